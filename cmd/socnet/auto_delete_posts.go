@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+)
+
+func autoDeletePosts(ctx context.Context, cfg config, args []string) error {
+	var dryRun bool
+	fs := flag.NewFlagSet("auto-delete-posts", flag.ExitOnError)
+	fs.BoolVar(&dryRun, "dry-run", false, "report how many posts would be deleted without deleting them")
+	fs.Parse(args)
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	s, err := newService(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	n, err := s.AutoDeletePosts(ctx, dryRun)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		log.Printf("would delete %d posts\n", n)
+		return nil
+	}
+
+	log.Printf("deleted %d posts\n", n)
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/djomlaa/socnet"
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+func backup(ctx context.Context, cfg config, args []string) error {
+	var out string
+	var withMedia bool
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	fs.StringVar(&out, "out", "", "gzipped tar archive to write")
+	fs.BoolVar(&withMedia, "media", true, "include the avatar, media and emoji files")
+	fs.Parse(args)
+
+	if out == "" {
+		return errors.New("-out is required")
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	s, err := newService(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	// Written aside and renamed, so a failed backup doesn't replace a good one.
+	f, err := os.CreateTemp(filepath.Dir(out), ".backup-*")
+	if err != nil {
+		return fmt.Errorf("could not create backup file: %v", err)
+	}
+
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	m, err := s.Backup(ctx, f, withMedia)
+	if err != nil {
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("could not close backup file: %v", err)
+	}
+
+	if err = os.Rename(f.Name(), out); err != nil {
+		return fmt.Errorf("could not rename backup file: %v", err)
+	}
+
+	logBackup("backed up", m)
+	return nil
+}
+
+func restore(ctx context.Context, cfg config, args []string) error {
+	var file string
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	fs.StringVar(&file, "file", "", "archive written by backup")
+	fs.Parse(args)
+
+	if file == "" {
+		return errors.New("-file is required")
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("could not open backup file: %v", err)
+	}
+
+	defer f.Close()
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	s, err := newService(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	m, err := s.Restore(ctx, f, socnet.SchemaFor(cfg.schema))
+	if err == service.ErrSchemaExists {
+		return fmt.Errorf("schema %s already exists, restore only into a fresh database", cfg.schema)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	logBackup("restored", m)
+	return nil
+}
+
+func logBackup(verb string, m service.BackupManifest) {
+	var rows int
+	for _, t := range m.Tables {
+		rows += t.Rows
+	}
+
+	media := "listed"
+	if m.MediaIncluded {
+		media = "included"
+	}
+
+	log.Printf("%s %d rows of %d tables, %d media files %s\n", verb, rows, len(m.Tables), len(m.Media), media)
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Operations of the bench workload.
+const (
+	benchPost     = "post"
+	benchTimeline = "timeline"
+	benchFollow   = "follow"
+	// benchFanout is the delay until a post shows on the timeline of a follower.
+	benchFanout = "fanout"
+)
+
+// benchFanoutTimeout is how long a sampled post is waited for on a follower timeline.
+const benchFanoutTimeout = time.Second * 30
+
+type benchUser struct {
+	username string
+	token    string
+}
+
+type bencher struct {
+	target *url.URL
+	client *http.Client
+	users  []benchUser
+	// followers of each user, by index in users.
+	followers map[int]map[int]bool
+	pages     int
+	fanout    float64
+	mu        sync.Mutex
+	rnd       *rand.Rand
+	samples   map[string][]time.Duration
+	errors    map[string]int
+	wg        sync.WaitGroup
+}
+
+// bench creates its own users on the target instance, then runs the workload
+// mix against its API with concurrent workers and reports latency percentiles
+// of each operation. Timeline reads follow the next page links, and a sample
+// of the posts is waited for on a follower timeline to measure the fanout delay.
+// Users are created through signup and log in by email, so it can't run against
+// instances requiring single sign-on. The post and follow rate limits of the
+// target apply, and count as errors, so raise them in its settings for heavy
+// runs. Not meant for production instances.
+func bench(ctx context.Context, cfg config, args []string) error {
+	var (
+		target      string
+		users       int
+		follows     int
+		concurrency int
+		duration    time.Duration
+		mix         string
+		pages       int
+		fanout      float64
+		randSeed    int64
+	)
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	fs.StringVar(&target, "target", cfg.origin, "origin of the instance to load")
+	fs.IntVar(&users, "users", 50, "users to create")
+	fs.IntVar(&follows, "follows", 10, "followees per user to start with")
+	fs.IntVar(&concurrency, "concurrency", 10, "concurrent workers")
+	fs.DurationVar(&duration, "duration", time.Minute, "how long to run the workload")
+	fs.StringVar(&mix, "mix", "post=1,timeline=8,follow=1", "weight of each operation")
+	fs.IntVar(&pages, "pages", 2, "timeline pages read each time")
+	fs.Float64Var(&fanout, "fanout-sample", 0.1, "fraction of the posts whose fanout delay is measured")
+	fs.Int64Var(&randSeed, "seed", time.Now().UnixNano(), "random seed")
+	fs.Parse(args)
+
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid -target %q", target)
+	}
+
+	if users < 2 || concurrency < 1 || pages < 1 {
+		return errors.New("-users must be at least 2, -concurrency and -pages at least 1")
+	}
+
+	weights, err := parseBenchMix(mix)
+	if err != nil {
+		return err
+	}
+
+	b := &bencher{
+		target:    u,
+		client:    &http.Client{Timeout: time.Second * 30},
+		pages:     pages,
+		fanout:    fanout,
+		followers: map[int]map[int]bool{},
+		rnd:       rand.New(rand.NewSource(randSeed)),
+		samples:   map[string][]time.Duration{},
+		errors:    map[string]int{},
+	}
+
+	log.Printf("creating %d users on %s\n", users, target)
+	if err = b.setup(ctx, users, follows); err != nil {
+		return err
+	}
+
+	log.Printf("running %s with %d workers\n", duration, concurrency)
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	start := time.Now()
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for ctx.Err() == nil {
+				b.run(ctx, b.pick(weights))
+			}
+		}()
+	}
+
+	workers.Wait()
+	elapsed := time.Since(start)
+	// Let the sampled posts finish their fanout.
+	b.wg.Wait()
+
+	b.report(os.Stdout, elapsed)
+	return nil
+}
+
+// parseBenchMix from op=weight pairs separated by commas.
+func parseBenchMix(s string) (map[string]int, error) {
+	weights := map[string]int{}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid -mix pair %q, must be op=weight", pair)
+		}
+
+		op := parts[0]
+		if op != benchPost && op != benchTimeline && op != benchFollow {
+			return nil, fmt.Errorf("invalid -mix operation %q, must be post, timeline or follow", op)
+		}
+
+		w, err := strconv.Atoi(parts[1])
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid -mix weight %q", parts[1])
+		}
+
+		weights[op] = w
+	}
+
+	var total int
+	for _, w := range weights {
+		total += w
+	}
+
+	if total == 0 {
+		return nil, errors.New("-mix weights add up to 0")
+	}
+
+	return weights, nil
+}
+
+// setup creates and logs in the users, and has each follow some others.
+func (b *bencher) setup(ctx context.Context, users, follows int) error {
+	prefix := "bench" + strconv.FormatInt(time.Now().Unix()%1e6, 36)
+	for i := 0; i < users; i++ {
+		username := fmt.Sprintf("%s_%d", prefix, i)
+		email := username + "@example.org"
+		in := map[string]string{"email": email, "username": username}
+		if err := b.do(ctx, "", http.MethodPost, "/api/users", in, nil); err != nil {
+			return fmt.Errorf("could not create user: %v", err)
+		}
+
+		var out struct{ Token string }
+		if err := b.do(ctx, "", http.MethodPost, "/api/login", map[string]string{"email": email}, &out); err != nil {
+			return fmt.Errorf("could not login: %v", err)
+		}
+
+		b.users = append(b.users, benchUser{username: username, token: out.Token})
+	}
+
+	for i := range b.users {
+		for _, j := range b.rnd.Perm(len(b.users))[:minInt(follows, len(b.users))] {
+			if j == i {
+				continue
+			}
+
+			if err := b.toggleFollow(ctx, i, j); err != nil {
+				return fmt.Errorf("could not follow: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// toggleFollow of the followee by the follower, keeping track of the followers.
+func (b *bencher) toggleFollow(ctx context.Context, follower, followee int) error {
+	var out struct{ Following bool }
+	path := "/api/users/" + b.users[followee].username + "/toggle_follow"
+	if err := b.do(ctx, b.users[follower].token, http.MethodPost, path, nil, &out); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.followers[followee] == nil {
+		b.followers[followee] = map[int]bool{}
+	}
+	if out.Following {
+		b.followers[followee][follower] = true
+	} else {
+		delete(b.followers[followee], follower)
+	}
+	return nil
+}
+
+func (b *bencher) pick(weights map[string]int) string {
+	var total int
+	for _, w := range weights {
+		total += w
+	}
+
+	b.mu.Lock()
+	n := b.rnd.Intn(total)
+	b.mu.Unlock()
+	for _, op := range []string{benchPost, benchTimeline, benchFollow} {
+		if n < weights[op] {
+			return op
+		}
+		n -= weights[op]
+	}
+	return benchTimeline
+}
+
+// user picks the index of a random user.
+func (b *bencher) user() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rnd.Intn(len(b.users))
+}
+
+// follower picks a random follower of the user to measure the fanout of their
+// post on, or -1 when they have none or the post isn't sampled.
+func (b *bencher) follower(i int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.followers[i]) == 0 || b.rnd.Float64() >= b.fanout {
+		return -1
+	}
+
+	ff := make([]int, 0, len(b.followers[i]))
+	for f := range b.followers[i] {
+		ff = append(ff, f)
+	}
+	sort.Ints(ff)
+	return ff[b.rnd.Intn(len(ff))]
+}
+
+func (b *bencher) run(ctx context.Context, op string) {
+	i := b.user()
+	u := b.users[i]
+	switch op {
+	case benchPost:
+		var out struct {
+			Post struct{ ID int64 }
+		}
+		in := map[string]string{"content": "bench post " + strconv.FormatInt(time.Now().UnixNano(), 36)}
+		start := time.Now()
+		err := b.do(ctx, u.token, http.MethodPost, "/api/posts", in, &out)
+		if !b.record(ctx, op, start, err) {
+			return
+		}
+
+		if f := b.follower(i); f != -1 {
+			b.wg.Add(1)
+			go b.waitFanout(b.users[f], out.Post.ID, start)
+		}
+	case benchTimeline:
+		path := "/api/timeline"
+		for i := 0; i < b.pages && path != ""; i++ {
+			start := time.Now()
+			var err error
+			path, err = b.timelinePage(ctx, u.token, path, nil)
+			if !b.record(ctx, op, start, err) {
+				return
+			}
+		}
+	case benchFollow:
+		followee := b.user()
+		if followee == i {
+			return
+		}
+
+		start := time.Now()
+		err := b.toggleFollow(ctx, i, followee)
+		b.record(ctx, op, start, err)
+	}
+}
+
+// waitFanout polls the timeline of a follower of the author until the post shows up.
+func (b *bencher) waitFanout(u benchUser, postID int64, start time.Time) {
+	defer b.wg.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), benchFanoutTimeout)
+	defer cancel()
+
+	for ctx.Err() == nil {
+		var ids []int64
+		_, err := b.timelinePage(ctx, u.token, "/api/timeline?last=20", &ids)
+		if err != nil {
+			b.record(ctx, benchFanout, start, err)
+			return
+		}
+
+		for _, id := range ids {
+			if id == postID {
+				b.record(ctx, benchFanout, start, nil)
+				return
+			}
+		}
+
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	b.record(context.Background(), benchFanout, start, errors.New("post not delivered"))
+}
+
+// timelinePage reads a page of the timeline, giving its post ids,
+// and returns the path of the next page, if any.
+func (b *bencher) timelinePage(ctx context.Context, token, path string, postIDs *[]int64) (string, error) {
+	var items []struct {
+		Post struct{ ID int64 }
+	}
+	req, err := b.request(ctx, token, http.MethodGet, path, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if err = decodeBenchResponse(resp, &items); err != nil {
+		return "", err
+	}
+
+	if postIDs != nil {
+		for _, it := range items {
+			*postIDs = append(*postIDs, it.Post.ID)
+		}
+	}
+
+	link := resp.Header.Get("Link")
+	if i, j := strings.Index(link, "<"), strings.Index(link, ">"); i != -1 && j > i && strings.Contains(link, `rel="next"`) {
+		return link[i+1 : j], nil
+	}
+
+	return "", nil
+}
+
+func (b *bencher) do(ctx context.Context, token, method, path string, in, out interface{}) error {
+	req, err := b.request(ctx, token, method, path, in)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	return decodeBenchResponse(resp, out)
+}
+
+func (b *bencher) request(ctx context.Context, token, method, path string, in interface{}) (*http.Request, error) {
+	var body io.Reader
+	if in != nil {
+		buf, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+
+		body = bytes.NewReader(buf)
+	}
+
+	u, err := b.target.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return req, nil
+}
+
+func decodeBenchResponse(resp *http.Response, out interface{}) error {
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+
+	if out == nil {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// record the latency of the operation, or its error, reporting whether it succeeded.
+// Requests cut by the end of the run are not recorded.
+func (b *bencher) record(ctx context.Context, op string, start time.Time, err error) bool {
+	if ctx.Err() != nil && op != benchFanout {
+		return false
+	}
+
+	d := time.Since(start)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		if b.errors[op]++; b.errors[op] <= 3 {
+			log.Printf("%s: %v\n", op, err)
+		}
+		return false
+	}
+
+	b.samples[op] = append(b.samples[op], d)
+	return true
+}
+
+func (b *bencher) report(w io.Writer, elapsed time.Duration) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\tcount\terrors\trate/s\tp50\tp90\tp99\tmax\t")
+	for _, op := range []string{benchPost, benchTimeline, benchFollow, benchFanout} {
+		dd := b.samples[op]
+		if len(dd) == 0 && b.errors[op] == 0 {
+			continue
+		}
+
+		sort.Slice(dd, func(i, j int) bool { return dd[i] < dd[j] })
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t\n", op, len(dd), b.errors[op],
+			float64(len(dd))/elapsed.Seconds(),
+			benchPercentile(dd, 0.5), benchPercentile(dd, 0.9), benchPercentile(dd, 0.99), benchPercentile(dd, 1))
+	}
+	tw.Flush()
+}
+
+// benchPercentile of the sorted durations, by the nearest rank.
+func benchPercentile(dd []time.Duration, p float64) time.Duration {
+	if len(dd) == 0 {
+		return 0
+	}
+
+	i := int(p*float64(len(dd))+0.5) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(dd) {
+		i = len(dd) - 1
+	}
+	return dd[i].Round(time.Microsecond * 100)
+}
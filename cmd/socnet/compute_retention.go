@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+func computeRetention(ctx context.Context, cfg config, args []string) error {
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	s, err := newService(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	n, err := s.ComputeRetention(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("computed %d cohort retention weeks\n", n)
+	return nil
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/hako/branca"
+	// postgres driver.
+	"github.com/djomlaa/socnet/internal/handler"
+	"github.com/djomlaa/socnet/internal/mailer"
+	"github.com/djomlaa/socnet/internal/pubsub"
+	"github.com/djomlaa/socnet/internal/purge"
+	"github.com/djomlaa/socnet/internal/push"
+	"github.com/djomlaa/socnet/internal/s3"
+	"github.com/djomlaa/socnet/internal/scan"
+	"github.com/djomlaa/socnet/internal/sqs"
+	"github.com/djomlaa/socnet/internal/sso"
+	"github.com/djomlaa/socnet/internal/translate"
+	_ "github.com/lib/pq"
+)
+
+const (
+	host     = "localhost"
+	dbport   = 5432
+	user     = "postgres"
+	password = "postgres"
+	dbname   = "postgres"
+	schema   = "socnet"
+)
+
+// Outgoing mail is sent in the background by a few workers.
+const (
+	mailQueueSize    = 1000
+	mailQueueWorkers = 2
+)
+
+type config struct {
+	port        string
+	origin      string
+	brancaKey   string
+	databaseURL string
+
+	// host and schema are set on the config of a tenant.
+	host    string
+	schema  string
+	tenants []tenant
+
+	translateProvider string
+	translateAPIKey   string
+	translateURL      string
+
+	pubsub string
+	mailer mailer.Config
+	// mailWebhookSecret is the token query parameter of the SNS subscription URL
+	// for SES, or the webhook signing key for Mailgun.
+	mailWebhookSecret string
+
+	fcmCredentialsFile string
+	apnsKeyFile        string
+	apnsKeyID          string
+	apnsTeamID         string
+	apnsTopic          string
+	apnsProduction     bool
+
+	scanProvider string
+	// scanAddr is the clamd socket for ClamAV or the endpoint of the scanning API.
+	scanAddr   string
+	scanAPIKey string
+
+	purgeProvider string
+	// purgeZone is the Cloudflare zone id.
+	purgeZone     string
+	purgeAPIToken string
+
+	// fanout is the strategy delivering new posts to timelines.
+	fanout string
+	// fanoutQueue is used by the sqs fanout.
+	fanoutQueue sqs.Client
+
+	// s3 is used for direct uploads when a bucket is set.
+	s3 s3.Client
+
+	// ldap enables logging in with a directory when its URL is set.
+	ldap sso.LDAP
+	// oidcIssuer enables logging in with an OpenID Connect provider when set.
+	oidcIssuer       string
+	oidcClientID     string
+	oidcClientSecret string
+	// oidcRedirectURL defaults to /login/oidc/callback on the origin,
+	// where the client posts the code and state to /api/login/oidc.
+	oidcRedirectURL string
+	oidcGroupsClaim string
+	// oidcTrustUnverifiedEmail accepts ID tokens missing the email_verified claim.
+	oidcTrustUnverifiedEmail bool
+	// ssoRoles maps the groups of the identity provider to roles.
+	ssoRoles map[string]string
+
+	// settingsFile holds the settings reloaded on SIGHUP.
+	settingsFile string
+
+	// deadlines of the API requests. The request one should stay under
+	// writeTimeout so the client gets a 504 before the connection closes.
+	deadlines handler.Deadlines
+	// accessLogSample of the successful requests to high volume routes.
+	accessLogSample float64
+	// debug serves the runtime profiles under /debug to admins.
+	debug bool
+}
+
+func loadConfig() (config, error) {
+	var cfg config
+	cfg.port = env("PORT", "8789")
+	cfg.origin = env("ORIGIN", "http://localhost:"+cfg.port)
+	cfg.brancaKey = env("BRANCA_KEY", "supersecretkeyyoushouldnotcommit")
+	cfg.databaseURL = env("DATABASE_URL", fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable search_path=%s,public",
+		host, dbport, user, password, dbname, schema))
+	cfg.schema = schema
+	cfg.translateProvider = env("TRANSLATE_PROVIDER", "")
+	cfg.translateAPIKey = env("TRANSLATE_API_KEY", "")
+	cfg.translateURL = env("TRANSLATE_URL", "")
+	cfg.pubsub = env("PUBSUB", "local")
+	cfg.mailer = mailer.Config{
+		Provider:           env("MAILER_PROVIDER", mailer.ProviderLog),
+		From:               env("MAIL_FROM", "socnet <noreply@localhost>"),
+		SMTPAddr:           env("SMTP_ADDR", "localhost:25"),
+		SMTPUsername:       env("SMTP_USERNAME", ""),
+		SMTPPassword:       env("SMTP_PASSWORD", ""),
+		SESRegion:          env("SES_REGION", "us-east-1"),
+		SESAccessKeyID:     env("AWS_ACCESS_KEY_ID", ""),
+		SESSecretAccessKey: env("AWS_SECRET_ACCESS_KEY", ""),
+		MailgunDomain:      env("MAILGUN_DOMAIN", ""),
+		MailgunAPIKey:      env("MAILGUN_API_KEY", ""),
+		MailgunBaseURL:     env("MAILGUN_URL", ""),
+	}
+	cfg.mailWebhookSecret = env("MAIL_WEBHOOK_SECRET", "")
+	cfg.fcmCredentialsFile = env("FCM_CREDENTIALS_FILE", "")
+	cfg.apnsKeyFile = env("APNS_KEY_FILE", "")
+	cfg.apnsKeyID = env("APNS_KEY_ID", "")
+	cfg.apnsTeamID = env("APNS_TEAM_ID", "")
+	cfg.apnsTopic = env("APNS_TOPIC", "")
+	cfg.apnsProduction = env("APNS_PRODUCTION", "") == "true"
+	cfg.scanProvider = env("SCAN_PROVIDER", "")
+	cfg.scanAddr = env("SCAN_ADDR", "")
+	cfg.scanAPIKey = env("SCAN_API_KEY", "")
+	cfg.purgeProvider = env("PURGE_PROVIDER", "")
+	cfg.purgeZone = env("PURGE_ZONE", "")
+	cfg.purgeAPIToken = env("PURGE_API_TOKEN", "")
+	cfg.settingsFile = env("SETTINGS_FILE", "")
+	cfg.debug = env("DEBUG_ENDPOINTS", "") == "true"
+	cfg.ldap = sso.LDAP{
+		URL:          env("LDAP_URL", ""),
+		BindDN:       env("LDAP_BIND_DN", ""),
+		BindPassword: env("LDAP_BIND_PASSWORD", ""),
+		BaseDN:       env("LDAP_BASE_DN", ""),
+		EmailAttr:    env("LDAP_EMAIL_ATTR", ""),
+		UsernameAttr: env("LDAP_USERNAME_ATTR", ""),
+		GroupsAttr:   env("LDAP_GROUPS_ATTR", ""),
+	}
+	cfg.oidcIssuer = env("OIDC_ISSUER", "")
+	cfg.oidcClientID = env("OIDC_CLIENT_ID", "")
+	cfg.oidcClientSecret = env("OIDC_CLIENT_SECRET", "")
+	cfg.oidcRedirectURL = env("OIDC_REDIRECT_URL", "")
+	cfg.oidcGroupsClaim = env("OIDC_GROUPS_CLAIM", "")
+	cfg.oidcTrustUnverifiedEmail = env("OIDC_TRUST_UNVERIFIED_EMAIL", "") == "true"
+
+	var err error
+	if cfg.ssoRoles, err = parseSSORoles(env("SSO_ROLES", "")); err != nil {
+		return cfg, err
+	}
+
+	if cfg.deadlines.Request, err = time.ParseDuration(env("REQUEST_TIMEOUT", "20s")); err != nil {
+		return cfg, fmt.Errorf("invalid REQUEST_TIMEOUT: %v", err)
+	}
+
+	if cfg.deadlines.Upload, err = time.ParseDuration(env("UPLOAD_TIMEOUT", "5m")); err != nil {
+		return cfg, fmt.Errorf("invalid UPLOAD_TIMEOUT: %v", err)
+	}
+
+	cfg.accessLogSample, err = strconv.ParseFloat(env("ACCESS_LOG_SAMPLE", "0.1"), 64)
+	if err != nil || cfg.accessLogSample < 0 || cfg.accessLogSample > 1 {
+		return cfg, fmt.Errorf("invalid ACCESS_LOG_SAMPLE, must be between 0 and 1")
+	}
+	cfg.fanout = env("FANOUT", service.FanoutQueue)
+	cfg.fanoutQueue = sqs.Client{
+		QueueURL:        env("FANOUT_QUEUE_URL", ""),
+		Region:          env("SQS_REGION", "us-east-1"),
+		AccessKeyID:     env("AWS_ACCESS_KEY_ID", ""),
+		SecretAccessKey: env("AWS_SECRET_ACCESS_KEY", ""),
+	}
+	cfg.s3 = s3.Client{
+		Bucket:          env("S3_BUCKET", ""),
+		Region:          env("S3_REGION", "us-east-1"),
+		AccessKeyID:     env("AWS_ACCESS_KEY_ID", ""),
+		SecretAccessKey: env("AWS_SECRET_ACCESS_KEY", ""),
+		Endpoint:        env("S3_ENDPOINT", ""),
+	}
+
+	tenantsFile := env("TENANTS_FILE", "")
+	if tenantsFile == "" {
+		return cfg, nil
+	}
+
+	tenants, err := loadTenants(tenantsFile)
+	if err != nil {
+		return cfg, err
+	}
+
+	cfg.tenants = tenants
+
+	// serve, migrate and fanout work on every tenant;
+	// other commands on the one selected with TENANT.
+	tenantHost := strings.ToLower(env("TENANT", ""))
+	if tenantHost == "" {
+		return cfg, nil
+	}
+
+	for _, t := range tenants {
+		if t.Host == tenantHost {
+			return cfg.forTenant(t)
+		}
+	}
+
+	return cfg, fmt.Errorf("unknown tenant %q", tenantHost)
+}
+
+// parseSSORoles from group=role pairs separated by semicolons, as LDAP group DNs
+// have commas. The role is after the last equal sign, for the same reason.
+func parseSSORoles(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	roles := map[string]string{}
+	for _, pair := range strings.Split(s, ";") {
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid SSO_ROLES pair %q, must be group=role", pair)
+		}
+
+		group, role := strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])
+		if role != service.RoleUser && role != service.RoleModerator && role != service.RoleAdmin {
+			return nil, fmt.Errorf("invalid SSO_ROLES role %q", role)
+		}
+
+		roles[group] = role
+	}
+
+	return roles, nil
+}
+
+// Connecting to the database is retried with a backoff doubling up to
+// dbConnectMaxBackoff, as it may still be starting along with the app.
+// It gives up after about 35 seconds of waiting.
+const (
+	dbConnectAttempts   = 8
+	dbConnectBackoff    = 500 * time.Millisecond
+	dbConnectMaxBackoff = 10 * time.Second
+	dbPingTimeout       = 5 * time.Second
+)
+
+func openDB(cfg config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not open db connection: %v", err)
+	}
+
+	backoff := dbConnectBackoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), dbPingTimeout)
+		err = db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return db, nil
+		}
+
+		if attempt == dbConnectAttempts {
+			db.Close()
+			return nil, fmt.Errorf("could not ping to db after %d attempts: %v", attempt, err)
+		}
+
+		log.Printf("could not ping to db (attempt %d/%d), retrying in %s: %v\n", attempt, dbConnectAttempts, backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > dbConnectMaxBackoff {
+			backoff = dbConnectMaxBackoff
+		}
+	}
+}
+
+func newService(cfg config, db *sql.DB) (*service.Service, error) {
+	codec := branca.NewBranca(cfg.brancaKey)
+	codec.SetTTL(uint32(service.TokenLifespan.Seconds()))
+
+	translator, err := translate.New(cfg.translateProvider, cfg.translateAPIKey, cfg.translateURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not create translator: %v", err)
+	}
+
+	ps, err := newPubSub(cfg, db)
+	if err != nil {
+		return nil, err
+	}
+
+	sender, err := mailer.New(cfg.mailer)
+	if err != nil {
+		return nil, fmt.Errorf("could not create mailer: %v", err)
+	}
+
+	pusher, err := newPush(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner, err := scan.New(cfg.scanProvider, cfg.scanAddr, cfg.scanAPIKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not create scanner: %v", err)
+	}
+
+	purger, err := purge.New(cfg.purgeProvider, cfg.purgeZone, cfg.purgeAPIToken)
+	if err != nil {
+		return nil, fmt.Errorf("could not create purger: %v", err)
+	}
+
+	var fanoutQueue *sqs.Client
+	switch cfg.fanout {
+	case service.FanoutSync, service.FanoutQueue, service.FanoutOutbox:
+	case service.FanoutSQS:
+		if cfg.fanoutQueue.QueueURL == "" {
+			return nil, fmt.Errorf("sqs fanout needs FANOUT_QUEUE_URL")
+		}
+		fanoutQueue = &cfg.fanoutQueue
+	default:
+		return nil, fmt.Errorf("unknown fanout %q", cfg.fanout)
+	}
+
+	var objects *s3.Client
+	if cfg.s3.Bucket != "" {
+		objects = &cfg.s3
+	}
+
+	var ldap *sso.LDAP
+	if cfg.ldap.URL != "" {
+		ldap = &cfg.ldap
+	}
+
+	var oidc *sso.OIDC
+	if cfg.oidcIssuer != "" {
+		if cfg.oidcClientID == "" || cfg.oidcClientSecret == "" {
+			return nil, fmt.Errorf("oidc login needs OIDC_CLIENT_ID and OIDC_CLIENT_SECRET")
+		}
+
+		oidc = &sso.OIDC{
+			Issuer:               cfg.oidcIssuer,
+			ClientID:             cfg.oidcClientID,
+			ClientSecret:         cfg.oidcClientSecret,
+			RedirectURL:          cfg.oidcRedirectURL,
+			GroupsClaim:          cfg.oidcGroupsClaim,
+			TrustUnverifiedEmail: cfg.oidcTrustUnverifiedEmail,
+		}
+		if oidc.RedirectURL == "" {
+			oidc.RedirectURL = strings.TrimSuffix(cfg.origin, "/") + "/login/oidc/callback"
+		}
+	}
+
+	s := service.New(service.Config{
+		DB:          db,
+		Codec:       codec,
+		Origin:      cfg.origin,
+		Translator:  translator,
+		PubSub:      ps,
+		Mailer:      mailer.NewQueue(sender, mailQueueSize, mailQueueWorkers),
+		Push:        pusher,
+		Scanner:     scanner,
+		Objects:     objects,
+		Purger:      purger,
+		Fanout:      cfg.fanout,
+		FanoutQueue: fanoutQueue,
+		LDAP:        ldap,
+		OIDC:        oidc,
+		SSORoles:    cfg.ssoRoles,
+
+		MailWebhookSecret: cfg.mailWebhookSecret,
+		SettingsFile:      cfg.settingsFile,
+	})
+	if _, err = s.LoadSettings(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// newPubSub returns the backplane delivering events to subscribers. Use postgres
+// when running more than one instance so events reach every one of them.
+func newPubSub(cfg config, db *sql.DB) (pubsub.PubSub, error) {
+	switch cfg.pubsub {
+	case "local":
+		return pubsub.NewLocal(), nil
+	case "postgres":
+		ps, err := pubsub.NewPostgres(db, cfg.databaseURL, cfg.schema+"_events")
+		if err != nil {
+			return nil, fmt.Errorf("could not create postgres pubsub: %v", err)
+		}
+
+		return ps, nil
+	}
+
+	return nil, fmt.Errorf("unknown pubsub %q", cfg.pubsub)
+}
+
+// newPush returns a sender for the platforms with credentials configured,
+// or nil when there are none.
+func newPush(cfg config) (push.Sender, error) {
+	platforms := push.Platforms{}
+	if cfg.fcmCredentialsFile != "" {
+		fcm, err := push.NewFCM(cfg.fcmCredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+
+		platforms[push.PlatformAndroid] = fcm
+	}
+
+	if cfg.apnsKeyFile != "" {
+		apns, err := push.NewAPNs(cfg.apnsKeyFile, cfg.apnsKeyID, cfg.apnsTeamID, cfg.apnsTopic, cfg.apnsProduction)
+		if err != nil {
+			return nil, err
+		}
+
+		platforms[push.PlatformIOS] = apns
+	}
+
+	if len(platforms) == 0 {
+		return nil, nil
+	}
+
+	return platforms, nil
+}
+
+func env(key, fallbackValue string) string {
+	s := os.Getenv(key)
+	if s == "" {
+		return fallbackValue
+	}
+
+	return s
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+func countActiveUsers(ctx context.Context, cfg config, args []string) error {
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	s, err := newService(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	n, err := s.CountActiveUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("counted active users of %d days\n", n)
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+)
+
+func createAdmin(ctx context.Context, cfg config, args []string) error {
+	var email, username string
+	fs := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	fs.StringVar(&email, "email", "", "admin email")
+	fs.StringVar(&username, "username", "", "admin username, used when the user does not exist yet")
+	fs.Parse(args)
+
+	if email == "" {
+		return errors.New("-email is required")
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	s, err := newService(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	if err = s.CreateAdmin(ctx, email, username); err != nil {
+		return err
+	}
+
+	log.Printf("%s is an admin\n", email)
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+// fanout runs the fanout workers of every tenant, so they scale apart from
+// the http server. Only the outbox and sqs strategies take posts created by
+// other processes.
+func fanout(ctx context.Context, cfg config, args []string) error {
+	if cfg.fanout != service.FanoutOutbox && cfg.fanout != service.FanoutSQS {
+		return fmt.Errorf("the %s fanout runs within serve", cfg.fanout)
+	}
+
+	tenants, err := cfg.tenantConfigs()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, tcfg := range tenants {
+		db, err := openDB(tcfg)
+		if err != nil {
+			return err
+		}
+
+		defer db.Close()
+
+		s, err := newService(tcfg, db)
+		if err != nil {
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.FanoutPosts(ctx)
+		}()
+	}
+
+	log.Printf("fanning out posts with the %s strategy\n", cfg.fanout)
+	wg.Wait()
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/djomlaa/socnet/internal/archive"
+)
+
+func importArchive(ctx context.Context, cfg config, args []string) error {
+	var username, file string
+	var dryRun bool
+	fs := flag.NewFlagSet("import-archive", flag.ExitOnError)
+	fs.StringVar(&username, "username", "", "user to import the archive into")
+	fs.StringVar(&file, "file", "", "zipped Mastodon or Twitter export")
+	fs.BoolVar(&dryRun, "dry-run", false, "report what would be imported without writing")
+	fs.Parse(args)
+
+	if username == "" || file == "" {
+		return errors.New("-username and -file are required")
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("could not open archive: %v", err)
+	}
+
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat archive: %v", err)
+	}
+
+	a, err := archive.Read(f, fi.Size())
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	s, err := newService(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	report, err := s.ImportArchive(ctx, username, a, dryRun)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+// importPlacesBatch is how many places are written per transaction.
+const importPlacesBatch = 1000
+
+// importPlaces reads a GeoNames dump, like cities15000.txt, whose tab separated
+// columns are id, name, ascii name, alternate names, latitude, longitude,
+// feature class, feature code and country code, followed by others not used.
+func importPlaces(ctx context.Context, cfg config, args []string) error {
+	var file string
+	fs := flag.NewFlagSet("import-places", flag.ExitOnError)
+	fs.StringVar(&file, "file", "", "GeoNames dump to import")
+	fs.Parse(args)
+
+	if file == "" {
+		return errors.New("-file is required")
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("could not open places file: %v", err)
+	}
+
+	defer f.Close()
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	s, err := newService(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	var total int
+	batch := make([]service.Place, 0, importPlacesBatch)
+	flush := func() error {
+		n, err := s.ImportPlaces(ctx, batch)
+		total += n
+		batch = batch[:0]
+		return err
+	}
+
+	sc := bufio.NewScanner(f)
+	// Alternate names make some lines longer than the default buffer.
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		p, ok := parseGeoNamesPlace(sc.Text())
+		if !ok {
+			continue
+		}
+
+		if batch = append(batch, p); len(batch) == importPlacesBatch {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = sc.Err(); err != nil {
+		return fmt.Errorf("could not read places file: %v", err)
+	}
+
+	if err = flush(); err != nil {
+		return err
+	}
+
+	log.Printf("imported %d places\n", total)
+	return nil
+}
+
+func parseGeoNamesPlace(line string) (service.Place, bool) {
+	var p service.Place
+	cols := strings.Split(line, "\t")
+	if len(cols) < 9 {
+		return p, false
+	}
+
+	id, err := strconv.ParseInt(cols[0], 10, 64)
+	if err != nil {
+		return p, false
+	}
+
+	if p.Latitude, err = strconv.ParseFloat(cols[4], 64); err != nil {
+		return p, false
+	}
+
+	if p.Longitude, err = strconv.ParseFloat(cols[5], 64); err != nil {
+		return p, false
+	}
+
+	p.GeoNamesID = &id
+	p.Name = cols[1]
+	if cols[8] != "" {
+		p.Country = &cols[8]
+	}
+
+	return p, true
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, cfg config, args []string) error
+}
+
+var commands = map[string]command{
+	"serve":                {"start the http server", serve},
+	"migrate":              {"apply the database schema", migrate},
+	"create-admin":         {"create an admin user or promote an existing one", createAdmin},
+	"prune-timeline":       {"delete old timeline items", pruneTimeline},
+	"reindex-search":       {"rebuild the user and post search indexes", reindexSearch},
+	"user":                 {"look up and manage users", userAdmin},
+	"seed":                 {"fill the database with fake data for development", seed},
+	"import-archive":       {"import a Mastodon or Twitter export into an account", importArchive},
+	"import-places":        {"import places from a GeoNames dump for place autocomplete", importPlaces},
+	"auto-delete-posts":    {"delete posts past their author auto delete policy, meant to run from cron", autoDeletePosts},
+	"update-reputations":   {"recompute user reputations, meant to run from cron", updateReputations},
+	"refresh-leaderboards": {"recompute the leaderboards, meant to run from cron", refreshLeaderboards},
+	"send-weekly-insights": {"email opted in authors how their posts did this week, meant to run from cron", sendWeeklyInsights},
+	"fanout":               {"deliver new posts to timelines, apart from serve -fanout=false", fanout},
+	"rebuild-user-stats":   {"recount the followers, followees and posts of every user", rebuildUserStats},
+	"count-active-users":   {"count the daily, weekly and monthly active users, meant to run daily from cron", countActiveUsers},
+	"compute-retention":    {"compute the weekly retention of signup cohorts, meant to run from cron", computeRetention},
+	"backup":               {"write a consistent backup of the database and media files", backup},
+	"restore":              {"restore a backup into a fresh database", restore},
+	"bench":                {"load an instance with a synthetic workload and report latencies", bench},
+}
+
+func main() {
+	name := "serve"
+	args := os.Args[1:]
+	if len(args) != 0 {
+		name, args = args[0], args[1:]
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("could not load config: %v\n", err)
+	}
+
+	if err := cmd.run(context.Background(), cfg, args); err != nil {
+		log.Fatalf("%s: %v\n", name, err)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags]\n\ncommands:\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", name, commands[name].usage)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/djomlaa/socnet"
+)
+
+func migrate(ctx context.Context, cfg config, args []string) error {
+	tenants, err := cfg.tenantConfigs()
+	if err != nil {
+		return err
+	}
+
+	for _, tcfg := range tenants {
+		if err = migrateSchema(ctx, tcfg); err != nil {
+			return err
+		}
+	}
+
+	log.Println("schema applied")
+	return nil
+}
+
+func migrateSchema(ctx context.Context, cfg config) error {
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	if _, err = db.ExecContext(ctx, socnet.SchemaFor(cfg.schema)); err != nil {
+		return fmt.Errorf("could not apply schema %s: %v", cfg.schema, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+)
+
+func pruneTimeline(ctx context.Context, cfg config, args []string) error {
+	var olderThan time.Duration
+	fs := flag.NewFlagSet("prune-timeline", flag.ExitOnError)
+	fs.DurationVar(&olderThan, "older-than", time.Hour*24*30, "delete timeline items of posts older than this")
+	fs.Parse(args)
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	s, err := newService(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	n, err := s.PruneTimeline(ctx, time.Now().Add(-olderThan))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("deleted %d timeline items\n", n)
+	return nil
+}
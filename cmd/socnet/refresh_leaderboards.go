@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+func refreshLeaderboards(ctx context.Context, cfg config, args []string) error {
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	s, err := newService(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	if err = s.RefreshLeaderboards(ctx); err != nil {
+		return err
+	}
+
+	log.Println("refreshed leaderboards")
+	return nil
+}
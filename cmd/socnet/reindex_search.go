@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+func reindexSearch(ctx context.Context, cfg config, args []string) error {
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	s, err := newService(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	if err = s.ReindexSearch(ctx); err != nil {
+		return err
+	}
+
+	log.Println("search index rebuilt")
+	return nil
+}
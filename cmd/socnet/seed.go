@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+var seedNames = []string{
+	"ana", "marko", "jelena", "nikola", "milica", "stefan", "ivana", "luka",
+	"maja", "petar", "sara", "jovan", "tara", "filip", "mina", "david",
+	"alice", "bob", "carol", "dave", "erin", "frank", "grace", "heidi",
+}
+
+var seedWords = []string{
+	"coffee", "morning", "code", "release", "weekend", "football", "music", "book",
+	"rain", "sunny", "train", "deploy", "bug", "fixed", "finally", "new", "great",
+	"today", "tonight", "friends", "city", "walk", "dinner", "movie", "postgres",
+	"golang", "learned", "reading", "shipping", "travel", "mountain", "river",
+}
+
+func seed(ctx context.Context, cfg config, args []string) error {
+	var (
+		users, follows, posts, comments, likes int
+		randSeed                               int64
+		days                                   int
+	)
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	fs.IntVar(&users, "users", 50, "users to create")
+	fs.IntVar(&follows, "follows", 10, "max followees per user")
+	fs.IntVar(&posts, "posts", 5, "max posts per user")
+	fs.IntVar(&comments, "comments", 3, "max comments per post")
+	fs.IntVar(&likes, "likes", 8, "max likes per post and comment")
+	fs.IntVar(&days, "days", 30, "spread post dates over the last days")
+	fs.Int64Var(&randSeed, "seed", 1, "random seed, same seed generates the same data")
+	fs.Parse(args)
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	rnd := rand.New(rand.NewSource(randSeed))
+	now := time.Now().Truncate(time.Hour)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	uids := make([]int64, 0, users)
+	for i := 0; i < users; i++ {
+		username := fmt.Sprintf("%s_%d", seedNames[rnd.Intn(len(seedNames))], i)
+		var uid int64
+		query := `INSERT INTO users (email, username, username_skeleton) VALUES ($1, $2, $3)
+			ON CONFLICT (email) DO UPDATE SET email = EXCLUDED.email RETURNING id`
+		if err = tx.QueryRowContext(ctx, query, username+"@example.org", username, validation.UsernameSkeleton(username)).Scan(&uid); err != nil {
+			return fmt.Errorf("could not insert user: %v", err)
+		}
+
+		uids = append(uids, uid)
+	}
+
+	if len(uids) < 2 {
+		return fmt.Errorf("at least two users are needed")
+	}
+
+	for _, follower := range uids {
+		for _, j := range rnd.Perm(len(uids))[:rnd.Intn(minInt(follows, len(uids)-1)+1)] {
+			if uids[j] == follower {
+				continue
+			}
+
+			query := "INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+			if _, err = tx.ExecContext(ctx, query, follower, uids[j]); err != nil {
+				return fmt.Errorf("could not insert follow: %v", err)
+			}
+		}
+	}
+
+	var pids []int64
+	for _, uid := range uids {
+		for n := rnd.Intn(posts + 1); n > 0; n-- {
+			createdAt := now.Add(-time.Duration(rnd.Int63n(int64(days)*int64(time.Hour)*24 + 1)))
+			var pid int64
+			query := "INSERT INTO posts (user_id, content, nsfw, created_at) VALUES ($1, $2, $3, $4) RETURNING id"
+			if err = tx.QueryRowContext(ctx, query, uid, seedSentence(rnd), rnd.Intn(20) == 0, createdAt).Scan(&pid); err != nil {
+				return fmt.Errorf("could not insert post: %v", err)
+			}
+
+			pids = append(pids, pid)
+		}
+	}
+
+	for _, pid := range pids {
+		for n := rnd.Intn(comments + 1); n > 0; n-- {
+			var cid int64
+			query := "INSERT INTO comments (user_id, post_id, content) VALUES ($1, $2, $3) RETURNING id"
+			if err = tx.QueryRowContext(ctx, query, uids[rnd.Intn(len(uids))], pid, seedSentence(rnd)).Scan(&cid); err != nil {
+				return fmt.Errorf("could not insert comment: %v", err)
+			}
+
+			for m := rnd.Intn(likes + 1); m > 0; m-- {
+				query = "INSERT INTO comment_likes (user_id, comment_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+				if _, err = tx.ExecContext(ctx, query, uids[rnd.Intn(len(uids))], cid); err != nil {
+					return fmt.Errorf("could not insert comment like: %v", err)
+				}
+			}
+		}
+
+		for n := rnd.Intn(likes + 1); n > 0; n-- {
+			query := "INSERT INTO post_likes (user_id, post_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+			if _, err = tx.ExecContext(ctx, query, uids[rnd.Intn(len(uids))], pid); err != nil {
+				return fmt.Errorf("could not insert post like: %v", err)
+			}
+		}
+	}
+
+	// counters and timelines are derived from the inserted rows.
+	for _, query := range []string{
+		`INSERT INTO user_stats (user_id, followers_count, followees_count, posts_count)
+			SELECT id,
+				(SELECT count(*) FROM follows WHERE followee_id = users.id),
+				(SELECT count(*) FROM follows WHERE follower_id = users.id),
+				(SELECT count(*) FROM posts WHERE user_id = users.id)
+			FROM users
+			ON CONFLICT (user_id) DO UPDATE SET
+				followers_count = EXCLUDED.followers_count,
+				followees_count = EXCLUDED.followees_count,
+				posts_count = EXCLUDED.posts_count`,
+		`UPDATE posts SET
+			likes_count = (SELECT count(*) FROM post_likes WHERE post_id = posts.id),
+			comments_count = (SELECT count(*) FROM comments WHERE post_id = posts.id)`,
+		`UPDATE comments SET likes_count = (SELECT count(*) FROM comment_likes WHERE comment_id = comments.id)`,
+		`INSERT INTO timeline (user_id, post_id)
+			SELECT user_id, id FROM posts
+			UNION
+			SELECT follows.follower_id, posts.id FROM posts
+			INNER JOIN follows ON follows.followee_id = posts.user_id
+			ON CONFLICT DO NOTHING`,
+	} {
+		if _, err = tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("could not update seeded counters: %v", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit seed: %v", err)
+	}
+
+	log.Printf("seeded %d users and %d posts\n", len(uids), len(pids))
+	return nil
+}
+
+func seedSentence(rnd *rand.Rand) string {
+	words := make([]string, 3+rnd.Intn(12))
+	for i := range words {
+		words[i] = seedWords[rnd.Intn(len(seedWords))]
+	}
+
+	s := strings.Join(words, " ")
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/cursor"
+	"github.com/djomlaa/socnet/internal/handler"
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/djomlaa/socnet/web"
+)
+
+// Server limits guarding against slow clients holding connections open.
+// WriteTimeout bounds regular responses only: streaming handlers must clear
+// their own write deadline with http.ResponseController.
+const (
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 30 * time.Second
+	idleTimeout       = 2 * time.Minute
+	maxHeaderBytes    = 1 << 20
+)
+
+// drainTimeout is how long in flight requests have to finish on shutdown.
+const drainTimeout = 30 * time.Second
+
+// serve http until SIGINT or SIGTERM, then drain the connections. On SIGUSR2
+// it first starts the binary anew on the same listener, so a deploy replaces
+// the process without refusing connections. Event streams are ended rather
+// than waited for; clients reconnect to the new process. SIGHUP reloads the
+// settings file.
+func serve(ctx context.Context, cfg config, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.StringVar(&cfg.port, "port", cfg.port, "port to listen on")
+	fanout := fs.Bool("fanout", true, "run the fanout workers, which can run apart with the fanout command instead")
+	migrate := fs.Bool("migrate", false, "apply the database schema before serving")
+	fs.Parse(args)
+
+	tenants, err := cfg.tenantConfigs()
+	if err != nil {
+		return err
+	}
+
+	// Stops the background workers once the requests drained.
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	handlers := make(map[string]http.Handler, len(tenants))
+	services := make([]*service.Service, 0, len(tenants))
+	dbs := make([]*sql.DB, 0, len(tenants))
+	for _, tcfg := range tenants {
+		if *migrate {
+			if err = migrateSchema(ctx, tcfg); err != nil {
+				return err
+			}
+		}
+
+		db, err := openDB(tcfg)
+		if err != nil {
+			return err
+		}
+
+		defer db.Close()
+		dbs = append(dbs, db)
+
+		s, err := newService(tcfg, db)
+		if err != nil {
+			return err
+		}
+
+		services = append(services, s)
+		go s.NotifyLikes(ctx)
+		go s.ProjectUserStats(ctx)
+		go s.ResumeFollowImports(ctx)
+		go s.PruneTusUploads(ctx)
+		if *fanout {
+			go s.FanoutPosts(ctx)
+		}
+
+		handlers[tcfg.host] = handler.New(s, cursor.New(tcfg.brancaKey), web.Static(), handler.Options{
+			Deadlines:       tcfg.deadlines,
+			AccessLogSample: tcfg.accessLogSample,
+			Debug:           tcfg.debug,
+		})
+	}
+
+	ln, err := listen(cfg.port)
+	if err != nil {
+		return err
+	}
+
+	// Closed on shutdown to end the event streams.
+	streamsDone := make(chan struct{})
+	baseCtx := handler.WithStreamsDone(context.Background(), streamsDone)
+
+	srv := &http.Server{
+		Handler:           tenantsHandler(handlers),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+	}
+	srv.RegisterOnShutdown(func() { close(streamsDone) })
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(ln)
+	}()
+
+	log.Printf("accepting connections on port %s", cfg.port)
+	notifyUpgraded()
+	sdReady()
+
+	// A hung database pool, like one exhausted by leaked connections, stops
+	// the heartbeats so systemd restarts the process.
+	go sdWatchdog(ctx, func(ctx context.Context) error {
+		for _, db := range dbs {
+			if err := db.PingContext(ctx); err != nil {
+				return fmt.Errorf("could not ping to db: %v", err)
+			}
+		}
+		return nil
+	})
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR2, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case err = <-errs:
+			return err
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				reloadSettings(services)
+				continue
+			}
+
+			if sig == syscall.SIGUSR2 {
+				if err = upgrade(ln); err != nil {
+					log.Printf("could not upgrade: %v\n", err)
+					continue
+				}
+			} else {
+				sdNotify("STOPPING=1")
+			}
+
+			log.Printf("draining connections for up to %s\n", drainTimeout)
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+			defer cancel()
+
+			if err = srv.Shutdown(shutdownCtx); err != nil {
+				return fmt.Errorf("could not drain connections: %v", err)
+			}
+
+			return nil
+		}
+	}
+}
+
+// reloadSettings of every tenant from the settings file.
+func reloadSettings(services []*service.Service) {
+	for _, s := range services {
+		if _, err := s.LoadSettings(); err != nil {
+			log.Printf("could not reload settings: %v\n", err)
+			return
+		}
+	}
+
+	log.Println("reloaded settings")
+}
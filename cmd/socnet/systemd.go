@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends the state to systemd, as in sd_notify(3). It does nothing
+// unless the process runs as a Type=notify service.
+func sdNotify(state string) {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return
+	}
+
+	// Abstract socket.
+	if name[0] == '@' {
+		name = "\x00" + name[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		log.Printf("could not connect to systemd notify socket: %v\n", err)
+		return
+	}
+
+	defer conn.Close()
+
+	if _, err = conn.Write([]byte(state)); err != nil {
+		log.Printf("could not notify systemd: %v\n", err)
+	}
+}
+
+// sdReady tells systemd the service is ready and that this process is its main
+// one, which it becomes after an upgrade. The unit needs NotifyAccess=all for
+// systemd to accept it from the new process.
+func sdReady() {
+	sdNotify(fmt.Sprintf("READY=1\nMAINPID=%d", os.Getpid()))
+}
+
+// sdWatchdogInterval returns how often to send watchdog heartbeats, which is half
+// the WatchdogSec of the unit, or zero when the watchdog is disabled.
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	// An upgraded process inherits the pid of the previous one,
+	// but takes over as the main process when ready.
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) && os.Getenv(listenerFDEnv) == "" {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// sdWatchdog sends a heartbeat to systemd at each interval that alive succeeds,
+// until ctx is done. Once heartbeats stop for the WatchdogSec of the unit,
+// systemd restarts the service.
+func sdWatchdog(ctx context.Context, alive func(ctx context.Context) error) {
+	interval := sdWatchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			checkCtx, cancel := context.WithTimeout(ctx, interval)
+			err := alive(checkCtx)
+			cancel()
+			if err != nil {
+				log.Printf("skipping watchdog heartbeat: %v\n", err)
+				continue
+			}
+
+			sdNotify("WATCHDOG=1")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var reSchema = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// tenant is an isolated instance hosted by the same binary,
+// with its own database schema, origin and token key.
+// Requests are routed to a tenant by their Host header.
+type tenant struct {
+	Host      string `json:"host"`
+	Schema    string `json:"schema"`
+	Origin    string `json:"origin"`
+	BrancaKey string `json:"brancaKey"`
+	// FanoutQueueURL is the SQS queue of the tenant with the sqs fanout.
+	// Tenants can't share one, as workers take any post from their queue.
+	FanoutQueueURL string `json:"fanoutQueueUrl"`
+}
+
+// loadTenants reads the JSON array of tenants from filename.
+func loadTenants(filename string) ([]tenant, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read tenants file: %v", err)
+	}
+
+	var tt []tenant
+	if err = json.Unmarshal(b, &tt); err != nil {
+		return nil, fmt.Errorf("could not parse tenants file: %v", err)
+	}
+
+	if len(tt) == 0 {
+		return nil, fmt.Errorf("tenants file has no tenants")
+	}
+
+	hosts := map[string]bool{}
+	schemas := map[string]bool{}
+	for i, t := range tt {
+		t.Host = strings.ToLower(strings.TrimSpace(t.Host))
+		if t.Host == "" || hosts[t.Host] {
+			return nil, fmt.Errorf("tenant %d: missing or duplicated host %q", i, t.Host)
+		}
+
+		if !reSchema.MatchString(t.Schema) || schemas[t.Schema] {
+			return nil, fmt.Errorf("tenant %s: invalid or duplicated schema %q", t.Host, t.Schema)
+		}
+
+		// branca keys are 32 bytes.
+		if len(t.BrancaKey) != 32 {
+			return nil, fmt.Errorf("tenant %s: branca key must be 32 bytes", t.Host)
+		}
+
+		if t.Origin == "" {
+			t.Origin = "https://" + t.Host
+		}
+
+		hosts[t.Host] = true
+		schemas[t.Schema] = true
+		tt[i] = t
+	}
+
+	return tt, nil
+}
+
+// tenantConfigs returns the config of each tenant, or just cfg
+// when the instance isn't multi tenant.
+func (cfg config) tenantConfigs() ([]config, error) {
+	if len(cfg.tenants) == 0 {
+		return []config{cfg}, nil
+	}
+
+	cc := make([]config, len(cfg.tenants))
+	for i, t := range cfg.tenants {
+		tcfg, err := cfg.forTenant(t)
+		if err != nil {
+			return nil, err
+		}
+
+		cc[i] = tcfg
+	}
+
+	return cc, nil
+}
+
+// forTenant returns a copy of cfg pointing to the schema, origin and key of t.
+func (cfg config) forTenant(t tenant) (config, error) {
+	databaseURL, err := withSearchPath(cfg.databaseURL, t.Schema)
+	if err != nil {
+		return cfg, fmt.Errorf("tenant %s: %v", t.Host, err)
+	}
+
+	cfg.host = t.Host
+	cfg.schema = t.Schema
+	cfg.origin = t.Origin
+	cfg.brancaKey = t.BrancaKey
+	cfg.fanoutQueue.QueueURL = t.FanoutQueueURL
+	cfg.databaseURL = databaseURL
+	cfg.tenants = nil
+	return cfg, nil
+}
+
+// withSearchPath sets the search_path of a key/value or URL postgres connection string
+// to the schema, then public where the extensions are.
+func withSearchPath(databaseURL, schema string) (string, error) {
+	searchPath := schema + ",public"
+	if !strings.HasPrefix(databaseURL, "postgres://") && !strings.HasPrefix(databaseURL, "postgresql://") {
+		// the last occurrence of a key wins.
+		return databaseURL + " search_path=" + searchPath, nil
+	}
+
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		return "", fmt.Errorf("could not parse database url: %v", err)
+	}
+
+	q := u.Query()
+	q.Set("search_path", searchPath)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// tenantsHandler routes each request to the handler of its Host.
+// The handler registered for the empty host serves any host.
+func tenantsHandler(handlers map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		h, ok := handlers[strings.ToLower(host)]
+		if !ok {
+			h, ok = handlers[""]
+		}
+
+		if !ok {
+			http.Error(w, "unknown host", http.StatusMisdirectedRequest)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// A new binary started by upgrade finds the listener it inherits, and the pipe
+// to report it is ready on, at these file descriptors. The env var names them.
+const (
+	listenerFDEnv = "SOCNET_LISTENER_FD"
+	readyFDEnv    = "SOCNET_READY_FD"
+)
+
+// upgradeTimeout is how long the new binary has to start before the upgrade
+// is given up and this process keeps serving.
+const upgradeTimeout = time.Minute
+
+// listen on the port, or on the listener inherited from the process
+// that started this one with upgrade.
+func listen(port string) (net.Listener, error) {
+	fd := os.Getenv(listenerFDEnv)
+	if fd == "" {
+		return net.Listen("tcp", ":"+port)
+	}
+
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", listenerFDEnv, fd)
+	}
+
+	f := os.NewFile(uintptr(n), "listener")
+	defer f.Close()
+
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not inherit listener: %v", err)
+	}
+
+	log.Println("inherited listener from the previous process")
+	return ln, nil
+}
+
+// notifyUpgraded tells the process that started this one with upgrade,
+// if any, that it is ready to accept connections.
+func notifyUpgraded() {
+	fd := os.Getenv(readyFDEnv)
+	if fd == "" {
+		return
+	}
+
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		log.Printf("invalid %s %q\n", readyFDEnv, fd)
+		return
+	}
+
+	f := os.NewFile(uintptr(n), "ready")
+	defer f.Close()
+
+	if _, err = f.Write([]byte{1}); err != nil {
+		log.Printf("could not notify the previous process: %v\n", err)
+	}
+}
+
+// upgrade starts the binary anew, possibly a newer one, with the same arguments
+// and sharing the listener, and waits for it to be ready. Connections keep
+// queueing on the shared socket meanwhile, so none is refused. It fails if the
+// new process exits or takes longer than upgradeTimeout, leaving this one serving.
+func upgrade(ln net.Listener) error {
+	tl, ok := ln.(*net.TCPListener)
+	if !ok {
+		return fmt.Errorf("unsupported listener %T", ln)
+	}
+
+	lf, err := tl.File()
+	if err != nil {
+		return fmt.Errorf("could not get listener file: %v", err)
+	}
+
+	defer lf.Close()
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("could not create ready pipe: %v", err)
+	}
+
+	defer readyR.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		readyW.Close()
+		return fmt.Errorf("could not find executable: %v", err)
+	}
+
+	// ExtraFiles start at fd 3.
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{lf, readyW}
+	cmd.Env = append(os.Environ(), listenerFDEnv+"=3", readyFDEnv+"=4")
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return fmt.Errorf("could not start new process: %v", err)
+	}
+
+	// The read fails with EOF if the new process exits before being ready.
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyR.Read(make([]byte, 1))
+		ready <- err
+	}()
+
+	select {
+	case err = <-ready:
+		if err == io.EOF {
+			err = fmt.Errorf("new process %d exited before being ready", cmd.Process.Pid)
+		}
+	case <-time.After(upgradeTimeout):
+		cmd.Process.Kill()
+		err = fmt.Errorf("new process %d was not ready after %s", cmd.Process.Pid, upgradeTimeout)
+	}
+
+	if err != nil {
+		go cmd.Wait()
+		return err
+	}
+
+	log.Printf("upgraded to process %d\n", cmd.Process.Pid)
+	return nil
+}
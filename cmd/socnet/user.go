@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+const userUsage = `usage: socnet user <action> [flags]
+
+actions:
+  lookup -login <id|email|username>
+  reset-avatar -username <username>
+  set-email -username <username> -email <email>
+  grant-role -username <username> -role <user|moderator|admin>
+  revoke-sessions -username <username>
+`
+
+func userAdmin(ctx context.Context, cfg config, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, userUsage)
+		os.Exit(2)
+	}
+
+	action := args[0]
+	var login, username, email, role string
+	fs := flag.NewFlagSet("user "+action, flag.ExitOnError)
+	fs.StringVar(&login, "login", "", "user id, email or username")
+	fs.StringVar(&username, "username", "", "username")
+	fs.StringVar(&email, "email", "", "new email")
+	fs.StringVar(&role, "role", "", "role to grant")
+	fs.Parse(args[1:])
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	s, err := newService(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "lookup":
+		u, err := s.LookupUser(ctx, login)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(u)
+	case "reset-avatar":
+		if err = s.ResetAvatar(ctx, username); err != nil {
+			return err
+		}
+
+		log.Printf("avatar of %s removed\n", username)
+	case "set-email":
+		if err = s.ChangeEmail(ctx, username, email); err != nil {
+			return err
+		}
+
+		log.Printf("email of %s changed to %s\n", username, email)
+	case "grant-role":
+		if err = s.GrantRole(ctx, username, role); err != nil {
+			return err
+		}
+
+		log.Printf("%s is now %s\n", username, role)
+	case "revoke-sessions":
+		n, err := s.RevokeSessions(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("revoked %d sessions of %s\n", n, username)
+	default:
+		fmt.Fprint(os.Stderr, userUsage)
+		return errors.New("unknown action " + action)
+	}
+
+	return nil
+}
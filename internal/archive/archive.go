@@ -0,0 +1,111 @@
+// Package archive reads account exports from other services
+// so they can be imported into socnet.
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Archive is the content of an export in a service independent form.
+type Archive struct {
+	Posts []Post
+	// Follows are account addresses like user@example.org.
+	Follows []string
+	// UnresolvedFollows counts follows the export lists without a handle.
+	UnresolvedFollows int
+	// Skipped counts entries that have no socnet equivalent, like boosts and retweets.
+	Skipped int
+}
+
+// Post of an archive.
+type Post struct {
+	Content   string
+	SpoilerOf *string
+	NSFW      bool
+	CreatedAt time.Time
+	Media     []Media
+}
+
+// Media attached to a post.
+type Media struct {
+	Path        string
+	Description string
+	// File of the media in the export, nil when the export lacks it.
+	File *zip.File
+}
+
+var (
+	reParagraph = regexp.MustCompile(`(?i)</p>\s*<p>|<br\s*/?>`)
+	reTag       = regexp.MustCompile(`<[^>]*>`)
+)
+
+// Read detects the format of the zipped export and reads it.
+func Read(r io.ReaderAt, size int64) (*Archive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("could not open archive: %v", err)
+	}
+
+	if findFile(zr, "outbox.json") != nil {
+		return readMastodon(zr)
+	}
+
+	if findFile(zr, "tweets.js") != nil || findFile(zr, "tweet.js") != nil {
+		return readTwitter(zr)
+	}
+
+	return nil, fmt.Errorf("unknown archive format")
+}
+
+// findFile by base name anywhere in the archive.
+func findFile(zr *zip.Reader, name string) *zip.File {
+	for _, f := range zr.File {
+		if path.Base(f.Name) == name {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// findPath of a file in the archive, which can be nested in a top directory.
+func findPath(zr *zip.Reader, name string) *zip.File {
+	name = strings.TrimPrefix(name, "/")
+	for _, f := range zr.File {
+		if f.Name == name || strings.HasSuffix(f.Name, "/"+name) {
+			return f
+		}
+	}
+
+	return nil
+}
+
+func readFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %v", f.Name, err)
+	}
+
+	defer rc.Close()
+
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", f.Name, err)
+	}
+
+	return b, nil
+}
+
+// plainText turns post HTML into text keeping paragraph breaks.
+func plainText(s string) string {
+	s = reParagraph.ReplaceAllString(s, "\n")
+	s = reTag.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
@@ -0,0 +1,107 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type mastodonOutbox struct {
+	OrderedItems []struct {
+		Type   string          `json:"type"`
+		Object json.RawMessage `json:"object"`
+	} `json:"orderedItems"`
+}
+
+type mastodonNote struct {
+	Type       string    `json:"type"`
+	Summary    *string   `json:"summary"`
+	Content    string    `json:"content"`
+	Sensitive  bool      `json:"sensitive"`
+	Published  time.Time `json:"published"`
+	Attachment []struct {
+		URL  string `json:"url"`
+		Name string `json:"name"`
+	} `json:"attachment"`
+}
+
+func readMastodon(zr *zip.Reader) (*Archive, error) {
+	var a Archive
+
+	b, err := readFile(findFile(zr, "outbox.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var outbox mastodonOutbox
+	if err = json.Unmarshal(b, &outbox); err != nil {
+		return nil, fmt.Errorf("could not decode outbox: %v", err)
+	}
+
+	for _, item := range outbox.OrderedItems {
+		if item.Type != "Create" {
+			a.Skipped++
+			continue
+		}
+
+		var note mastodonNote
+		if err = json.Unmarshal(item.Object, &note); err != nil || note.Type != "Note" {
+			a.Skipped++
+			continue
+		}
+
+		p := Post{
+			Content:   plainText(note.Content),
+			NSFW:      note.Sensitive,
+			CreatedAt: note.Published,
+		}
+		if note.Summary != nil && strings.TrimSpace(*note.Summary) != "" {
+			spoilerOf := strings.TrimSpace(*note.Summary)
+			p.SpoilerOf = &spoilerOf
+		}
+		for _, att := range note.Attachment {
+			m := Media{Path: att.URL, Description: att.Name}
+			// Attachment URLs are the paths of the files in the export,
+			// unless they are absolute to the instance.
+			if i := strings.Index(att.URL, "media_attachments/"); i != -1 {
+				m.File = findPath(zr, att.URL[i:])
+			}
+			p.Media = append(p.Media, m)
+		}
+
+		a.Posts = append(a.Posts, p)
+	}
+
+	if f := findFile(zr, "following_accounts.csv"); f != nil {
+		if b, err = readFile(f); err != nil {
+			return nil, err
+		}
+
+		cr := csv.NewReader(bytes.NewReader(b))
+		cr.FieldsPerRecord = -1
+		for {
+			record, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("could not read following accounts: %v", err)
+			}
+
+			account := strings.TrimSpace(record[0])
+			if account == "" || account == "Account address" {
+				continue
+			}
+
+			a.Follows = append(a.Follows, account)
+		}
+	}
+
+	return &a, nil
+}
@@ -0,0 +1,102 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"path"
+	"strings"
+	"time"
+)
+
+type twitterTweet struct {
+	Tweet struct {
+		ID                string `json:"id_str"`
+		FullText          string `json:"full_text"`
+		CreatedAt         string `json:"created_at"`
+		PossiblySensitive bool   `json:"possibly_sensitive"`
+		ExtendedEntities  struct {
+			Media []struct {
+				MediaURLHTTPS string `json:"media_url_https"`
+			} `json:"media"`
+		} `json:"extended_entities"`
+	} `json:"tweet"`
+}
+
+type twitterFollowing struct {
+	Following struct {
+		AccountID string `json:"accountId"`
+	} `json:"following"`
+}
+
+func readTwitter(zr *zip.Reader) (*Archive, error) {
+	var a Archive
+
+	f := findFile(zr, "tweets.js")
+	if f == nil {
+		f = findFile(zr, "tweet.js")
+	}
+
+	var tweets []twitterTweet
+	if err := readTwitterJS(f, &tweets); err != nil {
+		return nil, err
+	}
+
+	for _, t := range tweets {
+		if strings.HasPrefix(t.Tweet.FullText, "RT @") {
+			a.Skipped++
+			continue
+		}
+
+		createdAt, err := time.Parse(time.RubyDate, t.Tweet.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse tweet date %q: %v", t.Tweet.CreatedAt, err)
+		}
+
+		p := Post{
+			Content:   strings.TrimSpace(html.UnescapeString(t.Tweet.FullText)),
+			NSFW:      t.Tweet.PossiblySensitive,
+			CreatedAt: createdAt,
+		}
+		for _, m := range t.Tweet.ExtendedEntities.Media {
+			// The export keeps media as tweets_media/<tweet id>-<file name>.
+			name := "tweets_media/" + t.Tweet.ID + "-" + path.Base(m.MediaURLHTTPS)
+			p.Media = append(p.Media, Media{Path: m.MediaURLHTTPS, File: findPath(zr, name)})
+		}
+
+		a.Posts = append(a.Posts, p)
+	}
+
+	// the twitter export only lists account ids for follows.
+	if f = findFile(zr, "following.js"); f != nil {
+		var following []twitterFollowing
+		if err := readTwitterJS(f, &following); err != nil {
+			return nil, err
+		}
+
+		a.UnresolvedFollows = len(following)
+	}
+
+	return &a, nil
+}
+
+// readTwitterJS decodes the JSON assigned in files like
+// "window.YTD.tweets.part0 = [...]".
+func readTwitterJS(f *zip.File, v interface{}) error {
+	b, err := readFile(f)
+	if err != nil {
+		return err
+	}
+
+	if i := bytes.IndexByte(b, '='); i != -1 && bytes.HasPrefix(b, []byte("window.")) {
+		b = b[i+1:]
+	}
+
+	if err = json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("could not decode %s: %v", f.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package cursor_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/cursor"
+)
+
+func TestRoundTrip(t *testing.T) {
+	c := cursor.New("secret")
+	createdAt := time.Date(2020, time.March, 4, 5, 6, 7, 8, time.UTC)
+
+	token := c.Encode("posts", int64(42), "alice", createdAt)
+
+	var (
+		id       int64
+		username string
+		at       time.Time
+	)
+	if err := c.Decode(token, "posts", &id, &username, &at); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	if id != 42 || username != "alice" || !at.Equal(createdAt) {
+		t.Errorf("Decode() = %d, %q, %v, want 42, %q, %v", id, username, at, "alice", createdAt)
+	}
+
+	// Other codecs with the same secret, like other instances, accept it too.
+	if err := cursor.New("secret").Decode(token, "posts", &id, &username, &at); err != nil {
+		t.Errorf("Decode() with another codec error = %v", err)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	c := cursor.New("secret")
+	token := c.Encode("posts", int64(42))
+
+	flip := func(i int) string {
+		b, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			t.Fatalf("could not decode token: %v", err)
+		}
+
+		if i < 0 {
+			i += len(b)
+		}
+		b[i] ^= 1
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`["posts",42]`))
+
+	tests := []struct {
+		name  string
+		codec *cursor.Codec
+		token string
+		kind  string
+		keys  []interface{}
+	}{
+		{name: "empty", token: "", kind: "posts", keys: []interface{}{new(int64)}},
+		{name: "not base64", token: "not base64!", kind: "posts", keys: []interface{}{new(int64)}},
+		{name: "padded", token: token + "==", kind: "posts", keys: []interface{}{new(int64)}},
+		{name: "truncated", token: token[:len(token)-4], kind: "posts", keys: []interface{}{new(int64)}},
+		{name: "signature only", token: token[len(token)-43:], kind: "posts", keys: []interface{}{new(int64)}},
+		{name: "tampered payload", token: flip(3), kind: "posts", keys: []interface{}{new(int64)}},
+		{name: "tampered signature", token: flip(-1), kind: "posts", keys: []interface{}{new(int64)}},
+		{name: "unsigned", token: unsigned, kind: "posts", keys: []interface{}{new(int64)}},
+		{name: "other secret", codec: cursor.New("other"), token: token, kind: "posts", keys: []interface{}{new(int64)}},
+		{name: "other kind", token: token, kind: "comments", keys: []interface{}{new(int64)}},
+		{name: "fewer keys", token: token, kind: "posts"},
+		{name: "more keys", token: token, kind: "posts", keys: []interface{}{new(int64), new(int64)}},
+		{name: "wrong key type", token: token, kind: "posts", keys: []interface{}{new(string)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec := c
+			if tt.codec != nil {
+				codec = tt.codec
+			}
+
+			if err := codec.Decode(tt.token, tt.kind, tt.keys...); !errors.Is(err, cursor.ErrInvalid) {
+				t.Errorf("Decode() error = %v, want %v", err, cursor.ErrInvalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+func (h *handler) activity(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	last, _ := strconv.Atoi(q.Get("last"))
+	var before time.Time
+	if err := h.decodeCursor(r, "before", cursorActivity, &before); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	aa, err := h.Activity(r.Context(), last, before)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if n := len(aa); n != 0 {
+		h.linkNext(w, r, "before", cursorActivity, aa[n-1].CreatedAt)
+	}
+
+	respond(w, aa, http.StatusOK)
+}
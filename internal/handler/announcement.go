@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+func (h *handler) activeAnnouncements(w http.ResponseWriter, r *http.Request) {
+	aa, err := h.ActiveAnnouncements(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, aa, http.StatusOK)
+}
+
+func (h *handler) dismissAnnouncement(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	announcementID, _ := strconv.ParseInt(way.Param(ctx, "announcement_id"), 10, 64)
+	err := h.DismissAnnouncement(ctx, announcementID)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrAnnouncementNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) announcements(w http.ResponseWriter, r *http.Request) {
+	aa, err := h.Announcements(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, aa, http.StatusOK)
+}
+
+func (h *handler) createAnnouncement(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in service.AnnouncementInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a, err := h.CreateAnnouncement(r.Context(), in)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, a, http.StatusCreated)
+}
+
+func (h *handler) updateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in service.AnnouncementInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	announcementID, _ := strconv.ParseInt(way.Param(ctx, "announcement_id"), 10, 64)
+	a, err := h.UpdateAnnouncement(ctx, announcementID, in)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err == service.ErrAnnouncementNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, a, http.StatusOK)
+}
+
+func (h *handler) deleteAnnouncement(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	announcementID, _ := strconv.ParseInt(way.Param(ctx, "announcement_id"), 10, 64)
+	err := h.DeleteAnnouncement(ctx, announcementID)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err == service.ErrAnnouncementNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
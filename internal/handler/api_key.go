@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+// apiKeyHeader carries the API key of public API requests.
+const apiKeyHeader = "X-API-Key"
+
+// withAPIKey serves a public API request within the limits of its API key.
+// The request is served as an anonymous visitor even when it is also
+// authenticated, so keys only ever read what is public.
+func (h *handler) withAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		use, err := h.UseAPIKey(r.Context(), r.Header.Get(apiKeyHeader))
+		if err == service.ErrInvalidAPIKey {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if err == service.ErrRateLimited {
+			now := time.Now()
+			retryAfter := now.Truncate(time.Minute).Add(time.Minute).Sub(now)
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		if err == service.ErrQuotaExceeded {
+			now := time.Now().UTC()
+			retryAfter := now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		w.Header().Set("X-Quota-Limit", strconv.Itoa(use.DailyQuota))
+		w.Header().Set("X-Quota-Remaining", strconv.Itoa(use.QuotaRemaining))
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(use.RateLimit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(use.RateRemaining))
+
+		// A nil user id reads as unauthenticated everywhere.
+		ctx := context.WithValue(r.Context(), service.KeyAuthUserID, nil)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+func (h *handler) apiKeys(w http.ResponseWriter, r *http.Request) {
+	kk, err := h.APIKeys(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, kk, http.StatusOK)
+}
+
+func (h *handler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in service.APIKeyInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out, err := h.CreateAPIKey(r.Context(), in)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusCreated)
+}
+
+func (h *handler) updateAPIKey(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in service.APIKeyInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	keyID, _ := strconv.ParseInt(way.Param(ctx, "key_id"), 10, 64)
+	k, err := h.UpdateAPIKey(ctx, keyID, in)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err == service.ErrAPIKeyNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, k, http.StatusOK)
+}
+
+func (h *handler) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	keyID, _ := strconv.ParseInt(way.Param(ctx, "key_id"), 10, 64)
+	err := h.RevokeAPIKey(ctx, keyID)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err == service.ErrAPIKeyNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) apiKeyUsage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	keyID, _ := strconv.ParseInt(way.Param(ctx, "key_id"), 10, 64)
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+	uu, err := h.APIKeyUsage(ctx, keyID, days)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err == service.ErrAPIKeyNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, uu, http.StatusOK)
+}
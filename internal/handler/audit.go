@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+func (h *handler) auditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	last, _ := strconv.Atoi(q.Get("last"))
+	var before int64
+	if err := h.decodeCursor(r, "before", cursorAuditLog, &before); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	aa, err := h.AuditLog(r.Context(), last, before)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if n := len(aa); n != 0 {
+		h.linkNext(w, r, "before", cursorAuditLog, aa[n-1].ID)
+	}
+
+	respond(w, aa, http.StatusOK)
+}
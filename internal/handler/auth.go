@@ -2,18 +2,26 @@ package handler
 
 import (
 	"context"
-	"strings"
-	"github.com/djomlaa/socnet/internal/service"
 	"encoding/json"
+	"github.com/djomlaa/socnet/internal/service"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
+// impersonatedByHeader carries the id of the admin impersonating the auth user,
+// on the request for handlers and on the response for the client.
+const impersonatedByHeader = "X-Impersonated-By"
+
 type loginInput struct {
 	Email string
+	// Password is only checked by LDAP.
+	Password string
 }
 
 func (h *handler) login(w http.ResponseWriter, r *http.Request) {
-	
+
 	defer r.Body.Close()
 
 	var in loginInput
@@ -23,16 +31,25 @@ func (h *handler) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	out, err := h.Login(r.Context(), in.Email)
+	out, err := h.Login(r.Context(), in.Email, in.Password)
+
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 
-	if err == service.ErrInvalidEmail {
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	if err == service.ErrInvalidCredentials {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
-	
-	if err == service.ErrUserNotFound {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	if err == service.ErrSSORequired || err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err == service.ErrUsernameTaken {
+		http.Error(w, err.Error(), http.StatusConflict)
 		return
 	}
 
@@ -45,15 +62,15 @@ func (h *handler) login(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *handler) authUser(w http.ResponseWriter, r *http.Request) {
-	u, err := h.AuthUser(r.Context()) 
+	u, err := h.AuthUser(r.Context())
 	if err == service.ErrUnauthenticated {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
-			return 
+		return
 	}
 
 	if err == service.ErrUserNotFound {
 		http.Error(w, err.Error(), http.StatusNotFound)
-			return 
+		return
 	}
 
 	if err != nil {
@@ -66,22 +83,47 @@ func (h *handler) authUser(w http.ResponseWriter, r *http.Request) {
 
 func (h *handler) withAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), service.KeyClientInfo, clientInfo(r))
+		// Not for clients to set.
+		r.Header.Del(impersonatedByHeader)
+
 		a := r.Header.Get("Authorization")
 		if !strings.HasPrefix(a, "Bearer") {
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
 
 		token := a[7:]
-		uid, err := h.AuthUserID(token)
+		as, err := h.AuthSession(ctx, token)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return 
+			return
 		}
 
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, service.KeyAuthUserID, uid)
+		logAccessUser(ctx, as.UserID, as.ImpersonatorID)
+		ctx = context.WithValue(ctx, service.KeyAuthUserID, as.UserID)
+		ctx = context.WithValue(ctx, service.KeySessionID, as.SessionID)
+		ctx = withAccountPolicy(ctx, as)
+		if as.ImpersonatorID != 0 {
+			// Marks what an admin does as the user, for handlers and the client.
+			ctx = context.WithValue(ctx, service.KeyImpersonatorID, as.ImpersonatorID)
+			r.Header.Set(impersonatedByHeader, strconv.FormatInt(as.ImpersonatorID, 10))
+			w.Header().Set(impersonatedByHeader, strconv.FormatInt(as.ImpersonatorID, 10))
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 
 	})
 }
+
+// clientInfo of the request. The IP is the remote address of the connection.
+func clientInfo(r *http.Request) service.ClientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return service.ClientInfo{
+		UserAgent: r.UserAgent(),
+		IP:        ip,
+	}
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+type bookmarksDeltaOutput struct {
+	service.BookmarksDelta
+	SyncToken string `json:"syncToken"`
+}
+
+func (h *handler) bookmarksDelta(w http.ResponseWriter, r *http.Request) {
+	since, err := h.decodeSyncPosition(r, syncBookmarks)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	delta, err := h.BookmarksDelta(r.Context(), since)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrSyncExpired {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, bookmarksDeltaOutput{BookmarksDelta: delta, SyncToken: h.syncToken(syncBookmarks, delta.Position)}, http.StatusOK)
+}
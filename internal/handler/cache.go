@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+// maxCachedResponses kept at once. Once full, responses are not cached
+// until some expire.
+const maxCachedResponses = 10000
+
+// How long anonymous responses of public endpoints are cached for.
+// Changes, like a deleted post, take up to that long to show to logged-out visitors.
+const (
+	profileCacheTTL     = 30 * time.Second
+	postCacheTTL        = 30 * time.Second
+	discoverCacheTTL    = time.Minute
+	leaderboardCacheTTL = 5 * time.Minute
+)
+
+type cachedResponse struct {
+	header    http.Header
+	body      []byte
+	expiresAt time.Time
+}
+
+// responseCache keeps the responses of this process in memory.
+type responseCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedResponse
+}
+
+func (c *responseCache) get(key string) (cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expiresAt) {
+		return e, false
+	}
+
+	return e, true
+}
+
+func (c *responseCache) set(key string, e cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[string]cachedResponse{}
+	}
+
+	if len(c.entries) >= maxCachedResponses {
+		now := time.Now()
+		for k, old := range c.entries {
+			if now.After(old.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+
+		if len(c.entries) >= maxCachedResponses {
+			return
+		}
+	}
+
+	c.entries[key] = e
+}
+
+// responseRecorder buffers a response so it can be cached before it is sent.
+type responseRecorder struct {
+	header     http.Header
+	body       bytes.Buffer
+	statusCode int
+}
+
+func (rec *responseRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.statusCode == 0 {
+		rec.statusCode = http.StatusOK
+	}
+
+	return rec.body.Write(b)
+}
+
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	if rec.statusCode == 0 {
+		rec.statusCode = statusCode
+	}
+}
+
+// cacheAnonymous serves logged-out visitors of a public endpoint the same cached
+// response for ttl, since it is the same for all of them. Only successful
+// responses are cached, by URL. Authenticated requests always go through.
+func (h *handler) cacheAnonymous(ttl time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, auth := r.Context().Value(service.KeyAuthUserID).(int64); auth || r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+
+		key := r.URL.RequestURI()
+		if e, ok := h.cache.get(key); ok {
+			writeCachedResponse(w, r, e, "HIT")
+			return
+		}
+
+		// The full response is cached, and checked against the condition after.
+		full := r
+		if r.Header.Get("If-Modified-Since") != "" {
+			full = r.Clone(r.Context())
+			full.Header.Del("If-Modified-Since")
+		}
+
+		rec := &responseRecorder{header: http.Header{}}
+		next(rec, full)
+
+		if rec.statusCode == 0 {
+			rec.statusCode = http.StatusOK
+		}
+
+		if rec.statusCode != http.StatusOK {
+			copyHeader(w.Header(), rec.header)
+			w.WriteHeader(rec.statusCode)
+			w.Write(rec.body.Bytes())
+			return
+		}
+
+		e := cachedResponse{header: rec.header, body: rec.body.Bytes(), expiresAt: time.Now().Add(ttl)}
+		h.cache.set(key, e)
+		writeCachedResponse(w, r, e, "MISS")
+	}
+}
+
+func writeCachedResponse(w http.ResponseWriter, r *http.Request, e cachedResponse, status string) {
+	copyHeader(w.Header(), e.header)
+
+	// Responses to API key requests carry the quota of the key, and shared
+	// caches must not serve them past it to requests without the key.
+	scope := "public"
+	if r.Header.Get(apiKeyHeader) != "" {
+		scope = "private"
+	}
+
+	maxAge := int(time.Until(e.expiresAt).Seconds())
+	w.Header().Set("Cache-Control", scope+", max-age="+strconv.Itoa(maxAge))
+	// Authenticated requests of the same URL get a different response.
+	w.Header().Set("Vary", "Authorization, "+apiKeyHeader)
+	w.Header().Set("X-Cache", status)
+	if modified, err := http.ParseTime(e.header.Get("Last-Modified")); err == nil && notModifiedSince(r, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(e.body)
+}
+
+// checkNotModified sets the Last-Modified header and responds with
+// 304 Not Modified if the resource didn't change since the If-Modified-Since
+// of the request, in which case the caller is done. A zero modified time is unknown.
+func checkNotModified(w http.ResponseWriter, r *http.Request, modified time.Time) bool {
+	if modified.IsZero() {
+		return false
+	}
+
+	// HTTP dates have a precision of seconds.
+	modified = modified.UTC().Truncate(time.Second)
+	w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	if !notModifiedSince(r, modified) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+func notModifiedSince(r *http.Request, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modified.After(since)
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, v := range src {
+		dst[k] = append([]string(nil), v...)
+	}
+}
@@ -24,9 +24,6 @@ func (h *handler) createComment(w http.ResponseWriter, r *http.Request) {
 	c, err := h.CreateComment(r.Context(), postID, in.Content)
 	if err == service.ErrUnauthenticated {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
-	}
-	if err == service.ErrInvalidContent {
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
 	if err == service.ErrPostNotFound {
@@ -46,13 +43,33 @@ func (h *handler) comments(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
 	last, _ := strconv.Atoi(q.Get("last"))
-	before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
-	cc, err := h.Comments(ctx, postID, last, before)
+	// Each sort order pages by different keys, so each has its own kind of cursor.
+	sort := q.Get("sort")
+	kind := cursorComments + ":" + sort
+	var before service.CommentsCursor
+	keys := []interface{}{&before.ID}
+	if sort == service.CommentsSortTop {
+		keys = []interface{}{&before.LikesCount, &before.ID}
+	}
+	if err := h.decodeCursor(r, "before", kind, keys...); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	cc, err := h.Comments(ctx, postID, last, before, sort)
 	if err != nil {
 		respondError(w, err)
 		return
 	}
 
+	if n := len(cc); n != 0 {
+		keys := []interface{}{cc[n-1].ID}
+		if sort == service.CommentsSortTop {
+			keys = []interface{}{cc[n-1].LikesCount, cc[n-1].ID}
+		}
+		h.linkNext(w, r, "before", kind, keys...)
+	}
+
 	respond(w, cc, http.StatusOK)
 
 }
@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+type createCommunityInput struct {
+	Name        string
+	Description string
+}
+
+func (h *handler) createCommunity(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in createCommunityInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c, err := h.CreateCommunity(r.Context(), in.Name, in.Description)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrCommunityNameTaken {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, c, http.StatusCreated)
+}
+
+func (h *handler) communities(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	first, _ := strconv.Atoi(q.Get("first"))
+	var after string
+	if err := h.decodeCursor(r, "after", cursorCommunities, &after); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	cc, err := h.Communities(r.Context(), q.Get("search"), first, after)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if n := len(cc); n != 0 {
+		h.linkNext(w, r, "after", cursorCommunities, cc[n-1].Name)
+	}
+
+	respond(w, cc, http.StatusOK)
+}
+
+func (h *handler) community(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	c, err := h.Community(ctx, way.Param(ctx, "name"))
+	if err == service.ErrCommunityNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, c, http.StatusOK)
+}
+
+func (h *handler) joinCommunity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	c, err := h.JoinCommunity(ctx, way.Param(ctx, "name"))
+	h.respondCommunityMembership(w, c, err)
+}
+
+func (h *handler) leaveCommunity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	c, err := h.LeaveCommunity(ctx, way.Param(ctx, "name"))
+	h.respondCommunityMembership(w, c, err)
+}
+
+func (h *handler) respondCommunityMembership(w http.ResponseWriter, c service.Community, err error) {
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrCommunityNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, c, http.StatusOK)
+}
+
+func (h *handler) communityPosts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	last, _ := strconv.Atoi(q.Get("last"))
+	var before int64
+	if err := h.decodeCursor(r, "before", cursorPosts, &before); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	pp, err := h.CommunityPosts(ctx, way.Param(ctx, "name"), last, before)
+	if err == service.ErrCommunityNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if n := len(pp); n != 0 {
+		h.linkNext(w, r, "before", cursorPosts, pp[n-1].ID)
+	}
+
+	respondFields(w, r, pp, http.StatusOK)
+}
+
+func (h *handler) communityMembers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	first, _ := strconv.Atoi(q.Get("first"))
+	var after string
+	if err := h.decodeCursor(r, "after", cursorUsers, &after); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	mm, err := h.CommunityMembers(ctx, way.Param(ctx, "name"), first, after)
+	if err == service.ErrCommunityNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if n := len(mm); n != 0 {
+		h.linkNext(w, r, "after", cursorUsers, mm[n-1].Username)
+	}
+
+	respond(w, mm, http.StatusOK)
+}
+
+func (h *handler) addCommunityModerator(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	h.respondCommunityModeratorUpdate(w, h.SetCommunityModerator(ctx, way.Param(ctx, "name"), way.Param(ctx, "username"), true))
+}
+
+func (h *handler) removeCommunityModerator(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	h.respondCommunityModeratorUpdate(w, h.SetCommunityModerator(ctx, way.Param(ctx, "name"), way.Param(ctx, "username"), false))
+}
+
+func (h *handler) respondCommunityModeratorUpdate(w http.ResponseWriter, err error) {
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrCommunityNotFound || err == service.ErrNotCommunityMember {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err == service.ErrNotCommunityModerator {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) pinCommunityPost(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+	h.respondCommunityPinUpdate(w, h.SetCommunityPostPinned(ctx, way.Param(ctx, "name"), postID, true))
+}
+
+func (h *handler) unpinCommunityPost(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+	h.respondCommunityPinUpdate(w, h.SetCommunityPostPinned(ctx, way.Param(ctx, "name"), postID, false))
+}
+
+func (h *handler) respondCommunityPinUpdate(w http.ResponseWriter, err error) {
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrCommunityNotFound || err == service.ErrPostNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err == service.ErrNotCommunityModerator {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err == service.ErrCommunityPinsFull {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
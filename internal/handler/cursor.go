@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// Kinds of lists cursors are issued for. A cursor of one kind is rejected
+// by the others; changing what a list sorts by takes a new kind.
+const (
+	cursorPosts         = "posts"
+	cursorTimeline      = "timeline"
+	cursorComments      = "comments"
+	cursorNotifications = "notifications"
+	cursorActivity      = "activity"
+	cursorLikedPosts    = "liked_posts"
+	cursorMediaPosts    = "media_posts"
+	cursorAuditLog      = "audit_log"
+	cursorEvents        = "events"
+	cursorUsers         = "users"
+	cursorCommunities   = "communities"
+)
+
+// Kinds of resources sync tokens are issued for.
+const (
+	syncTimeline      = "timeline_sync"
+	syncNotifications = "notifications_sync"
+	syncBookmarks     = "bookmarks_sync"
+)
+
+// decodeCursor reads the cursor in the given query parameter into keys,
+// leaving them zero when there is none. Clients can't make up cursors:
+// they follow the next link of the previous page.
+func (h *handler) decodeCursor(r *http.Request, param, kind string, keys ...interface{}) error {
+	token := r.URL.Query().Get(param)
+	if token == "" {
+		return nil
+	}
+
+	if err := h.cursors.Decode(token, kind, keys...); err != nil {
+		var v validation.Validator
+		v.Check(false, param, "invalid cursor")
+		return v.Err()
+	}
+
+	return nil
+}
+
+// linkNext sets a Link header to the next page, with the cursor of the last item
+// of this one in the given query parameter. Empty pages have no next one,
+// so it is only called for pages with items.
+func (h *handler) linkNext(w http.ResponseWriter, r *http.Request, param, kind string, keys ...interface{}) {
+	// The URL of the request lost its /api prefix on the way here.
+	u, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		return
+	}
+
+	q := u.Query()
+	q.Set(param, h.cursors.Encode(kind, keys...))
+	u.RawQuery = q.Encode()
+	w.Header().Set("Link", "<"+u.RequestURI()+`>; rel="next"`)
+}
+
+// decodeSyncPosition reads the sync token of the given kind of resource in the
+// since query parameter, or nil when there is none.
+func (h *handler) decodeSyncPosition(r *http.Request, kind string) (*service.SyncPosition, error) {
+	if r.URL.Query().Get("since") == "" {
+		return nil, nil
+	}
+
+	var pos service.SyncPosition
+	if err := h.decodeCursor(r, "since", kind, &pos.SyncID, &pos.At); err != nil {
+		return nil, err
+	}
+
+	return &pos, nil
+}
+
+// syncToken to resume the delta sync of the given kind of resource from the position.
+func (h *handler) syncToken(kind string, pos service.SyncPosition) string {
+	return h.cursors.Encode(kind, pos.SyncID, pos.At)
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Deadlines bound how long the API takes to handle a request, so a stuck
+// database or remote call can't hold its goroutine forever. Event streams
+// have none. A zero duration disables the deadline.
+type Deadlines struct {
+	Request time.Duration
+	// Upload is for the requests carrying a file,
+	// which also extends the connection read and write deadlines.
+	Upload time.Duration
+}
+
+// isUpload reports whether the request carries a file. Paths are relative to /api.
+func isUpload(r *http.Request) bool {
+	p := r.URL.Path
+	switch r.Method {
+	case http.MethodPost:
+		return p == "/media" || (strings.HasPrefix(p, "/uploads/") && strings.HasSuffix(p, "/finalize"))
+	case http.MethodPut:
+		return p == "/auth_user/avatar" || strings.HasPrefix(p, "/admin/emojis/")
+	case http.MethodPatch:
+		return strings.HasPrefix(p, "/tus/")
+	}
+	return false
+}
+
+// withDeadline cancels the request context past its deadline. Handlers then
+// fail with the context error, which is answered with 504 instead of 500.
+func (h *handler) withDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if acceptsEventStream(r) || r.URL.Path == "/presence" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		d := h.deadlines.Request
+		if isUpload(r) {
+			d = h.deadlines.Upload
+			if d != 0 {
+				// Leaves some time to respond once the deadline passed.
+				rc := http.NewResponseController(w)
+				rc.SetReadDeadline(time.Now().Add(d))
+				rc.SetWriteDeadline(time.Now().Add(d + 5*time.Second))
+			}
+		}
+
+		if d == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		next.ServeHTTP(&deadlineWriter{ResponseWriter: w, ctx: ctx}, r.WithContext(ctx))
+	})
+}
+
+// deadlineWriter turns the internal server error of a
+// request past its deadline into a gateway timeout.
+type deadlineWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	timedOut bool
+}
+
+func (w *deadlineWriter) WriteHeader(statusCode int) {
+	if statusCode == http.StatusInternalServerError && w.ctx.Err() == context.DeadlineExceeded {
+		w.timedOut = true
+		http.Error(w.ResponseWriter, http.StatusText(http.StatusGatewayTimeout), http.StatusGatewayTimeout)
+		return
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *deadlineWriter) Write(b []byte) (int, error) {
+	if w.timedOut {
+		return len(b), nil
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (w *deadlineWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
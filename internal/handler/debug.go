@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+// debugProfileSeconds is the default CPU profile duration, as the one of
+// net/http/pprof reaches the server write timeout and is refused.
+const debugProfileSeconds = "20"
+
+// debugHandler serves the net/http/pprof profiles and the expvar variables
+// under /debug, to admins only. They cover the whole process, every tenant
+// included. Profiles are downloaded with the token, like:
+//
+//	curl -H "Authorization: Bearer $TOKEN" $ORIGIN/debug/pprof/profile > cpu.pprof
+//	go tool pprof cpu.pprof
+func (h *handler) debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return h.withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := h.DebugAccess(r.Context())
+		if err == service.ErrUnauthenticated {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if err == service.ErrForbidden {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		if r.URL.Path == "/debug/pprof/profile" && r.URL.Query().Get("seconds") == "" {
+			q := r.URL.Query()
+			q.Set("seconds", debugProfileSeconds)
+			r.URL.RawQuery = q.Encode()
+		}
+
+		mux.ServeHTTP(w, r)
+	}))
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+// maxWebhookBytes bounds the body of provider webhooks.
+const maxWebhookBytes = 1 << 20
+
+func (h *handler) mailWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	err = h.HandleMailWebhook(ctx, way.Param(ctx, "provider"), r.URL.Query().Get("token"), body)
+	if err == service.ErrUnknownMailProvider {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err == service.ErrInvalidMailWebhook {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) emailStatus(w http.ResponseWriter, r *http.Request) {
+	out, err := h.EmailStatus(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusOK)
+}
+
+func (h *handler) clearEmailSuppression(w http.ResponseWriter, r *http.Request) {
+	err := h.ClearEmailSuppression(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
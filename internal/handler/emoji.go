@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+func (h *handler) emojis(w http.ResponseWriter, r *http.Request) {
+	ee, err := h.Emojis(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, ee, http.StatusOK)
+}
+
+func (h *handler) createEmoji(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxEmojiBytes)
+	defer r.Body.Close()
+
+	ctx := r.Context()
+	e, err := h.CreateEmoji(ctx, way.Param(ctx, "shortcode"), r.Body)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err == service.ErrShortcodeTaken {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err == service.ErrUnsupportedEmojiFormat {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if err == service.ErrInfectedUpload {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, e, http.StatusCreated)
+}
+
+func (h *handler) deleteEmoji(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := h.DeleteEmoji(ctx, way.Param(ctx, "shortcode"))
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err == service.ErrEmojiNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
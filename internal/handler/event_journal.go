@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+func (h *handler) eventJournal(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	last, _ := strconv.Atoi(q.Get("last"))
+	var before int64
+	if err := h.decodeCursor(r, "before", cursorEvents, &before); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	ee, err := h.EventJournal(r.Context(), q.Get("type"), last, before)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if n := len(ee); n != 0 {
+		h.linkNext(w, r, "before", cursorEvents, ee[n-1].ID)
+	}
+
+	respond(w, ee, http.StatusOK)
+}
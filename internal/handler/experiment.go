@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+func (h *handler) experimentAssignments(w http.ResponseWriter, r *http.Request) {
+	aa, err := h.ExperimentAssignments(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, aa, http.StatusOK)
+}
+
+func (h *handler) experiments(w http.ResponseWriter, r *http.Request) {
+	ee, err := h.Experiments(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, ee, http.StatusOK)
+}
+
+func (h *handler) setExperiment(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in service.SetExperimentInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	e, err := h.SetExperiment(ctx, way.Param(ctx, "name"), in)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, e, http.StatusOK)
+}
+
+func (h *handler) deleteExperiment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := h.DeleteExperiment(ctx, way.Param(ctx, "name"))
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err == service.ErrExperimentNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+func (h *handler) fanoutStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.FanoutStats(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, stats, http.StatusOK)
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+func (h *handler) features(w http.ResponseWriter, r *http.Request) {
+	names, err := h.Features(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, names, http.StatusOK)
+}
+
+func (h *handler) featureFlags(w http.ResponseWriter, r *http.Request) {
+	ff, err := h.FeatureFlags(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, ff, http.StatusOK)
+}
+
+func (h *handler) setFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in service.SetFeatureFlagInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	f, err := h.SetFeatureFlag(ctx, way.Param(ctx, "name"), in)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, f, http.StatusOK)
+}
+
+func (h *handler) deleteFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := h.DeleteFeatureFlag(ctx, way.Param(ctx, "name"))
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err == service.ErrFeatureFlagNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) addFeatureFlagUser(w http.ResponseWriter, r *http.Request) {
+	h.setFeatureFlagUser(w, r, true)
+}
+
+func (h *handler) removeFeatureFlagUser(w http.ResponseWriter, r *http.Request) {
+	h.setFeatureFlagUser(w, r, false)
+}
+
+func (h *handler) setFeatureFlagUser(w http.ResponseWriter, r *http.Request, listed bool) {
+	ctx := r.Context()
+	err := h.SetFeatureFlagUser(ctx, way.Param(ctx, "name"), way.Param(ctx, "username"), listed)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err == service.ErrFeatureFlagNotFound || err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// fieldSet is the tree of response fields a client asked for with the fields
+// query parameter, e.g. fields=id,post.content,post.user.username.
+// A field without children selects its whole value.
+type fieldSet map[string]fieldSet
+
+func parseFields(s string) fieldSet {
+	fs := fieldSet{}
+	for _, path := range strings.Split(s, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		node := fs
+		for _, name := range strings.Split(path, ".") {
+			child, ok := node[name]
+			if !ok {
+				child = fieldSet{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+
+	return fs
+}
+
+// shape drops the fields not in the set from decoded JSON.
+// Lists are shaped item by item.
+func (fs fieldSet) shape(v interface{}) interface{} {
+	if len(fs) == 0 {
+		return v
+	}
+
+	switch v := v.(type) {
+	case []interface{}:
+		for i := range v {
+			v[i] = fs.shape(v[i])
+		}
+		return v
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(fs))
+		for name, child := range fs {
+			if val, ok := v[name]; ok {
+				out[name] = child.shape(val)
+			}
+		}
+		return out
+	}
+
+	return v
+}
+
+// respondFields is respond honoring the fields query parameter,
+// so clients on slow networks can download only the attributes they use.
+func respondFields(w http.ResponseWriter, r *http.Request, v interface{}, statusCode int) {
+	fs := parseFields(r.URL.Query().Get("fields"))
+	if len(fs) == 0 {
+		respond(w, v, statusCode)
+		return
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		respondError(w, fmt.Errorf("could not marshal response: %v", err))
+		return
+	}
+
+	var decoded interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err = d.Decode(&decoded); err != nil {
+		respondError(w, fmt.Errorf("could not decode response for shaping: %v", err))
+		return
+	}
+
+	respond(w, fs.shape(decoded), statusCode)
+}
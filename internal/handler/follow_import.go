@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+type importFollowsInput struct {
+	Usernames []string
+}
+
+// importFollows accepts a JSON list of usernames or a CSV export
+// whose first column holds the usernames.
+func (h *handler) importFollows(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in importFollowsInput
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		cr := csv.NewReader(r.Body)
+		cr.FieldsPerRecord = -1
+		for {
+			record, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			username := strings.TrimSpace(record[0])
+			if username == "" || (len(in.Usernames) == 0 && strings.EqualFold(username, "username")) {
+				continue
+			}
+
+			in.Usernames = append(in.Usernames, username)
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fi, err := h.ImportFollows(r.Context(), in.Usernames)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, fi, http.StatusAccepted)
+}
+
+func (h *handler) followImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	importID, _ := strconv.ParseInt(way.Param(ctx, "import_id"), 10, 64)
+	fi, err := h.FollowImport(ctx, importID)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrFollowImportNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, fi, http.StatusOK)
+}
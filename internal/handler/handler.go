@@ -1,44 +1,396 @@
 package handler
 
 import (
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/cursor"
 	"github.com/djomlaa/socnet/internal/service"
 	"github.com/matryer/way"
-	"net/http"
 )
 
+// Service is the core logic the handlers call into.
+// It is implemented by *service.Service.
+type Service interface {
+	AuthSession(ctx context.Context, token string) (service.AuthSession, error)
+	Login(ctx context.Context, email, password string) (service.LoginOutput, error)
+	AuthUser(ctx context.Context) (service.User, error)
+	Sessions(ctx context.Context) ([]service.Session, error)
+	Consent(ctx context.Context) (service.Consent, error)
+	AcceptTerms(ctx context.Context, version string) (service.Consent, error)
+	BeginPasskeyRegistration(ctx context.Context) (service.PasskeyCreationOptions, error)
+	FinishPasskeyRegistration(ctx context.Context, in service.PasskeyRegistrationInput) (service.Passkey, error)
+	Passkeys(ctx context.Context) ([]service.Passkey, error)
+	DeletePasskey(ctx context.Context, passkeyID string) error
+	BeginPasskeyLogin(ctx context.Context) (service.PasskeyRequestOptions, error)
+	PasskeyLogin(ctx context.Context, in service.PasskeyLoginInput) (service.LoginOutput, error)
+	BeginOIDCLogin(ctx context.Context) (service.OIDCAuthRequest, error)
+	OIDCLogin(ctx context.Context, in service.OIDCLoginInput) (service.LoginOutput, error)
+	RevokeSession(ctx context.Context, sessionID int64) error
+	CreateUser(ctx context.Context, email, username, birthdate string) error
+	User(ctx context.Context, username string) (service.UserProfile, error)
+	Users(ctx context.Context, search string, first int, after string) ([]service.UserProfile, error)
+	UpdateAvatar(ctx context.Context, r io.Reader) (string, error)
+	ToggleFollow(ctx context.Context, username string) (service.ToggleFollowOutput, error)
+	TogglePostNotifications(ctx context.Context, username string) (service.TogglePostNotificationsOutput, error)
+	Followers(ctx context.Context, username string, first int, after string) ([]service.UserProfile, error)
+	Followees(ctx context.Context, username string, first int, after string) ([]service.UserProfile, error)
+	SetInterests(ctx context.Context, interests []string) ([]string, error)
+	Discover(ctx context.Context, interest string, first int) (service.DiscoverOutput, error)
+	FollowRecommendations(ctx context.Context, first int) ([]service.UserProfile, error)
+	ImportFollows(ctx context.Context, usernames []string) (service.FollowImport, error)
+	FollowImport(ctx context.Context, importID int64) (service.FollowImport, error)
+	UploadMedia(ctx context.Context, r io.Reader, in service.UploadMediaInput) (service.Media, error)
+	UpdateMedia(ctx context.Context, mediaID int64, in service.UpdateMediaInput) (service.Media, error)
+	UserMedia(ctx context.Context, username string, last int, before int64) ([]service.MediaPost, error)
+	LikedPosts(ctx context.Context, username string, last int, before int64) ([]service.Post, error)
+	PresignUpload(ctx context.Context, in service.PresignUploadInput) (service.PresignedUpload, error)
+	FinalizeUpload(ctx context.Context, uploadID string, in service.UploadMediaInput) (service.Media, error)
+	CreateTusUpload(ctx context.Context, size int64, contentType string) (service.TusUpload, error)
+	TusUpload(ctx context.Context, uploadID string) (service.TusUpload, error)
+	AppendTusUpload(ctx context.Context, uploadID string, offset int64, r io.Reader) (int64, error)
+	DeleteTusUpload(ctx context.Context, uploadID string) error
+	ContentPreferences(ctx context.Context) (service.ContentPreferences, error)
+	UpdateContentPreferences(ctx context.Context, in service.ContentPreferences) (service.ContentPreferences, error)
+	AccessibilitySettings(ctx context.Context) (service.AccessibilitySettings, error)
+	UpdateAccessibilitySettings(ctx context.Context, in service.AccessibilitySettings) (service.AccessibilitySettings, error)
+	PrivacySettings(ctx context.Context) (service.PrivacySettings, error)
+	UpdatePrivacySettings(ctx context.Context, in service.PrivacySettings) (service.PrivacySettings, error)
+	CreatePost(ctx context.Context, in service.CreatePostInput) (service.TimelineItem, error)
+	Posts(ctx context.Context, username string, last int, before int64) ([]service.Post, error)
+	Post(ctx context.Context, postID int64) (service.Post, error)
+	Thread(ctx context.Context, postID int64) ([]service.Post, error)
+	PostTranslation(ctx context.Context, postID int64, lang string) (service.PostTranslation, error)
+	SearchPosts(ctx context.Context, search string, last int, before int64) ([]service.Post, error)
+	PostsByIDs(ctx context.Context, ids []int64) ([]service.Post, error)
+	PostInsights(ctx context.Context, postID int64) (service.PostInsights, error)
+	FollowLink(ctx context.Context, code string) (string, error)
+	NearbyPosts(ctx context.Context, area service.NearbyArea, last int, before int64) ([]service.Post, error)
+	Places(ctx context.Context, search string, last int) ([]service.Place, error)
+	TogglePostLike(ctx context.Context, postID int64) (service.ToggleLikeOutput, error)
+	ToggleBookmark(ctx context.Context, postID int64) (service.ToggleBookmarkOutput, error)
+	BookmarksDelta(ctx context.Context, since *service.SyncPosition) (service.BookmarksDelta, error)
+	TogglePostPin(ctx context.Context, postID int64) (service.TogglePinOutput, error)
+	TogglePostArchive(ctx context.Context, postID int64) (service.ToggleArchiveOutput, error)
+	ArchivedPosts(ctx context.Context, last int, before int64) ([]service.Post, error)
+	AutoDeletePolicy(ctx context.Context) (service.AutoDeletePolicy, error)
+	SetAutoDeletePolicy(ctx context.Context, in service.AutoDeletePolicy) (service.AutoDeletePolicy, error)
+	PreviewAutoDelete(ctx context.Context) (service.AutoDeletePreview, error)
+	Timeline(ctx context.Context, last int, before int, filter service.TimelineFilter) ([]service.TimelineItem, error)
+	SubscribeToTimeline(ctx context.Context) (<-chan service.TimelineItem, error)
+	TrackPresence(ctx context.Context)
+	SubscribeToPresence(ctx context.Context, usernames []string) (<-chan service.Presence, error)
+	TimelineMarker(ctx context.Context) (service.TimelineMarker, error)
+	UpdateTimelineMarker(ctx context.Context, timelineItemID int64) (service.TimelineMarker, error)
+	TimelineUpdates(ctx context.Context, sinceCursor int64, authors int) (service.TimelineUpdates, error)
+	TimelineDelta(ctx context.Context, since *service.SyncPosition) (service.TimelineDelta, error)
+	CreateComment(ctx context.Context, postID int64, content string) (service.Comment, error)
+	Comments(ctx context.Context, postID int64, last int, before service.CommentsCursor, sort string) ([]service.Comment, error)
+	ToggleCommentLike(ctx context.Context, commentID int64) (service.ToggleLikeOutput, error)
+	CreateList(ctx context.Context, name string) (service.List, error)
+	Lists(ctx context.Context) ([]service.List, error)
+	RenameList(ctx context.Context, listID int64, name string) (service.List, error)
+	DeleteList(ctx context.Context, listID int64) error
+	AddListMember(ctx context.Context, listID int64, username string) error
+	RemoveListMember(ctx context.Context, listID int64, username string) error
+	ListMembers(ctx context.Context, listID int64, first int, after string) ([]service.User, error)
+	ListTimeline(ctx context.Context, listID int64, last int, before int64) ([]service.Post, error)
+	CreateCommunity(ctx context.Context, name, description string) (service.Community, error)
+	Communities(ctx context.Context, search string, first int, after string) ([]service.Community, error)
+	Community(ctx context.Context, name string) (service.Community, error)
+	JoinCommunity(ctx context.Context, name string) (service.Community, error)
+	LeaveCommunity(ctx context.Context, name string) (service.Community, error)
+	CommunityPosts(ctx context.Context, name string, last int, before int64) ([]service.Post, error)
+	CommunityMembers(ctx context.Context, name string, first int, after string) ([]service.CommunityMemberOutput, error)
+	SetCommunityModerator(ctx context.Context, name, username string, moderator bool) error
+	SetCommunityPostPinned(ctx context.Context, name string, postID int64, pinned bool) error
+	Emojis(ctx context.Context) ([]service.Emoji, error)
+	CreateEmoji(ctx context.Context, shortcode string, r io.Reader) (service.Emoji, error)
+	DeleteEmoji(ctx context.Context, shortcode string) error
+	Maintenance() service.Maintenance
+	Leaderboards(ctx context.Context) (service.Leaderboards, error)
+	SetVerified(ctx context.Context, username string, verified bool) error
+	SuspendUser(ctx context.Context, username string, in service.SuspendUserInput) error
+	UnsuspendUser(ctx context.Context, username string) error
+	Impersonate(ctx context.Context, username string) (service.LoginOutput, error)
+	AuditLog(ctx context.Context, last int, before int64) ([]service.AuditEntry, error)
+	EventJournal(ctx context.Context, eventType string, last int, before int64) ([]service.JournalEntry, error)
+	SetMaintenance(ctx context.Context, in service.Maintenance) (service.Maintenance, error)
+	FanoutStats(ctx context.Context) (service.FanoutStats, error)
+	Health(ctx context.Context) service.Health
+	AdminSettings(ctx context.Context) (service.Settings, error)
+	ReloadSettings(ctx context.Context) (service.Settings, error)
+	Locale(ctx context.Context) (string, error)
+	SetLocale(ctx context.Context, locale string) error
+	WeeklyInsightsEmail(ctx context.Context) (bool, error)
+	SetWeeklyInsightsEmail(ctx context.Context, enabled bool) error
+	DefaultLicense(ctx context.Context) (string, error)
+	SetDefaultLicense(ctx context.Context, license string) error
+	RegisterPushDevice(ctx context.Context, platform, token string) (service.PushDevice, error)
+	PushDevices(ctx context.Context) ([]service.PushDevice, error)
+	UpdatePushDevice(ctx context.Context, deviceID int64, in service.UpdatePushDeviceInput) (service.PushDevice, error)
+	DeletePushDevice(ctx context.Context, deviceID int64) error
+	EmailStatus(ctx context.Context) (service.EmailStatus, error)
+	ClearEmailSuppression(ctx context.Context) error
+	HandleMailWebhook(ctx context.Context, provider, secret string, body []byte) error
+	Features(ctx context.Context) ([]string, error)
+	FeatureFlags(ctx context.Context) ([]service.FeatureFlag, error)
+	SetFeatureFlag(ctx context.Context, name string, in service.SetFeatureFlagInput) (service.FeatureFlag, error)
+	DeleteFeatureFlag(ctx context.Context, name string) error
+	SetFeatureFlagUser(ctx context.Context, name, username string, listed bool) error
+	ExperimentAssignments(ctx context.Context) ([]service.ExperimentAssignment, error)
+	Experiments(ctx context.Context) ([]service.Experiment, error)
+	SetExperiment(ctx context.Context, name string, in service.SetExperimentInput) (service.Experiment, error)
+	DeleteExperiment(ctx context.Context, name string) error
+	ActiveAnnouncements(ctx context.Context) ([]service.Announcement, error)
+	DismissAnnouncement(ctx context.Context, announcementID int64) error
+	Announcements(ctx context.Context) ([]service.Announcement, error)
+	CreateAnnouncement(ctx context.Context, in service.AnnouncementInput) (service.Announcement, error)
+	UpdateAnnouncement(ctx context.Context, announcementID int64, in service.AnnouncementInput) (service.Announcement, error)
+	DeleteAnnouncement(ctx context.Context, announcementID int64) error
+	UseAPIKey(ctx context.Context, key string) (service.APIKeyUse, error)
+	APIKeys(ctx context.Context) ([]service.APIKey, error)
+	CreateAPIKey(ctx context.Context, in service.APIKeyInput) (service.CreateAPIKeyOutput, error)
+	UpdateAPIKey(ctx context.Context, keyID int64, in service.APIKeyInput) (service.APIKey, error)
+	RevokeAPIKey(ctx context.Context, keyID int64) error
+	APIKeyUsage(ctx context.Context, keyID int64, days int) ([]service.APIKeyUsage, error)
+	DebugAccess(ctx context.Context) error
+	WordFilters(ctx context.Context) ([]service.WordFilter, error)
+	SetWordFilter(ctx context.Context, word, action string) (service.WordFilter, error)
+	DeleteWordFilter(ctx context.Context, word string) error
+	PostReviews(ctx context.Context) ([]service.PostReview, error)
+	ResolvePostReview(ctx context.Context, postID int64) error
+	UserReviews(ctx context.Context) ([]service.UserReview, error)
+	ResolveUserReview(ctx context.Context, username string) error
+	ProvisionUsers(ctx context.Context, users []service.ProvisionUser) ([]service.ProvisionResult, error)
+	ActiveUsers(ctx context.Context, days int) ([]service.ActiveUserCount, error)
+	Retention(ctx context.Context, cohorts int) ([]service.RetentionCohort, error)
+	CreateKeywordAlert(ctx context.Context, keyword, scope string) (service.KeywordAlert, error)
+	KeywordAlerts(ctx context.Context) ([]service.KeywordAlert, error)
+	DeleteKeywordAlert(ctx context.Context, alertID int64) error
+	CreateSavedSearch(ctx context.Context, name, kind, query string) (service.SavedSearch, error)
+	SavedSearches(ctx context.Context, counts bool) ([]service.SavedSearch, error)
+	RunSavedSearch(ctx context.Context, searchID int64) (service.SavedSearchResults, error)
+	DeleteSavedSearch(ctx context.Context, searchID int64) error
+	Notifications(ctx context.Context, last int, before int64) ([]service.Notification, error)
+	SubscribeToNotifications(ctx context.Context) (<-chan service.Notification, error)
+	NotificationsDelta(ctx context.Context, since *service.SyncPosition) (service.NotificationsDelta, error)
+	Activity(ctx context.Context, last int, before time.Time) ([]service.Activity, error)
+	MarkNotificationAsRead(ctx context.Context, notificationID int64) error
+	MarkNotificationsAsRead(ctx context.Context) error
+}
+
+var _ Service = (*service.Service)(nil)
+
 type handler struct {
-	*service.Service
+	Service
+	cursors         *cursor.Codec
+	cache           responseCache
+	deadlines       Deadlines
+	accessLogSample float64
+}
+
+// Options of the handler.
+type Options struct {
+	Deadlines Deadlines
+	// AccessLogSample is the fraction of the successful requests to high volume
+	// routes that are logged, from 0 to 1. Other requests are always logged.
+	AccessLogSample float64
+	// Debug serves the pprof profiles and expvar variables under /debug to admins.
+	Debug bool
 }
 
 // New creates predefined routing.
-func New(s *service.Service) http.Handler {
+// Requests outside /api are served from the static frontend files.
+// Pagination cursors are signed with cursors.
+func New(s Service, cursors *cursor.Codec, static fs.FS, opts Options) http.Handler {
 
-	h := &handler{s}
+	h := &handler{Service: s, cursors: cursors, deadlines: opts.Deadlines, accessLogSample: opts.AccessLogSample}
 
 	api := way.NewRouter()
 	api.HandleFunc("POST", "/login", h.login)
+	api.HandleFunc("POST", "/login/passkey/options", h.beginPasskeyLogin)
+	api.HandleFunc("POST", "/login/passkey", h.passkeyLogin)
+	api.HandleFunc("POST", "/login/oidc/options", h.beginOIDCLogin)
+	api.HandleFunc("POST", "/login/oidc", h.oidcLogin)
 	api.HandleFunc("GET", "/auth_user", h.authUser)
+	api.HandleFunc("GET", "/auth_user/sessions", h.sessions)
+	api.HandleFunc("DELETE", "/auth_user/sessions/:session_id", h.revokeSession)
+	api.HandleFunc("GET", "/auth_user/consent", h.consent)
+	api.HandleFunc("POST", "/auth_user/consent", h.acceptTerms)
+	api.HandleFunc("POST", "/auth_user/passkeys/options", h.beginPasskeyRegistration)
+	api.HandleFunc("POST", "/auth_user/passkeys", h.finishPasskeyRegistration)
+	api.HandleFunc("GET", "/auth_user/passkeys", h.passkeys)
+	api.HandleFunc("DELETE", "/auth_user/passkeys/:passkey_id", h.deletePasskey)
+	api.HandleFunc("GET", "/auth_user/locale", h.locale)
+	api.HandleFunc("PUT", "/auth_user/locale", h.setLocale)
+	api.HandleFunc("GET", "/auth_user/default_license", h.defaultLicense)
+	api.HandleFunc("PUT", "/auth_user/default_license", h.setDefaultLicense)
+	api.HandleFunc("GET", "/auth_user/email_status", h.emailStatus)
+	api.HandleFunc("GET", "/auth_user/weekly_insights_email", h.weeklyInsightsEmail)
+	api.HandleFunc("PUT", "/auth_user/weekly_insights_email", h.setWeeklyInsightsEmail)
+	api.HandleFunc("POST", "/auth_user/push_devices", h.registerPushDevice)
+	api.HandleFunc("GET", "/auth_user/push_devices", h.pushDevices)
+	api.HandleFunc("PUT", "/auth_user/push_devices/:device_id", h.updatePushDevice)
+	api.HandleFunc("DELETE", "/auth_user/push_devices/:device_id", h.deletePushDevice)
+	api.HandleFunc("DELETE", "/auth_user/email_status/suppression", h.clearEmailSuppression)
+	api.HandleFunc("POST", "/webhooks/mail/:provider", h.mailWebhook)
 	api.HandleFunc("POST", "/users", h.createUser)
 	api.HandleFunc("GET", "/users", h.users)
-	api.HandleFunc("GET", "/users/:username", h.user)
+	api.HandleFunc("GET", "/users/:username", h.cacheAnonymous(profileCacheTTL, h.user))
 	api.HandleFunc("PUT", "/auth_user/avatar", h.updateAvatar)
 	api.HandleFunc("POST", "/users/:username/toggle_follow", h.toggleFollow)
+	api.HandleFunc("POST", "/users/:username/toggle_post_notifications", h.togglePostNotifications)
 	api.HandleFunc("GET", "/users/:username/followers", h.followers)
 	api.HandleFunc("GET", "/users/:username/followees", h.followees)
+	api.HandleFunc("PUT", "/auth_user/interests", h.setInterests)
+	api.HandleFunc("GET", "/auth_user/recommendations", h.followRecommendations)
+	api.HandleFunc("GET", "/discover", h.cacheAnonymous(discoverCacheTTL, h.discover))
+	api.HandleFunc("POST", "/auth_user/follows/import", h.importFollows)
+	api.HandleFunc("GET", "/auth_user/follows/imports/:import_id", h.followImport)
+	api.HandleFunc("GET", "/auth_user/content_preferences", h.contentPreferences)
+	api.HandleFunc("PUT", "/auth_user/content_preferences", h.updateContentPreferences)
+	api.HandleFunc("GET", "/auth_user/accessibility", h.accessibilitySettings)
+	api.HandleFunc("PUT", "/auth_user/accessibility", h.updateAccessibilitySettings)
+	api.HandleFunc("GET", "/auth_user/privacy", h.privacySettings)
+	api.HandleFunc("GET", "/auth_user/archived_posts", h.archivedPosts)
+	api.HandleFunc("PUT", "/auth_user/privacy", h.updatePrivacySettings)
+	api.HandleFunc("POST", "/media", h.uploadMedia)
+	api.HandleFunc("PUT", "/media/:media_id", h.updateMedia)
+	api.HandleFunc("POST", "/uploads/presign", h.presignUpload)
+	api.HandleFunc("POST", "/uploads/:upload_id/finalize", h.finalizeUpload)
+	api.HandleFunc("OPTIONS", "/tus", withTus(h.tusOptions))
+	api.HandleFunc("POST", "/tus", withTus(h.createTusUpload))
+	api.HandleFunc("HEAD", "/tus/:upload_id", withTus(h.tusUpload))
+	api.HandleFunc("PATCH", "/tus/:upload_id", withTus(h.appendTusUpload))
+	api.HandleFunc("DELETE", "/tus/:upload_id", withTus(h.deleteTusUpload))
 	api.HandleFunc("POST", "/posts", h.createPost)
-	api.HandleFunc("GET", "/users/:username/posts", h.posts)
-	api.HandleFunc("GET", "/posts/:post_id", h.post)
+	api.HandleFunc("GET", "/posts", h.postsByIDs)
+	api.HandleFunc("GET", "/posts/nearby", h.nearbyPosts)
+	api.HandleFunc("GET", "/places", h.places)
+	api.HandleFunc("GET", "/users/:username/posts", h.cacheAnonymous(profileCacheTTL, h.posts))
+	api.HandleFunc("GET", "/users/:username/media", h.userMedia)
+	api.HandleFunc("GET", "/users/:username/likes", h.likedPosts)
+	api.HandleFunc("GET", "/posts/:post_id", h.cacheAnonymous(postCacheTTL, h.post))
+	api.HandleFunc("GET", "/posts/:post_id/thread", h.cacheAnonymous(postCacheTTL, h.thread))
+	api.HandleFunc("GET", "/posts/:post_id/translation", h.postTranslation)
+	api.HandleFunc("GET", "/posts/:post_id/insights", h.postInsights)
 	api.HandleFunc("POST", "/posts/:post_id/toggle_like", h.togglePostLike)
+	api.HandleFunc("POST", "/posts/:post_id/toggle_bookmark", h.toggleBookmark)
+	api.HandleFunc("GET", "/bookmarks/delta", h.bookmarksDelta)
+	api.HandleFunc("POST", "/posts/:post_id/toggle_pin", h.togglePostPin)
+	api.HandleFunc("POST", "/posts/:post_id/toggle_archive", h.togglePostArchive)
+	api.HandleFunc("GET", "/auth_user/auto_delete", h.autoDeletePolicy)
+	api.HandleFunc("PUT", "/auth_user/auto_delete", h.setAutoDeletePolicy)
+	api.HandleFunc("GET", "/auth_user/auto_delete/preview", h.previewAutoDelete)
 	api.HandleFunc("GET", "/timeline", h.timeline)
+	api.HandleFunc("GET", "/presence", h.presence)
+	api.HandleFunc("GET", "/timeline/updates", h.timelineUpdates)
+	api.HandleFunc("GET", "/timeline/delta", h.timelineDelta)
+	api.HandleFunc("GET", "/timeline/marker", h.timelineMarker)
+	api.HandleFunc("PUT", "/timeline/marker", h.updateTimelineMarker)
 	api.HandleFunc("POST", "/posts/:post_id/comments", h.createComment)
 	api.HandleFunc("GET", "/posts/:post_id/comments", h.comments)
 	api.HandleFunc("POST", "/comments/:comment_id/toggle_like", h.toggleCommentLike)
+	api.HandleFunc("POST", "/lists", h.createList)
+	api.HandleFunc("GET", "/lists", h.lists)
+	api.HandleFunc("PUT", "/lists/:list_id", h.renameList)
+	api.HandleFunc("DELETE", "/lists/:list_id", h.deleteList)
+	api.HandleFunc("GET", "/lists/:list_id/members", h.listMembers)
+	api.HandleFunc("PUT", "/lists/:list_id/members/:username", h.addListMember)
+	api.HandleFunc("DELETE", "/lists/:list_id/members/:username", h.removeListMember)
+	api.HandleFunc("GET", "/lists/:list_id/timeline", h.listTimeline)
+	api.HandleFunc("POST", "/communities", h.createCommunity)
+	api.HandleFunc("GET", "/communities", h.communities)
+	api.HandleFunc("GET", "/communities/:name", h.community)
+	api.HandleFunc("POST", "/communities/:name/join", h.joinCommunity)
+	api.HandleFunc("POST", "/communities/:name/leave", h.leaveCommunity)
+	api.HandleFunc("GET", "/communities/:name/posts", h.communityPosts)
+	api.HandleFunc("GET", "/communities/:name/members", h.communityMembers)
+	api.HandleFunc("PUT", "/communities/:name/moderators/:username", h.addCommunityModerator)
+	api.HandleFunc("DELETE", "/communities/:name/moderators/:username", h.removeCommunityModerator)
+	api.HandleFunc("PUT", "/communities/:name/pins/:post_id", h.pinCommunityPost)
+	api.HandleFunc("DELETE", "/communities/:name/pins/:post_id", h.unpinCommunityPost)
+	api.HandleFunc("GET", "/emojis", h.emojis)
+	api.HandleFunc("PUT", "/admin/emojis/:shortcode", h.createEmoji)
+	api.HandleFunc("DELETE", "/admin/emojis/:shortcode", h.deleteEmoji)
+	api.HandleFunc("GET", "/maintenance", h.maintenance)
+	api.HandleFunc("GET", "/leaderboards", h.cacheAnonymous(leaderboardCacheTTL, h.leaderboards))
+	api.HandleFunc("PUT", "/admin/maintenance", h.setMaintenance)
+	api.HandleFunc("PUT", "/admin/users/:username/verified", h.setVerified)
+	api.HandleFunc("PUT", "/admin/users/:username/suspension", h.suspendUser)
+	api.HandleFunc("DELETE", "/admin/users/:username/suspension", h.unsuspendUser)
+	api.HandleFunc("POST", "/admin/users/:username/impersonate", h.impersonate)
+	api.HandleFunc("POST", "/admin/users/provision", h.provisionUsers)
+	api.HandleFunc("GET", "/admin/audit_log", h.auditLog)
+	api.HandleFunc("GET", "/admin/events", h.eventJournal)
+	api.HandleFunc("GET", "/admin/fanout_stats", h.fanoutStats)
+	api.HandleFunc("GET", "/admin/active_users", h.activeUsers)
+	api.HandleFunc("GET", "/admin/retention", h.retention)
+	api.HandleFunc("GET", "/admin/settings", h.settings)
+	api.HandleFunc("POST", "/admin/settings/reload", h.reloadSettings)
+	api.HandleFunc("GET", "/features", h.features)
+	api.HandleFunc("GET", "/admin/feature_flags", h.featureFlags)
+	api.HandleFunc("PUT", "/admin/feature_flags/:name", h.setFeatureFlag)
+	api.HandleFunc("DELETE", "/admin/feature_flags/:name", h.deleteFeatureFlag)
+	api.HandleFunc("PUT", "/admin/feature_flags/:name/users/:username", h.addFeatureFlagUser)
+	api.HandleFunc("DELETE", "/admin/feature_flags/:name/users/:username", h.removeFeatureFlagUser)
+	api.HandleFunc("GET", "/experiments", h.experimentAssignments)
+	api.HandleFunc("GET", "/admin/experiments", h.experiments)
+	api.HandleFunc("PUT", "/admin/experiments/:name", h.setExperiment)
+	api.HandleFunc("DELETE", "/admin/experiments/:name", h.deleteExperiment)
+	api.HandleFunc("GET", "/announcements", h.activeAnnouncements)
+	api.HandleFunc("PUT", "/announcements/:announcement_id/dismissed", h.dismissAnnouncement)
+	api.HandleFunc("GET", "/admin/announcements", h.announcements)
+	api.HandleFunc("POST", "/admin/announcements", h.createAnnouncement)
+	api.HandleFunc("PUT", "/admin/announcements/:announcement_id", h.updateAnnouncement)
+	api.HandleFunc("DELETE", "/admin/announcements/:announcement_id", h.deleteAnnouncement)
+	api.HandleFunc("GET", "/admin/api_keys", h.apiKeys)
+	api.HandleFunc("POST", "/admin/api_keys", h.createAPIKey)
+	api.HandleFunc("PUT", "/admin/api_keys/:key_id", h.updateAPIKey)
+	api.HandleFunc("DELETE", "/admin/api_keys/:key_id", h.revokeAPIKey)
+	api.HandleFunc("GET", "/admin/api_keys/:key_id/usage", h.apiKeyUsage)
+
+	// Read-only public API for third-party tools, with API keys.
+	api.HandleFunc("GET", "/public/users/:username", h.withAPIKey(h.cacheAnonymous(profileCacheTTL, h.user)))
+	api.HandleFunc("GET", "/public/users/:username/posts", h.withAPIKey(h.cacheAnonymous(profileCacheTTL, h.posts)))
+	api.HandleFunc("GET", "/public/posts/:post_id", h.withAPIKey(h.cacheAnonymous(postCacheTTL, h.post)))
+	api.HandleFunc("GET", "/admin/word_filters", h.wordFilters)
+	api.HandleFunc("PUT", "/admin/word_filters/:word", h.setWordFilter)
+	api.HandleFunc("DELETE", "/admin/word_filters/:word", h.deleteWordFilter)
+	api.HandleFunc("GET", "/admin/post_reviews", h.postReviews)
+	api.HandleFunc("DELETE", "/admin/post_reviews/:post_id", h.resolvePostReview)
+	api.HandleFunc("GET", "/admin/user_reviews", h.userReviews)
+	api.HandleFunc("DELETE", "/admin/user_reviews/:username", h.resolveUserReview)
+	api.HandleFunc("POST", "/auth_user/keyword_alerts", h.createKeywordAlert)
+	api.HandleFunc("GET", "/auth_user/keyword_alerts", h.keywordAlerts)
+	api.HandleFunc("DELETE", "/auth_user/keyword_alerts/:alert_id", h.deleteKeywordAlert)
+	api.HandleFunc("GET", "/search/posts", h.searchPosts)
+	api.HandleFunc("POST", "/auth_user/saved_searches", h.createSavedSearch)
+	api.HandleFunc("GET", "/auth_user/saved_searches", h.savedSearches)
+	api.HandleFunc("POST", "/auth_user/saved_searches/:search_id/run", h.runSavedSearch)
+	api.HandleFunc("DELETE", "/auth_user/saved_searches/:search_id", h.deleteSavedSearch)
 	api.HandleFunc("GET", "/notifications", h.notifications)
+	api.HandleFunc("GET", "/notifications/delta", h.notificationsDelta)
+	api.HandleFunc("GET", "/activity", h.activity)
 	api.HandleFunc("POST", "/notifications/:notification_id/mark_as_read", h.markNotificationAsRead)
 	api.HandleFunc("POST", "/mark_notifications_as_read", h.markNotificationsAsRead)
 
 	r := way.NewRouter()
-	r.Handle("*", "/api...", http.StripPrefix("/api", h.withAuth(api)))
+	r.Handle("*", "/api...", http.StripPrefix("/api", h.withDeadline(h.withAuth(h.withPolicy(h.withMaintenance(api))))))
+	r.Handle("GET", "/img...", http.StripPrefix("/img", http.FileServer(http.Dir(imgDir))))
+	r.HandleFunc("GET", "/l/:code", h.followLink)
+	r.HandleFunc("GET", "/readyz", h.readyz)
+	if opts.Debug {
+		debug := h.debugHandler()
+		r.Handle("GET", "/debug...", debug)
+		// The symbol lookup is posted by go tool pprof.
+		r.Handle("POST", "/debug/pprof/symbol", debug)
+	}
+	r.Handle("GET", "/...", spa(static))
 
-	return r
+	return h.withAccessLog(r)
 }
@@ -0,0 +1,344 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/djomlaa/socnet/internal/cursor"
+	"github.com/djomlaa/socnet/internal/handler"
+	"github.com/djomlaa/socnet/internal/handler/mock"
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// route of the API, relative to /api. Requests with a method that takes
+// a body send an empty JSON object unless body is set.
+type route struct {
+	method   string
+	path     string
+	query    string
+	header   http.Header
+	body     string
+	notFound []error
+}
+
+// routes whose service calls can fail. notFound lists the errors of missing
+// resources each one answers with a 404.
+var routes = []route{
+	{method: "POST", path: "/login", notFound: []error{service.ErrUserNotFound}},
+	{method: "POST", path: "/login/passkey/options"},
+	{method: "POST", path: "/login/passkey"},
+	{method: "POST", path: "/login/oidc/options", notFound: []error{service.ErrOIDCDisabled}},
+	{method: "POST", path: "/login/oidc", notFound: []error{service.ErrOIDCDisabled}},
+	{method: "GET", path: "/auth_user", notFound: []error{service.ErrUserNotFound}},
+	{method: "GET", path: "/auth_user/sessions"},
+	{method: "DELETE", path: "/auth_user/sessions/:session_id", notFound: []error{service.ErrSessionNotFound}},
+	{method: "GET", path: "/auth_user/consent"},
+	{method: "POST", path: "/auth_user/consent"},
+	{method: "POST", path: "/auth_user/passkeys/options"},
+	{method: "POST", path: "/auth_user/passkeys"},
+	{method: "GET", path: "/auth_user/passkeys"},
+	{method: "DELETE", path: "/auth_user/passkeys/:passkey_id", notFound: []error{service.ErrPasskeyNotFound}},
+	{method: "GET", path: "/auth_user/locale"},
+	{method: "PUT", path: "/auth_user/locale"},
+	{method: "GET", path: "/auth_user/default_license"},
+	{method: "PUT", path: "/auth_user/default_license"},
+	{method: "GET", path: "/auth_user/email_status"},
+	{method: "GET", path: "/auth_user/weekly_insights_email"},
+	{method: "PUT", path: "/auth_user/weekly_insights_email"},
+	{method: "POST", path: "/auth_user/push_devices"},
+	{method: "GET", path: "/auth_user/push_devices"},
+	{method: "PUT", path: "/auth_user/push_devices/:device_id", notFound: []error{service.ErrPushDeviceNotFound}},
+	{method: "DELETE", path: "/auth_user/push_devices/:device_id", notFound: []error{service.ErrPushDeviceNotFound}},
+	{method: "DELETE", path: "/auth_user/email_status/suppression"},
+	{method: "POST", path: "/webhooks/mail/:provider", notFound: []error{service.ErrUnknownMailProvider}},
+	{method: "POST", path: "/users"},
+	{method: "GET", path: "/users"},
+	{method: "GET", path: "/users/:username", notFound: []error{service.ErrUserNotFound}},
+	{method: "PUT", path: "/auth_user/avatar"},
+	{method: "POST", path: "/users/:username/toggle_follow", notFound: []error{service.ErrUserNotFound}},
+	{method: "POST", path: "/users/:username/toggle_post_notifications", notFound: []error{service.ErrUserNotFound}},
+	{method: "GET", path: "/users/:username/followers", notFound: []error{service.ErrUserNotFound}},
+	{method: "GET", path: "/users/:username/followees", notFound: []error{service.ErrUserNotFound}},
+	{method: "PUT", path: "/auth_user/interests"},
+	{method: "GET", path: "/auth_user/recommendations"},
+	{method: "GET", path: "/discover"},
+	{method: "POST", path: "/auth_user/follows/import"},
+	{method: "GET", path: "/auth_user/follows/imports/:import_id", notFound: []error{service.ErrFollowImportNotFound}},
+	{method: "GET", path: "/auth_user/content_preferences", notFound: []error{service.ErrUserNotFound}},
+	{method: "PUT", path: "/auth_user/content_preferences"},
+	{method: "GET", path: "/auth_user/accessibility", notFound: []error{service.ErrUserNotFound}},
+	{method: "PUT", path: "/auth_user/accessibility"},
+	{method: "GET", path: "/auth_user/privacy", notFound: []error{service.ErrUserNotFound}},
+	{method: "GET", path: "/auth_user/archived_posts"},
+	{method: "PUT", path: "/auth_user/privacy"},
+	{method: "POST", path: "/media"},
+	{method: "PUT", path: "/media/:media_id", notFound: []error{service.ErrMediaNotFound}},
+	{method: "POST", path: "/uploads/presign"},
+	{method: "POST", path: "/uploads/:upload_id/finalize", notFound: []error{service.ErrUploadNotFound}},
+	{method: "POST", path: "/tus", header: tusHeader("Upload-Length", "1")},
+	{method: "HEAD", path: "/tus/:upload_id", header: tusHeader(), notFound: []error{service.ErrUploadNotFound}},
+	{method: "PATCH", path: "/tus/:upload_id", body: "x", header: tusHeader("Content-Type", "application/offset+octet-stream", "Upload-Offset", "0"), notFound: []error{service.ErrUploadNotFound}},
+	{method: "DELETE", path: "/tus/:upload_id", header: tusHeader(), notFound: []error{service.ErrUploadNotFound}},
+	{method: "POST", path: "/posts", notFound: []error{service.ErrCommunityNotFound, service.ErrMediaNotFound, service.ErrPlaceNotFound, service.ErrPostNotFound}},
+	{method: "GET", path: "/posts"},
+	{method: "GET", path: "/posts/nearby", query: "lat=0&lng=0"},
+	{method: "GET", path: "/places"},
+	{method: "GET", path: "/users/:username/posts"},
+	{method: "GET", path: "/users/:username/media"},
+	{method: "GET", path: "/users/:username/likes", notFound: []error{service.ErrUserNotFound}},
+	{method: "GET", path: "/posts/:post_id", notFound: []error{service.ErrPostNotFound}},
+	{method: "GET", path: "/posts/:post_id/thread", notFound: []error{service.ErrPostNotFound}},
+	{method: "GET", path: "/posts/:post_id/translation", notFound: []error{service.ErrPostNotFound}},
+	{method: "GET", path: "/posts/:post_id/insights", notFound: []error{service.ErrPostNotFound}},
+	{method: "POST", path: "/posts/:post_id/toggle_like", notFound: []error{service.ErrPostNotFound}},
+	{method: "POST", path: "/posts/:post_id/toggle_bookmark", notFound: []error{service.ErrPostNotFound}},
+	{method: "GET", path: "/bookmarks/delta"},
+	{method: "POST", path: "/posts/:post_id/toggle_pin", notFound: []error{service.ErrPostNotFound}},
+	{method: "POST", path: "/posts/:post_id/toggle_archive", notFound: []error{service.ErrPostNotFound}},
+	{method: "GET", path: "/auth_user/auto_delete", notFound: []error{service.ErrUserNotFound}},
+	{method: "PUT", path: "/auth_user/auto_delete"},
+	{method: "GET", path: "/auth_user/auto_delete/preview"},
+	{method: "GET", path: "/timeline"},
+	{method: "GET", path: "/presence"},
+	{method: "GET", path: "/timeline/updates"},
+	{method: "GET", path: "/timeline/delta"},
+	{method: "GET", path: "/timeline/marker"},
+	{method: "PUT", path: "/timeline/marker", notFound: []error{service.ErrTimelineItemNotFound}},
+	{method: "POST", path: "/posts/:post_id/comments", notFound: []error{service.ErrPostNotFound}},
+	{method: "GET", path: "/posts/:post_id/comments"},
+	{method: "POST", path: "/comments/:comment_id/toggle_like", notFound: []error{service.ErrCommentNotFound}},
+	{method: "POST", path: "/lists"},
+	{method: "GET", path: "/lists"},
+	{method: "PUT", path: "/lists/:list_id", notFound: []error{service.ErrListNotFound}},
+	{method: "DELETE", path: "/lists/:list_id", notFound: []error{service.ErrListNotFound}},
+	{method: "GET", path: "/lists/:list_id/members", notFound: []error{service.ErrListNotFound}},
+	{method: "PUT", path: "/lists/:list_id/members/:username", notFound: []error{service.ErrListNotFound, service.ErrUserNotFound}},
+	{method: "DELETE", path: "/lists/:list_id/members/:username", notFound: []error{service.ErrListNotFound, service.ErrUserNotFound}},
+	{method: "GET", path: "/lists/:list_id/timeline", notFound: []error{service.ErrListNotFound}},
+	{method: "POST", path: "/communities"},
+	{method: "GET", path: "/communities"},
+	{method: "GET", path: "/communities/:name", notFound: []error{service.ErrCommunityNotFound}},
+	{method: "POST", path: "/communities/:name/join", notFound: []error{service.ErrCommunityNotFound}},
+	{method: "POST", path: "/communities/:name/leave", notFound: []error{service.ErrCommunityNotFound}},
+	{method: "GET", path: "/communities/:name/posts", notFound: []error{service.ErrCommunityNotFound}},
+	{method: "GET", path: "/communities/:name/members", notFound: []error{service.ErrCommunityNotFound}},
+	{method: "PUT", path: "/communities/:name/moderators/:username", notFound: []error{service.ErrCommunityNotFound, service.ErrNotCommunityMember}},
+	{method: "DELETE", path: "/communities/:name/moderators/:username", notFound: []error{service.ErrCommunityNotFound, service.ErrNotCommunityMember}},
+	{method: "PUT", path: "/communities/:name/pins/:post_id", notFound: []error{service.ErrCommunityNotFound, service.ErrPostNotFound}},
+	{method: "DELETE", path: "/communities/:name/pins/:post_id", notFound: []error{service.ErrCommunityNotFound, service.ErrPostNotFound}},
+	{method: "GET", path: "/emojis"},
+	{method: "PUT", path: "/admin/emojis/:shortcode"},
+	{method: "DELETE", path: "/admin/emojis/:shortcode", notFound: []error{service.ErrEmojiNotFound}},
+	{method: "GET", path: "/leaderboards"},
+	{method: "PUT", path: "/admin/maintenance"},
+	{method: "PUT", path: "/admin/users/:username/verified", notFound: []error{service.ErrUserNotFound}},
+	{method: "PUT", path: "/admin/users/:username/suspension", notFound: []error{service.ErrUserNotFound}},
+	{method: "DELETE", path: "/admin/users/:username/suspension", notFound: []error{service.ErrUserNotFound}},
+	{method: "POST", path: "/admin/users/:username/impersonate", notFound: []error{service.ErrUserNotFound}},
+	{method: "POST", path: "/admin/users/provision"},
+	{method: "GET", path: "/admin/audit_log"},
+	{method: "GET", path: "/admin/events"},
+	{method: "GET", path: "/admin/fanout_stats"},
+	{method: "GET", path: "/admin/active_users"},
+	{method: "GET", path: "/admin/retention"},
+	{method: "GET", path: "/admin/settings"},
+	{method: "POST", path: "/admin/settings/reload"},
+	{method: "GET", path: "/features"},
+	{method: "GET", path: "/admin/feature_flags"},
+	{method: "PUT", path: "/admin/feature_flags/:name"},
+	{method: "DELETE", path: "/admin/feature_flags/:name", notFound: []error{service.ErrFeatureFlagNotFound}},
+	{method: "PUT", path: "/admin/feature_flags/:name/users/:username", notFound: []error{service.ErrFeatureFlagNotFound, service.ErrUserNotFound}},
+	{method: "DELETE", path: "/admin/feature_flags/:name/users/:username", notFound: []error{service.ErrFeatureFlagNotFound, service.ErrUserNotFound}},
+	{method: "GET", path: "/experiments"},
+	{method: "GET", path: "/admin/experiments"},
+	{method: "PUT", path: "/admin/experiments/:name"},
+	{method: "DELETE", path: "/admin/experiments/:name", notFound: []error{service.ErrExperimentNotFound}},
+	{method: "GET", path: "/announcements"},
+	{method: "PUT", path: "/announcements/:announcement_id/dismissed", notFound: []error{service.ErrAnnouncementNotFound}},
+	{method: "GET", path: "/admin/announcements"},
+	{method: "POST", path: "/admin/announcements"},
+	{method: "PUT", path: "/admin/announcements/:announcement_id", notFound: []error{service.ErrAnnouncementNotFound}},
+	{method: "DELETE", path: "/admin/announcements/:announcement_id", notFound: []error{service.ErrAnnouncementNotFound}},
+	{method: "GET", path: "/admin/api_keys"},
+	{method: "POST", path: "/admin/api_keys"},
+	{method: "PUT", path: "/admin/api_keys/:key_id", notFound: []error{service.ErrAPIKeyNotFound}},
+	{method: "DELETE", path: "/admin/api_keys/:key_id", notFound: []error{service.ErrAPIKeyNotFound}},
+	{method: "GET", path: "/admin/api_keys/:key_id/usage", notFound: []error{service.ErrAPIKeyNotFound}},
+	{method: "GET", path: "/public/users/:username", header: http.Header{"X-Api-Key": {"key"}}, notFound: []error{service.ErrUserNotFound}},
+	{method: "GET", path: "/public/users/:username/posts", header: http.Header{"X-Api-Key": {"key"}}},
+	{method: "GET", path: "/public/posts/:post_id", header: http.Header{"X-Api-Key": {"key"}}, notFound: []error{service.ErrPostNotFound}},
+	{method: "GET", path: "/admin/word_filters"},
+	{method: "PUT", path: "/admin/word_filters/:word"},
+	{method: "DELETE", path: "/admin/word_filters/:word", notFound: []error{service.ErrWordFilterNotFound}},
+	{method: "GET", path: "/admin/post_reviews"},
+	{method: "DELETE", path: "/admin/post_reviews/:post_id", notFound: []error{service.ErrPostNotFound}},
+	{method: "GET", path: "/admin/user_reviews"},
+	{method: "DELETE", path: "/admin/user_reviews/:username", notFound: []error{service.ErrUserNotFound}},
+	{method: "POST", path: "/auth_user/keyword_alerts"},
+	{method: "GET", path: "/auth_user/keyword_alerts"},
+	{method: "DELETE", path: "/auth_user/keyword_alerts/:alert_id", notFound: []error{service.ErrKeywordAlertNotFound}},
+	{method: "GET", path: "/search/posts"},
+	{method: "POST", path: "/auth_user/saved_searches"},
+	{method: "GET", path: "/auth_user/saved_searches"},
+	{method: "POST", path: "/auth_user/saved_searches/:search_id/run", notFound: []error{service.ErrSavedSearchNotFound}},
+	{method: "DELETE", path: "/auth_user/saved_searches/:search_id", notFound: []error{service.ErrSavedSearchNotFound}},
+	{method: "GET", path: "/notifications"},
+	{method: "GET", path: "/notifications/delta"},
+	{method: "GET", path: "/activity"},
+	{method: "POST", path: "/notifications/:notification_id/mark_as_read"},
+	{method: "POST", path: "/mark_notifications_as_read"},
+}
+
+var reParam = regexp.MustCompile(`:\w+`)
+
+func TestMain(m *testing.M) {
+	// Internal errors and access are logged on every request.
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func tusHeader(kv ...string) http.Header {
+	h := http.Header{"Tus-Resumable": {"1.0.0"}}
+	for i := 0; i < len(kv); i += 2 {
+		h.Set(kv[i], kv[i+1])
+	}
+	return h
+}
+
+// failingService returns a mock whose methods all fail with err,
+// but for those of the middlewares in front of every route.
+func failingService(err error) *mock.Service {
+	s := &mock.Service{}
+	v := reflect.ValueOf(s).Elem()
+	errType := reflect.TypeOf((*error)(nil)).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		ft := v.Field(i).Type()
+		v.Field(i).Set(reflect.MakeFunc(ft, func([]reflect.Value) []reflect.Value {
+			out := make([]reflect.Value, ft.NumOut())
+			for j := range out {
+				out[j] = reflect.Zero(ft.Out(j))
+				if ft.Out(j) == errType {
+					out[j] = reflect.ValueOf(&err).Elem()
+				}
+			}
+			return out
+		}))
+	}
+
+	s.UseAPIKeyFunc = func(ctx context.Context, key string) (service.APIKeyUse, error) {
+		return service.APIKeyUse{DailyQuota: 1, RateLimit: 1}, nil
+	}
+
+	return s
+}
+
+type statusCase struct {
+	name   string
+	err    error
+	status int
+}
+
+func TestRoutesErrorStatus(t *testing.T) {
+	cases := []statusCase{
+		{"unauthenticated", service.ErrUnauthenticated, http.StatusUnauthorized},
+		{"forbidden", service.ErrForbidden, http.StatusForbidden},
+		{"invalid", validation.Errors{{Field: "field", Message: "invalid"}}, http.StatusUnprocessableEntity},
+		{"internal", errors.New("internal"), http.StatusInternalServerError},
+	}
+
+	for _, rt := range routes {
+		rt := rt
+		t.Run(rt.method+" "+rt.path, func(t *testing.T) {
+			cc := append([]statusCase{}, cases...)
+			for _, err := range rt.notFound {
+				cc = append(cc, statusCase{err.Error(), err, http.StatusNotFound})
+			}
+
+			for _, c := range cc {
+				h := handler.New(failingService(c.err), cursor.New("secret"), fstest.MapFS{}, handler.Options{})
+
+				body := rt.body
+				if body == "" && (rt.method == http.MethodPost || rt.method == http.MethodPut || rt.method == http.MethodPatch) {
+					body = "{}"
+				}
+
+				target := "/api" + reParam.ReplaceAllString(rt.path, "1")
+				if rt.query != "" {
+					target += "?" + rt.query
+				}
+
+				req := httptest.NewRequest(rt.method, target, strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				for k, vv := range rt.header {
+					req.Header[k] = vv
+				}
+
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				if rec.Code != c.status {
+					t.Errorf("%s: got status %d, want %d: %s", c.name, rec.Code, c.status, strings.TrimSpace(rec.Body.String()))
+				}
+
+				// Falling through to another error response writes the body twice.
+				want := c.err.Error()
+				if c.status == http.StatusInternalServerError {
+					want = http.StatusText(c.status)
+				}
+				if got := strings.TrimSpace(rec.Body.String()); c.status != http.StatusUnprocessableEntity && got != want {
+					t.Errorf("%s: got body %q, want %q", c.name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCachedResponseScope(t *testing.T) {
+	tests := []struct {
+		path   string
+		header http.Header
+		want   string
+	}{
+		{"/posts/1", nil, "public"},
+		{"/users/1", nil, "public"},
+		{"/public/posts/1", http.Header{"X-Api-Key": {"key"}}, "private"},
+		{"/public/users/1", http.Header{"X-Api-Key": {"key"}}, "private"},
+		{"/public/users/1/posts", http.Header{"X-Api-Key": {"key"}}, "private"},
+	}
+
+	h := handler.New(failingService(nil), cursor.New("secret"), fstest.MapFS{}, handler.Options{})
+	for _, tt := range tests {
+		// Twice, for a cache miss and then a hit.
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/api"+tt.path, nil)
+			for k, vv := range tt.header {
+				req.Header[k] = vv
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s: got status %d, want 200: %s", tt.path, rec.Code, strings.TrimSpace(rec.Body.String()))
+			}
+
+			cc := rec.Header().Get("Cache-Control")
+			if !strings.HasPrefix(cc, tt.want+",") {
+				t.Errorf("%s (%s): got Cache-Control %q, want %s", tt.path, rec.Header().Get("X-Cache"), cc, tt.want)
+			}
+
+			if vary := rec.Header().Get("Vary"); !strings.Contains(vary, "X-API-Key") {
+				t.Errorf("%s: got Vary %q, want it to include X-API-Key", tt.path, vary)
+			}
+		}
+	}
+}
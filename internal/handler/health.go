@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+// readyz reports whether the instance can take traffic, with the status of each
+// dependency. It fails with 503 when one is down, not merely degraded, so a slow
+// dependency doesn't take every instance out of the load balancer at once.
+func (h *handler) readyz(w http.ResponseWriter, r *http.Request) {
+	health := h.Health(r.Context())
+	w.Header().Set("Cache-Control", "no-store")
+
+	statusCode := http.StatusOK
+	if health.Status == service.HealthDown {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	respond(w, health, statusCode)
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+type setInterestsInput struct {
+	Interests []string
+}
+
+func (h *handler) setInterests(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in setInterestsInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	interests, err := h.SetInterests(r.Context(), in.Interests)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, interests, http.StatusOK)
+}
+
+func (h *handler) discover(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	first, _ := strconv.Atoi(q.Get("first"))
+	out, err := h.Discover(r.Context(), q.Get("interest"), first)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusOK)
+}
+
+func (h *handler) followRecommendations(w http.ResponseWriter, r *http.Request) {
+	first, _ := strconv.Atoi(r.URL.Query().Get("first"))
+	uu, err := h.FollowRecommendations(r.Context(), first)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondFields(w, r, uu, http.StatusOK)
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+type createKeywordAlertInput struct {
+	Keyword string
+	Scope   string
+}
+
+func (h *handler) createKeywordAlert(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in createKeywordAlertInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a, err := h.CreateKeywordAlert(r.Context(), in.Keyword, in.Scope)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrKeywordAlertExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, a, http.StatusCreated)
+}
+
+func (h *handler) keywordAlerts(w http.ResponseWriter, r *http.Request) {
+	aa, err := h.KeywordAlerts(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, aa, http.StatusOK)
+}
+
+func (h *handler) deleteKeywordAlert(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	alertID, _ := strconv.ParseInt(way.Param(ctx, "alert_id"), 10, 64)
+	err := h.DeleteKeywordAlert(ctx, alertID)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrKeywordAlertNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,13 @@
+package handler
+
+import "net/http"
+
+func (h *handler) leaderboards(w http.ResponseWriter, r *http.Request) {
+	out, err := h.Leaderboards(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusOK)
+}
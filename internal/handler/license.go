@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+type defaultLicenseInput struct {
+	License string `json:"license"`
+}
+
+func (h *handler) defaultLicense(w http.ResponseWriter, r *http.Request) {
+	license, err := h.DefaultLicense(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, defaultLicenseInput{License: license}, http.StatusOK)
+}
+
+func (h *handler) setDefaultLicense(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in defaultLicenseInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := h.SetDefaultLicense(r.Context(), in.License)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
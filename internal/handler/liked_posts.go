@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+func (h *handler) likedPosts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	last, _ := strconv.Atoi(q.Get("last"))
+	var before int64
+	if err := h.decodeCursor(r, "before", cursorLikedPosts, &before); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	pp, err := h.LikedPosts(ctx, way.Param(ctx, "username"), last, before)
+	if err == service.ErrLikesHidden {
+		respond(w, hiddenOutput{Hidden: true}, http.StatusForbidden)
+		return
+	}
+
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if n := len(pp); n != 0 {
+		h.linkNext(w, r, "before", cursorLikedPosts, pp[n-1].ID)
+	}
+
+	respond(w, pp, http.StatusOK)
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+type listInput struct {
+	Name string
+}
+
+func (h *handler) createList(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in listInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	l, err := h.CreateList(r.Context(), in.Name)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, l, http.StatusCreated)
+}
+
+func (h *handler) lists(w http.ResponseWriter, r *http.Request) {
+	ll, err := h.Lists(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, ll, http.StatusOK)
+}
+
+func (h *handler) renameList(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in listInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	listID, _ := strconv.ParseInt(way.Param(ctx, "list_id"), 10, 64)
+	l, err := h.RenameList(ctx, listID, in.Name)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrListNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, l, http.StatusOK)
+}
+
+func (h *handler) deleteList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	listID, _ := strconv.ParseInt(way.Param(ctx, "list_id"), 10, 64)
+	err := h.DeleteList(ctx, listID)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrListNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) addListMember(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	listID, _ := strconv.ParseInt(way.Param(ctx, "list_id"), 10, 64)
+	h.respondListMemberUpdate(w, h.AddListMember(ctx, listID, way.Param(ctx, "username")))
+}
+
+func (h *handler) removeListMember(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	listID, _ := strconv.ParseInt(way.Param(ctx, "list_id"), 10, 64)
+	h.respondListMemberUpdate(w, h.RemoveListMember(ctx, listID, way.Param(ctx, "username")))
+}
+
+func (h *handler) respondListMemberUpdate(w http.ResponseWriter, err error) {
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrListNotFound || err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) listMembers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	listID, _ := strconv.ParseInt(way.Param(ctx, "list_id"), 10, 64)
+	first, _ := strconv.Atoi(q.Get("first"))
+	var after string
+	if err := h.decodeCursor(r, "after", cursorUsers, &after); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	uu, err := h.ListMembers(ctx, listID, first, after)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrListNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if n := len(uu); n != 0 {
+		h.linkNext(w, r, "after", cursorUsers, uu[n-1].Username)
+	}
+
+	respond(w, uu, http.StatusOK)
+}
+
+func (h *handler) listTimeline(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	listID, _ := strconv.ParseInt(way.Param(ctx, "list_id"), 10, 64)
+	last, _ := strconv.Atoi(q.Get("last"))
+	var before int64
+	if err := h.decodeCursor(r, "before", cursorPosts, &before); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	pp, err := h.ListTimeline(ctx, listID, last, before)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrListNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if n := len(pp); n != 0 {
+		h.linkNext(w, r, "before", cursorPosts, pp[n-1].ID)
+	}
+
+	respondFields(w, r, pp, http.StatusOK)
+}
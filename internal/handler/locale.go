@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+type localeInput struct {
+	Locale string `json:"locale"`
+}
+
+func (h *handler) locale(w http.ResponseWriter, r *http.Request) {
+	locale, err := h.Locale(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, localeInput{Locale: locale}, http.StatusOK)
+}
+
+func (h *handler) setLocale(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in localeInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := h.SetLocale(r.Context(), in.Locale)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
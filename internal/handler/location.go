@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// nearbyPosts searches within a radius of lat and lng or, when given,
+// within bbox as comma separated west, south, east and north edges.
+func (h *handler) nearbyPosts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var area service.NearbyArea
+	if bbox := q.Get("bbox"); bbox != "" {
+		b, err := parseBoundingBox(bbox)
+		if err != nil {
+			respondError(w, validation.Errors{{Field: "bbox", Message: "invalid bounding box"}})
+			return
+		}
+
+		area.Bounds = &b
+	} else {
+		var err error
+		if area.Latitude, err = strconv.ParseFloat(q.Get("lat"), 64); err != nil {
+			respondError(w, validation.Errors{{Field: "lat", Message: "invalid latitude"}})
+			return
+		}
+
+		if area.Longitude, err = strconv.ParseFloat(q.Get("lng"), 64); err != nil {
+			respondError(w, validation.Errors{{Field: "lng", Message: "invalid longitude"}})
+			return
+		}
+
+		area.Radius, _ = strconv.Atoi(q.Get("radius"))
+	}
+
+	last, _ := strconv.Atoi(q.Get("last"))
+	var before int64
+	if err := h.decodeCursor(r, "before", cursorPosts, &before); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	pp, err := h.NearbyPosts(r.Context(), area, last, before)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if n := len(pp); n != 0 {
+		h.linkNext(w, r, "before", cursorPosts, pp[n-1].ID)
+	}
+
+	respondFields(w, r, pp, http.StatusOK)
+}
+
+func parseBoundingBox(s string) (service.BoundingBox, error) {
+	var b service.BoundingBox
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return b, strconv.ErrSyntax
+	}
+
+	edges := []*float64{&b.West, &b.South, &b.East, &b.North}
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return b, err
+		}
+
+		*edges[i] = f
+	}
+
+	return b, nil
+}
+
+func (h *handler) places(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	last, _ := strconv.Atoi(q.Get("last"))
+	pp, err := h.Places(r.Context(), q.Get("search"), last)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, pp, http.StatusOK)
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+// maintenanceRetryAfter hints clients how many seconds to wait during maintenance.
+const maintenanceRetryAfter = "120"
+
+// withMaintenance refuses mutating requests with 503 while maintenance is enabled.
+// The maintenance endpoint itself stays reachable so an admin can turn it off.
+func (h *handler) withMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.URL.Path == "/admin/maintenance" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		m := h.Maintenance()
+		if !m.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+		http.Error(w, m.Message, http.StatusServiceUnavailable)
+	})
+}
+
+func (h *handler) maintenance(w http.ResponseWriter, r *http.Request) {
+	respond(w, h.Maintenance(), http.StatusOK)
+}
+
+func (h *handler) setMaintenance(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in service.Maintenance
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m, err := h.SetMaintenance(r.Context(), in)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, m, http.StatusOK)
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+func (h *handler) uploadMedia(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxMediaBytes)
+	defer r.Body.Close()
+
+	q := r.URL.Query()
+	var in service.UploadMediaInput
+	if vv, ok := q["alt_text"]; ok {
+		in.AltText = &vv[0]
+	}
+
+	if vv, ok := q["spoiler_of"]; ok {
+		in.SpoilerOf = &vv[0]
+	}
+
+	in.Sensitive, _ = strconv.ParseBool(q.Get("sensitive"))
+	m, err := h.UploadMedia(r.Context(), r.Body, in)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrUnsupportedMediaFormat {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if err == service.ErrInfectedUpload {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, m, http.StatusCreated)
+}
+
+func (h *handler) updateMedia(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in service.UpdateMediaInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	mediaID, _ := strconv.ParseInt(way.Param(ctx, "media_id"), 10, 64)
+	m, err := h.UpdateMedia(ctx, mediaID, in)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrMediaNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, m, http.StatusOK)
+}
+
+func (h *handler) accessibilitySettings(w http.ResponseWriter, r *http.Request) {
+	out, err := h.AccessibilitySettings(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusOK)
+}
+
+func (h *handler) updateAccessibilitySettings(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in service.AccessibilitySettings
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out, err := h.UpdateAccessibilitySettings(r.Context(), in)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusOK)
+}
+
+func (h *handler) userMedia(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	last, _ := strconv.Atoi(q.Get("last"))
+	var before int64
+	if err := h.decodeCursor(r, "before", cursorMediaPosts, &before); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	pp, err := h.UserMedia(ctx, way.Param(ctx, "username"), last, before)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if n := len(pp); n != 0 {
+		h.linkNext(w, r, "before", cursorMediaPosts, pp[n-1].PostID)
+	}
+
+	respond(w, pp, http.StatusOK)
+}
@@ -0,0 +1,162 @@
+// Command gen writes the mock of handler.Service: a struct with a Func field
+// per method of the interface, and the methods calling them.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const handlerImportPath = "github.com/djomlaa/socnet/internal/handler"
+
+func main() {
+	src := flag.String("src", "../handler.go", "file declaring the Service interface")
+	out := flag.String("out", "service.go", "file to write the mock to")
+	flag.Parse()
+
+	b, err := gen(*src)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if err = os.WriteFile(*out, b, 0644); err != nil {
+		log.Fatalf("could not write mock: %v\n", err)
+	}
+}
+
+func gen(src string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, src, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", src, err)
+	}
+
+	iface := serviceInterface(f)
+	if iface == nil {
+		return nil, fmt.Errorf("no Service interface in %s", src)
+	}
+
+	imports := map[string]string{}
+	for _, spec := range f.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		name := path.Base(p)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = p
+	}
+
+	node := func(n ast.Node) string {
+		var buf bytes.Buffer
+		printer.Fprint(&buf, fset, n)
+		return buf.String()
+	}
+
+	used := map[string]bool{handlerImportPath: true}
+	var fields, methods bytes.Buffer
+	for _, m := range iface.Methods.List {
+		ft, ok := m.Type.(*ast.FuncType)
+		if !ok || len(m.Names) == 0 {
+			return nil, fmt.Errorf("embedded interfaces are not supported")
+		}
+
+		ast.Inspect(ft, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if id, ok := sel.X.(*ast.Ident); ok && imports[id.Name] != "" {
+					used[imports[id.Name]] = true
+				}
+			}
+			return true
+		})
+
+		var args []string
+		for i, p := range ft.Params.List {
+			if len(p.Names) == 0 {
+				p.Names = []*ast.Ident{ast.NewIdent(fmt.Sprintf("p%d", i))}
+			}
+			for _, n := range p.Names {
+				arg := n.Name
+				if _, ok := p.Type.(*ast.Ellipsis); ok {
+					arg += "..."
+				}
+				args = append(args, arg)
+			}
+		}
+
+		name := m.Names[0].Name
+		sig := strings.TrimPrefix(node(ft), "func")
+		call := fmt.Sprintf("m.%sFunc(%s)", name, strings.Join(args, ", "))
+		if ft.Results != nil {
+			call = "return " + call
+		}
+
+		fmt.Fprintf(&fields, "%sFunc func%s\n", name, sig)
+		fmt.Fprintf(&methods, "\n// %s calls %sFunc.\nfunc (m *Service) %s%s {\n%s\n}\n", name, name, name, sig, call)
+	}
+
+	// Standard library imports go first, as goimports groups them.
+	var std, others []string
+	for p := range used {
+		if strings.Contains(strings.Split(p, "/")[0], ".") {
+			others = append(others, p)
+		} else {
+			std = append(std, p)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(others)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by go run ./gen; DO NOT EDIT.\n\n")
+	buf.WriteString("package mock\n\nimport (\n")
+	for _, p := range std {
+		fmt.Fprintf(&buf, "%q\n", p)
+	}
+	buf.WriteString("\n")
+	for _, p := range others {
+		fmt.Fprintf(&buf, "%q\n", p)
+	}
+	buf.WriteString(")\n\n")
+	buf.WriteString("// Service implements handler.Service by calling the matching Func field.\n")
+	buf.WriteString("// Calling a method whose Func is not set panics.\n")
+	fmt.Fprintf(&buf, "type Service struct {\n%s}\n\n", fields.String())
+	buf.WriteString("var _ handler.Service = (*Service)(nil)\n")
+	buf.Write(methods.Bytes())
+
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("could not format mock: %v", err)
+	}
+
+	return b, nil
+}
+
+func serviceInterface(f *ast.File) *ast.InterfaceType {
+	for _, d := range f.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if it, ok := ts.Type.(*ast.InterfaceType); ok && ts.Name.Name == "Service" {
+				return it
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,5 @@
+// Package mock provides a Service double for handler tests.
+// It is generated from handler.Service; run go generate after changing it.
+package mock
+
+//go:generate go run ./gen -src ../handler.go -out service.go
@@ -8,9 +8,19 @@ import (
 )
 
 func (h *handler) notifications(w http.ResponseWriter, r *http.Request) {
+	if acceptsEventStream(r) {
+		h.subscribeToNotifications(w, r)
+		return
+	}
+
 	q := r.URL.Query()
 	last, _ := strconv.Atoi(q.Get("last"))
-	before, _ := strconv.ParseInt(q.Get("last"), 10, 64)
+	var before int64
+	if err := h.decodeCursor(r, "before", cursorNotifications, &before); err != nil {
+		respondError(w, err)
+		return
+	}
+
 	nn, err := h.Notifications(r.Context(), last, before)
 	if err == service.ErrUnauthenticated {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
@@ -22,6 +32,10 @@ func (h *handler) notifications(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if n := len(nn); n != 0 {
+		h.linkNext(w, r, "before", cursorNotifications, nn[n-1].ID)
+	}
+
 	respond(w, nn, http.StatusOK)
 
 }
@@ -59,3 +73,64 @@ func (h *handler) markNotificationsAsRead(w http.ResponseWriter, r *http.Request
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (h *handler) subscribeToNotifications(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := streamContext(r)
+	defer cancel()
+
+	nn, err := h.SubscribeToNotifications(ctx)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	rc, err := startEventStream(w)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	go h.TrackPresence(ctx)
+
+	for n := range nn {
+		if err = writeEvent(w, rc, n); err != nil {
+			return
+		}
+	}
+}
+
+type notificationsDeltaOutput struct {
+	service.NotificationsDelta
+	SyncToken string `json:"syncToken"`
+}
+
+func (h *handler) notificationsDelta(w http.ResponseWriter, r *http.Request) {
+	since, err := h.decodeSyncPosition(r, syncNotifications)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	delta, err := h.NotificationsDelta(r.Context(), since)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrSyncExpired {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, notificationsDeltaOutput{NotificationsDelta: delta, SyncToken: h.syncToken(syncNotifications, delta.Position)}, http.StatusOK)
+}
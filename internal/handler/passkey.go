@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+func (h *handler) beginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	out, err := h.BeginPasskeyRegistration(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusOK)
+}
+
+func (h *handler) finishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in service.PasskeyRegistrationInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out, err := h.FinishPasskeyRegistration(r.Context(), in)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err == service.ErrPasskeyChallengeNotFound || err == service.ErrInvalidPasskey {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusCreated)
+}
+
+func (h *handler) passkeys(w http.ResponseWriter, r *http.Request) {
+	pp, err := h.Passkeys(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, pp, http.StatusOK)
+}
+
+func (h *handler) deletePasskey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := h.DeletePasskey(ctx, way.Param(ctx, "passkey_id"))
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrPasskeyNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) beginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	out, err := h.BeginPasskeyLogin(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusOK)
+}
+
+func (h *handler) passkeyLogin(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in service.PasskeyLoginInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out, err := h.PasskeyLogin(r.Context(), in)
+	if err == service.ErrPasskeyChallengeNotFound || err == service.ErrInvalidPasskey {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusOK)
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+type keyAccountPolicy struct{}
+
+// accountPolicy is the state of the account of the authenticated user
+// that restricts what they can do.
+type accountPolicy struct {
+	ConsentRequired bool
+	Suspended       bool
+	Banned          bool
+}
+
+// withAccountPolicy marks the request with the state of the account of the authenticated user.
+func withAccountPolicy(ctx context.Context, as service.AuthSession) context.Context {
+	return context.WithValue(ctx, keyAccountPolicy{}, accountPolicy{
+		ConsentRequired: as.ConsentRequired,
+		Suspended:       as.Suspended,
+		Banned:          as.Banned,
+	})
+}
+
+// accountExempt reports whether the request is allowed whatever the state of the account
+// of the authenticated user: reading and giving consent, the auth user, announcements and
+// logging out. Paths are relative to /api.
+func accountExempt(r *http.Request) bool {
+	p := r.URL.Path
+	switch r.Method {
+	case http.MethodGet:
+		return p == "/auth_user" || p == "/auth_user/consent" || p == "/auth_user/sessions" || p == "/maintenance" ||
+			p == "/announcements"
+	case http.MethodPost:
+		return p == "/auth_user/consent"
+	case http.MethodDelete:
+		return strings.HasPrefix(p, "/auth_user/sessions/")
+	}
+	return false
+}
+
+// withPolicy gates the requests of the authenticated user by the state of their account,
+// so handlers don't need to check it:
+//   - banned users can only do what accountExempt allows;
+//   - suspended users can also read, but not write;
+//   - users who have not accepted the current terms version can only do what accountExempt
+//     allows until they do.
+//
+// Refused requests get 403 with ErrAccountBanned, ErrAccountSuspended or ErrConsentRequired,
+// so clients know what to show.
+func (h *handler) withPolicy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := r.Context().Value(keyAccountPolicy{}).(accountPolicy)
+		if accountExempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var err error
+		switch {
+		case p.Banned:
+			err = service.ErrAccountBanned
+		case p.Suspended && r.Method != http.MethodGet && r.Method != http.MethodHead:
+			err = service.ErrAccountSuspended
+		case p.ConsentRequired:
+			err = service.ErrConsentRequired
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
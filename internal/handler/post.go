@@ -3,15 +3,23 @@ package handler
 import (
 	"encoding/json"
 	"github.com/djomlaa/socnet/internal/service"
+	"github.com/djomlaa/socnet/internal/validation"
 	"github.com/matryer/way"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 type createPostInput struct {
 	Content   string
 	SpoilerOf *string
 	NSFW      bool
+	Community *string
+	MediaIDs  []int64
+	License   *string
+	Location  *service.PostLocation
+	// ReplyToPostID chains the post to a previous post of the author.
+	ReplyToPostID *int64
 }
 
 func (h *handler) createPost(w http.ResponseWriter, r *http.Request) {
@@ -22,12 +30,32 @@ func (h *handler) createPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ti, err := h.CreatePost(r.Context(), in.Content, in.SpoilerOf, in.NSFW)
+	ti, err := h.CreatePost(r.Context(), service.CreatePostInput{
+		Content:   in.Content,
+		SpoilerOf: in.SpoilerOf,
+		NSFW:      in.NSFW,
+		Community: in.Community,
+		MediaIDs:  in.MediaIDs,
+		License:   in.License,
+		Location:  in.Location,
+
+		ReplyToPostID: in.ReplyToPostID,
+	})
 	if err == service.ErrUnauthenticated {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrCommunityNotFound || err == service.ErrMediaNotFound || err == service.ErrPlaceNotFound ||
+		err == service.ErrPostNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
 	}
-	if err == service.ErrInvalidContent || err == service.ErrInvalidSpoiler {
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	if err == service.ErrNotCommunityMember || err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err == service.ErrRateLimited {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
 		return
 	}
 	if err != nil {
@@ -62,21 +90,24 @@ func (h *handler) posts(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	q := r.URL.Query()
 	last, _ := strconv.Atoi(q.Get("last"))
-	before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
-
-	pp, err := h.Posts(ctx, way.Param(ctx, "username"), last, before)
-
-	if err == service.ErrInvalidUsername {
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	var before int64
+	if err := h.decodeCursor(r, "before", cursorPosts, &before); err != nil {
+		respondError(w, err)
 		return
 	}
 
+	pp, err := h.Posts(ctx, way.Param(ctx, "username"), last, before)
+
 	if err != nil {
 		respondError(w, err)
 		return
 	}
 
-	respond(w, pp, http.StatusOK)
+	if n := len(pp); n != 0 {
+		h.linkNext(w, r, "before", cursorPosts, pp[n-1].ID)
+	}
+
+	respondFields(w, r, pp, http.StatusOK)
 }
 
 func (h *handler) post(w http.ResponseWriter, r *http.Request) {
@@ -85,7 +116,7 @@ func (h *handler) post(w http.ResponseWriter, r *http.Request) {
 	p, err := h.Post(ctx, postID)
 
 	if err == service.ErrPostNotFound {
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
@@ -96,3 +127,67 @@ func (h *handler) post(w http.ResponseWriter, r *http.Request) {
 
 	respond(w, p, http.StatusOK)
 }
+
+func (h *handler) thread(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+	pp, err := h.Thread(ctx, postID)
+	if err == service.ErrPostNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, pp, http.StatusOK)
+}
+
+func (h *handler) postTranslation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+	t, err := h.PostTranslation(ctx, postID, r.URL.Query().Get("lang"))
+	if err == service.ErrPostNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err == service.ErrTranslationUnavailable {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, t, http.StatusOK)
+}
+
+func (h *handler) postsByIDs(w http.ResponseWriter, r *http.Request) {
+	var ids []int64
+	for _, s := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			respondError(w, validation.Errors{{Field: "ids", Message: "invalid id " + s}})
+			return
+		}
+
+		ids = append(ids, id)
+	}
+
+	pp, err := h.PostsByIDs(r.Context(), ids)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, pp, http.StatusOK)
+}
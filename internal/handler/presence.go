@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+// presence streams the presence events of the users given in the username
+// query parameter. Keeping the stream open also keeps the caller online.
+func (h *handler) presence(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := streamContext(r)
+	defer cancel()
+
+	pp, err := h.SubscribeToPresence(ctx, r.URL.Query()["username"])
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	rc, err := startEventStream(w)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	go h.TrackPresence(ctx)
+
+	for p := range pp {
+		if err = writeEvent(w, rc, p); err != nil {
+			return
+		}
+	}
+}
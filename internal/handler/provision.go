@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+type provisionUsersInput struct {
+	Users []service.ProvisionUser `json:"users"`
+}
+
+func (h *handler) provisionUsers(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in provisionUsersInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rr, err := h.ProvisionUsers(r.Context(), in.Users)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, rr, http.StatusOK)
+}
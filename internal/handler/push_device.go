@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+type registerPushDeviceInput struct {
+	Platform string
+	Token    string
+}
+
+func (h *handler) registerPushDevice(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in registerPushDeviceInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	d, err := h.RegisterPushDevice(r.Context(), in.Platform, in.Token)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, d, http.StatusCreated)
+}
+
+func (h *handler) pushDevices(w http.ResponseWriter, r *http.Request) {
+	dd, err := h.PushDevices(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, dd, http.StatusOK)
+}
+
+func (h *handler) updatePushDevice(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in service.UpdatePushDeviceInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	deviceID, _ := strconv.ParseInt(way.Param(ctx, "device_id"), 10, 64)
+	d, err := h.UpdatePushDevice(ctx, deviceID, in)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrPushDeviceNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, d, http.StatusOK)
+}
+
+func (h *handler) deletePushDevice(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	deviceID, _ := strconv.ParseInt(way.Param(ctx, "device_id"), 10, 64)
+	err := h.DeletePushDevice(ctx, deviceID)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrPushDeviceNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+type createSavedSearchInput struct {
+	Name  string
+	Kind  string
+	Query string
+}
+
+func (h *handler) searchPosts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	last, _ := strconv.Atoi(q.Get("last"))
+	var before int64
+	if err := h.decodeCursor(r, "before", cursorPosts, &before); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	pp, err := h.SearchPosts(r.Context(), q.Get("search"), last, before)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if n := len(pp); n != 0 {
+		h.linkNext(w, r, "before", cursorPosts, pp[n-1].ID)
+	}
+
+	respondFields(w, r, pp, http.StatusOK)
+}
+
+func (h *handler) createSavedSearch(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in createSavedSearchInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ss, err := h.CreateSavedSearch(r.Context(), in.Name, in.Kind, in.Query)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrSavedSearchNameTaken {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, ss, http.StatusCreated)
+}
+
+func (h *handler) savedSearches(w http.ResponseWriter, r *http.Request) {
+	counts, _ := strconv.ParseBool(r.URL.Query().Get("counts"))
+	ss, err := h.SavedSearches(r.Context(), counts)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, ss, http.StatusOK)
+}
+
+func (h *handler) runSavedSearch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	searchID, _ := strconv.ParseInt(way.Param(ctx, "search_id"), 10, 64)
+	out, err := h.RunSavedSearch(ctx, searchID)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrSavedSearchNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusOK)
+}
+
+func (h *handler) deleteSavedSearch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	searchID, _ := strconv.ParseInt(way.Param(ctx, "search_id"), 10, 64)
+	err := h.DeleteSavedSearch(ctx, searchID)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrSavedSearchNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
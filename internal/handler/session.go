@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+func (h *handler) sessions(w http.ResponseWriter, r *http.Request) {
+	ss, err := h.Sessions(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, ss, http.StatusOK)
+}
+
+func (h *handler) revokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sessionID, _ := strconv.ParseInt(way.Param(ctx, "session_id"), 10, 64)
+	err := h.RevokeSession(ctx, sessionID)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrSessionNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// acceptsEventStream reports whether the client asked for server-sent events
+// instead of a JSON page.
+func acceptsEventStream(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Accept"))
+	return err == nil && mediaType == "text/event-stream"
+}
+
+type keyStreamsDone struct{}
+
+// WithStreamsDone returns a copy of ctx whose requests end their event streams
+// once done is closed, while other requests keep running. Use it as the server
+// base context and close done on shutdown: clients reconnect to another process
+// instead of holding the drain until it times out.
+func WithStreamsDone(ctx context.Context, done <-chan struct{}) context.Context {
+	return context.WithValue(ctx, keyStreamsDone{}, done)
+}
+
+// streamContext of the request, canceled once the streams are done.
+func streamContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+	if done, ok := ctx.Value(keyStreamsDone{}).(<-chan struct{}); ok {
+		go func() {
+			select {
+			case <-done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	return ctx, cancel
+}
+
+// startEventStream writes the event stream headers and clears the server
+// write deadline so the stream can outlive it.
+func startEventStream(w http.ResponseWriter) (*http.ResponseController, error) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		return nil, fmt.Errorf("could not clear event stream write deadline: %v", err)
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return nil, fmt.Errorf("could not flush event stream: %v", err)
+	}
+
+	return rc, nil
+}
+
+func writeEvent(w http.ResponseWriter, rc *http.ResponseController, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("could not marshal event: %v\n", err)
+		return nil
+	}
+
+	if _, err = fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+		return err
+	}
+
+	return rc.Flush()
+}
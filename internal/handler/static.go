@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// imgDir is where uploaded images are written at runtime,
+// so it is served from disk instead of the embedded files.
+var imgDir = path.Join("web", "static", "img")
+
+// spa serves the frontend files and falls back to index.html
+// for unknown paths so the history API routing works on reload.
+func spa(files fs.FS) http.Handler {
+	fileServer := http.FileServer(http.FS(files))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if name != "" {
+			fi, err := fs.Stat(files, name)
+			if err != nil || fi.IsDir() {
+				r.URL.Path = "/"
+			}
+		}
+
+		fileServer.ServeHTTP(w, r)
+	})
+}
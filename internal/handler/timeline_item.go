@@ -7,22 +7,120 @@ import (
 )
 
 func (h *handler) timeline(w http.ResponseWriter, r *http.Request) {
+	if acceptsEventStream(r) {
+		h.subscribeToTimeline(w, r)
+		return
+	}
+
 	ctx := r.Context()
 	q := r.URL.Query()
 	last, _ := strconv.Atoi(q.Get("last"))
-	before, _ := strconv.Atoi(q.Get("before"))
+	var before int
+	if err := h.decodeCursor(r, "before", cursorTimeline, &before); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	var filter service.TimelineFilter
+	filter.OnlyMedia, _ = strconv.ParseBool(q.Get("only_media"))
+	filter.From = q.Get("from")
+
+	pp, err := h.Timeline(ctx, last, before, filter)
+
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if n := len(pp); n != 0 {
+		h.linkNext(w, r, "before", cursorTimeline, pp[n-1].ID)
+	}
+
+	respondFields(w, r, pp, http.StatusOK)
+}
+
+func (h *handler) timelineUpdates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	sinceCursor, _ := strconv.ParseInt(q.Get("since_cursor"), 10, 64)
+	authors, _ := strconv.Atoi(q.Get("authors"))
+
+	out, err := h.TimelineUpdates(ctx, sinceCursor, authors)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
 
-	pp, err := h.Timeline(ctx, last, before)
+	respond(w, out, http.StatusOK)
+}
+
+type timelineDeltaOutput struct {
+	service.TimelineDelta
+	SyncToken string `json:"syncToken"`
+}
 
+func (h *handler) timelineDelta(w http.ResponseWriter, r *http.Request) {
+	since, err := h.decodeSyncPosition(r, syncTimeline)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	delta, err := h.TimelineDelta(r.Context(), since)
 	if err == service.ErrUnauthenticated {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
+	if err == service.ErrSyncExpired {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+
 	if err != nil {
 		respondError(w, err)
 		return
 	}
 
-	respond(w, pp, http.StatusOK)
+	respond(w, timelineDeltaOutput{TimelineDelta: delta, SyncToken: h.syncToken(syncTimeline, delta.Position)}, http.StatusOK)
+}
+
+func (h *handler) subscribeToTimeline(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := streamContext(r)
+	defer cancel()
+
+	tt, err := h.SubscribeToTimeline(ctx)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	rc, err := startEventStream(w)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	go h.TrackPresence(ctx)
+
+	for ti := range tt {
+		if err = writeEvent(w, rc, ti); err != nil {
+			return
+		}
+	}
 }
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+type updateTimelineMarkerInput struct {
+	TimelineItemID int64
+}
+
+func (h *handler) timelineMarker(w http.ResponseWriter, r *http.Request) {
+	m, err := h.TimelineMarker(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, m, http.StatusOK)
+}
+
+func (h *handler) updateTimelineMarker(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in updateTimelineMarkerInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m, err := h.UpdateTimelineMarker(r.Context(), in.TimelineItemID)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrTimelineItemNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, m, http.StatusOK)
+}
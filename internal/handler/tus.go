@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/matryer/way"
+)
+
+// tusVersion of the tus resumable upload protocol spoken,
+// with the creation and termination extensions.
+const tusVersion = "1.0.0"
+
+// withTus sets the protocol headers and rejects requests
+// of clients speaking another version of it.
+func withTus(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Method != http.MethodOptions && r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (h *handler) tusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", "creation,termination")
+	w.Header().Set("Tus-Max-Size", strconv.Itoa(service.MaxDirectUploadBytes))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusMetadata decodes the Upload-Metadata header,
+// comma separated keys each followed by a base64 value.
+func tusMetadata(header string) map[string]string {
+	out := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 {
+			continue
+		}
+
+		var value string
+		if len(parts) > 1 {
+			b, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				continue
+			}
+
+			value = string(b)
+		}
+
+		out[parts[0]] = value
+	}
+
+	return out
+}
+
+func (h *handler) createTusUpload(w http.ResponseWriter, r *http.Request) {
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+
+	up, err := h.CreateTusUpload(r.Context(), size, tusMetadata(r.Header.Get("Upload-Metadata"))["filetype"])
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/tus/"+up.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *handler) tusUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	up, err := h.TusUpload(ctx, way.Param(ctx, "upload_id"))
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrUploadNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(up.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(up.Size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *handler) appendTusUpload(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	offset, err = h.AppendTusUpload(ctx, way.Param(ctx, "upload_id"), offset, r.Body)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrUploadNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err == service.ErrUploadOffsetMismatch {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err == service.ErrUploadLocked {
+		http.Error(w, err.Error(), http.StatusLocked)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) deleteTusUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := h.DeleteTusUpload(ctx, way.Param(ctx, "upload_id"))
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrUploadNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -11,7 +11,7 @@ import (
 )
 
 type createUserInput struct {
-	Email, Username string
+	Email, Username, Birthdate string
 }
 
 func (h *handler) createUser(w http.ResponseWriter, r *http.Request) {
@@ -24,12 +24,7 @@ func (h *handler) createUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.CreateUser(r.Context(), in.Email, in.Username)
-
-	if err == service.ErrInvalidEmail || err == service.ErrInvalidUsername {
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
-		return
-	}
+	err := h.CreateUser(r.Context(), in.Email, in.Username, in.Birthdate)
 
 	if err == service.ErrEmailTaken {
 		http.Error(w, err.Error(), http.StatusConflict)
@@ -41,6 +36,11 @@ func (h *handler) createUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err == service.ErrSSORequired {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	if err != nil {
 		respondError(w, err)
 		return
@@ -55,11 +55,6 @@ func (h *handler) user(w http.ResponseWriter, r *http.Request) {
 
 	u, err := h.User(ctx, username)
 
-	if err == service.ErrInvalidUsername {
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
-		return
-	}
-
 	if err == service.ErrUserNotFound {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -70,6 +65,10 @@ func (h *handler) user(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if checkNotModified(w, r, u.LastModified) {
+		return
+	}
+
 	respond(w, u, http.StatusOK)
 
 }
@@ -78,7 +77,12 @@ func (h *handler) users(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	search := q.Get("search")
 	first, _ := strconv.Atoi(q.Get("first"))
-	after := q.Get("after")
+	var after string
+	if err := h.decodeCursor(r, "after", cursorUsers, &after); err != nil {
+		respondError(w, err)
+		return
+	}
+
 	uu, err := h.Users(r.Context(), search, first, after)
 
 	if err != nil {
@@ -86,7 +90,11 @@ func (h *handler) users(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respond(w, uu, http.StatusOK)
+	if n := len(uu); n != 0 {
+		h.linkNext(w, r, "after", cursorUsers, uu[n-1].Username)
+	}
+
+	respondFields(w, r, uu, http.StatusOK)
 
 }
 
@@ -104,6 +112,11 @@ func (h *handler) updateAvatar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err == service.ErrInfectedUpload {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
 	if err != nil {
 		respondError(w, err)
 		return
@@ -125,11 +138,6 @@ func (h *handler) toggleFollow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err == service.ErrInvalidUsername {
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
-		return
-	}
-
 	if err == service.ErrUserNotFound {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -140,6 +148,11 @@ func (h *handler) toggleFollow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err == service.ErrRateLimited {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
 	if err != nil {
 		respondError(w, err)
 		return
@@ -149,6 +162,12 @@ func (h *handler) toggleFollow(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// hiddenOutput tells clients the follow lists or likes exist but are private,
+// so they can show that instead of an error.
+type hiddenOutput struct {
+	Hidden bool `json:"hidden"`
+}
+
 func (h *handler) followers(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -156,11 +175,20 @@ func (h *handler) followers(w http.ResponseWriter, r *http.Request) {
 
 	q := r.URL.Query()
 	first, _ := strconv.Atoi(q.Get("first"))
-	after := q.Get("after")
+	var after string
+	if err := h.decodeCursor(r, "after", cursorUsers, &after); err != nil {
+		respondError(w, err)
+		return
+	}
+
 	uu, err := h.Followers(ctx, username, first, after)
+	if err == service.ErrFollowListsHidden {
+		respond(w, hiddenOutput{Hidden: true}, http.StatusForbidden)
+		return
+	}
 
-	if err == service.ErrInvalidUsername {
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
@@ -169,6 +197,10 @@ func (h *handler) followers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if n := len(uu); n != 0 {
+		h.linkNext(w, r, "after", cursorUsers, uu[n-1].Username)
+	}
+
 	respond(w, uu, http.StatusOK)
 
 }
@@ -180,11 +212,20 @@ func (h *handler) followees(w http.ResponseWriter, r *http.Request) {
 
 	q := r.URL.Query()
 	first, _ := strconv.Atoi(q.Get("first"))
-	after := q.Get("after")
+	var after string
+	if err := h.decodeCursor(r, "after", cursorUsers, &after); err != nil {
+		respondError(w, err)
+		return
+	}
+
 	uu, err := h.Followees(ctx, username, first, after)
+	if err == service.ErrFollowListsHidden {
+		respond(w, hiddenOutput{Hidden: true}, http.StatusForbidden)
+		return
+	}
 
-	if err == service.ErrInvalidUsername {
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
@@ -193,6 +234,38 @@ func (h *handler) followees(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if n := len(uu); n != 0 {
+		h.linkNext(w, r, "after", cursorUsers, uu[n-1].Username)
+	}
+
 	respond(w, uu, http.StatusOK)
 
 }
+
+func (h *handler) togglePostNotifications(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	username := way.Param(ctx, "username")
+
+	out, err := h.TogglePostNotifications(ctx, username)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err == service.ErrNotFollowing {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusOK)
+}
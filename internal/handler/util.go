@@ -1,10 +1,13 @@
 package handler
 
 import (
-	"log"
-	"fmt"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/djomlaa/socnet/internal/validation"
 )
 
 func respond(w http.ResponseWriter, v interface{}, statusCode int) {
@@ -19,7 +22,29 @@ func respond(w http.ResponseWriter, v interface{}, statusCode int) {
 	w.Write(b)
 }
 
+type validationErrorsOutput struct {
+	Errors validation.Errors `json:"errors"`
+}
+
+// respondError maps authentication and authorization errors to 401 and 403,
+// and validation errors to 422 listing each invalid field;
+// any other error is logged and hidden behind a 500.
 func respondError(w http.ResponseWriter, err error) {
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err == service.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if errs, ok := err.(validation.Errors); ok {
+		respond(w, validationErrorsOutput{errs}, http.StatusUnprocessableEntity)
+		return
+	}
+
 	log.Println(err)
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
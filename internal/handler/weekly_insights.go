@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/djomlaa/socnet/internal/service"
+)
+
+type weeklyInsightsEmailInput struct {
+	Enabled bool `json:"enabled"`
+}
+
+func (h *handler) weeklyInsightsEmail(w http.ResponseWriter, r *http.Request) {
+	enabled, err := h.WeeklyInsightsEmail(r.Context())
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, weeklyInsightsEmailInput{Enabled: enabled}, http.StatusOK)
+}
+
+func (h *handler) setWeeklyInsightsEmail(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var in weeklyInsightsEmailInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := h.SetWeeklyInsightsEmail(r.Context(), in.Enabled)
+	if err == service.ErrUnauthenticated {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,15 @@
+package mailer
+
+import (
+	"context"
+	"log"
+)
+
+// Log sender writes the messages to the log instead of sending them. Meant for development.
+type Log struct{}
+
+// Send logs the message.
+func (*Log) Send(ctx context.Context, m Message) error {
+	log.Printf("mail to %s: %s\n%s\n", m.To, m.Subject, m.Text)
+	return nil
+}
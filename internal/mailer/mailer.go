@@ -0,0 +1,141 @@
+// Package mailer sends emails through pluggable providers.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// Supported providers.
+const (
+	ProviderLog     = "log"
+	ProviderSMTP    = "smtp"
+	ProviderSES     = "ses"
+	ProviderMailgun = "mailgun"
+)
+
+// ErrUnknownProvider used when the configured provider is not supported.
+var ErrUnknownProvider = errors.New("unknown mailer provider")
+
+// Message is an email with a plain text body and an optional HTML alternative.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Sender sends emails.
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Config of the provider. Only the fields of the chosen provider are used.
+type Config struct {
+	Provider string
+	// From is the sender address of every message.
+	From string
+
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+
+	SESRegion          string
+	SESAccessKeyID     string
+	SESSecretAccessKey string
+
+	MailgunDomain string
+	MailgunAPIKey string
+	// MailgunBaseURL defaults to the US region API.
+	MailgunBaseURL string
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// New sender for the configured provider.
+// An empty provider logs the messages instead of sending them.
+func New(cfg Config) (Sender, error) {
+	switch cfg.Provider {
+	case "", ProviderLog:
+		return &Log{}, nil
+	case ProviderSMTP:
+		return &SMTP{From: cfg.From, Addr: cfg.SMTPAddr, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword}, nil
+	case ProviderSES:
+		return &SES{From: cfg.From, Region: cfg.SESRegion, AccessKeyID: cfg.SESAccessKeyID, SecretAccessKey: cfg.SESSecretAccessKey}, nil
+	case ProviderMailgun:
+		return &Mailgun{From: cfg.From, Domain: cfg.MailgunDomain, APIKey: cfg.MailgunAPIKey, BaseURL: cfg.MailgunBaseURL}, nil
+	}
+
+	return nil, ErrUnknownProvider
+}
+
+// Template renders messages. Subject and Text are text templates
+// and HTML, when set, is an HTML template.
+type Template struct {
+	subject *template.Template
+	text    *template.Template
+	html    *htmltemplate.Template
+}
+
+// NewTemplate parses the subject, text and html templates.
+func NewTemplate(name, subject, text, html string) (*Template, error) {
+	var t Template
+	var err error
+	if t.subject, err = template.New(name + ".subject").Parse(subject); err != nil {
+		return nil, fmt.Errorf("could not parse %s subject template: %v", name, err)
+	}
+
+	if t.text, err = template.New(name + ".text").Parse(text); err != nil {
+		return nil, fmt.Errorf("could not parse %s text template: %v", name, err)
+	}
+
+	if html != "" {
+		if t.html, err = htmltemplate.New(name + ".html").Parse(html); err != nil {
+			return nil, fmt.Errorf("could not parse %s html template: %v", name, err)
+		}
+	}
+
+	return &t, nil
+}
+
+// Render a message to the given address.
+func (t *Template) Render(to string, data interface{}) (Message, error) {
+	m := Message{To: to}
+	var buf bytes.Buffer
+	if err := t.subject.Execute(&buf, data); err != nil {
+		return m, fmt.Errorf("could not render subject: %v", err)
+	}
+
+	m.Subject = buf.String()
+	buf.Reset()
+	if err := t.text.Execute(&buf, data); err != nil {
+		return m, fmt.Errorf("could not render text: %v", err)
+	}
+
+	m.Text = buf.String()
+	if t.html == nil {
+		return m, nil
+	}
+
+	buf.Reset()
+	if err := t.html.Execute(&buf, data); err != nil {
+		return m, fmt.Errorf("could not render html: %v", err)
+	}
+
+	m.HTML = buf.String()
+	return m, nil
+}
+
+func checkResponse(res *http.Response) error {
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("mail provider responded with %s", res.Status)
+	}
+
+	return nil
+}
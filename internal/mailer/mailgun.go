@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const mailgunBaseURL = "https://api.mailgun.net"
+
+// Mailgun sender.
+type Mailgun struct {
+	From    string
+	Domain  string
+	APIKey  string
+	BaseURL string
+}
+
+// Send the message through the Mailgun messages API.
+func (s *Mailgun) Send(ctx context.Context, m Message) error {
+	baseURL := s.BaseURL
+	if baseURL == "" {
+		baseURL = mailgunBaseURL
+	}
+
+	form := url.Values{}
+	form.Set("from", s.From)
+	form.Set("to", m.To)
+	form.Set("subject", m.Subject)
+	form.Set("text", m.Text)
+	if m.HTML != "" {
+		form.Set("html", m.HTML)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/v3/"+s.Domain+"/messages", strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("could not create mailgun request: %v", err)
+	}
+
+	req.SetBasicAuth("api", s.APIKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not do mailgun request: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	return checkResponse(res)
+}
@@ -0,0 +1,95 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull used when there is no room left in the send queue.
+var ErrQueueFull = errors.New("mail queue is full")
+
+// ErrQueueClosed used when sending through a closed queue.
+var ErrQueueClosed = errors.New("mail queue is closed")
+
+// sendAttempts before a message is given up.
+const sendAttempts = 3
+
+// Queue is a Sender that returns right away and sends the messages
+// in the background, retrying failed ones with backoff.
+type Queue struct {
+	sender   Sender
+	messages chan Message
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewQueue starts workers sending the queued messages through sender.
+func NewQueue(sender Sender, size, workers int) *Queue {
+	q := &Queue{
+		sender:   sender,
+		messages: make(chan Message, size),
+	}
+
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+
+	return q
+}
+
+// Send queues the message.
+func (q *Queue) Send(ctx context.Context, m Message) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.messages <- m:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting messages and waits for the queued ones to be sent.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.messages)
+	}
+	q.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	for m := range q.messages {
+		backoff := time.Second
+		for attempt := 1; ; attempt++ {
+			err := q.sender.Send(context.Background(), m)
+			if err == nil {
+				break
+			}
+
+			if attempt == sendAttempts {
+				log.Printf("could not send mail %q after %d attempts: %v\n", m.Subject, attempt, err)
+				break
+			}
+
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SES sender, through the Amazon SES v2 API.
+type SES struct {
+	From            string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+type sesContent struct {
+	Data    string `json:"Data"`
+	Charset string `json:"Charset"`
+}
+
+// Send the message through SES.
+func (s *SES) Send(ctx context.Context, m Message) error {
+	var in struct {
+		FromEmailAddress string `json:"FromEmailAddress"`
+		Destination      struct {
+			ToAddresses []string `json:"ToAddresses"`
+		} `json:"Destination"`
+		Content struct {
+			Simple struct {
+				Subject sesContent `json:"Subject"`
+				Body    struct {
+					Text *sesContent `json:"Text,omitempty"`
+					HTML *sesContent `json:"Html,omitempty"`
+				} `json:"Body"`
+			} `json:"Simple"`
+		} `json:"Content"`
+	}
+	in.FromEmailAddress = s.From
+	in.Destination.ToAddresses = []string{m.To}
+	in.Content.Simple.Subject = sesContent{m.Subject, "UTF-8"}
+	in.Content.Simple.Body.Text = &sesContent{m.Text, "UTF-8"}
+	if m.HTML != "" {
+		in.Content.Simple.Body.HTML = &sesContent{m.HTML, "UTF-8"}
+	}
+
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("could not marshal ses request: %v", err)
+	}
+
+	host := "email." + s.Region + ".amazonaws.com"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/v2/email/outbound-emails", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not create ses request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	s.sign(req, host, body, time.Now().UTC())
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not do ses request: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	return checkResponse(res)
+}
+
+// sign the request with AWS signature version 4.
+func (s *SES) sign(req *http.Request, host string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := date + "/" + s.Region + "/ses/aws4_request"
+	signedHeaders := "content-type;host;x-amz-date"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"content-type:" + req.Header.Get("Content-Type"),
+		"host:" + host,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "ses")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
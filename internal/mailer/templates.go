@@ -0,0 +1,136 @@
+package mailer
+
+import (
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// Names of the embedded templates. Data passed to them needs an Origin field
+// along with the fields each one uses.
+const (
+	// TemplateWelcome uses Username.
+	TemplateWelcome = "welcome"
+	// TemplateVerification uses Username and Link.
+	TemplateVerification = "verification"
+	// TemplateDigest uses Username and Notifications, each with Actors and Type.
+	TemplateDigest = "digest"
+	// TemplateWeeklyInsights uses Username, NewFollowers, TotalLikes
+	// and TopPost, with ID, Excerpt and Likes, when set.
+	TemplateWeeklyInsights = "weekly_insights"
+)
+
+// DefaultLocale is used for locales the templates are not translated to.
+const DefaultLocale = "en"
+
+//go:embed templates
+var templatesFS embed.FS
+
+var templateFuncs = map[string]interface{}{
+	"join": strings.Join,
+}
+
+// templates by locale and name.
+var templates = mustParseTemplates()
+
+// mustParseTemplates parses templates/<locale>/<name>.tmpl. Each one defines
+// a "subject", a "text" body and the "content" of the HTML body, which is
+// wrapped by templates/layout.html with its styles inlined, as email clients
+// ignore stylesheets. templates/<locale>/layout.tmpl defines the layout texts.
+func mustParseTemplates() map[string]map[string]*Template {
+	layout, err := templatesFS.ReadFile("templates/layout.html")
+	if err != nil {
+		panic(err)
+	}
+
+	out := map[string]map[string]*Template{}
+	locales, err := fs.ReadDir(templatesFS, "templates")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, locale := range locales {
+		if !locale.IsDir() {
+			continue
+		}
+
+		dir := path.Join("templates", locale.Name())
+		localeLayout, err := templatesFS.ReadFile(path.Join(dir, "layout.tmpl"))
+		if err != nil {
+			panic(err)
+		}
+
+		files, err := fs.ReadDir(templatesFS, dir)
+		if err != nil {
+			panic(err)
+		}
+
+		out[locale.Name()] = map[string]*Template{}
+		for _, f := range files {
+			if f.Name() == "layout.tmpl" {
+				continue
+			}
+
+			b, err := templatesFS.ReadFile(path.Join(dir, f.Name()))
+			if err != nil {
+				panic(err)
+			}
+
+			name := strings.TrimSuffix(f.Name(), ".tmpl")
+			t, err := parseTemplate(name, string(layout), string(localeLayout), string(b))
+			if err != nil {
+				panic(fmt.Sprintf("%s/%s: %v", locale.Name(), name, err))
+			}
+
+			out[locale.Name()][name] = t
+		}
+	}
+
+	return out
+}
+
+func parseTemplate(name, layout, localeLayout, text string) (*Template, error) {
+	textSet, err := template.New(name).Funcs(templateFuncs).Parse(localeLayout + text)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlSet, err := htmltemplate.New(name).Funcs(templateFuncs).Parse(layout + localeLayout + text)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Template{
+		subject: textSet.Lookup("subject"),
+		text:    textSet.Lookup("text"),
+		html:    htmlSet.Lookup("layout"),
+	}
+	if t.subject == nil || t.text == nil || htmlSet.Lookup("content") == nil {
+		return nil, fmt.Errorf("missing subject, text or content template")
+	}
+
+	return t, nil
+}
+
+// Render the embedded template in the given locale, falling back to its
+// base language and then to DefaultLocale.
+func Render(name, locale, to string, data interface{}) (Message, error) {
+	locale = strings.ToLower(locale)
+	candidates := []string{locale}
+	if i := strings.IndexAny(locale, "-_"); i != -1 {
+		candidates = append(candidates, locale[:i])
+	}
+	candidates = append(candidates, DefaultLocale)
+
+	for _, l := range candidates {
+		if t, ok := templates[l][name]; ok {
+			return t.Render(to, data)
+		}
+	}
+
+	return Message{}, fmt.Errorf("unknown mail template %q", name)
+}
@@ -0,0 +1,148 @@
+package mailer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Delivery events reported by the providers.
+const (
+	// EventBounce is a permanent delivery failure.
+	EventBounce = "bounce"
+	// EventComplaint is the recipient marking a message as spam.
+	EventComplaint = "complaint"
+)
+
+// ErrInvalidWebhook used when a webhook is malformed or its signature doesn't match.
+var ErrInvalidWebhook = errors.New("invalid mail webhook")
+
+// Event is a delivery problem with an address.
+type Event struct {
+	Type  string
+	Email string
+}
+
+// ParseMailgunWebhook verifies the signature of a Mailgun webhook with the
+// webhook signing key and returns its event, if it's a permanent failure or a complaint.
+func ParseMailgunWebhook(body []byte, signingKey string) ([]Event, error) {
+	var in struct {
+		Signature struct {
+			Timestamp string `json:"timestamp"`
+			Token     string `json:"token"`
+			Signature string `json:"signature"`
+		} `json:"signature"`
+		EventData struct {
+			Event     string `json:"event"`
+			Severity  string `json:"severity"`
+			Recipient string `json:"recipient"`
+		} `json:"event-data"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, ErrInvalidWebhook
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(in.Signature.Timestamp + in.Signature.Token))
+	want := hex.EncodeToString(mac.Sum(nil))
+	if signingKey == "" || !hmac.Equal([]byte(want), []byte(in.Signature.Signature)) {
+		return nil, ErrInvalidWebhook
+	}
+
+	switch {
+	case in.EventData.Event == "failed" && in.EventData.Severity == "permanent":
+		return []Event{{Type: EventBounce, Email: in.EventData.Recipient}}, nil
+	case in.EventData.Event == "complained":
+		return []Event{{Type: EventComplaint, Email: in.EventData.Recipient}}, nil
+	}
+
+	return nil, nil
+}
+
+// ParseSESNotification parses an SES notification delivered by Amazon SNS and
+// returns the addresses that bounced permanently or complained.
+// Subscription confirmations are confirmed.
+// SNS doesn't sign with a shared secret, so the caller must authenticate the
+// request by other means, like a secret in the subscribed URL.
+func ParseSESNotification(ctx context.Context, body []byte) ([]Event, error) {
+	var in struct {
+		Type         string `json:"Type"`
+		Message      string `json:"Message"`
+		SubscribeURL string `json:"SubscribeURL"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, ErrInvalidWebhook
+	}
+
+	switch in.Type {
+	case "SubscriptionConfirmation":
+		return nil, confirmSNSSubscription(ctx, in.SubscribeURL)
+	case "Notification":
+	default:
+		return nil, nil
+	}
+
+	var msg struct {
+		NotificationType string `json:"notificationType"`
+		Bounce           struct {
+			BounceType        string `json:"bounceType"`
+			BouncedRecipients []struct {
+				EmailAddress string `json:"emailAddress"`
+			} `json:"bouncedRecipients"`
+		} `json:"bounce"`
+		Complaint struct {
+			ComplainedRecipients []struct {
+				EmailAddress string `json:"emailAddress"`
+			} `json:"complainedRecipients"`
+		} `json:"complaint"`
+	}
+	if err := json.Unmarshal([]byte(in.Message), &msg); err != nil {
+		return nil, ErrInvalidWebhook
+	}
+
+	var ee []Event
+	switch msg.NotificationType {
+	case "Bounce":
+		if msg.Bounce.BounceType != "Permanent" {
+			return nil, nil
+		}
+
+		for _, r := range msg.Bounce.BouncedRecipients {
+			ee = append(ee, Event{Type: EventBounce, Email: r.EmailAddress})
+		}
+	case "Complaint":
+		for _, r := range msg.Complaint.ComplainedRecipients {
+			ee = append(ee, Event{Type: EventComplaint, Email: r.EmailAddress})
+		}
+	}
+
+	return ee, nil
+}
+
+func confirmSNSSubscription(ctx context.Context, subscribeURL string) error {
+	u, err := url.Parse(subscribeURL)
+	if err != nil || u.Scheme != "https" || !strings.HasSuffix(u.Hostname(), ".amazonaws.com") {
+		return ErrInvalidWebhook
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("could not create sns subscription confirmation request: %v", err)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not confirm sns subscription: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	return checkResponse(res)
+}
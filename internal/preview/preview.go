@@ -0,0 +1,230 @@
+// Package preview fetches the title, description and image
+// of web pages linked in posts.
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxPageBytes read of a page looking for its metadata, which lives in the head.
+const maxPageBytes = 512 << 10
+
+// maxRedirects followed when resolving a link.
+const maxRedirects = 10
+
+// ErrNotHTML used when the link does not point to a web page.
+var ErrNotHTML = errors.New("not an html page")
+
+// errPrivateAddress used when a link resolves to an address of the private network.
+var errPrivateAddress = errors.New("private address")
+
+// Preview of a web page.
+type Preview struct {
+	// URL of the page after following redirects.
+	URL         string
+	Title       string
+	Description string
+	ImageURL    string
+	SiteName    string
+}
+
+// httpClient refuses to connect to the private network,
+// so links in posts can't be used to probe it.
+var httpClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, c syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+
+				ip := net.ParseIP(host)
+				if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+					ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+					return errPrivateAddress
+				}
+
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return errors.New("too many redirects")
+		}
+
+		return nil
+	},
+}
+
+// trackingParams are dropped from links, along with any utm_ parameter.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"igshid":  true,
+	"yclid":   true,
+	"_ga":     true,
+	"ref_src": true,
+}
+
+// Canonicalize the link so links to the same page compare equal: the scheme and
+// host are lowercased, default ports, fragments and tracking parameters dropped,
+// and the remaining parameters sorted.
+func Canonicalize(link string) (string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("could not parse link: %v", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported link scheme %q", u.Scheme)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = u.Hostname()
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.User = nil
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	q := u.Query()
+	for key := range q {
+		if trackingParams[strings.ToLower(key)] || strings.HasPrefix(strings.ToLower(key), "utm_") {
+			q.Del(key)
+		}
+	}
+
+	// Encode sorts by key.
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Fetch the preview of the page the link points to, following redirects.
+// The URL of the preview is the canonical final URL.
+func Fetch(ctx context.Context, link string) (Preview, error) {
+	var out Preview
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return out, fmt.Errorf("could not create preview request: %v", err)
+	}
+
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "socnet-preview/1.0")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return out, fmt.Errorf("could not do preview request: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return out, fmt.Errorf("page responded with %s", res.Status)
+	}
+
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		return out, ErrNotHTML
+	}
+
+	if out.URL, err = Canonicalize(res.Request.URL.String()); err != nil {
+		return out, err
+	}
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxPageBytes))
+	if err != nil {
+		return out, fmt.Errorf("could not read page: %v", err)
+	}
+
+	meta := pageMeta(string(b))
+	out.Title = first(meta["og:title"], meta["twitter:title"], meta["title"])
+	out.Description = first(meta["og:description"], meta["twitter:description"], meta["description"])
+	out.SiteName = meta["og:site_name"]
+	if image := first(meta["og:image"], meta["twitter:image"]); image != "" {
+		// Images can be relative to the page.
+		if u, err := res.Request.URL.Parse(image); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			out.ImageURL = u.String()
+		}
+	}
+
+	return out, nil
+}
+
+var (
+	reMeta   = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	reAttr   = regexp.MustCompile(`(?is)([a-z:_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	reTitle  = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	reSpaces = regexp.MustCompile(`\s+`)
+)
+
+// maxTextRunes kept of a title or description.
+const maxTextRunes = 500
+
+// pageMeta maps the property or name of the meta tags of the page to their
+// content. The page title is under "title". The first tag of each wins.
+func pageMeta(page string) map[string]string {
+	out := map[string]string{}
+	if m := reTitle.FindStringSubmatch(page); m != nil {
+		out["title"] = cleanText(m[1])
+	}
+
+	for _, tag := range reMeta.FindAllString(page, -1) {
+		attrs := map[string]string{}
+		for _, m := range reAttr.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = m[2] + m[3]
+		}
+
+		key := strings.ToLower(first(attrs["property"], attrs["name"]))
+		if key == "" {
+			continue
+		}
+
+		if _, ok := out[key]; !ok {
+			out[key] = cleanText(attrs["content"])
+		}
+	}
+
+	return out
+}
+
+func cleanText(s string) string {
+	s = strings.TrimSpace(reSpaces.ReplaceAllString(html.UnescapeString(s), " "))
+	if r := []rune(s); len(r) > maxTextRunes {
+		s = string(r[:maxTextRunes])
+	}
+
+	return s
+}
+
+func first(ss ...string) string {
+	for _, s := range ss {
+		if s != "" {
+			return s
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,103 @@
+package pubsub
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// maxNotifyPayload is the size limit of a NOTIFY payload in the default Postgres build.
+const maxNotifyPayload = 8000
+
+// ErrMessageTooLarge used when a message doesn't fit a NOTIFY payload.
+var ErrMessageTooLarge = errors.New("pubsub message too large")
+
+type message struct {
+	Topic string          `json:"topic"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Postgres is a PubSub backed by LISTEN/NOTIFY, so messages reach the subscribers
+// connected to any instance using the same database.
+// All topics share one channel and each instance delivers to its own subscribers.
+type Postgres struct {
+	hub
+	db       *sql.DB
+	listener *pq.Listener
+	channel  string
+}
+
+// NewPostgres listens on channel with a dedicated connection to databaseURL
+// and publishes through db.
+func NewPostgres(db *sql.DB, databaseURL, channel string) (*Postgres, error) {
+	listener := pq.NewListener(databaseURL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("pubsub: postgres listener: %v\n", err)
+		}
+	})
+
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("could not listen to %s: %v", channel, err)
+	}
+
+	p := &Postgres{
+		db:       db,
+		listener: listener,
+		channel:  channel,
+	}
+	go p.listen()
+
+	return p, nil
+}
+
+func (p *Postgres) listen() {
+	for n := range p.listener.Notify {
+		// nil after a reconnection; messages sent meanwhile are lost.
+		if n == nil {
+			continue
+		}
+
+		var m message
+		if err := json.Unmarshal([]byte(n.Extra), &m); err != nil {
+			log.Printf("pubsub: could not unmarshal postgres notification: %v\n", err)
+			continue
+		}
+
+		p.deliver(m.Topic, m.Data)
+	}
+}
+
+// Publish implements PubSub.
+func (p *Postgres) Publish(ctx context.Context, topic string, data []byte) error {
+	b, err := json.Marshal(message{Topic: topic, Data: data})
+	if err != nil {
+		return fmt.Errorf("could not marshal pubsub message: %v", err)
+	}
+
+	if len(b) > maxNotifyPayload {
+		return ErrMessageTooLarge
+	}
+
+	if _, err = p.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", p.channel, string(b)); err != nil {
+		return fmt.Errorf("could not notify pubsub message: %v", err)
+	}
+
+	return nil
+}
+
+// Subscribe implements PubSub.
+func (p *Postgres) Subscribe(ctx context.Context, topic string) <-chan []byte {
+	return p.subscribe(ctx, topic)
+}
+
+// Close stops listening.
+func (p *Postgres) Close() error {
+	return p.listener.Close()
+}
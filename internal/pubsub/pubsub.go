@@ -0,0 +1,92 @@
+// Package pubsub delivers the messages published on a topic to its subscribers,
+// either within a single process or across every instance sharing a backplane.
+package pubsub
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// subscriptionBuffer is how many messages a slow subscriber can fall behind
+// before it starts missing them.
+const subscriptionBuffer = 16
+
+// PubSub publishes messages on topics and subscribes to them.
+type PubSub interface {
+	// Publish sends data to the subscribers of topic. data must be JSON.
+	Publish(ctx context.Context, topic string, data []byte) error
+	// Subscribe receives the messages published on topic until ctx is done,
+	// then the channel is closed.
+	Subscribe(ctx context.Context, topic string) <-chan []byte
+}
+
+// hub keeps the subscribers connected to this process.
+type hub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan []byte]struct{}
+}
+
+func (h *hub) subscribe(ctx context.Context, topic string) <-chan []byte {
+	ch := make(chan []byte, subscriptionBuffer)
+
+	h.mu.Lock()
+	if h.subs == nil {
+		h.subs = map[string]map[chan []byte]struct{}{}
+	}
+	if h.subs[topic] == nil {
+		h.subs[topic] = map[chan []byte]struct{}{}
+	}
+	h.subs[topic][ch] = struct{}{}
+	h.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		h.mu.Lock()
+		delete(h.subs[topic], ch)
+		if len(h.subs[topic]) == 0 {
+			delete(h.subs, topic)
+		}
+		h.mu.Unlock()
+
+		close(ch)
+	}()
+
+	return ch
+}
+
+// deliver never blocks: a subscriber with a full buffer misses the message.
+func (h *hub) deliver(topic string, data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs[topic] {
+		select {
+		case ch <- data:
+		default:
+			log.Printf("pubsub: dropping message on %s for a slow subscriber\n", topic)
+		}
+	}
+}
+
+// Local is a PubSub for a single process.
+type Local struct {
+	hub
+}
+
+// NewLocal creates a PubSub that only reaches subscribers of this process.
+func NewLocal() *Local {
+	return &Local{}
+}
+
+// Publish implements PubSub.
+func (l *Local) Publish(ctx context.Context, topic string, data []byte) error {
+	l.deliver(topic, data)
+	return nil
+}
+
+// Subscribe implements PubSub.
+func (l *Local) Subscribe(ctx context.Context, topic string) <-chan []byte {
+	return l.subscribe(ctx, topic)
+}
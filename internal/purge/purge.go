@@ -0,0 +1,139 @@
+// Package purge drops stale public URLs from the CDN in front of the app.
+package purge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Supported providers.
+const (
+	ProviderCloudflare = "cloudflare"
+	ProviderFastly     = "fastly"
+)
+
+// ErrUnknownProvider used when the configured provider is not supported.
+var ErrUnknownProvider = errors.New("unknown purge provider")
+
+// Purger purges URLs from the CDN cache so the next request reaches the origin.
+type Purger interface {
+	Purge(ctx context.Context, urls []string) error
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// New purger for the given provider. zone is the Cloudflare zone id and
+// is not used by Fastly. An empty provider returns a nil Purger,
+// for deployments without a CDN, where there is nothing to purge.
+func New(provider, zone, apiToken string) (Purger, error) {
+	switch provider {
+	case "":
+		return nil, nil
+	case ProviderCloudflare:
+		return &Cloudflare{ZoneID: zone, APIToken: apiToken}, nil
+	case ProviderFastly:
+		return &Fastly{APIToken: apiToken}, nil
+	}
+
+	return nil, ErrUnknownProvider
+}
+
+// cloudflareMaxFiles purged per request.
+const cloudflareMaxFiles = 30
+
+// Cloudflare purges by URL through the Cloudflare API.
+type Cloudflare struct {
+	ZoneID   string
+	APIToken string
+	// BaseURL defaults to https://api.cloudflare.com.
+	BaseURL string
+}
+
+// Purge the URLs, in batches as many as Cloudflare takes at once.
+func (c *Cloudflare) Purge(ctx context.Context, urls []string) error {
+	base := c.BaseURL
+	if base == "" {
+		base = "https://api.cloudflare.com"
+	}
+
+	endpoint := base + "/client/v4/zones/" + url.PathEscape(c.ZoneID) + "/purge_cache"
+	for len(urls) != 0 {
+		batch := urls
+		if len(batch) > cloudflareMaxFiles {
+			batch = batch[:cloudflareMaxFiles]
+		}
+		urls = urls[len(batch):]
+
+		b, err := json.Marshal(map[string][]string{"files": batch})
+		if err != nil {
+			return fmt.Errorf("could not marshal cloudflare purge request: %v", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
+		if err != nil {
+			return fmt.Errorf("could not create cloudflare purge request: %v", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+c.APIToken)
+		req.Header.Set("Content-Type", "application/json")
+		if err = do(req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Fastly purges by URL through the Fastly API, one URL per request.
+type Fastly struct {
+	APIToken string
+	// BaseURL defaults to https://api.fastly.com.
+	BaseURL string
+}
+
+// Purge the URLs.
+func (f *Fastly) Purge(ctx context.Context, urls []string) error {
+	base := f.BaseURL
+	if base == "" {
+		base = "https://api.fastly.com"
+	}
+
+	for _, u := range urls {
+		// Fastly takes the URL without its scheme.
+		target := strings.TrimPrefix(strings.TrimPrefix(u, "https://"), "http://")
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/purge/"+target, nil)
+		if err != nil {
+			return fmt.Errorf("could not create fastly purge request: %v", err)
+		}
+
+		req.Header.Set("Fastly-Key", f.APIToken)
+		req.Header.Set("Accept", "application/json")
+		if err = do(req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func do(req *http.Request) error {
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not do purge request: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("purge provider responded with %s", res.Status)
+	}
+
+	return nil
+}
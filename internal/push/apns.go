@@ -0,0 +1,149 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	apnsProductionURL  = "https://api.push.apple.com"
+	apnsDevelopmentURL = "https://api.sandbox.push.apple.com"
+	// apnsTokenLifespan is under the hour Apple accepts provider tokens for.
+	apnsTokenLifespan = 50 * time.Minute
+)
+
+// APNs sends to iOS devices through the Apple Push Notification service
+// with token based authentication.
+type APNs struct {
+	keyID   string
+	teamID  string
+	topic   string
+	baseURL string
+	key     *ecdsa.PrivateKey
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewAPNs reads the .p8 signing key. Topic is the app bundle ID.
+func NewAPNs(keyFile, keyID, teamID, topic string, production bool) (*APNs, error) {
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read apns key: %v", err)
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("could not decode apns key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse apns key: %v", err)
+	}
+
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("apns key is not ecdsa")
+	}
+
+	baseURL := apnsDevelopmentURL
+	if production {
+		baseURL = apnsProductionURL
+	}
+
+	return &APNs{
+		keyID:   keyID,
+		teamID:  teamID,
+		topic:   topic,
+		baseURL: baseURL,
+		key:     key,
+	}, nil
+}
+
+// Send implements Sender.
+func (a *APNs) Send(ctx context.Context, platform, token string, m Message) error {
+	providerToken, err := a.providerToken()
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{"title": m.Title, "body": m.Body},
+			"sound": "default",
+		},
+	}
+	for k, v := range m.Data {
+		if k != "aps" {
+			payload[k] = v
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("could not marshal apns payload: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+"/3/device/"+token, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not create apns request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "bearer "+providerToken)
+	req.Header.Set("apns-topic", a.topic)
+	req.Header.Set("apns-push-type", "alert")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not do apns request: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusGone {
+		return ErrInvalidToken
+	}
+
+	if res.StatusCode == http.StatusBadRequest {
+		var out struct {
+			Reason string `json:"reason"`
+		}
+		if json.NewDecoder(res.Body).Decode(&out) == nil && (out.Reason == "BadDeviceToken" || out.Reason == "DeviceTokenNotForTopic") {
+			return ErrInvalidToken
+		}
+	}
+
+	return checkResponse(res, "apns")
+}
+
+func (a *APNs) providerToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if a.token != "" && now.Before(a.expiresAt) {
+		return a.token, nil
+	}
+
+	token, err := signJWT("ES256", a.keyID, map[string]interface{}{
+		"iss": a.teamID,
+		"iat": now.Unix(),
+	}, a.key)
+	if err != nil {
+		return "", err
+	}
+
+	a.token = token
+	a.expiresAt = now.Add(apnsTokenLifespan)
+	return token, nil
+}
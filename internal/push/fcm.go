@@ -0,0 +1,183 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// FCM sends to Android devices through the Firebase Cloud Messaging HTTP v1 API,
+// authenticated as a Google service account.
+type FCM struct {
+	projectID   string
+	clientEmail string
+	tokenURI    string
+	key         *rsa.PrivateKey
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewFCM reads the service account credentials JSON file downloaded from the Firebase console.
+func NewFCM(credentialsFile string) (*FCM, error) {
+	b, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read fcm credentials: %v", err)
+	}
+
+	var creds struct {
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err = json.Unmarshal(b, &creds); err != nil {
+		return nil, fmt.Errorf("could not parse fcm credentials: %v", err)
+	}
+
+	block, _ := pem.Decode([]byte(creds.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("could not decode fcm private key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse fcm private key: %v", err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("fcm private key is not rsa")
+	}
+
+	return &FCM{
+		projectID:   creds.ProjectID,
+		clientEmail: creds.ClientEmail,
+		tokenURI:    creds.TokenURI,
+		key:         key,
+	}, nil
+}
+
+// Send implements Sender.
+func (f *FCM) Send(ctx context.Context, platform, token string, m Message) error {
+	accessToken, err := f.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	var in struct {
+		Message struct {
+			Token        string            `json:"token"`
+			Notification map[string]string `json:"notification"`
+			Data         map[string]string `json:"data,omitempty"`
+		} `json:"message"`
+	}
+	in.Message.Token = token
+	in.Message.Notification = map[string]string{"title": m.Title, "body": m.Body}
+	in.Message.Data = m.Data
+
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("could not marshal fcm message: %v", err)
+	}
+
+	endpoint := "https://fcm.googleapis.com/v1/projects/" + f.projectID + "/messages:send"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not create fcm request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not do fcm request: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return ErrInvalidToken
+	}
+
+	if res.StatusCode == http.StatusBadRequest {
+		var out struct {
+			Error struct {
+				Status string `json:"status"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(res.Body).Decode(&out) == nil && out.Error.Status == "INVALID_ARGUMENT" {
+			return ErrInvalidToken
+		}
+	}
+
+	return checkResponse(res, "fcm")
+}
+
+// token returns an OAuth2 access token, exchanging a signed assertion when it expired.
+func (f *FCM) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if f.accessToken != "" && now.Before(f.expiresAt) {
+		return f.accessToken, nil
+	}
+
+	assertion, err := signJWT("RS256", "", map[string]interface{}{
+		"iss":   f.clientEmail,
+		"scope": fcmScope,
+		"aud":   f.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}, f.key)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("could not create fcm token request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("could not do fcm token request: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	if err = checkResponse(res, "google oauth"); err != nil {
+		return "", err
+	}
+
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("could not decode fcm token response: %v", err)
+	}
+
+	f.accessToken = out.AccessToken
+	// refresh a minute early.
+	f.expiresAt = now.Add(time.Duration(out.ExpiresIn)*time.Second - time.Minute)
+	return f.accessToken, nil
+}
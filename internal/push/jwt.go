@@ -0,0 +1,56 @@
+package push
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// signJWT signs claims with an RSA key for RS256 or an ECDSA P-256 key for ES256.
+func signJWT(alg, keyID string, claims map[string]interface{}, key crypto.Signer) (string, error) {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal jwt header: %v", err)
+	}
+
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal jwt claims: %v", err)
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(h) + "." + enc.EncodeToString(c)
+	digest := sha256.Sum256([]byte(unsigned))
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, signErr := ecdsa.Sign(rand.Reader, k, digest[:])
+		err = signErr
+		// JWS wants the fixed size r || s concatenation, not ASN.1.
+		sig = make([]byte, 64)
+		if err == nil {
+			r.FillBytes(sig[:32])
+			s.FillBytes(sig[32:])
+		}
+	default:
+		return "", fmt.Errorf("unsupported jwt key type %T", key)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not sign jwt: %v", err)
+	}
+
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
@@ -0,0 +1,70 @@
+// Package push delivers notifications to mobile devices through
+// Firebase Cloud Messaging and the Apple Push Notification service.
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Device platforms.
+const (
+	PlatformAndroid = "android"
+	PlatformIOS     = "ios"
+)
+
+var (
+	// ErrInvalidToken used when the provider reports the device token is no longer valid.
+	// The device should be forgotten.
+	ErrInvalidToken = errors.New("invalid push token")
+	// ErrUnsupportedPlatform used when no provider is configured for the platform.
+	ErrUnsupportedPlatform = errors.New("unsupported push platform")
+)
+
+// Message shown on the device. Data is passed along to the app.
+type Message struct {
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// Sender delivers a message to a device token of the given platform.
+type Sender interface {
+	Send(ctx context.Context, platform, token string, m Message) error
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Platforms routes each message to the sender of its platform.
+type Platforms map[string]Sender
+
+// Send implements Sender.
+func (pp Platforms) Send(ctx context.Context, platform, token string, m Message) error {
+	s, ok := pp[platform]
+	if !ok {
+		return ErrUnsupportedPlatform
+	}
+
+	return s.Send(ctx, platform, token, m)
+}
+
+// Log sender writes the messages to the log instead of sending them. Meant for development.
+type Log struct{}
+
+// Send logs the message.
+func (*Log) Send(ctx context.Context, platform, token string, m Message) error {
+	log.Printf("push to %s device: %s: %s\n", platform, m.Title, m.Body)
+	return nil
+}
+
+func checkResponse(res *http.Response, provider string) error {
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%s responded with %s", provider, res.Status)
+	}
+
+	return nil
+}
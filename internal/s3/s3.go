@@ -0,0 +1,201 @@
+// Package s3 is a minimal client for S3 compatible object storage,
+// covering the calls needed for direct uploads from clients.
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound used when the object does not exist.
+var ErrNotFound = errors.New("object not found")
+
+// emptyPayloadHash is the SHA-256 of an empty body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+// Client of a bucket.
+type Client struct {
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// Endpoint of an S3 compatible service, like MinIO, addressed path style.
+	// Defaults to the virtual hosted AWS endpoint of the bucket.
+	Endpoint string
+}
+
+// objectURL of the key.
+func (c *Client) objectURL(key string) *url.URL {
+	escaped := (&url.URL{Path: "/" + key}).EscapedPath()
+	if c.Endpoint != "" {
+		u, _ := url.Parse(strings.TrimSuffix(c.Endpoint, "/") + "/" + c.Bucket + escaped)
+		return u
+	}
+
+	return &url.URL{Scheme: "https", Host: c.Bucket + ".s3." + c.Region + ".amazonaws.com", Path: "/" + key, RawPath: escaped}
+}
+
+// PresignPut returns a URL clients can PUT the object to, with the given
+// content type, until it expires.
+func (c *Client) PresignPut(key, contentType string, expires time.Duration, now time.Time) string {
+	u := c.objectURL(key)
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + c.Region + "/s3/aws4_request"
+
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", c.AccessKeyID+"/"+scope)
+	q.Set("X-Amz-Date", amzDate)
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "content-type;host")
+	query := canonicalQuery(q)
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodPut,
+		u.EscapedPath(),
+		query,
+		"content-type:" + contentType,
+		"host:" + u.Host,
+		"",
+		"content-type;host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	u.RawQuery = query + "&X-Amz-Signature=" + c.signature(canonicalRequest, amzDate, now)
+	return u.String()
+}
+
+// Get the object, returning its body and size.
+func (c *Client) Get(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	res, err := c.do(ctx, http.MethodGet, key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return res.Body, res.ContentLength, nil
+}
+
+// Delete the object.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	res, err := c.do(ctx, http.MethodDelete, key)
+	if err != nil {
+		return err
+	}
+
+	res.Body.Close()
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, key string) (*http.Response, error) {
+	u := c.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create s3 request: %v", err)
+	}
+
+	c.sign(req, time.Now().UTC())
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not do s3 request: %v", err)
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		res.Body.Close()
+		return nil, fmt.Errorf("s3 responded with %s", res.Status)
+	}
+
+	return res, nil
+}
+
+// sign the bodiless request with AWS signature version 4.
+func (c *Client) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + c.Region + "/s3/aws4_request"
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + emptyPayloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKeyID, scope, signedHeaders, c.signature(canonicalRequest, amzDate, now)))
+}
+
+func (c *Client) signature(canonicalRequest, amzDate string, now time.Time) string {
+	date := now.Format("20060102")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		date + "/" + c.Region + "/s3/aws4_request",
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), date)
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// canonicalQuery sorts the parameters and escapes them the way SigV4 expects.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, uriEscape(k)+"="+uriEscape(v))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+func uriEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
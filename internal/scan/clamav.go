@@ -0,0 +1,99 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	clamAVAddr = "/var/run/clamav/clamd.ctl"
+	// clamAVChunkSize stays below the StreamMaxLength clamd defaults to.
+	clamAVChunkSize = 64 << 10
+	clamAVTimeout   = time.Minute
+)
+
+// ClamAV scanner talking to clamd with the INSTREAM command.
+type ClamAV struct {
+	// Addr of clamd, a unix socket path or a host:port.
+	// Defaults to the socket of the Debian package.
+	Addr string
+}
+
+// Scan streams r to clamd.
+func (c *ClamAV) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	var out Result
+	addr := c.Addr
+	if addr == "" {
+		addr = clamAVAddr
+	}
+
+	network := "tcp"
+	if strings.HasPrefix(addr, "/") {
+		network = "unix"
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return out, fmt.Errorf("could not dial clamd: %v", err)
+	}
+
+	defer conn.Close()
+
+	deadline := time.Now().Add(clamAVTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err = conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return out, fmt.Errorf("could not write clamd command: %v", err)
+	}
+
+	buf := make([]byte, 4+clamAVChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				return out, fmt.Errorf("could not write clamd chunk: %v", werr)
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return out, fmt.Errorf("could not read file to scan: %v", err)
+		}
+	}
+
+	if _, err = conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return out, fmt.Errorf("could not write clamd end of stream: %v", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return out, fmt.Errorf("could not read clamd reply: %v", err)
+	}
+
+	// Replies look like "stream: OK" or "stream: Eicar-Signature FOUND".
+	reply = strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), "\x00")
+	switch {
+	case reply == "OK":
+		return out, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		out.Infected = true
+		out.Signature = strings.TrimSuffix(reply, " FOUND")
+		return out, nil
+	}
+
+	return out, fmt.Errorf("clamd replied %q", reply)
+}
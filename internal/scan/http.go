@@ -0,0 +1,54 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HTTP scanner for external scanning APIs. The file is POSTed as the request
+// body and the API must respond with JSON like {"infected": true, "signature": "..."}.
+type HTTP struct {
+	URL string
+	// APIKey is sent as a bearer token when set.
+	APIKey string
+}
+
+// Scan uploads r to the scanning API.
+func (h *HTTP) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	var out Result
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, r)
+	if err != nil {
+		return out, fmt.Errorf("could not create scan request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if h.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.APIKey)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return out, fmt.Errorf("could not do scan request: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return out, fmt.Errorf("scan api responded with %s", res.Status)
+	}
+
+	var body struct {
+		Infected  bool   `json:"infected"`
+		Signature string `json:"signature"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return out, fmt.Errorf("could not decode scan response: %v", err)
+	}
+
+	out.Infected = body.Infected
+	out.Signature = body.Signature
+	return out, nil
+}
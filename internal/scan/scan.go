@@ -0,0 +1,49 @@
+// Package scan checks uploaded files for malware.
+package scan
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Supported providers.
+const (
+	ProviderClamAV = "clamav"
+	ProviderHTTP   = "http"
+)
+
+// ErrUnknownProvider used when the configured provider is not supported.
+var ErrUnknownProvider = errors.New("unknown scan provider")
+
+// Result of scanning a file.
+type Result struct {
+	Infected bool
+	// Signature of the malware found, if the scanner names it.
+	Signature string
+}
+
+// Scanner checks the content read from r for malware.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+var httpClient = &http.Client{Timeout: time.Minute}
+
+// New scanner for the given provider. addr is the clamd socket for ClamAV,
+// either a unix socket path or a host:port, and the endpoint URL for HTTP.
+// An empty provider returns a nil Scanner.
+func New(provider, addr, apiKey string) (Scanner, error) {
+	switch provider {
+	case "":
+		return nil, nil
+	case ProviderClamAV:
+		return &ClamAV{Addr: addr}, nil
+	case ProviderHTTP:
+		return &HTTP{URL: addr, APIKey: apiKey}, nil
+	}
+
+	return nil, ErrUnknownProvider
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// UserActivityRetentionDays is how long the daily activity of each user is
+	// kept. Only the aggregate counts are kept past it, so it must cover the
+	// 30 days of the monthly count, plus some slack for missed runs.
+	UserActivityRetentionDays = 45
+	// MaxActiveUsersDays of counts readable at once.
+	MaxActiveUsersDays = 366
+)
+
+// ActiveUserCount of a day, in UTC. Weekly and monthly counts
+// are of the 7 and 30 days ending on it.
+type ActiveUserCount struct {
+	Day string `json:"day"`
+	DAU int    `json:"dau"`
+	WAU int    `json:"wau"`
+	MAU int    `json:"mau"`
+}
+
+// recordActivity flags the user as active today. Only the day is recorded,
+// nothing about what they did, and the flags are pruned by CountActiveUsers.
+func recordActivity(ctx context.Context, tx execer, uid int64) error {
+	query := "INSERT INTO user_activity (user_id, day) VALUES ($1, (now() AT TIME ZONE 'UTC')::date) ON CONFLICT DO NOTHING"
+	if _, err := tx.ExecContext(ctx, query, uid); err != nil {
+		return fmt.Errorf("could not insert user activity: %v", err)
+	}
+
+	return nil
+}
+
+// CountActiveUsers aggregates the daily, weekly and monthly active users of the
+// days ended since its last run, then prunes the activity flags past retention.
+// The first run only counts yesterday, and days older than the retention allows
+// a monthly count for are skipped. It is meant to run daily.
+func (s *Service) CountActiveUsers(ctx context.Context) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	query := `WITH today AS (SELECT (now() AT TIME ZONE 'UTC')::date AS day)
+		INSERT INTO active_user_counts (day, dau, wau, mau)
+		SELECT d.day,
+			count(DISTINCT a.user_id) FILTER (WHERE a.day = d.day),
+			count(DISTINCT a.user_id) FILTER (WHERE a.day > d.day - 7),
+			count(DISTINCT a.user_id)
+		FROM (
+			SELECT generate_series(
+				GREATEST(
+					COALESCE((SELECT max(day) + 1 FROM active_user_counts), today.day - 1),
+					today.day - $1::int + 30
+				),
+				today.day - 1,
+				INTERVAL '1 day'
+			)::date AS day
+			FROM today
+		) d
+		LEFT JOIN user_activity a ON a.day > d.day - 30 AND a.day <= d.day
+		GROUP BY d.day
+		ON CONFLICT (day) DO NOTHING`
+	res, err := tx.ExecContext(ctx, query, UserActivityRetentionDays)
+	if err != nil {
+		return 0, fmt.Errorf("could not insert active user counts: %v", err)
+	}
+
+	query = "DELETE FROM user_activity WHERE day < (now() AT TIME ZONE 'UTC')::date - $1::int"
+	if _, err = tx.ExecContext(ctx, query, UserActivityRetentionDays); err != nil {
+		return 0, fmt.Errorf("could not prune user activity: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not commit active users count: %v", err)
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// ActiveUsers counts of the last given days, oldest first. Admin only.
+func (s *Service) ActiveUsers(ctx context.Context, days int) ([]ActiveUserCount, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if days <= 0 {
+		days = 30
+	} else if days > MaxActiveUsersDays {
+		days = MaxActiveUsersDays
+	}
+
+	query := `SELECT to_char(day, 'YYYY-MM-DD'), dau, wau, mau FROM active_user_counts
+		WHERE day >= (now() AT TIME ZONE 'UTC')::date - $1::int
+		ORDER BY day`
+	rows, err := s.db.QueryContext(ctx, query, days)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select active user counts: %v", err)
+	}
+
+	defer rows.Close()
+
+	cc := []ActiveUserCount{}
+	for rows.Next() {
+		var c ActiveUserCount
+		if err = rows.Scan(&c.Day, &c.DAU, &c.WAU, &c.MAU); err != nil {
+			return nil, fmt.Errorf("could not scan active user count: %v", err)
+		}
+
+		cc = append(cc, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate active user count rows: %v", err)
+	}
+
+	return cc, nil
+}
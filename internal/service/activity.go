@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// Types of activity on the posts of a user.
+const (
+	ActivityLike    = "like"
+	ActivityComment = "comment"
+)
+
+// Activity is something another user did on a post of the authenticated user.
+type Activity struct {
+	Type   string `json:"type"`
+	Actor  User   `json:"actor"`
+	PostID int64  `json:"postId"`
+	// CommentID and Content are set on comments.
+	CommentID *int64    `json:"commentId,omitempty"`
+	Content   *string   `json:"content,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Activity on the posts of the authenticated user: the likes and comments others
+// left, merged in descending order. Unlike notifications it keeps no read state and
+// nothing is grouped. It paginates backward with before, the createdAt of the last
+// activity of the previous page.
+func (s *Service) Activity(ctx context.Context, last int, before time.Time) ([]Activity, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	var beforeTime *time.Time
+	if !before.IsZero() {
+		beforeTime = &before
+	}
+
+	last = validation.PageSize(last)
+	query, args, err := buildQuery(`
+		SELECT a.type, a.post_id, a.comment_id, a.content, a.created_at, u.username, u.avatar, u.verified
+		FROM (
+			SELECT 'like' AS type, pl.user_id, pl.post_id, NULL::INT AS comment_id, NULL AS content, pl.created_at
+			FROM post_likes pl
+			INNER JOIN posts p ON pl.post_id = p.id
+			WHERE p.user_id = @uid AND pl.user_id <> @uid
+			{{if .before}}AND pl.created_at < @before{{end}}
+			UNION ALL
+			SELECT 'comment', c.user_id, c.post_id, c.id, c.content, c.created_at
+			FROM comments c
+			INNER JOIN posts p ON c.post_id = p.id
+			WHERE p.user_id = @uid AND c.user_id <> @uid
+			{{if .before}}AND c.created_at < @before{{end}}
+		) a
+		INNER JOIN users u ON a.user_id = u.id
+		ORDER BY a.created_at DESC
+		LIMIT @last`, map[string]interface{}{
+		"uid":    uid,
+		"before": beforeTime,
+		"last":   last,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build activity sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select activity: %v", err)
+	}
+
+	defer rows.Close()
+
+	aa := make([]Activity, 0, last)
+	for rows.Next() {
+		var a Activity
+		var avatar sql.NullString
+		dest := []interface{}{&a.Type, &a.PostID, &a.CommentID, &a.Content, &a.CreatedAt, &a.Actor.Username, &avatar, &a.Actor.Verified}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan activity: %v", err)
+		}
+
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			a.Actor.AvatarURL = &avatarURL
+		}
+
+		aa = append(aa, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate activity rows: %v", err)
+	}
+
+	return aa, nil
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/djomlaa/socnet/internal/validation"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Roles a user can have.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// ErrForbidden used when the authenticated user lacks the role required.
+var ErrForbidden = errors.New("forbidden")
+
+// AdminUser is the full view of a user for operators.
+type AdminUser struct {
+	ID             int64   `json:"id"`
+	Email          string  `json:"email"`
+	Username       string  `json:"username"`
+	Role           string  `json:"role"`
+	AvatarURL      *string `json:"avatarUrl"`
+	Verified       bool    `json:"verified"`
+	FollowersCount int     `json:"followers_count"`
+	FolloweesCount int     `json:"followees_count"`
+	ActiveSessions int     `json:"active_sessions"`
+	Deactivated    bool    `json:"deactivated"`
+}
+
+func validRole(role string) bool {
+	return role == RoleUser || role == RoleModerator || role == RoleAdmin
+}
+
+// DebugAccess checks the authenticated user can reach the runtime
+// debug endpoints, which only admins can.
+func (s *Service) DebugAccess(ctx context.Context) error {
+	_, err := s.authAdmin(ctx)
+	return err
+}
+
+// authAdmin returns the id of the authenticated user when they are an admin.
+func (s *Service) authAdmin(ctx context.Context) (int64, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return 0, ErrUnauthenticated
+	}
+
+	var role string
+	if err := s.db.QueryRowContext(ctx, "SELECT role FROM users WHERE id = $1", uid).Scan(&role); err != nil {
+		return 0, fmt.Errorf("could not query select user role: %v", err)
+	}
+
+	if role != RoleAdmin {
+		return 0, ErrForbidden
+	}
+
+	return uid, nil
+}
+
+// CreateAdmin inserts an admin user or promotes the user with the given email to admin.
+func (s *Service) CreateAdmin(ctx context.Context, email, username string) error {
+	email = strings.TrimSpace(email)
+	var v validation.Validator
+	v.Email("email", email)
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	query := "UPDATE users SET role = $1 WHERE email = $2"
+	res, err := s.db.ExecContext(ctx, query, RoleAdmin, email)
+	if err != nil {
+		return fmt.Errorf("could not update user role: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n != 0 {
+		return nil
+	}
+
+	username = validation.NormalizeUsername(username)
+	v.Username("username", username)
+	if err = v.Err(); err != nil {
+		return err
+	}
+
+	query = "INSERT INTO users (email, username, username_skeleton, role) VALUES ($1, $2, $3, $4)"
+	_, err = s.db.ExecContext(ctx, query, email, username, validation.UsernameSkeleton(username), RoleAdmin)
+
+	if isUniqueViolation(err) && strings.Contains(err.Error(), "username") {
+		return ErrUsernameTaken
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not insert admin: %v", err)
+	}
+
+	return nil
+}
+
+// LookupUser by id, email or username.
+func (s *Service) LookupUser(ctx context.Context, login string) (AdminUser, error) {
+	var u AdminUser
+	var avatar sql.NullString
+
+	login = strings.TrimSpace(login)
+	query := `
+		SELECT id, email, username, role, avatar, verified,
+			COALESCE(stats.followers_count, 0), COALESCE(stats.followees_count, 0),
+			(SELECT count(*) FROM sessions WHERE user_id = users.id AND revoked_at IS NULL AND impersonator_id IS NULL),
+			deactivated_at IS NOT NULL
+		FROM users LEFT JOIN user_stats AS stats ON stats.user_id = users.id `
+	var arg interface{} = login
+	if id, err := strconv.ParseInt(login, 10, 64); err == nil {
+		query += "WHERE id = $1"
+		arg = id
+	} else if strings.Contains(login, "@") {
+		query += "WHERE email = $1"
+	} else {
+		query += "WHERE lower(username) = lower($1)"
+	}
+
+	err := s.db.QueryRowContext(ctx, query, arg).Scan(&u.ID, &u.Email, &u.Username, &u.Role, &avatar, &u.Verified,
+		&u.FollowersCount, &u.FolloweesCount, &u.ActiveSessions, &u.Deactivated)
+	if err == sql.ErrNoRows {
+		return u, ErrUserNotFound
+	}
+
+	if err != nil {
+		return u, fmt.Errorf("could not query select user: %v", err)
+	}
+
+	if avatar.Valid {
+		avatarURL := s.origin + "/img/avatars/" + avatar.String
+		u.AvatarURL = &avatarURL
+	}
+
+	return u, nil
+}
+
+// ResetAvatar removes the avatar of the given user.
+func (s *Service) ResetAvatar(ctx context.Context, username string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	// Locked like in UpdateAvatar, so a concurrent update doesn't orphan its file.
+	var uid int64
+	var oldAvatar sql.NullString
+	query := "SELECT id, avatar FROM users WHERE lower(username) = lower($1) FOR UPDATE"
+	err = tx.QueryRowContext(ctx, query, username).Scan(&uid, &oldAvatar)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not query select user avatar: %v", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE users SET avatar = NULL WHERE id = $1", uid); err != nil {
+		return fmt.Errorf("could not reset avatar: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit avatar reset: %v", err)
+	}
+
+	if oldAvatar.Valid {
+		if err = os.Remove(path.Join(avatarsDir, oldAvatar.String)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not remove avatar file: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// ChangeEmail of the given user.
+func (s *Service) ChangeEmail(ctx context.Context, username, email string) error {
+	email = strings.TrimSpace(email)
+	var v validation.Validator
+	v.Email("email", email)
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	query := "UPDATE users SET email = $1 WHERE lower(username) = lower($2)"
+	res, err := s.db.ExecContext(ctx, query, email, username)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not update email: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// GrantRole to the given user.
+func (s *Service) GrantRole(ctx context.Context, username, role string) error {
+	var v validation.Validator
+	v.Check(validRole(role), "role", "invalid role")
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	query := "UPDATE users SET role = $1 WHERE lower(username) = lower($2)"
+	res, err := s.db.ExecContext(ctx, query, role, username)
+	if err != nil {
+		return fmt.Errorf("could not update role: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// RevokeSessions of the given user, returning how many were revoked.
+// Tokens issued for those sessions stop working right away.
+func (s *Service) RevokeSessions(ctx context.Context, username string) (int64, error) {
+	var uid int64
+	query := "SELECT id FROM users WHERE lower(username) = lower($1)"
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&uid)
+	if err == sql.ErrNoRows {
+		return 0, ErrUserNotFound
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("could not query select user id: %v", err)
+	}
+
+	query = "UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL"
+	res, err := s.db.ExecContext(ctx, query, uid)
+	if err != nil {
+		return 0, fmt.Errorf("could not revoke sessions: %v", err)
+	}
+
+	return res.RowsAffected()
+}
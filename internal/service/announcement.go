@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// Announcement severities, from least to most prominent.
+const (
+	AnnouncementInfo     = "info"
+	AnnouncementWarning  = "warning"
+	AnnouncementCritical = "critical"
+)
+
+// MaxAnnouncementLength in runes.
+const MaxAnnouncementLength = 500
+
+// ErrAnnouncementNotFound denotes an announcement that was not found
+var ErrAnnouncementNotFound = errors.New("announcement not found")
+
+// Announcement shown to everyone in a banner during its active window.
+// A nil StartsAt or EndsAt leaves that side of the window open.
+type Announcement struct {
+	ID        int64      `json:"id"`
+	Text      string     `json:"text"`
+	Severity  string     `json:"severity"`
+	StartsAt  *time.Time `json:"startsAt"`
+	EndsAt    *time.Time `json:"endsAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// AnnouncementInput request
+type AnnouncementInput struct {
+	Text     string
+	Severity string
+	StartsAt *time.Time
+	EndsAt   *time.Time
+}
+
+func (in *AnnouncementInput) validate() error {
+	in.Text = strings.TrimSpace(in.Text)
+	if in.Severity == "" {
+		in.Severity = AnnouncementInfo
+	}
+
+	var v validation.Validator
+	v.Check(in.Text != "", "text", "cannot be empty")
+	v.Check(utf8.RuneCountInString(in.Text) <= MaxAnnouncementLength, "text", "too long")
+	v.Check(in.Severity == AnnouncementInfo || in.Severity == AnnouncementWarning || in.Severity == AnnouncementCritical,
+		"severity", "must be info, warning or critical")
+	v.Check(in.StartsAt == nil || in.EndsAt == nil || in.EndsAt.After(*in.StartsAt), "endsAt", "must be after startsAt")
+	return v.Err()
+}
+
+// ActiveAnnouncements in their window, most severe then newest first, but the
+// ones the authenticated user dismissed.
+func (s *Service) ActiveAnnouncements(ctx context.Context) ([]Announcement, error) {
+	uid, _ := ctx.Value(KeyAuthUserID).(int64)
+	query := `SELECT id, text, severity, starts_at, ends_at, created_at FROM announcements
+		WHERE (starts_at IS NULL OR starts_at <= now()) AND (ends_at IS NULL OR ends_at > now())
+		AND NOT EXISTS (
+			SELECT 1 FROM announcement_dismissals WHERE announcement_id = announcements.id AND user_id = $1
+		)
+		ORDER BY CASE severity WHEN 'critical' THEN 0 WHEN 'warning' THEN 1 ELSE 2 END, id DESC`
+	return s.queryAnnouncements(ctx, query, uid)
+}
+
+// DismissAnnouncement for the authenticated user, so it is no longer listed to them.
+func (s *Service) DismissAnnouncement(ctx context.Context, announcementID int64) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	query := "INSERT INTO announcement_dismissals (announcement_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	_, err := s.db.ExecContext(ctx, query, announcementID, uid)
+	if isForeignKeyViolation(err) {
+		return ErrAnnouncementNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not insert announcement dismissal: %v", err)
+	}
+
+	return nil
+}
+
+// Announcements of the instance, past and future ones too, newest first. Admin only.
+func (s *Service) Announcements(ctx context.Context) ([]Announcement, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT id, text, severity, starts_at, ends_at, created_at FROM announcements ORDER BY id DESC"
+	return s.queryAnnouncements(ctx, query)
+}
+
+// CreateAnnouncement to show in its window. Severity defaults to info. Admin only.
+func (s *Service) CreateAnnouncement(ctx context.Context, in AnnouncementInput) (Announcement, error) {
+	var a Announcement
+	if _, err := s.authAdmin(ctx); err != nil {
+		return a, err
+	}
+
+	if err := in.validate(); err != nil {
+		return a, err
+	}
+
+	query := `INSERT INTO announcements (text, severity, starts_at, ends_at) VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+	if err := s.db.QueryRowContext(ctx, query, in.Text, in.Severity, in.StartsAt, in.EndsAt).Scan(&a.ID, &a.CreatedAt); err != nil {
+		return a, fmt.Errorf("could not insert announcement: %v", err)
+	}
+
+	a.Text = in.Text
+	a.Severity = in.Severity
+	a.StartsAt = in.StartsAt
+	a.EndsAt = in.EndsAt
+	return a, nil
+}
+
+// UpdateAnnouncement replaces its text, severity and window. Users who dismissed
+// it don't see it again. Admin only.
+func (s *Service) UpdateAnnouncement(ctx context.Context, announcementID int64, in AnnouncementInput) (Announcement, error) {
+	var a Announcement
+	if _, err := s.authAdmin(ctx); err != nil {
+		return a, err
+	}
+
+	if err := in.validate(); err != nil {
+		return a, err
+	}
+
+	query := `UPDATE announcements SET text = $1, severity = $2, starts_at = $3, ends_at = $4
+		WHERE id = $5
+		RETURNING created_at`
+	err := s.db.QueryRowContext(ctx, query, in.Text, in.Severity, in.StartsAt, in.EndsAt, announcementID).Scan(&a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return a, ErrAnnouncementNotFound
+	}
+
+	if err != nil {
+		return a, fmt.Errorf("could not update announcement: %v", err)
+	}
+
+	a.ID = announcementID
+	a.Text = in.Text
+	a.Severity = in.Severity
+	a.StartsAt = in.StartsAt
+	a.EndsAt = in.EndsAt
+	return a, nil
+}
+
+// DeleteAnnouncement along with its dismissals. Admin only.
+func (s *Service) DeleteAnnouncement(ctx context.Context, announcementID int64) error {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM announcements WHERE id = $1", announcementID)
+	if err != nil {
+		return fmt.Errorf("could not delete announcement: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAnnouncementNotFound
+	}
+
+	return nil
+}
+
+func (s *Service) queryAnnouncements(ctx context.Context, query string, args ...interface{}) ([]Announcement, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select announcements: %v", err)
+	}
+
+	defer rows.Close()
+
+	aa := []Announcement{}
+	for rows.Next() {
+		var a Announcement
+		var startsAt, endsAt sql.NullTime
+		if err = rows.Scan(&a.ID, &a.Text, &a.Severity, &startsAt, &endsAt, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan announcement: %v", err)
+		}
+
+		if startsAt.Valid {
+			a.StartsAt = &startsAt.Time
+		}
+		if endsAt.Valid {
+			a.EndsAt = &endsAt.Time
+		}
+
+		aa = append(aa, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate announcement rows: %v", err)
+	}
+
+	return aa, nil
+}
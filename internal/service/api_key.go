@@ -0,0 +1,350 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// Defaults of API keys. Quotas are counted by UTC day and rate limits by minute.
+const (
+	DefaultAPIKeyDailyQuota = 10000
+	DefaultAPIKeyRateLimit  = 60
+)
+
+// MaxAPIKeyUsageDays readable at once.
+const MaxAPIKeyUsageDays = 90
+
+var (
+	// ErrAPIKeyNotFound denotes an API key that was not found
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrInvalidAPIKey used when a request has an unknown or revoked API key.
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	// ErrQuotaExceeded used when an API key used up its daily quota.
+	ErrQuotaExceeded = errors.New("daily quota exceeded")
+)
+
+// APIKey lets a third-party tool read the public API, within its daily quota
+// and rate limit per minute.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	DailyQuota int        `json:"dailyQuota"`
+	RateLimit  int        `json:"rateLimit"`
+	UsedToday  int        `json:"usedToday"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+// APIKeyInput request. Zero limits take the defaults.
+type APIKeyInput struct {
+	Name       string
+	DailyQuota int
+	RateLimit  int
+}
+
+// CreateAPIKeyOutput response. The key is only shown once.
+type CreateAPIKeyOutput struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyUsage of an API key on a UTC day. Requests refused past its limits
+// are counted apart.
+type APIKeyUsage struct {
+	Day      string `json:"day"`
+	Requests int    `json:"requests"`
+	Refused  int    `json:"refused"`
+}
+
+// APIKeyUse is what is left of the limits of an API key after a request.
+type APIKeyUse struct {
+	DailyQuota     int
+	QuotaRemaining int
+	RateLimit      int
+	RateRemaining  int
+}
+
+// apiKeyRates counts the requests of each API key in the current minute,
+// in this process only.
+type apiKeyRates struct {
+	mu     sync.Mutex
+	minute time.Time
+	counts map[int64]int
+}
+
+// allow a request of the key if it is within the limit, and return how many
+// are left this minute.
+func (r *apiKeyRates) allow(keyID int64, limit int) (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	minute := time.Now().Truncate(time.Minute)
+	if !minute.Equal(r.minute) {
+		r.minute = minute
+		r.counts = map[int64]int{}
+	}
+
+	if r.counts[keyID] >= limit {
+		return 0, false
+	}
+
+	r.counts[keyID]++
+	return limit - r.counts[keyID], true
+}
+
+func hashAPIKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+func (in *APIKeyInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.DailyQuota == 0 {
+		in.DailyQuota = DefaultAPIKeyDailyQuota
+	}
+	if in.RateLimit == 0 {
+		in.RateLimit = DefaultAPIKeyRateLimit
+	}
+
+	var v validation.Validator
+	v.Check(in.Name != "", "name", "cannot be empty")
+	v.Check(utf8.RuneCountInString(in.Name) <= 100, "name", "too long")
+	v.Check(in.DailyQuota > 0, "dailyQuota", "must be positive")
+	v.Check(in.RateLimit > 0, "rateLimit", "must be positive")
+	return v.Err()
+}
+
+// UseAPIKey counts a request of the public API against the limits of the key.
+// Requests past the rate limit fail with ErrRateLimited and past the daily
+// quota with ErrQuotaExceeded. Both are counted as refused.
+func (s *Service) UseAPIKey(ctx context.Context, key string) (APIKeyUse, error) {
+	var use APIKeyUse
+	if key == "" {
+		return use, ErrInvalidAPIKey
+	}
+
+	var keyID int64
+	query := "SELECT id, daily_quota, rate_limit FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL"
+	err := s.db.QueryRowContext(ctx, query, hashAPIKey(key)).Scan(&keyID, &use.DailyQuota, &use.RateLimit)
+	if err == sql.ErrNoRows {
+		return use, ErrInvalidAPIKey
+	}
+
+	if err != nil {
+		return use, fmt.Errorf("could not query select api key: %v", err)
+	}
+
+	var ok bool
+	if use.RateRemaining, ok = s.apiKeyRates.allow(keyID, use.RateLimit); !ok {
+		return use, s.refuseAPIKeyRequest(ctx, keyID, ErrRateLimited)
+	}
+
+	var requests int
+	query = `INSERT INTO api_key_usage (api_key_id, day, requests) VALUES ($1, (now() AT TIME ZONE 'UTC')::date, 1)
+		ON CONFLICT (api_key_id, day) DO UPDATE SET requests = api_key_usage.requests + 1
+		WHERE api_key_usage.requests < $2
+		RETURNING requests`
+	err = s.db.QueryRowContext(ctx, query, keyID, use.DailyQuota).Scan(&requests)
+	if err == sql.ErrNoRows {
+		return use, s.refuseAPIKeyRequest(ctx, keyID, ErrQuotaExceeded)
+	}
+
+	if err != nil {
+		return use, fmt.Errorf("could not upsert api key usage: %v", err)
+	}
+
+	use.QuotaRemaining = use.DailyQuota - requests
+	return use, nil
+}
+
+// refuseAPIKeyRequest counts a refused request of the key and returns why.
+func (s *Service) refuseAPIKeyRequest(ctx context.Context, keyID int64, reason error) error {
+	query := `INSERT INTO api_key_usage (api_key_id, day, refused) VALUES ($1, (now() AT TIME ZONE 'UTC')::date, 1)
+		ON CONFLICT (api_key_id, day) DO UPDATE SET refused = api_key_usage.refused + 1`
+	if _, err := s.db.ExecContext(ctx, query, keyID); err != nil {
+		return fmt.Errorf("could not upsert api key refused usage: %v", err)
+	}
+
+	return reason
+}
+
+// APIKeys of the instance with their usage today, revoked ones too, newest first. Admin only.
+func (s *Service) APIKeys(ctx context.Context) ([]APIKey, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT k.id, k.name, k.daily_quota, k.rate_limit, COALESCE(u.requests, 0), k.created_at, k.revoked_at
+		FROM api_keys k
+		LEFT JOIN api_key_usage u ON u.api_key_id = k.id AND u.day = (now() AT TIME ZONE 'UTC')::date
+		ORDER BY k.id DESC`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select api keys: %v", err)
+	}
+
+	defer rows.Close()
+
+	kk := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		var revokedAt sql.NullTime
+		if err = rows.Scan(&k.ID, &k.Name, &k.DailyQuota, &k.RateLimit, &k.UsedToday, &k.CreatedAt, &revokedAt); err != nil {
+			return nil, fmt.Errorf("could not scan api key: %v", err)
+		}
+
+		if revokedAt.Valid {
+			k.RevokedAt = &revokedAt.Time
+		}
+
+		kk = append(kk, k)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate api key rows: %v", err)
+	}
+
+	return kk, nil
+}
+
+// CreateAPIKey for a third-party tool. Only a hash of the key is stored,
+// so it can't be shown again. Admin only.
+func (s *Service) CreateAPIKey(ctx context.Context, in APIKeyInput) (CreateAPIKeyOutput, error) {
+	var out CreateAPIKeyOutput
+	if _, err := s.authAdmin(ctx); err != nil {
+		return out, err
+	}
+
+	if err := in.validate(); err != nil {
+		return out, err
+	}
+
+	key, err := randomToken()
+	if err != nil {
+		return out, err
+	}
+
+	query := `INSERT INTO api_keys (name, key_hash, daily_quota, rate_limit) VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+	err = s.db.QueryRowContext(ctx, query, in.Name, hashAPIKey(key), in.DailyQuota, in.RateLimit).Scan(&out.ID, &out.CreatedAt)
+	if err != nil {
+		return out, fmt.Errorf("could not insert api key: %v", err)
+	}
+
+	out.Name = in.Name
+	out.DailyQuota = in.DailyQuota
+	out.RateLimit = in.RateLimit
+	out.Key = key
+	return out, nil
+}
+
+// UpdateAPIKey replaces the name and limits of a key, taking effect on its
+// next request. Admin only.
+func (s *Service) UpdateAPIKey(ctx context.Context, keyID int64, in APIKeyInput) (APIKey, error) {
+	var k APIKey
+	if _, err := s.authAdmin(ctx); err != nil {
+		return k, err
+	}
+
+	if err := in.validate(); err != nil {
+		return k, err
+	}
+
+	var revokedAt sql.NullTime
+	query := `UPDATE api_keys SET name = $1, daily_quota = $2, rate_limit = $3
+		WHERE id = $4
+		RETURNING created_at, revoked_at,
+			COALESCE((SELECT requests FROM api_key_usage WHERE api_key_id = $4 AND day = (now() AT TIME ZONE 'UTC')::date), 0)`
+	err := s.db.QueryRowContext(ctx, query, in.Name, in.DailyQuota, in.RateLimit, keyID).Scan(&k.CreatedAt, &revokedAt, &k.UsedToday)
+	if err == sql.ErrNoRows {
+		return k, ErrAPIKeyNotFound
+	}
+
+	if err != nil {
+		return k, fmt.Errorf("could not update api key: %v", err)
+	}
+
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+
+	k.ID = keyID
+	k.Name = in.Name
+	k.DailyQuota = in.DailyQuota
+	k.RateLimit = in.RateLimit
+	return k, nil
+}
+
+// RevokeAPIKey for good. Its usage is kept for reporting. Admin only.
+func (s *Service) RevokeAPIKey(ctx context.Context, keyID int64) error {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return err
+	}
+
+	query := "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1"
+	res, err := s.db.ExecContext(ctx, query, keyID)
+	if err != nil {
+		return fmt.Errorf("could not revoke api key: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// APIKeyUsage of a key on the last given days it was used, newest first. Admin only.
+func (s *Service) APIKeyUsage(ctx context.Context, keyID int64, days int) ([]APIKeyUsage, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if days <= 0 || days > MaxAPIKeyUsageDays {
+		days = MaxAPIKeyUsageDays
+	}
+
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM api_keys WHERE id = $1)", keyID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("could not query select api key existence: %v", err)
+	}
+
+	if !exists {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	query := `SELECT to_char(day, 'YYYY-MM-DD'), requests, refused FROM api_key_usage
+		WHERE api_key_id = $1 AND day > (now() AT TIME ZONE 'UTC')::date - $2::int
+		ORDER BY day DESC`
+	rows, err := s.db.QueryContext(ctx, query, keyID, days)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select api key usage: %v", err)
+	}
+
+	defer rows.Close()
+
+	uu := []APIKeyUsage{}
+	for rows.Next() {
+		var u APIKeyUsage
+		if err = rows.Scan(&u.Day, &u.Requests, &u.Refused); err != nil {
+			return nil, fmt.Errorf("could not scan api key usage: %v", err)
+		}
+
+		uu = append(uu, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate api key usage rows: %v", err)
+	}
+
+	return uu, nil
+}
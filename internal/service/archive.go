@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/djomlaa/socnet/internal/archive"
+	"github.com/djomlaa/socnet/internal/validation"
+	"github.com/lib/pq"
+)
+
+// ArchiveReport tells what an archive import did, or would do on a dry run.
+type ArchiveReport struct {
+	DryRun          bool     `json:"dryRun"`
+	PostsImported   int      `json:"postsImported"`
+	PostsDuplicated int      `json:"postsDuplicated"`
+	PostsFailed     int      `json:"postsFailed"`
+	MediaImported   int      `json:"mediaImported"`
+	MediaSkipped    int      `json:"mediaSkipped"`
+	FollowsImported int      `json:"followsImported"`
+	FollowsSkipped  int      `json:"followsSkipped"`
+	EntriesSkipped  int      `json:"entriesSkipped"`
+	Errors          []string `json:"errors"`
+}
+
+// ImportArchive into the account of the given user keeping the original post dates.
+// Posts already imported are detected and not duplicated.
+// Imported posts are not fanned out since they are history, but their
+// creation is journaled so they count in the posts count of the user.
+// Media is imported from the files of the export, up to validation.MaxPostMedia
+// per post; media the export lacks or that is rejected is skipped and reported.
+// Media is stored before the posts are committed, and left unattached
+// if the import fails. On a dry run nothing is written.
+func (s *Service) ImportArchive(ctx context.Context, username string, a *archive.Archive, dryRun bool) (ArchiveReport, error) {
+	r := ArchiveReport{DryRun: dryRun, EntriesSkipped: a.Skipped, FollowsSkipped: a.UnresolvedFollows}
+
+	var uid int64
+	var requireAltText bool
+	query := "SELECT id, require_alt_text FROM users WHERE lower(username) = lower($1)"
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&uid, &requireAltText)
+	if err == sql.ErrNoRows {
+		return r, ErrUserNotFound
+	}
+
+	if err != nil {
+		return r, fmt.Errorf("could not query select user id: %v", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return r, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	var pids []int64
+	for i, p := range a.Posts {
+		var v validation.Validator
+		v.Content("content", p.Content, validation.MaxPostLength)
+		if p.SpoilerOf != nil {
+			v.Content("spoilerOf", *p.SpoilerOf, validation.MaxSpoilerLength)
+		}
+
+		if err = v.Err(); err != nil {
+			r.PostsFailed++
+			r.Errors = append(r.Errors, fmt.Sprintf("post %d from %s: %v", i+1, p.CreatedAt.Format("2006-01-02"), err))
+			continue
+		}
+
+		var exists bool
+		query = "SELECT EXISTS (SELECT 1 FROM posts WHERE user_id = $1 AND created_at = $2 AND content = $3)"
+		if err = tx.QueryRowContext(ctx, query, uid, p.CreatedAt, p.Content).Scan(&exists); err != nil {
+			return r, fmt.Errorf("could not query select imported post existence: %v", err)
+		}
+
+		if exists {
+			r.PostsDuplicated++
+			continue
+		}
+
+		r.PostsImported++
+		mediaIDs := s.importArchiveMedia(ctx, uid, p, requireAltText, dryRun, &r)
+		if dryRun {
+			continue
+		}
+
+		var pid int64
+		query = `INSERT INTO posts (user_id, content, spoiler_of, nsfw, created_at, license)
+			VALUES ($1, $2, $3, $4, $5, (SELECT default_license FROM users WHERE id = $1)) RETURNING id`
+		if err = tx.QueryRowContext(ctx, query, uid, p.Content, p.SpoilerOf, p.NSFW, p.CreatedAt).Scan(&pid); err != nil {
+			return r, fmt.Errorf("could not insert imported post: %v", err)
+		}
+
+		if _, err = s.attachMedia(ctx, tx, uid, pid, mediaIDs); err != nil {
+			return r, err
+		}
+
+		pids = append(pids, pid)
+
+		// Not published, so there is no fanout nor keyword alert.
+		created := PostCreated{Post: Post{ID: pid, UserID: uid, Content: p.Content, SpoilerOf: p.SpoilerOf, NSFW: p.NSFW, CreatedAt: p.CreatedAt}}
+		if err = s.recordEvent(ctx, tx, created); err != nil {
+			return r, err
+		}
+	}
+
+	// Inserted last so their sync ids are taken right before the commit,
+	// however long the import took, or delta sync could skip them.
+	query = "INSERT INTO timeline (user_id, post_id) SELECT $1, unnest($2::INT[])"
+	if _, err = tx.ExecContext(ctx, query, uid, pq.Array(pids)); err != nil {
+		return r, fmt.Errorf("could not insert imported timeline items: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return r, fmt.Errorf("could not commit archive import: %v", err)
+	}
+
+	for _, account := range a.Follows {
+		followee, ok := s.localUsername(account)
+		if !ok {
+			r.FollowsSkipped++
+			r.Errors = append(r.Errors, fmt.Sprintf("follow %s: account is not on this instance", account))
+			continue
+		}
+
+		if dryRun {
+			var exists bool
+			query = "SELECT EXISTS (SELECT 1 FROM users WHERE lower(username) = lower($1))"
+			if err = s.db.QueryRowContext(ctx, query, followee).Scan(&exists); err != nil {
+				return r, fmt.Errorf("could not query select user existence: %v", err)
+			}
+
+			if !exists {
+				r.FollowsSkipped++
+				r.Errors = append(r.Errors, fmt.Sprintf("follow %s: %v", account, ErrUserNotFound))
+				continue
+			}
+
+			r.FollowsImported++
+			continue
+		}
+
+		followed, err := s.follow(ctx, uid, followee)
+		if err == ErrUserNotFound || err == ErrForbiddenFollow || err == ErrRateLimited {
+			r.FollowsSkipped++
+			r.Errors = append(r.Errors, fmt.Sprintf("follow %s: %v", account, err))
+			continue
+		}
+
+		if err != nil {
+			return r, err
+		}
+
+		if followed {
+			r.FollowsImported++
+		} else {
+			r.FollowsSkipped++
+		}
+	}
+
+	return r, nil
+}
+
+// localUsername of an account address when it belongs to this instance.
+func (s *Service) localUsername(account string) (string, bool) {
+	account = strings.TrimPrefix(strings.TrimSpace(account), "@")
+	i := strings.LastIndex(account, "@")
+	if i == -1 {
+		return account, true
+	}
+
+	u, err := url.Parse(s.origin)
+	if err != nil || !strings.EqualFold(account[i+1:], u.Hostname()) {
+		return "", false
+	}
+
+	return account[:i], true
+}
+
+// importArchiveMedia stores the media of an imported post from the export and
+// returns their ids. Media that can't be imported is skipped and reported.
+// On a dry run nothing is stored.
+func (s *Service) importArchiveMedia(ctx context.Context, uid int64, p archive.Post, requireAltText, dryRun bool, r *ArchiveReport) []int64 {
+	var ids []int64
+	for i, am := range p.Media {
+		skip := func(reason string) {
+			r.MediaSkipped++
+			r.Errors = append(r.Errors, fmt.Sprintf("media %s of post from %s: %s", am.Path, p.CreatedAt.Format("2006-01-02"), reason))
+		}
+
+		if i >= validation.MaxPostMedia {
+			skip("too many media")
+			continue
+		}
+
+		if am.File == nil {
+			skip("not in the archive")
+			continue
+		}
+
+		var in UploadMediaInput
+		if d := strings.TrimSpace(am.Description); d != "" {
+			in.AltText = &d
+		}
+
+		if in.AltText == nil && requireAltText {
+			skip("alt text required")
+			continue
+		}
+
+		if err := validateUploadMedia(&in); err != nil {
+			skip(err.Error())
+			continue
+		}
+
+		if dryRun {
+			r.MediaImported++
+			continue
+		}
+
+		rc, err := am.File.Open()
+		if err != nil {
+			skip(fmt.Sprintf("could not open: %v", err))
+			continue
+		}
+
+		m, err := s.storeMedia(ctx, uid, io.LimitReader(rc, MaxMediaBytes), in)
+		rc.Close()
+		if err != nil {
+			skip(err.Error())
+			continue
+		}
+
+		ids = append(ids, m.ID)
+		r.MediaImported++
+	}
+
+	return ids
+}
@@ -0,0 +1,102 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/archive"
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/djomlaa/socnet/internal/testutil"
+)
+
+func TestImportArchiveSlowTxCounted(t *testing.T) {
+	s, db := testutil.NewService(t)
+
+	testutil.CreateUser(t, db, "alice")
+	bob := testutil.CreateUser(t, db, "bob")
+
+	// The second imported post holds the import tx open well past the time
+	// other events take to be projected.
+	const slow = 20 * time.Second
+	for _, query := range []string{
+		fmt.Sprintf(`CREATE FUNCTION slow_import() RETURNS trigger AS $$
+		BEGIN
+			IF NEW.content = 'slow' THEN
+				PERFORM pg_sleep(%d);
+			END IF;
+			RETURN NEW;
+		END
+		$$ LANGUAGE plpgsql`, int(slow.Seconds())),
+		"CREATE TRIGGER slow_import BEFORE INSERT ON posts FOR EACH ROW EXECUTE FUNCTION slow_import()",
+	} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("could not create slow import trigger: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.ProjectUserStats(ctx)
+
+	now := time.Now()
+	a := &archive.Archive{Posts: []archive.Post{
+		{Content: "fast", CreatedAt: now.Add(-2 * time.Hour)},
+		{Content: "slow", CreatedAt: now.Add(-time.Hour)},
+	}}
+	imported := make(chan error, 1)
+	go func() {
+		_, err := s.ImportArchive(ctx, "alice", a, false)
+		imported <- err
+	}()
+
+	// The first post is journaled once the second one sleeps.
+	testutil.Eventually(t, 10*time.Second, func() error {
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM pg_stat_activity WHERE wait_event = 'PgSleep'").Scan(&n); err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return fmt.Errorf("import not sleeping yet")
+		}
+
+		return nil
+	})
+
+	// Journaled after the import, and committed way before it.
+	if _, err := s.CreatePost(testutil.AuthContext(bob), service.CreatePostInput{Content: "hello"}); err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	expectPosts := func(username string, want int) {
+		t.Helper()
+
+		testutil.Eventually(t, projectionTimeout, func() error {
+			u, err := s.User(context.Background(), username)
+			if err != nil {
+				return err
+			}
+
+			if u.PostsCount != want {
+				return fmt.Errorf("%s has %d posts, want %d", username, u.PostsCount, want)
+			}
+
+			return nil
+		})
+	}
+
+	expectPosts("bob", 1)
+
+	select {
+	case err := <-imported:
+		if err != nil {
+			t.Fatalf("could not import archive: %v", err)
+		}
+	case <-time.After(2 * slow):
+		t.Fatal("archive import did not finish")
+	}
+
+	expectPosts("alice", 2)
+}
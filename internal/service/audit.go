@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// Audited admin actions.
+const (
+	AuditActionVerify             = "user.verify"
+	AuditActionUnverify           = "user.unverify"
+	AuditActionPinCommunityPost   = "community.pin_post"
+	AuditActionUnpinCommunityPost = "community.unpin_post"
+	AuditActionImpersonate        = "user.impersonate"
+	AuditActionProvision          = "user.provision"
+	AuditActionSSOProvision       = "user.sso_provision"
+	AuditActionSSORole            = "user.sso_role"
+	AuditActionSuspend            = "user.suspend"
+	AuditActionBan                = "user.ban"
+	AuditActionUnsuspend          = "user.unsuspend"
+	// AuditActionInfectedUpload is recorded by the system, with the
+	// uploader as actor, when an upload is rejected as malware.
+	AuditActionInfectedUpload = "upload.infected"
+)
+
+// AuditEntry records an action an admin or moderator took on a user,
+// or an incident moderators should know about.
+type AuditEntry struct {
+	ID     int64   `json:"id"`
+	Actor  *string `json:"actor"`
+	Action string  `json:"action"`
+	Target *string `json:"target"`
+	// Details depend on the action.
+	Details   json.RawMessage `json:"details"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// audit records an admin or moderator action. Pass the tx of the action
+// so the entry is only kept if the action is.
+func (s *Service) audit(ctx context.Context, tx execer, actorID int64, action string, targetUserID int64, details interface{}) error {
+	b, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("could not marshal audit details: %v", err)
+	}
+
+	query := "INSERT INTO audit_log (actor_id, action, target_user_id, details) VALUES ($1, $2, $3, $4)"
+	if _, err = tx.ExecContext(ctx, query, actorID, action, targetUserID, b); err != nil {
+		return fmt.Errorf("could not insert audit log entry: %v", err)
+	}
+
+	return nil
+}
+
+// AuditLog of admin and moderator actions, newest first with backward pagination.
+// Only admins can read it.
+func (s *Service) AuditLog(ctx context.Context, last int, before int64) ([]AuditEntry, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	last = validation.PageSize(last)
+	query, args, err := buildQuery(`
+		SELECT a.id, actor.username, a.action, target.username, a.details, a.created_at
+		FROM audit_log a
+		LEFT JOIN users actor ON a.actor_id = actor.id
+		LEFT JOIN users target ON a.target_user_id = target.id
+		{{if .before}}WHERE a.id < @before{{end}}
+		ORDER BY a.id DESC
+		LIMIT @last`, map[string]interface{}{
+		"before": before,
+		"last":   last,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build audit log sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select audit log: %v", err)
+	}
+
+	defer rows.Close()
+
+	aa := make([]AuditEntry, 0, last)
+	for rows.Next() {
+		var a AuditEntry
+		var details []byte
+		if err = rows.Scan(&a.ID, &a.Actor, &a.Action, &a.Target, &details, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan audit log entry: %v", err)
+		}
+
+		a.Details = details
+		aa = append(aa, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate audit log rows: %v", err)
+	}
+
+	return aa, nil
+}
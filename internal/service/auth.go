@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/djomlaa/socnet/internal/validation"
 	"strconv"
 	"strings"
 	"time"
@@ -13,52 +14,189 @@ import (
 const (
 	// TokenLifespan until tokens are valid
 	TokenLifespan = time.Hour * 24 * 14
+	// SessionTouchInterval throttles how often a session last-used time is refreshed
+	SessionTouchInterval = time.Minute * 5
 	// KeyAuthUserID to use in context
 	KeyAuthUserID key = "auth_user_id"
+	// KeySessionID to use in context
+	KeySessionID key = "session_id"
+	// KeyClientInfo to use in context
+	KeyClientInfo key = "client_info"
+	// KeyImpersonatorID to use in context when an admin acts as the auth user
+	KeyImpersonatorID key = "impersonator_id"
 )
 
 var (
 	// ErrUnauthenticated used when there is no autheniticated user in context
 	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrInvalidToken used when the token payload is malformed
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrSessionRevoked used when the token session was revoked
+	ErrSessionRevoked = errors.New("session revoked")
 )
 
 type key string
 
-//LoginOutput response
+// ClientInfo describes the device a request comes from.
+// It is recorded on the session when logging in and on use.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// AuthSession the token belongs to.
+type AuthSession struct {
+	UserID    int64
+	SessionID int64
+	// ImpersonatorID is the admin acting as the user, if any.
+	ImpersonatorID int64
+	// ConsentRequired until the user accepts the current terms version.
+	// Never for impersonated sessions.
+	ConsentRequired bool
+	// Suspended until the suspension of the user ends.
+	Suspended bool
+	// Banned when the user is suspended for good.
+	Banned bool
+}
+
+// LoginOutput response
 type LoginOutput struct {
 	Token     string    `json:"token,omitempty"`
 	ExpiresAt time.Time `json:"expires_at,omitempty"`
 	AuthUser  User      `json:"auth_user,omitempty"`
 }
 
-// AuthUserID from Token
-func (s *Service) AuthUserID(token string) (int64, error) {
+// AuthUserID from Token.
+// The token must belong to a session that has not been revoked.
+func (s *Service) AuthUserID(ctx context.Context, token string) (int64, error) {
+	as, err := s.AuthSession(ctx, token)
+	return as.UserID, err
+}
+
+// AuthSession from Token.
+// The token must belong to a session that has not been revoked nor expired,
+// of a user that was not deactivated. Suspended and banned users still
+// authenticate, so they can manage their account.
+// The session and user last seen times are refreshed at most once every SessionTouchInterval.
+func (s *Service) AuthSession(ctx context.Context, token string) (AuthSession, error) {
+	var as AuthSession
 
 	str, err := s.codec.DecodeToString(token)
 	if err != nil {
-		return 0, fmt.Errorf("could not decode token: %v", err)
+		return as, fmt.Errorf("could not decode token: %v", err)
+	}
+
+	parts := strings.Split(str, ".")
+	if len(parts) != 2 {
+		return as, ErrInvalidToken
+	}
+
+	as.UserID, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return as, fmt.Errorf("could not parse auth user id from token: %v", err)
+	}
+
+	as.SessionID, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return as, fmt.Errorf("could not parse session id from token: %v", err)
+	}
+
+	var lastUsedAt time.Time
+	var impersonatorID sql.NullInt64
+	var consented bool
+	query := `SELECT sessions.last_used_at, sessions.impersonator_id,
+		$3 = '' OR EXISTS (SELECT 1 FROM consents WHERE user_id = $2 AND version = $3),
+		users.suspended_at IS NOT NULL AND users.suspended_until IS NOT NULL AND users.suspended_until > now(),
+		users.suspended_at IS NOT NULL AND users.suspended_until IS NULL
+		FROM sessions
+		INNER JOIN users ON users.id = sessions.user_id
+		WHERE sessions.id = $1 AND sessions.user_id = $2 AND sessions.revoked_at IS NULL
+		AND (sessions.expires_at IS NULL OR sessions.expires_at > now())
+		AND users.deactivated_at IS NULL`
+	err = s.db.QueryRowContext(ctx, query, as.SessionID, as.UserID, s.Settings().TermsVersion).
+		Scan(&lastUsedAt, &impersonatorID, &consented, &as.Suspended, &as.Banned)
+	if err == sql.ErrNoRows {
+		return as, ErrSessionRevoked
+	}
+
+	if err != nil {
+		return as, fmt.Errorf("could not query select session: %v", err)
+	}
+
+	as.ImpersonatorID = impersonatorID.Int64
+	as.ConsentRequired = !consented && as.ImpersonatorID == 0
+
+	if time.Since(lastUsedAt) >= SessionTouchInterval {
+		if err = s.touchSession(ctx, as); err != nil {
+			return as, err
+		}
 	}
 
-	i, err := strconv.ParseInt(str, 10, 64)
+	return as, nil
+}
+
+// touchSession refreshes the session last used time and device info, and the
+// user last seen time and daily activity unless an admin is impersonating them.
+func (s *Service) touchSession(ctx context.Context, as AuthSession) error {
+	ci, _ := ctx.Value(KeyClientInfo).(ClientInfo)
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, fmt.Errorf("could not parse auth user id from token: %v", err)
+		return fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	query := `UPDATE sessions SET last_used_at = now(),
+		user_agent = COALESCE(NULLIF($1, ''), user_agent),
+		ip = COALESCE(NULLIF($2, ''), ip)
+		WHERE id = $3`
+	if _, err = tx.ExecContext(ctx, query, ci.UserAgent, ci.IP, as.SessionID); err != nil {
+		return fmt.Errorf("could not update session last used time: %v", err)
 	}
-	return i, nil
+
+	if as.ImpersonatorID == 0 {
+		query = "UPDATE users SET last_seen_at = now() WHERE id = $1"
+		if _, err = tx.ExecContext(ctx, query, as.UserID); err != nil {
+			return fmt.Errorf("could not update user last seen time: %v", err)
+		}
+
+		if err = recordActivity(ctx, tx, as.UserID); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit session touch: %v", err)
+	}
+
+	return nil
 }
 
-//Login insecurely
-func (s *Service) Login(ctx context.Context, email string) (LoginOutput, error) {
+// Login insecurely, by email alone, unless LDAP is configured,
+// in which case the password is checked with a bind to the directory.
+func (s *Service) Login(ctx context.Context, email, password string) (LoginOutput, error) {
 
 	var out LoginOutput
 
 	email = strings.TrimSpace(email)
-	if !reEmail.MatchString(email) {
-		return out, ErrInvalidEmail
+	var v validation.Validator
+	v.Email("email", email)
+	if err := v.Err(); err != nil {
+		return out, err
+	}
+
+	if s.ldap != nil {
+		return s.ldapLogin(ctx, email, password)
+	}
+
+	if s.oidc != nil {
+		return out, ErrSSORequired
 	}
 
 	var avatar sql.NullString
-	query := "SELECT id, username, avatar FROM users WHERE email = $1"
-	err := s.db.QueryRowContext(ctx, query, email).Scan(&out.AuthUser.ID, &out.AuthUser.Username, &avatar)
+	query := "SELECT id, username, avatar, verified FROM users WHERE email = $1 AND deactivated_at IS NULL"
+	err := s.db.QueryRowContext(ctx, query, email).Scan(&out.AuthUser.ID, &out.AuthUser.Username, &avatar, &out.AuthUser.Verified)
 
 	if err == sql.ErrNoRows {
 		return out, ErrUserNotFound
@@ -73,15 +211,34 @@ func (s *Service) Login(ctx context.Context, email string) (LoginOutput, error)
 		out.AuthUser.AvatarURL = &avatarURL
 	}
 
-	out.Token, err = s.codec.EncodeToString(strconv.FormatInt(out.AuthUser.ID, 10))
+	err = s.startSession(ctx, &out)
+	return out, err
+}
+
+// startSession of out.AuthUser on the device of the request and fills out its token.
+func (s *Service) startSession(ctx context.Context, out *LoginOutput) error {
+	ci, _ := ctx.Value(KeyClientInfo).(ClientInfo)
+
+	var sid int64
+	query := "INSERT INTO sessions (user_id, user_agent, ip) VALUES ($1, NULLIF($2, ''), NULLIF($3, '')) RETURNING id"
+	if err := s.db.QueryRowContext(ctx, query, out.AuthUser.ID, ci.UserAgent, ci.IP).Scan(&sid); err != nil {
+		return fmt.Errorf("could not insert session: %v", err)
+	}
+
+	if err := recordActivity(ctx, s.db, out.AuthUser.ID); err != nil {
+		return err
+	}
+
+	token, err := s.codec.EncodeToString(strconv.FormatInt(out.AuthUser.ID, 10) + "." + strconv.FormatInt(sid, 10))
 
 	if err != nil {
-		return out, fmt.Errorf("could not create token: %v", err)
+		return fmt.Errorf("could not create token: %v", err)
 	}
 
+	out.Token = token
 	out.ExpiresAt = time.Now().Add(TokenLifespan)
 
-	return out, nil
+	return nil
 }
 
 // AuthUser from context
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path"
+
+	"github.com/djomlaa/socnet/internal/validation"
+	"github.com/lib/pq"
+)
+
+// AutoDeletePolicy of a user. Posts older than AfterDays are deleted,
+// except pinned posts and posts the author bookmarked. Nil disables it.
+type AutoDeletePolicy struct {
+	AfterDays *int `json:"afterDays"`
+}
+
+// AutoDeletePreview lists the posts the next auto delete run would delete.
+type AutoDeletePreview struct {
+	Count   int     `json:"count"`
+	PostIDs []int64 `json:"postIds"`
+}
+
+// AutoDeletePolicy of the authenticated user.
+func (s *Service) AutoDeletePolicy(ctx context.Context) (AutoDeletePolicy, error) {
+	var out AutoDeletePolicy
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	query := "SELECT auto_delete_after_days FROM users WHERE id = $1"
+	err := s.db.QueryRowContext(ctx, query, uid).Scan(&out.AfterDays)
+	if err == sql.ErrNoRows {
+		return out, ErrUserNotFound
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not query select auto delete policy: %v", err)
+	}
+
+	return out, nil
+}
+
+// SetAutoDeletePolicy of the authenticated user.
+func (s *Service) SetAutoDeletePolicy(ctx context.Context, in AutoDeletePolicy) (AutoDeletePolicy, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return in, ErrUnauthenticated
+	}
+
+	if in.AfterDays != nil {
+		var v validation.Validator
+		v.Check(*in.AfterDays > 0 && *in.AfterDays <= validation.MaxAutoDeleteDays, "afterDays",
+			fmt.Sprintf("must be between 1 and %d", validation.MaxAutoDeleteDays))
+		if err := v.Err(); err != nil {
+			return in, err
+		}
+	}
+
+	query := "UPDATE users SET auto_delete_after_days = $1 WHERE id = $2"
+	if _, err := s.db.ExecContext(ctx, query, in.AfterDays, uid); err != nil {
+		return in, fmt.Errorf("could not update auto delete policy: %v", err)
+	}
+
+	return in, nil
+}
+
+// PreviewAutoDelete returns the posts of the authenticated user
+// that would be deleted by the next auto delete run.
+func (s *Service) PreviewAutoDelete(ctx context.Context) (AutoDeletePreview, error) {
+	var out AutoDeletePreview
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	ids, err := s.autoDeletablePosts(ctx, s.db, uid)
+	if err != nil {
+		return out, err
+	}
+
+	out.Count = len(ids)
+	out.PostIDs = ids
+	return out, nil
+}
+
+// AutoDeletePosts deletes the posts past their author auto delete policy
+// and returns how many were, or would be on a dry run, deleted.
+func (s *Service) AutoDeletePosts(ctx context.Context, dryRun bool) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	ids, err := s.autoDeletablePosts(ctx, tx, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	if dryRun || len(ids) == 0 {
+		return len(ids), nil
+	}
+
+	deleted, files, err := s.deletePosts(ctx, tx, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not commit auto delete posts: %v", err)
+	}
+
+	for _, e := range deleted {
+		s.publish(e)
+	}
+
+	var paths []string
+	for _, id := range ids {
+		paths = append(paths, postPaths(id)...)
+	}
+
+	for _, f := range files {
+		paths = append(paths, "/img/media/"+f)
+		if err = os.Remove(path.Join(mediaDir, f)); err != nil && !os.IsNotExist(err) {
+			log.Printf("could not remove media file: %v\n", err)
+		}
+	}
+
+	s.purge(paths...)
+
+	return len(ids), nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// autoDeletablePosts returns the ids of the posts past their author auto delete policy.
+// When uid is not zero only the posts of that user are returned.
+func (s *Service) autoDeletablePosts(ctx context.Context, db queryer, uid int64) ([]int64, error) {
+	query, args, err := buildQuery(`
+		SELECT p.id FROM posts p
+		INNER JOIN users u ON p.user_id = u.id
+		WHERE u.auto_delete_after_days IS NOT NULL
+		AND p.created_at < now() - make_interval(days => u.auto_delete_after_days)
+		AND NOT p.pinned
+		AND NOT EXISTS (SELECT 1 FROM post_bookmarks b WHERE b.post_id = p.id AND b.user_id = p.user_id)
+		{{if .uid}}AND p.user_id = @uid{{end}}
+		ORDER BY p.id`, map[string]interface{}{
+		"uid": uid,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build auto deletable posts sql query: %v", err)
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select auto deletable posts: %v", err)
+	}
+
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("could not scan auto deletable post: %v", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate auto deletable post rows: %v", err)
+	}
+
+	return ids, nil
+}
+
+// deletePosts deletes the posts along with their comments, likes and timeline items,
+// noting the removal of the items for delta sync, and journals their deletion. It returns the events to publish and the media
+// filenames to remove from disk once the tx commits.
+func (s *Service) deletePosts(ctx context.Context, tx *sql.Tx, ids []int64) ([]Event, []string, error) {
+	for _, query := range []string{
+		"DELETE FROM comment_likes WHERE comment_id IN (SELECT id FROM comments WHERE post_id = ANY($1::INT[]))",
+		"DELETE FROM comments WHERE post_id = ANY($1::INT[])",
+		"DELETE FROM post_likes WHERE post_id = ANY($1::INT[])",
+		`WITH removed AS (DELETE FROM timeline WHERE post_id = ANY($1::INT[]) RETURNING id, user_id)
+		INSERT INTO sync_removals (user_id, resource, item_id) SELECT user_id, 'timeline', id FROM removed`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, pq.Array(ids)); err != nil {
+			return nil, nil, fmt.Errorf("could not delete posts dependents: %v", err)
+		}
+	}
+
+	var files []string
+	query := "DELETE FROM media WHERE post_id = ANY($1::INT[]) RETURNING filename, thumbnail"
+	rows, err := tx.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not delete posts media: %v", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var f string
+		var thumbnail *string
+		if err = rows.Scan(&f, &thumbnail); err != nil {
+			return nil, nil, fmt.Errorf("could not scan deleted media: %v", err)
+		}
+
+		files = append(files, f)
+		if thumbnail != nil {
+			files = append(files, *thumbnail)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("could not iterate deleted media rows: %v", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, "DELETE FROM posts WHERE id = ANY($1::INT[]) RETURNING id, user_id", pq.Array(ids))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not delete posts: %v", err)
+	}
+
+	defer rows.Close()
+
+	var deleted []PostDeleted
+	for rows.Next() {
+		var e PostDeleted
+		if err = rows.Scan(&e.PostID, &e.UserID); err != nil {
+			return nil, nil, fmt.Errorf("could not scan deleted post: %v", err)
+		}
+
+		deleted = append(deleted, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("could not iterate deleted post rows: %v", err)
+	}
+
+	ee := make([]Event, 0, len(deleted))
+	for _, e := range deleted {
+		if err = s.recordEvent(ctx, tx, e); err != nil {
+			return nil, nil, err
+		}
+
+		ee = append(ee, e)
+	}
+
+	return ee, files, nil
+}
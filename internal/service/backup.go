@@ -0,0 +1,643 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// BackupVersion of the archives written by Backup.
+	BackupVersion = 1
+	// backupBatch is how many rows of a table go in each archive entry,
+	// and are inserted at once on restore.
+	backupBatch = 1000
+	// backupManifestName is the first entry of the archive.
+	backupManifestName = "manifest.json"
+)
+
+// ErrSchemaExists used when restoring into a database schema that already exists.
+var ErrSchemaExists = errors.New("database schema already exists")
+
+// backupMediaDirs are the directories of the media files a backup can hold,
+// by the name of their directory in the archive.
+var backupMediaDirs = map[string]string{
+	"avatars": avatarsDir,
+	"media":   mediaDir,
+	"emojis":  emojisDir,
+}
+
+// BackupManifest describes the content of a backup.
+type BackupManifest struct {
+	Version   int           `json:"version"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Tables    []BackupTable `json:"tables"`
+	// Media are the files the rows reference, whether or not they are
+	// in the backup, so restores can report the missing ones.
+	Media []BackupMedia `json:"media"`
+	// MediaIncluded reports whether the files are in the backup.
+	MediaIncluded bool `json:"mediaIncluded"`
+}
+
+// BackupTable in the order it is restored, so referenced tables come first.
+// Generated columns are left out.
+type BackupTable struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Rows    int      `json:"rows,omitempty"`
+	// key columns the rows are read ordered by, so rows referencing others
+	// of the same table, like replies, come after them.
+	key []string
+}
+
+// BackupMedia file. Path is relative to the media directories, like avatars/1.jpg.
+type BackupMedia struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Backup writes a gzipped tar archive of every table of the database schema,
+// and of the media files the rows reference when withMedia is set. Rows are
+// read from a single snapshot, so they are consistent, and files after it.
+// The first entry is the manifest, followed by batches of rows as JSON arrays
+// under tables/, then the files under media/. Row counts are only known once
+// written, so the returned manifest has them but the archived one doesn't.
+func (s *Service) Backup(ctx context.Context, w io.Writer, withMedia bool) (BackupManifest, error) {
+	m := BackupManifest{Version: BackupVersion, CreatedAt: time.Now(), MediaIncluded: withMedia}
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return m, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	if m.Tables, err = backupTables(ctx, tx); err != nil {
+		return m, err
+	}
+
+	if m.Media, err = backupMedia(ctx, tx); err != nil {
+		return m, err
+	}
+
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return m, fmt.Errorf("could not marshal backup manifest: %v", err)
+	}
+
+	if err = writeTarEntry(tw, backupManifestName, b, m.CreatedAt); err != nil {
+		return m, err
+	}
+
+	for i := range m.Tables {
+		if m.Tables[i].Rows, err = backupRows(ctx, tx, tw, m.Tables[i], m.CreatedAt); err != nil {
+			return m, err
+		}
+	}
+
+	// The snapshot is no longer needed, and files are read from disk.
+	if err = tx.Commit(); err != nil {
+		return m, fmt.Errorf("could not commit backup: %v", err)
+	}
+
+	if withMedia {
+		for _, f := range m.Media {
+			if err = backupFile(tw, f); err != nil {
+				return m, err
+			}
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return m, fmt.Errorf("could not close backup archive: %v", err)
+	}
+
+	if err = zw.Close(); err != nil {
+		return m, fmt.Errorf("could not close backup compression: %v", err)
+	}
+
+	return m, nil
+}
+
+// backupTables of the current schema, referenced tables first, with their columns.
+func backupTables(ctx context.Context, tx *sql.Tx) ([]BackupTable, error) {
+	query := `SELECT c.relname, COALESCE(string_agg(DISTINCT r.relname, ',') FILTER (WHERE r.oid <> c.oid), '')
+		FROM pg_class c
+		LEFT JOIN pg_constraint fk ON fk.conrelid = c.oid AND fk.contype = 'f'
+		LEFT JOIN pg_class r ON r.oid = fk.confrelid
+		WHERE c.relnamespace = current_schema()::regnamespace AND c.relkind = 'r'
+		GROUP BY c.relname
+		ORDER BY c.relname`
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select tables: %v", err)
+	}
+
+	defer rows.Close()
+
+	var names []string
+	deps := map[string][]string{}
+	for rows.Next() {
+		var name, refs string
+		if err = rows.Scan(&name, &refs); err != nil {
+			return nil, fmt.Errorf("could not scan table: %v", err)
+		}
+
+		names = append(names, name)
+		if refs != "" {
+			deps[name] = strings.Split(refs, ",")
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate table rows: %v", err)
+	}
+
+	order, err := sortTables(names, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	tt := make([]BackupTable, len(order))
+	for i, name := range order {
+		tt[i].Name = name
+		if tt[i].Columns, tt[i].key, err = backupColumns(ctx, tx, name); err != nil {
+			return nil, err
+		}
+	}
+
+	return tt, nil
+}
+
+// sortTables so each one comes after the ones it references.
+func sortTables(names []string, deps map[string][]string) ([]string, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := map[string]int{}
+	order := make([]string, 0, len(names))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("could not order tables: %s references itself through others", name)
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		for _, dep := range deps[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// backupColumns of the table but generated ones and transaction ids, which
+// only mean something on the database that took them, and its primary key columns.
+func backupColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, []string, error) {
+	query := `SELECT a.attname, array_position(i.indkey::int2[], a.attnum) FROM pg_attribute a
+		LEFT JOIN pg_index i ON i.indrelid = a.attrelid AND i.indisprimary
+		WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped AND a.attgenerated = ''
+			AND a.atttypid NOT IN ('xid8'::regtype, 'pg_snapshot'::regtype)
+		ORDER BY a.attnum`
+	rows, err := tx.QueryContext(ctx, query, pq.QuoteIdentifier(table))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not query select %s columns: %v", table, err)
+	}
+
+	defer rows.Close()
+
+	var cols []string
+	key := map[int64]string{}
+	for rows.Next() {
+		var col string
+		var keyPosition sql.NullInt64
+		if err = rows.Scan(&col, &keyPosition); err != nil {
+			return nil, nil, fmt.Errorf("could not scan column: %v", err)
+		}
+
+		cols = append(cols, col)
+		if keyPosition.Valid {
+			key[keyPosition.Int64] = col
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("could not iterate column rows: %v", err)
+	}
+
+	keyCols := make([]string, len(key))
+	for pos, col := range key {
+		keyCols[pos-1] = col
+	}
+
+	return cols, keyCols, nil
+}
+
+// backupMedia lists the files referenced by avatars, media and custom emojis,
+// skipping the ones missing from disk.
+func backupMedia(ctx context.Context, tx *sql.Tx) ([]BackupMedia, error) {
+	query := `SELECT 'avatars', avatar FROM users WHERE avatar IS NOT NULL
+		UNION SELECT 'media', filename FROM media
+		UNION SELECT 'media', thumbnail FROM media WHERE thumbnail IS NOT NULL
+		UNION SELECT 'emojis', filename FROM custom_emojis
+		ORDER BY 1, 2`
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select media files: %v", err)
+	}
+
+	defer rows.Close()
+
+	mm := []BackupMedia{}
+	for rows.Next() {
+		var dir, filename string
+		if err = rows.Scan(&dir, &filename); err != nil {
+			return nil, fmt.Errorf("could not scan media file: %v", err)
+		}
+
+		fi, err := os.Stat(path.Join(backupMediaDirs[dir], filename))
+		if os.IsNotExist(err) {
+			log.Printf("media file %s/%s is missing, skipping it\n", dir, filename)
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("could not stat media file: %v", err)
+		}
+
+		mm = append(mm, BackupMedia{Path: path.Join(dir, filename), Size: fi.Size()})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate media file rows: %v", err)
+	}
+
+	return mm, nil
+}
+
+// backupRows writes the rows of the table to the archive in batches.
+func backupRows(ctx context.Context, tx *sql.Tx, tw *tar.Writer, t BackupTable, modTime time.Time) (int, error) {
+	cols := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		cols[i] = pq.QuoteIdentifier(col)
+	}
+
+	query := fmt.Sprintf("SELECT row_to_json(t)::text FROM (SELECT %s FROM %s", strings.Join(cols, ", "), pq.QuoteIdentifier(t.Name))
+	if len(t.key) != 0 {
+		key := make([]string, len(t.key))
+		for i, col := range t.key {
+			key[i] = pq.QuoteIdentifier(col)
+		}
+		query += " ORDER BY " + strings.Join(key, ", ")
+	}
+	query += ") t"
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("could not query select %s rows: %v", t.Name, err)
+	}
+
+	defer rows.Close()
+
+	var n, batch int
+	var buf strings.Builder
+	flush := func() error {
+		if buf.Len() == 0 {
+			return nil
+		}
+
+		buf.WriteString("]")
+		name := fmt.Sprintf("tables/%s/%06d.json", t.Name, batch)
+		err := writeTarEntry(tw, name, []byte(buf.String()), modTime)
+		buf.Reset()
+		batch++
+		return err
+	}
+
+	for rows.Next() {
+		var row string
+		if err = rows.Scan(&row); err != nil {
+			return n, fmt.Errorf("could not scan %s row: %v", t.Name, err)
+		}
+
+		if buf.Len() == 0 {
+			buf.WriteString("[")
+		} else {
+			buf.WriteString(",\n")
+		}
+		buf.WriteString(row)
+
+		if n++; n%backupBatch == 0 {
+			if err = flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return n, fmt.Errorf("could not iterate %s rows: %v", t.Name, err)
+	}
+
+	return n, flush()
+}
+
+func backupFile(tw *tar.Writer, m BackupMedia) error {
+	dir, filename := path.Split(m.Path)
+	f, err := os.Open(path.Join(backupMediaDirs[path.Clean(dir)], filename))
+	if err != nil {
+		return fmt.Errorf("could not open media file: %v", err)
+	}
+
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat media file: %v", err)
+	}
+
+	// Files are written once, so their size is that of the manifest.
+	hdr := &tar.Header{Name: "media/" + m.Path, Mode: 0644, Size: m.Size, ModTime: fi.ModTime()}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("could not write media file header: %v", err)
+	}
+
+	if _, err = io.CopyN(tw, f, m.Size); err != nil {
+		return fmt.Errorf("could not write media file %s: %v", m.Path, err)
+	}
+
+	return nil
+}
+
+func writeTarEntry(tw *tar.Writer, name string, b []byte, modTime time.Time) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(b)), ModTime: modTime}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("could not write %s header: %v", name, err)
+	}
+
+	if _, err := tw.Write(b); err != nil {
+		return fmt.Errorf("could not write %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// Restore a backup written by Backup into a fresh instance. The database
+// schema must not exist yet: it is created with the given schema DDL and
+// filled in a single transaction, so a failed restore leaves nothing behind.
+// Media files in the backup are written afterwards, and the referenced
+// ones still missing from disk are logged, to be copied over by hand.
+func (s *Service) Restore(ctx context.Context, r io.Reader, schema string) (BackupManifest, error) {
+	var m BackupManifest
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return m, fmt.Errorf("could not read backup compression: %v", err)
+	}
+
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	hdr, err := tr.Next()
+	if err != nil {
+		return m, fmt.Errorf("could not read backup archive: %v", err)
+	}
+
+	if hdr.Name != backupManifestName {
+		return m, fmt.Errorf("invalid backup: %s is not the first entry", backupManifestName)
+	}
+
+	if err = json.NewDecoder(tr).Decode(&m); err != nil {
+		return m, fmt.Errorf("could not decode backup manifest: %v", err)
+	}
+
+	if m.Version != BackupVersion {
+		return m, fmt.Errorf("unsupported backup version %d", m.Version)
+	}
+
+	tables := map[string]*BackupTable{}
+	for i := range m.Tables {
+		tables[m.Tables[i].Name] = &m.Tables[i]
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return m, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	if err = restoreSchema(ctx, tx, schema); err != nil {
+		return m, err
+	}
+
+	// Tables come first in the archive, then media files.
+	for {
+		if hdr, err = tr.Next(); err == io.EOF || (err == nil && strings.HasPrefix(hdr.Name, "media/")) {
+			break
+		}
+
+		if err != nil {
+			return m, fmt.Errorf("could not read backup archive: %v", err)
+		}
+
+		parts := strings.Split(hdr.Name, "/")
+		t, ok := tables[parts[len(parts)-2]]
+		if len(parts) != 3 || parts[0] != "tables" || !ok {
+			return m, fmt.Errorf("invalid backup entry %s", hdr.Name)
+		}
+
+		var n int
+		if n, err = restoreRows(ctx, tx, *t, tr); err != nil {
+			return m, err
+		}
+
+		t.Rows += n
+	}
+
+	if err = restoreSequences(ctx, tx, m.Tables); err != nil {
+		return m, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return m, fmt.Errorf("could not commit restore: %v", err)
+	}
+
+	for ; err == nil; hdr, err = tr.Next() {
+		if err = restoreFile(tr, hdr); err != nil {
+			return m, err
+		}
+	}
+
+	if err != io.EOF {
+		return m, fmt.Errorf("could not read backup archive: %v", err)
+	}
+
+	for _, f := range m.Media {
+		dir, filename := path.Split(f.Path)
+		if _, err = os.Stat(path.Join(backupMediaDirs[path.Clean(dir)], filename)); os.IsNotExist(err) {
+			log.Printf("media file %s is missing\n", f.Path)
+		}
+	}
+
+	return m, nil
+}
+
+// restoreSchema creates the schema, which must not exist yet, and empties
+// the tables from the sample data the schema comes with.
+func restoreSchema(ctx context.Context, tx *sql.Tx, schema string) error {
+	// The schema is the first of the search path, followed by public
+	// where the extensions are.
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM pg_namespace
+		WHERE nspname = trim(both ' "' from split_part(current_setting('search_path'), ',', 1)))`
+	if err := tx.QueryRowContext(ctx, query).Scan(&exists); err != nil {
+		return fmt.Errorf("could not query select schema existence: %v", err)
+	}
+
+	if exists {
+		return ErrSchemaExists
+	}
+
+	if _, err := tx.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("could not apply schema: %v", err)
+	}
+
+	query = `SELECT string_agg(quote_ident(relname), ', ') FROM pg_class
+		WHERE relnamespace = current_schema()::regnamespace AND relkind = 'r'`
+	var list string
+	if err := tx.QueryRowContext(ctx, query).Scan(&list); err != nil {
+		return fmt.Errorf("could not query select tables: %v", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "TRUNCATE "+list+" RESTART IDENTITY CASCADE"); err != nil {
+		return fmt.Errorf("could not truncate sample data: %v", err)
+	}
+
+	return nil
+}
+
+// restoreRows inserts a batch of rows, given as a JSON array. Columns
+// missing from the backup, as it predates them, get their default.
+func restoreRows(ctx context.Context, tx *sql.Tx, t BackupTable, r io.Reader) (int, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("could not read %s rows: %v", t.Name, err)
+	}
+
+	cols := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		cols[i] = pq.QuoteIdentifier(col)
+	}
+
+	list := strings.Join(cols, ", ")
+	table := pq.QuoteIdentifier(t.Name)
+	query := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM json_populate_recordset(NULL::%s, $1)",
+		table, list, list, table)
+	res, err := tx.ExecContext(ctx, query, string(b))
+	if err != nil {
+		return 0, fmt.Errorf("could not insert %s rows: %v", t.Name, err)
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// restoreSequences continues the ids of each sequence after the restored ones,
+// past every column taking its default from it. Sequences shared by several
+// tables, like the one of sync ids, aren't owned by any of their columns.
+func restoreSequences(ctx context.Context, tx *sql.Tx, tt []BackupTable) error {
+	var seqs []string
+	maxes := map[string][]string{}
+	query := `SELECT s.oid::regclass::text FROM pg_attrdef d
+		INNER JOIN pg_attribute a ON a.attrelid = d.adrelid AND a.attnum = d.adnum
+		INNER JOIN pg_depend dep ON dep.classid = 'pg_attrdef'::regclass AND dep.objid = d.oid
+		INNER JOIN pg_class s ON s.oid = dep.refobjid AND s.relkind = 'S'
+		WHERE d.adrelid = $1::regclass AND a.attname = $2`
+	for _, t := range tt {
+		table := pq.QuoteIdentifier(t.Name)
+		for _, col := range t.Columns {
+			var seq string
+			err := tx.QueryRowContext(ctx, query, table, col).Scan(&seq)
+			if err == sql.ErrNoRows {
+				continue
+			}
+
+			if err != nil {
+				return fmt.Errorf("could not query select %s.%s sequence: %v", t.Name, col, err)
+			}
+
+			if maxes[seq] == nil {
+				seqs = append(seqs, seq)
+			}
+			maxes[seq] = append(maxes[seq], fmt.Sprintf("(SELECT max(%s) FROM %s)", pq.QuoteIdentifier(col), table))
+		}
+	}
+
+	for _, seq := range seqs {
+		query := fmt.Sprintf("SELECT setval($1, COALESCE(GREATEST(%s), 0) + 1, false)", strings.Join(maxes[seq], ", "))
+		if _, err := tx.ExecContext(ctx, query, seq); err != nil {
+			return fmt.Errorf("could not set %s sequence: %v", seq, err)
+		}
+	}
+
+	return nil
+}
+
+// restoreFile writes a media file of the archive to its directory.
+func restoreFile(tr *tar.Reader, hdr *tar.Header) error {
+	parts := strings.Split(hdr.Name, "/")
+	if len(parts) != 3 || parts[0] != "media" || parts[2] == "" || parts[2] == "." || parts[2] == ".." {
+		return fmt.Errorf("invalid backup entry %s", hdr.Name)
+	}
+
+	dir, ok := backupMediaDirs[parts[1]]
+	if !ok {
+		return fmt.Errorf("invalid backup entry %s", hdr.Name)
+	}
+
+	f, err := os.Create(path.Join(dir, parts[2]))
+	if err != nil {
+		return fmt.Errorf("could not create media file: %v", err)
+	}
+
+	if _, err = io.Copy(f, tr); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write media file %s: %v", hdr.Name, err)
+	}
+
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("could not close media file %s: %v", hdr.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/djomlaa/socnet"
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/djomlaa/socnet/internal/testutil"
+)
+
+func TestRestoreSyncSequence(t *testing.T) {
+	s, db := testutil.NewService(t)
+
+	alice := testutil.CreateUser(t, db, "alice")
+	bob := testutil.CreateUser(t, db, "bob")
+	kept := testutil.CreatePost(t, db, bob, "kept")
+	removed := testutil.CreatePost(t, db, bob, "removed")
+
+	// Every resource synced by deltas takes its sync ids from sync_seq.
+	for _, q := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{"INSERT INTO timeline (user_id, post_id) VALUES ($1, $2)", []interface{}{alice, kept}},
+		{"INSERT INTO post_bookmarks (user_id, post_id) VALUES ($1, $2), ($1, $3)", []interface{}{alice, kept, removed}},
+		{"DELETE FROM post_bookmarks WHERE user_id = $1 AND post_id = $2", []interface{}{alice, removed}},
+		{"INSERT INTO notifications (user_id, actors, type) VALUES ($1, '{bob}', 'follow')", []interface{}{alice}},
+	} {
+		if _, err := db.Exec(q.query, q.args...); err != nil {
+			t.Fatalf("could not run %q: %v", q.query, err)
+		}
+	}
+
+	var want int64
+	query := `SELECT GREATEST(
+		(SELECT max(sync_id) FROM timeline),
+		(SELECT max(sync_id) FROM post_bookmarks),
+		(SELECT max(sync_id) FROM notifications),
+		(SELECT max(id) FROM sync_removals))`
+	if err := db.QueryRow(query).Scan(&want); err != nil {
+		t.Fatalf("could not query select max sync id: %v", err)
+	}
+
+	var buf bytes.Buffer
+	ctx := context.Background()
+	if _, err := s.Backup(ctx, &buf, false); err != nil {
+		t.Fatalf("could not backup: %v", err)
+	}
+
+	restoredDB := testutil.NewEmptyDB(t)
+	restored := service.New(service.Config{DB: restoredDB, Origin: "http://localhost"})
+	if _, err := restored.Restore(ctx, &buf, socnet.Schema); err != nil {
+		t.Fatalf("could not restore: %v", err)
+	}
+
+	var next int64
+	if err := restoredDB.QueryRow("SELECT nextval('sync_seq')").Scan(&next); err != nil {
+		t.Fatalf("could not query select next sync id: %v", err)
+	}
+
+	if next <= want {
+		t.Fatalf("next sync id after restore is %d, want past %d", next, want)
+	}
+}
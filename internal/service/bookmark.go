@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ToggleBookmarkOutput response
+type ToggleBookmarkOutput struct {
+	Bookmarked bool `json:"bookmarked"`
+}
+
+// TogglePinOutput response
+type TogglePinOutput struct {
+	Pinned bool `json:"pinned"`
+}
+
+// ToggleBookmark of a post for the authenticated user.
+func (s *Service) ToggleBookmark(ctx context.Context, postID int64) (ToggleBookmarkOutput, error) {
+	var out ToggleBookmarkOutput
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	query := "DELETE FROM post_bookmarks WHERE user_id = $1 AND post_id = $2"
+	res, err := s.db.ExecContext(ctx, query, uid, postID)
+	if err != nil {
+		return out, fmt.Errorf("could not delete post bookmark: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n != 0 {
+		return out, nil
+	}
+
+	query = "INSERT INTO post_bookmarks (user_id, post_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	_, err = s.db.ExecContext(ctx, query, uid, postID)
+	if isForeignKeyViolation(err) {
+		return out, ErrPostNotFound
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not insert post bookmark: %v", err)
+	}
+
+	out.Bookmarked = true
+	return out, nil
+}
+
+// TogglePostPin of a post of the authenticated user.
+func (s *Service) TogglePostPin(ctx context.Context, postID int64) (TogglePinOutput, error) {
+	var out TogglePinOutput
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	query := "UPDATE posts SET pinned = NOT pinned WHERE id = $1 AND user_id = $2 RETURNING pinned"
+	err := s.db.QueryRowContext(ctx, query, postID, uid).Scan(&out.Pinned)
+	if err == sql.ErrNoRows {
+		return out, ErrPostNotFound
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not update post pinned: %v", err)
+	}
+
+	return out, nil
+}
+
+// BookmarksDelta is what changed in the bookmarks since a sync position.
+type BookmarksDelta struct {
+	// Added bookmarked posts, oldest bookmark first.
+	Added []Post `json:"added"`
+	// Removed ids of posts no longer bookmarked.
+	Removed []int64 `json:"removed"`
+	// More changes are left past SyncDeltaSize; sync again from Position.
+	More     bool         `json:"more"`
+	Position SyncPosition `json:"-"`
+}
+
+// BookmarksDelta of the authenticated user since the given position. Bookmarks
+// are not listed otherwise, so a nil position starts from the first one.
+func (s *Service) BookmarksDelta(ctx context.Context, since *SyncPosition) (BookmarksDelta, error) {
+	out := BookmarksDelta{Added: []Post{}, Removed: []int64{}}
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	if since == nil {
+		since = &SyncPosition{At: time.Now()}
+	} else if since.expired() {
+		return out, ErrSyncExpired
+	}
+
+	query := `SELECT sync_id, post_id FROM post_bookmarks
+		WHERE user_id = $1 AND sync_id > $2 AND synced_at < now() - $3::INTERVAL
+		ORDER BY sync_id
+		LIMIT $4`
+	rows, err := s.db.QueryContext(ctx, query, uid, since.SyncID, interval(syncSettleDelay), SyncDeltaSize)
+	if err != nil {
+		return out, fmt.Errorf("could not query select bookmarks delta: %v", err)
+	}
+
+	defer rows.Close()
+
+	var changed []syncChange
+	for rows.Next() {
+		var c syncChange
+		if err = rows.Scan(&c.syncID, &c.itemID); err != nil {
+			return out, fmt.Errorf("could not scan bookmark: %v", err)
+		}
+
+		changed = append(changed, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return out, fmt.Errorf("could not iterate bookmark rows: %v", err)
+	}
+
+	d, err := s.syncDelta(ctx, uid, syncBookmarks, *since, changed)
+	if err != nil {
+		return out, err
+	}
+
+	if d.changed != 0 {
+		ids := make([]int64, d.changed)
+		for i, c := range changed[:d.changed] {
+			ids[i] = c.itemID
+		}
+
+		if out.Added, err = s.PostsByIDs(ctx, ids); err != nil {
+			return out, err
+		}
+	}
+
+	out.Removed = d.removed
+	out.More = d.more
+	out.Position = d.position
+	return out, nil
+}
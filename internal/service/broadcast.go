@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+)
+
+func timelineTopic(userID int64) string {
+	return "timeline_item:" + strconv.FormatInt(userID, 10)
+}
+
+func notificationsTopic(userID int64) string {
+	return "notification:" + strconv.FormatInt(userID, 10)
+}
+
+func (s *Service) broadcast(topic string, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("could not marshal %s message: %v\n", topic, err)
+		return
+	}
+
+	if err = s.pubsub.Publish(context.Background(), topic, b); err != nil {
+		log.Printf("could not publish %s message: %v\n", topic, err)
+	}
+}
+
+func (s *Service) broadcastTimelineItem(ti TimelineItem) {
+	s.broadcast(timelineTopic(ti.UserID), ti)
+}
+
+func (s *Service) broadcastNotification(n Notification) {
+	s.broadcast(notificationsTopic(n.UserID), n)
+	s.pushNotification(n)
+}
+
+// SubscribeToTimeline receives the timeline items of the authenticated user
+// as they are added, until ctx is done.
+func (s *Service) SubscribeToTimeline(ctx context.Context) (<-chan TimelineItem, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	tt := make(chan TimelineItem)
+	go func() {
+		defer close(tt)
+		for b := range s.pubsub.Subscribe(ctx, timelineTopic(uid)) {
+			var ti TimelineItem
+			if err := json.Unmarshal(b, &ti); err != nil {
+				log.Printf("could not unmarshal timeline item message: %v\n", err)
+				continue
+			}
+
+			select {
+			case tt <- ti:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return tt, nil
+}
+
+// SubscribeToNotifications receives the notifications of the authenticated user
+// as they are issued, until ctx is done.
+func (s *Service) SubscribeToNotifications(ctx context.Context) (<-chan Notification, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	nn := make(chan Notification)
+	go func() {
+		defer close(nn)
+		for b := range s.pubsub.Subscribe(ctx, notificationsTopic(uid)) {
+			var n Notification
+			if err := json.Unmarshal(b, &n); err != nil {
+				log.Printf("could not unmarshal notification message: %v\n", err)
+				continue
+			}
+
+			select {
+			case nn <- n:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nn, nil
+}
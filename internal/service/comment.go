@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/djomlaa/socnet/internal/validation"
 	"strings"
 	"time"
 )
@@ -20,6 +21,7 @@ type Comment struct {
 	User       *User     `json:"user,omitempty"`
 	Mine       bool      `json:"mine"`
 	Liked      bool      `json:"liked"`
+	Emojis     []Emoji   `json:"emojis,omitempty"`
 }
 
 var (
@@ -27,6 +29,22 @@ var (
 	ErrCommentNotFound = errors.New("comment not found")
 )
 
+// Comments sort orders.
+const (
+	CommentsSortNewest = "newest"
+	CommentsSortOldest = "oldest"
+	// CommentsSortTop ranks by likes, newest first on ties.
+	CommentsSortTop = "top"
+)
+
+// CommentsCursor holds the sort keys of the last comment of the previous page.
+// LikesCount is only used by CommentsSortTop, as the comment had it then, so
+// the pages don't skip nor repeat comments as their likes change.
+type CommentsCursor struct {
+	ID         int64
+	LikesCount int
+}
+
 // CreateComment on post
 func (s *Service) CreateComment(ctx context.Context, postID int64, content string) (Comment, error) {
 	var c Comment
@@ -35,9 +53,11 @@ func (s *Service) CreateComment(ctx context.Context, postID int64, content strin
 		return c, ErrUnauthenticated
 	}
 
+	var v validation.Validator
 	content = strings.TrimSpace(content)
-	if content == "" || len([]rune(content)) == 480 {
-		return c, ErrInvalidContent
+	v.Content("content", content, validation.MaxCommentLength)
+	if err := v.Err(); err != nil {
+		return c, err
 	}
 
 	tx, err := s.db.BeginTx(ctx, nil)
@@ -62,24 +82,50 @@ func (s *Service) CreateComment(ctx context.Context, postID int64, content strin
 	c.Content = content
 	c.Mine = true
 
+	emojis, err := s.resolveEmojis(ctx, content)
+	if err != nil {
+		return c, err
+	}
+
+	c.Emojis = usedEmojis(emojis, content)
+
 	query = "UPDATE posts SET comments_count = comments_count + 1 WHERE id =$1"
 	if _, err = tx.ExecContext(ctx, query, postID); err != nil {
 		return c, fmt.Errorf("could not update and increase comments count comment: %v", err)
 	}
 
+	created := CommentCreated{Comment: c}
+	if err = s.recordEvent(ctx, tx, created); err != nil {
+		return c, err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return c, fmt.Errorf("could not commit tx: %v", err)
 	}
 
+	s.publish(created)
+
 	return c, nil
 }
 
-// Comments from a post in descending order with backward pagination
-func (s *Service) Comments(ctx context.Context, postID int64, last int, before int64) ([]Comment, error) {
+// Comments from a post in the given sort order, newest by default, with cursor pagination
+func (s *Service) Comments(ctx context.Context, postID int64, last int, before CommentsCursor, sort string) ([]Comment, error) {
+	if sort == "" {
+		sort = CommentsSortNewest
+	}
+
+	var v validation.Validator
+	v.Cursor("before", before.ID)
+	v.Check(before.LikesCount >= 0, "before", "invalid cursor")
+	v.Check(sort == CommentsSortNewest || sort == CommentsSortOldest || sort == CommentsSortTop, "sort", "must be newest, oldest or top")
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
 	uid, auth := ctx.Value(KeyAuthUserID).(int64)
-	last = normalizePageSize(last)
+	last = validation.PageSize(last)
 	query, args, err := buildQuery(`
-		SELECT c.id, c.content, c.likes_count, c.created_at, u.username, u.avatar
+		SELECT c.id, c.content, c.likes_count, c.created_at, u.username, u.avatar, u.verified
 		{{if .auth}}
 		, c.user_id =@uid as mine
 		, cl.user_id IS NOT NULL AS likes
@@ -90,15 +136,23 @@ func (s *Service) Comments(ctx context.Context, postID int64, last int, before i
 		LEFT JOIN comment_likes cl ON cl.comment_id = c.id AND cl.user_id =@uid
 		{{end}}
 		WHERE c.post_id = @post_id
-		{{if .before}}AND c.id < @before{{end}}
-		ORDER BY c.created_at DESC
+		{{if .before}}
+			{{if eq .sort "oldest"}}AND c.id > @before
+			{{else if eq .sort "top"}}AND (c.likes_count, c.id) < (@cursor_likes, @before)
+			{{else}}AND c.id < @before{{end}}
+		{{end}}
+		{{if eq .sort "oldest"}}ORDER BY c.id ASC
+		{{else if eq .sort "top"}}ORDER BY c.likes_count DESC, c.id DESC
+		{{else}}ORDER BY c.id DESC{{end}}
 		LIMIT @last`,
 		map[string]interface{}{
-			"auth":    auth,
-			"uid":     uid,
-			"post_id": postID,
-			"before":  before,
-			"last":    last,
+			"auth":         auth,
+			"uid":          uid,
+			"post_id":      postID,
+			"before":       before.ID,
+			"cursor_likes": before.LikesCount,
+			"last":         last,
+			"sort":         sort,
 		})
 
 	if err != nil {
@@ -117,7 +171,7 @@ func (s *Service) Comments(ctx context.Context, postID int64, last int, before i
 		var c Comment
 		var u User
 		var avatar sql.NullString
-		dest := []interface{}{&c.ID, &c.Content, &c.LikesCount, &c.CreatedAt, &u.Username, &avatar}
+		dest := []interface{}{&c.ID, &c.Content, &c.LikesCount, &c.CreatedAt, &u.Username, &avatar, &u.Verified}
 		if auth {
 			dest = append(dest, &c.Mine, &c.Liked)
 		}
@@ -137,6 +191,10 @@ func (s *Service) Comments(ctx context.Context, postID int64, last int, before i
 		return nil, fmt.Errorf("could not iterate comment rows: , %v", err)
 	}
 
+	if err = s.fillCommentsEmojis(ctx, cc); err != nil {
+		return nil, err
+	}
+
 	return cc, nil
 }
 
@@ -0,0 +1,575 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// Community member roles.
+const (
+	CommunityMember    = "member"
+	CommunityModerator = "moderator"
+)
+
+// MaxCommunityPins is how many posts can be pinned to a community feed at once.
+const MaxCommunityPins = 3
+
+var (
+	// ErrCommunityNotFound denotes a community that was not found
+	ErrCommunityNotFound = errors.New("community not found")
+	// ErrCommunityNameTaken used when the community name already exists
+	ErrCommunityNameTaken = errors.New("community name is taken")
+	// ErrNotCommunityMember used when the user must be a member of the community
+	ErrNotCommunityMember = errors.New("not a community member")
+	// ErrNotCommunityModerator used when the user must be a moderator of the community
+	ErrNotCommunityModerator = errors.New("not a community moderator")
+	// ErrCommunityPinsFull used when pinning more than MaxCommunityPins posts
+	ErrCommunityPinsFull = errors.New("too many pinned posts")
+)
+
+// Community model
+type Community struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	MembersCount int       `json:"membersCount"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Role         *string   `json:"role"`
+}
+
+// CommunityMemberOutput is a member with its role in the community.
+type CommunityMemberOutput struct {
+	User
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+// CreateCommunity with the authenticated user as its first moderator.
+func (s *Service) CreateCommunity(ctx context.Context, name, description string) (Community, error) {
+	var c Community
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return c, ErrUnauthenticated
+	}
+
+	var v validation.Validator
+	name = strings.TrimSpace(name)
+	description = strings.TrimSpace(description)
+	v.Slug("name", name)
+	v.Check(len([]rune(description)) <= validation.MaxPostLength, "description", "too long")
+	if err := v.Err(); err != nil {
+		return c, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return c, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	query := "INSERT INTO communities (name, description, members_count) VALUES ($1, $2, 1) RETURNING id, created_at"
+	err = tx.QueryRowContext(ctx, query, name, description).Scan(&c.ID, &c.CreatedAt)
+	if isUniqueViolation(err) {
+		return c, ErrCommunityNameTaken
+	}
+
+	if err != nil {
+		return c, fmt.Errorf("could not insert community: %v", err)
+	}
+
+	query = "INSERT INTO community_members (community_id, user_id, role) VALUES ($1, $2, $3)"
+	if _, err = tx.ExecContext(ctx, query, c.ID, uid, CommunityModerator); err != nil {
+		return c, fmt.Errorf("could not insert community moderator: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return c, fmt.Errorf("could not commit community creation: %v", err)
+	}
+
+	role := CommunityModerator
+	c.Name = name
+	c.Description = description
+	c.MembersCount = 1
+	c.Role = &role
+
+	return c, nil
+}
+
+// Community by name, with the role of the authenticated user in it.
+func (s *Service) Community(ctx context.Context, name string) (Community, error) {
+	var c Community
+	uid, auth := ctx.Value(KeyAuthUserID).(int64)
+
+	query, args, err := buildQuery(`
+		SELECT id, name, description, members_count, created_at
+		{{if .auth}}, cm.role{{end}}
+		FROM communities
+		{{if .auth}}
+		LEFT JOIN community_members cm ON cm.community_id = communities.id AND cm.user_id = @uid
+		{{end}}
+		WHERE name = @name`, map[string]interface{}{
+		"auth": auth,
+		"uid":  uid,
+		"name": strings.TrimSpace(name),
+	})
+	if err != nil {
+		return c, fmt.Errorf("could not build community sql query: %v", err)
+	}
+
+	dest := []interface{}{&c.ID, &c.Name, &c.Description, &c.MembersCount, &c.CreatedAt}
+	if auth {
+		dest = append(dest, &c.Role)
+	}
+
+	err = s.db.QueryRowContext(ctx, query, args...).Scan(dest...)
+	if err == sql.ErrNoRows {
+		return c, ErrCommunityNotFound
+	}
+
+	if err != nil {
+		return c, fmt.Errorf("could not query select community: %v", err)
+	}
+
+	return c, nil
+}
+
+// Communities in ascending order with forward pagination and filter by name
+func (s *Service) Communities(ctx context.Context, search string, first int, after string) ([]Community, error) {
+	uid, auth := ctx.Value(KeyAuthUserID).(int64)
+	first = validation.PageSize(first)
+	search = strings.TrimSpace(search)
+	after = strings.TrimSpace(after)
+
+	query, args, err := buildQuery(`
+		SELECT id, name, description, members_count, created_at
+		{{if .auth}}, cm.role{{end}}
+		FROM communities
+		{{if .auth}}
+		LEFT JOIN community_members cm ON cm.community_id = communities.id AND cm.user_id = @uid
+		{{end}}
+		{{if or .search .after}} WHERE {{end}}
+		{{if .search}}name LIKE '%' || @search || '%'{{end}}
+		{{if and .search .after}} AND {{end}}
+		{{if .after}}name > @after{{end}}
+		ORDER BY name ASC
+		LIMIT @first`, map[string]interface{}{
+		"auth":   auth,
+		"uid":    uid,
+		"search": search,
+		"after":  after,
+		"first":  first,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build communities sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select communities: %v", err)
+	}
+
+	defer rows.Close()
+
+	cc := make([]Community, 0, first)
+	for rows.Next() {
+		var c Community
+		dest := []interface{}{&c.ID, &c.Name, &c.Description, &c.MembersCount, &c.CreatedAt}
+		if auth {
+			dest = append(dest, &c.Role)
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan community: %v", err)
+		}
+
+		cc = append(cc, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate community rows: %v", err)
+	}
+
+	return cc, nil
+}
+
+// JoinCommunity as the authenticated user.
+func (s *Service) JoinCommunity(ctx context.Context, name string) (Community, error) {
+	return s.updateCommunityMembership(ctx, name, true)
+}
+
+// LeaveCommunity as the authenticated user.
+// The last moderator cannot leave, so the community keeps one.
+func (s *Service) LeaveCommunity(ctx context.Context, name string) (Community, error) {
+	return s.updateCommunityMembership(ctx, name, false)
+}
+
+func (s *Service) updateCommunityMembership(ctx context.Context, name string, join bool) (Community, error) {
+	var c Community
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return c, ErrUnauthenticated
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return c, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	query := "SELECT id, name, description, created_at FROM communities WHERE name = $1 FOR UPDATE"
+	err = tx.QueryRowContext(ctx, query, strings.TrimSpace(name)).Scan(&c.ID, &c.Name, &c.Description, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return c, ErrCommunityNotFound
+	}
+
+	if err != nil {
+		return c, fmt.Errorf("could not query select community: %v", err)
+	}
+
+	var res sql.Result
+	delta := 1
+	if join {
+		query = "INSERT INTO community_members (community_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+		res, err = tx.ExecContext(ctx, query, c.ID, uid)
+	} else {
+		var lastModerator bool
+		query = `SELECT role = $3 AND NOT EXISTS (
+				SELECT 1 FROM community_members
+				WHERE community_id = $1 AND user_id <> $2 AND role = $3
+			) FROM community_members WHERE community_id = $1 AND user_id = $2`
+		err = tx.QueryRowContext(ctx, query, c.ID, uid, CommunityModerator).Scan(&lastModerator)
+		if err != nil && err != sql.ErrNoRows {
+			return c, fmt.Errorf("could not query select community moderators: %v", err)
+		}
+
+		if lastModerator {
+			return c, ErrForbidden
+		}
+
+		query = "DELETE FROM community_members WHERE community_id = $1 AND user_id = $2"
+		res, err = tx.ExecContext(ctx, query, c.ID, uid)
+		delta = -1
+	}
+
+	if err != nil {
+		return c, fmt.Errorf("could not update community membership: %v", err)
+	}
+
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		delta = 0
+	}
+
+	query = "UPDATE communities SET members_count = members_count + $1 WHERE id = $2 RETURNING members_count"
+	if err = tx.QueryRowContext(ctx, query, delta, c.ID).Scan(&c.MembersCount); err != nil {
+		return c, fmt.Errorf("could not update community members count: %v", err)
+	}
+
+	query = "SELECT role FROM community_members WHERE community_id = $1 AND user_id = $2"
+	if err = tx.QueryRowContext(ctx, query, c.ID, uid).Scan(&c.Role); err != nil && err != sql.ErrNoRows {
+		return c, fmt.Errorf("could not query select community role: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return c, fmt.Errorf("could not commit community membership: %v", err)
+	}
+
+	return c, nil
+}
+
+// communityID by name.
+func (s *Service) communityID(ctx context.Context, name string) (int64, error) {
+	var cid int64
+	query := "SELECT id FROM communities WHERE name = $1"
+	err := s.db.QueryRowContext(ctx, query, strings.TrimSpace(name)).Scan(&cid)
+	if err == sql.ErrNoRows {
+		return 0, ErrCommunityNotFound
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("could not query select community id: %v", err)
+	}
+
+	return cid, nil
+}
+
+// CommunityMembers in ascending order with forward pagination.
+func (s *Service) CommunityMembers(ctx context.Context, name string, first int, after string) ([]CommunityMemberOutput, error) {
+	first = validation.PageSize(first)
+	after = strings.TrimSpace(after)
+
+	cid, err := s.communityID(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	query, args, err := buildQuery(`
+		SELECT users.username, users.avatar, users.verified, cm.role, cm.joined_at
+		FROM community_members cm
+		INNER JOIN users ON cm.user_id = users.id
+		WHERE cm.community_id = @cid
+		{{if .after}}AND users.username > @after{{end}}
+		ORDER BY users.username ASC
+		LIMIT @first`, map[string]interface{}{
+		"cid":   cid,
+		"after": after,
+		"first": first,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build community members sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select community members: %v", err)
+	}
+
+	defer rows.Close()
+
+	mm := make([]CommunityMemberOutput, 0, first)
+	for rows.Next() {
+		var m CommunityMemberOutput
+		var avatar sql.NullString
+		if err = rows.Scan(&m.Username, &avatar, &m.Verified, &m.Role, &m.JoinedAt); err != nil {
+			return nil, fmt.Errorf("could not scan community member: %v", err)
+		}
+
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			m.AvatarURL = &avatarURL
+		}
+
+		mm = append(mm, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate community member rows: %v", err)
+	}
+
+	return mm, nil
+}
+
+// SetCommunityModerator grants or revokes the moderator role of a member.
+// Only moderators of the community can do it.
+func (s *Service) SetCommunityModerator(ctx context.Context, name, username string, moderator bool) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	cid, err := s.moderatedCommunityID(ctx, name, uid)
+	if err != nil {
+		return err
+	}
+
+	role := CommunityMember
+	if moderator {
+		role = CommunityModerator
+	}
+
+	query := `UPDATE community_members SET role = $1
+		WHERE community_id = $2 AND user_id = (SELECT id FROM users WHERE lower(username) = lower($3))`
+	res, err := s.db.ExecContext(ctx, query, role, cid, validation.NormalizeUsername(username))
+	if err != nil {
+		return fmt.Errorf("could not update community member role: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotCommunityMember
+	}
+
+	return nil
+}
+
+// moderatedCommunityID returns the id of the community when uid moderates it.
+func (s *Service) moderatedCommunityID(ctx context.Context, name string, uid int64) (int64, error) {
+	var cid int64
+	var role sql.NullString
+	query := `SELECT id, cm.role FROM communities
+		LEFT JOIN community_members cm ON cm.community_id = communities.id AND cm.user_id = $2
+		WHERE name = $1`
+	err := s.db.QueryRowContext(ctx, query, strings.TrimSpace(name), uid).Scan(&cid, &role)
+	if err == sql.ErrNoRows {
+		return 0, ErrCommunityNotFound
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("could not query select community role: %v", err)
+	}
+
+	if role.String != CommunityModerator {
+		return 0, ErrNotCommunityModerator
+	}
+
+	return cid, nil
+}
+
+// CommunityPosts in descending order with backward pagination.
+// The first page starts with the posts pinned by moderators, most recently pinned first.
+func (s *Service) CommunityPosts(ctx context.Context, name string, last int, before int64) ([]Post, error) {
+	var v validation.Validator
+	v.Cursor("before", before)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	uid, auth := ctx.Value(KeyAuthUserID).(int64)
+	last = validation.PageSize(last)
+	name = strings.TrimSpace(name)
+	cid, err := s.communityID(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	query, args, err := buildQuery(`
+		SELECT p.id, p.content, p.spoiler_of, p.nsfw, p.license, p.likes_count, p.comments_count, p.created_at, u.username, u.avatar, u.verified
+		, p.community_pinned_at IS NOT NULL AS pinned
+		{{if .auth}}
+		, p.user_id = @uid AS mine
+		, pl.user_id IS NOT NULL AS liked
+		{{end}}
+		FROM posts p
+		INNER JOIN users u ON p.user_id = u.id
+		{{if .auth}}
+		LEFT JOIN post_likes pl ON pl.user_id = @uid AND pl.post_id = p.id
+		{{end}}
+		WHERE p.community_id = @cid
+		{{template "nsfwFilter" .}}
+		AND NOT p.archived
+		{{if .before}}AND p.id < @before AND p.community_pinned_at IS NULL{{end}}
+		ORDER BY p.community_pinned_at DESC NULLS LAST, p.id DESC
+		LIMIT @last`, map[string]interface{}{
+		"auth":       auth,
+		"uid":        uid,
+		"nsfwBornBy": s.nsfwBornBy(),
+		"cid":        cid,
+		"before":     before,
+		"last":       last,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build community posts sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select community posts: %v", err)
+	}
+
+	defer rows.Close()
+
+	pp := make([]Post, 0, last)
+	for rows.Next() {
+		var p Post
+		var u User
+		var avatar sql.NullString
+		dest := []interface{}{&p.ID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.License, &p.LikesCount, &p.CommentsCount, &p.CreatedAt, &u.Username, &avatar, &u.Verified, &p.Pinned}
+		if auth {
+			dest = append(dest, &p.Mine, &p.Liked)
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan community post: %v", err)
+		}
+
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			u.AvatarURL = &avatarURL
+		}
+
+		p.User = &u
+		p.Community = &name
+		pp = append(pp, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate community post rows: %v", err)
+	}
+
+	if err = s.fillPosts(ctx, postPtrs(pp)); err != nil {
+		return nil, err
+	}
+
+	return pp, nil
+}
+
+// SetCommunityPostPinned pins a post of the community to the top of its feed, or unpins it.
+// Only moderators of the community can do it, and every change is recorded in the audit log.
+func (s *Service) SetCommunityPostPinned(ctx context.Context, name string, postID int64, pinned bool) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	cid, err := s.moderatedCommunityID(ctx, name, uid)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	// Lock the community so concurrent pins can't go past the limit.
+	if _, err = tx.ExecContext(ctx, "SELECT 1 FROM communities WHERE id = $1 FOR UPDATE", cid); err != nil {
+		return fmt.Errorf("could not lock community: %v", err)
+	}
+
+	var authorID int64
+	var wasPinned bool
+	query := "SELECT user_id, community_pinned_at IS NOT NULL FROM posts WHERE id = $1 AND community_id = $2"
+	err = tx.QueryRowContext(ctx, query, postID, cid).Scan(&authorID, &wasPinned)
+	if err == sql.ErrNoRows {
+		return ErrPostNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not query select community post: %v", err)
+	}
+
+	if wasPinned == pinned {
+		return nil
+	}
+
+	action := AuditActionUnpinCommunityPost
+	query = "UPDATE posts SET community_pinned_at = NULL WHERE id = $1"
+	if pinned {
+		var pins int
+		query = "SELECT count(*) FROM posts WHERE community_id = $1 AND community_pinned_at IS NOT NULL"
+		if err = tx.QueryRowContext(ctx, query, cid).Scan(&pins); err != nil {
+			return fmt.Errorf("could not query select community pins count: %v", err)
+		}
+
+		if pins >= MaxCommunityPins {
+			return ErrCommunityPinsFull
+		}
+
+		action = AuditActionPinCommunityPost
+		query = "UPDATE posts SET community_pinned_at = now() WHERE id = $1"
+	}
+
+	if _, err = tx.ExecContext(ctx, query, postID); err != nil {
+		return fmt.Errorf("could not update community post pinned: %v", err)
+	}
+
+	details := map[string]interface{}{"community": strings.TrimSpace(name), "postId": postID}
+	if err = s.audit(ctx, tx, uid, action, authorID, details); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit community post pin: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// ErrConsentRequired used when the authenticated user has not accepted
+// the current version of the terms of service and privacy policy.
+var ErrConsentRequired = errors.New("consent required")
+
+// Consent of the authenticated user to the terms of service and privacy policy.
+type Consent struct {
+	// CurrentVersion users must accept, if any.
+	CurrentVersion string `json:"currentVersion"`
+	// AcceptedVersion is the last version the user accepted.
+	AcceptedVersion *string    `json:"acceptedVersion"`
+	AcceptedAt      *time.Time `json:"acceptedAt"`
+	// Required is true until the user accepts the current version.
+	Required bool `json:"required"`
+}
+
+// Consent of the authenticated user.
+func (s *Service) Consent(ctx context.Context) (Consent, error) {
+	out := Consent{CurrentVersion: s.Settings().TermsVersion}
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	query := "SELECT version, accepted_at FROM consents WHERE user_id = $1 ORDER BY accepted_at DESC LIMIT 1"
+	err := s.db.QueryRowContext(ctx, query, uid).Scan(&out.AcceptedVersion, &out.AcceptedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return out, fmt.Errorf("could not query select consent: %v", err)
+	}
+
+	if out.CurrentVersion != "" {
+		out.Required = out.AcceptedVersion == nil || *out.AcceptedVersion != out.CurrentVersion
+	}
+
+	return out, nil
+}
+
+// AcceptTerms records that the authenticated user accepted the given version
+// of the terms of service and privacy policy, with the device they did it from.
+// Only the current version can be accepted, so a client showing outdated terms
+// can't consent to newer ones. Admins impersonating the user can't consent for them.
+func (s *Service) AcceptTerms(ctx context.Context, version string) (Consent, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return Consent{}, ErrUnauthenticated
+	}
+
+	if _, ok := ctx.Value(KeyImpersonatorID).(int64); ok {
+		return Consent{}, ErrForbidden
+	}
+
+	version = strings.TrimSpace(version)
+	current := s.Settings().TermsVersion
+	var v validation.Validator
+	v.Check(current != "", "version", "there are no terms to accept")
+	v.Check(current == "" || version == current, "version", "is not the current version")
+	if err := v.Err(); err != nil {
+		return Consent{}, err
+	}
+
+	ci, _ := ctx.Value(KeyClientInfo).(ClientInfo)
+	query := `INSERT INTO consents (user_id, version, user_agent, ip) VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''))
+		ON CONFLICT (user_id, version) DO NOTHING`
+	if _, err := s.db.ExecContext(ctx, query, uid, version, ci.UserAgent, ci.IP); err != nil {
+		return Consent{}, fmt.Errorf("could not insert consent: %v", err)
+	}
+
+	return s.Consent(ctx)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// NSFW preferences of a viewer.
+const (
+	// NSFWHide filters NSFW posts of others out of timelines, feeds and search.
+	NSFWHide = "hide"
+	// NSFWBlur returns NSFW posts for clients to blur. It is the default.
+	NSFWBlur = "blur"
+	// NSFWShow returns NSFW posts for clients to show as is.
+	NSFWShow = "show"
+)
+
+// NSFWMinimumAge is the default minimum age to see NSFW posts.
+const NSFWMinimumAge = 18
+
+// ContentPreferences of a user.
+type ContentPreferences struct {
+	NSFW string `json:"nsfw"`
+	// NSFWLocked is true while the user is under the minimum age,
+	// which hides NSFW posts of others whatever their preference.
+	NSFWLocked bool `json:"nsfwLocked"`
+}
+
+// nsfwBornBy is the latest birthdate of the users old enough to see NSFW posts,
+// as a date for the nsfwFilter query partial. Users without a birthdate are not checked.
+func (s *Service) nsfwBornBy() string {
+	age := s.Settings().NSFWMinimumAge
+	if age == 0 {
+		return "infinity"
+	}
+
+	return time.Now().UTC().AddDate(-age, 0, 0).Format(birthdateLayout)
+}
+
+// ContentPreferences of the authenticated user.
+func (s *Service) ContentPreferences(ctx context.Context) (ContentPreferences, error) {
+	var out ContentPreferences
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	query := "SELECT nsfw_preference, COALESCE(birthdate > $2, false) FROM users WHERE id = $1"
+	err := s.db.QueryRowContext(ctx, query, uid, s.nsfwBornBy()).Scan(&out.NSFW, &out.NSFWLocked)
+	if err == sql.ErrNoRows {
+		return out, ErrUserNotFound
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not query select content preferences: %v", err)
+	}
+
+	return out, nil
+}
+
+// UpdateContentPreferences of the authenticated user.
+// Users under the minimum age can't change their NSFW preference.
+func (s *Service) UpdateContentPreferences(ctx context.Context, in ContentPreferences) (ContentPreferences, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return in, ErrUnauthenticated
+	}
+
+	var v validation.Validator
+	v.Check(in.NSFW == NSFWHide || in.NSFW == NSFWBlur || in.NSFW == NSFWShow, "nsfw", "must be hide, blur or show")
+	if err := v.Err(); err != nil {
+		return in, err
+	}
+
+	query := `UPDATE users SET nsfw_preference = $1
+		WHERE id = $2 AND (nsfw_preference = $1 OR birthdate IS NULL OR birthdate <= $3)`
+	res, err := s.db.ExecContext(ctx, query, in.NSFW, uid, s.nsfwBornBy())
+	if err != nil {
+		return in, fmt.Errorf("could not update content preferences: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return in, ErrForbidden
+	}
+
+	return s.ContentPreferences(ctx)
+}
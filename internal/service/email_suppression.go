@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/mailer"
+)
+
+var (
+	// ErrUnknownMailProvider used for webhooks of a mail provider that is not supported.
+	ErrUnknownMailProvider = errors.New("unknown mail provider")
+	// ErrInvalidMailWebhook used when a mail webhook is malformed or not authentic.
+	ErrInvalidMailWebhook = errors.New("invalid mail webhook")
+)
+
+// EmailStatus tells whether emails can be delivered to the address of the authenticated user.
+// Addresses that bounced or complained stop receiving emails.
+type EmailStatus struct {
+	Email        string     `json:"email"`
+	Deliverable  bool       `json:"deliverable"`
+	Reason       *string    `json:"reason,omitempty"`
+	SuppressedAt *time.Time `json:"suppressedAt,omitempty"`
+}
+
+// HandleMailWebhook records the bounces and complaints reported by the mail provider.
+// SES notifications come through SNS and are authenticated with the secret in the
+// subscribed URL, Mailgun webhooks with their signature using the secret as signing key.
+func (s *Service) HandleMailWebhook(ctx context.Context, provider, secret string, body []byte) error {
+	var ee []mailer.Event
+	var err error
+	switch provider {
+	case mailer.ProviderSES:
+		if s.mailWebhookSecret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(s.mailWebhookSecret)) != 1 {
+			return ErrInvalidMailWebhook
+		}
+
+		ee, err = mailer.ParseSESNotification(ctx, body)
+	case mailer.ProviderMailgun:
+		ee, err = mailer.ParseMailgunWebhook(body, s.mailWebhookSecret)
+	default:
+		return ErrUnknownMailProvider
+	}
+
+	if err == mailer.ErrInvalidWebhook {
+		return ErrInvalidMailWebhook
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, e := range ee {
+		query := `INSERT INTO email_suppressions (email, reason) VALUES (lower($1), $2)
+			ON CONFLICT (email) DO UPDATE SET reason = EXCLUDED.reason, created_at = now()`
+		if _, err = s.db.ExecContext(ctx, query, strings.TrimSpace(e.Email), e.Type); err != nil {
+			return fmt.Errorf("could not upsert email suppression: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// EmailStatus of the authenticated user.
+func (s *Service) EmailStatus(ctx context.Context) (EmailStatus, error) {
+	var out EmailStatus
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	query := `SELECT users.email, es.reason, es.created_at FROM users
+		LEFT JOIN email_suppressions es ON es.email = lower(users.email)
+		WHERE users.id = $1`
+	if err := s.db.QueryRowContext(ctx, query, uid).Scan(&out.Email, &out.Reason, &out.SuppressedAt); err != nil {
+		return out, fmt.Errorf("could not query select email status: %v", err)
+	}
+
+	out.Deliverable = out.Reason == nil
+	return out, nil
+}
+
+// ClearEmailSuppression lets emails be sent again to the address of the
+// authenticated user, once they fixed their mailbox.
+func (s *Service) ClearEmailSuppression(ctx context.Context) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	query := "DELETE FROM email_suppressions WHERE email = (SELECT lower(email) FROM users WHERE id = $1)"
+	if _, err := s.db.ExecContext(ctx, query, uid); err != nil {
+		return fmt.Errorf("could not delete email suppression: %v", err)
+	}
+
+	return nil
+}
+
+func (s *Service) emailSuppressed(ctx context.Context, email string) (bool, error) {
+	var suppressed bool
+	query := "SELECT EXISTS (SELECT 1 FROM email_suppressions WHERE email = lower($1))"
+	err := s.db.QueryRowContext(ctx, query, strings.TrimSpace(email)).Scan(&suppressed)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("could not query select email suppression existence: %v", err)
+	}
+
+	return suppressed, nil
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/djomlaa/socnet/internal/validation"
+	"github.com/lib/pq"
+)
+
+// MaxEmojiBytes to read
+const MaxEmojiBytes = 256 << 10
+
+var (
+	emojisDir   = path.Join("web", "static", "img", "emojis")
+	reShortcode = regexp.MustCompile(`:([a-zA-Z0-9_]{2,32}):`)
+	emojiTypes  = map[string]string{
+		"image/png":  ".png",
+		"image/gif":  ".gif",
+		"image/webp": ".webp",
+	}
+)
+
+var (
+	// ErrEmojiNotFound denotes a custom emoji that was not found
+	ErrEmojiNotFound = errors.New("emoji not found")
+	// ErrShortcodeTaken used when the emoji shortcode already exists
+	ErrShortcodeTaken = errors.New("shortcode is taken")
+	// ErrUnsupportedEmojiFormat used for unsupported emoji format.
+	ErrUnsupportedEmojiFormat = errors.New("only png, gif and webp allowed as emoji")
+)
+
+// Emoji is an instance level custom emoji.
+type Emoji struct {
+	Shortcode string `json:"shortcode"`
+	URL       string `json:"url"`
+}
+
+// CreateEmoji registers a custom emoji under shortcode. Admin only.
+func (s *Service) CreateEmoji(ctx context.Context, shortcode string, r io.Reader) (Emoji, error) {
+	var e Emoji
+	uid, err := s.authAdmin(ctx)
+	if err != nil {
+		return e, err
+	}
+
+	shortcode = strings.Trim(strings.TrimSpace(shortcode), ":")
+	var v validation.Validator
+	v.Shortcode("shortcode", shortcode)
+	if err = v.Err(); err != nil {
+		return e, err
+	}
+
+	r, done, err := s.scanUpload(ctx, uid, io.LimitReader(r, MaxEmojiBytes), "emoji")
+	if err != nil {
+		return e, err
+	}
+
+	defer done()
+
+	br := bufio.NewReaderSize(r, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF {
+		return e, fmt.Errorf("could not read emoji: %v", err)
+	}
+
+	ext, ok := emojiTypes[http.DetectContentType(head)]
+	if !ok {
+		return e, ErrUnsupportedEmojiFormat
+	}
+
+	filename := shortcode + ext
+	emojiPath := path.Join(emojisDir, filename)
+	f, err := os.Create(emojiPath)
+	if err != nil {
+		return e, fmt.Errorf("could not create emoji file: %v", err)
+	}
+
+	defer f.Close()
+
+	if _, err = io.Copy(f, br); err != nil {
+		defer os.Remove(emojiPath)
+		return e, fmt.Errorf("could not write emoji to disk: %v", err)
+	}
+
+	query := "INSERT INTO custom_emojis (shortcode, filename) VALUES ($1, $2)"
+	_, err = s.db.ExecContext(ctx, query, shortcode, filename)
+	if isUniqueViolation(err) {
+		return e, ErrShortcodeTaken
+	}
+
+	if err != nil {
+		defer os.Remove(emojiPath)
+		return e, fmt.Errorf("could not insert emoji: %v", err)
+	}
+
+	e.Shortcode = shortcode
+	e.URL = s.emojiURL(filename)
+	return e, nil
+}
+
+// DeleteEmoji by shortcode. Admin only.
+func (s *Service) DeleteEmoji(ctx context.Context, shortcode string) error {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return err
+	}
+
+	var filename string
+	query := "DELETE FROM custom_emojis WHERE shortcode = $1 RETURNING filename"
+	err := s.db.QueryRowContext(ctx, query, strings.Trim(shortcode, ":")).Scan(&filename)
+	if err == sql.ErrNoRows {
+		return ErrEmojiNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not delete emoji: %v", err)
+	}
+
+	if err = os.Remove(path.Join(emojisDir, filename)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not remove emoji file: %v", err)
+	}
+
+	return nil
+}
+
+// Emojis registered in the instance, sorted by shortcode.
+func (s *Service) Emojis(ctx context.Context) ([]Emoji, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT shortcode, filename FROM custom_emojis ORDER BY shortcode")
+	if err != nil {
+		return nil, fmt.Errorf("could not query select emojis: %v", err)
+	}
+
+	defer rows.Close()
+
+	return s.scanEmojis(rows)
+}
+
+// resolveEmojis returns the registered emojis used in the given texts by shortcode.
+func (s *Service) resolveEmojis(ctx context.Context, texts ...string) (map[string]Emoji, error) {
+	seen := map[string]bool{}
+	var shortcodes []string
+	for _, text := range texts {
+		for _, m := range reShortcode.FindAllStringSubmatch(text, -1) {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				shortcodes = append(shortcodes, m[1])
+			}
+		}
+	}
+
+	out := make(map[string]Emoji, len(shortcodes))
+	if len(shortcodes) == 0 {
+		return out, nil
+	}
+
+	query := "SELECT shortcode, filename FROM custom_emojis WHERE shortcode = ANY($1::VARCHAR[])"
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(shortcodes))
+	if err != nil {
+		return nil, fmt.Errorf("could not query select used emojis: %v", err)
+	}
+
+	defer rows.Close()
+
+	ee, err := s.scanEmojis(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range ee {
+		out[e.Shortcode] = e
+	}
+
+	return out, nil
+}
+
+// usedEmojis picks from the resolved emojis the ones used in text.
+func usedEmojis(emojis map[string]Emoji, text string) []Emoji {
+	var out []Emoji
+	seen := map[string]bool{}
+	for _, m := range reShortcode.FindAllStringSubmatch(text, -1) {
+		if e, ok := emojis[m[1]]; ok && !seen[m[1]] {
+			seen[m[1]] = true
+			out = append(out, e)
+		}
+	}
+
+	return out
+}
+
+// fillPostsEmojis sets the custom emojis used in each post content or spoiler.
+func (s *Service) fillPostsEmojis(ctx context.Context, pp []*Post) error {
+	texts := make([]string, 0, len(pp)*2)
+	for _, p := range pp {
+		texts = append(texts, p.Content)
+		if p.SpoilerOf != nil {
+			texts = append(texts, *p.SpoilerOf)
+		}
+	}
+
+	emojis, err := s.resolveEmojis(ctx, texts...)
+	if err != nil || len(emojis) == 0 {
+		return err
+	}
+
+	for _, p := range pp {
+		text := p.Content
+		if p.SpoilerOf != nil {
+			text = *p.SpoilerOf + " " + text
+		}
+
+		p.Emojis = usedEmojis(emojis, text)
+	}
+
+	return nil
+}
+
+// fillCommentsEmojis sets the custom emojis used in each comment content.
+func (s *Service) fillCommentsEmojis(ctx context.Context, cc []Comment) error {
+	texts := make([]string, len(cc))
+	for i, c := range cc {
+		texts[i] = c.Content
+	}
+
+	emojis, err := s.resolveEmojis(ctx, texts...)
+	if err != nil || len(emojis) == 0 {
+		return err
+	}
+
+	for i := range cc {
+		cc[i].Emojis = usedEmojis(emojis, cc[i].Content)
+	}
+
+	return nil
+}
+
+func (s *Service) scanEmojis(rows *sql.Rows) ([]Emoji, error) {
+	ee := []Emoji{}
+	for rows.Next() {
+		var e Emoji
+		var filename string
+		if err := rows.Scan(&e.Shortcode, &filename); err != nil {
+			return nil, fmt.Errorf("could not scan emoji: %v", err)
+		}
+
+		e.URL = s.emojiURL(filename)
+		ee = append(ee, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate emoji rows: %v", err)
+	}
+
+	return ee, nil
+}
+
+func (s *Service) emojiURL(filename string) string {
+	return s.origin + "/img/emojis/" + filename
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// Types of domain events.
+const (
+	EventPostCreated    = "post_created"
+	EventPostDeleted    = "post_deleted"
+	EventUserFollowed   = "user_followed"
+	EventUserUnfollowed = "user_unfollowed"
+	EventCommentCreated = "comment_created"
+)
+
+// Event is something that happened in the domain. Events are journaled in
+// the tx of the change and published once it commits, so side effects like
+// notifications and broadcasts run apart from the request that caused them.
+type Event interface {
+	EventType() string
+	// EventActor is the id of the user who caused the event.
+	EventActor() int64
+	// EventTarget is the id of what the event happened to, depending on its type.
+	EventTarget() int64
+}
+
+// PostCreated event. Its target is the post.
+type PostCreated struct {
+	Post Post `json:"post"`
+}
+
+// EventType of PostCreated.
+func (PostCreated) EventType() string { return EventPostCreated }
+
+// EventActor of PostCreated.
+func (e PostCreated) EventActor() int64 { return e.Post.UserID }
+
+// EventTarget of PostCreated.
+func (e PostCreated) EventTarget() int64 { return e.Post.ID }
+
+// PostDeleted event. Its actor is the author and its target the post.
+type PostDeleted struct {
+	UserID int64 `json:"userId"`
+	PostID int64 `json:"postId"`
+}
+
+// EventType of PostDeleted.
+func (PostDeleted) EventType() string { return EventPostDeleted }
+
+// EventActor of PostDeleted.
+func (e PostDeleted) EventActor() int64 { return e.UserID }
+
+// EventTarget of PostDeleted.
+func (e PostDeleted) EventTarget() int64 { return e.PostID }
+
+// UserFollowed event. Its target is the followee.
+type UserFollowed struct {
+	FollowerID int64 `json:"followerId"`
+	FolloweeID int64 `json:"followeeId"`
+}
+
+// EventType of UserFollowed.
+func (UserFollowed) EventType() string { return EventUserFollowed }
+
+// EventActor of UserFollowed.
+func (e UserFollowed) EventActor() int64 { return e.FollowerID }
+
+// EventTarget of UserFollowed.
+func (e UserFollowed) EventTarget() int64 { return e.FolloweeID }
+
+// UserUnfollowed event. Its target is the former followee.
+type UserUnfollowed struct {
+	FollowerID int64 `json:"followerId"`
+	FolloweeID int64 `json:"followeeId"`
+}
+
+// EventType of UserUnfollowed.
+func (UserUnfollowed) EventType() string { return EventUserUnfollowed }
+
+// EventActor of UserUnfollowed.
+func (e UserUnfollowed) EventActor() int64 { return e.FollowerID }
+
+// EventTarget of UserUnfollowed.
+func (e UserUnfollowed) EventTarget() int64 { return e.FolloweeID }
+
+// CommentCreated event. Its target is the commented post.
+type CommentCreated struct {
+	Comment Comment `json:"comment"`
+}
+
+// EventType of CommentCreated.
+func (CommentCreated) EventType() string { return EventCommentCreated }
+
+// EventActor of CommentCreated.
+func (e CommentCreated) EventActor() int64 { return e.Comment.UserID }
+
+// EventTarget of CommentCreated.
+func (e CommentCreated) EventTarget() int64 { return e.Comment.PostID }
+
+// EventHandler reacts to a domain event.
+type EventHandler func(ctx context.Context, e Event)
+
+// eventBus dispatches the events published by this process to its subscribers.
+type eventBus struct {
+	mu       sync.RWMutex
+	handlers map[string][]EventHandler
+}
+
+// Subscribe h to the events of the given type. Each handler runs in its own
+// goroutine, so a slow one holds back neither the request nor the others.
+func (s *Service) Subscribe(eventType string, h EventHandler) {
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+
+	if s.events.handlers == nil {
+		s.events.handlers = map[string][]EventHandler{}
+	}
+	s.events.handlers[eventType] = append(s.events.handlers[eventType], h)
+}
+
+// publish the event to its subscribers. Call it after the tx commits.
+func (s *Service) publish(e Event) {
+	s.events.mu.RLock()
+	handlers := s.events.handlers[e.EventType()]
+	s.events.mu.RUnlock()
+
+	for _, h := range handlers {
+		go h(context.Background(), e)
+	}
+}
+
+// subscribeEvents registers the side effects of the domain events.
+func (s *Service) subscribeEvents() {
+	s.Subscribe(EventPostCreated, func(ctx context.Context, e Event) {
+		s.fanout.Committed(e.(PostCreated).Post.ID)
+	})
+	s.Subscribe(EventPostCreated, func(ctx context.Context, e Event) {
+		s.notifyKeywordAlerts(e.(PostCreated).Post)
+	})
+	s.Subscribe(EventPostCreated, func(ctx context.Context, e Event) {
+		if p := e.(PostCreated).Post; len(p.Links) != 0 {
+			s.previewPostLinks(p.ID)
+		}
+	})
+
+	s.Subscribe(EventUserFollowed, func(ctx context.Context, e Event) {
+		ev := e.(UserFollowed)
+		s.notifyFollow(ev.FollowerID, ev.FolloweeID)
+	})
+
+	// The comments count of the post changed.
+	s.Subscribe(EventCommentCreated, func(ctx context.Context, e Event) {
+		s.purge(postPaths(e.(CommentCreated).Comment.PostID)...)
+	})
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+	"github.com/lib/pq"
+)
+
+// replayBatchSize is how many journaled events are read at once when replaying.
+const replayBatchSize = 500
+
+// journalPosition is how far a read model replayed the events journal.
+// Ids are taken on insert, so an event can commit after one with a greater id
+// however long its transaction takes; replays go by transaction instead.
+type journalPosition struct {
+	// eventID is the last event replayed. Events journaled without their
+	// transaction, before it was kept or as restored from a backup, are
+	// replayed past it.
+	eventID int64
+	// snapshot taken by the last replay. The events of the transactions
+	// it saw finished were replayed.
+	snapshot sql.NullString
+}
+
+// JournalEntry is a domain event as journaled.
+type JournalEntry struct {
+	ID       int64  `json:"id"`
+	Type     string `json:"type"`
+	ActorID  int64  `json:"actorId"`
+	TargetID int64  `json:"targetId"`
+	// Payload depends on the type.
+	Payload json.RawMessage `json:"payload"`
+	// Variants the actor was assigned in the experiments running then, by experiment.
+	Variants  map[string]string `json:"variants"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// recordEvent appends the event to the journal, tagged with the experiment
+// variants of its actor. Pass the tx of the change so the event is only kept
+// if the change is, then publish it once it commits.
+func (s *Service) recordEvent(ctx context.Context, tx execer, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("could not marshal %s event: %v", e.EventType(), err)
+	}
+
+	variants, err := s.experimentVariants(ctx, e.EventActor())
+	if err != nil {
+		return err
+	}
+
+	vb, err := json.Marshal(variants)
+	if err != nil {
+		return fmt.Errorf("could not marshal %s event variants: %v", e.EventType(), err)
+	}
+
+	query := `INSERT INTO events (type, actor_id, target_id, payload, variants, xact_id)
+		VALUES ($1, $2, $3, $4, $5, pg_current_xact_id())`
+	if _, err = tx.ExecContext(ctx, query, e.EventType(), e.EventActor(), e.EventTarget(), b, vb); err != nil {
+		return fmt.Errorf("could not insert %s event: %v", e.EventType(), err)
+	}
+
+	return nil
+}
+
+// decodeEvent back from its journal entry. The ids models leave out
+// of their JSON are restored from the actor and target.
+func decodeEvent(entry JournalEntry) (Event, error) {
+	var e Event
+	var err error
+	switch entry.Type {
+	case EventPostCreated:
+		var ev PostCreated
+		err = json.Unmarshal(entry.Payload, &ev)
+		ev.Post.UserID = entry.ActorID
+		e = ev
+	case EventPostDeleted:
+		var ev PostDeleted
+		err = json.Unmarshal(entry.Payload, &ev)
+		e = ev
+	case EventUserFollowed:
+		var ev UserFollowed
+		err = json.Unmarshal(entry.Payload, &ev)
+		e = ev
+	case EventUserUnfollowed:
+		var ev UserUnfollowed
+		err = json.Unmarshal(entry.Payload, &ev)
+		e = ev
+	case EventCommentCreated:
+		var ev CommentCreated
+		err = json.Unmarshal(entry.Payload, &ev)
+		ev.Comment.UserID = entry.ActorID
+		ev.Comment.PostID = entry.TargetID
+		e = ev
+	default:
+		return nil, fmt.Errorf("unknown event type %q", entry.Type)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal %s event: %v", entry.Type, err)
+	}
+
+	return e, nil
+}
+
+// replayEvents calls h with the journaled events of the given types past the
+// given position, by id, to backfill a new read model. Unlike publish it calls
+// h in order and without other subscribers seeing them again. Events of
+// transactions still in progress are left for a later replay, however long
+// they take to commit. It returns the position to replay from next.
+func (s *Service) replayEvents(ctx context.Context, types []string, from journalPosition, h EventHandler) (journalPosition, error) {
+	to := from
+	if err := s.db.QueryRowContext(ctx, "SELECT pg_current_snapshot()::text").Scan(&to.snapshot); err != nil {
+		return from, fmt.Errorf("could not query select snapshot: %v", err)
+	}
+
+	var after int64
+	for {
+		entries, err := s.journal(ctx, types, from, to, after, replayBatchSize)
+		if err != nil {
+			return from, err
+		}
+
+		for _, entry := range entries {
+			e, err := decodeEvent(entry)
+			if err != nil {
+				return from, err
+			}
+
+			h(ctx, e)
+			after = entry.ID
+			if after > to.eventID {
+				to.eventID = after
+			}
+		}
+
+		if len(entries) < replayBatchSize {
+			return to, nil
+		}
+	}
+}
+
+// journal reads the events after the given id whose transaction finished
+// between the from and to positions.
+func (s *Service) journal(ctx context.Context, types []string, from, to journalPosition, after int64, limit int) ([]JournalEntry, error) {
+	query, args, err := buildQuery(`
+		SELECT id, type, actor_id, target_id, payload, variants, created_at
+		FROM events
+		WHERE id > @after
+		AND ((xact_id IS NULL AND id > @checkpoint)
+			OR (xact_id >= COALESCE(pg_snapshot_xmin(@from::pg_snapshot), '0'::xid8)
+				AND pg_visible_in_snapshot(xact_id, @to::pg_snapshot)
+				AND (@from::pg_snapshot IS NULL OR NOT pg_visible_in_snapshot(xact_id, @from::pg_snapshot))))
+		{{if .types}}AND type = ANY(@types::VARCHAR[]){{end}}
+		ORDER BY id
+		LIMIT @limit`, map[string]interface{}{
+		"after":      after,
+		"checkpoint": from.eventID,
+		"from":       from.snapshot,
+		"to":         to.snapshot,
+		"types":      pq.StringArray(types),
+		"limit":      limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build events journal sql query: %v", err)
+	}
+
+	return s.queryJournal(ctx, query, args, limit)
+}
+
+// EventJournal of domain events, newest first with backward pagination,
+// optionally of a single type. Only admins can read it.
+func (s *Service) EventJournal(ctx context.Context, eventType string, last int, before int64) ([]JournalEntry, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	var v validation.Validator
+	v.Cursor("before", before)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	last = validation.PageSize(last)
+	query, args, err := buildQuery(`
+		SELECT id, type, actor_id, target_id, payload, variants, created_at
+		FROM events
+		WHERE true
+		{{if .type}}AND type = @type{{end}}
+		{{if .before}}AND id < @before{{end}}
+		ORDER BY id DESC
+		LIMIT @last`, map[string]interface{}{
+		"type":   eventType,
+		"before": before,
+		"last":   last,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build events journal sql query: %v", err)
+	}
+
+	return s.queryJournal(ctx, query, args, last)
+}
+
+func (s *Service) queryJournal(ctx context.Context, query string, args []interface{}, limit int) ([]JournalEntry, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select events: %v", err)
+	}
+
+	defer rows.Close()
+
+	ee := make([]JournalEntry, 0, limit)
+	for rows.Next() {
+		var e JournalEntry
+		var payload, variants []byte
+		if err = rows.Scan(&e.ID, &e.Type, &e.ActorID, &e.TargetID, &payload, &variants, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan event: %v", err)
+		}
+
+		if err = json.Unmarshal(variants, &e.Variants); err != nil {
+			return nil, fmt.Errorf("could not unmarshal event variants: %v", err)
+		}
+
+		e.Payload = payload
+		ee = append(ee, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate event rows: %v", err)
+	}
+
+	return ee, nil
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// MaxExperimentVariants an experiment can split users between.
+const MaxExperimentVariants = 10
+
+// ErrExperimentNotFound denotes an experiment that was not found
+var ErrExperimentNotFound = errors.New("experiment not found")
+
+// Experiment splits users between variants to compare them. While running,
+// each user is assigned a variant by a stable hash of their id, weighted by the
+// traffic split. Changing the split reassigns part of the users.
+type Experiment struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Running     bool                `json:"running"`
+	Variants    []ExperimentVariant `json:"variants"`
+	UpdatedAt   time.Time           `json:"updatedAt"`
+}
+
+// ExperimentVariant gets the given percentage of the users.
+type ExperimentVariant struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// SetExperimentInput request
+type SetExperimentInput struct {
+	Description string
+	Running     bool
+	Variants    []ExperimentVariant
+}
+
+// ExperimentAssignment is the variant a user is in.
+type ExperimentAssignment struct {
+	Experiment string `json:"experiment"`
+	Variant    string `json:"variant"`
+}
+
+// assignVariant picks the variant of the user by their bucket, stable per
+// experiment and apart from the feature flag ones.
+func assignVariant(name string, variants []ExperimentVariant, uid int64) string {
+	bucket := rolloutBucket("experiment:"+name, uid)
+	for _, v := range variants {
+		if bucket < v.Weight {
+			return v.Name
+		}
+		bucket -= v.Weight
+	}
+	return ""
+}
+
+// experimentVariants the user is assigned in the running experiments, by experiment name.
+func (s *Service) experimentVariants(ctx context.Context, uid int64) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT name, variants FROM experiments WHERE running")
+	if err != nil {
+		return nil, fmt.Errorf("could not query select running experiments: %v", err)
+	}
+
+	defer rows.Close()
+
+	assigned := map[string]string{}
+	for rows.Next() {
+		var name string
+		var b []byte
+		if err = rows.Scan(&name, &b); err != nil {
+			return nil, fmt.Errorf("could not scan experiment: %v", err)
+		}
+
+		var variants []ExperimentVariant
+		if err = json.Unmarshal(b, &variants); err != nil {
+			return nil, fmt.Errorf("could not unmarshal experiment variants: %v", err)
+		}
+
+		if v := assignVariant(name, variants, uid); v != "" {
+			assigned[name] = v
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate experiment rows: %v", err)
+	}
+
+	return assigned, nil
+}
+
+// ExperimentAssignments of the authenticated user in the running experiments,
+// so clients can adapt their UI. Anonymous requests are in none, as they have
+// no stable id.
+func (s *Service) ExperimentAssignments(ctx context.Context) ([]ExperimentAssignment, error) {
+	aa := []ExperimentAssignment{}
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return aa, nil
+	}
+
+	assigned, err := s.experimentVariants(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, variant := range assigned {
+		aa = append(aa, ExperimentAssignment{Experiment: name, Variant: variant})
+	}
+
+	sort.Slice(aa, func(i, j int) bool { return aa[i].Experiment < aa[j].Experiment })
+	return aa, nil
+}
+
+// Experiments of the instance. Admin only.
+func (s *Service) Experiments(ctx context.Context) ([]Experiment, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT name, description, running, variants, updated_at FROM experiments ORDER BY name"
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select experiments: %v", err)
+	}
+
+	defer rows.Close()
+
+	ee := []Experiment{}
+	for rows.Next() {
+		var e Experiment
+		var b []byte
+		if err = rows.Scan(&e.Name, &e.Description, &e.Running, &b, &e.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan experiment: %v", err)
+		}
+
+		if err = json.Unmarshal(b, &e.Variants); err != nil {
+			return nil, fmt.Errorf("could not unmarshal experiment variants: %v", err)
+		}
+
+		ee = append(ee, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate experiment rows: %v", err)
+	}
+
+	return ee, nil
+}
+
+// SetExperiment creates or updates an experiment. The variant weights
+// are percentages and must add up to 100. Admin only.
+func (s *Service) SetExperiment(ctx context.Context, name string, in SetExperimentInput) (Experiment, error) {
+	var e Experiment
+	if _, err := s.authAdmin(ctx); err != nil {
+		return e, err
+	}
+
+	name = strings.TrimSpace(name)
+	in.Description = strings.TrimSpace(in.Description)
+	var v validation.Validator
+	v.Slug("name", name)
+	v.Check(utf8.RuneCountInString(in.Description) <= validation.MaxPostLength, "description", "too long")
+	v.Check(len(in.Variants) >= 2, "variants", "at least two are needed")
+	v.Check(len(in.Variants) <= MaxExperimentVariants, "variants", "too many variants")
+	total := 0
+	seen := map[string]bool{}
+	for i, variant := range in.Variants {
+		variant.Name = strings.TrimSpace(variant.Name)
+		v.Slug("variants", variant.Name)
+		v.Check(!seen[variant.Name], "variants", "duplicated name")
+		v.Check(variant.Weight >= 0, "variants", "weights can't be negative")
+		seen[variant.Name] = true
+		total += variant.Weight
+		in.Variants[i] = variant
+	}
+	v.Check(total == 100, "variants", "weights must add up to 100")
+	if err := v.Err(); err != nil {
+		return e, err
+	}
+
+	b, err := json.Marshal(in.Variants)
+	if err != nil {
+		return e, fmt.Errorf("could not marshal experiment variants: %v", err)
+	}
+
+	query := `INSERT INTO experiments (name, description, running, variants) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE SET
+			description = EXCLUDED.description,
+			running = EXCLUDED.running,
+			variants = EXCLUDED.variants,
+			updated_at = now()
+		RETURNING updated_at`
+	if err = s.db.QueryRowContext(ctx, query, name, in.Description, in.Running, b).Scan(&e.UpdatedAt); err != nil {
+		return e, fmt.Errorf("could not upsert experiment: %v", err)
+	}
+
+	e.Name = name
+	e.Description = in.Description
+	e.Running = in.Running
+	e.Variants = in.Variants
+	return e, nil
+}
+
+// DeleteExperiment ends an experiment for good. Events already tagged
+// with its variants keep them. Admin only.
+func (s *Service) DeleteExperiment(ctx context.Context, name string) error {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM experiments WHERE name = $1", strings.TrimSpace(name))
+	if err != nil {
+		return fmt.Errorf("could not delete experiment: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrExperimentNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/sqs"
+)
+
+// Fanout strategies, from the simplest to the one scaling furthest.
+const (
+	// FanoutSync delivers a post within the tx creating it.
+	FanoutSync = "sync"
+	// FanoutQueue delivers posts from a bounded queue in the memory of the
+	// process that created them, shedding them to pull when it's full.
+	FanoutQueue = "queue"
+	// FanoutOutbox delivers posts from an outbox table drained by the workers of every instance.
+	FanoutOutbox = "outbox"
+	// FanoutSQS delivers posts from an Amazon SQS queue.
+	FanoutSQS = "sqs"
+)
+
+// fanoutWorkers delivering posts at once per process.
+const fanoutWorkers = 4
+
+// shedPullWindow is how old a shed post can be and still be pulled into timelines.
+const shedPullWindow = 7 * 24 * time.Hour
+
+// Fanout moves new posts to the timelines of the followers of their author
+// and the members of their community.
+type Fanout interface {
+	// Enqueue the post from within the tx creating it.
+	Enqueue(ctx context.Context, tx *sql.Tx, postID int64) error
+	// Committed is called once the tx creating the post commits.
+	Committed(postID int64)
+	// Pending reports how many posts wait to be delivered.
+	Pending(ctx context.Context) (int, error)
+	// Run delivers the enqueued posts until ctx is done.
+	Run(ctx context.Context)
+}
+
+// FanoutStats of this process since it started.
+type FanoutStats struct {
+	Strategy   string `json:"strategy"`
+	QueueDepth int    `json:"queueDepth"`
+	// QueueCapacity is set on the queue strategy, the only one with a bound.
+	QueueCapacity int   `json:"queueCapacity,omitempty"`
+	Fanned        int64 `json:"fanned"`
+	Failed        int64 `json:"failed"`
+	Shed          int64 `json:"shed"`
+	// AvgDurationMS and MaxDurationMS of fanning out a single post.
+	AvgDurationMS float64 `json:"avgDurationMs"`
+	MaxDurationMS float64 `json:"maxDurationMs"`
+	// LagMS from the creation of the last fanned out post until it reached timelines.
+	LagMS float64 `json:"lagMs"`
+}
+
+// fanoutMetrics counts the posts delivered by this process.
+type fanoutMetrics struct {
+	fanned        atomic.Int64
+	failed        atomic.Int64
+	shed          atomic.Int64
+	totalDuration atomic.Int64
+	maxDuration   atomic.Int64
+	lag           atomic.Int64
+}
+
+func (m *fanoutMetrics) observe(d, lag time.Duration) {
+	m.fanned.Add(1)
+	m.totalDuration.Add(int64(d))
+	m.lag.Store(int64(lag))
+	for {
+		max := m.maxDuration.Load()
+		if int64(d) <= max || m.maxDuration.CompareAndSwap(max, int64(d)) {
+			return
+		}
+	}
+}
+
+// newFanout returns the given strategy, defaulting to FanoutQueue.
+// queue is required by FanoutSQS.
+func (s *Service) newFanout(strategy string, queue *sqs.Client) Fanout {
+	switch strategy {
+	case FanoutSync:
+		return &syncFanout{s: s}
+	case FanoutOutbox:
+		return &outboxFanout{s: s, nudge: make(chan struct{}, 1)}
+	case FanoutSQS:
+		return &sqsFanout{s: s, queue: queue}
+	}
+
+	return &queueFanout{s: s, posts: make(chan int64, fanoutQueueSize)}
+}
+
+// FanoutStats reports how far behind the fanout of posts is. Admin only.
+// Counters are per process and reset on restart.
+func (s *Service) FanoutStats(ctx context.Context) (FanoutStats, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return FanoutStats{}, err
+	}
+
+	pending, err := s.fanout.Pending(ctx)
+	if err != nil {
+		return FanoutStats{}, err
+	}
+
+	m := &s.fanoutMetrics
+	out := FanoutStats{
+		Strategy:      s.fanoutStrategy,
+		QueueDepth:    pending,
+		Fanned:        m.fanned.Load(),
+		Failed:        m.failed.Load(),
+		Shed:          m.shed.Load(),
+		MaxDurationMS: ms(time.Duration(m.maxDuration.Load())),
+		LagMS:         ms(time.Duration(m.lag.Load())),
+	}
+	if q, ok := s.fanout.(*queueFanout); ok {
+		out.QueueCapacity = cap(q.posts)
+	}
+	if out.Fanned != 0 {
+		out.AvgDurationMS = ms(time.Duration(m.totalDuration.Load() / out.Fanned))
+	}
+
+	return out, nil
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// FanoutPosts runs the fanout workers of this process until ctx is done.
+// With the outbox and SQS strategies they can run apart from the http server.
+func (s *Service) FanoutPosts(ctx context.Context) {
+	s.fanout.Run(ctx)
+}
+
+// deliverPost to the timelines of its recipients, then notifies and broadcasts it.
+// Posts deleted or archived in the meantime are skipped.
+func (s *Service) deliverPost(ctx context.Context, postID int64) error {
+	p, err := s.Post(ctx, postID)
+	if err == ErrPostNotFound {
+		return nil
+	}
+
+	if err != nil {
+		s.fanoutMetrics.failed.Add(1)
+		return err
+	}
+
+	start := time.Now()
+	tt, err := s.fanoutPost(ctx, s.db, postID)
+	if err != nil {
+		s.fanoutMetrics.failed.Add(1)
+		return err
+	}
+
+	s.fanoutMetrics.observe(time.Since(start), time.Since(p.CreatedAt))
+	s.announcePost(p, tt)
+	return nil
+}
+
+// announcePost notifies the subscribers of the author of a delivered post
+// and broadcasts its timeline items.
+func (s *Service) announcePost(p Post, tt []TimelineItem) {
+	s.notifyPostSubscribers(p.ID)
+
+	for _, ti := range tt {
+		ti.Post = p
+		s.broadcastTimelineItem(ti)
+	}
+}
+
+// fanoutPost inserts the post into the timeline of the followers of its author
+// and the members of its community.
+func (s *Service) fanoutPost(ctx context.Context, db queryer, postID int64) ([]TimelineItem, error) {
+	query := `INSERT INTO timeline (user_id, post_id)
+		SELECT r.user_id, p.id FROM posts p, LATERAL (
+			SELECT follower_id AS user_id FROM follows WHERE followee_id = p.user_id
+			UNION SELECT user_id FROM community_members WHERE community_id = p.community_id AND user_id <> p.user_id
+		) AS r
+		WHERE p.id = $1
+		ON CONFLICT DO NOTHING
+		RETURNING id, user_id`
+	rows, err := db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, fmt.Errorf("could not insert timeline : %v", err)
+	}
+
+	defer rows.Close()
+
+	tt := []TimelineItem{}
+	for rows.Next() {
+		ti := TimelineItem{PostID: postID}
+		if err = rows.Scan(&ti.ID, &ti.UserID); err != nil {
+			return nil, fmt.Errorf("could not scan timeline item : %v", err)
+		}
+
+		tt = append(tt, ti)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate timeline rows : %v", err)
+	}
+
+	return tt, nil
+}
+
+// shedFanout leaves the post to the pull model: instead of being pushed into
+// the timeline of each recipient, they pull it into their own timeline when
+// they next read it. Subscribers are still notified.
+func (s *Service) shedFanout(postID int64) {
+	s.fanoutMetrics.shed.Add(1)
+	if _, err := s.db.Exec("UPDATE posts SET fanout_shed = true WHERE id = $1", postID); err != nil {
+		s.fanoutMetrics.failed.Add(1)
+		log.Printf("could not shed post fanout: %v\n", err)
+		return
+	}
+
+	s.notifyPostSubscribers(postID)
+}
+
+// pullShedPosts inserts into the timeline of the given user the recent shed
+// posts of the users they follow and the communities they are a member of.
+func (s *Service) pullShedPosts(ctx context.Context, uid int64) error {
+	query := `INSERT INTO timeline (user_id, post_id)
+		SELECT $1, p.id FROM posts p
+		WHERE p.fanout_shed AND p.created_at > now() - $2::INTERVAL AND p.user_id <> $1
+		AND (
+			p.user_id IN (SELECT followee_id FROM follows WHERE follower_id = $1)
+			OR p.community_id IN (SELECT community_id FROM community_members WHERE user_id = $1)
+		)
+		ORDER BY p.id
+		ON CONFLICT DO NOTHING`
+	if _, err := s.db.ExecContext(ctx, query, uid, interval(shedPullWindow)); err != nil {
+		return fmt.Errorf("could not pull shed posts: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/sqs"
+)
+
+// fanoutQueueSize bounds the posts waiting to be fanned out by the queue strategy.
+// Once full, new posts are shed to the pull model instead of queueing further.
+const fanoutQueueSize = 256
+
+// Outbox polling, for when no post created by this process nudges the workers,
+// and retrying posts that failed, with a backoff growing with each attempt.
+const (
+	outboxPollInterval = time.Second
+	outboxRetryBackoff = 10 * time.Second
+	outboxMaxBackoff   = 10 * time.Minute
+)
+
+// sqsReceiveWait long polls the queue for up to this long.
+const sqsReceiveWait = 20 * time.Second
+
+// syncFanout delivers posts within the tx creating them, so they are in every
+// timeline as soon as the post exists. Creating a post takes as long as the
+// fanout does, which suits small instances.
+type syncFanout struct {
+	s *Service
+}
+
+func (f *syncFanout) Enqueue(ctx context.Context, tx *sql.Tx, postID int64) error {
+	start := time.Now()
+	if _, err := f.s.fanoutPost(ctx, tx, postID); err != nil {
+		f.s.fanoutMetrics.failed.Add(1)
+		return err
+	}
+
+	f.s.fanoutMetrics.observe(time.Since(start), time.Since(start))
+	return nil
+}
+
+func (f *syncFanout) Committed(postID int64) {
+	ctx := context.Background()
+	p, err := f.s.Post(ctx, postID)
+	if err != nil {
+		log.Printf("could not get delivered post: %v\n", err)
+		return
+	}
+
+	query := "SELECT id, user_id FROM timeline WHERE post_id = $1 AND user_id <> (SELECT user_id FROM posts WHERE id = $1)"
+	rows, err := f.s.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		log.Printf("could not query select delivered timeline items: %v\n", err)
+		return
+	}
+
+	defer rows.Close()
+
+	var tt []TimelineItem
+	for rows.Next() {
+		ti := TimelineItem{PostID: postID}
+		if err = rows.Scan(&ti.ID, &ti.UserID); err != nil {
+			log.Printf("could not scan delivered timeline item: %v\n", err)
+			return
+		}
+
+		tt = append(tt, ti)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("could not iterate delivered timeline item rows: %v\n", err)
+		return
+	}
+
+	f.s.announcePost(p, tt)
+}
+
+func (f *syncFanout) Pending(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (f *syncFanout) Run(ctx context.Context) {
+	<-ctx.Done()
+}
+
+// queueFanout delivers posts from a bounded queue in memory with a fixed number
+// of workers. When the queue is full, or the process stops, posts are shed to pull.
+type queueFanout struct {
+	s     *Service
+	posts chan int64
+}
+
+func (f *queueFanout) Enqueue(ctx context.Context, tx *sql.Tx, postID int64) error {
+	return nil
+}
+
+// Committed hands the post to the workers without blocking.
+func (f *queueFanout) Committed(postID int64) {
+	select {
+	case f.posts <- postID:
+	default:
+		log.Printf("fanout queue is full, shedding post %d to pull\n", postID)
+		f.s.shedFanout(postID)
+	}
+}
+
+func (f *queueFanout) Pending(ctx context.Context) (int, error) {
+	return len(f.posts), nil
+}
+
+func (f *queueFanout) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < fanoutWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case postID := <-f.posts:
+					if err := f.s.deliverPost(context.Background(), postID); err != nil {
+						log.Printf("could not fanout post : %v\n", err)
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for {
+		select {
+		case postID := <-f.posts:
+			f.s.shedFanout(postID)
+		default:
+			return
+		}
+	}
+}
+
+// outboxFanout records posts in an outbox table within the tx creating them,
+// so none is lost, and delivers them with workers on any instance.
+type outboxFanout struct {
+	s     *Service
+	nudge chan struct{}
+}
+
+func (f *outboxFanout) Enqueue(ctx context.Context, tx *sql.Tx, postID int64) error {
+	if _, err := tx.ExecContext(ctx, "INSERT INTO fanout_outbox (post_id) VALUES ($1)", postID); err != nil {
+		return fmt.Errorf("could not insert fanout outbox: %v", err)
+	}
+
+	return nil
+}
+
+// Committed wakes up a worker of this process instead of waiting for the next poll.
+func (f *outboxFanout) Committed(postID int64) {
+	select {
+	case f.nudge <- struct{}{}:
+	default:
+	}
+}
+
+func (f *outboxFanout) Pending(ctx context.Context) (int, error) {
+	var n int
+	if err := f.s.db.QueryRowContext(ctx, "SELECT count(*) FROM fanout_outbox").Scan(&n); err != nil {
+		return 0, fmt.Errorf("could not query select fanout outbox count: %v", err)
+	}
+
+	return n, nil
+}
+
+func (f *outboxFanout) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < fanoutWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ticker := time.NewTicker(outboxPollInterval)
+			defer ticker.Stop()
+
+			for {
+				delivered, err := f.deliverNext(ctx)
+				if err != nil {
+					log.Printf("could not deliver fanout outbox: %v\n", err)
+				}
+
+				if delivered {
+					continue
+				}
+
+				select {
+				case <-f.nudge:
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// deliverNext claims the oldest post available in the outbox and delivers it,
+// reporting whether there was one. The row stays locked while delivering so no
+// other worker takes it, and is removed once delivered or scheduled for a retry.
+func (f *outboxFanout) deliverNext(ctx context.Context) (bool, error) {
+	tx, err := f.s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	var postID int64
+	var attempts int
+	query := `SELECT post_id, attempts FROM fanout_outbox
+		WHERE available_at <= now()
+		ORDER BY post_id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`
+	err = tx.QueryRowContext(ctx, query).Scan(&postID, &attempts)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("could not query select fanout outbox: %v", err)
+	}
+
+	if err = f.s.deliverPost(ctx, postID); err != nil {
+		log.Printf("could not fanout post : %v\n", err)
+
+		backoff := outboxRetryBackoff << attempts
+		if backoff > outboxMaxBackoff || backoff <= 0 {
+			backoff = outboxMaxBackoff
+		}
+
+		query = "UPDATE fanout_outbox SET attempts = attempts + 1, available_at = now() + $1::INTERVAL WHERE post_id = $2"
+		if _, err = tx.ExecContext(ctx, query, interval(backoff), postID); err != nil {
+			return false, fmt.Errorf("could not update fanout outbox attempts: %v", err)
+		}
+	} else if _, err = tx.ExecContext(ctx, "DELETE FROM fanout_outbox WHERE post_id = $1", postID); err != nil {
+		return false, fmt.Errorf("could not delete fanout outbox: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("could not commit fanout outbox: %v", err)
+	}
+
+	return true, nil
+}
+
+// sqsFanout sends posts to an Amazon SQS queue, delivered by workers on any
+// instance. Posts that can't be sent are shed to pull. Failed deliveries are
+// retried by SQS once their visibility timeout runs out.
+type sqsFanout struct {
+	s     *Service
+	queue *sqs.Client
+}
+
+func (f *sqsFanout) Enqueue(ctx context.Context, tx *sql.Tx, postID int64) error {
+	return nil
+}
+
+func (f *sqsFanout) Committed(postID int64) {
+	if err := f.queue.Send(context.Background(), strconv.FormatInt(postID, 10)); err != nil {
+		log.Printf("could not send post %d to fanout queue, shedding it to pull: %v\n", postID, err)
+		f.s.shedFanout(postID)
+	}
+}
+
+func (f *sqsFanout) Pending(ctx context.Context) (int, error) {
+	return f.queue.ApproximateMessages(ctx)
+}
+
+func (f *sqsFanout) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < fanoutWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				mm, err := f.queue.Receive(ctx, 10, sqsReceiveWait)
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("could not receive from fanout queue: %v\n", err)
+						time.Sleep(outboxPollInterval)
+					}
+					continue
+				}
+
+				for _, m := range mm {
+					f.deliver(m)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (f *sqsFanout) deliver(m sqs.Message) {
+	ctx := context.Background()
+	postID, err := strconv.ParseInt(m.Body, 10, 64)
+	if err != nil {
+		log.Printf("could not parse fanout queue message %q: %v\n", m.Body, err)
+	} else if err = f.s.deliverPost(ctx, postID); err != nil {
+		log.Printf("could not fanout post : %v\n", err)
+		return
+	}
+
+	if err = f.queue.Delete(ctx, m.ReceiptHandle); err != nil {
+		log.Printf("could not delete fanout queue message: %v\n", err)
+	}
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/djomlaa/socnet/internal/validation"
+	"github.com/lib/pq"
+)
+
+// ErrFeatureFlagNotFound denotes a feature flag that was not found
+var ErrFeatureFlagNotFound = errors.New("feature flag not found")
+
+// FeatureFlag gates a capability. A disabled flag is off for everyone.
+// An enabled flag is on for the listed users and for a stable Rollout
+// percentage of the rest; anonymous requests only see it at 100.
+type FeatureFlag struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Enabled     bool      `json:"enabled"`
+	Rollout     int       `json:"rollout"`
+	Users       []string  `json:"users"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// SetFeatureFlagInput request
+type SetFeatureFlagInput struct {
+	Description string
+	Enabled     bool
+	Rollout     int
+}
+
+// rolloutBucket places a user in 0..99, stable per flag so each flag
+// rolls out to a different slice of users.
+func rolloutBucket(flag string, uid int64) int {
+	h := fnv.New32a()
+	h.Write([]byte(flag + ":" + strconv.FormatInt(uid, 10)))
+	return int(h.Sum32() % 100)
+}
+
+func featureOn(name string, enabled bool, rollout int, listed bool, uid int64, auth bool) bool {
+	if !enabled {
+		return false
+	}
+
+	if rollout >= 100 {
+		return true
+	}
+
+	return auth && (listed || rolloutBucket(name, uid) < rollout)
+}
+
+// FeatureEnabled reports whether the flag is on for the authenticated user,
+// or for anonymous requests. Unknown flags are off.
+func (s *Service) FeatureEnabled(ctx context.Context, name string) (bool, error) {
+	uid, auth := ctx.Value(KeyAuthUserID).(int64)
+
+	var enabled, listed bool
+	var rollout int
+	query := `SELECT enabled, rollout, EXISTS (
+		SELECT 1 FROM feature_flag_users WHERE flag_name = feature_flags.name AND user_id = $2
+	) FROM feature_flags WHERE name = $1`
+	err := s.db.QueryRowContext(ctx, query, name, uid).Scan(&enabled, &rollout, &listed)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("could not query select feature flag: %v", err)
+	}
+
+	return featureOn(name, enabled, rollout, listed, uid, auth), nil
+}
+
+// Features lists the names of the flags that are on for the authenticated user,
+// or for anonymous requests, so clients can adapt their UI.
+func (s *Service) Features(ctx context.Context) ([]string, error) {
+	uid, auth := ctx.Value(KeyAuthUserID).(int64)
+
+	query := `SELECT name, rollout, EXISTS (
+		SELECT 1 FROM feature_flag_users WHERE flag_name = feature_flags.name AND user_id = $1
+	) FROM feature_flags WHERE enabled ORDER BY name`
+	rows, err := s.db.QueryContext(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select features: %v", err)
+	}
+
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		var rollout int
+		var listed bool
+		if err = rows.Scan(&name, &rollout, &listed); err != nil {
+			return nil, fmt.Errorf("could not scan feature: %v", err)
+		}
+
+		if featureOn(name, true, rollout, listed, uid, auth) {
+			names = append(names, name)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate feature rows: %v", err)
+	}
+
+	return names, nil
+}
+
+// FeatureFlags of the instance. Admin only.
+func (s *Service) FeatureFlags(ctx context.Context) ([]FeatureFlag, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT name, description, enabled, rollout, updated_at, ARRAY(
+		SELECT u.username FROM feature_flag_users ffu
+		INNER JOIN users u ON ffu.user_id = u.id
+		WHERE ffu.flag_name = feature_flags.name
+		ORDER BY u.username
+	) FROM feature_flags ORDER BY name`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select feature flags: %v", err)
+	}
+
+	defer rows.Close()
+
+	ff := []FeatureFlag{}
+	for rows.Next() {
+		var f FeatureFlag
+		if err = rows.Scan(&f.Name, &f.Description, &f.Enabled, &f.Rollout, &f.UpdatedAt, (*pq.StringArray)(&f.Users)); err != nil {
+			return nil, fmt.Errorf("could not scan feature flag: %v", err)
+		}
+
+		ff = append(ff, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate feature flag rows: %v", err)
+	}
+
+	return ff, nil
+}
+
+// SetFeatureFlag creates or updates a feature flag. Admin only.
+func (s *Service) SetFeatureFlag(ctx context.Context, name string, in SetFeatureFlagInput) (FeatureFlag, error) {
+	var f FeatureFlag
+	if _, err := s.authAdmin(ctx); err != nil {
+		return f, err
+	}
+
+	name = strings.TrimSpace(name)
+	in.Description = strings.TrimSpace(in.Description)
+	var v validation.Validator
+	v.Slug("name", name)
+	v.Check(utf8.RuneCountInString(in.Description) <= validation.MaxPostLength, "description", "too long")
+	v.Check(in.Rollout >= 0 && in.Rollout <= 100, "rollout", "must be a percentage between 0 and 100")
+	if err := v.Err(); err != nil {
+		return f, err
+	}
+
+	query := `INSERT INTO feature_flags (name, description, enabled, rollout) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE SET
+			description = EXCLUDED.description,
+			enabled = EXCLUDED.enabled,
+			rollout = EXCLUDED.rollout,
+			updated_at = now()
+		RETURNING updated_at, ARRAY(
+			SELECT u.username FROM feature_flag_users ffu
+			INNER JOIN users u ON ffu.user_id = u.id
+			WHERE ffu.flag_name = $1
+			ORDER BY u.username
+		)`
+	err := s.db.QueryRowContext(ctx, query, name, in.Description, in.Enabled, in.Rollout).Scan(&f.UpdatedAt, (*pq.StringArray)(&f.Users))
+	if err != nil {
+		return f, fmt.Errorf("could not upsert feature flag: %v", err)
+	}
+
+	f.Name = name
+	f.Description = in.Description
+	f.Enabled = in.Enabled
+	f.Rollout = in.Rollout
+	return f, nil
+}
+
+// DeleteFeatureFlag removes a feature flag, turning it off for everyone. Admin only.
+func (s *Service) DeleteFeatureFlag(ctx context.Context, name string) error {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM feature_flags WHERE name = $1", strings.TrimSpace(name))
+	if err != nil {
+		return fmt.Errorf("could not delete feature flag: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrFeatureFlagNotFound
+	}
+
+	return nil
+}
+
+// SetFeatureFlagUser adds a user to the flag or removes them from it,
+// letting them in regardless of the rollout percentage. Admin only.
+func (s *Service) SetFeatureFlagUser(ctx context.Context, name, username string, listed bool) error {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return err
+	}
+
+	name = strings.TrimSpace(name)
+	username = validation.NormalizeUsername(username)
+	var v validation.Validator
+	v.Slug("name", name)
+	v.Username("username", username)
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	var exists bool
+	var userID sql.NullInt64
+	query := `SELECT EXISTS (SELECT 1 FROM feature_flags WHERE name = $1),
+		(SELECT id FROM users WHERE lower(username) = lower($2))`
+	if err := s.db.QueryRowContext(ctx, query, name, username).Scan(&exists, &userID); err != nil {
+		return fmt.Errorf("could not query select feature flag user: %v", err)
+	}
+
+	if !exists {
+		return ErrFeatureFlagNotFound
+	}
+
+	if !userID.Valid {
+		return ErrUserNotFound
+	}
+
+	query = "DELETE FROM feature_flag_users WHERE flag_name = $1 AND user_id = $2"
+	if listed {
+		query = "INSERT INTO feature_flag_users (flag_name, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	}
+	if _, err := s.db.ExecContext(ctx, query, name, userID.Int64); err != nil {
+		return fmt.Errorf("could not update feature flag user: %v", err)
+	}
+
+	return nil
+}
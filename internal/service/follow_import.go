@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+	"github.com/lib/pq"
+)
+
+// MaxFollowImportRows accepted in a single import.
+const MaxFollowImportRows = 5000
+
+// FollowImportRetryInterval is how often imports paused at the follow limits
+// are tried again.
+const FollowImportRetryInterval = 15 * time.Minute
+
+// FollowImportStaleAfter is how long a running import can go without progress
+// before it is taken as abandoned, like by a restart, and resumed.
+const FollowImportStaleAfter = 5 * time.Minute
+
+// Follow import and row statuses.
+const (
+	FollowImportPending     = "pending"
+	FollowImportRunning     = "running"
+	FollowImportDone        = "done"
+	FollowImportRowFollowed = "followed"
+	FollowImportRowSkipped  = "skipped"
+	FollowImportRowFailed   = "failed"
+)
+
+var (
+	// ErrFollowImportNotFound denotes a follow import that was not found
+	ErrFollowImportNotFound = errors.New("follow import not found")
+)
+
+// FollowImport is the progress of an asynchronous bulk follow.
+type FollowImport struct {
+	ID         int64             `json:"id"`
+	Status     string            `json:"status"`
+	Total      int               `json:"total"`
+	Processed  int               `json:"processed"`
+	Failed     int               `json:"failed"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	FinishedAt *time.Time        `json:"finishedAt"`
+	Rows       []FollowImportRow `json:"rows,omitempty"`
+}
+
+// FollowImportRow is the outcome of following a single username.
+type FollowImportRow struct {
+	Row      int     `json:"row"`
+	Username string  `json:"username"`
+	Status   string  `json:"status"`
+	Error    *string `json:"error"`
+}
+
+// ImportFollows of the authenticated user.
+// Usernames are followed in the background; progress is reported by FollowImport.
+// Imported follows count against the follow limits: once reached, the import
+// goes back to pending until ResumeFollowImports tries it again. Imports cut
+// short by a restart are resumed by it too.
+func (s *Service) ImportFollows(ctx context.Context, usernames []string) (FollowImport, error) {
+	var fi FollowImport
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return fi, ErrUnauthenticated
+	}
+
+	var v validation.Validator
+	v.Check(len(usernames) != 0, "usernames", "cannot be empty")
+	v.Check(len(usernames) <= MaxFollowImportRows, "usernames", "too many usernames")
+	if err := v.Err(); err != nil {
+		return fi, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fi, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	query := "INSERT INTO follow_imports (user_id, total) VALUES ($1, $2) RETURNING id, created_at"
+	if err = tx.QueryRowContext(ctx, query, uid, len(usernames)).Scan(&fi.ID, &fi.CreatedAt); err != nil {
+		return fi, fmt.Errorf("could not insert follow import: %v", err)
+	}
+
+	for i := range usernames {
+		usernames[i] = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(usernames[i]), "@"))
+	}
+
+	query = `INSERT INTO follow_import_rows (import_id, row, username)
+		SELECT $1, row, username FROM unnest($2::VARCHAR[]) WITH ORDINALITY AS t(username, row)`
+	if _, err = tx.ExecContext(ctx, query, fi.ID, pq.Array(usernames)); err != nil {
+		return fi, fmt.Errorf("could not insert follow import rows: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fi, fmt.Errorf("could not commit follow import: %v", err)
+	}
+
+	fi.Status = FollowImportPending
+	fi.Total = len(usernames)
+
+	go s.processFollowImport(fi.ID, uid)
+
+	return fi, nil
+}
+
+// FollowImport of the authenticated user with the outcome of every row.
+func (s *Service) FollowImport(ctx context.Context, importID int64) (FollowImport, error) {
+	var fi FollowImport
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return fi, ErrUnauthenticated
+	}
+
+	query := `SELECT id, status, total, processed, failed, created_at, finished_at
+		FROM follow_imports WHERE id = $1 AND user_id = $2`
+	err := s.db.QueryRowContext(ctx, query, importID, uid).Scan(&fi.ID, &fi.Status, &fi.Total,
+		&fi.Processed, &fi.Failed, &fi.CreatedAt, &fi.FinishedAt)
+	if err == sql.ErrNoRows {
+		return fi, ErrFollowImportNotFound
+	}
+
+	if err != nil {
+		return fi, fmt.Errorf("could not query select follow import: %v", err)
+	}
+
+	query = "SELECT row, username, status, error FROM follow_import_rows WHERE import_id = $1 ORDER BY row"
+	rows, err := s.db.QueryContext(ctx, query, importID)
+	if err != nil {
+		return fi, fmt.Errorf("could not query select follow import rows: %v", err)
+	}
+
+	defer rows.Close()
+
+	fi.Rows = make([]FollowImportRow, 0, fi.Total)
+	for rows.Next() {
+		var r FollowImportRow
+		if err = rows.Scan(&r.Row, &r.Username, &r.Status, &r.Error); err != nil {
+			return fi, fmt.Errorf("could not scan follow import row: %v", err)
+		}
+
+		fi.Rows = append(fi.Rows, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return fi, fmt.Errorf("could not iterate follow import rows: %v", err)
+	}
+
+	return fi, nil
+}
+
+// ResumeFollowImports tries the pending follow imports again, along with the
+// stale running ones, right away and then every FollowImportRetryInterval
+// until ctx is done.
+func (s *Service) ResumeFollowImports(ctx context.Context) {
+	if err := s.resumeFollowImports(ctx); err != nil {
+		log.Printf("could not resume follow imports: %v\n", err)
+	}
+
+	ticker := time.NewTicker(FollowImportRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.resumeFollowImports(ctx); err != nil {
+				log.Printf("could not resume follow imports: %v\n", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Service) resumeFollowImports(ctx context.Context) error {
+	query := `SELECT id, user_id FROM follow_imports
+		WHERE status = $1 OR (status = $2 AND updated_at < now() - $3::INTERVAL)
+		ORDER BY id`
+	rows, err := s.db.QueryContext(ctx, query, FollowImportPending, FollowImportRunning, interval(FollowImportStaleAfter))
+	if err != nil {
+		return fmt.Errorf("could not query select pending follow imports: %v", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var importID, uid int64
+		if err = rows.Scan(&importID, &uid); err != nil {
+			return fmt.Errorf("could not scan pending follow import: %v", err)
+		}
+
+		go s.processFollowImport(importID, uid)
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("could not iterate pending follow import rows: %v", err)
+	}
+
+	return nil
+}
+
+// processFollowImport follows the pending rows of the import, unless it is
+// already running and not stale. It stops at the follow limits, leaving the
+// rest pending.
+func (s *Service) processFollowImport(importID, uid int64) {
+	ctx := context.Background()
+
+	query := `UPDATE follow_imports SET status = $1, updated_at = now()
+		WHERE id = $2 AND (status = $3 OR (status = $1 AND updated_at < now() - $4::INTERVAL))`
+	res, err := s.db.ExecContext(ctx, query, FollowImportRunning, importID, FollowImportPending, interval(FollowImportStaleAfter))
+	if err != nil {
+		log.Printf("could not update follow import status: %v\n", err)
+		return
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+
+	query = "SELECT row, username FROM follow_import_rows WHERE import_id = $1 AND status = $2 ORDER BY row"
+	rows, err := s.db.QueryContext(ctx, query, importID, FollowImportPending)
+	if err != nil {
+		log.Printf("could not query select pending follow import rows: %v\n", err)
+		return
+	}
+
+	var rr []FollowImportRow
+	for rows.Next() {
+		var r FollowImportRow
+		if err = rows.Scan(&r.Row, &r.Username); err != nil {
+			rows.Close()
+			log.Printf("could not scan follow import row: %v\n", err)
+			return
+		}
+
+		rr = append(rr, r)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		log.Printf("could not iterate follow import rows: %v\n", err)
+		return
+	}
+
+	for _, r := range rr {
+		r.Status = FollowImportRowFollowed
+		followed, err := s.follow(ctx, uid, r.Username)
+		if err == ErrRateLimited {
+			query = "UPDATE follow_imports SET status = $1, updated_at = now() WHERE id = $2"
+			if _, err = s.db.ExecContext(ctx, query, FollowImportPending, importID); err != nil {
+				log.Printf("could not pause follow import: %v\n", err)
+			}
+			return
+		}
+
+		if err == nil && !followed {
+			r.Status = FollowImportRowSkipped
+		} else if err != nil {
+			r.Status = FollowImportRowFailed
+			msg := err.Error()
+			if _, ok := err.(validation.Errors); !ok && err != ErrUserNotFound && err != ErrForbiddenFollow {
+				log.Printf("could not follow %q from import %d: %v\n", r.Username, importID, err)
+				msg = "internal error"
+			}
+			r.Error = &msg
+		}
+
+		if err = s.finishFollowImportRow(ctx, importID, r); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+
+	query = "UPDATE follow_imports SET status = $1, updated_at = now(), finished_at = now() WHERE id = $2"
+	if _, err = s.db.ExecContext(ctx, query, FollowImportDone, importID); err != nil {
+		log.Printf("could not finish follow import: %v\n", err)
+	}
+}
+
+// finishFollowImportRow saves the outcome of the row along with the progress
+// of the import, so they stay in step if the import dies in between.
+// Rows no longer pending were already counted.
+func (s *Service) finishFollowImportRow(ctx context.Context, importID int64, r FollowImportRow) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	query := "UPDATE follow_import_rows SET status = $1, error = $2 WHERE import_id = $3 AND row = $4 AND status = $5"
+	res, err := tx.ExecContext(ctx, query, r.Status, r.Error, importID, r.Row, FollowImportPending)
+	if err != nil {
+		return fmt.Errorf("could not update follow import row: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	query = "UPDATE follow_imports SET processed = processed + 1, failed = failed + $1, updated_at = now() WHERE id = $2"
+	failed := 0
+	if r.Status == FollowImportRowFailed {
+		failed = 1
+	}
+	if _, err = tx.ExecContext(ctx, query, failed, importID); err != nil {
+		return fmt.Errorf("could not update follow import progress: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit follow import row: %v", err)
+	}
+
+	return nil
+}
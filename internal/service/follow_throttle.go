@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Default follow limits, unless Settings say otherwise. Follows and unfollows
+// both count towards FollowsPerHour and FollowsPerDay. Past FollowRatioAfter
+// followees, a user can follow at most MaxFollowRatio times as many users as
+// follow them.
+const (
+	FollowsPerHour   = 60
+	FollowsPerDay    = 400
+	FollowRatioAfter = 1000
+	MaxFollowRatio   = 10
+)
+
+// Users throttled in followThrottleReviewHours distinct hours within
+// followThrottleReviewWindow are queued for moderator review.
+const (
+	followThrottleReviewHours  = 3
+	followThrottleReviewWindow = time.Hour * 24 * 7
+)
+
+// checkFollowRate returns ErrRateLimited when the user followed or unfollowed
+// too many users lately, or follows too many more users than follow them.
+// It's checked before following only, so users can always unfollow.
+// Each refusal is recorded to flag repeat offenders for review.
+func (s *Service) checkFollowRate(ctx context.Context, tx *sql.Tx, uid int64) error {
+	settings := s.Settings()
+	var lastHour, lastDay, followers, followees int
+	query := `SELECT
+		count(*) FILTER (WHERE created_at > now() - INTERVAL '1 hour'),
+		count(*),
+		COALESCE((SELECT followers_count FROM user_stats WHERE user_id = $1), 0),
+		COALESCE((SELECT followees_count FROM user_stats WHERE user_id = $1), 0)
+		FROM events
+		WHERE actor_id = $1 AND type IN ($2, $3) AND created_at > now() - INTERVAL '1 day'`
+	err := tx.QueryRowContext(ctx, query, uid, EventUserFollowed, EventUserUnfollowed).Scan(&lastHour, &lastDay, &followers, &followees)
+	if err != nil {
+		return fmt.Errorf("could not query select follow rate: %v", err)
+	}
+
+	var reason string
+	switch {
+	case settings.FollowsPerHour != 0 && lastHour >= settings.FollowsPerHour:
+		reason = "hourly follow limit"
+	case settings.FollowsPerDay != 0 && lastDay >= settings.FollowsPerDay:
+		reason = "daily follow limit"
+	case settings.MaxFollowRatio != 0 && followees >= settings.FollowRatioAfter && followees >= settings.MaxFollowRatio*followers:
+		reason = "follow ratio"
+	default:
+		return nil
+	}
+
+	s.recordFollowThrottle(ctx, uid, reason)
+
+	return ErrRateLimited
+}
+
+// recordFollowThrottle outside of the refused follow tx, and queues the user for
+// review when throttled in enough distinct hours since their last review.
+// Failures are only logged so the user still gets ErrRateLimited.
+func (s *Service) recordFollowThrottle(ctx context.Context, uid int64, reason string) {
+	query := "INSERT INTO follow_throttles (user_id, reason) VALUES ($1, $2)"
+	if _, err := s.db.ExecContext(ctx, query, uid, reason); err != nil {
+		log.Printf("could not insert follow throttle: %v\n", err)
+		return
+	}
+
+	query = `INSERT INTO user_reviews (user_id, reason)
+		SELECT $1, $2 WHERE (
+			SELECT count(DISTINCT date_trunc('hour', created_at)) FROM follow_throttles
+			WHERE user_id = $1 AND created_at > GREATEST(now() - $3::INTERVAL,
+				COALESCE((SELECT resolved_at FROM user_reviews WHERE user_id = $1), '-infinity'))
+		) >= $4
+		ON CONFLICT (user_id) DO UPDATE SET reason = EXCLUDED.reason, created_at = now(), resolved_at = NULL
+		WHERE user_reviews.resolved_at IS NOT NULL`
+	if _, err := s.db.ExecContext(ctx, query, uid, "repeated follow throttling", interval(followThrottleReviewWindow), followThrottleReviewHours); err != nil {
+		log.Printf("could not insert user review: %v\n", err)
+	}
+}
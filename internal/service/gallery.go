@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// MediaPost is a post with attachments as shown in a profile media grid,
+// without the rest of the post payload.
+type MediaPost struct {
+	PostID    int64     `json:"postId"`
+	NSFW      bool      `json:"nsfw"`
+	SpoilerOf *string   `json:"spoilerOf"`
+	CreatedAt time.Time `json:"createdAt"`
+	Media     []Media   `json:"media"`
+}
+
+// UserMedia returns the posts of a user that have media attached,
+// in descending order with backward pagination.
+func (s *Service) UserMedia(ctx context.Context, username string, last int, before int64) ([]MediaPost, error) {
+	username = validation.NormalizeUsername(username)
+	var v validation.Validator
+	v.Username("username", username)
+	v.Cursor("before", before)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	uid, auth := ctx.Value(KeyAuthUserID).(int64)
+	last = validation.PageSize(last)
+	query, args, err := buildQuery(`
+		SELECT p.id, p.nsfw, p.spoiler_of, p.created_at
+		FROM posts p
+		WHERE p.user_id = (SELECT id FROM users u WHERE lower(u.username) = lower(@username))
+		AND EXISTS (SELECT 1 FROM media WHERE media.post_id = p.id)
+		{{template "nsfwFilter" .}}
+		AND NOT p.archived
+		{{if .before}}AND p.id < @before{{end}}
+		ORDER BY p.id DESC
+		LIMIT @last`, map[string]interface{}{
+		"auth":       auth,
+		"uid":        uid,
+		"nsfwBornBy": s.nsfwBornBy(),
+		"username":   username,
+		"before":     before,
+		"last":       last,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build user media sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select user media posts: %v", err)
+	}
+
+	defer rows.Close()
+
+	pp := make([]MediaPost, 0, last)
+	var ids []int64
+	for rows.Next() {
+		var p MediaPost
+		if err = rows.Scan(&p.PostID, &p.NSFW, &p.SpoilerOf, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan user media post: %v", err)
+		}
+
+		pp = append(pp, p)
+		ids = append(ids, p.PostID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate user media post rows: %v", err)
+	}
+
+	media, err := s.postsMedia(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range pp {
+		pp[i].Media = media[pp[i].PostID]
+	}
+
+	return pp, nil
+}
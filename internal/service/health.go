@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/s3"
+	"github.com/lib/pq"
+)
+
+// Statuses of a health check.
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+const (
+	// healthCheckTimeout bounds each dependency check.
+	healthCheckTimeout = 2 * time.Second
+	// healthSlowDB is the database round trip past which it is reported degraded.
+	healthSlowDB = 250 * time.Millisecond
+	// healthMaxJobLag is how far behind a background job can fall before it is
+	// reported degraded.
+	healthMaxJobLag = 2 * time.Minute
+)
+
+// Health of the instance and of each of its dependencies.
+type Health struct {
+	// Status is HealthDown when any dependency is down,
+	// HealthDegraded when any is degraded and HealthOK otherwise.
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyHealth `json:"dependencies"`
+}
+
+// DependencyHealth reports the status of a dependency and how long checking it took.
+// Failures are logged rather than reported, as the health is public.
+type DependencyHealth struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latencyMs"`
+}
+
+type healthCheck func(ctx context.Context) (string, error)
+
+// Health checks the dependencies of the instance concurrently: the database,
+// the media storage, the object storage when configured, and whether the fanout
+// and the user_stats projection keep up. Only the database and the media storage
+// can be down; the instance still serves most requests without the others.
+func (s *Service) Health(ctx context.Context) Health {
+	checks := map[string]healthCheck{
+		"database":   s.checkDatabase,
+		"storage":    s.checkStorage,
+		"fanout":     s.checkFanout,
+		"user_stats": s.checkUserStats,
+	}
+	if s.objects != nil {
+		checks["objects"] = s.checkObjects
+	}
+
+	out := Health{Status: HealthOK, Dependencies: make(map[string]DependencyHealth, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check healthCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			status, err := check(ctx)
+			if err != nil {
+				log.Printf("health check of %s failed: %v\n", name, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			out.Dependencies[name] = DependencyHealth{Status: status, LatencyMS: ms(time.Since(start))}
+			if status == HealthDown || (status == HealthDegraded && out.Status == HealthOK) {
+				out.Status = status
+			}
+		}(name, check)
+	}
+
+	wg.Wait()
+	return out
+}
+
+func (s *Service) checkDatabase(ctx context.Context) (string, error) {
+	start := time.Now()
+	if err := s.db.PingContext(ctx); err != nil {
+		return HealthDown, err
+	}
+
+	var one int
+	if err := s.db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		return HealthDown, err
+	}
+
+	if time.Since(start) > healthSlowDB {
+		return HealthDegraded, nil
+	}
+
+	return HealthOK, nil
+}
+
+// checkStorage writes and removes a file in each directory uploads are saved to.
+func (s *Service) checkStorage(ctx context.Context) (string, error) {
+	for _, dir := range []string{avatarsDir, mediaDir, emojisDir} {
+		f, err := os.CreateTemp(dir, ".health-*")
+		if err != nil {
+			return HealthDown, err
+		}
+
+		_, err = f.WriteString("ok")
+		f.Close()
+		os.Remove(f.Name())
+		if err != nil {
+			return HealthDown, err
+		}
+	}
+
+	return HealthOK, nil
+}
+
+// checkObjects asks for an object that doesn't exist: a not found
+// means the bucket is reachable and the credentials are accepted.
+func (s *Service) checkObjects(ctx context.Context) (string, error) {
+	body, _, err := s.objects.Get(ctx, ".health")
+	if err == s3.ErrNotFound {
+		return HealthOK, nil
+	}
+
+	if err != nil {
+		return HealthDegraded, err
+	}
+
+	body.Close()
+	return HealthOK, nil
+}
+
+// checkFanout reports the fanout degraded while its queue is full,
+// as new posts are then shed to the pull model.
+func (s *Service) checkFanout(ctx context.Context) (string, error) {
+	pending, err := s.fanout.Pending(ctx)
+	if err != nil {
+		return HealthDegraded, err
+	}
+
+	if q, ok := s.fanout.(*queueFanout); ok && pending >= cap(q.posts) {
+		return HealthDegraded, nil
+	}
+
+	return HealthOK, nil
+}
+
+// checkUserStats reports the projection degraded when the oldest event
+// it has yet to apply is older than healthMaxJobLag.
+func (s *Service) checkUserStats(ctx context.Context) (string, error) {
+	var oldest sql.NullTime
+	query := `SELECT min(e.created_at) FROM events e, projections p
+		WHERE p.name = $1 AND e.type = ANY($2::VARCHAR[])
+		AND ((e.xact_id IS NULL AND e.id > p.last_event_id)
+			OR (e.xact_id >= COALESCE(pg_snapshot_xmin(p.last_snapshot), '0'::xid8)
+				AND (p.last_snapshot IS NULL OR NOT pg_visible_in_snapshot(e.xact_id, p.last_snapshot))))`
+	if err := s.db.QueryRowContext(ctx, query, userStatsProjection, pq.StringArray(userStatsEvents)).Scan(&oldest); err != nil {
+		return HealthDegraded, err
+	}
+
+	if oldest.Valid && time.Since(oldest.Time) > healthMaxJobLag {
+		return HealthDegraded, nil
+	}
+
+	return HealthOK, nil
+}
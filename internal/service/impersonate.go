@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// ImpersonationLifespan until impersonation tokens expire.
+const ImpersonationLifespan = time.Hour
+
+// Impersonate gives the authenticated admin a token acting as the given user,
+// to debug what they see. The token is short-lived, its session is left out of
+// the user's sessions and doesn't mark them as seen, and every impersonation is
+// recorded in the audit log. Admins can't be impersonated.
+func (s *Service) Impersonate(ctx context.Context, username string) (LoginOutput, error) {
+	var out LoginOutput
+
+	adminID, err := s.authAdmin(ctx)
+	if err != nil {
+		return out, err
+	}
+
+	username = validation.NormalizeUsername(username)
+	var v validation.Validator
+	v.Username("username", username)
+	if err = v.Err(); err != nil {
+		return out, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return out, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	var avatar sql.NullString
+	var role string
+	query := "SELECT id, username, avatar, verified, role FROM users WHERE lower(username) = lower($1)"
+	err = tx.QueryRowContext(ctx, query, username).Scan(&out.AuthUser.ID, &out.AuthUser.Username, &avatar, &out.AuthUser.Verified, &role)
+	if err == sql.ErrNoRows {
+		return out, ErrUserNotFound
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not query select user: %v", err)
+	}
+
+	if role == RoleAdmin {
+		return out, ErrForbidden
+	}
+
+	if avatar.Valid {
+		avatarURL := s.origin + "/img/avatars/" + avatar.String
+		out.AuthUser.AvatarURL = &avatarURL
+	}
+
+	ci, _ := ctx.Value(KeyClientInfo).(ClientInfo)
+	out.ExpiresAt = time.Now().Add(ImpersonationLifespan)
+
+	var sid int64
+	query = `INSERT INTO sessions (user_id, user_agent, ip, impersonator_id, expires_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5) RETURNING id`
+	if err = tx.QueryRowContext(ctx, query, out.AuthUser.ID, ci.UserAgent, ci.IP, adminID, out.ExpiresAt).Scan(&sid); err != nil {
+		return out, fmt.Errorf("could not insert impersonation session: %v", err)
+	}
+
+	details := map[string]interface{}{
+		"username":  out.AuthUser.Username,
+		"sessionId": sid,
+		"expiresAt": out.ExpiresAt,
+	}
+	if err = s.audit(ctx, tx, adminID, AuditActionImpersonate, out.AuthUser.ID, details); err != nil {
+		return out, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return out, fmt.Errorf("could not commit impersonation: %v", err)
+	}
+
+	out.Token, err = s.codec.EncodeToString(strconv.FormatInt(out.AuthUser.ID, 10) + "." + strconv.FormatInt(sid, 10))
+	if err != nil {
+		return out, fmt.Errorf("could not create token: %v", err)
+	}
+
+	return out, nil
+}
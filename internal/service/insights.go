@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// PostInsights are the engagement totals of a post, for its author.
+type PostInsights struct {
+	LikesCount    int `json:"likesCount"`
+	CommentsCount int `json:"commentsCount"`
+	// LinkClicks on all the links of the post.
+	LinkClicks int          `json:"linkClicks"`
+	Links      []LinkClicks `json:"links"`
+}
+
+// LinkClicks on a link of a post.
+type LinkClicks struct {
+	URL    string `json:"url"`
+	Clicks int    `json:"clicks"`
+}
+
+// PostInsights of a post of the authenticated user.
+func (s *Service) PostInsights(ctx context.Context, postID int64) (PostInsights, error) {
+	var out PostInsights
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	var authorID int64
+	query := "SELECT user_id, likes_count, comments_count FROM posts WHERE id = $1"
+	err := s.db.QueryRowContext(ctx, query, postID).Scan(&authorID, &out.LikesCount, &out.CommentsCount)
+	if err == sql.ErrNoRows {
+		return out, ErrPostNotFound
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not query select post insights: %v", err)
+	}
+
+	if authorID != uid {
+		return out, ErrForbidden
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT url, clicks FROM post_links WHERE post_id = $1 ORDER BY id", postID)
+	if err != nil {
+		return out, fmt.Errorf("could not query select post link clicks: %v", err)
+	}
+
+	defer rows.Close()
+
+	out.Links = []LinkClicks{}
+	for rows.Next() {
+		var l LinkClicks
+		if err = rows.Scan(&l.URL, &l.Clicks); err != nil {
+			return out, fmt.Errorf("could not scan post link clicks: %v", err)
+		}
+
+		out.LinkClicks += l.Clicks
+		out.Links = append(out.Links, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return out, fmt.Errorf("could not iterate post link clicks rows: %v", err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/djomlaa/socnet/internal/validation"
+	"github.com/lib/pq"
+)
+
+// DiscoverOutput response
+type DiscoverOutput struct {
+	Users []UserProfile `json:"users"`
+	Posts []Post        `json:"posts"`
+}
+
+// SetInterests replaces the interest tags of the authenticated user
+// and returns them normalized and sorted.
+func (s *Service) SetInterests(ctx context.Context, interests []string) ([]string, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	seen := make(map[string]bool, len(interests))
+	tags := make([]string, 0, len(interests))
+	var v validation.Validator
+	for _, interest := range interests {
+		interest = strings.ToLower(strings.TrimSpace(interest))
+		if seen[interest] {
+			continue
+		}
+
+		seen[interest] = true
+		v.Slug("interests", interest)
+		tags = append(tags, interest)
+	}
+
+	v.Check(len(tags) <= validation.MaxInterests, "interests", fmt.Sprintf("at most %d allowed", validation.MaxInterests))
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(tags)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM user_interests WHERE user_id = $1", uid); err != nil {
+		return nil, fmt.Errorf("could not delete user interests: %v", err)
+	}
+
+	query := "INSERT INTO user_interests (user_id, interest) SELECT $1, unnest($2::VARCHAR[])"
+	if _, err = tx.ExecContext(ctx, query, uid, pq.Array(tags)); err != nil {
+		return nil, fmt.Errorf("could not insert user interests: %v", err)
+	}
+
+	// They show on the profile, whose modification time is kept on users.
+	if _, err = tx.ExecContext(ctx, "UPDATE users SET updated_at = now() WHERE id = $1", uid); err != nil {
+		return nil, fmt.Errorf("could not update user modification time: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not commit user interests: %v", err)
+	}
+
+	return tags, nil
+}
+
+// Discover users tagged with an interest, most followed first,
+// along with their recent posts.
+func (s *Service) Discover(ctx context.Context, interest string, first int) (DiscoverOutput, error) {
+	var out DiscoverOutput
+	interest = strings.ToLower(strings.TrimSpace(interest))
+	var v validation.Validator
+	v.Slug("interest", interest)
+	if err := v.Err(); err != nil {
+		return out, err
+	}
+
+	uid, auth := ctx.Value(KeyAuthUserID).(int64)
+	first = validation.PageSize(first)
+
+	query, args, err := buildQuery(`
+		SELECT users.id, users.username, users.avatar, users.verified, {{template "followCounts" .}}
+		{{if .auth}}
+		, followers.follower_id IS NOT NULL AS following
+		, followees.followee_id IS NOT NULL AS followeed
+		{{end}}
+		FROM user_interests ui
+		INNER JOIN users ON ui.user_id = users.id
+		LEFT JOIN user_stats AS stats ON stats.user_id = users.id
+		{{if .auth}}
+		LEFT JOIN follows AS followers ON followers.follower_id = @uid AND followers.followee_id = users.id
+		LEFT JOIN follows AS followees ON followees.follower_id = users.id AND followees.followee_id = @uid
+		{{end}}
+		WHERE ui.interest = @interest
+		ORDER BY stats.followers_count DESC NULLS LAST, users.id ASC
+		LIMIT @first`, map[string]interface{}{
+		"auth":     auth,
+		"uid":      uid,
+		"interest": interest,
+		"first":    first,
+	})
+	if err != nil {
+		return out, fmt.Errorf("could not build discover users sql query: %v", err)
+	}
+
+	out.Users, err = s.queryUserProfiles(ctx, query, args, auth, uid, first)
+	if err != nil {
+		return out, err
+	}
+
+	query, args, err = buildQuery(`
+		SELECT p.id, p.content, p.spoiler_of, p.nsfw, p.license, p.likes_count, p.comments_count, p.created_at, u.username, u.avatar, u.verified
+		{{if .auth}}
+		, p.user_id = @uid AS mine
+		, pl.user_id IS NOT NULL AS liked
+		{{end}}
+		FROM posts p
+		INNER JOIN users u ON p.user_id = u.id
+		INNER JOIN user_interests ui ON ui.user_id = p.user_id
+		{{if .auth}}
+		LEFT JOIN post_likes pl ON pl.user_id = @uid AND pl.post_id = p.id
+		{{end}}
+		WHERE ui.interest = @interest
+		{{template "nsfwFilter" .}}
+		AND NOT p.archived
+		ORDER BY p.id DESC
+		LIMIT @first`, map[string]interface{}{
+		"auth":       auth,
+		"uid":        uid,
+		"nsfwBornBy": s.nsfwBornBy(),
+		"interest":   interest,
+		"first":      first,
+	})
+	if err != nil {
+		return out, fmt.Errorf("could not build discover posts sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return out, fmt.Errorf("could not query select discover posts: %v", err)
+	}
+
+	defer rows.Close()
+
+	out.Posts = make([]Post, 0, first)
+	for rows.Next() {
+		var p Post
+		var u User
+		var avatar sql.NullString
+		dest := []interface{}{&p.ID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.License, &p.LikesCount, &p.CommentsCount, &p.CreatedAt, &u.Username, &avatar, &u.Verified}
+		if auth {
+			dest = append(dest, &p.Mine, &p.Liked)
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return out, fmt.Errorf("could not scan discover post: %v", err)
+		}
+
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			u.AvatarURL = &avatarURL
+		}
+
+		p.User = &u
+		out.Posts = append(out.Posts, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return out, fmt.Errorf("could not iterate discover post rows: %v", err)
+	}
+
+	if err = s.fillPosts(ctx, postPtrs(out.Posts)); err != nil {
+		return out, err
+	}
+
+	return out, nil
+}
+
+// FollowRecommendations for the authenticated user: users they do not follow yet,
+// ranked by the number of shared interests and then by followers.
+func (s *Service) FollowRecommendations(ctx context.Context, first int) ([]UserProfile, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	first = validation.PageSize(first)
+	query, args, err := buildQuery(`
+		SELECT users.id, users.username, users.avatar, users.verified, {{template "followCounts" .}}
+		, false AS following
+		, followees.followee_id IS NOT NULL AS followeed
+		FROM users
+		LEFT JOIN follows AS followees ON followees.follower_id = users.id AND followees.followee_id = @uid
+		LEFT JOIN user_interests ui ON ui.user_id = users.id
+			AND ui.interest IN (SELECT interest FROM user_interests WHERE user_id = @uid)
+		LEFT JOIN user_stats AS stats ON stats.user_id = users.id
+		WHERE users.id <> @uid
+		AND NOT EXISTS (SELECT 1 FROM follows WHERE follower_id = @uid AND followee_id = users.id)
+		GROUP BY users.id, followees.followee_id, stats.followers_count
+		ORDER BY count(ui.interest) DESC, stats.followers_count DESC NULLS LAST, users.id ASC
+		LIMIT @first`, map[string]interface{}{
+		"auth":  true,
+		"uid":   uid,
+		"first": first,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build follow recommendations sql query: %v", err)
+	}
+
+	return s.queryUserProfiles(ctx, query, args, true, uid, first)
+}
+
+// queryUserProfiles scans id, username, avatar, verified, followers and followees counts
+// and, when auth, the following and followeed flags.
+func (s *Service) queryUserProfiles(ctx context.Context, query string, args []interface{}, auth bool, uid int64, size int) ([]UserProfile, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select users: %v", err)
+	}
+
+	defer rows.Close()
+
+	uu := make([]UserProfile, 0, size)
+	for rows.Next() {
+		var u UserProfile
+		var avatar sql.NullString
+		dest := []interface{}{&u.ID, &u.Username, &avatar, &u.Verified, &u.FollowersCount, &u.FolloweesCount}
+		if auth {
+			dest = append(dest, &u.Following, &u.Followeed)
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan user: %v", err)
+		}
+
+		u.Me = auth && uid == u.ID
+		u.ID = 0
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			u.AvatarURL = &avatarURL
+		}
+
+		uu = append(uu, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate user rows: %v", err)
+	}
+
+	return uu, nil
+}
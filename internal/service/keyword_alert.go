@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+	"github.com/lib/pq"
+)
+
+// Keyword alert scopes.
+const (
+	// KeywordAlertFollowees alerts on posts from followed users only.
+	KeywordAlertFollowees = "followees"
+	// KeywordAlertAnyone alerts on posts from any user.
+	KeywordAlertAnyone = "anyone"
+)
+
+var reWord = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+var (
+	// ErrKeywordAlertNotFound denotes a keyword alert that was not found
+	ErrKeywordAlertNotFound = errors.New("keyword alert not found")
+	// ErrKeywordAlertExists used when the user already has an alert for the keyword
+	ErrKeywordAlertExists = errors.New("keyword alert already exists")
+)
+
+// KeywordAlert model
+type KeywordAlert struct {
+	ID        int64     `json:"id"`
+	Keyword   string    `json:"keyword"`
+	Scope     string    `json:"scope"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreateKeywordAlert subscribes the authenticated user to posts containing keyword.
+// Scope defaults to followees.
+func (s *Service) CreateKeywordAlert(ctx context.Context, keyword, scope string) (KeywordAlert, error) {
+	var a KeywordAlert
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return a, ErrUnauthenticated
+	}
+
+	if scope == "" {
+		scope = KeywordAlertFollowees
+	}
+
+	keyword = strings.ToLower(strings.TrimSpace(keyword))
+	var v validation.Validator
+	v.Keyword("keyword", keyword)
+	v.Check(scope == KeywordAlertFollowees || scope == KeywordAlertAnyone, "scope", "must be followees or anyone")
+	if err := v.Err(); err != nil {
+		return a, err
+	}
+
+	query := "INSERT INTO keyword_alerts (user_id, keyword, scope) VALUES ($1, $2, $3) RETURNING id, created_at"
+	err := s.db.QueryRowContext(ctx, query, uid, keyword, scope).Scan(&a.ID, &a.CreatedAt)
+	if isUniqueViolation(err) {
+		return a, ErrKeywordAlertExists
+	}
+
+	if err != nil {
+		return a, fmt.Errorf("could not insert keyword alert: %v", err)
+	}
+
+	a.Keyword = keyword
+	a.Scope = scope
+	return a, nil
+}
+
+// KeywordAlerts of the authenticated user.
+func (s *Service) KeywordAlerts(ctx context.Context) ([]KeywordAlert, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	query := "SELECT id, keyword, scope, created_at FROM keyword_alerts WHERE user_id = $1 ORDER BY keyword"
+	rows, err := s.db.QueryContext(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select keyword alerts: %v", err)
+	}
+
+	defer rows.Close()
+
+	aa := []KeywordAlert{}
+	for rows.Next() {
+		var a KeywordAlert
+		if err = rows.Scan(&a.ID, &a.Keyword, &a.Scope, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan keyword alert: %v", err)
+		}
+
+		aa = append(aa, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate keyword alert rows: %v", err)
+	}
+
+	return aa, nil
+}
+
+// DeleteKeywordAlert of the authenticated user.
+func (s *Service) DeleteKeywordAlert(ctx context.Context, alertID int64) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	query := "DELETE FROM keyword_alerts WHERE id = $1 AND user_id = $2"
+	res, err := s.db.ExecContext(ctx, query, alertID, uid)
+	if err != nil {
+		return fmt.Errorf("could not delete keyword alert: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrKeywordAlertNotFound
+	}
+
+	return nil
+}
+
+// postWords returns the distinct lowercase words of a post.
+func postWords(p Post) []string {
+	text := p.Content
+	if p.SpoilerOf != nil {
+		text += " " + *p.SpoilerOf
+	}
+
+	seen := map[string]bool{}
+	var words []string
+	for _, w := range reWord.FindAllString(strings.ToLower(text), -1) {
+		if !seen[w] {
+			seen[w] = true
+			words = append(words, w)
+		}
+	}
+
+	return words
+}
+
+// notifyKeywordAlerts notifies the users with alerts on the words of the post.
+// Alerts are matched by exact word with a single indexed lookup.
+func (s *Service) notifyKeywordAlerts(p Post) {
+	words := postWords(p)
+	if len(words) == 0 {
+		return
+	}
+
+	query := `INSERT INTO notifications (user_id, actors, type, post_id)
+		SELECT DISTINCT ka.user_id, ARRAY[u.username], 'keyword', $3::INT
+		FROM keyword_alerts ka
+		INNER JOIN users u ON u.id = $2
+		WHERE ka.keyword = ANY($1::VARCHAR[])
+		AND ka.user_id <> $2
+		AND (ka.scope = 'anyone' OR EXISTS (
+			SELECT 1 FROM follows WHERE follower_id = ka.user_id AND followee_id = $2
+		))` + returningNotification
+	rows, err := s.db.Query(query, pq.Array(words), p.UserID, p.ID)
+	if err != nil {
+		log.Printf("could not insert keyword alert notifications: %v\n", err)
+		return
+	}
+
+	if err = s.broadcastNotifications(rows); err != nil {
+		log.Printf("could not broadcast keyword alert notifications: %v\n", err)
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Leaderboards a user can rank in.
+const (
+	LeaderboardMostFollowed = "most_followed"
+	LeaderboardMostLiked    = "most_liked"
+	LeaderboardMostActive   = "most_active"
+)
+
+// LeaderboardSize is how many users each leaderboard ranks.
+const LeaderboardSize = 10
+
+// leaderboardQueries select the user_id and score of the top users of each
+// leaderboard. Weekly boards count the last seven days. Users hiding their
+// follow lists are left out of the most followed board, as it tells their counts.
+var leaderboardQueries = map[string]string{
+	LeaderboardMostFollowed: `SELECT user_stats.user_id, user_stats.followers_count FROM user_stats
+		INNER JOIN users ON user_stats.user_id = users.id
+		WHERE user_stats.followers_count > 0 AND users.follow_lists_visibility = 'everyone'
+		ORDER BY user_stats.followers_count DESC, user_stats.user_id ASC
+		LIMIT $1`,
+	LeaderboardMostLiked: `SELECT p.user_id, count(*) FROM post_likes pl
+		INNER JOIN posts p ON pl.post_id = p.id
+		WHERE pl.created_at > now() - INTERVAL '7 days' AND pl.user_id <> p.user_id
+		GROUP BY p.user_id
+		ORDER BY count(*) DESC, p.user_id ASC
+		LIMIT $1`,
+	LeaderboardMostActive: `SELECT user_id, count(*) FROM (
+			SELECT user_id FROM posts WHERE created_at > now() - INTERVAL '7 days'
+			UNION ALL
+			SELECT user_id FROM comments WHERE created_at > now() - INTERVAL '7 days'
+		) activity
+		GROUP BY user_id
+		ORDER BY count(*) DESC, user_id ASC
+		LIMIT $1`,
+}
+
+// LeaderboardEntry is a user ranked in a leaderboard.
+type LeaderboardEntry struct {
+	Rank  int  `json:"rank"`
+	User  User `json:"user"`
+	Score int  `json:"score"`
+}
+
+// Leaderboards for a community highlights page.
+type Leaderboards struct {
+	MostFollowed []LeaderboardEntry `json:"mostFollowed"`
+	// MostLiked ranks users by likes received this week.
+	MostLiked []LeaderboardEntry `json:"mostLiked"`
+	// MostActive ranks users by posts and comments written this week.
+	MostActive  []LeaderboardEntry `json:"mostActive"`
+	RefreshedAt *time.Time         `json:"refreshedAt"`
+}
+
+// Leaderboards as of their last refresh. Users who hid their follow lists
+// since are left out of the most followed board right away.
+func (s *Service) Leaderboards(ctx context.Context) (Leaderboards, error) {
+	out := Leaderboards{
+		MostFollowed: []LeaderboardEntry{},
+		MostLiked:    []LeaderboardEntry{},
+		MostActive:   []LeaderboardEntry{},
+	}
+	boards := map[string]*[]LeaderboardEntry{
+		LeaderboardMostFollowed: &out.MostFollowed,
+		LeaderboardMostLiked:    &out.MostLiked,
+		LeaderboardMostActive:   &out.MostActive,
+	}
+
+	query := `SELECT l.board, l.rank, l.score, l.refreshed_at, u.username, u.avatar, u.verified
+		FROM leaderboard_entries l
+		INNER JOIN users u ON l.user_id = u.id
+		WHERE l.board <> $1 OR u.follow_lists_visibility = 'everyone'
+		ORDER BY l.board, l.rank`
+	rows, err := s.db.QueryContext(ctx, query, LeaderboardMostFollowed)
+	if err != nil {
+		return out, fmt.Errorf("could not query select leaderboards: %v", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var board string
+		var e LeaderboardEntry
+		var refreshedAt time.Time
+		var avatar sql.NullString
+		if err = rows.Scan(&board, &e.Rank, &e.Score, &refreshedAt, &e.User.Username, &avatar, &e.User.Verified); err != nil {
+			return out, fmt.Errorf("could not scan leaderboard entry: %v", err)
+		}
+
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			e.User.AvatarURL = &avatarURL
+		}
+
+		if out.RefreshedAt == nil {
+			out.RefreshedAt = &refreshedAt
+		}
+
+		if entries, ok := boards[board]; ok {
+			*entries = append(*entries, e)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return out, fmt.Errorf("could not iterate leaderboard rows: %v", err)
+	}
+
+	return out, nil
+}
+
+// RefreshLeaderboards recomputes every leaderboard in a single transaction,
+// so readers never see a partial refresh. It is meant to run periodically.
+func (s *Service) RefreshLeaderboards(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM leaderboard_entries"); err != nil {
+		return fmt.Errorf("could not delete leaderboard entries: %v", err)
+	}
+
+	for board, q := range leaderboardQueries {
+		query := `INSERT INTO leaderboard_entries (board, rank, user_id, score)
+			SELECT $2, row_number() OVER (ORDER BY top.score DESC, top.user_id ASC), top.user_id, top.score
+			FROM (` + q + `) top (user_id, score)`
+		if _, err = tx.ExecContext(ctx, query, LeaderboardSize, board); err != nil {
+			return fmt.Errorf("could not insert %s leaderboard: %v", board, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit leaderboards refresh: %v", err)
+	}
+
+	return nil
+}
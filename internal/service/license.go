@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// Content licenses a post can be published under.
+const (
+	LicenseAllRightsReserved = "all-rights-reserved"
+	LicenseCCBY              = "cc-by-4.0"
+	LicenseCCBYSA            = "cc-by-sa-4.0"
+	LicenseCCBYNC            = "cc-by-nc-4.0"
+	LicenseCC0               = "cc0-1.0"
+)
+
+// LicenseURLs of the licenses that have a canonical text online,
+// for representations linking to it.
+var LicenseURLs = map[string]string{
+	LicenseAllRightsReserved: "",
+	LicenseCCBY:              "https://creativecommons.org/licenses/by/4.0/",
+	LicenseCCBYSA:            "https://creativecommons.org/licenses/by-sa/4.0/",
+	LicenseCCBYNC:            "https://creativecommons.org/licenses/by-nc/4.0/",
+	LicenseCC0:               "https://creativecommons.org/publicdomain/zero/1.0/",
+}
+
+func validLicense(license string) bool {
+	_, ok := LicenseURLs[license]
+	return ok
+}
+
+// DefaultLicense of the authenticated user, applied to posts published without one.
+func (s *Service) DefaultLicense(ctx context.Context) (string, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+
+	var license string
+	if err := s.db.QueryRowContext(ctx, "SELECT default_license FROM users WHERE id = $1", uid).Scan(&license); err != nil {
+		return "", fmt.Errorf("could not query select user default license: %v", err)
+	}
+
+	return license, nil
+}
+
+// SetDefaultLicense of the authenticated user. Posts already published keep their license.
+func (s *Service) SetDefaultLicense(ctx context.Context, license string) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	license = strings.ToLower(strings.TrimSpace(license))
+	var v validation.Validator
+	v.Check(validLicense(license), "license", "unknown license")
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE users SET default_license = $1 WHERE id = $2", license, uid); err != nil {
+		return fmt.Errorf("could not update user default license: %v", err)
+	}
+
+	return nil
+}
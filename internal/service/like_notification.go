@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// LikeNotificationsWindow is how long likes on a post are coalesced before
+// they update the single like notification of its author.
+const LikeNotificationsWindow = 10 * time.Second
+
+// likesQueueSize bounds the likes waiting for the next flush.
+const likesQueueSize = 1024
+
+type likeEvent struct {
+	postID  int64
+	actorID int64
+}
+
+// queueLikeNotification hands a like to NotifyLikes without blocking the request.
+func (s *Service) queueLikeNotification(postID, actorID int64) {
+	select {
+	case s.likes <- likeEvent{postID: postID, actorID: actorID}:
+	default:
+		log.Printf("like notifications queue is full, dropping like of post %d\n", postID)
+	}
+}
+
+// NotifyLikes delivers the like notifications. It coalesces the likes of each post
+// over LikeNotificationsWindow into one update of the unread notification of the
+// post author, so a popular post doesn't write one notification per like.
+// It blocks until ctx is done, flushing the pending likes before returning.
+func (s *Service) NotifyLikes(ctx context.Context) {
+	ticker := time.NewTicker(LikeNotificationsWindow)
+	defer ticker.Stop()
+
+	pending := map[int64][]int64{}
+	flush := func() {
+		for postID, actorIDs := range pending {
+			s.notifyLikes(postID, actorIDs)
+		}
+		pending = map[int64][]int64{}
+	}
+
+	for {
+		select {
+		case e := <-s.likes:
+			pending[e.postID] = append(pending[e.postID], e.actorID)
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			flush()
+			return
+		}
+	}
+}
+
+func (s *Service) notifyLikes(postID int64, actorIDs []int64) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("could not begin tx: %v\n", err)
+		return
+	}
+
+	defer tx.Rollback()
+
+	var userID int64
+	query := "SELECT user_id FROM posts WHERE id = $1"
+	err = tx.QueryRow(query, postID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return
+	}
+
+	if err != nil {
+		log.Printf("could not query select liked post author: %v\n", err)
+		return
+	}
+
+	// Users who unliked within the window are left out. Latest likes go first.
+	var actors []string
+	query = `SELECT u.username FROM post_likes pl
+		INNER JOIN users u ON pl.user_id = u.id
+		WHERE pl.post_id = $1 AND pl.user_id = ANY($2::INT[]) AND pl.user_id <> $3
+		ORDER BY array_position($2::INT[], pl.user_id) DESC`
+	rows, err := tx.Query(query, postID, pq.Array(actorIDs), userID)
+	if err != nil {
+		log.Printf("could not query select like notification actors: %v\n", err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var actor string
+		if err = rows.Scan(&actor); err != nil {
+			log.Printf("could not scan like notification actor: %v\n", err)
+			return
+		}
+
+		actors = append(actors, actor)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("could not iterate like notification actors rows: %v\n", err)
+		return
+	}
+
+	if len(actors) == 0 {
+		return
+	}
+
+	var nid int64
+	var oldActors []string
+	query = "SELECT id, actors FROM notifications WHERE user_id = $1 AND type = 'like' AND post_id = $2 AND read = false FOR UPDATE"
+	err = tx.QueryRow(query, userID, postID).Scan(&nid, pq.Array(&oldActors))
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("could not query select unread like notification: %v\n", err)
+		return
+	}
+
+	n := Notification{UserID: userID, Type: "like", PostID: &postID}
+	if err == sql.ErrNoRows {
+		query = "INSERT INTO notifications (user_id, actors, type, post_id) VALUES ($1, $2, 'like', $3) RETURNING id, issued_at"
+		if err = tx.QueryRow(query, userID, pq.Array(actors), postID).Scan(&n.ID, &n.IssuedAt); err != nil {
+			log.Printf("could not insert like notification: %v\n", err)
+			return
+		}
+	} else {
+		seen := map[string]bool{}
+		for _, actor := range actors {
+			seen[actor] = true
+		}
+		for _, actor := range oldActors {
+			if !seen[actor] {
+				seen[actor] = true
+				actors = append(actors, actor)
+			}
+		}
+
+		query = "UPDATE notifications SET actors = $1, issued_at = now() WHERE id = $2 RETURNING issued_at"
+		if err = tx.QueryRow(query, pq.Array(actors), nid).Scan(&n.IssuedAt); err != nil {
+			log.Printf("could not update like notification: %v\n", err)
+			return
+		}
+
+		n.ID = nid
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("could not commit to notify likes: %v\n", err)
+		return
+	}
+
+	n.Actors = actors
+	go s.broadcastNotification(n)
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// LikedPosts returns the posts a user liked, the most recently liked first, with
+// backward pagination where before is the id of the last post of the previous page.
+// The user may hide them with their likes visibility, see PrivacySettings.
+func (s *Service) LikedPosts(ctx context.Context, username string, last int, before int64) ([]Post, error) {
+	username = validation.NormalizeUsername(username)
+	var v validation.Validator
+	v.Username("username", username)
+	v.Cursor("before", before)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkLikesVisible(ctx, username); err != nil {
+		return nil, err
+	}
+
+	uid, auth := ctx.Value(KeyAuthUserID).(int64)
+	last = validation.PageSize(last)
+	query, args, err := buildQuery(`
+		SELECT p.id, p.content, p.spoiler_of, p.nsfw, p.license, p.likes_count, p.comments_count, p.created_at, u.username, u.avatar, u.verified
+		{{if .auth}}
+		, p.user_id = @uid AS mine
+		, vl.user_id IS NOT NULL AS liked
+		{{end}}
+		FROM post_likes l
+		INNER JOIN posts p ON l.post_id = p.id
+		INNER JOIN users u ON p.user_id = u.id
+		{{if .auth}}
+		LEFT JOIN post_likes vl ON vl.user_id = @uid AND vl.post_id = p.id
+		{{end}}
+		WHERE l.user_id = (SELECT id FROM users WHERE lower(username) = lower(@username))
+		{{template "nsfwFilter" .}}
+		AND NOT p.archived
+		{{if .before}}
+		AND (l.created_at, l.post_id) < (
+			SELECT created_at, post_id FROM post_likes WHERE user_id = l.user_id AND post_id = @before
+		)
+		{{end}}
+		ORDER BY l.created_at DESC, l.post_id DESC
+		LIMIT @last`, map[string]interface{}{
+		"auth":       auth,
+		"uid":        uid,
+		"nsfwBornBy": s.nsfwBornBy(),
+		"username":   username,
+		"before":     before,
+		"last":       last,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build liked posts sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select liked posts: %v", err)
+	}
+
+	defer rows.Close()
+
+	pp := make([]Post, 0, last)
+	for rows.Next() {
+		var p Post
+		var u User
+		var avatar sql.NullString
+		dest := []interface{}{&p.ID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.License, &p.LikesCount, &p.CommentsCount, &p.CreatedAt, &u.Username, &avatar, &u.Verified}
+		if auth {
+			dest = append(dest, &p.Mine, &p.Liked)
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan liked post: %v", err)
+		}
+
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			u.AvatarURL = &avatarURL
+		}
+
+		p.User = &u
+		pp = append(pp, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate liked post rows: %v", err)
+	}
+
+	if err = s.fillPosts(ctx, postPtrs(pp)); err != nil {
+		return nil, err
+	}
+
+	return pp, nil
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	gonanoid "github.com/matoous/go-nanoid"
+)
+
+// maxPostLinks tracked per post. Further links are left as is.
+const maxPostLinks = 10
+
+// linkCodeLength of the codes tracked links redirect through.
+const linkCodeLength = 10
+
+var reLink = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// ErrLinkNotFound denotes a tracked link that was not found
+var ErrLinkNotFound = errors.New("link not found")
+
+// PostLink is a link in the content of a post. Clients open TrackedURL
+// instead of URL so clicks are counted. Preview is set once the linked
+// page has been fetched.
+type PostLink struct {
+	URL        string       `json:"url"`
+	TrackedURL string       `json:"trackedUrl"`
+	Preview    *LinkPreview `json:"preview,omitempty"`
+}
+
+// postLinks in the order they appear in content, without duplicates
+// and without the punctuation that usually ends a sentence after them.
+func postLinks(content string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, link := range reLink.FindAllString(content, -1) {
+		link = strings.TrimRight(link, ".,;:!?)]}'")
+		if seen[link] {
+			continue
+		}
+
+		seen[link] = true
+		out = append(out, link)
+		if len(out) == maxPostLinks {
+			break
+		}
+	}
+
+	return out
+}
+
+func (s *Service) linkURL(code string) string {
+	return s.origin + "/l/" + code
+}
+
+// insertPostLinks tracks the links in the content of the post.
+func (s *Service) insertPostLinks(ctx context.Context, tx *sql.Tx, postID int64, content string) ([]PostLink, error) {
+	var out []PostLink
+	for _, link := range postLinks(content) {
+		code, err := gonanoid.Nanoid(linkCodeLength)
+		if err != nil {
+			return nil, fmt.Errorf("could not generate link code: %v", err)
+		}
+
+		query := "INSERT INTO post_links (code, post_id, url) VALUES ($1, $2, $3)"
+		if _, err = tx.ExecContext(ctx, query, code, postID, link); err != nil {
+			return nil, fmt.Errorf("could not insert post link: %v", err)
+		}
+
+		out = append(out, PostLink{URL: link, TrackedURL: s.linkURL(code)})
+	}
+
+	return out, nil
+}
+
+// fillPostsLinks sets the tracked links of each post along with their previews.
+// Stale previews are still returned while they are refreshed in the background.
+func (s *Service) fillPostsLinks(ctx context.Context, pp []*Post) error {
+	if len(pp) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(pp))
+	for i, p := range pp {
+		ids[i] = p.ID
+	}
+
+	query := `SELECT l.post_id, l.code, l.url
+		, lp.url, lp.title, lp.description, lp.image_url, lp.site_name, lp.fetched_at
+		, lp.fetched_at < now() - $2::INTERVAL
+		FROM post_links l
+		LEFT JOIN link_previews lp ON lp.url = l.preview_url
+		WHERE l.post_id = ANY($1)
+		ORDER BY l.id`
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids), interval(LinkPreviewTTL))
+	if err != nil {
+		return fmt.Errorf("could not query select post links: %v", err)
+	}
+
+	defer rows.Close()
+
+	links := map[int64][]PostLink{}
+	stale := map[string]bool{}
+	for rows.Next() {
+		var postID int64
+		var code string
+		var l PostLink
+		var previewURL *string
+		var preview LinkPreview
+		var fetchedAt *time.Time
+		var expired *bool
+		dest := []interface{}{
+			&postID, &code, &l.URL,
+			&previewURL, &preview.Title, &preview.Description, &preview.ImageURL, &preview.SiteName, &fetchedAt,
+			&expired,
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return fmt.Errorf("could not scan post link: %v", err)
+		}
+
+		l.TrackedURL = s.linkURL(code)
+		if previewURL != nil {
+			preview.URL = *previewURL
+			preview.FetchedAt = *fetchedAt
+			l.Preview = &preview
+			if *expired {
+				stale[preview.URL] = true
+			}
+		}
+
+		links[postID] = append(links[postID], l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("could not iterate post link rows: %v", err)
+	}
+
+	for _, p := range pp {
+		p.Links = links[p.ID]
+	}
+
+	for previewURL := range stale {
+		go s.refreshLinkPreview(previewURL)
+	}
+
+	return nil
+}
+
+// FollowLink counts a click on a tracked link and returns where it points to.
+// Only the count is kept; nothing about who clicked.
+func (s *Service) FollowLink(ctx context.Context, code string) (string, error) {
+	var url string
+	query := "UPDATE post_links SET clicks = clicks + 1 WHERE code = $1 RETURNING url"
+	err := s.db.QueryRowContext(ctx, query, code).Scan(&url)
+	if err == sql.ErrNoRows {
+		return "", ErrLinkNotFound
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not update link clicks: %v", err)
+	}
+
+	return url, nil
+}
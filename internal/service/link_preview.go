@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/preview"
+)
+
+const (
+	// LinkPreviewTTL is how long a fetched preview is served before it is fetched again.
+	LinkPreviewTTL = 24 * time.Hour
+	// linkPreviewClaim is how long an instance has to refresh a stale
+	// preview before another one may try.
+	linkPreviewClaim = time.Minute
+)
+
+// LinkPreview of the page a post link points to. Previews are shared
+// by every link to the same page, once canonicalized.
+type LinkPreview struct {
+	URL         string    `json:"url"`
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	ImageURL    *string   `json:"imageUrl"`
+	SiteName    *string   `json:"siteName"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+}
+
+// previewPostLinks sets the preview of each link of the post,
+// fetching the ones not cached or stale.
+func (s *Service) previewPostLinks(postID int64) {
+	ctx := context.Background()
+	rows, err := s.db.QueryContext(ctx, "SELECT id, url FROM post_links WHERE post_id = $1", postID)
+	if err != nil {
+		log.Printf("could not query select post links to preview: %v\n", err)
+		return
+	}
+
+	type link struct {
+		id  int64
+		url string
+	}
+	var links []link
+	for rows.Next() {
+		var l link
+		if err = rows.Scan(&l.id, &l.url); err != nil {
+			rows.Close()
+			log.Printf("could not scan post link to preview: %v\n", err)
+			return
+		}
+
+		links = append(links, l)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		log.Printf("could not iterate post link to preview rows: %v\n", err)
+		return
+	}
+
+	for _, l := range links {
+		previewURL, err := s.linkPreviewURL(ctx, l.url)
+		if err != nil {
+			log.Printf("could not preview link: %v\n", err)
+			continue
+		}
+
+		if _, err = s.db.ExecContext(ctx, "UPDATE post_links SET preview_url = $1 WHERE id = $2", previewURL, l.id); err != nil {
+			log.Printf("could not update post link preview: %v\n", err)
+		}
+	}
+}
+
+// linkPreviewURL returns the canonical URL the preview of the link is cached under.
+// Links are canonicalized and their redirects resolved, so the same page linked
+// many ways is fetched once. Previews past their TTL are fetched again.
+func (s *Service) linkPreviewURL(ctx context.Context, link string) (string, error) {
+	canonical, err := preview.Canonicalize(link)
+	if err != nil {
+		return "", err
+	}
+
+	var previewURL string
+	var fresh bool
+	query := `SELECT a.preview_url, p.fetched_at > now() - $2::INTERVAL
+		FROM link_preview_aliases a
+		INNER JOIN link_previews p ON p.url = a.preview_url
+		WHERE a.url = $1`
+	err = s.db.QueryRowContext(ctx, query, canonical, interval(LinkPreviewTTL)).Scan(&previewURL, &fresh)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("could not query select link preview alias: %v", err)
+	}
+
+	if err == nil && (fresh || !s.claimLinkPreview(ctx, previewURL)) {
+		return previewURL, nil
+	}
+
+	p, err := preview.Fetch(ctx, canonical)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	query = `INSERT INTO link_previews (url, title, description, image_url, site_name, fetched_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), now())
+		ON CONFLICT (url) DO UPDATE SET
+			title = EXCLUDED.title, description = EXCLUDED.description,
+			image_url = EXCLUDED.image_url, site_name = EXCLUDED.site_name,
+			fetched_at = EXCLUDED.fetched_at, refreshing_at = NULL`
+	if _, err = tx.ExecContext(ctx, query, p.URL, p.Title, p.Description, p.ImageURL, p.SiteName); err != nil {
+		return "", fmt.Errorf("could not upsert link preview: %v", err)
+	}
+
+	query = `INSERT INTO link_preview_aliases (url, preview_url) VALUES ($1, $2), ($2, $2)
+		ON CONFLICT (url) DO UPDATE SET preview_url = EXCLUDED.preview_url`
+	if _, err = tx.ExecContext(ctx, query, canonical, p.URL); err != nil {
+		return "", fmt.Errorf("could not upsert link preview aliases: %v", err)
+	}
+
+	// The page moved since it was last fetched; links to it follow.
+	if previewURL != "" && previewURL != p.URL {
+		query = "UPDATE post_links SET preview_url = $1 WHERE preview_url = $2"
+		if _, err = tx.ExecContext(ctx, query, p.URL, previewURL); err != nil {
+			return "", fmt.Errorf("could not update moved link previews: %v", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("could not commit to cache link preview: %v", err)
+	}
+
+	return p.URL, nil
+}
+
+// claimLinkPreview reports whether this instance gets to refresh the stale
+// preview, so concurrent posts and readers don't all fetch it at once.
+func (s *Service) claimLinkPreview(ctx context.Context, previewURL string) bool {
+	query := `UPDATE link_previews SET refreshing_at = now()
+		WHERE url = $1 AND (refreshing_at IS NULL OR refreshing_at < now() - $2::INTERVAL)`
+	res, err := s.db.ExecContext(ctx, query, previewURL, interval(linkPreviewClaim))
+	if err != nil {
+		log.Printf("could not claim link preview refresh: %v\n", err)
+		return false
+	}
+
+	n, _ := res.RowsAffected()
+	return n != 0
+}
+
+// refreshLinkPreview fetches the stale preview again, if no one else is.
+func (s *Service) refreshLinkPreview(previewURL string) {
+	if _, err := s.linkPreviewURL(context.Background(), previewURL); err != nil {
+		log.Printf("could not refresh link preview: %v\n", err)
+	}
+}
+
+func interval(d time.Duration) string {
+	return fmt.Sprintf("%d seconds", int64(d.Seconds()))
+}
@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+var (
+	// ErrListNotFound denotes a list that was not found
+	ErrListNotFound = errors.New("list not found")
+)
+
+// List of users curated by its owner.
+type List struct {
+	ID           int64     `json:"id"`
+	UserID       int64     `json:"-"`
+	Name         string    `json:"name"`
+	MembersCount int       `json:"membersCount"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// CreateList for the authenticated user.
+func (s *Service) CreateList(ctx context.Context, name string) (List, error) {
+	var l List
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return l, ErrUnauthenticated
+	}
+
+	var v validation.Validator
+	name = strings.TrimSpace(name)
+	v.Content("name", name, validation.MaxNameLength)
+	if err := v.Err(); err != nil {
+		return l, err
+	}
+
+	query := "INSERT INTO lists (user_id, name) VALUES ($1, $2) RETURNING id, created_at"
+	if err := s.db.QueryRowContext(ctx, query, uid, name).Scan(&l.ID, &l.CreatedAt); err != nil {
+		return l, fmt.Errorf("could not insert list: %v", err)
+	}
+
+	l.UserID = uid
+	l.Name = name
+
+	return l, nil
+}
+
+// Lists of the authenticated user by name.
+func (s *Service) Lists(ctx context.Context) ([]List, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	query := "SELECT id, name, members_count, created_at FROM lists WHERE user_id = $1 ORDER BY name"
+	rows, err := s.db.QueryContext(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select lists: %v", err)
+	}
+
+	defer rows.Close()
+
+	ll := []List{}
+	for rows.Next() {
+		l := List{UserID: uid}
+		if err = rows.Scan(&l.ID, &l.Name, &l.MembersCount, &l.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan list: %v", err)
+		}
+
+		ll = append(ll, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate list rows: %v", err)
+	}
+
+	return ll, nil
+}
+
+// RenameList owned by the authenticated user.
+func (s *Service) RenameList(ctx context.Context, listID int64, name string) (List, error) {
+	var l List
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return l, ErrUnauthenticated
+	}
+
+	var v validation.Validator
+	name = strings.TrimSpace(name)
+	v.Content("name", name, validation.MaxNameLength)
+	if err := v.Err(); err != nil {
+		return l, err
+	}
+
+	query := "UPDATE lists SET name = $1 WHERE id = $2 AND user_id = $3 RETURNING id, name, members_count, created_at"
+	err := s.db.QueryRowContext(ctx, query, name, listID, uid).Scan(&l.ID, &l.Name, &l.MembersCount, &l.CreatedAt)
+	if err == sql.ErrNoRows {
+		return l, ErrListNotFound
+	}
+
+	if err != nil {
+		return l, fmt.Errorf("could not update list: %v", err)
+	}
+
+	l.UserID = uid
+
+	return l, nil
+}
+
+// DeleteList owned by the authenticated user.
+func (s *Service) DeleteList(ctx context.Context, listID int64) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	query := "DELETE FROM lists WHERE id = $1 AND user_id = $2"
+	res, err := s.db.ExecContext(ctx, query, listID, uid)
+	if err != nil {
+		return fmt.Errorf("could not delete list: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrListNotFound
+	}
+
+	return nil
+}
+
+// AddListMember to a list owned by the authenticated user.
+func (s *Service) AddListMember(ctx context.Context, listID int64, username string) error {
+	return s.updateListMembers(ctx, listID, username, true)
+}
+
+// RemoveListMember from a list owned by the authenticated user.
+func (s *Service) RemoveListMember(ctx context.Context, listID int64, username string) error {
+	return s.updateListMembers(ctx, listID, username, false)
+}
+
+func (s *Service) updateListMembers(ctx context.Context, listID int64, username string, add bool) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	var v validation.Validator
+	username = validation.NormalizeUsername(username)
+	v.Username("username", username)
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	query := "SELECT id FROM lists WHERE id = $1 AND user_id = $2 FOR UPDATE"
+	err = tx.QueryRowContext(ctx, query, listID, uid).Scan(&listID)
+	if err == sql.ErrNoRows {
+		return ErrListNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not query select list for update: %v", err)
+	}
+
+	var memberID int64
+	query = "SELECT id FROM users WHERE lower(username) = lower($1)"
+	err = tx.QueryRowContext(ctx, query, username).Scan(&memberID)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not query select list member id: %v", err)
+	}
+
+	var res sql.Result
+	delta := 1
+	if add {
+		query = "INSERT INTO list_members (list_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+		res, err = tx.ExecContext(ctx, query, listID, memberID)
+	} else {
+		query = "DELETE FROM list_members WHERE list_id = $1 AND user_id = $2"
+		res, err = tx.ExecContext(ctx, query, listID, memberID)
+		delta = -1
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not update list members: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n != 0 {
+		query = "UPDATE lists SET members_count = members_count + $1 WHERE id = $2"
+		if _, err = tx.ExecContext(ctx, query, delta, listID); err != nil {
+			return fmt.Errorf("could not update list members count: %v", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit list members update: %v", err)
+	}
+
+	return nil
+}
+
+// ListMembers of a list owned by the authenticated user in ascending order with forward pagination.
+func (s *Service) ListMembers(ctx context.Context, listID int64, first int, after string) ([]User, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	if err := s.checkListOwner(ctx, listID, uid); err != nil {
+		return nil, err
+	}
+
+	first = validation.PageSize(first)
+	after = strings.TrimSpace(after)
+	query, args, err := buildQuery(`
+		SELECT users.id, username, avatar, verified
+		FROM list_members
+		INNER JOIN users ON list_members.user_id = users.id
+		WHERE list_members.list_id = @list_id
+		{{if .after}}AND username > @after{{end}}
+		ORDER BY username ASC
+		LIMIT @first`, map[string]interface{}{
+		"list_id": listID,
+		"after":   after,
+		"first":   first,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build list members sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select list members: %v", err)
+	}
+
+	defer rows.Close()
+
+	uu := make([]User, 0, first)
+	for rows.Next() {
+		var u User
+		var avatar sql.NullString
+		if err = rows.Scan(&u.ID, &u.Username, &avatar, &u.Verified); err != nil {
+			return nil, fmt.Errorf("could not scan list member: %v", err)
+		}
+
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			u.AvatarURL = &avatarURL
+		}
+
+		uu = append(uu, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate list member rows: %v", err)
+	}
+
+	return uu, nil
+}
+
+// ListTimeline returns the posts of the list members in descending order with backward pagination.
+func (s *Service) ListTimeline(ctx context.Context, listID int64, last int, before int64) ([]Post, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	var v validation.Validator
+	v.Cursor("before", before)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkListOwner(ctx, listID, uid); err != nil {
+		return nil, err
+	}
+
+	last = validation.PageSize(last)
+	query, args, err := buildQuery(`
+		SELECT p.id, p.content, p.spoiler_of, p.nsfw, p.license, p.likes_count, p.comments_count, p.created_at
+		, p.user_id = @uid AS mine
+		, pl.user_id IS NOT NULL AS liked
+		, u.username, u.avatar, u.verified
+		FROM posts p
+		INNER JOIN list_members lm ON lm.user_id = p.user_id
+		INNER JOIN users u ON p.user_id = u.id
+		LEFT JOIN post_likes pl ON pl.user_id = @uid AND pl.post_id = p.id
+		WHERE lm.list_id = @list_id
+		{{template "nsfwFilter" .}}
+		AND NOT p.archived
+		{{if .before}}AND p.id < @before{{end}}
+		ORDER BY p.id DESC
+		LIMIT @last`, map[string]interface{}{
+		"auth":       true,
+		"uid":        uid,
+		"nsfwBornBy": s.nsfwBornBy(),
+		"list_id":    listID,
+		"before":     before,
+		"last":       last,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build list timeline sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select list timeline: %v", err)
+	}
+
+	defer rows.Close()
+
+	pp := make([]Post, 0, last)
+	for rows.Next() {
+		var p Post
+		var u User
+		var avatar sql.NullString
+		if err = rows.Scan(&p.ID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.License, &p.LikesCount, &p.CommentsCount, &p.CreatedAt,
+			&p.Mine, &p.Liked, &u.Username, &avatar, &u.Verified); err != nil {
+			return nil, fmt.Errorf("could not scan list timeline post: %v", err)
+		}
+
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			u.AvatarURL = &avatarURL
+		}
+
+		p.User = &u
+		pp = append(pp, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate list timeline rows: %v", err)
+	}
+
+	if err = s.fillPosts(ctx, postPtrs(pp)); err != nil {
+		return nil, err
+	}
+
+	return pp, nil
+}
+
+func (s *Service) checkListOwner(ctx context.Context, listID, uid int64) error {
+	var owned bool
+	query := "SELECT EXISTS (SELECT 1 FROM lists WHERE id = $1 AND user_id = $2)"
+	if err := s.db.QueryRowContext(ctx, query, listID, uid).Scan(&owned); err != nil {
+		return fmt.Errorf("could not query select list existence: %v", err)
+	}
+
+	if !owned {
+		return ErrListNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// Locale of the authenticated user, used for the emails sent to them.
+func (s *Service) Locale(ctx context.Context) (string, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+
+	var locale string
+	if err := s.db.QueryRowContext(ctx, "SELECT locale FROM users WHERE id = $1", uid).Scan(&locale); err != nil {
+		return "", fmt.Errorf("could not query select user locale: %v", err)
+	}
+
+	return locale, nil
+}
+
+// SetLocale of the authenticated user. Emails fall back to English
+// for locales they are not translated to.
+func (s *Service) SetLocale(ctx context.Context, locale string) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	var v validation.Validator
+	v.Lang("locale", locale)
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE users SET locale = $1 WHERE id = $2", locale, uid); err != nil {
+		return fmt.Errorf("could not update user locale: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/djomlaa/socnet/internal/validation"
+	"github.com/lib/pq"
+)
+
+const (
+	// DefaultNearbyRadius in meters used when none is requested.
+	DefaultNearbyRadius = 5000
+	// MaxNearbyRadius in meters the nearby feed can search within.
+	MaxNearbyRadius = 100000
+)
+
+// PostLocation tags a post with coordinates, a named place or both.
+type PostLocation struct {
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	Place     *string  `json:"place,omitempty"`
+	// PlaceID of a known place. Its name and coordinates
+	// fill the ones not given explicitly.
+	PlaceID *int64 `json:"placeId,omitempty"`
+}
+
+// NearbyArea to search for posts in. Either a circle of Radius meters
+// around the coordinates or, when Bounds is set, a bounding box.
+type NearbyArea struct {
+	Latitude  float64
+	Longitude float64
+	Radius    int
+	Bounds    *BoundingBox
+}
+
+// BoundingBox given by the longitude of its west and east edges
+// and the latitude of its south and north ones.
+type BoundingBox struct {
+	West  float64
+	South float64
+	East  float64
+	North float64
+}
+
+func validateLocation(v *validation.Validator, field string, loc *PostLocation) {
+	if loc.Place != nil {
+		*loc.Place = strings.TrimSpace(*loc.Place)
+		if *loc.Place == "" {
+			loc.Place = nil
+		} else {
+			v.Check(utf8.RuneCountInString(*loc.Place) <= validation.MaxPlaceLength, field, "place too long")
+		}
+	}
+
+	v.Check((loc.Latitude == nil) == (loc.Longitude == nil), field, "latitude and longitude go together")
+	if loc.Latitude != nil && loc.Longitude != nil {
+		v.Coordinates(field, *loc.Latitude, *loc.Longitude)
+	}
+
+	v.Check(loc.Latitude != nil || loc.Place != nil || loc.PlaceID != nil, field, "coordinates or place required")
+}
+
+// insertPostLocation tags the post with the location unless the author
+// chose to strip location from what they publish. The stored location is returned.
+func insertPostLocation(ctx context.Context, tx *sql.Tx, uid, postID int64, loc *PostLocation) (*PostLocation, error) {
+	if loc == nil {
+		return nil, nil
+	}
+
+	if loc.PlaceID != nil {
+		if err := fillLocationPlace(ctx, tx, loc); err != nil {
+			return nil, err
+		}
+	}
+
+	query := `INSERT INTO post_locations (post_id, latitude, longitude, place, place_id)
+		SELECT $1, $2, $3, $4, $5 FROM users WHERE id = $6 AND NOT strip_post_location`
+	res, err := tx.ExecContext(ctx, query, postID, loc.Latitude, loc.Longitude, loc.Place, loc.PlaceID, uid)
+	if err != nil {
+		return nil, fmt.Errorf("could not insert post location: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+
+	return loc, nil
+}
+
+func (s *Service) fillPostsLocation(ctx context.Context, pp []*Post) error {
+	if len(pp) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(pp))
+	for i, p := range pp {
+		ids[i] = p.ID
+	}
+
+	query := "SELECT post_id, latitude, longitude, place, place_id FROM post_locations WHERE post_id = ANY($1)"
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("could not query select post locations: %v", err)
+	}
+
+	defer rows.Close()
+
+	locs := map[int64]*PostLocation{}
+	for rows.Next() {
+		var postID int64
+		var loc PostLocation
+		if err = rows.Scan(&postID, &loc.Latitude, &loc.Longitude, &loc.Place, &loc.PlaceID); err != nil {
+			return fmt.Errorf("could not scan post location: %v", err)
+		}
+
+		locs[postID] = &loc
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("could not iterate post location rows: %v", err)
+	}
+
+	for _, p := range pp {
+		p.Location = locs[p.ID]
+	}
+
+	return nil
+}
+
+// NearbyPosts tagged within the given area, in descending order with backward pagination.
+func (s *Service) NearbyPosts(ctx context.Context, area NearbyArea, last int, before int64) ([]Post, error) {
+	if area.Radius == 0 {
+		area.Radius = DefaultNearbyRadius
+	}
+
+	var v validation.Validator
+	if b := area.Bounds; b != nil {
+		v.Coordinates("bbox", b.South, b.West)
+		v.Coordinates("bbox", b.North, b.East)
+		v.Check(b.West < b.East && b.South < b.North, "bbox", "edges out of order")
+	} else {
+		v.Coordinates("location", area.Latitude, area.Longitude)
+		v.Check(area.Radius > 0 && area.Radius <= MaxNearbyRadius, "radius", "out of range")
+	}
+	v.Cursor("before", before)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	var bounds BoundingBox
+	if area.Bounds != nil {
+		bounds = *area.Bounds
+	}
+
+	uid, auth := ctx.Value(KeyAuthUserID).(int64)
+	last = validation.PageSize(last)
+	query, args, err := buildQuery(`
+		SELECT p.id, p.content, p.spoiler_of, p.nsfw, p.license, p.likes_count, p.comments_count, p.created_at, u.username, u.avatar, u.verified
+		{{if .auth}}
+		, p.user_id = @uid AS mine
+		, pl.user_id IS NOT NULL AS liked
+		{{end}}
+		FROM post_locations loc
+		INNER JOIN posts p ON p.id = loc.post_id
+		INNER JOIN users u ON p.user_id = u.id
+		{{if .auth}}
+		LEFT JOIN post_likes pl ON pl.user_id = @uid AND pl.post_id = p.id
+		{{end}}
+		WHERE
+		{{if .bounds}}
+		loc.geog && ST_MakeEnvelope(@west, @south, @east, @north, 4326)::geography
+		{{else}}
+		ST_DWithin(loc.geog, ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326)::geography, @radius)
+		{{end}}
+		{{template "nsfwFilter" .}}
+		AND NOT p.archived
+		{{if .before}}AND p.id < @before{{end}}
+		ORDER BY p.id DESC
+		LIMIT @last`, map[string]interface{}{
+		"auth":       auth,
+		"uid":        uid,
+		"nsfwBornBy": s.nsfwBornBy(),
+		"latitude":   area.Latitude,
+		"longitude":  area.Longitude,
+		"radius":     area.Radius,
+		"bounds":     area.Bounds != nil,
+		"west":       bounds.West,
+		"south":      bounds.South,
+		"east":       bounds.East,
+		"north":      bounds.North,
+		"before":     before,
+		"last":       last,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build nearby posts sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select nearby posts: %v", err)
+	}
+
+	defer rows.Close()
+
+	pp := make([]Post, 0, last)
+	for rows.Next() {
+		var p Post
+		var u User
+		var avatar sql.NullString
+		dest := []interface{}{&p.ID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.License, &p.LikesCount, &p.CommentsCount, &p.CreatedAt, &u.Username, &avatar, &u.Verified}
+		if auth {
+			dest = append(dest, &p.Mine, &p.Liked)
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan nearby post: %v", err)
+		}
+
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			u.AvatarURL = &avatarURL
+		}
+
+		p.User = &u
+		pp = append(pp, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate nearby post rows: %v", err)
+	}
+
+	if err = s.fillPosts(ctx, postPtrs(pp)); err != nil {
+		return nil, err
+	}
+
+	return pp, nil
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/djomlaa/socnet/internal/mailer"
+)
+
+type welcomeMail struct {
+	Origin   string
+	Username string
+}
+
+// sendMail renders the embedded mail template in the given locale and sends it.
+// Addresses that bounced or complained are skipped.
+func (s *Service) sendMail(ctx context.Context, name, locale, to string, data interface{}) error {
+	suppressed, err := s.emailSuppressed(ctx, to)
+	if err != nil {
+		return err
+	}
+
+	if suppressed {
+		log.Printf("skipping %s mail to suppressed address\n", name)
+		return nil
+	}
+
+	m, err := mailer.Render(name, locale, to, data)
+	if err != nil {
+		return fmt.Errorf("could not render %s mail: %v", name, err)
+	}
+
+	if err = s.mailer.Send(ctx, m); err != nil {
+		return fmt.Errorf("could not send %s mail: %v", name, err)
+	}
+
+	return nil
+}
+
+func (s *Service) sendWelcomeMail(email, username, locale string) {
+	data := welcomeMail{Origin: s.origin, Username: username}
+	if err := s.sendMail(context.Background(), mailer.TemplateWelcome, locale, email, data); err != nil {
+		log.Println(err)
+	}
+}
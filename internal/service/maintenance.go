@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// DefaultMaintenanceMessage is shown when maintenance is enabled without a message.
+const DefaultMaintenanceMessage = "socnet is in read-only mode for maintenance, please try again later"
+
+// maxMaintenanceMessageLength in runes.
+const maxMaintenanceMessageLength = 280
+
+// Maintenance is the read-only mode of the instance. While enabled,
+// mutating requests are refused and reads keep working.
+type Maintenance struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
+
+// maintenanceMode holds the Maintenance state of this process.
+type maintenanceMode struct {
+	mu sync.RWMutex
+	m  Maintenance
+}
+
+// Maintenance returns the current read-only mode state. It's cheap enough to call on every request.
+func (s *Service) Maintenance() Maintenance {
+	s.maintenance.mu.RLock()
+	defer s.maintenance.mu.RUnlock()
+	return s.maintenance.m
+}
+
+// SetMaintenance enables or disables the read-only mode. Admin only.
+// The state lives in memory, so it resets on restart and applies to this process only.
+func (s *Service) SetMaintenance(ctx context.Context, in Maintenance) (Maintenance, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return Maintenance{}, err
+	}
+
+	in.Message = strings.TrimSpace(in.Message)
+	var v validation.Validator
+	v.Check(utf8.RuneCountInString(in.Message) <= maxMaintenanceMessageLength, "message", "too long")
+	if err := v.Err(); err != nil {
+		return Maintenance{}, err
+	}
+
+	if !in.Enabled {
+		in.Message = ""
+	} else if in.Message == "" {
+		in.Message = DefaultMaintenanceMessage
+	}
+
+	s.maintenance.mu.Lock()
+	s.maintenance.m = in
+	s.maintenance.mu.Unlock()
+
+	return in, nil
+}
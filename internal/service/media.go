@@ -0,0 +1,444 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/djomlaa/socnet/internal/validation"
+	"github.com/lib/pq"
+	gonanoid "github.com/matoous/go-nanoid"
+)
+
+// MaxMediaBytes to read
+const MaxMediaBytes = 50 << 20
+
+// Media kinds.
+const (
+	MediaImage = "image"
+	MediaVideo = "video"
+)
+
+var mediaDir = path.Join("web", "static", "img", "media")
+
+// thumbnailSize in pixels of the side of media thumbnails.
+const thumbnailSize = 320
+
+// mediaTypes maps the supported content types to their kind and file extension.
+var mediaTypes = map[string][2]string{
+	"image/png":  {MediaImage, ".png"},
+	"image/jpeg": {MediaImage, ".jpeg"},
+	"image/gif":  {MediaImage, ".gif"},
+	"image/webp": {MediaImage, ".webp"},
+	"video/mp4":  {MediaVideo, ".mp4"},
+	"video/webm": {MediaVideo, ".webm"},
+}
+
+var (
+	// ErrMediaNotFound denotes a media that was not found
+	ErrMediaNotFound = errors.New("media not found")
+	// ErrUnsupportedMediaFormat used for unsupported media format.
+	ErrUnsupportedMediaFormat = errors.New("only png, jpeg, gif, webp, mp4 and webm allowed as media")
+)
+
+// Media model
+type Media struct {
+	ID        int64   `json:"id"`
+	UserID    int64   `json:"-"`
+	PostID    *int64  `json:"-"`
+	Kind      string  `json:"kind"`
+	Filename  string  `json:"-"`
+	URL       string  `json:"url"`
+	Thumbnail *string `json:"-"`
+	AltText   *string `json:"altText"`
+	Sensitive bool    `json:"sensitive"`
+	SpoilerOf *string `json:"spoilerOf"`
+	// ThumbnailURL of a small square version of images, for grids.
+	ThumbnailURL *string `json:"thumbnailUrl,omitempty"`
+}
+
+// AccessibilitySettings of a user.
+type AccessibilitySettings struct {
+	// RequireAltText rejects posts with media lacking alt text.
+	RequireAltText bool `json:"requireAltText"`
+}
+
+// UploadMediaInput request
+type UploadMediaInput struct {
+	AltText *string
+	// Sensitive media is blurred by clients regardless of the post NSFW flag.
+	Sensitive bool
+	// SpoilerOf is a content warning shown over the media.
+	SpoilerOf *string
+}
+
+// UpdateMediaInput request. Nil fields are left unchanged;
+// an empty alt text or spoiler removes it.
+type UpdateMediaInput struct {
+	AltText   *string
+	Sensitive *bool
+	SpoilerOf *string
+}
+
+// UploadMedia stores an image or video of the authenticated user to be attached to a post later.
+func (s *Service) UploadMedia(ctx context.Context, r io.Reader, in UploadMediaInput) (Media, error) {
+	var m Media
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return m, ErrUnauthenticated
+	}
+
+	if err := validateUploadMedia(&in); err != nil {
+		return m, err
+	}
+
+	return s.storeMedia(ctx, uid, io.LimitReader(r, MaxMediaBytes), in)
+}
+
+func validateUploadMedia(in *UploadMediaInput) error {
+	var v validation.Validator
+	if in.AltText != nil {
+		*in.AltText = strings.TrimSpace(*in.AltText)
+		v.Content("altText", *in.AltText, validation.MaxAltTextLength)
+	}
+
+	if in.SpoilerOf != nil {
+		*in.SpoilerOf = strings.TrimSpace(*in.SpoilerOf)
+		v.Content("spoilerOf", *in.SpoilerOf, validation.MaxSpoilerLength)
+	}
+
+	return v.Err()
+}
+
+// storeMedia scans and processes the media read from r, storing it for the user.
+func (s *Service) storeMedia(ctx context.Context, uid int64, r io.Reader, in UploadMediaInput) (Media, error) {
+	var m Media
+	r, done, err := s.scanUpload(ctx, uid, r, "media")
+	if err != nil {
+		return m, err
+	}
+
+	defer done()
+
+	br := bufio.NewReaderSize(r, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF {
+		return m, fmt.Errorf("could not read media: %v", err)
+	}
+
+	contentType := http.DetectContentType(head)
+	mt, ok := mediaTypes[contentType]
+	if !ok {
+		return m, ErrUnsupportedMediaFormat
+	}
+
+	filename, err := gonanoid.Nanoid()
+	if err != nil {
+		return m, fmt.Errorf("could not generate media filename: %v", err)
+	}
+
+	filename += mt[1]
+	mediaPath := path.Join(mediaDir, filename)
+	f, err := os.Create(mediaPath)
+	if err != nil {
+		return m, fmt.Errorf("could not create media file: %v", err)
+	}
+
+	defer f.Close()
+
+	if err = stripMetadata(f, br, contentType); err != nil {
+		defer os.Remove(mediaPath)
+		return m, fmt.Errorf("could not write media to disk: %v", err)
+	}
+
+	if thumbnailTypes[contentType] {
+		thumbnail, err := makeThumbnail(mediaPath)
+		if err != nil {
+			log.Printf("could not make media thumbnail: %v\n", err)
+		} else {
+			m.Thumbnail = &thumbnail
+		}
+	}
+
+	query := "INSERT INTO media (user_id, kind, filename, thumbnail, alt_text, sensitive, spoiler_of) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id"
+	if err = s.db.QueryRowContext(ctx, query, uid, mt[0], filename, m.Thumbnail, in.AltText, in.Sensitive, in.SpoilerOf).Scan(&m.ID); err != nil {
+		defer os.Remove(mediaPath)
+		if m.Thumbnail != nil {
+			defer os.Remove(path.Join(mediaDir, *m.Thumbnail))
+		}
+		return m, fmt.Errorf("could not insert media: %v", err)
+	}
+
+	m.UserID = uid
+	m.Kind = mt[0]
+	m.Filename = filename
+	s.setMediaURLs(&m)
+	m.AltText = in.AltText
+	m.Sensitive = in.Sensitive
+	m.SpoilerOf = in.SpoilerOf
+
+	return m, nil
+}
+
+// UpdateMedia uploaded by the authenticated user.
+func (s *Service) UpdateMedia(ctx context.Context, mediaID int64, in UpdateMediaInput) (Media, error) {
+	var m Media
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return m, ErrUnauthenticated
+	}
+
+	var v validation.Validator
+	if in.AltText != nil {
+		if *in.AltText = strings.TrimSpace(*in.AltText); *in.AltText != "" {
+			v.Content("altText", *in.AltText, validation.MaxAltTextLength)
+		}
+	}
+
+	if in.SpoilerOf != nil {
+		if *in.SpoilerOf = strings.TrimSpace(*in.SpoilerOf); *in.SpoilerOf != "" {
+			v.Content("spoilerOf", *in.SpoilerOf, validation.MaxSpoilerLength)
+		}
+	}
+
+	if err := v.Err(); err != nil {
+		return m, err
+	}
+
+	query, args, err := buildQuery(`
+		UPDATE media SET
+		id = id
+		{{if .altText}}, alt_text = NULLIF(@alt_text, ''){{end}}
+		{{if .sensitive}}, sensitive = @sensitive{{end}}
+		{{if .spoilerOf}}, spoiler_of = NULLIF(@spoiler_of, ''){{end}}
+		WHERE id = @media_id AND user_id = @uid
+		RETURNING post_id, kind, filename, thumbnail, alt_text, sensitive, spoiler_of`, map[string]interface{}{
+		"altText":    in.AltText != nil,
+		"alt_text":   in.AltText,
+		"sensitive":  in.Sensitive,
+		"spoilerOf":  in.SpoilerOf != nil,
+		"spoiler_of": in.SpoilerOf,
+		"media_id":   mediaID,
+		"uid":        uid,
+	})
+	if err != nil {
+		return m, fmt.Errorf("could not build update media sql query: %v", err)
+	}
+
+	err = s.db.QueryRowContext(ctx, query, args...).Scan(&m.PostID, &m.Kind, &m.Filename, &m.Thumbnail, &m.AltText, &m.Sensitive, &m.SpoilerOf)
+	if err == sql.ErrNoRows {
+		return m, ErrMediaNotFound
+	}
+
+	if err != nil {
+		return m, fmt.Errorf("could not update media: %v", err)
+	}
+
+	m.ID = mediaID
+	m.UserID = uid
+	s.setMediaURLs(&m)
+
+	if m.PostID != nil {
+		s.purge(postPaths(*m.PostID)...)
+	}
+
+	return m, nil
+}
+
+// AccessibilitySettings of the authenticated user.
+func (s *Service) AccessibilitySettings(ctx context.Context) (AccessibilitySettings, error) {
+	var out AccessibilitySettings
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	query := "SELECT require_alt_text FROM users WHERE id = $1"
+	err := s.db.QueryRowContext(ctx, query, uid).Scan(&out.RequireAltText)
+	if err == sql.ErrNoRows {
+		return out, ErrUserNotFound
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not query select accessibility settings: %v", err)
+	}
+
+	return out, nil
+}
+
+// UpdateAccessibilitySettings of the authenticated user.
+func (s *Service) UpdateAccessibilitySettings(ctx context.Context, in AccessibilitySettings) (AccessibilitySettings, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return in, ErrUnauthenticated
+	}
+
+	query := "UPDATE users SET require_alt_text = $1 WHERE id = $2"
+	if _, err := s.db.ExecContext(ctx, query, in.RequireAltText, uid); err != nil {
+		return in, fmt.Errorf("could not update accessibility settings: %v", err)
+	}
+
+	return in, nil
+}
+
+// attachMedia attaches unattached media of the user to a post, in the given order.
+// Media without alt text is rejected when the user requires it.
+func (s *Service) attachMedia(ctx context.Context, tx *sql.Tx, uid, postID int64, mediaIDs []int64) ([]Media, error) {
+	if len(mediaIDs) == 0 {
+		return nil, nil
+	}
+
+	var requireAltText bool
+	query := "SELECT require_alt_text FROM users WHERE id = $1"
+	if err := tx.QueryRowContext(ctx, query, uid).Scan(&requireAltText); err != nil {
+		return nil, fmt.Errorf("could not query select accessibility settings: %v", err)
+	}
+
+	query = `UPDATE media SET post_id = $1
+		WHERE id = ANY($2::INT[]) AND user_id = $3 AND post_id IS NULL
+		RETURNING id, kind, filename, thumbnail, alt_text, sensitive, spoiler_of`
+	rows, err := tx.QueryContext(ctx, query, postID, pq.Array(mediaIDs), uid)
+	if err != nil {
+		return nil, fmt.Errorf("could not update media post: %v", err)
+	}
+
+	defer rows.Close()
+
+	byID := make(map[int64]Media, len(mediaIDs))
+	var v validation.Validator
+	for rows.Next() {
+		m := Media{UserID: uid, PostID: &postID}
+		if err = rows.Scan(&m.ID, &m.Kind, &m.Filename, &m.Thumbnail, &m.AltText, &m.Sensitive, &m.SpoilerOf); err != nil {
+			return nil, fmt.Errorf("could not scan media: %v", err)
+		}
+
+		v.Check(!requireAltText || m.AltText != nil, "media", "alt text required")
+		s.setMediaURLs(&m)
+		byID[m.ID] = m
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate media rows: %v", err)
+	}
+
+	if len(byID) != len(mediaIDs) {
+		return nil, ErrMediaNotFound
+	}
+
+	if err = v.Err(); err != nil {
+		return nil, err
+	}
+
+	mm := make([]Media, len(mediaIDs))
+	for i, id := range mediaIDs {
+		mm[i] = byID[id]
+	}
+
+	return mm, nil
+}
+
+// postsMedia returns the media of the given posts by post id.
+func (s *Service) postsMedia(ctx context.Context, postIDs []int64) (map[int64][]Media, error) {
+	out := make(map[int64][]Media)
+	if len(postIDs) == 0 {
+		return out, nil
+	}
+
+	query := "SELECT id, user_id, post_id, kind, filename, thumbnail, alt_text, sensitive, spoiler_of FROM media WHERE post_id = ANY($1::INT[]) ORDER BY id"
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, fmt.Errorf("could not query select posts media: %v", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var m Media
+		if err = rows.Scan(&m.ID, &m.UserID, &m.PostID, &m.Kind, &m.Filename, &m.Thumbnail, &m.AltText, &m.Sensitive, &m.SpoilerOf); err != nil {
+			return nil, fmt.Errorf("could not scan media: %v", err)
+		}
+
+		s.setMediaURLs(&m)
+		out[*m.PostID] = append(out[*m.PostID], m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate media rows: %v", err)
+	}
+
+	return out, nil
+}
+
+// fillPostsMedia sets the media of each post.
+func (s *Service) fillPostsMedia(ctx context.Context, pp []*Post) error {
+	ids := make([]int64, len(pp))
+	for i, p := range pp {
+		ids[i] = p.ID
+	}
+
+	media, err := s.postsMedia(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pp {
+		p.Media = media[p.ID]
+	}
+
+	return nil
+}
+
+func (s *Service) mediaURL(filename string) string {
+	return s.origin + "/img/media/" + filename
+}
+
+func (s *Service) setMediaURLs(m *Media) {
+	m.URL = s.mediaURL(m.Filename)
+	if m.Thumbnail != nil {
+		thumbnailURL := s.mediaURL(*m.Thumbnail)
+		m.ThumbnailURL = &thumbnailURL
+	}
+}
+
+// thumbnailTypes are the media content types thumbnails can be made of.
+var thumbnailTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// makeThumbnail of the image stored at mediaPath, next to it.
+// The first frame is used for animated images. It returns the thumbnail filename.
+func makeThumbnail(mediaPath string) (string, error) {
+	img, err := imaging.Open(mediaPath)
+	if err != nil {
+		return "", fmt.Errorf("could not open image: %v", err)
+	}
+
+	filename := strings.TrimSuffix(path.Base(mediaPath), path.Ext(mediaPath)) + "_thumb.jpeg"
+	thumbnailPath := path.Join(path.Dir(mediaPath), filename)
+	f, err := os.Create(thumbnailPath)
+	if err != nil {
+		return "", fmt.Errorf("could not create thumbnail file: %v", err)
+	}
+
+	defer f.Close()
+
+	img = imaging.Fill(img, thumbnailSize, thumbnailSize, imaging.Center, imaging.Lanczos)
+	if err = jpeg.Encode(f, img, &jpeg.Options{Quality: 85}); err != nil {
+		os.Remove(thumbnailPath)
+		return "", fmt.Errorf("could not write thumbnail to disk: %v", err)
+	}
+
+	return filename, nil
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/disintegration/imaging"
+)
+
+// errMalformedWebP used when a WebP file is not a well formed RIFF container.
+var errMalformedWebP = errors.New("malformed webp")
+
+// stripMetadata writes the image read from r to w without its metadata, so
+// uploads don't leak the GPS coordinates or device serials cameras embed in EXIF.
+// JPEG and PNG images are re-encoded with their EXIF orientation applied.
+// WebP images keep their pixels and lose their EXIF and XMP chunks.
+// Other content is copied as is.
+func stripMetadata(w io.Writer, r io.Reader, contentType string) error {
+	switch contentType {
+	case "image/jpeg", "image/png":
+		img, err := imaging.Decode(r, imaging.AutoOrientation(true))
+		if err != nil {
+			return fmt.Errorf("could not decode image: %v", err)
+		}
+
+		if contentType == "image/png" {
+			err = png.Encode(w, img)
+		} else {
+			err = jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+		}
+		if err != nil {
+			return fmt.Errorf("could not encode image: %v", err)
+		}
+
+		return nil
+	case "image/webp":
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("could not read image: %v", err)
+		}
+
+		if b, err = stripWebPMetadata(b); err != nil {
+			return err
+		}
+
+		_, err = w.Write(b)
+		return err
+	}
+
+	_, err := io.Copy(w, r)
+	return err
+}
+
+// VP8X header flags telling which metadata chunks follow.
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+// stripWebPMetadata drops the EXIF and XMP chunks of a WebP file.
+func stripWebPMetadata(b []byte) ([]byte, error) {
+	if len(b) < 12 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WEBP" {
+		return nil, errMalformedWebP
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(b)))
+	out.Write(b[0:12])
+	for rest := b[12:]; len(rest) != 0; {
+		if len(rest) < 8 {
+			return nil, errMalformedWebP
+		}
+
+		fourCC := string(rest[0:4])
+		size := int(binary.LittleEndian.Uint32(rest[4:8]))
+		end := 8 + size + size%2
+		if size < 0 || end > len(rest) {
+			// The padding byte of the last chunk is often left out.
+			if 8+size != len(rest) {
+				return nil, errMalformedWebP
+			}
+
+			end = len(rest)
+		}
+
+		chunk := rest[:end]
+		rest = rest[end:]
+		switch fourCC {
+		case "EXIF", "XMP ":
+			continue
+		case "VP8X":
+			if size < 1 {
+				return nil, errMalformedWebP
+			}
+
+			chunk = append([]byte(nil), chunk...)
+			chunk[8] &^= webpFlagEXIF | webpFlagXMP
+		}
+
+		out.Write(chunk)
+	}
+
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:8], uint32(len(stripped)-8))
+	return stripped, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"github.com/djomlaa/socnet/internal/validation"
 	"github.com/lib/pq"
 	"log"
 	"time"
@@ -15,6 +16,7 @@ type Notification struct {
 	UserID   int64     `json:"-"`
 	Actors   []string  `json:"actors"`
 	Type     string    `json:"type"`
+	PostID   *int64    `json:"postId,omitempty"`
 	Read     bool      `json:"read"`
 	IssuedAt time.Time `json:"issuedAt"`
 }
@@ -26,10 +28,16 @@ func (s *Service) Notifications(ctx context.Context, last int, before int64) ([]
 		return nil, ErrUnauthenticated
 	}
 
-	last = normalizePageSize(last)
+	var v validation.Validator
+	v.Cursor("before", before)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	last = validation.PageSize(last)
 
 	query, args, err := buildQuery(`
-		SELECT id, actors, type, read, issued_at
+		SELECT id, actors, type, post_id, read, issued_at
 		FROM notifications
 		WHERE user_id = @uid
 		{{if .before}}AND id < @before{{end}}
@@ -54,7 +62,7 @@ func (s *Service) Notifications(ctx context.Context, last int, before int64) ([]
 	nn := make([]Notification, 0, last)
 	for rows.Next() {
 		var n Notification
-		if err = rows.Scan(&n.ID, pq.Array(&n.Actors), &n.Type, &n.Read, &n.IssuedAt); err != nil {
+		if err = rows.Scan(&n.ID, pq.Array(&n.Actors), &n.Type, &n.PostID, &n.Read, &n.IssuedAt); err != nil {
 			return nil, fmt.Errorf("could not scan notification: %v", err)
 		}
 		nn = append(nn, n)
@@ -68,6 +76,77 @@ func (s *Service) Notifications(ctx context.Context, last int, before int64) ([]
 	return nn, nil
 }
 
+// NotificationsDelta is what changed in the notifications since a sync position.
+type NotificationsDelta struct {
+	// Changed notifications, new or updated, oldest change first.
+	Changed []Notification `json:"changed"`
+	// Removed ids of notifications.
+	Removed []int64 `json:"removed"`
+	// More changes are left past SyncDeltaSize; sync again from Position.
+	More     bool         `json:"more"`
+	Position SyncPosition `json:"-"`
+}
+
+// NotificationsDelta of the authenticated user since the given position. Marking
+// as read and grouping more actors change notifications. A nil position only
+// returns the current one: take it before loading the notifications.
+func (s *Service) NotificationsDelta(ctx context.Context, since *SyncPosition) (NotificationsDelta, error) {
+	out := NotificationsDelta{Changed: []Notification{}, Removed: []int64{}}
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	if since == nil {
+		var err error
+		out.Position, err = s.syncPosition(ctx, uid, syncNotifications, "notifications")
+		return out, err
+	}
+
+	if since.expired() {
+		return out, ErrSyncExpired
+	}
+
+	query := `SELECT id, actors, type, post_id, read, issued_at, sync_id
+		FROM notifications
+		WHERE user_id = $1 AND sync_id > $2 AND synced_at < now() - $3::INTERVAL
+		ORDER BY sync_id
+		LIMIT $4`
+	rows, err := s.db.QueryContext(ctx, query, uid, since.SyncID, interval(syncSettleDelay), SyncDeltaSize)
+	if err != nil {
+		return out, fmt.Errorf("could not query select notifications delta: %v", err)
+	}
+
+	defer rows.Close()
+
+	var changed []syncChange
+	for rows.Next() {
+		var n Notification
+		var syncID int64
+		if err = rows.Scan(&n.ID, pq.Array(&n.Actors), &n.Type, &n.PostID, &n.Read, &n.IssuedAt, &syncID); err != nil {
+			return out, fmt.Errorf("could not scan notification: %v", err)
+		}
+
+		out.Changed = append(out.Changed, n)
+		changed = append(changed, syncChange{syncID: syncID, itemID: n.ID})
+	}
+
+	if err = rows.Err(); err != nil {
+		return out, fmt.Errorf("could not iterate over notification rows: %v", err)
+	}
+
+	d, err := s.syncDelta(ctx, uid, syncNotifications, *since, changed)
+	if err != nil {
+		return out, err
+	}
+
+	out.Changed = out.Changed[:d.changed]
+	out.Removed = d.removed
+	out.More = d.more
+	out.Position = d.position
+	return out, nil
+}
+
 // MarkNotificationAsRead sets a notification from the authenticated user as read
 func (s *Service) MarkNotificationAsRead(ctx context.Context, notificationID int64) error {
 	uid, ok := ctx.Value(KeyAuthUserID).(int64)
@@ -165,6 +244,37 @@ func (s *Service) notifyFollow(followerID, followeeID int64) {
 
 	if err = tx.Commit(); err != nil {
 		log.Printf("could not commit to notify follow: %v\n", err)
+		return
 	}
-	// TODO broadcast notifications
+
+	go s.broadcastNotification(n)
+}
+
+// returningNotification is appended to the queries inserting or updating
+// notifications so broadcastNotifications can scan them.
+const returningNotification = " RETURNING id, user_id, actors, type, post_id, read, issued_at"
+
+// broadcastNotifications scans the notification rows and broadcasts each one.
+func (s *Service) broadcastNotifications(rows *sql.Rows) error {
+	defer rows.Close()
+
+	nn := []Notification{}
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.UserID, pq.Array(&n.Actors), &n.Type, &n.PostID, &n.Read, &n.IssuedAt); err != nil {
+			return fmt.Errorf("could not scan notification: %v", err)
+		}
+
+		nn = append(nn, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("could not iterate notification rows: %v", err)
+	}
+
+	for _, n := range nn {
+		go s.broadcastNotification(n)
+	}
+
+	return nil
 }
@@ -0,0 +1,400 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+	"github.com/djomlaa/socnet/internal/webauthn"
+)
+
+const (
+	// PasskeyChallengeTTL is how long a passkey ceremony can take.
+	PasskeyChallengeTTL = time.Minute * 5
+	// MaxPasskeys a user can register.
+	MaxPasskeys = 10
+	// maxPasskeyNameLength in runes.
+	maxPasskeyNameLength = 64
+)
+
+var (
+	// ErrPasskeyNotFound denotes a passkey that was not found
+	ErrPasskeyNotFound = errors.New("passkey not found")
+	// ErrPasskeyChallengeNotFound used when the challenge answered was not
+	// issued, expired or was already used
+	ErrPasskeyChallengeNotFound = errors.New("passkey challenge not found")
+	// ErrInvalidPasskey used when a passkey response doesn't verify
+	ErrInvalidPasskey = errors.New("invalid passkey")
+)
+
+// Passkey registered by the authenticated user.
+type Passkey struct {
+	ID         webauthn.Base64URL `json:"id"`
+	Name       string             `json:"name"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	LastUsedAt *time.Time         `json:"lastUsedAt"`
+}
+
+// PasskeyCredential describes a credential to the client.
+type PasskeyCredential struct {
+	Type string             `json:"type"`
+	ID   webauthn.Base64URL `json:"id"`
+}
+
+// PasskeyCredentialParam is an algorithm the client can create a credential with.
+type PasskeyCredentialParam struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// PasskeyCreationOptions for navigator.credentials.create(), binary values base64url encoded.
+type PasskeyCreationOptions struct {
+	Challenge webauthn.Base64URL `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          webauthn.Base64URL `json:"id"`
+		Name        string             `json:"name"`
+		DisplayName string             `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []PasskeyCredentialParam `json:"pubKeyCredParams"`
+	Timeout                int64                    `json:"timeout"`
+	Attestation            string                   `json:"attestation"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	ExcludeCredentials []PasskeyCredential `json:"excludeCredentials"`
+}
+
+// PasskeyRequestOptions for navigator.credentials.get(), binary values base64url encoded.
+// No credentials are allowed explicitly, so the authenticator offers the discoverable ones.
+type PasskeyRequestOptions struct {
+	Challenge        webauthn.Base64URL `json:"challenge"`
+	RPID             string             `json:"rpId"`
+	Timeout          int64              `json:"timeout"`
+	UserVerification string             `json:"userVerification"`
+}
+
+// PasskeyRegistrationInput answers the challenge of PasskeyCreationOptions.
+type PasskeyRegistrationInput struct {
+	Challenge webauthn.Base64URL    `json:"challenge"`
+	Name      string                `json:"name"`
+	Response  webauthn.Registration `json:"response"`
+}
+
+// PasskeyLoginInput answers the challenge of PasskeyRequestOptions.
+type PasskeyLoginInput struct {
+	Challenge webauthn.Base64URL `json:"challenge"`
+	// CredentialID is the raw id of the credential used.
+	CredentialID webauthn.Base64URL `json:"credentialId"`
+	Response     webauthn.Assertion `json:"response"`
+}
+
+// relyingParty passkeys are scoped to, which is the origin of the instance.
+func (s *Service) relyingParty() webauthn.RelyingParty {
+	origin := strings.TrimSuffix(s.origin, "/")
+	rp := webauthn.RelyingParty{Origin: origin}
+	if u, err := url.Parse(origin); err == nil {
+		rp.ID = u.Hostname()
+	}
+	return rp
+}
+
+// passkeyUserHandle identifies the user to their authenticator without personal data.
+func passkeyUserHandle(uid int64) []byte {
+	return []byte(strconv.FormatInt(uid, 10))
+}
+
+// newPasskeyChallenge stores a random challenge for the given user,
+// or for anyone when uid is zero, and clears the expired ones.
+func (s *Service) newPasskeyChallenge(ctx context.Context, uid int64) ([]byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, fmt.Errorf("could not generate passkey challenge: %v", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM passkey_challenges WHERE expires_at < now()"); err != nil {
+		return nil, fmt.Errorf("could not delete expired passkey challenges: %v", err)
+	}
+
+	query := "INSERT INTO passkey_challenges (challenge, user_id, expires_at) VALUES ($1, NULLIF($2, 0), $3)"
+	if _, err := s.db.ExecContext(ctx, query, challenge, uid, time.Now().Add(PasskeyChallengeTTL)); err != nil {
+		return nil, fmt.Errorf("could not insert passkey challenge: %v", err)
+	}
+
+	return challenge, nil
+}
+
+// usePasskeyChallenge deletes the challenge so it can only be answered once.
+func (s *Service) usePasskeyChallenge(ctx context.Context, challenge []byte, uid int64) error {
+	query := "DELETE FROM passkey_challenges WHERE challenge = $1 AND user_id IS NOT DISTINCT FROM NULLIF($2, 0) AND expires_at > now()"
+	res, err := s.db.ExecContext(ctx, query, challenge, uid)
+	if err != nil {
+		return fmt.Errorf("could not delete passkey challenge: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPasskeyChallengeNotFound
+	}
+
+	return nil
+}
+
+// BeginPasskeyRegistration issues the options to create a passkey for the authenticated user.
+// Admins impersonating the user can't register passkeys for them.
+func (s *Service) BeginPasskeyRegistration(ctx context.Context) (PasskeyCreationOptions, error) {
+	var out PasskeyCreationOptions
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	if _, ok := ctx.Value(KeyImpersonatorID).(int64); ok {
+		return out, ErrForbidden
+	}
+
+	u, err := s.userByID(ctx, uid)
+	if err != nil {
+		return out, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM passkeys WHERE user_id = $1", uid)
+	if err != nil {
+		return out, fmt.Errorf("could not query select passkey ids: %v", err)
+	}
+
+	defer rows.Close()
+
+	out.ExcludeCredentials = []PasskeyCredential{}
+	for rows.Next() {
+		c := PasskeyCredential{Type: "public-key"}
+		if err = rows.Scan((*[]byte)(&c.ID)); err != nil {
+			return out, fmt.Errorf("could not scan passkey id: %v", err)
+		}
+
+		out.ExcludeCredentials = append(out.ExcludeCredentials, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return out, fmt.Errorf("could not iterate passkey id rows: %v", err)
+	}
+
+	var v validation.Validator
+	v.Check(len(out.ExcludeCredentials) < MaxPasskeys, "passkeys", "too many passkeys")
+	if err = v.Err(); err != nil {
+		return out, err
+	}
+
+	if out.Challenge, err = s.newPasskeyChallenge(ctx, uid); err != nil {
+		return out, err
+	}
+
+	rp := s.relyingParty()
+	out.RP.ID = rp.ID
+	out.RP.Name = rp.ID
+	out.User.ID = passkeyUserHandle(uid)
+	out.User.Name = u.Username
+	out.User.DisplayName = u.Username
+	for _, alg := range webauthn.Algorithms {
+		out.PubKeyCredParams = append(out.PubKeyCredParams, PasskeyCredentialParam{Type: "public-key", Alg: alg})
+	}
+	out.Timeout = PasskeyChallengeTTL.Milliseconds()
+	out.Attestation = "none"
+	out.AuthenticatorSelection.ResidentKey = "required"
+	out.AuthenticatorSelection.UserVerification = "required"
+
+	return out, nil
+}
+
+// FinishPasskeyRegistration verifies the created credential and stores it as a passkey
+// of the authenticated user.
+func (s *Service) FinishPasskeyRegistration(ctx context.Context, in PasskeyRegistrationInput) (Passkey, error) {
+	var out Passkey
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	if _, ok := ctx.Value(KeyImpersonatorID).(int64); ok {
+		return out, ErrForbidden
+	}
+
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		in.Name = "Passkey"
+	}
+
+	var v validation.Validator
+	v.Check(len([]rune(in.Name)) <= maxPasskeyNameLength, "name", "too long")
+	if err := v.Err(); err != nil {
+		return out, err
+	}
+
+	if err := s.usePasskeyChallenge(ctx, in.Challenge, uid); err != nil {
+		return out, err
+	}
+
+	c, err := s.relyingParty().VerifyRegistration(in.Challenge, in.Response)
+	if err != nil {
+		return out, ErrInvalidPasskey
+	}
+
+	query := `INSERT INTO passkeys (id, user_id, public_key, sign_count, name) VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at`
+	err = s.db.QueryRowContext(ctx, query, c.ID, uid, c.PublicKey, int64(c.SignCount), in.Name).Scan(&out.CreatedAt)
+	if isUniqueViolation(err) {
+		return out, ErrInvalidPasskey
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not insert passkey: %v", err)
+	}
+
+	out.ID = c.ID
+	out.Name = in.Name
+
+	return out, nil
+}
+
+// Passkeys of the authenticated user, most recently created first.
+func (s *Service) Passkeys(ctx context.Context) ([]Passkey, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	query := "SELECT id, name, created_at, last_used_at FROM passkeys WHERE user_id = $1 ORDER BY created_at DESC"
+	rows, err := s.db.QueryContext(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select passkeys: %v", err)
+	}
+
+	defer rows.Close()
+
+	pp := []Passkey{}
+	for rows.Next() {
+		var p Passkey
+		if err = rows.Scan((*[]byte)(&p.ID), &p.Name, &p.CreatedAt, &p.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("could not scan passkey: %v", err)
+		}
+
+		pp = append(pp, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate passkey rows: %v", err)
+	}
+
+	return pp, nil
+}
+
+// DeletePasskey of the authenticated user, given its base64url id.
+func (s *Service) DeletePasskey(ctx context.Context, passkeyID string) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	id, err := base64.RawURLEncoding.DecodeString(passkeyID)
+	if err != nil {
+		return ErrPasskeyNotFound
+	}
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM passkeys WHERE id = $1 AND user_id = $2", id, uid)
+	if err != nil {
+		return fmt.Errorf("could not delete passkey: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPasskeyNotFound
+	}
+
+	return nil
+}
+
+// BeginPasskeyLogin issues the options to log in with a passkey.
+func (s *Service) BeginPasskeyLogin(ctx context.Context) (PasskeyRequestOptions, error) {
+	var out PasskeyRequestOptions
+	var err error
+	if out.Challenge, err = s.newPasskeyChallenge(ctx, 0); err != nil {
+		return out, err
+	}
+
+	out.RPID = s.relyingParty().ID
+	out.Timeout = PasskeyChallengeTTL.Milliseconds()
+	out.UserVerification = "required"
+
+	return out, nil
+}
+
+// PasskeyLogin verifies the passkey assertion and logs its user in,
+// as an alternative to Login that can't be phished.
+func (s *Service) PasskeyLogin(ctx context.Context, in PasskeyLoginInput) (LoginOutput, error) {
+	var out LoginOutput
+	if err := s.usePasskeyChallenge(ctx, in.Challenge, 0); err != nil {
+		return out, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return out, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	var uid, signCount int64
+	c := webauthn.Credential{ID: in.CredentialID}
+	query := `SELECT user_id, public_key, sign_count FROM passkeys
+		WHERE id = $1 AND user_id IN (SELECT id FROM users WHERE deactivated_at IS NULL)
+		FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, c.ID).Scan(&uid, &c.PublicKey, &signCount)
+	if err == sql.ErrNoRows {
+		return out, ErrInvalidPasskey
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not query select passkey: %v", err)
+	}
+
+	if len(in.Response.UserHandle) != 0 && string(in.Response.UserHandle) != string(passkeyUserHandle(uid)) {
+		return out, ErrInvalidPasskey
+	}
+
+	c.SignCount = uint32(signCount)
+	newSignCount, err := s.relyingParty().VerifyAssertion(in.Challenge, c, in.Response)
+	if err == webauthn.ErrCloned {
+		log.Printf("refusing passkey login of user %d: %v\n", uid, err)
+	}
+
+	if err != nil {
+		return out, ErrInvalidPasskey
+	}
+
+	query = "UPDATE passkeys SET sign_count = $1, last_used_at = now() WHERE id = $2"
+	if _, err = tx.ExecContext(ctx, query, int64(newSignCount), c.ID); err != nil {
+		return out, fmt.Errorf("could not update passkey: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return out, fmt.Errorf("could not commit passkey login: %v", err)
+	}
+
+	if out.AuthUser, err = s.userByID(ctx, uid); err != nil {
+		return out, err
+	}
+
+	err = s.startSession(ctx, &out)
+	return out, err
+}
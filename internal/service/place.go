@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// ErrPlaceNotFound denotes a place that was not found
+var ErrPlaceNotFound = errors.New("place not found")
+
+// Place posts can be tagged with.
+type Place struct {
+	ID        int64   `json:"id"`
+	Name      string  `json:"name"`
+	Country   *string `json:"country"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// GeoNamesID of places imported from GeoNames, to update them on reimport.
+	GeoNamesID *int64 `json:"-"`
+}
+
+// Places which name matches the search, for autocompleting the place of a post.
+// Names starting with the search come first.
+func (s *Service) Places(ctx context.Context, search string, last int) ([]Place, error) {
+	search = strings.TrimSpace(search)
+	var v validation.Validator
+	v.Check(search != "", "search", "cannot be empty")
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	last = validation.PageSize(last)
+	query := `SELECT id, name, country, latitude, longitude FROM places
+		WHERE name ILIKE '%' || $1 || '%'
+		ORDER BY name ILIKE $1 || '%' DESC, similarity(name, $1) DESC, id
+		LIMIT $2`
+	rows, err := s.db.QueryContext(ctx, query, search, last)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select places: %v", err)
+	}
+
+	defer rows.Close()
+
+	pp := make([]Place, 0, last)
+	for rows.Next() {
+		var p Place
+		if err = rows.Scan(&p.ID, &p.Name, &p.Country, &p.Latitude, &p.Longitude); err != nil {
+			return nil, fmt.Errorf("could not scan place: %v", err)
+		}
+
+		pp = append(pp, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate place rows: %v", err)
+	}
+
+	return pp, nil
+}
+
+// ImportPlaces inserts the places, updating the ones already imported
+// with the same GeoNames id. It returns how many places were written.
+func (s *Service) ImportPlaces(ctx context.Context, pp []Place) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO places (geonames_id, name, country, latitude, longitude)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (geonames_id) DO UPDATE SET
+			name = EXCLUDED.name, country = EXCLUDED.country,
+			latitude = EXCLUDED.latitude, longitude = EXCLUDED.longitude`)
+	if err != nil {
+		return 0, fmt.Errorf("could not prepare insert place: %v", err)
+	}
+
+	defer stmt.Close()
+
+	var n int
+	for _, p := range pp {
+		var v validation.Validator
+		v.Content("name", p.Name, validation.MaxPlaceLength)
+		v.Coordinates("location", p.Latitude, p.Longitude)
+		if v.Err() != nil {
+			continue
+		}
+
+		if _, err = stmt.ExecContext(ctx, p.GeoNamesID, p.Name, p.Country, p.Latitude, p.Longitude); err != nil {
+			return 0, fmt.Errorf("could not insert place: %v", err)
+		}
+
+		n++
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not commit to import places: %v", err)
+	}
+
+	return n, nil
+}
+
+// fillLocationPlace completes the location with the name and
+// coordinates of its place, for those not given explicitly.
+func fillLocationPlace(ctx context.Context, tx *sql.Tx, loc *PostLocation) error {
+	var p Place
+	query := "SELECT name, latitude, longitude FROM places WHERE id = $1"
+	err := tx.QueryRowContext(ctx, query, *loc.PlaceID).Scan(&p.Name, &p.Latitude, &p.Longitude)
+	if err == sql.ErrNoRows {
+		return ErrPlaceNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not query select post place: %v", err)
+	}
+
+	if loc.Place == nil {
+		loc.Place = &p.Name
+	}
+
+	if loc.Latitude == nil {
+		loc.Latitude = &p.Latitude
+		loc.Longitude = &p.Longitude
+	}
+
+	return nil
+}
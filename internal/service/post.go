@@ -5,64 +5,118 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"github.com/sanity-io/litter"
-	"log"
+	"github.com/djomlaa/socnet/internal/validation"
+	"github.com/lib/pq"
 	"strings"
 	"time"
 )
 
 var (
-	// ErrInvalidContent is used for invalid content
-	ErrInvalidContent = errors.New("invalid content")
-
-	// ErrInvalidSpoiler is used for invalid spoiler
-	ErrInvalidSpoiler = errors.New("invalid spoiler")
-
 	// ErrPostNotFound denotes a post that was not found
 	ErrPostNotFound = errors.New("post not found")
 )
 
 // Post model.
 type Post struct {
-	ID            int64     `json:"id"`
-	UserID        int64     `json:"-"`
-	Content       string    `json:"content"`
-	SpoilerOf     *string   `json:"spoilerOf"`
-	NSFW          bool      `json:"nsfw"`
-	LikesCount    int       `json:"likesCount"`
-	CommentsCount int       `json:"commentsCount"`
-	CreatedAt     time.Time `json:"createdAt"`
-	User          *User     `json:"user,omitempty"`
-	Mine          bool      `json:"mine"`
-	Liked         bool      `json:"liked"`
+	ID            int64         `json:"id"`
+	UserID        int64         `json:"-"`
+	CommunityID   *int64        `json:"-"`
+	Content       string        `json:"content"`
+	SpoilerOf     *string       `json:"spoilerOf"`
+	NSFW          bool          `json:"nsfw"`
+	License       string        `json:"license"`
+	LikesCount    int           `json:"likesCount"`
+	CommentsCount int           `json:"commentsCount"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	User          *User         `json:"user,omitempty"`
+	Community     *string       `json:"community,omitempty"`
+	Location      *PostLocation `json:"location,omitempty"`
+	Links         []PostLink    `json:"links,omitempty"`
+	Media         []Media       `json:"media,omitempty"`
+	Emojis        []Emoji       `json:"emojis,omitempty"`
+	Mine          bool          `json:"mine"`
+	Liked         bool          `json:"liked"`
+	// Pinned is set on posts a moderator pinned to the top of the community feed.
+	Pinned bool `json:"pinned,omitempty"`
+	// ThreadID is the id of the first post of the thread the post is part of.
+	ThreadID *int64 `json:"threadId,omitempty"`
+	// ReplyToPostID is the post of the same author this one continues.
+	ReplyToPostID *int64 `json:"replyToPostId,omitempty"`
 }
 
-//ToggleLikeOutput response
+// ToggleLikeOutput response
 type ToggleLikeOutput struct {
 	Liked      bool `json:"liked"`
 	LikesCount int  `json:"likes_count"`
 }
 
+// CreatePostInput request
+type CreatePostInput struct {
+	Content   string
+	SpoilerOf *string
+	NSFW      bool
+	// Community name to publish the post in. The author must be a member.
+	Community *string
+	// MediaIDs of media uploaded by the author and not attached yet.
+	MediaIDs []int64
+	// License of the post. Defaults to the author default license.
+	License *string
+	// Location to tag the post with. Dropped when the author strips post location.
+	Location *PostLocation
+	// ReplyToPostID chains the post to a previous post of the author, making a thread.
+	ReplyToPostID *int64
+}
+
 // CreatePost publishes a post to the user timeline and fan-outs it to his followers
-func (s *Service) CreatePost(ctx context.Context, content string, spoilerOf *string, nsfw bool) (TimelineItem, error) {
+// and, for community posts, to the community members.
+func (s *Service) CreatePost(ctx context.Context, in CreatePostInput) (TimelineItem, error) {
 	var ti TimelineItem
 	uid, ok := ctx.Value(KeyAuthUserID).(int64)
 	if !ok {
 		return ti, ErrUnauthenticated
 	}
 
-	content = strings.TrimSpace(content)
-	if content == "" || len([]rune(content)) > 480 {
-		return ti, ErrInvalidContent
+	var v validation.Validator
+	in.Content = strings.TrimSpace(in.Content)
+	v.Content("content", in.Content, validation.MaxPostLength)
+	if in.SpoilerOf != nil {
+		*in.SpoilerOf = strings.TrimSpace(*in.SpoilerOf)
+		v.Content("spoilerOf", *in.SpoilerOf, validation.MaxSpoilerLength)
+	}
+	v.Check(len(in.MediaIDs) <= validation.MaxPostMedia, "mediaIds", "too many media")
+	if in.License != nil {
+		*in.License = strings.ToLower(strings.TrimSpace(*in.License))
+		v.Check(validLicense(*in.License), "license", "unknown license")
+	}
+	if in.Location != nil {
+		validateLocation(&v, "location", in.Location)
+	}
+
+	if err := v.Err(); err != nil {
+		return ti, err
 	}
 
-	if spoilerOf != nil {
-		*spoilerOf = strings.TrimSpace(*spoilerOf)
-		if *spoilerOf == "" || len([]rune(content)) > 64 {
-			return ti, ErrInvalidSpoiler
-		}
+	if err := s.checkPostRate(ctx, uid); err != nil {
+		return ti, err
+	}
+
+	texts := []string{in.Content}
+	if in.SpoilerOf != nil {
+		texts = append(texts, *in.SpoilerOf)
+	}
+
+	filtered, err := s.matchWordFilters(ctx, texts...)
+	if err != nil {
+		return ti, err
+	}
+
+	v.Check(!filtered[WordFilterReject], "content", "contains banned words")
+	if err = v.Err(); err != nil {
+		return ti, err
 	}
 
+	in.NSFW = in.NSFW || filtered[WordFilterNSFW]
+
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return ti, fmt.Errorf("could not begin tx: %v", err)
@@ -70,16 +124,75 @@ func (s *Service) CreatePost(ctx context.Context, content string, spoilerOf *str
 
 	defer tx.Rollback()
 
-	query := "INSERT INTO posts (user_id, content, spoiler_of, nsfw) VALUES ($1, $2, $3, $4) RETURNING id, created_at"
-	if err = tx.QueryRowContext(ctx, query, uid, content, spoilerOf, nsfw).Scan(&ti.Post.ID, &ti.Post.CreatedAt); err != nil {
+	var communityID *int64
+	if in.Community != nil {
+		var cid int64
+		var member bool
+		query := `SELECT id, EXISTS (SELECT 1 FROM community_members WHERE community_id = communities.id AND user_id = $2)
+			FROM communities WHERE name = $1`
+		err = tx.QueryRowContext(ctx, query, *in.Community, uid).Scan(&cid, &member)
+		if err == sql.ErrNoRows {
+			return ti, ErrCommunityNotFound
+		}
+
+		if err != nil {
+			return ti, fmt.Errorf("could not query select post community: %v", err)
+		}
+
+		if !member {
+			return ti, ErrNotCommunityMember
+		}
+
+		communityID = &cid
+	}
+
+	var threadID *int64
+	if in.ReplyToPostID != nil {
+		if threadID, err = threadOf(ctx, tx, uid, *in.ReplyToPostID); err != nil {
+			return ti, err
+		}
+	}
+
+	query := `INSERT INTO posts (user_id, content, spoiler_of, nsfw, community_id, license, thread_id, reply_to_post_id)
+		VALUES ($1, $2, $3, $4, $5, COALESCE($6, (SELECT default_license FROM users WHERE id = $1)), $7, $8)
+		RETURNING id, license, created_at`
+	err = tx.QueryRowContext(ctx, query, uid, in.Content, in.SpoilerOf, in.NSFW, communityID, in.License, threadID, in.ReplyToPostID).
+		Scan(&ti.Post.ID, &ti.Post.License, &ti.Post.CreatedAt)
+	if err != nil {
 		return ti, fmt.Errorf("could not insert post %v", err)
 	}
 
+	if ti.Post.Media, err = s.attachMedia(ctx, tx, uid, ti.Post.ID, in.MediaIDs); err != nil {
+		return ti, err
+	}
+
+	if ti.Post.Location, err = insertPostLocation(ctx, tx, uid, ti.Post.ID, in.Location); err != nil {
+		return ti, err
+	}
+
+	if ti.Post.Links, err = s.insertPostLinks(ctx, tx, ti.Post.ID, in.Content); err != nil {
+		return ti, err
+	}
+
+	if filtered[WordFilterFlag] {
+		query = "INSERT INTO post_reviews (post_id, reason) VALUES ($1, $2)"
+		if _, err = tx.ExecContext(ctx, query, ti.Post.ID, "word filter"); err != nil {
+			return ti, fmt.Errorf("could not insert post review: %v", err)
+		}
+	}
+
 	ti.Post.UserID = uid
-	ti.Post.Content = content
-	ti.Post.SpoilerOf = spoilerOf
-	ti.Post.NSFW = nsfw
+	ti.Post.Content = in.Content
+	ti.Post.SpoilerOf = in.SpoilerOf
+	ti.Post.NSFW = in.NSFW
+	ti.Post.Community = in.Community
+	ti.Post.CommunityID = communityID
+	ti.Post.ThreadID = threadID
+	ti.Post.ReplyToPostID = in.ReplyToPostID
 	ti.Post.Mine = true
+	if err = s.fillPostsEmojis(ctx, []*Post{&ti.Post}); err != nil {
+		return ti, err
+	}
 
 	query = "INSERT INTO timeline (user_id, post_id) VALUES ($1, $2) RETURNING id"
 	if err = tx.QueryRowContext(ctx, query, uid, ti.Post.ID).Scan(&ti.ID); err != nil {
@@ -89,77 +202,65 @@ func (s *Service) CreatePost(ctx context.Context, content string, spoilerOf *str
 	ti.UserID = uid
 	ti.PostID = ti.Post.ID
 
-	if err = tx.Commit(); err != nil {
-		return ti, fmt.Errorf("could not commit to create post : %v", err)
+	if err = s.fanout.Enqueue(ctx, tx, ti.Post.ID); err != nil {
+		return ti, err
 	}
 
-	go func(p Post) {
-		u, err := s.userByID(context.Background(), p.UserID)
-		if err != nil {
-			log.Printf("could not get post user : %v\n", err)
-			return
-		}
-		p.User = &u
-		p.Mine = false
-
-		tt, err := s.fanoutPost(p)
-		if err != nil {
-			log.Printf("could not fanout post : %v\n", err)
-			return
-		}
+	created := PostCreated{Post: ti.Post}
+	if err = s.recordEvent(ctx, tx, created); err != nil {
+		return ti, err
+	}
 
-		for _, ti = range tt {
-			log.Println(litter.Sdump(ti))
-			// TODO broadcast timeline items
-		}
+	if err = tx.Commit(); err != nil {
+		return ti, fmt.Errorf("could not commit to create post : %v", err)
+	}
 
-	}(ti.Post)
+	s.publish(created)
 
 	return ti, nil
 
 }
 
-func (s *Service) fanoutPost(p Post) ([]TimelineItem, error) {
-	query := "INSERT INTO timeline (user_id, post_id) " +
-		"SELECT follower_id, $1 FROM follows WHERE followee_id = $2 " +
-		"RETURNING id, user_id"
-	rows, err := s.db.Query(query, p.ID, p.UserID)
-	if err != nil {
-		return nil, fmt.Errorf("could not insert timeline : %v", err)
+// fillPosts sets the data of each post that is loaded separately from the post row.
+func (s *Service) fillPosts(ctx context.Context, pp []*Post) error {
+	if err := s.fillPostsMedia(ctx, pp); err != nil {
+		return err
 	}
 
-	defer rows.Close()
+	if err := s.fillPostsLocation(ctx, pp); err != nil {
+		return err
+	}
 
-	tt := []TimelineItem{}
-	for rows.Next() {
-		var ti TimelineItem
-		if err = rows.Scan(&ti.ID, &ti.UserID); err != nil {
-			return nil, fmt.Errorf("could not scan timeline item : %v", err)
-		}
+	if err := s.fillPostsLinks(ctx, pp); err != nil {
+		return err
+	}
 
-		ti.PostID = p.ID
-		ti.Post = p
+	return s.fillPostsEmojis(ctx, pp)
+}
 
-		tt = append(tt, ti)
-	}
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("could not iterate timeline rows : %v", err)
+func postPtrs(pp []Post) []*Post {
+	out := make([]*Post, len(pp))
+	for i := range pp {
+		out[i] = &pp[i]
 	}
 
-	return tt, nil
+	return out
 }
 
 // Posts from a user in descending order with backward pagination
 func (s *Service) Posts(ctx context.Context, username string, last int, before int64) ([]Post, error) {
-	username = strings.TrimSpace(username)
-	if !reUsername.MatchString(username) {
-		return nil, ErrInvalidUsername
+	username = validation.NormalizeUsername(username)
+	var v validation.Validator
+	v.Username("username", username)
+	v.Cursor("before", before)
+	if err := v.Err(); err != nil {
+		return nil, err
 	}
 
 	uid, auth := ctx.Value(KeyAuthUserID).(int64)
-	last = normalizePageSize(last)
+	last = validation.PageSize(last)
 	query, args, err := buildQuery(`
-		SELECT id, content, spoiler_of, nsfw, likes_count, comments_count, created_at
+		SELECT id, content, spoiler_of, nsfw, license, likes_count, comments_count, created_at
 		{{if .auth}}
 		, p.user_id = @uid AS mine
 		, pl.user_id IS NOT NULL AS liked
@@ -168,18 +269,21 @@ func (s *Service) Posts(ctx context.Context, username string, last int, before i
 		{{if .auth}}
 		LEFT JOIN post_likes pl on pl.user_id = p.user_id and pl.post_id = p.id
 		{{end}}
-		WHERE p.user_id = (SELECT id from users u WHERE u.username = @username)
+		WHERE p.user_id = (SELECT id from users u WHERE lower(u.username) = lower(@username))
+		{{template "nsfwFilter" .}}
+		AND NOT p.archived
 		{{if .before}}
 		AND p.id < @before
 		{{end}}
 		ORDER BY created_at DESC
 		LIMIT @last
 	`, map[string]interface{}{
-		"uid":      uid,
-		"auth":     auth,
-		"username": username,
-		"last":     last,
-		"before":   before,
+		"uid":        uid,
+		"nsfwBornBy": s.nsfwBornBy(),
+		"auth":       auth,
+		"username":   username,
+		"last":       last,
+		"before":     before,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("could not build posts sql query: %v", err)
@@ -194,7 +298,7 @@ func (s *Service) Posts(ctx context.Context, username string, last int, before i
 	pp := make([]Post, 0, last)
 	for rows.Next() {
 		var p Post
-		dest := []interface{}{&p.ID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.LikesCount, &p.CommentsCount, &p.CreatedAt}
+		dest := []interface{}{&p.ID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.License, &p.LikesCount, &p.CommentsCount, &p.CreatedAt}
 		if auth {
 			dest = append(dest, &p.Mine, &p.Liked)
 		}
@@ -209,6 +313,10 @@ func (s *Service) Posts(ctx context.Context, username string, last int, before i
 		return nil, fmt.Errorf("could not iterate posts rows: %v", err)
 	}
 
+	if err = s.fillPosts(ctx, postPtrs(pp)); err != nil {
+		return nil, err
+	}
+
 	return pp, nil
 }
 
@@ -218,7 +326,8 @@ func (s *Service) Post(ctx context.Context, postID int64) (Post, error) {
 	uid, auth := ctx.Value(KeyAuthUserID).(int64)
 
 	query, args, err := buildQuery(`
-		SELECT p.id, p.content, p.spoiler_of, p.nsfw, p.likes_count, p.comments_count, p.created_at, u.username, u.avatar
+		SELECT p.id, p.content, p.spoiler_of, p.nsfw, p.license, p.likes_count, p.comments_count, p.created_at, u.username, u.avatar, u.verified
+		, p.thread_id, p.reply_to_post_id
 		{{if .auth}}
 		, p.user_id = @uid AS mine
 		, pl.user_id IS NOT NULL AS liked
@@ -229,17 +338,20 @@ func (s *Service) Post(ctx context.Context, postID int64) (Post, error) {
 		LEFT JOIN post_likes pl ON pl.user_id = p.user_id AND pl.post_id = p.id
 		{{end}}
 		WHERE p.id = @post_id
+		AND (NOT p.archived{{if .auth}} OR p.user_id = @uid{{end}})
+		{{template "nsfwFilter" .}}
 	`, map[string]interface{}{
-		"uid":     uid,
-		"auth":    auth,
-		"post_id": postID,
+		"uid":        uid,
+		"auth":       auth,
+		"nsfwBornBy": s.nsfwBornBy(),
+		"post_id":    postID,
 	})
 	if err != nil {
 		return p, fmt.Errorf("could not build post sql query: %v", err)
 	}
 	var u User
 	var avatar sql.NullString
-	dest := []interface{}{&p.ID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.LikesCount, &p.CommentsCount, &p.CreatedAt, &u.Username, &avatar}
+	dest := []interface{}{&p.ID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.License, &p.LikesCount, &p.CommentsCount, &p.CreatedAt, &u.Username, &avatar, &u.Verified, &p.ThreadID, &p.ReplyToPostID}
 	if auth {
 		dest = append(dest, &p.Mine, &p.Liked)
 	}
@@ -259,10 +371,171 @@ func (s *Service) Post(ctx context.Context, postID int64) (Post, error) {
 	}
 
 	p.User = &u
+	if err = s.fillPosts(ctx, []*Post{&p}); err != nil {
+		return p, err
+	}
 
 	return p, nil
 }
 
+// SearchPosts by content in descending order with backward pagination
+func (s *Service) SearchPosts(ctx context.Context, search string, last int, before int64) ([]Post, error) {
+	search = strings.TrimSpace(search)
+	var v validation.Validator
+	v.Check(search != "", "search", "cannot be empty")
+	v.Cursor("before", before)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	uid, auth := ctx.Value(KeyAuthUserID).(int64)
+	last = validation.PageSize(last)
+	query, args, err := buildQuery(`
+		SELECT p.id, p.content, p.spoiler_of, p.nsfw, p.license, p.likes_count, p.comments_count, p.created_at, u.username, u.avatar, u.verified
+		{{if .auth}}
+		, p.user_id = @uid AS mine
+		, pl.user_id IS NOT NULL AS liked
+		{{end}}
+		FROM posts p
+		INNER JOIN users u ON p.user_id = u.id
+		{{if .auth}}
+		LEFT JOIN post_likes pl ON pl.user_id = @uid AND pl.post_id = p.id
+		{{end}}
+		WHERE p.content ILIKE '%' || @search || '%'
+		{{template "nsfwFilter" .}}
+		AND NOT p.archived
+		{{if .before}}AND p.id < @before{{end}}
+		ORDER BY p.id DESC
+		LIMIT @last`, map[string]interface{}{
+		"auth":       auth,
+		"uid":        uid,
+		"nsfwBornBy": s.nsfwBornBy(),
+		"search":     search,
+		"before":     before,
+		"last":       last,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build search posts sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query search posts: %v", err)
+	}
+
+	defer rows.Close()
+
+	pp := make([]Post, 0, last)
+	for rows.Next() {
+		var p Post
+		var u User
+		var avatar sql.NullString
+		dest := []interface{}{&p.ID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.License, &p.LikesCount, &p.CommentsCount, &p.CreatedAt, &u.Username, &avatar, &u.Verified}
+		if auth {
+			dest = append(dest, &p.Mine, &p.Liked)
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan searched post: %v", err)
+		}
+
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			u.AvatarURL = &avatarURL
+		}
+
+		p.User = &u
+		pp = append(pp, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate searched post rows: %v", err)
+	}
+
+	if err = s.fillPosts(ctx, postPtrs(pp)); err != nil {
+		return nil, err
+	}
+
+	return pp, nil
+}
+
+// PostsByIDs returns the posts with the given ids in the requested order.
+// Missing posts, archived ones of other users and the NSFW ones the viewer
+// can't see are skipped.
+func (s *Service) PostsByIDs(ctx context.Context, ids []int64) ([]Post, error) {
+	var v validation.Validator
+	v.Check(len(ids) != 0, "ids", "cannot be empty")
+	v.Check(len(ids) <= validation.MaxPageSize, "ids", "too many ids")
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	uid, auth := ctx.Value(KeyAuthUserID).(int64)
+	query, args, err := buildQuery(`
+		SELECT p.id, p.content, p.spoiler_of, p.nsfw, p.license, p.likes_count, p.comments_count, p.created_at, u.username, u.avatar, u.verified
+		{{if .auth}}
+		, p.user_id = @uid AS mine
+		, pl.user_id IS NOT NULL AS liked
+		{{end}}
+		FROM posts p
+		INNER JOIN users u ON p.user_id = u.id
+		{{if .auth}}
+		LEFT JOIN post_likes pl ON pl.user_id = @uid AND pl.post_id = p.id
+		{{end}}
+		WHERE p.id = ANY(@ids::INT[])
+		AND (NOT p.archived{{if .auth}} OR p.user_id = @uid{{end}})
+		{{template "nsfwFilter" .}}
+		ORDER BY array_position(@ids::INT[], p.id)
+	`, map[string]interface{}{
+		"uid":        uid,
+		"auth":       auth,
+		"nsfwBornBy": s.nsfwBornBy(),
+		"ids":        pq.Array(ids),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build posts by ids sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select posts by ids: %v", err)
+	}
+	defer rows.Close()
+
+	pp := make([]Post, 0, len(ids))
+	for rows.Next() {
+		var p Post
+		var u User
+		var avatar sql.NullString
+		dest := []interface{}{&p.ID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.License, &p.LikesCount, &p.CommentsCount, &p.CreatedAt, &u.Username, &avatar, &u.Verified}
+		if auth {
+			dest = append(dest, &p.Mine, &p.Liked)
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan posts: %v", err)
+		}
+
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			u.AvatarURL = &avatarURL
+		}
+
+		p.User = &u
+		pp = append(pp, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate posts rows: %v", err)
+	}
+
+	if err = s.fillPosts(ctx, postPtrs(pp)); err != nil {
+		return nil, err
+	}
+
+	return pp, nil
+}
+
 // TogglePostLike
 func (s *Service) TogglePostLike(ctx context.Context, postID int64) (ToggleLikeOutput, error) {
 	var out ToggleLikeOutput
@@ -313,6 +586,9 @@ func (s *Service) TogglePostLike(ctx context.Context, postID int64) (ToggleLikeO
 	}
 
 	out.Liked = !out.Liked
+	if out.Liked {
+		s.queueLikeNotification(postID, uid)
+	}
 
 	return out, nil
 }
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// ToggleArchiveOutput response
+type ToggleArchiveOutput struct {
+	Archived bool `json:"archived"`
+}
+
+// TogglePostArchive of a post of the authenticated user. Archived posts are
+// hidden from everyone else, from the profile, timelines and search,
+// without being deleted; unarchiving brings them back.
+func (s *Service) TogglePostArchive(ctx context.Context, postID int64) (ToggleArchiveOutput, error) {
+	var out ToggleArchiveOutput
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	var username string
+	query := `UPDATE posts SET archived = NOT archived WHERE id = $1 AND user_id = $2
+		RETURNING archived, (SELECT username FROM users WHERE id = $2)`
+	err := s.db.QueryRowContext(ctx, query, postID, uid).Scan(&out.Archived, &username)
+	if err == sql.ErrNoRows {
+		return out, ErrPostNotFound
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not update post archived: %v", err)
+	}
+
+	s.purge(append(postPaths(postID), profilePaths(username)...)...)
+
+	return out, nil
+}
+
+// ArchivedPosts of the authenticated user in descending order with backward pagination.
+func (s *Service) ArchivedPosts(ctx context.Context, last int, before int64) ([]Post, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	var v validation.Validator
+	v.Cursor("before", before)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	last = validation.PageSize(last)
+	query, args, err := buildQuery(`
+		SELECT p.id, p.content, p.spoiler_of, p.nsfw, p.license, p.likes_count, p.comments_count, p.created_at
+		, pl.user_id IS NOT NULL AS liked
+		FROM posts p
+		LEFT JOIN post_likes pl ON pl.user_id = p.user_id AND pl.post_id = p.id
+		WHERE p.user_id = @uid AND p.archived
+		{{if .before}}AND p.id < @before{{end}}
+		ORDER BY p.id DESC
+		LIMIT @last`, map[string]interface{}{
+		"uid":    uid,
+		"before": before,
+		"last":   last,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build archived posts sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select archived posts: %v", err)
+	}
+
+	defer rows.Close()
+
+	pp := make([]Post, 0, last)
+	for rows.Next() {
+		p := Post{Mine: true}
+		dest := []interface{}{&p.ID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.License, &p.LikesCount, &p.CommentsCount, &p.CreatedAt, &p.Liked}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan archived post: %v", err)
+		}
+
+		pp = append(pp, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate archived post rows: %v", err)
+	}
+
+	if err = s.fillPosts(ctx, postPtrs(pp)); err != nil {
+		return nil, err
+	}
+
+	return pp, nil
+}
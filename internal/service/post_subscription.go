@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// ErrNotFollowing used when subscribing to the posts of a user you don't follow.
+var ErrNotFollowing = errors.New("you must follow the user first")
+
+// TogglePostNotificationsOutput response
+type TogglePostNotificationsOutput struct {
+	PostNotifications bool `json:"postNotifications"`
+}
+
+// TogglePostNotifications subscribes the authenticated user to a notification
+// on every new post of a followee, or unsubscribes them.
+func (s *Service) TogglePostNotifications(ctx context.Context, username string) (TogglePostNotificationsOutput, error) {
+	var out TogglePostNotificationsOutput
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	username = validation.NormalizeUsername(username)
+	var v validation.Validator
+	v.Username("username", username)
+	if err := v.Err(); err != nil {
+		return out, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return out, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	var userID int64
+	var following bool
+	query := `SELECT id, EXISTS (
+		SELECT 1 FROM follows WHERE follower_id = $2 AND followee_id = users.id
+	) FROM users WHERE lower(username) = lower($1)`
+	err = tx.QueryRowContext(ctx, query, username, uid).Scan(&userID, &following)
+	if err == sql.ErrNoRows {
+		return out, ErrUserNotFound
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not query select post subscription user: %v", err)
+	}
+
+	query = "DELETE FROM post_subscriptions WHERE subscriber_id = $1 AND user_id = $2"
+	res, err := tx.ExecContext(ctx, query, uid, userID)
+	if err != nil {
+		return out, fmt.Errorf("could not delete post subscription: %v", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return out, fmt.Errorf("could not count deleted post subscriptions: %v", err)
+	}
+
+	if n == 0 {
+		if !following {
+			return out, ErrNotFollowing
+		}
+
+		query = "INSERT INTO post_subscriptions (subscriber_id, user_id) VALUES ($1, $2)"
+		if _, err = tx.ExecContext(ctx, query, uid, userID); err != nil {
+			return out, fmt.Errorf("could not insert post subscription: %v", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return out, fmt.Errorf("could not commit toggle post notifications: %v", err)
+	}
+
+	out.PostNotifications = n == 0
+	return out, nil
+}
+
+// notifyPostSubscribers notifies the followers subscribed to the posts of the author of the post.
+func (s *Service) notifyPostSubscribers(postID int64) {
+	query := `INSERT INTO notifications (user_id, actors, type, post_id)
+		SELECT ps.subscriber_id, ARRAY[u.username], 'post', $1::INT
+		FROM post_subscriptions ps
+		INNER JOIN users u ON u.id = ps.user_id
+		INNER JOIN follows f ON f.follower_id = ps.subscriber_id AND f.followee_id = ps.user_id
+		WHERE ps.user_id = (SELECT user_id FROM posts WHERE id = $1)` + returningNotification
+	rows, err := s.db.Query(query, postID)
+	if err != nil {
+		log.Printf("could not insert post notifications: %v\n", err)
+		return
+	}
+
+	if err = s.broadcastNotifications(rows); err != nil {
+		log.Printf("could not broadcast post notifications: %v\n", err)
+	}
+}
@@ -0,0 +1,185 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/djomlaa/socnet/internal/testutil"
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+func TestCreatePostFanout(t *testing.T) {
+	s, db := testutil.NewService(t)
+
+	author := testutil.CreateUser(t, db, "author")
+	follower := testutil.CreateUser(t, db, "follower")
+	stranger := testutil.CreateUser(t, db, "stranger")
+	testutil.Follow(t, db, follower, author)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.FanoutPosts(ctx)
+
+	ti, err := s.CreatePost(testutil.AuthContext(author), service.CreatePostInput{Content: "hello followers"})
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	if ti.UserID != author || ti.PostID == 0 || !ti.Post.Mine {
+		t.Fatalf("unexpected author timeline item: %+v", ti)
+	}
+
+	testutil.Eventually(t, 10*time.Second, func() error {
+		tt, err := s.Timeline(testutil.AuthContext(follower), 0, 0, service.TimelineFilter{})
+		if err != nil {
+			return err
+		}
+
+		if len(tt) != 1 || tt[0].PostID != ti.PostID {
+			return fmt.Errorf("follower timeline has %d items, want post %d", len(tt), ti.PostID)
+		}
+
+		if tt[0].Post.Mine {
+			return errors.New("post is mine in the follower timeline")
+		}
+
+		return nil
+	})
+
+	tt, err := s.Timeline(testutil.AuthContext(author), 0, 0, service.TimelineFilter{})
+	if err != nil {
+		t.Fatalf("could not get author timeline: %v", err)
+	}
+
+	if len(tt) != 1 || tt[0].ID != ti.ID {
+		t.Fatalf("author timeline has %d items, want only item %d", len(tt), ti.ID)
+	}
+
+	tt, err = s.Timeline(testutil.AuthContext(stranger), 0, 0, service.TimelineFilter{})
+	if err != nil {
+		t.Fatalf("could not get stranger timeline: %v", err)
+	}
+
+	if len(tt) != 0 {
+		t.Fatalf("post fanned out to a user not following the author: %+v", tt)
+	}
+}
+
+func TestCreatePostValidation(t *testing.T) {
+	s, db := testutil.NewService(t)
+
+	uid := testutil.CreateUser(t, db, "author")
+
+	_, err := s.CreatePost(context.Background(), service.CreatePostInput{Content: "hello"})
+	if err != service.ErrUnauthenticated {
+		t.Fatalf("got %v, want ErrUnauthenticated", err)
+	}
+
+	_, err = s.CreatePost(testutil.AuthContext(uid), service.CreatePostInput{Content: "   "})
+	var ve validation.Errors
+	if !errors.As(err, &ve) {
+		t.Fatalf("got %v, want validation errors for blank content", err)
+	}
+}
+
+func TestPostsPagination(t *testing.T) {
+	s, db := testutil.NewService(t)
+
+	uid := testutil.CreateUser(t, db, "author")
+	testutil.CreateUser(t, db, "nobody")
+
+	pids := make([]int64, 5)
+	for i := range pids {
+		pids[i] = testutil.CreatePost(t, db, uid, fmt.Sprintf("post %d", i))
+	}
+
+	ctx := context.Background()
+
+	// Pages of two, newest first, down to an empty page past the oldest post.
+	var got []int64
+	var before int64
+	for page := 0; ; page++ {
+		pp, err := s.Posts(ctx, "author", 2, before)
+		if err != nil {
+			t.Fatalf("could not get posts page %d: %v", page, err)
+		}
+
+		if len(pp) > 2 {
+			t.Fatalf("page %d has %d posts, want at most 2", page, len(pp))
+		}
+
+		if len(pp) == 0 {
+			break
+		}
+
+		for _, p := range pp {
+			if p.ID == before {
+				t.Fatalf("page %d repeats its cursor post %d", page, before)
+			}
+			got = append(got, p.ID)
+		}
+
+		before = pp[len(pp)-1].ID
+	}
+
+	if len(got) != len(pids) {
+		t.Fatalf("paged %d posts, want %d", len(got), len(pids))
+	}
+
+	for i, pid := range got {
+		if want := pids[len(pids)-1-i]; pid != want {
+			t.Fatalf("post %d is %d, want %d", i, pid, want)
+		}
+	}
+
+	// Out of range page sizes are clamped, not rejected.
+	pp, err := s.Posts(ctx, "author", -5, 0)
+	if err != nil {
+		t.Fatalf("could not get posts with negative page size: %v", err)
+	}
+
+	if len(pp) != validation.MinPageSize {
+		t.Fatalf("got %d posts, want %d", len(pp), validation.MinPageSize)
+	}
+
+	pp, err = s.Posts(ctx, "author", validation.MaxPageSize+1, 0)
+	if err != nil {
+		t.Fatalf("could not get posts with oversized page size: %v", err)
+	}
+
+	if len(pp) != len(pids) {
+		t.Fatalf("got %d posts, want %d", len(pp), len(pids))
+	}
+
+	// The oldest post as cursor leaves nothing before it.
+	pp, err = s.Posts(ctx, "author", 0, pids[0])
+	if err != nil {
+		t.Fatalf("could not get posts before the oldest: %v", err)
+	}
+
+	if len(pp) != 0 {
+		t.Fatalf("got %d posts before the oldest one", len(pp))
+	}
+
+	pp, err = s.Posts(ctx, "nobody", 0, 0)
+	if err != nil {
+		t.Fatalf("could not get posts of a user without posts: %v", err)
+	}
+
+	if pp == nil || len(pp) != 0 {
+		t.Fatalf("got %v, want an empty non-nil page", pp)
+	}
+
+	var ve validation.Errors
+	if _, err = s.Posts(ctx, "author", 0, -1); !errors.As(err, &ve) {
+		t.Fatalf("got %v, want validation errors for a negative cursor", err)
+	}
+
+	if _, err = s.Posts(ctx, "not a username", 0, 0); !errors.As(err, &ve) {
+		t.Fatalf("got %v, want validation errors for an invalid username", err)
+	}
+}
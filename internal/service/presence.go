@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+	"github.com/lib/pq"
+)
+
+const (
+	// PresenceGracePeriod a user stays online after their last event stream closes,
+	// so reconnecting doesn't flap their presence.
+	PresenceGracePeriod = time.Minute
+	// presenceHeartbeat is how often an open event stream extends its user presence.
+	presenceHeartbeat = PresenceGracePeriod / 2
+	// MaxPresenceUsernames a single presence subscription can watch.
+	MaxPresenceUsernames = 100
+)
+
+// Presence event of a user going online or offline.
+type Presence struct {
+	Username string `json:"username"`
+	Online   bool   `json:"online"`
+}
+
+func presenceTopic(userID int64) string {
+	return "presence:" + strconv.FormatInt(userID, 10)
+}
+
+// TrackPresence keeps the authenticated user online while ctx is not done.
+// It is meant to run for as long as one of their event streams is open.
+func (s *Service) TrackPresence(ctx context.Context) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return
+	}
+
+	s.extendPresence(uid)
+
+	t := time.NewTicker(presenceHeartbeat)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			s.extendPresence(uid)
+		case <-ctx.Done():
+			time.AfterFunc(PresenceGracePeriod, func() {
+				s.expirePresence(uid)
+			})
+			return
+		}
+	}
+}
+
+// extendPresence moves the user online deadline forward,
+// broadcasting the user came online if they weren't.
+func (s *Service) extendPresence(uid int64) {
+	var username string
+	var wasOnline bool
+	query := `UPDATE users SET online_until = now() + $2::INTERVAL
+		FROM (SELECT online_until > now() IS TRUE AS was_online FROM users WHERE id = $1 FOR UPDATE) AS prev
+		WHERE id = $1
+		RETURNING username, prev.was_online`
+	interval := strconv.FormatInt(int64(PresenceGracePeriod/time.Second), 10) + " seconds"
+	if err := s.db.QueryRow(query, uid, interval).Scan(&username, &wasOnline); err != nil {
+		log.Printf("could not extend presence: %v\n", err)
+		return
+	}
+
+	if !wasOnline {
+		s.broadcast(presenceTopic(uid), Presence{Username: username, Online: true})
+	}
+}
+
+// expirePresence broadcasts the user went offline, unless another
+// event stream extended their presence in the meantime.
+func (s *Service) expirePresence(uid int64) {
+	var username string
+	query := "SELECT username FROM users WHERE id = $1 AND online_until <= now()"
+	err := s.db.QueryRow(query, uid).Scan(&username)
+	if err == sql.ErrNoRows {
+		return
+	}
+
+	if err != nil {
+		log.Printf("could not query select expired presence: %v\n", err)
+		return
+	}
+
+	s.broadcast(presenceTopic(uid), Presence{Username: username, Online: false})
+}
+
+// SubscribeToPresence receives presence events of the given users until ctx is done.
+// The current presence of each user is sent first.
+func (s *Service) SubscribeToPresence(ctx context.Context, usernames []string) (<-chan Presence, error) {
+	if _, ok := ctx.Value(KeyAuthUserID).(int64); !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	var v validation.Validator
+	v.Check(len(usernames) != 0, "username", "at least one required")
+	v.Check(len(usernames) <= MaxPresenceUsernames, "username", "too many")
+	for i, username := range usernames {
+		username = validation.NormalizeUsername(username)
+		v.Username("username", username)
+		usernames[i] = strings.ToLower(username)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT id, username, online_until > now() IS TRUE FROM users WHERE lower(username) = ANY($1)"
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(usernames))
+	if err != nil {
+		return nil, fmt.Errorf("could not query select presence: %v", err)
+	}
+
+	defer rows.Close()
+
+	var initial []Presence
+	var topics []string
+	for rows.Next() {
+		var uid int64
+		var p Presence
+		if err = rows.Scan(&uid, &p.Username, &p.Online); err != nil {
+			return nil, fmt.Errorf("could not scan presence: %v", err)
+		}
+
+		initial = append(initial, p)
+		topics = append(topics, presenceTopic(uid))
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate presence rows: %v", err)
+	}
+
+	pp := make(chan Presence)
+	merged := make(chan []byte)
+	for _, topic := range topics {
+		go func(msgs <-chan []byte) {
+			for b := range msgs {
+				select {
+				case merged <- b:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(s.pubsub.Subscribe(ctx, topic))
+	}
+
+	go func() {
+		defer close(pp)
+		for _, p := range initial {
+			select {
+			case pp <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		for {
+			select {
+			case b := <-merged:
+				var p Presence
+				if err := json.Unmarshal(b, &p); err != nil {
+					log.Printf("could not unmarshal presence message: %v\n", err)
+					continue
+				}
+
+				select {
+				case pp <- p:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return pp, nil
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+const (
+	// LastActiveRecently is shown for users seen within the last hour.
+	LastActiveRecently = "recently"
+	// LastActiveToday is shown for users seen within the last day.
+	LastActiveToday = "today"
+)
+
+// Who can see the followers and followees of a user,
+// and the posts they liked.
+const (
+	FollowListsEveryone  = "everyone"
+	FollowListsFollowers = "followers"
+	FollowListsNobody    = "nobody"
+)
+
+// ErrFollowListsHidden used when the user hides their followers and followees
+// from the authenticated user.
+var ErrFollowListsHidden = errors.New("follow lists hidden")
+
+// ErrLikesHidden used when the user hides the posts they liked
+// from the authenticated user.
+var ErrLikesHidden = errors.New("likes hidden")
+
+// PrivacySettings of a user.
+type PrivacySettings struct {
+	// ShowLastActive shows on the profile how recently the user was active.
+	ShowLastActive bool `json:"showLastActive"`
+	// FollowListsVisibility is who besides the user can see their followers,
+	// followees and the counts of both.
+	FollowListsVisibility string `json:"followListsVisibility"`
+	// StripPostLocation drops the location of posts the user publishes.
+	StripPostLocation bool `json:"stripPostLocation"`
+	// LikesVisibility is who besides the user can see the posts they liked.
+	LikesVisibility string `json:"likesVisibility"`
+}
+
+// PrivacySettings of the authenticated user.
+func (s *Service) PrivacySettings(ctx context.Context) (PrivacySettings, error) {
+	var out PrivacySettings
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	query := "SELECT show_last_active, follow_lists_visibility, strip_post_location, likes_visibility FROM users WHERE id = $1"
+	err := s.db.QueryRowContext(ctx, query, uid).Scan(&out.ShowLastActive, &out.FollowListsVisibility, &out.StripPostLocation, &out.LikesVisibility)
+	if err == sql.ErrNoRows {
+		return out, ErrUserNotFound
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not query select privacy settings: %v", err)
+	}
+
+	return out, nil
+}
+
+// UpdatePrivacySettings of the authenticated user.
+func (s *Service) UpdatePrivacySettings(ctx context.Context, in PrivacySettings) (PrivacySettings, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return in, ErrUnauthenticated
+	}
+
+	var v validation.Validator
+	v.Check(validVisibility(in.FollowListsVisibility), "followListsVisibility", "must be everyone, followers or nobody")
+	v.Check(validVisibility(in.LikesVisibility), "likesVisibility", "must be everyone, followers or nobody")
+	if err := v.Err(); err != nil {
+		return in, err
+	}
+
+	var username string
+	query := `UPDATE users SET show_last_active = $1, follow_lists_visibility = $2, strip_post_location = $3, likes_visibility = $4
+		WHERE id = $5 RETURNING username`
+	row := s.db.QueryRowContext(ctx, query, in.ShowLastActive, in.FollowListsVisibility, in.StripPostLocation, in.LikesVisibility, uid)
+	if err := row.Scan(&username); err != nil {
+		return in, fmt.Errorf("could not update privacy settings: %v", err)
+	}
+
+	s.purge(profilePaths(username)...)
+
+	return in, nil
+}
+
+func validVisibility(visibility string) bool {
+	return visibility == FollowListsEveryone || visibility == FollowListsFollowers || visibility == FollowListsNobody
+}
+
+// checkFollowListsVisible returns ErrFollowListsHidden when the given user
+// hides their followers and followees from the authenticated user.
+func (s *Service) checkFollowListsVisible(ctx context.Context, username string) error {
+	uid, auth := ctx.Value(KeyAuthUserID).(int64)
+	query, args, err := buildQuery(`
+		SELECT {{template "followListsVisible" .}}
+		FROM users
+		WHERE lower(username) = lower(@username)`, map[string]interface{}{
+		"auth":     auth,
+		"uid":      uid,
+		"username": username,
+	})
+	if err != nil {
+		return fmt.Errorf("could not build follow lists visibility sql query: %v", err)
+	}
+
+	var visible bool
+	err = s.db.QueryRowContext(ctx, query, args...).Scan(&visible)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not query select follow lists visibility: %v", err)
+	}
+
+	if !visible {
+		return ErrFollowListsHidden
+	}
+
+	return nil
+}
+
+// checkLikesVisible returns ErrLikesHidden when the given user
+// hides the posts they liked from the authenticated user.
+func (s *Service) checkLikesVisible(ctx context.Context, username string) error {
+	uid, auth := ctx.Value(KeyAuthUserID).(int64)
+	query, args, err := buildQuery(`
+		SELECT {{template "likesVisible" .}}
+		FROM users
+		WHERE lower(username) = lower(@username)`, map[string]interface{}{
+		"auth":     auth,
+		"uid":      uid,
+		"username": username,
+	})
+	if err != nil {
+		return fmt.Errorf("could not build likes visibility sql query: %v", err)
+	}
+
+	var visible bool
+	err = s.db.QueryRowContext(ctx, query, args...).Scan(&visible)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not query select likes visibility: %v", err)
+	}
+
+	if !visible {
+		return ErrLikesHidden
+	}
+
+	return nil
+}
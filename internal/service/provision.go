@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// MaxProvisionUsers accepted in a single provisioning request.
+const MaxProvisionUsers = 500
+
+// Provisioning outcomes of a user.
+const (
+	ProvisionCreated   = "created"
+	ProvisionUpdated   = "updated"
+	ProvisionUnchanged = "unchanged"
+	ProvisionFailed    = "failed"
+)
+
+// ProvisionUser is the desired state of a user in an external identity system,
+// keyed by email. Nil fields are left as they are.
+type ProvisionUser struct {
+	Email    string  `json:"email"`
+	Username *string `json:"username"`
+	Role     *string `json:"role"`
+	// Active false deactivates the user: they can't log in and their sessions are revoked.
+	Active *bool `json:"active"`
+}
+
+// ProvisionResult of a single user.
+type ProvisionResult struct {
+	Email  string  `json:"email"`
+	Status string  `json:"status"`
+	Error  *string `json:"error"`
+}
+
+// ProvisionUsers creates, updates and deactivates users in bulk so they match
+// an external identity system. Each user is upserted by email in its own tx,
+// so running the same request again changes nothing, and a failure only affects
+// its user. Every change is recorded in the audit log. Admin only.
+func (s *Service) ProvisionUsers(ctx context.Context, users []ProvisionUser) ([]ProvisionResult, error) {
+	adminID, err := s.authAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var v validation.Validator
+	v.Check(len(users) != 0, "users", "cannot be empty")
+	v.Check(len(users) <= MaxProvisionUsers, "users", "too many users")
+	if err = v.Err(); err != nil {
+		return nil, err
+	}
+
+	rr := make([]ProvisionResult, 0, len(users))
+	for _, u := range users {
+		r := ProvisionResult{Email: strings.TrimSpace(u.Email)}
+		r.Status, err = s.provisionUser(ctx, adminID, u)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			r.Status = ProvisionFailed
+			msg := err.Error()
+			if _, ok := err.(validation.Errors); !ok && err != ErrUsernameTaken && err != ErrEmailTaken && err != ErrForbidden {
+				log.Printf("could not provision user %q: %v\n", r.Email, err)
+				msg = "internal error"
+			}
+			r.Error = &msg
+		}
+
+		rr = append(rr, r)
+	}
+
+	return rr, nil
+}
+
+func (s *Service) provisionUser(ctx context.Context, adminID int64, in ProvisionUser) (string, error) {
+	in.Email = strings.TrimSpace(in.Email)
+	var v validation.Validator
+	v.Email("email", in.Email)
+	if in.Username != nil {
+		username := validation.NormalizeUsername(*in.Username)
+		in.Username = &username
+		v.Username("username", username)
+	}
+	if in.Role != nil {
+		v.Check(validRole(*in.Role), "role", "invalid role")
+	}
+	if err := v.Err(); err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	var uid int64
+	var username, role string
+	var active bool
+	query := "SELECT id, username, role, deactivated_at IS NULL FROM users WHERE email = $1 FOR UPDATE"
+	err = tx.QueryRowContext(ctx, query, in.Email).Scan(&uid, &username, &role, &active)
+	if err == sql.ErrNoRows {
+		return s.provisionNewUser(ctx, tx, adminID, in)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not query select user: %v", err)
+	}
+
+	changes := map[string]interface{}{}
+	if in.Username != nil && *in.Username != username {
+		query = "UPDATE users SET username = $1, username_skeleton = $2 WHERE id = $3"
+		_, err = tx.ExecContext(ctx, query, *in.Username, validation.UsernameSkeleton(*in.Username), uid)
+		if isUniqueViolation(err) {
+			return "", ErrUsernameTaken
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("could not update username: %v", err)
+		}
+
+		changes["username"] = *in.Username
+	}
+
+	if in.Role != nil && *in.Role != role {
+		if uid == adminID {
+			return "", ErrForbidden
+		}
+
+		if _, err = tx.ExecContext(ctx, "UPDATE users SET role = $1 WHERE id = $2", *in.Role, uid); err != nil {
+			return "", fmt.Errorf("could not update role: %v", err)
+		}
+
+		changes["role"] = *in.Role
+	}
+
+	if in.Active != nil && *in.Active != active {
+		if uid == adminID {
+			return "", ErrForbidden
+		}
+
+		if err = setUserActive(ctx, tx, uid, *in.Active); err != nil {
+			return "", err
+		}
+
+		changes["active"] = *in.Active
+	}
+
+	if len(changes) == 0 {
+		return ProvisionUnchanged, nil
+	}
+
+	changes["email"] = in.Email
+	if err = s.audit(ctx, tx, adminID, AuditActionProvision, uid, changes); err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("could not commit user provisioning: %v", err)
+	}
+
+	if _, ok := changes["username"]; ok {
+		s.purge(append(profilePaths(username), profilePaths(*in.Username)...)...)
+	}
+
+	return ProvisionUpdated, nil
+}
+
+// provisionNewUser creates the user, unless they should be inactive,
+// which they already are by not existing.
+func (s *Service) provisionNewUser(ctx context.Context, tx *sql.Tx, adminID int64, in ProvisionUser) (string, error) {
+	if in.Active != nil && !*in.Active {
+		return ProvisionUnchanged, nil
+	}
+
+	var v validation.Validator
+	v.Check(in.Username != nil, "username", "required to create the user")
+	if err := v.Err(); err != nil {
+		return "", err
+	}
+
+	role := RoleUser
+	if in.Role != nil {
+		role = *in.Role
+	}
+
+	var uid int64
+	query := "INSERT INTO users (email, username, username_skeleton, role) VALUES ($1, $2, $3, $4) RETURNING id"
+	err := tx.QueryRowContext(ctx, query, in.Email, *in.Username, validation.UsernameSkeleton(*in.Username), role).Scan(&uid)
+	if isUniqueViolation(err) && strings.Contains(err.Error(), "email") {
+		return "", ErrEmailTaken
+	}
+
+	if isUniqueViolation(err) {
+		return "", ErrUsernameTaken
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not insert user: %v", err)
+	}
+
+	details := map[string]interface{}{"email": in.Email, "username": *in.Username, "role": role, "active": true}
+	if err = s.audit(ctx, tx, adminID, AuditActionProvision, uid, details); err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("could not commit user provisioning: %v", err)
+	}
+
+	return ProvisionCreated, nil
+}
+
+// setUserActive deactivates the user and revokes their sessions, or reactivates them.
+func setUserActive(ctx context.Context, tx execer, uid int64, active bool) error {
+	if active {
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET deactivated_at = NULL WHERE id = $1", uid); err != nil {
+			return fmt.Errorf("could not reactivate user: %v", err)
+		}
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET deactivated_at = now() WHERE id = $1", uid); err != nil {
+		return fmt.Errorf("could not deactivate user: %v", err)
+	}
+
+	query := "UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL"
+	if _, err := tx.ExecContext(ctx, query, uid); err != nil {
+		return fmt.Errorf("could not revoke sessions: %v", err)
+	}
+
+	return nil
+}
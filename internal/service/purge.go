@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+)
+
+// purgeTimeout bounds purging a batch of URLs from the CDN.
+const purgeTimeout = 30 * time.Second
+
+// purge drops the given paths of the origin from the CDN in the background,
+// so their cached responses don't outlive a change. Without a purger there is
+// no CDN to purge.
+func (s *Service) purge(paths ...string) {
+	if s.purger == nil || len(paths) == 0 {
+		return
+	}
+
+	urls := make([]string, len(paths))
+	for i, p := range paths {
+		urls[i] = s.origin + p
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), purgeTimeout)
+		defer cancel()
+
+		if err := s.purger.Purge(ctx, urls); err != nil {
+			log.Printf("could not purge cdn: %v\n", err)
+		}
+	}()
+}
+
+// profilePaths are the public URLs showing the profile of a user.
+func profilePaths(username string) []string {
+	return []string{
+		"/api/users/" + username,
+		"/api/users/" + username + "/posts",
+		"/api/users/" + username + "/media",
+	}
+}
+
+// postPaths are the public URLs showing a post.
+func postPaths(postID int64) []string {
+	id := strconv.FormatInt(postID, 10)
+	return []string{
+		"/api/posts/" + id,
+		"/api/posts/" + id + "/thread",
+	}
+}
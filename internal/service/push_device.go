@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/push"
+	"github.com/djomlaa/socnet/internal/validation"
+	"github.com/lib/pq"
+)
+
+// maxPushTokenLength covers the FCM and APNs token sizes.
+const maxPushTokenLength = 4096
+
+// ErrPushDeviceNotFound denotes a push device that was not found
+var ErrPushDeviceNotFound = errors.New("push device not found")
+
+// notificationTexts are the push texts of each notification type, after the actors.
+var notificationTexts = map[string]string{
+	"follow":  "followed you",
+	"like":    "liked your post",
+	"keyword": "posted a word you follow",
+	"post":    "published a new post",
+}
+
+// PushDevice is a mobile device receiving the notifications of its user.
+type PushDevice struct {
+	ID       int64  `json:"id"`
+	Platform string `json:"platform"`
+	// Enabled turns off every push to the device when false.
+	Enabled bool `json:"enabled"`
+	// MutedTypes are the notification types not pushed to the device.
+	MutedTypes []string  `json:"mutedTypes"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// UpdatePushDeviceInput request. Nil fields are left unchanged.
+type UpdatePushDeviceInput struct {
+	Enabled    *bool
+	MutedTypes *[]string
+}
+
+// RegisterPushDevice registers a device token of the authenticated user.
+// Registering a known token moves it to the authenticated user.
+func (s *Service) RegisterPushDevice(ctx context.Context, platform, token string) (PushDevice, error) {
+	var d PushDevice
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return d, ErrUnauthenticated
+	}
+
+	token = strings.TrimSpace(token)
+	var v validation.Validator
+	v.Check(platform == push.PlatformAndroid || platform == push.PlatformIOS, "platform", "must be android or ios")
+	v.Content("token", token, maxPushTokenLength)
+	if err := v.Err(); err != nil {
+		return d, err
+	}
+
+	query := `INSERT INTO push_devices (user_id, platform, token) VALUES ($1, $2, $3)
+		ON CONFLICT (token) DO UPDATE SET user_id = EXCLUDED.user_id, platform = EXCLUDED.platform
+		RETURNING id, enabled, muted_types, created_at`
+	err := s.db.QueryRowContext(ctx, query, uid, platform, token).Scan(&d.ID, &d.Enabled, (*pq.StringArray)(&d.MutedTypes), &d.CreatedAt)
+	if err != nil {
+		return d, fmt.Errorf("could not upsert push device: %v", err)
+	}
+
+	d.Platform = platform
+	return d, nil
+}
+
+// PushDevices of the authenticated user.
+func (s *Service) PushDevices(ctx context.Context) ([]PushDevice, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	query := "SELECT id, platform, enabled, muted_types, created_at FROM push_devices WHERE user_id = $1 ORDER BY id"
+	rows, err := s.db.QueryContext(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select push devices: %v", err)
+	}
+
+	defer rows.Close()
+
+	dd := []PushDevice{}
+	for rows.Next() {
+		var d PushDevice
+		if err = rows.Scan(&d.ID, &d.Platform, &d.Enabled, (*pq.StringArray)(&d.MutedTypes), &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan push device: %v", err)
+		}
+
+		dd = append(dd, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate push device rows: %v", err)
+	}
+
+	return dd, nil
+}
+
+// UpdatePushDevice settings of a device of the authenticated user.
+func (s *Service) UpdatePushDevice(ctx context.Context, deviceID int64, in UpdatePushDeviceInput) (PushDevice, error) {
+	var d PushDevice
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return d, ErrUnauthenticated
+	}
+
+	var mutedTypes interface{}
+	if in.MutedTypes != nil {
+		var v validation.Validator
+		for _, t := range *in.MutedTypes {
+			_, known := notificationTexts[t]
+			v.Check(known, "mutedTypes", "unknown notification type "+strconv.Quote(t))
+		}
+		if err := v.Err(); err != nil {
+			return d, err
+		}
+
+		mutedTypes = pq.Array(*in.MutedTypes)
+	}
+
+	query := `UPDATE push_devices SET
+			enabled = COALESCE($3, enabled),
+			muted_types = COALESCE($4, muted_types)
+		WHERE id = $1 AND user_id = $2
+		RETURNING platform, enabled, muted_types, created_at`
+	err := s.db.QueryRowContext(ctx, query, deviceID, uid, in.Enabled, mutedTypes).
+		Scan(&d.Platform, &d.Enabled, (*pq.StringArray)(&d.MutedTypes), &d.CreatedAt)
+	if err == sql.ErrNoRows {
+		return d, ErrPushDeviceNotFound
+	}
+
+	if err != nil {
+		return d, fmt.Errorf("could not update push device: %v", err)
+	}
+
+	d.ID = deviceID
+	return d, nil
+}
+
+// DeletePushDevice of the authenticated user, usually on logout.
+func (s *Service) DeletePushDevice(ctx context.Context, deviceID int64) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM push_devices WHERE id = $1 AND user_id = $2", deviceID, uid)
+	if err != nil {
+		return fmt.Errorf("could not delete push device: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPushDeviceNotFound
+	}
+
+	return nil
+}
+
+// pushNotification sends the notification to the devices of its user that
+// didn't mute its type. Devices whose token the provider rejects are deleted.
+func (s *Service) pushNotification(n Notification) {
+	if s.push == nil {
+		return
+	}
+
+	ctx := context.Background()
+	query := `SELECT id, platform, token FROM push_devices
+		WHERE user_id = $1 AND enabled AND NOT ($2 = ANY(muted_types))`
+	rows, err := s.db.QueryContext(ctx, query, n.UserID, n.Type)
+	if err != nil {
+		log.Printf("could not query select push devices: %v\n", err)
+		return
+	}
+
+	type device struct {
+		id              int64
+		platform, token string
+	}
+	var dd []device
+	for rows.Next() {
+		var d device
+		if err = rows.Scan(&d.id, &d.platform, &d.token); err != nil {
+			rows.Close()
+			log.Printf("could not scan push device: %v\n", err)
+			return
+		}
+
+		dd = append(dd, d)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		log.Printf("could not iterate push device rows: %v\n", err)
+		return
+	}
+
+	m := push.Message{
+		Title: "socnet",
+		Body:  strings.Join(n.Actors, ", ") + " " + notificationTexts[n.Type],
+		Data: map[string]string{
+			"notificationId": strconv.FormatInt(n.ID, 10),
+			"type":           n.Type,
+		},
+	}
+	if n.PostID != nil {
+		m.Data["postId"] = strconv.FormatInt(*n.PostID, 10)
+	}
+
+	for _, d := range dd {
+		err = s.push.Send(ctx, d.platform, d.token, m)
+		if err == push.ErrInvalidToken {
+			if _, err = s.db.ExecContext(ctx, "DELETE FROM push_devices WHERE id = $1", d.id); err != nil {
+				log.Printf("could not delete invalid push device: %v\n", err)
+			}
+			continue
+		}
+
+		if err != nil {
+			log.Printf("could not push notification: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Reputation weights. Each event counts less as it ages, halving every
+// ReputationHalfLife.
+const (
+	ReputationHalfLife = time.Hour * 24 * 30
+	reputationLike     = 1
+	reputationFollower = 3
+	reputationReview   = -20
+)
+
+// Accounts with a reputation below LowReputation can publish at most
+// LowReputationPostsPerHour posts an hour, unless Settings say otherwise.
+const (
+	LowReputation             = -10
+	LowReputationPostsPerHour = 5
+)
+
+// ErrRateLimited used when the user did too much of something too fast.
+var ErrRateLimited = errors.New("rate limited")
+
+// UpdateReputations recomputes the reputation of every user from the likes
+// their posts received, the followers they gained and their posts queued for
+// moderator review, and returns how many changed. It is meant to run periodically.
+func (s *Service) UpdateReputations(ctx context.Context) (int64, error) {
+	query := `
+		WITH events AS (
+			SELECT p.user_id, $1::FLOAT AS weight, pl.created_at
+			FROM post_likes pl
+			INNER JOIN posts p ON pl.post_id = p.id
+			WHERE pl.user_id <> p.user_id
+			UNION ALL
+			SELECT followee_id, $2::FLOAT, created_at FROM follows
+			UNION ALL
+			SELECT p.user_id, $3::FLOAT, r.created_at
+			FROM post_reviews r
+			INNER JOIN posts p ON r.post_id = p.id
+		), scores AS (
+			SELECT users.id, COALESCE(round(sum(
+				events.weight * power(0.5, extract(epoch FROM now() - events.created_at) / $4::FLOAT)
+			)), 0)::INT AS reputation
+			FROM users
+			LEFT JOIN events ON events.user_id = users.id
+			GROUP BY users.id
+		)
+		UPDATE users SET reputation = scores.reputation
+		FROM scores
+		WHERE users.id = scores.id AND users.reputation <> scores.reputation`
+	res, err := s.db.ExecContext(ctx, query, reputationLike, reputationFollower, reputationReview, ReputationHalfLife.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("could not update reputations: %v", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// checkPostRate returns ErrRateLimited when a low reputation user
+// already published LowReputationPostsPerHour posts within the last hour.
+func (s *Service) checkPostRate(ctx context.Context, uid int64) error {
+	settings := s.Settings()
+	var limited bool
+	query := `SELECT reputation < $2 AND (
+			SELECT count(*) FROM posts WHERE user_id = $1 AND created_at > now() - INTERVAL '1 hour'
+		) >= $3
+		FROM users WHERE id = $1`
+	if err := s.db.QueryRowContext(ctx, query, uid, settings.LowReputation, settings.LowReputationPostsPerHour).Scan(&limited); err != nil {
+		return fmt.Errorf("could not query select post rate: %v", err)
+	}
+
+	if limited {
+		return ErrRateLimited
+	}
+
+	return nil
+}
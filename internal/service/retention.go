@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// RetentionWeeks after the signup week the activity of a cohort is followed for.
+	RetentionWeeks = 12
+	// MaxRetentionCohorts readable at once.
+	MaxRetentionCohorts = 52
+)
+
+// RetentionCohort is the users who signed up on a week, starting on Monday in UTC.
+type RetentionCohort struct {
+	Cohort string          `json:"cohort"`
+	Size   int             `json:"size"`
+	Weeks  []RetentionWeek `json:"weeks"`
+}
+
+// RetentionWeek is how many users of the cohort were active on the given week
+// after their signup one, which is week 0.
+type RetentionWeek struct {
+	Week        int     `json:"week"`
+	ActiveUsers int     `json:"activeUsers"`
+	Retention   float64 `json:"retention"`
+}
+
+// ComputeRetention adds the activity of each signup cohort on the weeks ended
+// since its last run to the cohort_retention table, from the daily activity
+// flags. The first run only computes last week, and weeks older than the flags
+// retention are skipped. Users who signed up before signup times were recorded
+// are in no cohort. It is meant to run weekly, or daily as it is idempotent.
+func (s *Service) ComputeRetention(ctx context.Context) (int, error) {
+	query := `WITH today AS (SELECT (now() AT TIME ZONE 'UTC')::date AS day),
+		weeks AS (
+			SELECT generate_series(
+				GREATEST(
+					COALESCE((SELECT max(cohort + week * 7) + 7 FROM cohort_retention), date_trunc('week', today.day)::date - 7),
+					date_trunc('week', today.day - $1::int + 6)::date
+				),
+				date_trunc('week', today.day)::date - 7,
+				INTERVAL '7 days'
+			)::date AS start
+			FROM today
+		),
+		cohorts AS (
+			SELECT id, date_trunc('week', created_at AT TIME ZONE 'UTC')::date AS cohort
+			FROM users
+			WHERE created_at IS NOT NULL
+		)
+		INSERT INTO cohort_retention (cohort, week, cohort_size, active_users)
+		SELECT c.cohort, (w.start - c.cohort) / 7, count(*), count(*) FILTER (WHERE EXISTS (
+			SELECT 1 FROM user_activity a
+			WHERE a.user_id = c.id AND a.day >= w.start AND a.day < w.start + 7
+		))
+		FROM weeks w
+		INNER JOIN cohorts c ON c.cohort <= w.start AND c.cohort >= w.start - $2::int * 7
+		GROUP BY c.cohort, w.start
+		ON CONFLICT (cohort, week) DO NOTHING`
+	res, err := s.db.ExecContext(ctx, query, UserActivityRetentionDays, RetentionWeeks)
+	if err != nil {
+		return 0, fmt.Errorf("could not insert cohort retention: %v", err)
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// Retention curves of the last given signup cohorts, newest first. Admin only.
+func (s *Service) Retention(ctx context.Context, cohorts int) ([]RetentionCohort, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if cohorts <= 0 {
+		cohorts = RetentionWeeks
+	} else if cohorts > MaxRetentionCohorts {
+		cohorts = MaxRetentionCohorts
+	}
+
+	query := `SELECT to_char(cohort, 'YYYY-MM-DD'), week, cohort_size, active_users
+		FROM cohort_retention
+		WHERE cohort IN (SELECT DISTINCT cohort FROM cohort_retention ORDER BY cohort DESC LIMIT $1)
+		ORDER BY cohort DESC, week`
+	rows, err := s.db.QueryContext(ctx, query, cohorts)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select cohort retention: %v", err)
+	}
+
+	defer rows.Close()
+
+	cc := []RetentionCohort{}
+	for rows.Next() {
+		var cohort string
+		var size int
+		var w RetentionWeek
+		if err = rows.Scan(&cohort, &w.Week, &size, &w.ActiveUsers); err != nil {
+			return nil, fmt.Errorf("could not scan cohort retention: %v", err)
+		}
+
+		if size != 0 {
+			w.Retention = float64(w.ActiveUsers) / float64(size)
+		}
+
+		if len(cc) == 0 || cc[len(cc)-1].Cohort != cohort {
+			cc = append(cc, RetentionCohort{Cohort: cohort})
+		}
+
+		// Users deleted since shrink the later weeks, so the latest size is kept.
+		c := &cc[len(cc)-1]
+		c.Size = size
+		c.Weeks = append(c.Weeks, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate cohort retention rows: %v", err)
+	}
+
+	return cc, nil
+}
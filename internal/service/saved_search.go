@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// Saved search kinds.
+const (
+	SavedSearchUsers = "users"
+	SavedSearchPosts = "posts"
+)
+
+var (
+	// ErrSavedSearchNotFound denotes a saved search that was not found
+	ErrSavedSearchNotFound = errors.New("saved search not found")
+	// ErrSavedSearchNameTaken used when the user already has a saved search with the name
+	ErrSavedSearchNameTaken = errors.New("saved search name is taken")
+)
+
+// SavedSearch model
+type SavedSearch struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Query     string    `json:"query"`
+	CreatedAt time.Time `json:"createdAt"`
+	// NewResults since the search was last run. Only set when requested.
+	NewResults *int `json:"newResults,omitempty"`
+}
+
+// SavedSearchResults of running a saved search. Only the field of its kind is set.
+type SavedSearchResults struct {
+	Users []UserProfile `json:"users,omitempty"`
+	Posts []Post        `json:"posts,omitempty"`
+}
+
+// CreateSavedSearch of users or posts for the authenticated user.
+func (s *Service) CreateSavedSearch(ctx context.Context, name, kind, query string) (SavedSearch, error) {
+	var ss SavedSearch
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ss, ErrUnauthenticated
+	}
+
+	name = strings.TrimSpace(name)
+	query = strings.TrimSpace(query)
+	var v validation.Validator
+	v.Content("name", name, validation.MaxNameLength)
+	v.Check(kind == SavedSearchUsers || kind == SavedSearchPosts, "kind", "must be users or posts")
+	v.Content("query", query, validation.MaxNameLength)
+	if err := v.Err(); err != nil {
+		return ss, err
+	}
+
+	q := "INSERT INTO saved_searches (user_id, name, kind, query) VALUES ($1, $2, $3, $4) RETURNING id, created_at"
+	err := s.db.QueryRowContext(ctx, q, uid, name, kind, query).Scan(&ss.ID, &ss.CreatedAt)
+	if isUniqueViolation(err) {
+		return ss, ErrSavedSearchNameTaken
+	}
+
+	if err != nil {
+		return ss, fmt.Errorf("could not insert saved search: %v", err)
+	}
+
+	ss.Name = name
+	ss.Kind = kind
+	ss.Query = query
+	return ss, nil
+}
+
+// SavedSearches of the authenticated user,
+// optionally with how many new results each one has since it was last run.
+func (s *Service) SavedSearches(ctx context.Context, counts bool) ([]SavedSearch, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	query, args, err := buildQuery(`
+		SELECT s.id, s.name, s.kind, s.query, s.created_at
+		{{if .counts}}
+		, CASE WHEN s.kind = 'posts'
+			THEN (SELECT count(*) FROM posts p WHERE p.id > s.last_seen_id AND NOT p.archived AND p.content ILIKE '%' || s.query || '%')
+			ELSE (SELECT count(*) FROM users u WHERE u.id > s.last_seen_id AND u.username ILIKE '%' || s.query || '%')
+		END AS new_results
+		{{end}}
+		FROM saved_searches s
+		WHERE s.user_id = @uid
+		ORDER BY s.name`, map[string]interface{}{
+		"uid":    uid,
+		"counts": counts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build saved searches sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select saved searches: %v", err)
+	}
+
+	defer rows.Close()
+
+	ss := []SavedSearch{}
+	for rows.Next() {
+		var saved SavedSearch
+		dest := []interface{}{&saved.ID, &saved.Name, &saved.Kind, &saved.Query, &saved.CreatedAt}
+		if counts {
+			dest = append(dest, &saved.NewResults)
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan saved search: %v", err)
+		}
+
+		ss = append(ss, saved)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate saved search rows: %v", err)
+	}
+
+	return ss, nil
+}
+
+// RunSavedSearch returns the first page of results of a saved search
+// and resets its new results count.
+func (s *Service) RunSavedSearch(ctx context.Context, searchID int64) (SavedSearchResults, error) {
+	var out SavedSearchResults
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	var kind, search string
+	query := "SELECT kind, query FROM saved_searches WHERE id = $1 AND user_id = $2"
+	err := s.db.QueryRowContext(ctx, query, searchID, uid).Scan(&kind, &search)
+	if err == sql.ErrNoRows {
+		return out, ErrSavedSearchNotFound
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not query select saved search: %v", err)
+	}
+
+	if kind == SavedSearchPosts {
+		out.Posts, err = s.SearchPosts(ctx, search, 0, 0)
+		query = "UPDATE saved_searches SET last_seen_id = (SELECT COALESCE(max(id), 0) FROM posts) WHERE id = $1"
+	} else {
+		out.Users, err = s.Users(ctx, search, 0, "")
+		query = "UPDATE saved_searches SET last_seen_id = (SELECT COALESCE(max(id), 0) FROM users) WHERE id = $1"
+	}
+
+	if err != nil {
+		return out, err
+	}
+
+	if _, err = s.db.ExecContext(ctx, query, searchID); err != nil {
+		return out, fmt.Errorf("could not update saved search last seen id: %v", err)
+	}
+
+	return out, nil
+}
+
+// DeleteSavedSearch of the authenticated user.
+func (s *Service) DeleteSavedSearch(ctx context.Context, searchID int64) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	query := "DELETE FROM saved_searches WHERE id = $1 AND user_id = $2"
+	res, err := s.db.ExecContext(ctx, query, searchID, uid)
+	if err != nil {
+		return fmt.Errorf("could not delete saved search: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSavedSearchNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// ErrInfectedUpload used when the malware scanner flags an upload.
+var ErrInfectedUpload = errors.New("upload rejected as malware")
+
+// scanUpload checks what r reads for malware before it is processed, spooling it
+// to a temporary file so it can be read again. Infected uploads are recorded in the
+// audit log and rejected with ErrInfectedUpload. The returned reader must be read
+// instead of r, and done called once finished with it.
+// Without a scanner r is returned as is.
+func (s *Service) scanUpload(ctx context.Context, uid int64, r io.Reader, kind string) (io.Reader, func(), error) {
+	if s.scanner == nil {
+		return r, func() {}, nil
+	}
+
+	f, err := os.CreateTemp("", "socnet-upload-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create upload temp file: %v", err)
+	}
+
+	done := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+
+	if _, err = io.Copy(f, r); err != nil {
+		done()
+		return nil, nil, fmt.Errorf("could not spool upload: %v", err)
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		done()
+		return nil, nil, fmt.Errorf("could not rewind upload: %v", err)
+	}
+
+	res, err := s.scanner.Scan(ctx, f)
+	if err != nil {
+		done()
+		return nil, nil, fmt.Errorf("could not scan upload: %v", err)
+	}
+
+	if res.Infected {
+		done()
+		log.Printf("rejected infected %s upload of user %d: %s\n", kind, uid, res.Signature)
+		details := map[string]interface{}{"kind": kind, "signature": res.Signature}
+		if err = s.audit(ctx, s.db, uid, AuditActionInfectedUpload, uid, details); err != nil {
+			log.Println(err)
+		}
+
+		return nil, nil, ErrInfectedUpload
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		done()
+		return nil, nil, fmt.Errorf("could not rewind upload: %v", err)
+	}
+
+	return f, done, nil
+}
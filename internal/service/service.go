@@ -2,18 +2,126 @@ package service
 
 import (
 	"database/sql"
+
+	"github.com/djomlaa/socnet/internal/mailer"
+	"github.com/djomlaa/socnet/internal/pubsub"
+	"github.com/djomlaa/socnet/internal/purge"
+	"github.com/djomlaa/socnet/internal/push"
+	"github.com/djomlaa/socnet/internal/s3"
+	"github.com/djomlaa/socnet/internal/scan"
+	"github.com/djomlaa/socnet/internal/sqs"
+	"github.com/djomlaa/socnet/internal/sso"
+	"github.com/djomlaa/socnet/internal/translate"
 	"github.com/hako/branca"
 )
 
 // Service contains the core logic
 // Can be used to back Rest, GraphQL or RPC API
 type Service struct {
-	db     *sql.DB
-	codec  *branca.Branca
-	origin string
+	db         *sql.DB
+	codec      *branca.Branca
+	origin     string
+	translator translate.Translator
+	pubsub     pubsub.PubSub
+	mailer     mailer.Sender
+	push       push.Sender
+	scanner    scan.Scanner
+	objects    *s3.Client
+	purger     purge.Purger
+	ldap       *sso.LDAP
+	oidc       *sso.OIDC
+	ssoRoles   map[string]string
+	likes      chan likeEvent
+
+	fanout         Fanout
+	fanoutStrategy string
+	fanoutMetrics  fanoutMetrics
+	events         eventBus
+
+	mailWebhookSecret string
+	maintenance       maintenanceMode
+	settings          runtimeSettings
+	apiKeyRates       apiKeyRates
+}
+
+// Config to create a Service.
+type Config struct {
+	DB     *sql.DB
+	Codec  *branca.Branca
+	Origin string
+	// Translator is optional. Post translation is unavailable without one.
+	Translator translate.Translator
+	// PubSub delivers the timeline items and notifications to their subscribers.
+	// Defaults to one that only reaches subscribers of this process.
+	PubSub pubsub.PubSub
+	// Mailer sends the emails, usually through a mailer.Queue.
+	// Defaults to logging them.
+	Mailer mailer.Sender
+	// Push is optional. Notifications are not pushed to mobile devices without one.
+	Push push.Sender
+	// Scanner is optional. Uploads are not checked for malware without one.
+	Scanner scan.Scanner
+	// Objects is optional. Media can't be uploaded straight to object storage without it.
+	Objects *s3.Client
+	// Purger is optional. Without one, public responses cached by a CDN
+	// are left to expire on their own.
+	Purger purge.Purger
+	// Fanout is the strategy delivering new posts to timelines, one of FanoutSync,
+	// FanoutQueue, FanoutOutbox or FanoutSQS. Defaults to FanoutQueue.
+	Fanout string
+	// FanoutQueue is required by FanoutSQS.
+	FanoutQueue *sqs.Client
+	// MailWebhookSecret authenticates the bounce and complaint webhooks of the mail provider.
+	MailWebhookSecret string
+	// LDAP and OIDC are optional. With either, users log in with the enterprise
+	// identity provider only, and are created on their first login.
+	LDAP *sso.LDAP
+	OIDC *sso.OIDC
+	// SSORoles maps the groups of the identity provider to roles. When set,
+	// the role of users logging in with the provider follows their groups.
+	SSORoles map[string]string
+	// SettingsFile is optional. It holds the Settings to change without a restart,
+	// and is only read by LoadSettings.
+	SettingsFile string
 }
 
 // New Service implementation
-func New(db *sql.DB, codec *branca.Branca, origin string) *Service {
-	return &Service{db: db, codec: codec, origin: origin}
+func New(cfg Config) *Service {
+	if cfg.PubSub == nil {
+		cfg.PubSub = pubsub.NewLocal()
+	}
+
+	if cfg.Mailer == nil {
+		cfg.Mailer = &mailer.Log{}
+	}
+
+	if cfg.Fanout == "" {
+		cfg.Fanout = FanoutQueue
+	}
+
+	s := &Service{
+		db:         cfg.DB,
+		codec:      cfg.Codec,
+		origin:     cfg.Origin,
+		translator: cfg.Translator,
+		pubsub:     cfg.PubSub,
+		mailer:     cfg.Mailer,
+		push:       cfg.Push,
+		scanner:    cfg.Scanner,
+		objects:    cfg.Objects,
+		purger:     cfg.Purger,
+		ldap:       cfg.LDAP,
+		oidc:       cfg.OIDC,
+		ssoRoles:   cfg.SSORoles,
+		likes:      make(chan likeEvent, likesQueueSize),
+
+		mailWebhookSecret: cfg.MailWebhookSecret,
+		fanoutStrategy:    cfg.Fanout,
+	}
+	s.settings.file = cfg.SettingsFile
+	s.settings.settings = DefaultSettings()
+	s.fanout = s.newFanout(cfg.Fanout, cfg.FanoutQueue)
+	s.subscribeEvents()
+
+	return s
 }
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSessionNotFound denotes a session that was not found
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is a login of the authenticated user on some device.
+type Session struct {
+	ID         int64     `json:"id"`
+	UserAgent  *string   `json:"userAgent"`
+	IP         *string   `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	// Current is true for the session the request was made with.
+	Current bool `json:"current"`
+}
+
+// Sessions of the authenticated user that were not revoked, most recently used first.
+func (s *Service) Sessions(ctx context.Context) ([]Session, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	sid, _ := ctx.Value(KeySessionID).(int64)
+
+	query := `SELECT id, user_agent, ip, created_at, last_used_at FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND impersonator_id IS NULL
+		ORDER BY last_used_at DESC, id DESC`
+	rows, err := s.db.QueryContext(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select sessions: %v", err)
+	}
+
+	defer rows.Close()
+
+	ss := []Session{}
+	for rows.Next() {
+		var ses Session
+		if err = rows.Scan(&ses.ID, &ses.UserAgent, &ses.IP, &ses.CreatedAt, &ses.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("could not scan session: %v", err)
+		}
+
+		ses.Current = ses.ID == sid
+		ss = append(ss, ses)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate session rows: %v", err)
+	}
+
+	return ss, nil
+}
+
+// RevokeSession of the authenticated user, logging that device out.
+func (s *Service) RevokeSession(ctx context.Context, sessionID int64) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	query := "UPDATE sessions SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL"
+	res, err := s.db.ExecContext(ctx, query, sessionID, uid)
+	if err != nil {
+		return fmt.Errorf("could not revoke session: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// Settings of the instance that can change while it runs. They are read from
+// the settings file on startup and read again on SIGHUP or when an admin asks,
+// without dropping connections. Feature flags and word filters live in the
+// database and already apply as soon as they change.
+type Settings struct {
+	// Accounts with a reputation below LowReputation can publish
+	// at most LowReputationPostsPerHour posts an hour.
+	LowReputation             int `json:"lowReputation"`
+	LowReputationPostsPerHour int `json:"lowReputationPostsPerHour"`
+	// Follow limits, see FollowsPerHour. Zero disables each.
+	FollowsPerHour   int `json:"followsPerHour"`
+	FollowsPerDay    int `json:"followsPerDay"`
+	FollowRatioAfter int `json:"followRatioAfter"`
+	MaxFollowRatio   int `json:"maxFollowRatio"`
+	// NSFWMinimumAge users must be to see NSFW posts of others and
+	// to change their NSFW preference. Zero disables the check.
+	NSFWMinimumAge int `json:"nsfwMinimumAge"`
+	// TermsVersion is the current version of the terms of service and privacy
+	// policy, which users must accept before using the API. Empty requires none.
+	TermsVersion string `json:"termsVersion"`
+}
+
+// DefaultSettings apply when there is no settings file,
+// and to the settings it leaves out.
+func DefaultSettings() Settings {
+	return Settings{
+		LowReputation:             LowReputation,
+		LowReputationPostsPerHour: LowReputationPostsPerHour,
+		FollowsPerHour:            FollowsPerHour,
+		FollowsPerDay:             FollowsPerDay,
+		FollowRatioAfter:          FollowRatioAfter,
+		MaxFollowRatio:            MaxFollowRatio,
+		NSFWMinimumAge:            NSFWMinimumAge,
+	}
+}
+
+// runtimeSettings holds the Settings of this process.
+type runtimeSettings struct {
+	mu       sync.RWMutex
+	file     string
+	settings Settings
+}
+
+// Settings returns the current settings. It's cheap enough to call on every request.
+func (s *Service) Settings() Settings {
+	s.settings.mu.RLock()
+	defer s.settings.mu.RUnlock()
+	return s.settings.settings
+}
+
+// LoadSettings reads the settings file anew and applies it. When the file
+// is invalid, the current settings are kept. Without a file it's a no-op.
+func (s *Service) LoadSettings() (Settings, error) {
+	s.settings.mu.Lock()
+	defer s.settings.mu.Unlock()
+
+	if s.settings.file == "" {
+		return s.settings.settings, nil
+	}
+
+	b, err := os.ReadFile(s.settings.file)
+	if err != nil {
+		return s.settings.settings, fmt.Errorf("could not read settings file: %v", err)
+	}
+
+	in := DefaultSettings()
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err = d.Decode(&in); err != nil {
+		return s.settings.settings, fmt.Errorf("could not parse settings file: %v", err)
+	}
+
+	var v validation.Validator
+	v.Check(in.LowReputationPostsPerHour >= 0, "lowReputationPostsPerHour", "can't be negative")
+	v.Check(in.FollowsPerHour >= 0, "followsPerHour", "can't be negative")
+	v.Check(in.FollowsPerDay >= 0, "followsPerDay", "can't be negative")
+	v.Check(in.FollowRatioAfter >= 0, "followRatioAfter", "can't be negative")
+	v.Check(in.MaxFollowRatio >= 0, "maxFollowRatio", "can't be negative")
+	v.Check(in.NSFWMinimumAge >= 0, "nsfwMinimumAge", "can't be negative")
+	v.Check(in.TermsVersion == strings.TrimSpace(in.TermsVersion), "termsVersion", "can't have surrounding spaces")
+	if err = v.Err(); err != nil {
+		return s.settings.settings, err
+	}
+
+	s.settings.settings = in
+	return in, nil
+}
+
+// AdminSettings returns the current settings. Admin only.
+func (s *Service) AdminSettings(ctx context.Context) (Settings, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return Settings{}, err
+	}
+
+	return s.Settings(), nil
+}
+
+// ReloadSettings reads the settings file anew, like on SIGHUP. Admin only.
+// It applies to this process only.
+func (s *Service) ReloadSettings(ctx context.Context) (Settings, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return Settings{}, err
+	}
+
+	return s.LoadSettings()
+}
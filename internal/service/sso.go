@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/sso"
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// OIDCStateTTL is how long logging in with the OIDC provider can take.
+const OIDCStateTTL = time.Minute * 10
+
+// Single sign-on providers, as recorded in the audit log.
+const (
+	SSOProviderLDAP = "ldap"
+	SSOProviderOIDC = "oidc"
+)
+
+var (
+	// ErrInvalidCredentials used when the enterprise identity provider
+	// doesn't authenticate the user
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrSSORequired used when logging in or signing up without the
+	// enterprise identity provider while it is configured
+	ErrSSORequired = errors.New("single sign-on required")
+	// ErrOIDCDisabled used when logging in with OIDC while no provider is configured
+	ErrOIDCDisabled = errors.New("oidc login disabled")
+	// ErrOIDCStateNotFound used when the state given back was not issued,
+	// expired or was already used
+	ErrOIDCStateNotFound = errors.New("oidc state not found")
+)
+
+// roleRanks orders the roles from least to most privileged.
+var roleRanks = map[string]int{RoleUser: 0, RoleModerator: 1, RoleAdmin: 2}
+
+// OIDCAuthRequest to send the user to for logging in with the OIDC provider.
+type OIDCAuthRequest struct {
+	URL string `json:"url"`
+}
+
+// OIDCLoginInput is what the OIDC provider sent back to its redirect URL.
+type OIDCLoginInput struct {
+	State string `json:"state"`
+	Code  string `json:"code"`
+}
+
+// ssoRequired reports whether users must log in with the enterprise identity provider.
+func (s *Service) ssoRequired() bool {
+	return s.ldap != nil || s.oidc != nil
+}
+
+// ldapLogin binds to the directory as the user and logs them in.
+func (s *Service) ldapLogin(ctx context.Context, email, password string) (LoginOutput, error) {
+	id, err := s.ldap.Authenticate(ctx, email, password)
+	if err == sso.ErrInvalidCredentials {
+		return LoginOutput{}, ErrInvalidCredentials
+	}
+
+	if err != nil {
+		return LoginOutput{}, fmt.Errorf("could not authenticate with ldap: %v", err)
+	}
+
+	return s.ssoLogin(ctx, SSOProviderLDAP, id)
+}
+
+// BeginOIDCLogin issues the URL of the OIDC provider to log in with.
+func (s *Service) BeginOIDCLogin(ctx context.Context) (OIDCAuthRequest, error) {
+	var out OIDCAuthRequest
+	if s.oidc == nil {
+		return out, ErrOIDCDisabled
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return out, err
+	}
+
+	nonce, err := randomToken()
+	if err != nil {
+		return out, err
+	}
+
+	if _, err = s.db.ExecContext(ctx, "DELETE FROM oidc_states WHERE expires_at < now()"); err != nil {
+		return out, fmt.Errorf("could not delete expired oidc states: %v", err)
+	}
+
+	query := "INSERT INTO oidc_states (state, nonce, expires_at) VALUES ($1, $2, $3)"
+	if _, err = s.db.ExecContext(ctx, query, state, nonce, time.Now().Add(OIDCStateTTL)); err != nil {
+		return out, fmt.Errorf("could not insert oidc state: %v", err)
+	}
+
+	if out.URL, err = s.oidc.AuthURL(ctx, state, nonce); err != nil {
+		return out, fmt.Errorf("could not create oidc auth url: %v", err)
+	}
+
+	return out, nil
+}
+
+// OIDCLogin exchanges the code the OIDC provider sent back for the identity
+// of the user and logs them in. The state can only be used once.
+func (s *Service) OIDCLogin(ctx context.Context, in OIDCLoginInput) (LoginOutput, error) {
+	var out LoginOutput
+	if s.oidc == nil {
+		return out, ErrOIDCDisabled
+	}
+
+	var nonce string
+	query := "DELETE FROM oidc_states WHERE state = $1 AND expires_at > now() RETURNING nonce"
+	err := s.db.QueryRowContext(ctx, query, in.State).Scan(&nonce)
+	if err == sql.ErrNoRows {
+		return out, ErrOIDCStateNotFound
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not delete oidc state: %v", err)
+	}
+
+	id, err := s.oidc.Exchange(ctx, in.Code, nonce)
+	if err == sso.ErrInvalidCredentials {
+		return out, ErrInvalidCredentials
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not exchange oidc code: %v", err)
+	}
+
+	return s.ssoLogin(ctx, SSOProviderOIDC, id)
+}
+
+// ssoLogin logs in the user authenticated by the provider, creating them on their
+// first login. With SSORoles configured, their role follows their groups on every
+// login. Users to create with a username that is invalid or taken on socnet
+// can be provisioned ahead, by email, with ProvisionUsers.
+func (s *Service) ssoLogin(ctx context.Context, provider string, id sso.Identity) (LoginOutput, error) {
+	var out LoginOutput
+	email := strings.TrimSpace(id.Email)
+	role, syncRole := s.ssoRole(id.Groups)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return out, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	var uid int64
+	var currentRole string
+	var active bool
+	query := "SELECT id, role, deactivated_at IS NULL FROM users WHERE email = $1 FOR UPDATE"
+	err = tx.QueryRowContext(ctx, query, email).Scan(&uid, &currentRole, &active)
+	switch {
+	case err == sql.ErrNoRows:
+		if uid, err = s.createSSOUser(ctx, tx, provider, email, id.Username, role); err != nil {
+			return out, err
+		}
+	case err != nil:
+		return out, fmt.Errorf("could not query select user: %v", err)
+	case !active:
+		return out, ErrForbidden
+	case syncRole && role != currentRole:
+		if _, err = tx.ExecContext(ctx, "UPDATE users SET role = $1 WHERE id = $2", role, uid); err != nil {
+			return out, fmt.Errorf("could not update role: %v", err)
+		}
+
+		details := map[string]interface{}{"provider": provider, "role": role}
+		if err = s.audit(ctx, tx, uid, AuditActionSSORole, uid, details); err != nil {
+			return out, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return out, fmt.Errorf("could not commit sso login: %v", err)
+	}
+
+	if out.AuthUser, err = s.userByID(ctx, uid); err != nil {
+		return out, err
+	}
+
+	err = s.startSession(ctx, &out)
+	return out, err
+}
+
+// createSSOUser named after their username on the provider,
+// or the local part of their email when it has none.
+func (s *Service) createSSOUser(ctx context.Context, tx *sql.Tx, provider, email, username, role string) (int64, error) {
+	if username == "" {
+		username = strings.Split(email, "@")[0]
+	}
+
+	username = validation.NormalizeUsername(username)
+	var v validation.Validator
+	v.Email("email", email)
+	v.Username("username", username)
+	if err := v.Err(); err != nil {
+		log.Printf("could not create %s user %q: %v\n", provider, email, err)
+		return 0, err
+	}
+
+	var uid int64
+	query := "INSERT INTO users (email, username, username_skeleton, role) VALUES ($1, $2, $3, $4) RETURNING id"
+	err := tx.QueryRowContext(ctx, query, email, username, validation.UsernameSkeleton(username), role).Scan(&uid)
+	if isUniqueViolation(err) && strings.Contains(err.Error(), "username") {
+		log.Printf("could not create %s user %q: username %q taken\n", provider, email, username)
+		return 0, ErrUsernameTaken
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("could not insert user: %v", err)
+	}
+
+	details := map[string]interface{}{"provider": provider, "email": email, "username": username, "role": role}
+	if err = s.audit(ctx, tx, uid, AuditActionSSOProvision, uid, details); err != nil {
+		return 0, err
+	}
+
+	return uid, nil
+}
+
+// ssoRole is the most privileged role the groups map to, and whether roles
+// are managed by the provider at all, which they are once SSORoles is set.
+func (s *Service) ssoRole(groups []string) (string, bool) {
+	if len(s.ssoRoles) == 0 {
+		return RoleUser, false
+	}
+
+	role := RoleUser
+	for _, g := range groups {
+		for group, r := range s.ssoRoles {
+			if strings.EqualFold(g, group) && roleRanks[r] > roleRanks[role] {
+				role = r
+			}
+		}
+	}
+
+	return role, true
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate random token: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
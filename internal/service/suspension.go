@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+var (
+	// ErrAccountSuspended used when a suspended user tries to do anything
+	// but read and manage their account
+	ErrAccountSuspended = errors.New("account suspended")
+	// ErrAccountBanned used when a banned user tries to do anything
+	// but manage their account
+	ErrAccountBanned = errors.New("account banned")
+)
+
+// SuspendUserInput request. A nil Until bans the user for good.
+type SuspendUserInput struct {
+	Until  *time.Time
+	Reason string
+}
+
+// SuspendUser restricts the given user until the given time, or bans them.
+// They can still log in, but what they can do is gated by the handler from
+// their AuthSession. Suspending again replaces the previous suspension.
+// Admin only, and every change is recorded in the audit log.
+func (s *Service) SuspendUser(ctx context.Context, username string, in SuspendUserInput) error {
+	adminID, err := s.authAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	username = validation.NormalizeUsername(username)
+	in.Reason = strings.TrimSpace(in.Reason)
+	var v validation.Validator
+	v.Username("username", username)
+	v.Check(in.Until == nil || in.Until.After(time.Now()), "until", "must be in the future")
+	v.Check(utf8.RuneCountInString(in.Reason) <= validation.MaxPostLength, "reason", "too long")
+	if err = v.Err(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	var uid int64
+	query := `UPDATE users SET suspended_at = now(), suspended_until = $1, suspension_reason = $2
+		WHERE lower(username) = lower($3)
+		RETURNING id`
+	err = tx.QueryRowContext(ctx, query, in.Until, in.Reason, username).Scan(&uid)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not update user suspension: %v", err)
+	}
+
+	if uid == adminID {
+		return ErrForbidden
+	}
+
+	action := AuditActionSuspend
+	details := map[string]interface{}{"username": username, "reason": in.Reason}
+	if in.Until == nil {
+		action = AuditActionBan
+	} else {
+		details["until"] = in.Until
+	}
+	if err = s.audit(ctx, tx, adminID, action, uid, details); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit user suspension: %v", err)
+	}
+
+	return nil
+}
+
+// UnsuspendUser lifts the suspension or ban of the given user.
+// Admin only, and recorded in the audit log.
+func (s *Service) UnsuspendUser(ctx context.Context, username string) error {
+	adminID, err := s.authAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	username = validation.NormalizeUsername(username)
+	var v validation.Validator
+	v.Username("username", username)
+	if err = v.Err(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	var uid int64
+	var suspended bool
+	query := `SELECT id, suspended_at IS NOT NULL AND (suspended_until IS NULL OR suspended_until > now())
+		FROM users WHERE lower(username) = lower($1) FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, username).Scan(&uid, &suspended)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not query select user suspension: %v", err)
+	}
+
+	if !suspended {
+		return nil
+	}
+
+	query = "UPDATE users SET suspended_at = NULL, suspended_until = NULL, suspension_reason = NULL WHERE id = $1"
+	if _, err = tx.ExecContext(ctx, query, uid); err != nil {
+		return fmt.Errorf("could not update user suspension: %v", err)
+	}
+
+	if err = s.audit(ctx, tx, adminID, AuditActionUnsuspend, uid, map[string]interface{}{"username": username}); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit user unsuspension: %v", err)
+	}
+
+	return nil
+}
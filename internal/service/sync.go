@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// Resources clients sync by deltas, as noted in sync_removals.
+const (
+	syncTimeline      = "timeline"
+	syncNotifications = "notifications"
+	syncBookmarks     = "bookmarks"
+)
+
+// SyncDeltaSize is how many changed and how many removed items a delta has at most.
+const SyncDeltaSize = validation.MaxPageSize
+
+// SyncRetention is how long removals are kept for delta sync.
+// Older sync positions expire, and clients have to load the resource again.
+const SyncRetention = 30 * 24 * time.Hour
+
+// syncSettleDelay keeps the newest changes out of deltas, so a change
+// committing after one with a greater sync id isn't skipped. They show up in
+// the next delta. Changes must commit within it of taking their sync id.
+const syncSettleDelay = 10 * time.Second
+
+// ErrSyncExpired denotes a sync position older than SyncRetention.
+var ErrSyncExpired = errors.New("sync position expired")
+
+// SyncPosition is how far a client synced a resource. Sync ids of all the
+// resources come from a single sequence, but a position is only good for the
+// resource it was taken on.
+type SyncPosition struct {
+	SyncID int64
+	// At is when the position was taken.
+	At time.Time
+}
+
+func (pos SyncPosition) expired() bool {
+	return pos.At.Before(time.Now().Add(-SyncRetention))
+}
+
+// syncChange is an item changed or removed at a sync id.
+type syncChange struct {
+	syncID int64
+	itemID int64
+}
+
+// syncDelta bounds the changes and removals of a delta.
+type syncDelta struct {
+	// changed is how many of the changed items to keep.
+	changed  int
+	removed  []int64
+	position SyncPosition
+	more     bool
+}
+
+// syncPosition of the user on the resource kept on the given table, past its
+// settled changes and removals.
+func (s *Service) syncPosition(ctx context.Context, uid int64, resource, table string) (SyncPosition, error) {
+	pos := SyncPosition{At: time.Now()}
+	query := `SELECT GREATEST(
+		(SELECT max(sync_id) FROM ` + table + ` WHERE user_id = $1 AND synced_at < now() - $3::INTERVAL),
+		(SELECT max(id) FROM sync_removals WHERE user_id = $1 AND resource = $2 AND removed_at < now() - $3::INTERVAL),
+		0)`
+	if err := s.db.QueryRowContext(ctx, query, uid, resource, interval(syncSettleDelay)).Scan(&pos.SyncID); err != nil {
+		return pos, fmt.Errorf("could not query select %s sync position: %v", resource, err)
+	}
+
+	return pos, nil
+}
+
+// syncDelta reads the settled removals of the resource after the position and
+// cuts them along with the given changed items, both oldest first and at most
+// SyncDeltaSize, at the first sync id one of them could be missing items after.
+// Removals of items changed again after are dropped.
+func (s *Service) syncDelta(ctx context.Context, uid int64, resource string, since SyncPosition, changed []syncChange) (syncDelta, error) {
+	out := syncDelta{changed: len(changed), removed: []int64{}, position: SyncPosition{SyncID: since.SyncID, At: time.Now()}}
+	query := `SELECT id, item_id FROM sync_removals
+		WHERE user_id = $1 AND resource = $2 AND id > $3 AND removed_at < now() - $4::INTERVAL
+		ORDER BY id
+		LIMIT $5`
+	rows, err := s.db.QueryContext(ctx, query, uid, resource, since.SyncID, interval(syncSettleDelay), SyncDeltaSize)
+	if err != nil {
+		return out, fmt.Errorf("could not query select %s removals: %v", resource, err)
+	}
+
+	defer rows.Close()
+
+	var removed []syncChange
+	for rows.Next() {
+		var r syncChange
+		if err = rows.Scan(&r.syncID, &r.itemID); err != nil {
+			return out, fmt.Errorf("could not scan %s removal: %v", resource, err)
+		}
+
+		removed = append(removed, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return out, fmt.Errorf("could not iterate %s removal rows: %v", resource, err)
+	}
+
+	var bound int64 = -1
+	if n := len(changed); n == SyncDeltaSize {
+		bound = changed[n-1].syncID
+	}
+	if n := len(removed); n == SyncDeltaSize && (bound == -1 || removed[n-1].syncID < bound) {
+		bound = removed[n-1].syncID
+	}
+	out.more = bound != -1
+
+	kept := map[int64]bool{}
+	for i, c := range changed {
+		if out.more && c.syncID > bound {
+			out.changed = i
+			break
+		}
+
+		kept[c.itemID] = true
+		if c.syncID > out.position.SyncID {
+			out.position.SyncID = c.syncID
+		}
+	}
+
+	for _, r := range removed {
+		if out.more && r.syncID > bound {
+			break
+		}
+
+		if r.syncID > out.position.SyncID {
+			out.position.SyncID = r.syncID
+		}
+		if !kept[r.itemID] {
+			out.removed = append(out.removed, r.itemID)
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// threadOf returns the thread a reply to the given post of the user joins.
+// Replying to a post that is not part of a thread yet starts one with it.
+func threadOf(ctx context.Context, tx *sql.Tx, uid, replyToPostID int64) (*int64, error) {
+	var userID int64
+	var threadID int64
+	query := "SELECT user_id, COALESCE(thread_id, id) FROM posts WHERE id = $1 FOR UPDATE"
+	err := tx.QueryRowContext(ctx, query, replyToPostID).Scan(&userID, &threadID)
+	if err == sql.ErrNoRows {
+		return nil, ErrPostNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not query select thread post: %v", err)
+	}
+
+	// Threads are chains of posts of the same author.
+	if userID != uid {
+		return nil, ErrForbidden
+	}
+
+	query = "UPDATE posts SET thread_id = id WHERE id = $1 AND thread_id IS NULL"
+	if _, err = tx.ExecContext(ctx, query, replyToPostID); err != nil {
+		return nil, fmt.Errorf("could not update thread start: %v", err)
+	}
+
+	return &threadID, nil
+}
+
+// Thread returns the posts of the thread the given post is part of, in the
+// order they were posted. A post not part of a thread is returned alone.
+func (s *Service) Thread(ctx context.Context, postID int64) ([]Post, error) {
+	uid, auth := ctx.Value(KeyAuthUserID).(int64)
+
+	var threadID int64
+	query := "SELECT COALESCE(thread_id, id) FROM posts WHERE id = $1"
+	err := s.db.QueryRowContext(ctx, query, postID).Scan(&threadID)
+	if err == sql.ErrNoRows {
+		return nil, ErrPostNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not query select post thread: %v", err)
+	}
+
+	query, args, err := buildQuery(`
+		SELECT p.id, p.content, p.spoiler_of, p.nsfw, p.license, p.likes_count, p.comments_count, p.created_at, u.username, u.avatar, u.verified
+		, p.thread_id, p.reply_to_post_id
+		{{if .auth}}
+		, p.user_id = @uid AS mine
+		, pl.user_id IS NOT NULL AS liked
+		{{end}}
+		FROM posts p
+		INNER JOIN users u ON p.user_id = u.id
+		{{if .auth}}
+		LEFT JOIN post_likes pl ON pl.user_id = @uid AND pl.post_id = p.id
+		{{end}}
+		WHERE (p.id = @thread_id OR p.thread_id = @thread_id)
+		AND (NOT p.archived{{if .auth}} OR p.user_id = @uid{{end}})
+		{{template "nsfwFilter" .}}
+		ORDER BY p.id
+	`, map[string]interface{}{
+		"uid":        uid,
+		"auth":       auth,
+		"nsfwBornBy": s.nsfwBornBy(),
+		"thread_id":  threadID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build thread sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select thread posts: %v", err)
+	}
+
+	defer rows.Close()
+
+	pp := []Post{}
+	for rows.Next() {
+		var p Post
+		var u User
+		var avatar sql.NullString
+		dest := []interface{}{&p.ID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.License, &p.LikesCount, &p.CommentsCount, &p.CreatedAt, &u.Username, &avatar, &u.Verified, &p.ThreadID, &p.ReplyToPostID}
+		if auth {
+			dest = append(dest, &p.Mine, &p.Liked)
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan thread post: %v", err)
+		}
+
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			u.AvatarURL = &avatarURL
+		}
+
+		p.User = &u
+		pp = append(pp, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate thread post rows: %v", err)
+	}
+
+	if err = s.fillPosts(ctx, postPtrs(pp)); err != nil {
+		return nil, err
+	}
+
+	return pp, nil
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"fmt"
+)
+
+// TimelineDelta is what changed in a timeline since a sync position.
+type TimelineDelta struct {
+	// Added items, oldest first.
+	Added []TimelineItem `json:"added"`
+	// Removed ids of items, of posts deleted since.
+	Removed []int64 `json:"removed"`
+	// More changes are left past SyncDeltaSize; sync again from Position.
+	More     bool         `json:"more"`
+	Position SyncPosition `json:"-"`
+}
+
+// TimelineDelta of the authenticated user since the given position, so clients
+// can reconcile a local copy without loading it again. A nil position only
+// returns the current one: take it before loading the timeline.
+// Items are filtered as in the timeline at the time of the sync.
+func (s *Service) TimelineDelta(ctx context.Context, since *SyncPosition) (TimelineDelta, error) {
+	out := TimelineDelta{Added: []TimelineItem{}, Removed: []int64{}}
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	if since == nil {
+		var err error
+		out.Position, err = s.syncPosition(ctx, uid, syncTimeline, "timeline")
+		return out, err
+	}
+
+	if since.expired() {
+		return out, ErrSyncExpired
+	}
+
+	if err := s.pullShedPosts(ctx, uid); err != nil {
+		return out, err
+	}
+
+	query, args, err := buildQuery(`
+		SELECT t.id, p.id, p.content, p.spoiler_of, p.nsfw, p.license, p.likes_count, p.comments_count, p.created_at
+		, p.user_id = @uid AS mine
+		, pl.user_id IS NOT NULL AS liked
+		, u.username, u.avatar, u.verified, t.sync_id
+		FROM timeline t
+		INNER JOIN posts p ON t.post_id = p.id
+		INNER JOIN users u ON p.user_id = u.id
+		LEFT JOIN post_likes pl on pl.user_id = p.user_id and pl.post_id = p.id
+		WHERE t.user_id = @uid AND t.sync_id > @since
+		AND t.synced_at < now() - @settle::INTERVAL
+		{{template "nsfwFilter" .}}
+		AND NOT p.archived
+		ORDER BY t.sync_id
+		LIMIT @limit
+	`, map[string]interface{}{
+		"auth":       true,
+		"uid":        uid,
+		"nsfwBornBy": s.nsfwBornBy(),
+		"since":      since.SyncID,
+		"settle":     interval(syncSettleDelay),
+		"limit":      SyncDeltaSize,
+	})
+	if err != nil {
+		return out, fmt.Errorf("could not build timeline delta sql query: %v", err)
+	}
+
+	if out.Added, err = s.queryTimeline(ctx, query, args, SyncDeltaSize); err != nil {
+		return out, err
+	}
+
+	changed := make([]syncChange, len(out.Added))
+	for i, ti := range out.Added {
+		changed[i] = syncChange{syncID: ti.SyncID, itemID: ti.ID}
+	}
+
+	d, err := s.syncDelta(ctx, uid, syncTimeline, *since, changed)
+	if err != nil {
+		return out, err
+	}
+
+	out.Added = out.Added[:d.changed]
+	out.Removed = d.removed
+	out.More = d.more
+	out.Position = d.position
+	return out, nil
+}
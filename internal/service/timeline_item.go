@@ -4,6 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"github.com/djomlaa/socnet/internal/validation"
+	"strings"
+	"time"
 )
 
 // TimelineItem model
@@ -11,38 +14,78 @@ type TimelineItem struct {
 	ID     int64 `json:"id"`
 	UserID int64 `json:"-"`
 	PostID int64 `json:"-"`
+	SyncID int64 `json:"-"`
 	Post   Post  `json:"post"`
 }
 
+// TimelineFilter narrows down the timeline items. The zero value filters nothing.
+type TimelineFilter struct {
+	// OnlyMedia keeps posts with media attached.
+	OnlyMedia bool
+	// From keeps posts of the user with this username.
+	From string
+}
+
 // Timeline -
-func (s *Service) Timeline(ctx context.Context, last int, before int) ([]TimelineItem, error) {
+func (s *Service) Timeline(ctx context.Context, last int, before int, filter TimelineFilter) ([]TimelineItem, error) {
 	uid, ok := ctx.Value(KeyAuthUserID).(int64)
 	if !ok {
 		return nil, ErrUnauthenticated
 	}
-	last = normalizePageSize(last)
+	var v validation.Validator
+	v.Cursor("before", int64(before))
+	filter.From = strings.TrimSpace(filter.From)
+	if filter.From != "" {
+		v.Username("from", filter.From)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	if before == 0 {
+		if err := s.pullShedPosts(ctx, uid); err != nil {
+			return nil, err
+		}
+	}
+
+	last = validation.PageSize(last)
 	query, args, err := buildQuery(`
-		SELECT t.id, p.id, p.content, p.spoiler_of, p.nsfw, p.likes_count, p.comments_count, p.created_at
+		SELECT t.id, p.id, p.content, p.spoiler_of, p.nsfw, p.license, p.likes_count, p.comments_count, p.created_at
 		, p.user_id = @uid AS mine
 		, pl.user_id IS NOT NULL AS liked
-		, u.username, u.avatar
+		, u.username, u.avatar, u.verified, t.sync_id
 		FROM timeline t
 		INNER JOIN posts p ON t.post_id = p.id
 		INNER JOIN users u ON p.user_id = u.id
 		LEFT JOIN post_likes pl on pl.user_id = p.user_id and pl.post_id = p.id
 		WHERE t.user_id = @uid
+		{{template "nsfwFilter" .}}
+		AND NOT p.archived
+		{{if .only_media}}AND EXISTS (SELECT 1 FROM media m WHERE m.post_id = p.id){{end}}
+		{{if .from}}AND lower(u.username) = lower(@from){{end}}
 		{{if .before}}	AND t.id < @before {{end}}
 		ORDER BY created_at DESC
 		LIMIT @last
 	`, map[string]interface{}{
-		"uid":    uid,
-		"last":   last,
-		"before": before,
+		"auth":       true,
+		"uid":        uid,
+		"nsfwBornBy": s.nsfwBornBy(),
+		"last":       last,
+		"before":     before,
+		"only_media": filter.OnlyMedia,
+		"from":       filter.From,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("could not build timeline sql query: %v", err)
 	}
 
+	return s.queryTimeline(ctx, query, args, last)
+}
+
+// queryTimeline runs a query selecting the timeline item id, the post with its
+// author, whether the authenticated user wrote and liked it and the item sync id,
+// and fills the posts.
+func (s *Service) queryTimeline(ctx context.Context, query string, args []interface{}, capacity int) ([]TimelineItem, error) {
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("could not query select timeline: %v", err)
@@ -51,7 +94,7 @@ func (s *Service) Timeline(ctx context.Context, last int, before int) ([]Timelin
 
 	var u User
 	var avatar sql.NullString
-	tt := make([]TimelineItem, 0, last)
+	tt := make([]TimelineItem, 0, capacity)
 	for rows.Next() {
 		var ti TimelineItem
 		dest := []interface{}{
@@ -60,6 +103,7 @@ func (s *Service) Timeline(ctx context.Context, last int, before int) ([]Timelin
 			&ti.Post.Content,
 			&ti.Post.SpoilerOf,
 			&ti.Post.NSFW,
+			&ti.Post.License,
 			&ti.Post.LikesCount,
 			&ti.Post.CommentsCount,
 			&ti.Post.CreatedAt,
@@ -67,6 +111,8 @@ func (s *Service) Timeline(ctx context.Context, last int, before int) ([]Timelin
 			&ti.Post.Liked,
 			&u.Username,
 			&avatar,
+			&u.Verified,
+			&ti.SyncID,
 		}
 
 		if err = rows.Scan(dest...); err != nil {
@@ -86,5 +132,138 @@ func (s *Service) Timeline(ctx context.Context, last int, before int) ([]Timelin
 		return nil, fmt.Errorf("could not iterate timeline rows: %v", err)
 	}
 
+	pp := make([]*Post, len(tt))
+	for i := range tt {
+		pp[i] = &tt[i].Post
+	}
+
+	if err = s.fillPosts(ctx, pp); err != nil {
+		return nil, err
+	}
+
 	return tt, nil
 }
+
+// PruneTimeline deletes the timeline items of posts created before the given time
+// and returns how many were deleted. Clients keep their pruned items on delta sync.
+// Sync removals past SyncRetention are deleted too.
+func (s *Service) PruneTimeline(ctx context.Context, before time.Time) (int64, error) {
+	query := "DELETE FROM sync_removals WHERE removed_at < now() - $1::INTERVAL"
+	if _, err := s.db.ExecContext(ctx, query, interval(SyncRetention)); err != nil {
+		return 0, fmt.Errorf("could not delete sync removals: %v", err)
+	}
+
+	query = "DELETE FROM timeline USING posts WHERE timeline.post_id = posts.id AND posts.created_at < $1"
+	res, err := s.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("could not delete timeline items: %v", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("could not count deleted timeline items: %v", err)
+	}
+
+	return n, nil
+}
+
+// TimelineUpdates is a summary of the timeline items newer than a cursor.
+type TimelineUpdates struct {
+	Count   int    `json:"count"`
+	Authors []User `json:"authors"`
+}
+
+// MaxTimelineUpdatesAuthors is how many authors TimelineUpdates can include.
+const MaxTimelineUpdatesAuthors = 5
+
+// TimelineUpdates counts the timeline items after sinceCursor, without fetching them,
+// and includes up to authors distinct authors of the newest ones.
+func (s *Service) TimelineUpdates(ctx context.Context, sinceCursor int64, authors int) (TimelineUpdates, error) {
+	var out TimelineUpdates
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	var v validation.Validator
+	v.Cursor("since_cursor", sinceCursor)
+	v.Check(authors >= 0 && authors <= MaxTimelineUpdatesAuthors, "authors", "out of range")
+	if err := v.Err(); err != nil {
+		return out, err
+	}
+
+	data := map[string]interface{}{
+		"auth":       true,
+		"uid":        uid,
+		"nsfwBornBy": s.nsfwBornBy(),
+		"since":      sinceCursor,
+		"last":       authors,
+	}
+	query, args, err := buildQuery(`
+		SELECT COUNT(*)
+		FROM timeline t
+		INNER JOIN posts p ON t.post_id = p.id
+		WHERE t.user_id = @uid AND t.id > @since
+		{{template "nsfwFilter" .}}
+		AND NOT p.archived
+	`, data)
+	if err != nil {
+		return out, fmt.Errorf("could not build timeline updates count sql query: %v", err)
+	}
+
+	if err = s.db.QueryRowContext(ctx, query, args...).Scan(&out.Count); err != nil {
+		return out, fmt.Errorf("could not query select timeline updates count: %v", err)
+	}
+
+	out.Authors = []User{}
+	if out.Count == 0 || authors == 0 {
+		return out, nil
+	}
+
+	query, args, err = buildQuery(`
+		SELECT u.username, u.avatar, u.verified
+		FROM (
+			SELECT p.user_id, MAX(t.id) AS last_item_id
+			FROM timeline t
+			INNER JOIN posts p ON t.post_id = p.id
+			WHERE t.user_id = @uid AND t.id > @since
+			{{template "nsfwFilter" .}}
+			AND NOT p.archived
+			GROUP BY p.user_id
+			ORDER BY last_item_id DESC
+			LIMIT @last
+		) a
+		INNER JOIN users u ON a.user_id = u.id
+		ORDER BY a.last_item_id DESC
+	`, data)
+	if err != nil {
+		return out, fmt.Errorf("could not build timeline updates authors sql query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return out, fmt.Errorf("could not query select timeline updates authors: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u User
+		var avatar sql.NullString
+		if err = rows.Scan(&u.Username, &avatar, &u.Verified); err != nil {
+			return out, fmt.Errorf("could not scan timeline updates author: %v", err)
+		}
+
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			u.AvatarURL = &avatarURL
+		}
+
+		out.Authors = append(out.Authors, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return out, fmt.Errorf("could not iterate timeline updates authors rows: %v", err)
+	}
+
+	return out, nil
+}
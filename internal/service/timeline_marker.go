@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTimelineItemNotFound denotes a timeline item that was not found
+var ErrTimelineItemNotFound = errors.New("timeline item not found")
+
+// TimelineMarker is the last timeline item the user read.
+type TimelineMarker struct {
+	TimelineItemID int64     `json:"timelineItemId"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// TimelineMarker of the authenticated user. A zero item id means nothing was read yet.
+func (s *Service) TimelineMarker(ctx context.Context) (TimelineMarker, error) {
+	var m TimelineMarker
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return m, ErrUnauthenticated
+	}
+
+	query := "SELECT timeline_item_id, updated_at FROM timeline_markers WHERE user_id = $1"
+	err := s.db.QueryRowContext(ctx, query, uid).Scan(&m.TimelineItemID, &m.UpdatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return m, fmt.Errorf("could not query select timeline marker: %v", err)
+	}
+
+	return m, nil
+}
+
+// UpdateTimelineMarker sets the last timeline item read by the authenticated user.
+func (s *Service) UpdateTimelineMarker(ctx context.Context, timelineItemID int64) (TimelineMarker, error) {
+	var m TimelineMarker
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return m, ErrUnauthenticated
+	}
+
+	query := `INSERT INTO timeline_markers (user_id, timeline_item_id)
+		SELECT user_id, id FROM timeline WHERE id = $1 AND user_id = $2
+		ON CONFLICT (user_id) DO UPDATE SET
+			timeline_item_id = EXCLUDED.timeline_item_id,
+			updated_at = now()
+		RETURNING updated_at`
+	err := s.db.QueryRowContext(ctx, query, timelineItemID, uid).Scan(&m.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return m, ErrTimelineItemNotFound
+	}
+
+	if err != nil {
+		return m, fmt.Errorf("could not upsert timeline marker: %v", err)
+	}
+
+	m.TimelineItemID = timelineItemID
+	return m, nil
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// ErrTranslationUnavailable used when no translation provider is configured.
+var ErrTranslationUnavailable = errors.New("translation unavailable")
+
+// PostTranslation model
+type PostTranslation struct {
+	PostID     int64  `json:"postId"`
+	Lang       string `json:"lang"`
+	SourceLang string `json:"sourceLang"`
+	Content    string `json:"content"`
+}
+
+// PostTranslation into lang. Translations are cached per post and language,
+// and the detected source language is stored on the post.
+// Archived posts are only translated for their author.
+func (s *Service) PostTranslation(ctx context.Context, postID int64, lang string) (PostTranslation, error) {
+	out := PostTranslation{PostID: postID}
+	uid, _ := ctx.Value(KeyAuthUserID).(int64)
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	var v validation.Validator
+	v.Lang("lang", lang)
+	if err := v.Err(); err != nil {
+		return out, err
+	}
+
+	out.Lang = lang
+
+	var content string
+	var sourceLang, cached sql.NullString
+	query := `SELECT p.content, p.lang, pt.content FROM posts p
+		LEFT JOIN post_translations pt ON pt.post_id = p.id AND pt.lang = $2
+		WHERE p.id = $1 AND (NOT p.archived OR p.user_id = $3)`
+	err := s.db.QueryRowContext(ctx, query, postID, lang, uid).Scan(&content, &sourceLang, &cached)
+	if err == sql.ErrNoRows {
+		return out, ErrPostNotFound
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not query select post translation: %v", err)
+	}
+
+	out.SourceLang = sourceLang.String
+	if cached.Valid {
+		out.Content = cached.String
+		return out, nil
+	}
+
+	if sourceLang.String == lang {
+		out.Content = content
+		return out, nil
+	}
+
+	if s.translator == nil {
+		return out, ErrTranslationUnavailable
+	}
+
+	t, err := s.translator.Translate(ctx, content, lang)
+	if err != nil {
+		return out, fmt.Errorf("could not translate post: %v", err)
+	}
+
+	out.Content = t.Text
+	if !sourceLang.Valid && t.SourceLang != "" {
+		out.SourceLang = t.SourceLang
+		query = "UPDATE posts SET lang = $1 WHERE id = $2 AND lang IS NULL"
+		if _, err = s.db.ExecContext(ctx, query, t.SourceLang, postID); err != nil {
+			return out, fmt.Errorf("could not update post lang: %v", err)
+		}
+	}
+
+	query = "INSERT INTO post_translations (post_id, lang, content) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING"
+	if _, err = s.db.ExecContext(ctx, query, postID, lang, t.Text); err != nil {
+		return out, fmt.Errorf("could not insert post translation: %v", err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+	gonanoid "github.com/matoous/go-nanoid"
+)
+
+// Where the bytes of an upload are kept until it is finalized.
+const (
+	uploadStorageS3  = "s3"
+	uploadStorageTus = "tus"
+)
+
+// tusDir keeps the partial tus uploads. Instances behind a load balancer
+// must share it, or route the requests of an upload to the same one.
+var tusDir = path.Join(os.TempDir(), "socnet-tus")
+
+// ErrUploadOffsetMismatch used when a tus chunk does not start where the upload left off.
+var ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+
+// ErrUploadLocked used when another chunk of the tus upload is being written.
+var ErrUploadLocked = errors.New("upload locked")
+
+// TusWriteLease is how long a chunk being written keeps other chunks of the
+// same upload out. Past it, a writer that never finished is taken over.
+const TusWriteLease = time.Hour
+
+// TusPruneInterval is how often expired tus uploads are deleted.
+const TusPruneInterval = time.Hour
+
+// TusUpload is the progress of a resumable upload.
+type TusUpload struct {
+	ID     string
+	Offset int64
+	Size   int64
+}
+
+func tusPath(uploadID string) string {
+	return path.Join(tusDir, uploadID)
+}
+
+// CreateTusUpload of the given size for the authenticated user, to be sent in
+// chunks with AppendTusUpload and then finalized like direct uploads.
+// The content type is optional; media is detected from its content anyway.
+func (s *Service) CreateTusUpload(ctx context.Context, size int64, contentType string) (TusUpload, error) {
+	var out TusUpload
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	var v validation.Validator
+	v.Check(size > 0 && size <= MaxDirectUploadBytes, "size", "out of range")
+	if contentType != "" {
+		_, supported := mediaTypes[contentType]
+		v.Check(supported, "contentType", "unsupported media type")
+	}
+	if err := v.Err(); err != nil {
+		return out, err
+	}
+
+	id, err := gonanoid.Nanoid()
+	if err != nil {
+		return out, fmt.Errorf("could not generate upload id: %v", err)
+	}
+
+	if err = os.MkdirAll(tusDir, 0700); err != nil {
+		return out, fmt.Errorf("could not create tus dir: %v", err)
+	}
+
+	f, err := os.Create(tusPath(id))
+	if err != nil {
+		return out, fmt.Errorf("could not create tus upload file: %v", err)
+	}
+
+	f.Close()
+
+	query := `INSERT INTO uploads (id, user_id, content_type, size, storage, expires_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)`
+	if _, err = s.db.ExecContext(ctx, query, id, uid, contentType, size, uploadStorageTus, time.Now().Add(UploadLifespan)); err != nil {
+		os.Remove(tusPath(id))
+		return out, fmt.Errorf("could not insert tus upload: %v", err)
+	}
+
+	out.ID = id
+	out.Size = size
+	return out, nil
+}
+
+// PruneTusUploads deletes the expired tus uploads and their files every
+// TusPruneInterval until ctx is done.
+func (s *Service) PruneTusUploads(ctx context.Context) {
+	ticker := time.NewTicker(TusPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.deleteExpiredTusUploads(ctx); err != nil {
+				log.Printf("could not prune tus uploads: %v\n", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deleteExpiredTusUploads along with their files.
+func (s *Service) deleteExpiredTusUploads(ctx context.Context) error {
+	query := "DELETE FROM uploads WHERE storage = $1 AND expires_at < now() RETURNING id"
+	rows, err := s.db.QueryContext(ctx, query, uploadStorageTus)
+	if err != nil {
+		return fmt.Errorf("could not delete expired tus uploads: %v", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return fmt.Errorf("could not scan expired tus upload: %v", err)
+		}
+
+		os.Remove(tusPath(id))
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("could not iterate expired tus upload rows: %v", err)
+	}
+
+	return nil
+}
+
+// TusUpload of the authenticated user, telling the client where to resume from.
+func (s *Service) TusUpload(ctx context.Context, uploadID string) (TusUpload, error) {
+	var out TusUpload
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	query := `SELECT upload_offset, size FROM uploads
+		WHERE id = $1 AND user_id = $2 AND storage = $3 AND expires_at > now()`
+	err := s.db.QueryRowContext(ctx, query, uploadID, uid, uploadStorageTus).Scan(&out.Offset, &out.Size)
+	if err == sql.ErrNoRows {
+		return out, ErrUploadNotFound
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not query select tus upload: %v", err)
+	}
+
+	out.ID = uploadID
+	return out, nil
+}
+
+// AppendTusUpload writes the chunk read from r at offset, which must be where
+// the upload left off. The bytes received are kept even if reading r fails
+// midway, so the client can resume from there. It returns the new offset.
+// A chunk sent while another one of the upload is being written fails with
+// ErrUploadLocked.
+func (s *Service) AppendTusUpload(ctx context.Context, uploadID string, offset int64, r io.Reader) (int64, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return 0, ErrUnauthenticated
+	}
+
+	// Chunks of the same upload are kept from interleaving by claiming it for
+	// the write, instead of locking its row while reading from the client.
+	// The claim outlives a client disconnecting midway, so what it sent is kept.
+	dbCtx := context.Background()
+	var current, size int64
+	var since time.Time
+	query := `UPDATE uploads SET writing_since = now()
+		WHERE id = $1 AND user_id = $2 AND storage = $3 AND expires_at > now()
+			AND (writing_since IS NULL OR writing_since < now() - $4::INTERVAL)
+		RETURNING upload_offset, size, writing_since`
+	err := s.db.QueryRowContext(dbCtx, query, uploadID, uid, uploadStorageTus, interval(TusWriteLease)).
+		Scan(&current, &size, &since)
+	if err == sql.ErrNoRows {
+		var exists bool
+		query = `SELECT EXISTS (SELECT 1 FROM uploads
+			WHERE id = $1 AND user_id = $2 AND storage = $3 AND expires_at > now())`
+		if err = s.db.QueryRowContext(dbCtx, query, uploadID, uid, uploadStorageTus).Scan(&exists); err != nil {
+			return 0, fmt.Errorf("could not query select tus upload existence: %v", err)
+		}
+
+		if exists {
+			return 0, ErrUploadLocked
+		}
+
+		return 0, ErrUploadNotFound
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("could not claim tus upload: %v", err)
+	}
+
+	released := false
+	defer func() {
+		if released {
+			return
+		}
+
+		query := "UPDATE uploads SET writing_since = NULL WHERE id = $1 AND writing_since = $2"
+		if _, err := s.db.ExecContext(dbCtx, query, uploadID, since); err != nil {
+			log.Printf("could not release tus upload: %v\n", err)
+		}
+	}()
+
+	if offset != current {
+		return current, ErrUploadOffsetMismatch
+	}
+
+	f, err := os.OpenFile(tusPath(uploadID), os.O_WRONLY, 0600)
+	if err != nil {
+		return current, fmt.Errorf("could not open tus upload file: %v", err)
+	}
+
+	defer f.Close()
+
+	// Drop whatever a previous failed chunk left past the offset.
+	if err = f.Truncate(current); err != nil {
+		return current, fmt.Errorf("could not truncate tus upload file: %v", err)
+	}
+
+	if _, err = f.Seek(current, io.SeekStart); err != nil {
+		return current, fmt.Errorf("could not seek tus upload file: %v", err)
+	}
+
+	n, copyErr := io.Copy(f, io.LimitReader(r, size-current))
+	if n == 0 && copyErr != nil {
+		return current, fmt.Errorf("could not write tus chunk: %v", copyErr)
+	}
+
+	if err = f.Sync(); err != nil {
+		return current, fmt.Errorf("could not sync tus upload file: %v", err)
+	}
+
+	current += n
+	query = "UPDATE uploads SET upload_offset = $1, writing_since = NULL WHERE id = $2 AND writing_since = $3"
+	res, err := s.db.ExecContext(dbCtx, query, current, uploadID, since)
+	if err != nil {
+		return offset, fmt.Errorf("could not update tus upload offset: %v", err)
+	}
+
+	released = true
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		// The lease ran out and another chunk took the upload over.
+		return offset, ErrUploadLocked
+	}
+
+	if copyErr != nil {
+		return current, fmt.Errorf("could not write tus chunk: %v", copyErr)
+	}
+
+	return current, nil
+}
+
+// DeleteTusUpload of the authenticated user, discarding what was uploaded.
+func (s *Service) DeleteTusUpload(ctx context.Context, uploadID string) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	query := "DELETE FROM uploads WHERE id = $1 AND user_id = $2 AND storage = $3"
+	res, err := s.db.ExecContext(ctx, query, uploadID, uid, uploadStorageTus)
+	if err != nil {
+		return fmt.Errorf("could not delete tus upload: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUploadNotFound
+	}
+
+	os.Remove(tusPath(uploadID))
+	return nil
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/s3"
+	"github.com/djomlaa/socnet/internal/validation"
+	gonanoid "github.com/matoous/go-nanoid"
+)
+
+const (
+	// MaxDirectUploadBytes a media uploaded straight to object storage can take.
+	MaxDirectUploadBytes = 1 << 30
+	// UploadURLLifespan is how long a presigned upload URL can be used.
+	UploadURLLifespan = 15 * time.Minute
+	// UploadLifespan is how long after presigning an upload can be finalized.
+	UploadLifespan = 24 * time.Hour
+)
+
+var (
+	// ErrUploadsUnavailable used when no object storage is configured.
+	ErrUploadsUnavailable = errors.New("direct uploads unavailable")
+	// ErrUploadNotFound denotes an upload that was not found or expired
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrUploadIncomplete used when finalizing an upload whose object was not uploaded yet.
+	ErrUploadIncomplete = errors.New("upload incomplete")
+)
+
+// PresignUploadInput request
+type PresignUploadInput struct {
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+// PresignedUpload tells the client where to upload the media to.
+// The client must PUT it to the URL with the given headers,
+// then finalize the upload by its id.
+type PresignedUpload struct {
+	ID        string            `json:"id"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+func uploadKey(uploadID string) string {
+	return "uploads/" + uploadID
+}
+
+// PresignUpload lets the authenticated user upload large media straight to object storage.
+func (s *Service) PresignUpload(ctx context.Context, in PresignUploadInput) (PresignedUpload, error) {
+	var out PresignedUpload
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	if s.objects == nil {
+		return out, ErrUploadsUnavailable
+	}
+
+	var v validation.Validator
+	_, supported := mediaTypes[in.ContentType]
+	v.Check(supported, "contentType", "unsupported media type")
+	v.Check(in.Size > 0 && in.Size <= MaxDirectUploadBytes, "size", "out of range")
+	if err := v.Err(); err != nil {
+		return out, err
+	}
+
+	id, err := gonanoid.Nanoid()
+	if err != nil {
+		return out, fmt.Errorf("could not generate upload id: %v", err)
+	}
+
+	// Uploads of the user left unfinalized are forgotten here; the bucket
+	// lifecycle rules are expected to expire their objects.
+	query := "DELETE FROM uploads WHERE user_id = $1 AND storage = $2 AND expires_at < now()"
+	if _, err = s.db.ExecContext(ctx, query, uid, uploadStorageS3); err != nil {
+		return out, fmt.Errorf("could not delete expired uploads: %v", err)
+	}
+
+	now := time.Now()
+	query = "INSERT INTO uploads (id, user_id, content_type, size, expires_at) VALUES ($1, $2, $3, $4, $5)"
+	if _, err = s.db.ExecContext(ctx, query, id, uid, in.ContentType, in.Size, now.Add(UploadLifespan)); err != nil {
+		return out, fmt.Errorf("could not insert upload: %v", err)
+	}
+
+	out.ID = id
+	out.Method = "PUT"
+	out.URL = s.objects.PresignPut(uploadKey(id), in.ContentType, UploadURLLifespan, now)
+	out.Headers = map[string]string{"Content-Type": in.ContentType}
+	out.ExpiresAt = now.Add(UploadURLLifespan)
+	return out, nil
+}
+
+// FinalizeUpload verifies the media was fully uploaded, either to object storage
+// or through tus, and processes it like UploadMedia does, returning media to be
+// attached to a post later. The uploaded bytes are removed afterwards.
+func (s *Service) FinalizeUpload(ctx context.Context, uploadID string, in UploadMediaInput) (Media, error) {
+	var m Media
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return m, ErrUnauthenticated
+	}
+
+	if err := validateUploadMedia(&in); err != nil {
+		return m, err
+	}
+
+	var storage string
+	var size, offset int64
+	query := "SELECT storage, size, upload_offset FROM uploads WHERE id = $1 AND user_id = $2 AND expires_at > now()"
+	err := s.db.QueryRowContext(ctx, query, uploadID, uid).Scan(&storage, &size, &offset)
+	if err == sql.ErrNoRows {
+		return m, ErrUploadNotFound
+	}
+
+	if err != nil {
+		return m, fmt.Errorf("could not query select upload: %v", err)
+	}
+
+	var body io.ReadCloser
+	var remove func() error
+	if storage == uploadStorageTus {
+		if offset != size {
+			return m, ErrUploadIncomplete
+		}
+
+		if body, err = os.Open(tusPath(uploadID)); err != nil {
+			return m, fmt.Errorf("could not open tus upload file: %v", err)
+		}
+
+		remove = func() error { return os.Remove(tusPath(uploadID)) }
+	} else {
+		if s.objects == nil {
+			return m, ErrUploadsUnavailable
+		}
+
+		key := uploadKey(uploadID)
+		var objectSize int64
+		body, objectSize, err = s.objects.Get(ctx, key)
+		if err == s3.ErrNotFound {
+			return m, ErrUploadIncomplete
+		}
+
+		if err != nil {
+			return m, fmt.Errorf("could not get uploaded object: %v", err)
+		}
+
+		if objectSize != size {
+			body.Close()
+			var v validation.Validator
+			v.Check(false, "size", "uploaded size does not match")
+			return m, v.Err()
+		}
+
+		remove = func() error { return s.objects.Delete(ctx, key) }
+	}
+
+	defer body.Close()
+
+	m, err = s.storeMedia(ctx, uid, io.LimitReader(body, size), in)
+	if err != nil && err != ErrInfectedUpload && err != ErrUnsupportedMediaFormat {
+		return m, err
+	}
+
+	// Rejected uploads are removed as well, they can't be finalized again.
+	if _, derr := s.db.ExecContext(ctx, "DELETE FROM uploads WHERE id = $1", uploadID); derr != nil {
+		log.Printf("could not delete finalized upload: %v\n", derr)
+	}
+
+	if derr := remove(); derr != nil {
+		log.Printf("could not remove uploaded media: %v\n", derr)
+	}
+
+	return m, err
+}
@@ -1,21 +1,25 @@
 package service
 
 import (
+	"bufio"
 	"context"
 	"database/sql"
 	"fmt"
 	"github.com/disintegration/imaging"
+	"github.com/djomlaa/socnet/internal/validation"
 	gonanoid "github.com/matoous/go-nanoid"
-	"image"
 	"image/jpeg"
 	"image/png"
 	"io"
 	"log"
+	"net/http"
 	"os"
 	"path"
-	"regexp"
 	"strings"
+	"time"
 
+	"github.com/djomlaa/socnet/internal/mailer"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
@@ -24,18 +28,15 @@ const (
 	MaxAvatarBytes = 5 << 20
 )
 
+// birthdateLayout of the birthdates given at signup.
+const birthdateLayout = "2006-01-02"
+
 var (
-	reEmail    = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
-	reUsername = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{0,17}$`)
 	avatarsDir = path.Join("web", "static", "img", "avatars")
 )
 var (
 	// ErrUserNotFound used when the user not found on the db.
 	ErrUserNotFound = errors.New("user not found")
-	// ErrInvalidEmail used when the email is not valid.
-	ErrInvalidEmail = errors.New("invalid email")
-	// ErrInvalidUsername used when the username is not valid.
-	ErrInvalidUsername = errors.New("invalid username")
 	// ErrEmailTaken used when email already exists.
 	ErrEmailTaken = errors.New("email is taken")
 	// ErrUsernameTaken used when username already exists.
@@ -52,41 +53,78 @@ type User struct {
 	Email     string  `json:"email,omitempty"`
 	Username  string  `json:"username,omitempty"`
 	AvatarURL *string `json:"avatarUrl"`
+	Verified  bool    `json:"verified"`
 }
 
 // UserProfile model
 type UserProfile struct {
 	User
-	Email          string `json:"email,omitempty"`
-	FollowersCount int    `json:"followers_count"`
-	FolloweesCount int    `json:"followees_count"`
-	Me             bool   `json:"me,omitempty"`
-	Following      bool   `json:"following,omitempty"`
-	Followeed      bool   `json:"followeed,omitempty"`
+	Email          string   `json:"email,omitempty"`
+	FollowersCount int      `json:"followers_count"`
+	FolloweesCount int      `json:"followees_count"`
+	Me             bool     `json:"me,omitempty"`
+	Following      bool     `json:"following,omitempty"`
+	Followeed      bool     `json:"followeed,omitempty"`
+	Interests      []string `json:"interests,omitempty"`
+	// PostNotifications reports whether the authenticated user is notified of every new post.
+	PostNotifications bool `json:"postNotifications,omitempty"`
+	// Online reports whether the user has a live event stream open.
+	Online bool `json:"online,omitempty"`
+	// LastActive is LastActiveRecently or LastActiveToday, or empty when
+	// the user was last seen earlier or hides it.
+	LastActive string `json:"lastActive,omitempty"`
+	// FollowListsHidden reports the followers and followees are hidden from
+	// the authenticated user, whose counts are then zero.
+	FollowListsHidden bool `json:"followListsHidden,omitempty"`
+	// Reputation grows with received likes and followers and drops with
+	// posts queued for review. It is recomputed periodically.
+	Reputation int `json:"reputation"`
+	// PostsCount is only set on the profile of a single user.
+	PostsCount int `json:"posts_count,omitempty"`
+	// LastModified is when the profile last changed, for conditional requests.
+	// It is only set on the profile of a single user, for anonymous requests
+	// and the user themself, as changes to what it shows others about their
+	// relationship with the user aren't tracked.
+	LastModified time.Time `json:"-"`
 }
 
 // ToggleFollowOutput response
 type ToggleFollowOutput struct {
-	Following      bool `json:"following"`
-	FollowersCount int  `json:"followers_count"`
+	Following bool `json:"following"`
+	// FollowersCount of the followee, as projected into user_stats
+	// and adjusted by this toggle.
+	FollowersCount int `json:"followers_count"`
 }
 
-// CreateUser inserts a user into db
-func (s *Service) CreateUser(ctx context.Context, email, username string) error {
+// CreateUser inserts a user into db.
+// The birthdate is optional, formatted as 2006-01-02. It's used to gate NSFW posts.
+func (s *Service) CreateUser(ctx context.Context, email, username, birthdate string) error {
 
 	email = strings.TrimSpace(email)
+	username = validation.NormalizeUsername(username)
+	birthdate = strings.TrimSpace(birthdate)
 
-	if !reEmail.MatchString(email) {
-		return ErrInvalidEmail
+	var v validation.Validator
+	v.Email("email", email)
+	v.Username("username", username)
+	var bd *time.Time
+	if birthdate != "" {
+		t, err := time.Parse(birthdateLayout, birthdate)
+		v.Check(err == nil, "birthdate", "must be formatted as 2006-01-02")
+		v.Check(err != nil || (t.Year() >= 1900 && t.Before(time.Now())), "birthdate", "out of range")
+		bd = &t
+	}
+	if err := v.Err(); err != nil {
+		return err
 	}
 
-	username = strings.TrimSpace(username)
-	if !reUsername.MatchString(username) {
-		return ErrInvalidUsername
+	// Users of the enterprise identity provider are created on their first login.
+	if s.ssoRequired() {
+		return ErrSSORequired
 	}
 
-	query := "INSERT INTO users (email, username) VALUES ($1, $2)"
-	_, err := s.db.ExecContext(ctx, query, email, username)
+	query := "INSERT INTO users (email, username, username_skeleton, birthdate) VALUES ($1, $2, $3, $4)"
+	_, err := s.db.ExecContext(ctx, query, email, username, validation.UsernameSkeleton(username), bd)
 
 	unique := isUniqueViolation(err)
 
@@ -102,16 +140,17 @@ func (s *Service) CreateUser(ctx context.Context, email, username string) error
 		return fmt.Errorf("could not insert user: %v", err)
 	}
 
+	s.sendWelcomeMail(email, username, mailer.DefaultLocale)
+
 	return nil
 }
 
-//
 func (s *Service) userByID(ctx context.Context, id int64) (User, error) {
 	var u User
 	var avatar sql.NullString
 
-	query := "SELECT username, avatar FROM users WHERE id = $1"
-	err := s.db.QueryRowContext(ctx, query, id).Scan(&u.Username, &avatar)
+	query := "SELECT username, avatar, verified FROM users WHERE id = $1"
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&u.Username, &avatar, &u.Verified)
 	if err == sql.ErrNoRows {
 		return u, ErrUserNotFound
 	}
@@ -133,32 +172,57 @@ func (s *Service) User(ctx context.Context, username string) (UserProfile, error
 
 	var u UserProfile
 
-	username = strings.TrimSpace(username)
-	if !reUsername.MatchString(username) {
-		return u, ErrInvalidUsername
+	username = validation.NormalizeUsername(username)
+	var v validation.Validator
+	v.Username("username", username)
+	if err := v.Err(); err != nil {
+		return u, err
 	}
 
 	uid, auth := ctx.Value(KeyAuthUserID).(int64)
 
 	var avatar sql.NullString
 	args := []interface{}{username}
-	dest := []interface{}{&u.ID, &u.Email, &avatar, &u.FollowersCount, &u.FolloweesCount}
+	var lastModified time.Time
+	dest := []interface{}{&u.ID, &u.Email, &u.Username, &avatar, &u.Verified, &u.FollowListsHidden, &u.FollowersCount, &u.FolloweesCount,
+		&u.PostsCount, &u.Online, &u.LastActive, &u.Reputation, (*pq.StringArray)(&u.Interests), &lastModified}
 
-	query := "SELECT id, email, avatar, followers_count, followees_count "
+	visible := "users.follow_lists_visibility = '" + FollowListsEveryone + "'"
+	if auth {
+		visible = "(" + visible + " OR users.id = $2 OR (users.follow_lists_visibility = '" + FollowListsFollowers + "' " +
+			"AND followers.follower_id IS NOT NULL))"
+	}
+
+	query := "SELECT id, email, username, avatar, verified, NOT " + visible + " AS follow_lists_hidden, " +
+		"CASE WHEN " + visible + " THEN COALESCE(stats.followers_count, 0) ELSE 0 END AS followers_count, " +
+		"CASE WHEN " + visible + " THEN COALESCE(stats.followees_count, 0) ELSE 0 END AS followees_count, " +
+		"COALESCE(stats.posts_count, 0) AS posts_count, " +
+		"online_until > now() IS TRUE AS online, " +
+		"CASE WHEN NOT show_last_active THEN '' " +
+		"WHEN last_seen_at > now() - INTERVAL '1 hour' THEN '" + LastActiveRecently + "' " +
+		"WHEN last_seen_at > now() - INTERVAL '1 day' THEN '" + LastActiveToday + "' " +
+		"ELSE '' END AS last_active, reputation, " +
+		"ARRAY(SELECT interest FROM user_interests WHERE user_id = users.id ORDER BY interest) AS interests, " +
+		// Online and last active also change as time passes their thresholds.
+		"GREATEST(users.updated_at, stats.updated_at, " +
+		"CASE WHEN online_until <= now() THEN online_until END, " +
+		"CASE WHEN last_seen_at + INTERVAL '1 hour' <= now() THEN last_seen_at + INTERVAL '1 hour' END, " +
+		"CASE WHEN last_seen_at + INTERVAL '1 day' <= now() THEN last_seen_at + INTERVAL '1 day' END) AS last_modified "
 	if auth {
 		query += ", " +
 			"followers.follower_id IS NOT NULL as following, " +
-			"followees.followee_id IS NOT NULL as followeed "
-		dest = append(dest, &u.Following, &u.Followeed)
+			"followees.followee_id IS NOT NULL as followeed, " +
+			"EXISTS (SELECT 1 FROM post_subscriptions WHERE subscriber_id = $2 AND user_id = users.id) AS post_notifications "
+		dest = append(dest, &u.Following, &u.Followeed, &u.PostNotifications)
 	}
 
-	query += "FROM users "
+	query += "FROM users LEFT JOIN user_stats AS stats ON stats.user_id = users.id "
 	if auth {
 		query += "LEFT JOIN follows AS followers on followers.follower_id = $2 AND followers.followee_id = users.id " +
 			"LEFT JOIN follows AS followees on followees.follower_id = users.id AND followees.followee_id = $2 "
 		args = append(args, uid)
 	}
-	query += "WHERE username =$1"
+	query += "WHERE lower(username) = lower($1)"
 
 	err := s.db.QueryRowContext(ctx, query, args...).Scan(dest...)
 	if err == sql.ErrNoRows {
@@ -169,8 +233,10 @@ func (s *Service) User(ctx context.Context, username string) (UserProfile, error
 		return u, fmt.Errorf("could not query select user %v", err)
 	}
 
-	u.Username = username
 	u.Me = auth && uid == u.ID
+	if !auth || u.Me {
+		u.LastModified = lastModified
+	}
 	if !u.Me {
 		u.ID = 0
 		u.Email = ""
@@ -183,16 +249,18 @@ func (s *Service) User(ctx context.Context, username string) (UserProfile, error
 	return u, nil
 }
 
-// Users in ascending order with forward pagination and filter by username
+// Users in ascending order with forward pagination and filter by username.
+// A verified:true term in the search only matches verified users.
 func (s *Service) Users(ctx context.Context, search string, first int, after string) ([]UserProfile, error) {
 
 	uid, auth := ctx.Value(KeyAuthUserID).(int64)
-	first = normalizePageSize(first)
-	search = strings.TrimSpace(search)
+	first = validation.PageSize(first)
+	search, verified := parseVerifiedFilter(search)
 	after = strings.TrimSpace(after)
 
 	query, args, err := buildQuery(`
-		SELECT id, email, username, avatar, followers_count, followees_count
+		SELECT id, email, username, avatar, verified, {{template "followCounts" .}}
+		, online_until > now() IS TRUE AS online
 		{{if .auth}}
 		, followers.follower_id IS NOT NULL AS following
 		, followees.followee_id IS NOT NULL AS followeed
@@ -202,17 +270,18 @@ func (s *Service) Users(ctx context.Context, search string, first int, after str
 		LEFT JOIN follows AS followers ON followers.follower_id = @uid AND followers.followee_id = users.id
 		LEFT JOIN follows AS followees ON followees.follower_id = users.id AND followees.followee_id = @uid
 		{{end}}
-		{{if or .search .after}} WHERE {{end}}
-		{{if .search}}username LIKE '%' || @search || '%'{{end}}
-		{{if and .search .after}} AND {{end}}
-		{{if .after}}username > @after{{end}}
+		WHERE true
+		{{if .search}}AND username ILIKE '%' || @search || '%'{{end}}
+		{{if .after}}AND username > @after{{end}}
+		{{if .verified}}AND verified{{end}}
 		ORDER BY username ASC
 		LIMIT @first`, map[string]interface{}{
-		"auth":   auth,
-		"uid":    uid,
-		"search": search,
-		"first":  first,
-		"after":  after,
+		"auth":     auth,
+		"uid":      uid,
+		"search":   search,
+		"first":    first,
+		"after":    after,
+		"verified": verified,
 	})
 
 	if err != nil {
@@ -232,7 +301,7 @@ func (s *Service) Users(ctx context.Context, search string, first int, after str
 	for rows.Next() {
 		var u UserProfile
 		var avatar sql.NullString
-		dest := []interface{}{&u.ID, &u.Email, &u.Username, &avatar, &u.FollowersCount, &u.FolloweesCount}
+		dest := []interface{}{&u.ID, &u.Email, &u.Username, &avatar, &u.Verified, &u.FollowersCount, &u.FolloweesCount, &u.Online}
 		if auth {
 			dest = append(dest, &u.Following, &u.Followeed)
 		}
@@ -266,16 +335,35 @@ func (s *Service) UpdateAvatar(ctx context.Context, r io.Reader) (string, error)
 		return "", ErrUnauthenticated
 	}
 
-	r = io.LimitReader(r, MaxAvatarBytes)
-	img, format, err := image.Decode(r)
+	r, done, err := s.scanUpload(ctx, uid, io.LimitReader(r, MaxAvatarBytes), "avatar")
 	if err != nil {
+		return "", err
+	}
+
+	defer done()
+
+	br := bufio.NewReaderSize(r, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF {
 		return "", fmt.Errorf("could not read avatar: %v", err)
 	}
 
-	if format != "png" && format != "jpeg" {
+	var format string
+	switch http.DetectContentType(head) {
+	case "image/png":
+		format = "png"
+	case "image/jpeg":
+		format = "jpeg"
+	default:
 		return "", ErrUnsupportedAvatarFormat
 	}
 
+	// Decoding leaves the EXIF metadata behind, orientation aside.
+	img, err := imaging.Decode(br, imaging.AutoOrientation(true))
+	if err != nil {
+		return "", fmt.Errorf("could not read avatar: %v", err)
+	}
+
 	avatar, err := gonanoid.Nanoid()
 	if err != nil {
 		return "", fmt.Errorf("could not generate avatar filename: %v", err)
@@ -292,6 +380,19 @@ func (s *Service) UpdateAvatar(ctx context.Context, r io.Reader) (string, error)
 	if err != nil {
 		return "", fmt.Errorf("could not create avatar file: %v", err)
 	}
+
+	// The new avatar file is only kept once the user points to it.
+	var committed bool
+	defer func() {
+		if committed {
+			return
+		}
+
+		if err := os.Remove(avatarPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("could not remove uncommitted avatar file: %v\n", err)
+		}
+	}()
+
 	defer f.Close()
 
 	img = imaging.Fill(img, 400, 400, imaging.Center, imaging.CatmullRom)
@@ -305,21 +406,47 @@ func (s *Service) UpdateAvatar(ctx context.Context, r io.Reader) (string, error)
 		return "", fmt.Errorf("could not write avatar to disk: %v", err)
 	}
 
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	// Locking the user serializes concurrent updates of their avatar,
+	// so each one replaces, and removes, the avatar set by the previous.
+	var username string
 	var oldAvatar sql.NullString
-	if err = s.db.QueryRowContext(ctx, `UPDATE users SET avatar = $1 WHERE id = $2
-									RETURNING (SELECT avatar FROM users WHERE id = $2) AS old_avatar`, avatar, uid).Scan(&oldAvatar); err != nil {
-		defer os.Remove(avatarPath)
+	query := "SELECT username, avatar FROM users WHERE id = $1 FOR UPDATE"
+	if err = tx.QueryRowContext(ctx, query, uid).Scan(&username, &oldAvatar); err != nil {
+		return "", fmt.Errorf("could not query select user avatar: %v", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE users SET avatar = $1 WHERE id = $2", avatar, uid); err != nil {
 		return "", fmt.Errorf("could not update avatar: %v", err)
 	}
 
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("could not commit avatar update: %v", err)
+	}
+
+	committed = true
+
+	paths := profilePaths(username)
 	if oldAvatar.Valid {
-		defer os.Remove(path.Join(avatarsDir, oldAvatar.String))
+		if err = os.Remove(path.Join(avatarsDir, oldAvatar.String)); err != nil && !os.IsNotExist(err) {
+			log.Printf("could not remove old avatar file: %v\n", err)
+		}
+		paths = append(paths, "/img/avatars/"+oldAvatar.String)
 	}
 
+	s.purge(paths...)
+
 	return s.origin + "/img/avatars/" + avatar, nil
 }
 
-// ToggleFollow between two users
+// ToggleFollow between two users.
+// Following fails with ErrRateLimited past the follow limits.
 func (s *Service) ToggleFollow(ctx context.Context, username string) (ToggleFollowOutput, error) {
 	var out ToggleFollowOutput
 
@@ -328,9 +455,11 @@ func (s *Service) ToggleFollow(ctx context.Context, username string) (ToggleFoll
 		return out, ErrUnauthenticated
 	}
 
-	username = strings.TrimSpace(username)
-	if !reUsername.MatchString(username) {
-		return out, ErrInvalidUsername
+	username = validation.NormalizeUsername(username)
+	var v validation.Validator
+	v.Username("username", username)
+	if err := v.Err(); err != nil {
+		return out, err
 	}
 
 	tx, err := s.db.BeginTx(ctx, nil)
@@ -341,8 +470,9 @@ func (s *Service) ToggleFollow(ctx context.Context, username string) (ToggleFoll
 	defer tx.Rollback()
 
 	var followeeID int64
-	query := "SELECT id FROM users WHERE username = $1"
-	err = tx.QueryRowContext(ctx, query, username).Scan(&followeeID)
+	var followListsVisibility string
+	query := "SELECT id, follow_lists_visibility FROM users WHERE lower(username) = lower($1)"
+	err = tx.QueryRowContext(ctx, query, username).Scan(&followeeID, &followListsVisibility)
 	if err == sql.ErrNoRows {
 		return out, ErrUserNotFound
 	}
@@ -358,38 +488,53 @@ func (s *Service) ToggleFollow(ctx context.Context, username string) (ToggleFoll
 	query = "SELECT EXISTS (SELECT 1 FROM follows WHERE follower_id = $1 AND followee_id = $2)"
 	err = tx.QueryRowContext(ctx, query, followerID, followeeID).Scan(&out.Following)
 	if err != nil {
-		return out, fmt.Errorf("could not query select existence of follow %v", err)
+		return out, fmt.Errorf("could not query select existence of follow: %v", err)
 	}
 
+	// The read model lags behind, so the count is adjusted by this toggle.
+	query = "SELECT COALESCE((SELECT followers_count FROM user_stats WHERE user_id = $1), 0)"
+	if err = tx.QueryRowContext(ctx, query, followeeID).Scan(&out.FollowersCount); err != nil {
+		return out, fmt.Errorf("could not query select followee followers count: %v", err)
+	}
+
+	var e Event
 	if out.Following {
 		query = "DELETE FROM follows WHERE follower_id =$1 AND followee_id =$2"
-		if _, err = tx.ExecContext(ctx, query, followerID, followeeID); err != nil {
+		res, err := tx.ExecContext(ctx, query, followerID, followeeID)
+		if err != nil {
 			return out, fmt.Errorf("could not delete follow: %v", err)
 		}
 
-		query = "UPDATE users SET followees_count = followees_count - 1 WHERE id = $1"
-		if _, err = tx.ExecContext(ctx, query, followerID); err != nil {
-			return out, fmt.Errorf("could not update follower followees count (-): %v", err)
+		query = "DELETE FROM post_subscriptions WHERE subscriber_id = $1 AND user_id = $2"
+		if _, err = tx.ExecContext(ctx, query, followerID, followeeID); err != nil {
+			return out, fmt.Errorf("could not delete post subscription: %v", err)
+		}
+
+		// Unless a concurrent toggle deleted it first.
+		if n, _ := res.RowsAffected(); n != 0 {
+			e = UserUnfollowed{FollowerID: followerID, FolloweeID: followeeID}
 		}
 
-		query = "UPDATE users SET followers_count = followers_count - 1 WHERE id = $1 RETURNING followers_count"
-		if err = tx.QueryRowContext(ctx, query, followeeID).Scan(&out.FollowersCount); err != nil {
-			return out, fmt.Errorf("could not update followee followers count (-): %v", err)
+		if out.FollowersCount > 0 {
+			out.FollowersCount--
 		}
 	} else {
+		if err = s.checkFollowRate(ctx, tx, followerID); err != nil {
+			return out, err
+		}
+
 		query = "INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2)"
 		if _, err = tx.ExecContext(ctx, query, followerID, followeeID); err != nil {
 			return out, fmt.Errorf("could not insert follow: %v", err)
 		}
 
-		query = "UPDATE users SET followees_count = followees_count  + 1 WHERE id = $1"
-		if _, err = tx.ExecContext(ctx, query, followerID); err != nil {
-			return out, fmt.Errorf("could not update follower followees count (+): %v", err)
-		}
+		e = UserFollowed{FollowerID: followerID, FolloweeID: followeeID}
+		out.FollowersCount++
+	}
 
-		query = "UPDATE users SET followers_count = followers_count + 1 WHERE id = $1 RETURNING followers_count"
-		if err = tx.QueryRowContext(ctx, query, followeeID).Scan(&out.FollowersCount); err != nil {
-			return out, fmt.Errorf("could not update followee followers count (+) %v", err)
+	if e != nil {
+		if err = s.recordEvent(ctx, tx, e); err != nil {
+			return out, err
 		}
 	}
 
@@ -399,26 +544,108 @@ func (s *Service) ToggleFollow(ctx context.Context, username string) (ToggleFoll
 
 	out.Following = !out.Following
 
-	if out.Following {
-		go s.notifyFollow(followerID, followeeID)
+	// Zeroed when hidden, as in profiles, now that the toggle is done.
+	if followListsVisibility != FollowListsEveryone && (followListsVisibility != FollowListsFollowers || !out.Following) {
+		out.FollowersCount = 0
+	}
+
+	if e != nil {
+		s.publish(e)
 	}
 
 	return out, nil
 }
 
+// follow makes followerID follow the given user, reporting false when already following.
+// Follows made on behalf of the user, like imported ones, count against the
+// same limits as the others.
+func (s *Service) follow(ctx context.Context, followerID int64, username string) (bool, error) {
+	var v validation.Validator
+	v.Username("username", username)
+	if err := v.Err(); err != nil {
+		return false, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	var followeeID int64
+	query := "SELECT id FROM users WHERE lower(username) = lower($1)"
+	err = tx.QueryRowContext(ctx, query, username).Scan(&followeeID)
+	if err == sql.ErrNoRows {
+		return false, ErrUserNotFound
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("could not query select user id from followee username %v", err)
+	}
+
+	if followeeID == followerID {
+		return false, ErrForbiddenFollow
+	}
+
+	var exists bool
+	query = "SELECT EXISTS (SELECT 1 FROM follows WHERE follower_id = $1 AND followee_id = $2)"
+	if err = tx.QueryRowContext(ctx, query, followerID, followeeID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("could not query select existence of follow: %v", err)
+	}
+
+	if exists {
+		return false, nil
+	}
+
+	if err = s.checkFollowRate(ctx, tx, followerID); err != nil {
+		return false, err
+	}
+
+	query = "INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	res, err := tx.ExecContext(ctx, query, followerID, followeeID)
+	if err != nil {
+		return false, fmt.Errorf("could not insert follow: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	followed := UserFollowed{FollowerID: followerID, FolloweeID: followeeID}
+	if err = s.recordEvent(ctx, tx, followed); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("could not commit follow: %v", err)
+	}
+
+	s.publish(followed)
+
+	return true, nil
+}
+
 // Followers in ascending order with forward pagination and filter by username
 func (s *Service) Followers(ctx context.Context, username string, first int, after string) ([]UserProfile, error) {
 
 	uid, auth := ctx.Value(KeyAuthUserID).(int64)
-	first = normalizePageSize(first)
-	username = strings.TrimSpace(username)
-	if !reUsername.MatchString(username) {
-		return nil, ErrInvalidUsername
+	first = validation.PageSize(first)
+	username = validation.NormalizeUsername(username)
+	var v validation.Validator
+	v.Username("username", username)
+	if err := v.Err(); err != nil {
+		return nil, err
 	}
 	after = strings.TrimSpace(after)
 
+	if err := s.checkFollowListsVisible(ctx, username); err != nil {
+		return nil, err
+	}
+
 	query, args, err := buildQuery(`
-		SELECT id, email, username, avatar, followers_count, followees_count
+		SELECT id, email, username, avatar, verified, {{template "followCounts" .}}
+		, online_until > now() IS TRUE AS online
 		{{if .auth}}
 		, followers.follower_id IS NOT NULL AS following
 		, followees.followee_id IS NOT NULL AS followeed
@@ -429,7 +656,7 @@ func (s *Service) Followers(ctx context.Context, username string, first int, aft
 		LEFT JOIN follows AS followers ON followers.follower_id = @uid AND followers.followee_id = users.id
 		LEFT JOIN follows AS followees ON followees.follower_id = users.id AND followees.followee_id = @uid
 		{{end}}
-		WHERE follows.followee_id = (SELECT id FROM users WHERE username = @username)
+		WHERE follows.followee_id = (SELECT id FROM users WHERE lower(username) = lower(@username))
 		{{if .after}} AND username > @after{{end}}
 		ORDER BY username ASC
 		LIMIT @first`, map[string]interface{}{
@@ -456,7 +683,7 @@ func (s *Service) Followers(ctx context.Context, username string, first int, aft
 	uu := make([]UserProfile, 0, first)
 	for rows.Next() {
 		var u UserProfile
-		dest := []interface{}{&u.ID, &u.Email, &u.Username, &avatar, &u.FollowersCount, &u.FolloweesCount}
+		dest := []interface{}{&u.ID, &u.Email, &u.Username, &avatar, &u.Verified, &u.FollowersCount, &u.FolloweesCount, &u.Online}
 		if auth {
 			dest = append(dest, &u.Following, &u.Followeed)
 		}
@@ -486,15 +713,22 @@ func (s *Service) Followers(ctx context.Context, username string, first int, aft
 func (s *Service) Followees(ctx context.Context, username string, first int, after string) ([]UserProfile, error) {
 
 	uid, auth := ctx.Value(KeyAuthUserID).(int64)
-	first = normalizePageSize(first)
-	username = strings.TrimSpace(username)
-	if !reUsername.MatchString(username) {
-		return nil, ErrInvalidUsername
+	first = validation.PageSize(first)
+	username = validation.NormalizeUsername(username)
+	var v validation.Validator
+	v.Username("username", username)
+	if err := v.Err(); err != nil {
+		return nil, err
 	}
 	after = strings.TrimSpace(after)
 
+	if err := s.checkFollowListsVisible(ctx, username); err != nil {
+		return nil, err
+	}
+
 	query, args, err := buildQuery(`
-		SELECT id, email, username, avatar, followers_count, followees_count
+		SELECT id, email, username, avatar, verified, {{template "followCounts" .}}
+		, online_until > now() IS TRUE AS online
 		{{if .auth}}
 		, followers.follower_id IS NOT NULL AS following
 		, followees.followee_id IS NOT NULL AS followeed
@@ -505,7 +739,7 @@ func (s *Service) Followees(ctx context.Context, username string, first int, aft
 		LEFT JOIN follows AS followers ON followers.follower_id = @uid AND followers.followee_id = users.id
 		LEFT JOIN follows AS followees ON followees.follower_id = users.id AND followees.followee_id = @uid
 		{{end}}
-		WHERE follows.follower_id = (SELECT id FROM users WHERE username = @username)
+		WHERE follows.follower_id = (SELECT id FROM users WHERE lower(username) = lower(@username))
 		{{if .after}} AND username > @after{{end}}
 		ORDER BY username ASC
 		LIMIT @first`, map[string]interface{}{
@@ -533,7 +767,7 @@ func (s *Service) Followees(ctx context.Context, username string, first int, aft
 	uu := make([]UserProfile, 0, first)
 	for rows.Next() {
 		var u UserProfile
-		dest := []interface{}{&u.ID, &u.Email, &u.Username, &avatar, &u.FollowersCount, &u.FolloweesCount}
+		dest := []interface{}{&u.ID, &u.Email, &u.Username, &avatar, &u.Verified, &u.FollowersCount, &u.FolloweesCount, &u.Online}
 		if auth {
 			dest = append(dest, &u.Following, &u.Followeed)
 		}
@@ -558,3 +792,20 @@ func (s *Service) Followees(ctx context.Context, username string, first int, aft
 
 	return uu, nil
 }
+
+// ReindexSearch rebuilds the indexes backing the users and posts search.
+func (s *Service) ReindexSearch(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, "REINDEX INDEX users_username_trgm"); err != nil {
+		return fmt.Errorf("could not reindex users search: %v", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, "REINDEX INDEX posts_content_trgm"); err != nil {
+		return fmt.Errorf("could not reindex posts search: %v", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, "ANALYZE users, posts"); err != nil {
+		return fmt.Errorf("could not analyze users and posts: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// UserReview is a user queued for moderator review, like repeat follow abusers.
+type UserReview struct {
+	User      User      `json:"user"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// UserReviews pending, oldest first. Admin only.
+func (s *Service) UserReviews(ctx context.Context) ([]UserReview, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT u.id, u.username, u.avatar, u.verified, r.reason, r.created_at
+		FROM user_reviews r
+		INNER JOIN users u ON r.user_id = u.id
+		WHERE r.resolved_at IS NULL
+		ORDER BY r.created_at ASC`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select user reviews: %v", err)
+	}
+
+	defer rows.Close()
+
+	rr := []UserReview{}
+	for rows.Next() {
+		var r UserReview
+		var avatar sql.NullString
+		if err = rows.Scan(&r.User.ID, &r.User.Username, &avatar, &r.User.Verified, &r.Reason, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan user review: %v", err)
+		}
+
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			r.User.AvatarURL = &avatarURL
+		}
+
+		rr = append(rr, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate user review rows: %v", err)
+	}
+
+	return rr, nil
+}
+
+// ResolveUserReview removes a user from the review queue. Admin only.
+func (s *Service) ResolveUserReview(ctx context.Context, username string) error {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return err
+	}
+
+	username = validation.NormalizeUsername(username)
+	var v validation.Validator
+	v.Username("username", username)
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	query := `UPDATE user_reviews SET resolved_at = now()
+		WHERE user_id = (SELECT id FROM users WHERE lower(username) = lower($1)) AND resolved_at IS NULL`
+	res, err := s.db.ExecContext(ctx, query, username)
+	if err != nil {
+		return fmt.Errorf("could not update user review: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// UserStatsInterval is how often the user_stats read model catches up with
+// the events journal. Counts lag behind by up to this once the events commit.
+const UserStatsInterval = 5 * time.Second
+
+// userStatsProjection names the checkpoint of the user_stats read model.
+const userStatsProjection = "user_stats"
+
+// userStatsEvents change the counts of the user_stats read model.
+var userStatsEvents = []string{EventPostCreated, EventPostDeleted, EventUserFollowed, EventUserUnfollowed}
+
+type userStatsDelta struct {
+	followers int
+	followees int
+	posts     int
+}
+
+// ProjectUserStats keeps the user_stats read model up to date with the
+// events journal until ctx is done. The followers, followees and posts
+// counts of each user are written once per pass however many events
+// changed them, so a user gaining many followers at once doesn't make
+// every follow wait on their row.
+func (s *Service) ProjectUserStats(ctx context.Context) {
+	ticker := time.NewTicker(UserStatsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.projectUserStats(ctx); err != nil {
+				log.Printf("could not project user stats: %v\n", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// projectUserStats applies the events journaled since the checkpoint.
+// Only one instance projects at a time; the others skip the pass.
+func (s *Service) projectUserStats(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	var from journalPosition
+	query := "SELECT last_event_id, last_snapshot::text FROM projections WHERE name = $1 FOR UPDATE SKIP LOCKED"
+	err = tx.QueryRowContext(ctx, query, userStatsProjection).Scan(&from.eventID, &from.snapshot)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not query select user stats checkpoint: %v", err)
+	}
+
+	deltas := map[int64]*userStatsDelta{}
+	delta := func(uid int64) *userStatsDelta {
+		if deltas[uid] == nil {
+			deltas[uid] = &userStatsDelta{}
+		}
+		return deltas[uid]
+	}
+
+	var replayed int
+	to, err := s.replayEvents(ctx, userStatsEvents, from, func(ctx context.Context, e Event) {
+		replayed++
+		switch e := e.(type) {
+		case PostCreated:
+			delta(e.Post.UserID).posts++
+		case PostDeleted:
+			delta(e.UserID).posts--
+		case UserFollowed:
+			delta(e.FollowerID).followees++
+			delta(e.FolloweeID).followers++
+		case UserUnfollowed:
+			delta(e.FollowerID).followees--
+			delta(e.FolloweeID).followers--
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if replayed == 0 {
+		return nil
+	}
+
+	var uids []int64
+	var followers, followees, posts []int64
+	for uid, d := range deltas {
+		uids = append(uids, uid)
+		followers = append(followers, int64(d.followers))
+		followees = append(followees, int64(d.followees))
+		posts = append(posts, int64(d.posts))
+	}
+
+	// Users deleted since are left out.
+	query = `INSERT INTO user_stats (user_id, followers_count, followees_count, posts_count)
+		SELECT d.user_id, GREATEST(d.followers, 0), GREATEST(d.followees, 0), GREATEST(d.posts, 0)
+		FROM unnest($1::INT[], $2::INT[], $3::INT[], $4::INT[]) AS d(user_id, followers, followees, posts)
+		WHERE EXISTS (SELECT 1 FROM users WHERE id = d.user_id)
+		ON CONFLICT (user_id) DO UPDATE SET
+			followers_count = GREATEST(user_stats.followers_count + EXCLUDED.followers_count, 0),
+			followees_count = GREATEST(user_stats.followees_count + EXCLUDED.followees_count, 0),
+			posts_count = GREATEST(user_stats.posts_count + EXCLUDED.posts_count, 0)`
+	if len(uids) != 0 {
+		if _, err = tx.ExecContext(ctx, query, pq.Array(uids), pq.Array(followers), pq.Array(followees), pq.Array(posts)); err != nil {
+			return fmt.Errorf("could not upsert user stats: %v", err)
+		}
+	}
+
+	query = "UPDATE projections SET last_event_id = $1, last_snapshot = $2::pg_snapshot, updated_at = now() WHERE name = $3"
+	if _, err = tx.ExecContext(ctx, query, to.eventID, to.snapshot, userStatsProjection); err != nil {
+		return fmt.Errorf("could not update user stats checkpoint: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit user stats: %v", err)
+	}
+
+	return nil
+}
+
+// RebuildUserStats recounts the user_stats read model from the follows and posts
+// and moves its checkpoint to the end of the events journal. It returns how many
+// users were recounted. Run it to repair the counts or after restoring a backup.
+func (s *Service) RebuildUserStats(ctx context.Context) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	// Waits for a projection pass in progress, and holds off the next ones.
+	query := "SELECT 1 FROM projections WHERE name = $1 FOR UPDATE"
+	if _, err = tx.ExecContext(ctx, query, userStatsProjection); err != nil {
+		return 0, fmt.Errorf("could not lock user stats checkpoint: %v", err)
+	}
+
+	// A single statement, so the checkpoint is the snapshot the counts were taken in.
+	var n int64
+	query = `WITH rebuilt AS (
+			INSERT INTO user_stats (user_id, followers_count, followees_count, posts_count)
+			SELECT u.id,
+				(SELECT count(*) FROM follows WHERE followee_id = u.id),
+				(SELECT count(*) FROM follows WHERE follower_id = u.id),
+				(SELECT count(*) FROM posts WHERE user_id = u.id)
+			FROM users u
+			ON CONFLICT (user_id) DO UPDATE SET
+				followers_count = EXCLUDED.followers_count,
+				followees_count = EXCLUDED.followees_count,
+				posts_count = EXCLUDED.posts_count
+			RETURNING 1
+		), checkpoint AS (
+			UPDATE projections SET
+				last_event_id = (SELECT COALESCE(max(id), 0) FROM events),
+				last_snapshot = pg_current_snapshot(),
+				updated_at = now()
+			WHERE name = $1
+		)
+		SELECT count(*) FROM rebuilt`
+	if err = tx.QueryRowContext(ctx, query, userStatsProjection).Scan(&n); err != nil {
+		return 0, fmt.Errorf("could not rebuild user stats: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not commit user stats rebuild: %v", err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,189 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/djomlaa/socnet/internal/testutil"
+)
+
+// projectionTimeout bounds how long the user_stats read model takes to catch
+// up: events settle for 10 seconds before they are projected.
+const projectionTimeout = 30 * time.Second
+
+func TestToggleFollowCounts(t *testing.T) {
+	s, db := testutil.NewService(t)
+
+	alice := testutil.CreateUser(t, db, "alice")
+	testutil.CreateUser(t, db, "bob")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.ProjectUserStats(ctx)
+
+	aliceCtx := testutil.AuthContext(alice)
+	out, err := s.ToggleFollow(aliceCtx, "bob")
+	if err != nil {
+		t.Fatalf("could not follow: %v", err)
+	}
+
+	if !out.Following || out.FollowersCount != 1 {
+		t.Fatalf("got %+v after following, want following with 1 follower", out)
+	}
+
+	expectCounts := func(followers, followees int) {
+		t.Helper()
+
+		testutil.Eventually(t, projectionTimeout, func() error {
+			bob, err := s.User(aliceCtx, "bob")
+			if err != nil {
+				return err
+			}
+
+			me, err := s.User(aliceCtx, "alice")
+			if err != nil {
+				return err
+			}
+
+			if bob.FollowersCount != followers || me.FolloweesCount != followees {
+				return fmt.Errorf("bob has %d followers and alice %d followees, want %d and %d",
+					bob.FollowersCount, me.FolloweesCount, followers, followees)
+			}
+
+			if bob.Following != (followers == 1) {
+				return fmt.Errorf("alice following bob is %v", bob.Following)
+			}
+
+			return nil
+		})
+	}
+
+	expectCounts(1, 1)
+
+	out, err = s.ToggleFollow(aliceCtx, "bob")
+	if err != nil {
+		t.Fatalf("could not unfollow: %v", err)
+	}
+
+	if out.Following || out.FollowersCount != 0 {
+		t.Fatalf("got %+v after unfollowing, want not following with no followers", out)
+	}
+
+	expectCounts(0, 0)
+}
+
+func TestToggleFollowErrors(t *testing.T) {
+	s, db := testutil.NewService(t)
+
+	alice := testutil.CreateUser(t, db, "alice")
+	testutil.CreateUser(t, db, "bob")
+
+	if _, err := s.ToggleFollow(context.Background(), "bob"); err != service.ErrUnauthenticated {
+		t.Fatalf("got %v, want ErrUnauthenticated", err)
+	}
+
+	aliceCtx := testutil.AuthContext(alice)
+	if _, err := s.ToggleFollow(aliceCtx, "alice"); err != service.ErrForbiddenFollow {
+		t.Fatalf("got %v, want ErrForbiddenFollow", err)
+	}
+
+	if _, err := s.ToggleFollow(aliceCtx, "nobody"); err != service.ErrUserNotFound {
+		t.Fatalf("got %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestToggleFollowHiddenCount(t *testing.T) {
+	s, db := testutil.NewService(t)
+
+	alice := testutil.CreateUser(t, db, "alice")
+	testutil.CreateUser(t, db, "bob")
+	testutil.CreateUser(t, db, "carol")
+
+	query := "UPDATE users SET follow_lists_visibility = $1 WHERE username = $2"
+	for username, visibility := range map[string]string{"bob": service.FollowListsNobody, "carol": service.FollowListsFollowers} {
+		if _, err := db.Exec(query, visibility, username); err != nil {
+			t.Fatalf("could not hide follow lists of %s: %v", username, err)
+		}
+	}
+
+	aliceCtx := testutil.AuthContext(alice)
+	out, err := s.ToggleFollow(aliceCtx, "bob")
+	if err != nil {
+		t.Fatalf("could not follow bob: %v", err)
+	}
+
+	if !out.Following || out.FollowersCount != 0 {
+		t.Fatalf("got %+v after following bob, want following with the count hidden", out)
+	}
+
+	out, err = s.ToggleFollow(aliceCtx, "carol")
+	if err != nil {
+		t.Fatalf("could not follow carol: %v", err)
+	}
+
+	if !out.Following || out.FollowersCount != 1 {
+		t.Fatalf("got %+v after following carol, want following with 1 follower", out)
+	}
+
+	out, err = s.ToggleFollow(aliceCtx, "carol")
+	if err != nil {
+		t.Fatalf("could not unfollow carol: %v", err)
+	}
+
+	if out.Following || out.FollowersCount != 0 {
+		t.Fatalf("got %+v after unfollowing carol, want not following with the count hidden", out)
+	}
+}
+
+func TestFollowersPagination(t *testing.T) {
+	s, db := testutil.NewService(t)
+
+	star := testutil.CreateUser(t, db, "star")
+	for i := 0; i < 3; i++ {
+		fan := testutil.CreateUser(t, db, fmt.Sprintf("fan%d", i))
+		testutil.Follow(t, db, fan, star)
+	}
+
+	ctx := context.Background()
+	seen := map[string]bool{}
+	var after string
+	for page := 0; ; page++ {
+		uu, err := s.Followers(ctx, "star", 2, after)
+		if err != nil {
+			t.Fatalf("could not get followers page %d: %v", page, err)
+		}
+
+		if len(uu) > 2 {
+			t.Fatalf("page %d has %d followers, want at most 2", page, len(uu))
+		}
+
+		if len(uu) == 0 {
+			break
+		}
+
+		for _, u := range uu {
+			if seen[u.Username] {
+				t.Fatalf("page %d repeats follower %s", page, u.Username)
+			}
+			seen[u.Username] = true
+		}
+
+		after = uu[len(uu)-1].Username
+	}
+
+	if len(seen) != 3 {
+		t.Fatalf("paged %d followers, want 3", len(seen))
+	}
+
+	uu, err := s.Followees(ctx, "star", 0, "")
+	if err != nil {
+		t.Fatalf("could not get followees: %v", err)
+	}
+
+	if len(uu) != 0 {
+		t.Fatalf("got %d followees of a user following nobody", len(uu))
+	}
+}
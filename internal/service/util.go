@@ -9,14 +9,41 @@ import (
 	"github.com/lib/pq"
 )
 
-const (
-	minPageSize     = 1
-	defaultPageSize = 10
-	maxPageSize     = 99
-)
-
 var queriesCache = make(map[string]*template.Template)
 
+// queryPartials are shared by all queries and included with {{template "name" .}}.
+//
+// nsfwFilter hides NSFW posts of others from a viewer who chose to hide them
+// or is too young to see them. It expects the auth, uid and nsfwBornBy keys
+// and a posts table aliased p.
+//
+// followListsVisible tells whether the viewer can see the followers and followees
+// of a user, and followCounts selects their counts, zeroed when hidden.
+// likesVisible tells whether the viewer can see the posts a user liked.
+// They expect the auth and uid keys and a users table not aliased.
+const queryPartials = `{{define "nsfwFilter"}}{{if .auth}}
+	AND (NOT p.nsfw OR p.user_id = @uid OR NOT EXISTS (
+		SELECT 1 FROM users WHERE users.id = @uid
+		AND (users.nsfw_preference = 'hide' OR users.birthdate > @nsfwBornBy)
+	))
+{{end}}{{end}}
+{{define "followListsVisible"}}(users.follow_lists_visibility = 'everyone'{{if .auth}}
+	OR users.id = @uid
+	OR (users.follow_lists_visibility = 'followers' AND EXISTS (
+		SELECT 1 FROM follows vf WHERE vf.follower_id = @uid AND vf.followee_id = users.id
+	)){{end}}){{end}}
+{{define "likesVisible"}}(users.likes_visibility = 'everyone'{{if .auth}}
+	OR users.id = @uid
+	OR (users.likes_visibility = 'followers' AND EXISTS (
+		SELECT 1 FROM follows vf WHERE vf.follower_id = @uid AND vf.followee_id = users.id
+	)){{end}}){{end}}
+{{define "followCounts"}}
+	CASE WHEN {{template "followListsVisible" .}}
+		THEN COALESCE((SELECT followers_count FROM user_stats WHERE user_id = users.id), 0) ELSE 0 END AS followers_count,
+	CASE WHEN {{template "followListsVisible" .}}
+		THEN COALESCE((SELECT followees_count FROM user_stats WHERE user_id = users.id), 0) ELSE 0 END AS followees_count
+{{end}}`
+
 func isUniqueViolation(err error) bool {
 	pqerr, ok := err.(*pq.Error)
 	return ok && pqerr.Code == "23505"
@@ -31,7 +58,7 @@ func buildQuery(text string, data map[string]interface{}) (string, []interface{}
 	t, ok := queriesCache[text]
 	if !ok {
 		var err error
-		t, err = template.New("query").Parse(text)
+		t, err = template.New("query").Parse(queryPartials + text)
 		if err != nil {
 			return "", nil, fmt.Errorf("could not parse sql query template: %v", err)
 		}
@@ -56,19 +83,3 @@ func buildQuery(text string, data map[string]interface{}) (string, []interface{}
 
 	return query, args, nil
 }
-
-func normalizePageSize(i int) int {
-	if i == 0 {
-		return defaultPageSize
-	}
-
-	if i < minPageSize {
-		return minPageSize
-	}
-
-	if i > maxPageSize {
-		return maxPageSize
-	}
-
-	return i
-}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// searchVerifiedFilter is the user search token that only matches verified users.
+const searchVerifiedFilter = "verified:true"
+
+// SetVerified marks the given user as verified or not.
+// Only admins can do it, and every change is recorded in the audit log.
+func (s *Service) SetVerified(ctx context.Context, username string, verified bool) error {
+	adminID, err := s.authAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	username = validation.NormalizeUsername(username)
+	var v validation.Validator
+	v.Username("username", username)
+	if err = v.Err(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	var uid int64
+	var wasVerified bool
+	query := "SELECT id, verified FROM users WHERE lower(username) = lower($1) FOR UPDATE"
+	err = tx.QueryRowContext(ctx, query, username).Scan(&uid, &wasVerified)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not query select user verified: %v", err)
+	}
+
+	if wasVerified == verified {
+		return nil
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE users SET verified = $1 WHERE id = $2", verified, uid); err != nil {
+		return fmt.Errorf("could not update user verified: %v", err)
+	}
+
+	action := AuditActionVerify
+	if !verified {
+		action = AuditActionUnverify
+	}
+	if err = s.audit(ctx, tx, adminID, action, uid, map[string]interface{}{"username": username}); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit verified change: %v", err)
+	}
+
+	s.purge(profilePaths(username)...)
+
+	return nil
+}
+
+// parseVerifiedFilter removes the verified:true token from a user search,
+// reporting whether it was present.
+func parseVerifiedFilter(search string) (string, bool) {
+	var verified bool
+	var terms []string
+	for _, term := range strings.Fields(search) {
+		if strings.EqualFold(term, searchVerifiedFilter) {
+			verified = true
+			continue
+		}
+
+		terms = append(terms, term)
+	}
+
+	return strings.Join(terms, " "), verified
+}
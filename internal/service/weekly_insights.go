@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/djomlaa/socnet/internal/mailer"
+)
+
+// maxTopPostExcerpt is how many characters of the top post go in the email.
+const maxTopPostExcerpt = 140
+
+// WeeklyInsights of an author over the last seven days.
+type WeeklyInsights struct {
+	NewFollowers int
+	TotalLikes   int
+	// TopPost is the post that got the most likes, if any got one.
+	TopPost *WeeklyTopPost
+}
+
+// WeeklyTopPost is the best performing post of the week.
+type WeeklyTopPost struct {
+	ID      int64
+	Excerpt string
+	Likes   int
+}
+
+type weeklyInsightsMail struct {
+	Origin   string
+	Username string
+	WeeklyInsights
+}
+
+// WeeklyInsightsEmail tells whether the authenticated user gets the weekly insights email.
+func (s *Service) WeeklyInsightsEmail(ctx context.Context) (bool, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return false, ErrUnauthenticated
+	}
+
+	var enabled bool
+	query := "SELECT weekly_insights_email FROM users WHERE id = $1"
+	if err := s.db.QueryRowContext(ctx, query, uid).Scan(&enabled); err != nil {
+		return false, fmt.Errorf("could not query select weekly insights email: %v", err)
+	}
+
+	return enabled, nil
+}
+
+// SetWeeklyInsightsEmail opts the authenticated user in or out of the weekly insights email.
+func (s *Service) SetWeeklyInsightsEmail(ctx context.Context, enabled bool) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	query := "UPDATE users SET weekly_insights_email = $1 WHERE id = $2"
+	if _, err := s.db.ExecContext(ctx, query, enabled, uid); err != nil {
+		return fmt.Errorf("could not update weekly insights email: %v", err)
+	}
+
+	return nil
+}
+
+// SendWeeklyInsights emails the users who opted in a summary of how their posts did
+// over the last seven days, and returns how many were sent. Users sent one in the
+// last six days are skipped, so running it more than once a week is harmless, and
+// so are users with nothing to report.
+func (s *Service) SendWeeklyInsights(ctx context.Context) (int, error) {
+	query := `SELECT id, username, email, locale FROM users
+		WHERE weekly_insights_email
+		AND (weekly_insights_sent_at IS NULL OR weekly_insights_sent_at < now() - INTERVAL '6 days')
+		ORDER BY id`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("could not query select weekly insights recipients: %v", err)
+	}
+
+	type recipient struct {
+		id                      int64
+		username, email, locale string
+	}
+	var rr []recipient
+	for rows.Next() {
+		var r recipient
+		if err = rows.Scan(&r.id, &r.username, &r.email, &r.locale); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("could not scan weekly insights recipient: %v", err)
+		}
+
+		rr = append(rr, r)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("could not iterate weekly insights recipient rows: %v", err)
+	}
+
+	var sent int
+	for _, r := range rr {
+		in, err := s.weeklyInsights(ctx, r.id)
+		if err != nil {
+			return sent, err
+		}
+
+		if in.NewFollowers != 0 || in.TotalLikes != 0 {
+			data := weeklyInsightsMail{Origin: s.origin, Username: r.username, WeeklyInsights: in}
+			if err = s.sendMail(ctx, mailer.TemplateWeeklyInsights, r.locale, r.email, data); err != nil {
+				log.Println(err)
+				continue
+			}
+
+			sent++
+		}
+
+		query = "UPDATE users SET weekly_insights_sent_at = now() WHERE id = $1"
+		if _, err = s.db.ExecContext(ctx, query, r.id); err != nil {
+			return sent, fmt.Errorf("could not update weekly insights sent at: %v", err)
+		}
+	}
+
+	return sent, nil
+}
+
+// weeklyInsights of the user over the last seven days.
+// Likes of the user on their own posts are not counted.
+func (s *Service) weeklyInsights(ctx context.Context, uid int64) (WeeklyInsights, error) {
+	var out WeeklyInsights
+	query := `SELECT
+		(SELECT count(*) FROM follows WHERE followee_id = $1 AND created_at > now() - INTERVAL '7 days'),
+		(SELECT count(*) FROM post_likes pl
+			INNER JOIN posts p ON pl.post_id = p.id
+			WHERE p.user_id = $1 AND pl.user_id <> $1 AND pl.created_at > now() - INTERVAL '7 days')`
+	if err := s.db.QueryRowContext(ctx, query, uid).Scan(&out.NewFollowers, &out.TotalLikes); err != nil {
+		return out, fmt.Errorf("could not query select weekly insights: %v", err)
+	}
+
+	if out.TotalLikes == 0 {
+		return out, nil
+	}
+
+	var p WeeklyTopPost
+	query = `SELECT p.id, p.content, count(*) FROM post_likes pl
+		INNER JOIN posts p ON pl.post_id = p.id
+		WHERE p.user_id = $1 AND pl.user_id <> $1 AND pl.created_at > now() - INTERVAL '7 days'
+		AND NOT p.archived
+		GROUP BY p.id
+		ORDER BY count(*) DESC, p.id DESC
+		LIMIT 1`
+	err := s.db.QueryRowContext(ctx, query, uid).Scan(&p.ID, &p.Excerpt, &p.Likes)
+	if err == sql.ErrNoRows {
+		return out, nil
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("could not query select weekly top post: %v", err)
+	}
+
+	if r := []rune(p.Excerpt); len(r) > maxTopPostExcerpt {
+		p.Excerpt = string(r[:maxTopPostExcerpt]) + "…"
+	}
+
+	out.TopPost = &p
+	return out, nil
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/djomlaa/socnet/internal/validation"
+)
+
+// Word filter actions, applied to posts whose content or spoiler contains the word.
+const (
+	// WordFilterReject refuses to publish the post.
+	WordFilterReject = "reject"
+	// WordFilterFlag publishes the post and queues it for moderator review.
+	WordFilterFlag = "flag"
+	// WordFilterNSFW publishes the post marked as NSFW.
+	WordFilterNSFW = "nsfw"
+)
+
+// ErrWordFilterNotFound denotes a word filter that was not found
+var ErrWordFilterNotFound = errors.New("word filter not found")
+
+// WordFilter model
+type WordFilter struct {
+	ID        int64     `json:"id"`
+	Word      string    `json:"word"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PostReview is a post queued for moderator review.
+type PostReview struct {
+	Post      Post      `json:"post"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func validWordFilterAction(action string) bool {
+	return action == WordFilterReject || action == WordFilterFlag || action == WordFilterNSFW
+}
+
+// WordFilters of the instance. Admin only.
+func (s *Service) WordFilters(ctx context.Context) ([]WordFilter, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, word, action, created_at FROM word_filters ORDER BY word")
+	if err != nil {
+		return nil, fmt.Errorf("could not query select word filters: %v", err)
+	}
+
+	defer rows.Close()
+
+	ff := []WordFilter{}
+	for rows.Next() {
+		var f WordFilter
+		if err = rows.Scan(&f.ID, &f.Word, &f.Action, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan word filter: %v", err)
+		}
+
+		ff = append(ff, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate word filter rows: %v", err)
+	}
+
+	return ff, nil
+}
+
+// SetWordFilter adds a word to the filter or changes its action. Admin only.
+func (s *Service) SetWordFilter(ctx context.Context, word, action string) (WordFilter, error) {
+	var f WordFilter
+	if _, err := s.authAdmin(ctx); err != nil {
+		return f, err
+	}
+
+	word = strings.ToLower(strings.TrimSpace(word))
+	var v validation.Validator
+	v.Content("word", word, validation.MaxNameLength)
+	v.Check(validWordFilterAction(action), "action", "must be reject, flag or nsfw")
+	if err := v.Err(); err != nil {
+		return f, err
+	}
+
+	query := `INSERT INTO word_filters (word, action) VALUES ($1, $2)
+		ON CONFLICT (word) DO UPDATE SET action = EXCLUDED.action
+		RETURNING id, created_at`
+	if err := s.db.QueryRowContext(ctx, query, word, action).Scan(&f.ID, &f.CreatedAt); err != nil {
+		return f, fmt.Errorf("could not upsert word filter: %v", err)
+	}
+
+	f.Word = word
+	f.Action = action
+	return f, nil
+}
+
+// DeleteWordFilter removes a word from the filter. Admin only.
+func (s *Service) DeleteWordFilter(ctx context.Context, word string) error {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return err
+	}
+
+	query := "DELETE FROM word_filters WHERE word = $1"
+	res, err := s.db.ExecContext(ctx, query, strings.ToLower(strings.TrimSpace(word)))
+	if err != nil {
+		return fmt.Errorf("could not delete word filter: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrWordFilterNotFound
+	}
+
+	return nil
+}
+
+// matchWordFilters returns the actions of the filtered words found in texts,
+// matching whole words case insensitively.
+func (s *Service) matchWordFilters(ctx context.Context, texts ...string) (map[string]bool, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT word, action FROM word_filters")
+	if err != nil {
+		return nil, fmt.Errorf("could not query select word filters: %v", err)
+	}
+
+	defer rows.Close()
+
+	words := map[string][]string{}
+	for rows.Next() {
+		var word, action string
+		if err = rows.Scan(&word, &action); err != nil {
+			return nil, fmt.Errorf("could not scan word filter: %v", err)
+		}
+
+		words[action] = append(words[action], regexp.QuoteMeta(word))
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate word filter rows: %v", err)
+	}
+
+	text := strings.Join(texts, "\n")
+	actions := map[string]bool{}
+	for action, ww := range words {
+		re, err := regexp.Compile(`(?i)\b(` + strings.Join(ww, "|") + `)\b`)
+		if err != nil {
+			return nil, fmt.Errorf("could not compile word filter: %v", err)
+		}
+
+		actions[action] = re.MatchString(text)
+	}
+
+	return actions, nil
+}
+
+// PostReviews pending, oldest first. Admin only.
+func (s *Service) PostReviews(ctx context.Context) ([]PostReview, error) {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT p.id, p.content, p.spoiler_of, p.nsfw, p.license, p.likes_count, p.comments_count, p.created_at,
+		u.username, u.avatar, u.verified, r.reason, r.created_at
+		FROM post_reviews r
+		INNER JOIN posts p ON r.post_id = p.id
+		INNER JOIN users u ON p.user_id = u.id
+		WHERE r.resolved_at IS NULL
+		ORDER BY r.created_at ASC`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("could not query select post reviews: %v", err)
+	}
+
+	defer rows.Close()
+
+	rr := []PostReview{}
+	for rows.Next() {
+		var r PostReview
+		var u User
+		var avatar sql.NullString
+		dest := []interface{}{&r.Post.ID, &r.Post.Content, &r.Post.SpoilerOf, &r.Post.NSFW, &r.Post.License, &r.Post.LikesCount, &r.Post.CommentsCount, &r.Post.CreatedAt,
+			&u.Username, &avatar, &u.Verified, &r.Reason, &r.CreatedAt}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan post review: %v", err)
+		}
+
+		if avatar.Valid {
+			avatarURL := s.origin + "/img/avatars/" + avatar.String
+			u.AvatarURL = &avatarURL
+		}
+
+		r.Post.User = &u
+		rr = append(rr, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate post review rows: %v", err)
+	}
+
+	return rr, nil
+}
+
+// ResolvePostReview removes a post from the review queue. Admin only.
+func (s *Service) ResolvePostReview(ctx context.Context, postID int64) error {
+	if _, err := s.authAdmin(ctx); err != nil {
+		return err
+	}
+
+	query := "UPDATE post_reviews SET resolved_at = now() WHERE post_id = $1 AND resolved_at IS NULL"
+	res, err := s.db.ExecContext(ctx, query, postID)
+	if err != nil {
+		return fmt.Errorf("could not update post review: %v", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPostNotFound
+	}
+
+	return nil
+}
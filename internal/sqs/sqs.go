@@ -0,0 +1,186 @@
+// Package sqs is a minimal client for Amazon SQS queues,
+// covering the calls needed to use one as a work queue.
+package sqs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpClient timeout leaves room for the longest receive wait of 20 seconds.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// Client of a queue.
+type Client struct {
+	// QueueURL like https://sqs.us-east-1.amazonaws.com/123456789012/socnet-fanout.
+	QueueURL        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// Message received from the queue.
+type Message struct {
+	Body string
+	// ReceiptHandle deletes the message once it has been processed.
+	ReceiptHandle string
+}
+
+// Send a message to the queue.
+func (c *Client) Send(ctx context.Context, body string) error {
+	in := map[string]interface{}{"QueueUrl": c.QueueURL, "MessageBody": body}
+	return c.do(ctx, "SendMessage", in, nil)
+}
+
+// Receive up to max messages, waiting up to wait for one to arrive.
+// Messages not deleted become visible again after the visibility timeout
+// of the queue, to be received again.
+func (c *Client) Receive(ctx context.Context, max int, wait time.Duration) ([]Message, error) {
+	in := map[string]interface{}{
+		"QueueUrl":            c.QueueURL,
+		"MaxNumberOfMessages": max,
+		"WaitTimeSeconds":     int(wait.Seconds()),
+	}
+
+	var out struct {
+		Messages []Message `json:"Messages"`
+	}
+	if err := c.do(ctx, "ReceiveMessage", in, &out); err != nil {
+		return nil, err
+	}
+
+	return out.Messages, nil
+}
+
+// Delete a received message.
+func (c *Client) Delete(ctx context.Context, receiptHandle string) error {
+	in := map[string]interface{}{"QueueUrl": c.QueueURL, "ReceiptHandle": receiptHandle}
+	return c.do(ctx, "DeleteMessage", in, nil)
+}
+
+// ApproximateMessages waiting in the queue.
+func (c *Client) ApproximateMessages(ctx context.Context) (int, error) {
+	in := map[string]interface{}{
+		"QueueUrl":       c.QueueURL,
+		"AttributeNames": []string{"ApproximateNumberOfMessages"},
+	}
+
+	var out struct {
+		Attributes map[string]string `json:"Attributes"`
+	}
+	if err := c.do(ctx, "GetQueueAttributes", in, &out); err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.Atoi(out.Attributes["ApproximateNumberOfMessages"])
+	if err != nil {
+		return 0, fmt.Errorf("could not parse sqs approximate number of messages: %v", err)
+	}
+
+	return n, nil
+}
+
+// do calls action through the JSON protocol of SQS.
+func (c *Client) do(ctx context.Context, action string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("could not marshal sqs %s request: %v", action, err)
+	}
+
+	u, err := url.Parse(c.QueueURL)
+	if err != nil {
+		return fmt.Errorf("could not parse sqs queue url: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.Scheme+"://"+u.Host+"/", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not create sqs %s request: %v", action, err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	c.sign(req, u.Host, body, time.Now().UTC())
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not do sqs %s request: %v", action, err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return fmt.Errorf("sqs %s responded with %s: %s", action, res.Status, b)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("could not decode sqs %s response: %v", action, err)
+	}
+
+	return nil
+}
+
+// sign the request with AWS signature version 4.
+func (c *Client) sign(req *http.Request, host string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := date + "/" + c.Region + "/sqs/aws4_request"
+	signedHeaders := "content-type;host;x-amz-date;x-amz-target"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"content-type:" + req.Header.Get("Content-Type"),
+		"host:" + host,
+		"x-amz-date:" + amzDate,
+		"x-amz-target:" + req.Header.Get("X-Amz-Target"),
+		"",
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), date)
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, "sqs")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,164 @@
+package sso
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// maxBERLength bounds the size of the LDAP messages read.
+const maxBERLength = 1 << 20
+
+// BER tags of the universal types used by LDAP.
+const (
+	berBoolean     = 0x01
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berEnumerated  = 0x0a
+	berSequence    = 0x30
+	berSet         = 0x31
+)
+
+var errBER = errors.New("malformed ber")
+
+// berElement is a decoded tag with its raw content.
+type berElement struct {
+	tag     byte
+	content []byte
+}
+
+// berTLV encodes the concatenated contents under tag.
+// Only the single byte tags LDAP uses are supported.
+func berTLV(tag byte, contents ...[]byte) []byte {
+	n := 0
+	for _, c := range contents {
+		n += len(c)
+	}
+
+	b := append([]byte{tag}, berLength(n)...)
+	for _, c := range contents {
+		b = append(b, c...)
+	}
+	return b
+}
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// berInt encodes n in the fewest two's complement bytes.
+func berInt(tag byte, n int64) []byte {
+	b := []byte{byte(n)}
+	for n > 127 || n < -128 {
+		n >>= 8
+		b = append([]byte{byte(n)}, b...)
+	}
+	return berTLV(tag, b)
+}
+
+func berString(tag byte, s string) []byte {
+	return berTLV(tag, []byte(s))
+}
+
+func berBool(b bool) []byte {
+	if b {
+		return berTLV(berBoolean, []byte{0xff})
+	}
+	return berTLV(berBoolean, []byte{0})
+}
+
+// readBER reads the next element from r.
+func readBER(r *bufio.Reader) (berElement, error) {
+	var e berElement
+	tag, err := r.ReadByte()
+	if err != nil {
+		return e, err
+	}
+
+	n, err := r.ReadByte()
+	if err != nil {
+		return e, err
+	}
+
+	length := int(n)
+	if n&0x80 != 0 {
+		size := int(n & 0x7f)
+		if size == 0 || size > 4 {
+			return e, errBER
+		}
+
+		length = 0
+		for i := 0; i < size; i++ {
+			if n, err = r.ReadByte(); err != nil {
+				return e, err
+			}
+			length = length<<8 | int(n)
+		}
+	}
+
+	if length > maxBERLength {
+		return e, errBER
+	}
+
+	e.tag = tag
+	e.content = make([]byte, length)
+	if _, err = io.ReadFull(r, e.content); err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+// berElements decodes the elements concatenated in b,
+// like the content of a sequence.
+func berElements(b []byte) ([]berElement, error) {
+	var ee []berElement
+	for len(b) != 0 {
+		if len(b) < 2 {
+			return nil, errBER
+		}
+
+		tag, length, rest := b[0], int(b[1]), b[2:]
+		if b[1]&0x80 != 0 {
+			size := int(b[1] & 0x7f)
+			if size == 0 || size > 4 || len(rest) < size {
+				return nil, errBER
+			}
+
+			length = 0
+			for _, c := range rest[:size] {
+				length = length<<8 | int(c)
+			}
+			rest = rest[size:]
+		}
+
+		if length < 0 || length > len(rest) {
+			return nil, errBER
+		}
+
+		ee = append(ee, berElement{tag: tag, content: rest[:length]})
+		b = rest[length:]
+	}
+	return ee, nil
+}
+
+// berIntValue decodes the two's complement content of an integer or enumerated.
+func berIntValue(b []byte) (int64, error) {
+	if len(b) == 0 || len(b) > 8 {
+		return 0, errBER
+	}
+
+	n := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		n = n<<8 | int64(c)
+	}
+	return n, nil
+}
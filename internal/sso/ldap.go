@@ -0,0 +1,332 @@
+package sso
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ldapTimeout bounds a whole authentication when the context has no deadline.
+const ldapTimeout = time.Second * 10
+
+// LDAP protocol operations.
+const (
+	ldapBindRequest        = 0x60
+	ldapBindResponse       = 0x61
+	ldapUnbindRequest      = 0x42
+	ldapSearchRequest      = 0x63
+	ldapSearchEntry        = 0x64
+	ldapSearchDone         = 0x65
+	ldapSearchReference    = 0x73
+	ldapSimpleAuth         = 0x80
+	ldapFilterEquality     = 0xa3
+	ldapScopeSubtree       = 2
+	ldapNeverDerefAlias    = 0
+	ldapResultSuccess      = 0
+	ldapResultSizeLimit    = 4
+	ldapResultInvalidCreds = 49
+)
+
+// LDAP authenticates users by binding to a directory as them, after looking up
+// their entry by email with a service account.
+type LDAP struct {
+	// URL of the server, like ldaps://ldap.example.org. ldap:// URLs send
+	// the passwords in clear text, so only use them on a trusted network.
+	URL string
+	// BindDN and BindPassword of the service account searching the directory.
+	// An empty BindDN searches anonymously.
+	BindDN       string
+	BindPassword string
+	// BaseDN the user entries are searched under.
+	BaseDN string
+	// EmailAttr, UsernameAttr and GroupsAttr of the user entries.
+	// They default to mail, uid and memberOf.
+	EmailAttr    string
+	UsernameAttr string
+	GroupsAttr   string
+}
+
+type ldapConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	lastID int64
+}
+
+// Authenticate the user with the given email and password. Their groups are the
+// values of GroupsAttr, usually the DNs of the groups they are a member of.
+func (l *LDAP) Authenticate(ctx context.Context, email, password string) (Identity, error) {
+	var id Identity
+	// An empty password would be an unauthenticated bind, which servers accept.
+	if password == "" {
+		return id, ErrInvalidCredentials
+	}
+
+	c, err := l.dial(ctx)
+	if err != nil {
+		return id, err
+	}
+
+	defer c.close()
+
+	if l.BindDN != "" {
+		if err = c.bind(l.BindDN, l.BindPassword); err != nil {
+			return id, fmt.Errorf("could not bind ldap service account: %v", err)
+		}
+	}
+
+	emailAttr := fallback(l.EmailAttr, "mail")
+	usernameAttr := fallback(l.UsernameAttr, "uid")
+	groupsAttr := fallback(l.GroupsAttr, "memberOf")
+
+	dn, attrs, err := c.searchOne(l.BaseDN, emailAttr, email, []string{usernameAttr, groupsAttr})
+	if err != nil {
+		return id, err
+	}
+
+	if err = c.bind(dn, password); err != nil {
+		return id, err
+	}
+
+	id.Email = email
+	if vv := attrs[strings.ToLower(usernameAttr)]; len(vv) != 0 {
+		id.Username = vv[0]
+	}
+	id.Groups = attrs[strings.ToLower(groupsAttr)]
+
+	return id, nil
+}
+
+func (l *LDAP) dial(ctx context.Context) (*ldapConn, error) {
+	u, err := url.Parse(l.URL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse ldap url: %v", err)
+	}
+
+	host, port := u.Hostname(), u.Port()
+	switch u.Scheme {
+	case "ldaps":
+		port = fallback(port, "636")
+	case "ldap":
+		port = fallback(port, "389")
+	default:
+		return nil, fmt.Errorf("unsupported ldap url scheme %q", u.Scheme)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(ldapTimeout)
+	}
+
+	d := net.Dialer{Deadline: deadline}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, fmt.Errorf("could not dial ldap: %v", err)
+	}
+
+	if u.Scheme == "ldaps" {
+		conn = tls.Client(conn, &tls.Config{ServerName: host})
+	}
+
+	if err = conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not set ldap deadline: %v", err)
+	}
+
+	return &ldapConn{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+func (c *ldapConn) close() {
+	c.send(berTLV(ldapUnbindRequest))
+	c.conn.Close()
+}
+
+// send the operation in a new message, returning its id.
+func (c *ldapConn) send(op []byte) (int64, error) {
+	c.lastID++
+	if _, err := c.conn.Write(berTLV(berSequence, berInt(berInteger, c.lastID), op)); err != nil {
+		return 0, fmt.Errorf("could not write ldap message: %v", err)
+	}
+
+	return c.lastID, nil
+}
+
+// receive the operation of the next message, which must answer id.
+func (c *ldapConn) receive(id int64) (berElement, error) {
+	msg, err := readBER(c.r)
+	if err != nil {
+		return berElement{}, fmt.Errorf("could not read ldap message: %v", err)
+	}
+
+	ee, err := berElements(msg.content)
+	if err != nil || msg.tag != berSequence || len(ee) < 2 {
+		return berElement{}, errBER
+	}
+
+	if got, err := berIntValue(ee[0].content); err != nil || got != id {
+		return berElement{}, fmt.Errorf("unexpected ldap message id")
+	}
+
+	return ee[1], nil
+}
+
+// bind as dn with a simple password.
+func (c *ldapConn) bind(dn, password string) error {
+	id, err := c.send(berTLV(ldapBindRequest,
+		berInt(berInteger, 3),
+		berString(berOctetString, dn),
+		berString(ldapSimpleAuth, password),
+	))
+	if err != nil {
+		return err
+	}
+
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+
+	if op.tag != ldapBindResponse {
+		return errBER
+	}
+
+	code, msg, err := ldapResult(op.content)
+	if err != nil {
+		return err
+	}
+
+	if code == ldapResultInvalidCreds {
+		return ErrInvalidCredentials
+	}
+
+	if code != ldapResultSuccess {
+		return fmt.Errorf("ldap bind failed with code %d: %s", code, msg)
+	}
+
+	return nil
+}
+
+// searchOne returns the DN and attributes, by lowercase name, of the single entry
+// under base whose attr equals value. None is ErrInvalidCredentials, so as not
+// to tell which emails exist.
+func (c *ldapConn) searchOne(base, attr, value string, attrs []string) (string, map[string][]string, error) {
+	var list [][]byte
+	for _, a := range attrs {
+		list = append(list, berString(berOctetString, a))
+	}
+
+	// Size limit 2 is enough to tell whether the email is ambiguous.
+	id, err := c.send(berTLV(ldapSearchRequest,
+		berString(berOctetString, base),
+		berInt(berEnumerated, ldapScopeSubtree),
+		berInt(berEnumerated, ldapNeverDerefAlias),
+		berInt(berInteger, 2),
+		berInt(berInteger, int64(ldapTimeout.Seconds())),
+		berBool(false),
+		berTLV(ldapFilterEquality, berString(berOctetString, attr), berString(berOctetString, value)),
+		berTLV(berSequence, list...),
+	))
+	if err != nil {
+		return "", nil, err
+	}
+
+	var dn string
+	var found map[string][]string
+	entries := 0
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return "", nil, err
+		}
+
+		switch op.tag {
+		case ldapSearchEntry:
+			entries++
+			if dn, found, err = ldapEntry(op.content); err != nil {
+				return "", nil, err
+			}
+		case ldapSearchReference:
+			// Referrals to other servers are not followed.
+		case ldapSearchDone:
+			code, msg, err := ldapResult(op.content)
+			if err != nil {
+				return "", nil, err
+			}
+
+			if entries > 1 || code == ldapResultSizeLimit {
+				return "", nil, fmt.Errorf("ldap has more than one entry with %s %q", attr, value)
+			}
+
+			if code != ldapResultSuccess {
+				return "", nil, fmt.Errorf("ldap search failed with code %d: %s", code, msg)
+			}
+
+			if entries == 0 {
+				return "", nil, ErrInvalidCredentials
+			}
+
+			return dn, found, nil
+		default:
+			return "", nil, errBER
+		}
+	}
+}
+
+// ldapResult decodes the result code and diagnostic message of an LDAPResult.
+func ldapResult(b []byte) (int64, string, error) {
+	ee, err := berElements(b)
+	if err != nil || len(ee) < 3 || ee[0].tag != berEnumerated {
+		return 0, "", errBER
+	}
+
+	code, err := berIntValue(ee[0].content)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return code, string(ee[2].content), nil
+}
+
+// ldapEntry decodes the DN and attributes of a SearchResultEntry.
+func ldapEntry(b []byte) (string, map[string][]string, error) {
+	ee, err := berElements(b)
+	if err != nil || len(ee) != 2 || ee[0].tag != berOctetString || ee[1].tag != berSequence {
+		return "", nil, errBER
+	}
+
+	list, err := berElements(ee[1].content)
+	if err != nil {
+		return "", nil, err
+	}
+
+	attrs := map[string][]string{}
+	for _, a := range list {
+		parts, err := berElements(a.content)
+		if err != nil || len(parts) != 2 || a.tag != berSequence || parts[1].tag != berSet {
+			return "", nil, errBER
+		}
+
+		vals, err := berElements(parts[1].content)
+		if err != nil {
+			return "", nil, err
+		}
+
+		name := strings.ToLower(string(parts[0].content))
+		for _, v := range vals {
+			attrs[name] = append(attrs[name], string(v.content))
+		}
+	}
+
+	return string(ee[0].content), attrs, nil
+}
+
+func fallback(s, fallbackValue string) string {
+	if s == "" {
+		return fallbackValue
+	}
+	return s
+}
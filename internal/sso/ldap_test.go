@@ -0,0 +1,338 @@
+package sso
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// ldapHandler answers the operation of the message id with whole messages.
+type ldapHandler func(id int64, op berElement) [][]byte
+
+func ldapMessage(id int64, op []byte) []byte {
+	return berTLV(berSequence, berInt(berInteger, id), op)
+}
+
+// serveLDAP on a local port, returning its URL.
+func serveLDAP(t *testing.T, handle ldapHandler) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				r := bufio.NewReader(conn)
+				for {
+					msg, err := readBER(r)
+					if err != nil {
+						return
+					}
+
+					ee, err := berElements(msg.content)
+					if err != nil || len(ee) < 2 {
+						return
+					}
+
+					id, err := berIntValue(ee[0].content)
+					if err != nil || ee[1].tag == ldapUnbindRequest {
+						return
+					}
+
+					for _, res := range handle(id, ee[1]) {
+						if _, err = conn.Write(res); err != nil {
+							return
+						}
+					}
+				}
+			}()
+		}
+	}()
+
+	return "ldap://" + ln.Addr().String()
+}
+
+type ldapTestEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// ldapDirectory answers binds and equality searches over entries,
+// with a service account cn=socnet of password secret.
+func ldapDirectory(entries ...ldapTestEntry) ldapHandler {
+	result := func(tag byte, code int64) []byte {
+		return berTLV(tag, berInt(berEnumerated, code), berString(berOctetString, ""), berString(berOctetString, "diagnostic"))
+	}
+
+	return func(id int64, op berElement) [][]byte {
+		ee, err := berElements(op.content)
+		if err != nil {
+			return nil
+		}
+
+		switch op.tag {
+		case ldapBindRequest:
+			dn, password := string(ee[1].content), string(ee[2].content)
+			if dn == "cn=socnet" && password == "secret" {
+				return [][]byte{ldapMessage(id, result(ldapBindResponse, ldapResultSuccess))}
+			}
+
+			for _, e := range entries {
+				if e.dn == dn && e.password == password {
+					return [][]byte{ldapMessage(id, result(ldapBindResponse, ldapResultSuccess))}
+				}
+			}
+
+			return [][]byte{ldapMessage(id, result(ldapBindResponse, ldapResultInvalidCreds))}
+		case ldapSearchRequest:
+			filter, err := berElements(ee[6].content)
+			if err != nil || ee[6].tag != ldapFilterEquality {
+				return nil
+			}
+
+			attr, value := string(filter[0].content), string(filter[1].content)
+			var res [][]byte
+			for _, e := range entries {
+				if !contains(e.attrs[attr], value) {
+					continue
+				}
+
+				var list [][]byte
+				for name, vals := range e.attrs {
+					var set [][]byte
+					for _, v := range vals {
+						set = append(set, berString(berOctetString, v))
+					}
+					list = append(list, berTLV(berSequence, berString(berOctetString, name), berTLV(berSet, set...)))
+				}
+
+				res = append(res, ldapMessage(id, berTLV(ldapSearchEntry, berString(berOctetString, e.dn), berTLV(berSequence, list...))))
+			}
+
+			return append(res, ldapMessage(id, result(ldapSearchDone, ldapResultSuccess)))
+		}
+
+		return nil
+	}
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	alice := ldapTestEntry{
+		dn:       "uid=alice,ou=people,dc=example,dc=org",
+		password: "alice password",
+		attrs: map[string][]string{
+			"mail":     {"alice@example.org"},
+			"uid":      {"alice"},
+			"memberOf": {"cn=admins,dc=example,dc=org", "cn=staff,dc=example,dc=org"},
+		},
+	}
+	bob := ldapTestEntry{
+		dn:       "uid=bob,ou=people,dc=example,dc=org",
+		password: "bob password",
+		attrs:    map[string][]string{"mail": {"bob@example.org", "shared@example.org"}},
+	}
+	carol := ldapTestEntry{
+		dn:       "uid=carol,ou=people,dc=example,dc=org",
+		password: "carol password",
+		attrs:    map[string][]string{"mail": {"shared@example.org"}},
+	}
+	url := serveLDAP(t, ldapDirectory(alice, bob, carol))
+
+	tests := []struct {
+		name     string
+		bindDN   string
+		email    string
+		password string
+		want     Identity
+		err      error
+	}{
+		{
+			name:     "valid",
+			bindDN:   "cn=socnet",
+			email:    "alice@example.org",
+			password: "alice password",
+			want: Identity{
+				Email:    "alice@example.org",
+				Username: "alice",
+				Groups:   []string{"cn=admins,dc=example,dc=org", "cn=staff,dc=example,dc=org"},
+			},
+		},
+		{name: "anonymous search", email: "bob@example.org", password: "bob password", want: Identity{Email: "bob@example.org"}},
+		{name: "wrong password", bindDN: "cn=socnet", email: "alice@example.org", password: "bob password", err: ErrInvalidCredentials},
+		{name: "empty password", bindDN: "cn=socnet", email: "alice@example.org", err: ErrInvalidCredentials},
+		{name: "unknown email", bindDN: "cn=socnet", email: "dave@example.org", password: "alice password", err: ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &LDAP{URL: url, BindDN: tt.bindDN, BindPassword: "secret", BaseDN: "dc=example,dc=org"}
+			got, err := l.Authenticate(context.Background(), tt.email, tt.password)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Authenticate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLDAPAuthenticateFailures(t *testing.T) {
+	alice := ldapTestEntry{
+		dn:       "uid=alice,dc=example,dc=org",
+		password: "alice password",
+		attrs:    map[string][]string{"mail": {"alice@example.org", "shared@example.org"}},
+	}
+	bob := ldapTestEntry{
+		dn:       "uid=bob,dc=example,dc=org",
+		password: "bob password",
+		attrs:    map[string][]string{"mail": {"shared@example.org"}},
+	}
+	directory := ldapDirectory(alice, bob)
+
+	tests := []struct {
+		name         string
+		bindPassword string
+		email        string
+		handle       ldapHandler
+	}{
+		{name: "wrong service account password", bindPassword: "wrong", email: "alice@example.org", handle: directory},
+		{name: "ambiguous email", bindPassword: "secret", email: "shared@example.org", handle: directory},
+		{
+			name:         "wrong message id",
+			bindPassword: "secret",
+			email:        "alice@example.org",
+			handle: func(id int64, op berElement) [][]byte {
+				res := directory(id, op)
+				if len(res) != 0 {
+					res[0] = directory(id+1, op)[0]
+				}
+				return res
+			},
+		},
+		{
+			name:         "unexpected operation",
+			bindPassword: "secret",
+			email:        "alice@example.org",
+			handle: func(id int64, op berElement) [][]byte {
+				return [][]byte{ldapMessage(id, berTLV(ldapSearchDone, berInt(berEnumerated, ldapResultSuccess)))}
+			},
+		},
+		{
+			name:         "truncated operation",
+			bindPassword: "secret",
+			email:        "alice@example.org",
+			handle: func(id int64, op berElement) [][]byte {
+				return [][]byte{ldapMessage(id, []byte{ldapBindResponse, 5, berEnumerated, 1, 0})}
+			},
+		},
+		{
+			name:         "malformed result",
+			bindPassword: "secret",
+			email:        "alice@example.org",
+			handle: func(id int64, op berElement) [][]byte {
+				return [][]byte{ldapMessage(id, berTLV(ldapBindResponse, berString(berOctetString, "not a code")))}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &LDAP{URL: serveLDAP(t, tt.handle), BindDN: "cn=socnet", BindPassword: tt.bindPassword}
+			id, err := l.Authenticate(context.Background(), tt.email, "alice password")
+			if err == nil || errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Authenticate() = %+v, %v, want an error other than %v", id, err, ErrInvalidCredentials)
+			}
+		})
+	}
+}
+
+func TestBERInt(t *testing.T) {
+	for _, n := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 1 << 40, math.MaxInt64, math.MinInt64} {
+		ee, err := berElements(berInt(berInteger, n))
+		if err != nil || len(ee) != 1 || ee[0].tag != berInteger {
+			t.Fatalf("berElements(berInt(%d)) = %v, %v", n, ee, err)
+		}
+
+		got, err := berIntValue(ee[0].content)
+		if err != nil || got != n {
+			t.Errorf("berIntValue(berInt(%d)) = %d, %v", n, got, err)
+		}
+	}
+}
+
+func TestReadBER(t *testing.T) {
+	for _, n := range []int{0, 0x7f, 0x80, 0xff, 0x100, 0x10000} {
+		content := bytes.Repeat([]byte{'a'}, n)
+		e, err := readBER(bufio.NewReader(bytes.NewReader(berTLV(berOctetString, content))))
+		if err != nil || e.tag != berOctetString || !bytes.Equal(e.content, content) {
+			t.Errorf("readBER() of %d bytes = %d bytes with tag %x, %v", n, len(e.content), e.tag, err)
+		}
+	}
+}
+
+func TestBERMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{name: "tag only", in: []byte{berOctetString}},
+		{name: "truncated content", in: []byte{berOctetString, 3, 'a', 'b'}},
+		{name: "truncated long length", in: []byte{berOctetString, 0x82, 0x01}},
+		{name: "indefinite length", in: []byte{berSequence, 0x80, 0, 0}},
+		{name: "length too long", in: []byte{berOctetString, 0x85, 0, 0, 0, 0, 1, 'a'}},
+		{name: "over-long content", in: []byte{berOctetString, 0x84, 0x7f, 0xff, 0xff, 0xff, 'a'}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ee, err := berElements(tt.in); err == nil {
+				t.Errorf("berElements(%x) = %v, want error", tt.in, ee)
+			}
+
+			if e, err := readBER(bufio.NewReader(bytes.NewReader(tt.in))); err == nil {
+				t.Errorf("readBER(%x) = %v, want error", tt.in, e)
+			}
+		})
+	}
+
+	// Past maxBERLength, whatever follows.
+	huge := append([]byte{berOctetString}, berLength(maxBERLength+1)...)
+	if _, err := readBER(bufio.NewReader(bytes.NewReader(huge))); !errors.Is(err, errBER) {
+		t.Errorf("readBER() of %d bytes error = %v, want %v", maxBERLength+1, err, errBER)
+	}
+
+	for _, b := range [][]byte{nil, make([]byte, 9)} {
+		if n, err := berIntValue(b); err == nil {
+			t.Errorf("berIntValue(%x) = %d, want error", b, n)
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package sso
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// oidcKeysRefresh is how long the signing keys of the provider are kept before
+	// refetching them for an unknown key id, so made up ids don't hammer it.
+	oidcKeysRefresh = time.Minute
+	// oidcLeeway tolerates clock skew with the provider on expiration.
+	oidcLeeway = time.Minute
+	// maxOIDCResponse bounds the size of the provider responses read.
+	maxOIDCResponse = 1 << 20
+)
+
+// OIDC authenticates users with the authorization code flow of an OpenID Connect
+// provider, trusting the email of the ID token it issues.
+type OIDC struct {
+	// Issuer URL of the provider, where its discovery document is found.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL the provider sends the user back to with the code.
+	RedirectURL string
+	// GroupsClaim of the ID token listing the groups of the user.
+	// Defaults to groups.
+	GroupsClaim string
+	// TrustUnverifiedEmail accepts ID tokens without an email_verified claim,
+	// for providers that only issue verified emails but omit it. Emails
+	// claimed unverified are refused either way.
+	TrustUnverifiedEmail bool
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]crypto.PublicKey
+	keysAt    time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type idTokenClaims struct {
+	Issuer            string   `json:"iss"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	ExpiresAt         float64  `json:"exp"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     *bool    `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// audience claim, either a string or an array of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return err
+	}
+
+	*a = ss
+	return nil
+}
+
+// AuthURL to send the user to for logging in. The provider echoes the state
+// back to RedirectURL along with the code; the nonce ends up in the ID token.
+func (o *OIDC) AuthURL(ctx context.Context, state, nonce string) (string, error) {
+	d, err := o.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", o.ClientID)
+	q.Set("redirect_uri", o.RedirectURL)
+	q.Set("scope", "openid email profile")
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange the code for an ID token and returns the identity in it.
+// The token must carry the nonce given to AuthURL.
+func (o *OIDC) Exchange(ctx context.Context, code, nonce string) (Identity, error) {
+	var id Identity
+	d, err := o.discover(ctx)
+	if err != nil {
+		return id, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", o.RedirectURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return id, fmt.Errorf("could not create oidc token request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return id, fmt.Errorf("could not do oidc token request: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	var body struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err = json.NewDecoder(io.LimitReader(res.Body, maxOIDCResponse)).Decode(&body); err != nil {
+		return id, fmt.Errorf("could not decode oidc token response with status %d: %v", res.StatusCode, err)
+	}
+
+	// The code was already used, expired or made up.
+	if body.Error == "invalid_grant" {
+		return id, ErrInvalidCredentials
+	}
+
+	if res.StatusCode != http.StatusOK || body.IDToken == "" {
+		return id, fmt.Errorf("oidc token request failed with status %d: %s", res.StatusCode, body.Error)
+	}
+
+	return o.verifyIDToken(ctx, d, body.IDToken, nonce)
+}
+
+// verifyIDToken checks the signature and claims of the token. Tokens that
+// don't verify are ErrInvalidCredentials.
+func (o *OIDC) verifyIDToken(ctx context.Context, d *oidcDiscovery, token, nonce string) (Identity, error) {
+	var id Identity
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return id, ErrInvalidCredentials
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return id, ErrInvalidCredentials
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return id, ErrInvalidCredentials
+	}
+
+	key, err := o.key(ctx, d, header.Kid)
+	if err != nil {
+		return id, err
+	}
+
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !verifyJWTSignature(header.Alg, key, hash[:], sig) {
+		return id, ErrInvalidCredentials
+	}
+
+	var claims idTokenClaims
+	if err = decodeJWTPart(parts[1], &claims); err != nil {
+		return id, ErrInvalidCredentials
+	}
+
+	if claims.Issuer != d.Issuer || !claims.Audience.has(o.ClientID) ||
+		(len(claims.Audience) > 1 && claims.AuthorizedParty != o.ClientID) ||
+		time.Unix(int64(claims.ExpiresAt), 0).Add(oidcLeeway).Before(time.Now()) ||
+		subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return id, ErrInvalidCredentials
+	}
+
+	// Providers that don't verify emails can't vouch for them, or logging in
+	// would take over the account of whoever has that email here.
+	verified := claims.EmailVerified != nil && *claims.EmailVerified
+	if claims.EmailVerified == nil && o.TrustUnverifiedEmail {
+		verified = true
+	}
+
+	if claims.Email == "" || !verified {
+		return id, ErrInvalidCredentials
+	}
+
+	id.Email = claims.Email
+	id.Username = claims.PreferredUsername
+
+	var extra map[string]json.RawMessage
+	if err = decodeJWTPart(parts[1], &extra); err != nil {
+		return id, ErrInvalidCredentials
+	}
+
+	if raw, ok := extra[fallback(o.GroupsClaim, "groups")]; ok {
+		var groups audience
+		if err = json.Unmarshal(raw, &groups); err == nil {
+			id.Groups = groups
+		}
+	}
+
+	return id, nil
+}
+
+func (a audience) has(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeJWTPart(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// verifyJWTSignature of RS256 and ES256 tokens. Other algorithms,
+// none and the symmetric ones above all, are refused.
+func verifyJWTSignature(alg string, key crypto.PublicKey, hash, sig []byte) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return alg == "RS256" && rsa.VerifyPKCS1v15(k, crypto.SHA256, hash, sig) == nil
+	case *ecdsa.PublicKey:
+		// JWS signs with the fixed size r || s concatenation, not ASN.1.
+		if alg != "ES256" || len(sig) != 64 {
+			return false
+		}
+
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(k, hash, r, s)
+	}
+	return false
+}
+
+// discover the endpoints of the provider, once.
+func (o *OIDC) discover(ctx context.Context) (*oidcDiscovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.discovery != nil {
+		return o.discovery, nil
+	}
+
+	var d oidcDiscovery
+	if err := getJSON(ctx, strings.TrimSuffix(o.Issuer, "/")+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("could not discover oidc provider: %v", err)
+	}
+
+	if d.Issuer != o.Issuer || d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery document of %q is invalid", o.Issuer)
+	}
+
+	o.discovery = &d
+	return o.discovery, nil
+}
+
+// key of the provider with the given id. Tokens without one can use
+// the only key of providers that have a single one.
+func (o *OIDC) key(ctx context.Context, d *oidcDiscovery, kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	lookup := func() (crypto.PublicKey, bool) {
+		if kid == "" && len(o.keys) == 1 {
+			for _, k := range o.keys {
+				return k, true
+			}
+		}
+
+		k, ok := o.keys[kid]
+		return k, ok
+	}
+
+	if k, ok := lookup(); ok {
+		return k, nil
+	}
+
+	// Keys get rotated, so unknown ids are looked up again, but not too often.
+	if time.Since(o.keysAt) < oidcKeysRefresh {
+		return nil, ErrInvalidCredentials
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			Kid string `json:"kid"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, d.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("could not fetch oidc keys: %v", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	enc := base64.RawURLEncoding
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := enc.DecodeString(jwk.N)
+			e, errE := enc.DecodeString(jwk.E)
+			if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+				continue
+			}
+
+			exp := 0
+			for _, b := range e {
+				exp = exp<<8 | int(b)
+			}
+
+			keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}
+		case "EC":
+			x, errX := enc.DecodeString(jwk.X)
+			y, errY := enc.DecodeString(jwk.Y)
+			if jwk.Crv != "P-256" || errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+				continue
+			}
+
+			// Rejects points off the curve.
+			if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+				continue
+			}
+
+			keys[jwk.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+
+	o.keys, o.keysAt = keys, time.Now()
+	if k, ok := lookup(); ok {
+		return k, nil
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+func getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with status %d", u, res.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, maxOIDCResponse)).Decode(v)
+}
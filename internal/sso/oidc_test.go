@@ -0,0 +1,336 @@
+package sso
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID = "socnet"
+	testNonce    = "nonce"
+)
+
+// testProvider is an OpenID Connect provider signing ID tokens with its keys.
+type testProvider struct {
+	*httptest.Server
+	mu   sync.Mutex
+	keys map[string]crypto.Signer
+	// idToken the token endpoint responds with.
+	idToken string
+}
+
+func newTestProvider(t *testing.T, keys map[string]crypto.Signer) *testProvider {
+	t.Helper()
+
+	p := &testProvider{keys: keys}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                p.URL,
+			AuthorizationEndpoint: p.URL + "/authorize",
+			TokenEndpoint:         p.URL + "/token",
+			JWKSURI:               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		enc := base64.RawURLEncoding
+		var jwks []map[string]string
+		for kid, k := range p.keys {
+			switch pub := k.Public().(type) {
+			case *rsa.PublicKey:
+				jwks = append(jwks, map[string]string{
+					"kty": "RSA",
+					"kid": kid,
+					"n":   enc.EncodeToString(pub.N.Bytes()),
+					"e":   enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+				})
+			case *ecdsa.PublicKey:
+				jwks = append(jwks, map[string]string{
+					"kty": "EC",
+					"use": "sig",
+					"kid": kid,
+					"crv": "P-256",
+					"x":   enc.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+					"y":   enc.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+				})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": jwks})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != testClientID || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		if r.PostFormValue("code") != "code" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.idToken})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *testProvider) client() *OIDC {
+	return &OIDC{Issuer: p.URL, ClientID: testClientID, ClientSecret: "secret", RedirectURL: "https://socnet.example/oidc"}
+}
+
+// claims valid for the test client.
+func (p *testProvider) claims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":                p.URL,
+		"aud":                testClientID,
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"nonce":              testNonce,
+		"email":              "alice@example.org",
+		"email_verified":     true,
+		"preferred_username": "alice",
+		"groups":             []string{"admins", "staff"},
+	}
+}
+
+// sign a token with the key kid, or with another key under that id if key is set.
+func (p *testProvider) sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+
+	if key == nil {
+		p.mu.Lock()
+		key = p.keys[kid]
+		p.mu.Unlock()
+	}
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+
+	enc := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("could not marshal jwt part: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	signed := enc(header) + "." + enc(claims)
+	hash := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:]); err != nil {
+			t.Fatalf("could not sign jwt: %v", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, hash[:])
+		if err != nil {
+			t.Fatalf("could not sign jwt: %v", err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func testKeys(t *testing.T) (*rsa.PrivateKey, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate rsa key: %v", err)
+	}
+
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate ecdsa key: %v", err)
+	}
+
+	return rk, ek
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	rk, ek := testKeys(t)
+	other, _ := testKeys(t)
+	p := newTestProvider(t, map[string]crypto.Signer{"rsa": rk, "ec": ek})
+
+	with := func(change func(claims map[string]interface{})) map[string]interface{} {
+		claims := p.claims()
+		change(claims)
+		return claims
+	}
+
+	tampered := p.sign(t, "RS256", "rsa", nil, p.claims())
+	parts := strings.Split(tampered, ".")
+	payload, _ := json.Marshal(with(func(c map[string]interface{}) { c["email"] = "mallory@example.org" }))
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+	tampered = strings.Join(parts, ".")
+
+	parts = strings.Split(p.sign(t, "RS256", "rsa", nil, p.claims()), ".")
+	unsigned := parts[0] + "." + parts[1] + "."
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"rsa"}`)) + "." + parts[1] + "."
+
+	tests := []struct {
+		name  string
+		token string
+		trust bool
+		ok    bool
+	}{
+		{name: "RS256", token: p.sign(t, "RS256", "rsa", nil, p.claims()), ok: true},
+		{name: "ES256", token: p.sign(t, "ES256", "ec", nil, p.claims()), ok: true},
+		{name: "alg none", token: none},
+		{name: "empty signature", token: unsigned},
+		{name: "alg HS256", token: p.sign(t, "HS256", "rsa", nil, p.claims())},
+		{name: "alg of another key type", token: p.sign(t, "ES256", "rsa", nil, p.claims())},
+		{name: "unknown kid", token: p.sign(t, "RS256", "other", other, p.claims())},
+		{name: "no kid with several keys", token: p.sign(t, "RS256", "", rk, p.claims())},
+		{name: "signed by another key", token: p.sign(t, "RS256", "rsa", other, p.claims())},
+		{name: "tampered payload", token: tampered},
+		{name: "not a jwt", token: "a.b"},
+		{name: "wrong issuer", token: p.sign(t, "RS256", "rsa", nil, with(func(c map[string]interface{}) { c["iss"] = "https://evil.example" }))},
+		{name: "wrong audience", token: p.sign(t, "RS256", "rsa", nil, with(func(c map[string]interface{}) { c["aud"] = "other" }))},
+		{name: "audience list without azp", token: p.sign(t, "RS256", "rsa", nil, with(func(c map[string]interface{}) { c["aud"] = []string{testClientID, "other"} }))},
+		{
+			name: "audience list with another azp",
+			token: p.sign(t, "RS256", "rsa", nil, with(func(c map[string]interface{}) {
+				c["aud"], c["azp"] = []string{testClientID, "other"}, "other"
+			})),
+		},
+		{
+			name: "audience list with azp",
+			token: p.sign(t, "RS256", "rsa", nil, with(func(c map[string]interface{}) {
+				c["aud"], c["azp"] = []string{testClientID, "other"}, testClientID
+			})),
+			ok: true,
+		},
+		{name: "expired", token: p.sign(t, "RS256", "rsa", nil, with(func(c map[string]interface{}) { c["exp"] = time.Now().Add(-2 * oidcLeeway).Unix() }))},
+		{name: "expired within leeway", token: p.sign(t, "RS256", "rsa", nil, with(func(c map[string]interface{}) { c["exp"] = time.Now().Add(-oidcLeeway / 2).Unix() })), ok: true},
+		{name: "no exp", token: p.sign(t, "RS256", "rsa", nil, with(func(c map[string]interface{}) { delete(c, "exp") }))},
+		{name: "wrong nonce", token: p.sign(t, "RS256", "rsa", nil, with(func(c map[string]interface{}) { c["nonce"] = "other" }))},
+		{name: "no nonce", token: p.sign(t, "RS256", "rsa", nil, with(func(c map[string]interface{}) { delete(c, "nonce") }))},
+		{name: "no email", token: p.sign(t, "RS256", "rsa", nil, with(func(c map[string]interface{}) { delete(c, "email") }))},
+		{name: "email unverified", token: p.sign(t, "RS256", "rsa", nil, with(func(c map[string]interface{}) { c["email_verified"] = false }))},
+		{name: "no email_verified", token: p.sign(t, "RS256", "rsa", nil, with(func(c map[string]interface{}) { delete(c, "email_verified") }))},
+		{name: "no email_verified trusted", token: p.sign(t, "RS256", "rsa", nil, with(func(c map[string]interface{}) { delete(c, "email_verified") })), trust: true, ok: true},
+		{name: "email unverified trusted", token: p.sign(t, "RS256", "rsa", nil, with(func(c map[string]interface{}) { c["email_verified"] = false })), trust: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := p.client()
+			o.TrustUnverifiedEmail = tt.trust
+
+			ctx := context.Background()
+			d, err := o.discover(ctx)
+			if err != nil {
+				t.Fatalf("could not discover provider: %v", err)
+			}
+
+			id, err := o.verifyIDToken(ctx, d, tt.token, testNonce)
+			if !tt.ok {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Errorf("verifyIDToken() = %+v, %v, want %v", id, err, ErrInvalidCredentials)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("verifyIDToken() error = %v", err)
+			}
+
+			want := Identity{Email: "alice@example.org", Username: "alice", Groups: []string{"admins", "staff"}}
+			if !reflect.DeepEqual(id, want) {
+				t.Errorf("verifyIDToken() = %+v, want %+v", id, want)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenSingleKey(t *testing.T) {
+	_, ek := testKeys(t)
+	p := newTestProvider(t, map[string]crypto.Signer{"ec": ek})
+	o := p.client()
+
+	ctx := context.Background()
+	d, err := o.discover(ctx)
+	if err != nil {
+		t.Fatalf("could not discover provider: %v", err)
+	}
+
+	// Providers with a single key may leave the kid out.
+	if _, err = o.verifyIDToken(ctx, d, p.sign(t, "ES256", "", ek, p.claims()), testNonce); err != nil {
+		t.Errorf("verifyIDToken() without kid error = %v", err)
+	}
+
+	// Keys rotated since they were fetched are only looked up again after a while.
+	_, rotated := testKeys(t)
+	p.mu.Lock()
+	p.keys["rotated"] = rotated
+	p.mu.Unlock()
+	token := p.sign(t, "ES256", "rotated", nil, p.claims())
+	if _, err = o.verifyIDToken(ctx, d, token, testNonce); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("verifyIDToken() with a key just rotated error = %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	o.keysAt = o.keysAt.Add(-oidcKeysRefresh)
+	if _, err = o.verifyIDToken(ctx, d, token, testNonce); err != nil {
+		t.Errorf("verifyIDToken() with a rotated key error = %v", err)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	rk, _ := testKeys(t)
+	p := newTestProvider(t, map[string]crypto.Signer{"rsa": rk})
+	p.idToken = p.sign(t, "RS256", "rsa", nil, p.claims())
+	o := p.client()
+	ctx := context.Background()
+
+	id, err := o.Exchange(ctx, "code", testNonce)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	if id.Email != "alice@example.org" {
+		t.Errorf("Exchange() email = %q, want %q", id.Email, "alice@example.org")
+	}
+
+	if _, err = o.Exchange(ctx, "used code", testNonce); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Exchange() with an invalid code error = %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	if _, err = o.Exchange(ctx, "code", "other nonce"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Exchange() with another nonce error = %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	o = p.client()
+	o.ClientSecret = "wrong"
+	if _, err = o.Exchange(ctx, "code", testNonce); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Exchange() with a wrong client secret error = %v, want a provider error", err)
+	}
+}
@@ -0,0 +1,24 @@
+// Package sso authenticates users with an enterprise identity provider:
+// an LDAP directory or an OpenID Connect provider.
+package sso
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrInvalidCredentials used when the provider doesn't authenticate the user.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+var httpClient = &http.Client{Timeout: time.Second * 10}
+
+// Identity of a user authenticated by the provider.
+type Identity struct {
+	Email string
+	// Username is the one known to the provider, if any.
+	// It may not be valid on socnet.
+	Username string
+	// Groups the user is a member of, to map to roles.
+	Groups []string
+}
@@ -0,0 +1,179 @@
+// Package testutil provides a disposable Postgres database
+// and factories for integration tests against the service.
+package testutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/djomlaa/socnet"
+	"github.com/djomlaa/socnet/internal/service"
+	"github.com/djomlaa/socnet/internal/validation"
+	"github.com/hako/branca"
+	// postgres driver.
+	_ "github.com/lib/pq"
+	"github.com/ory/dockertest/v3"
+)
+
+const (
+	// postgresImage comes with PostGIS, which the schema needs for places.
+	postgresImage = "postgis/postgis"
+	postgresTag   = "15-3.4-alpine"
+	// containerTTL bounds how long a container outlives a crashed test run.
+	containerTTL = 300
+)
+
+// NewDB starts a disposable Postgres container, applies the schema
+// and returns a connection to it. The container is removed when the test ends.
+// Tests are skipped in short mode or when docker is not available.
+func NewDB(t testing.TB) *sql.DB {
+	t.Helper()
+
+	db := NewEmptyDB(t)
+	if _, err := db.Exec(socnet.Schema); err != nil {
+		t.Fatalf("could not apply schema: %v", err)
+	}
+
+	return db
+}
+
+// NewEmptyDB is like NewDB but leaves the database empty, for restoring backups.
+func NewEmptyDB(t testing.TB) *sql.DB {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		t.Skipf("could not connect to docker: %v", err)
+	}
+
+	pool.MaxWait = time.Minute
+
+	resource, err := pool.Run(postgresImage, postgresTag, []string{
+		"POSTGRES_USER=postgres",
+		"POSTGRES_PASSWORD=postgres",
+		"POSTGRES_DB=postgres",
+	})
+	if err != nil {
+		t.Skipf("could not start postgres container: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := pool.Purge(resource); err != nil {
+			t.Logf("could not purge postgres container: %v", err)
+		}
+	})
+
+	resource.Expire(containerTTL)
+
+	dsn := fmt.Sprintf("host=localhost port=%s user=postgres password=postgres dbname=postgres sslmode=disable search_path=socnet,public",
+		resource.GetPort("5432/tcp"))
+
+	var db *sql.DB
+	err = pool.Retry(func() error {
+		var err error
+		db, err = sql.Open("postgres", dsn)
+		if err != nil {
+			return err
+		}
+
+		return db.Ping()
+	})
+	if err != nil {
+		t.Fatalf("could not connect to postgres: %v", err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// NewService returns a service backed by a fresh database.
+func NewService(t testing.TB) (*service.Service, *sql.DB) {
+	t.Helper()
+
+	db := NewDB(t)
+	codec := branca.NewBranca("supersecretkeyyoushouldnotcommit")
+	codec.SetTTL(uint32(service.TokenLifespan.Seconds()))
+
+	return service.New(service.Config{DB: db, Codec: codec, Origin: "http://localhost"}), db
+}
+
+// AuthContext returns a context authenticated as the given user.
+func AuthContext(uid int64) context.Context {
+	return context.WithValue(context.Background(), service.KeyAuthUserID, uid)
+}
+
+// CreateUser inserts a user with an email derived from the username.
+func CreateUser(t testing.TB, db *sql.DB, username string) int64 {
+	t.Helper()
+
+	var uid int64
+	query := "INSERT INTO users (email, username, username_skeleton) VALUES ($1, $2, $3) RETURNING id"
+	if err := db.QueryRow(query, username+"@example.org", username, validation.UsernameSkeleton(username)).Scan(&uid); err != nil {
+		t.Fatalf("could not insert user %s: %v", username, err)
+	}
+
+	return uid
+}
+
+// CreatePost inserts a post without fanning it out.
+func CreatePost(t testing.TB, db *sql.DB, uid int64, content string) int64 {
+	t.Helper()
+
+	var pid int64
+	query := "INSERT INTO posts (user_id, content) VALUES ($1, $2) RETURNING id"
+	if err := db.QueryRow(query, uid, content).Scan(&pid); err != nil {
+		t.Fatalf("could not insert post: %v", err)
+	}
+
+	return pid
+}
+
+// Follow inserts a follow and updates both users counters.
+func Follow(t testing.TB, db *sql.DB, followerID, followeeID int64) {
+	t.Helper()
+
+	query := "INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2)"
+	if _, err := db.Exec(query, followerID, followeeID); err != nil {
+		t.Fatalf("could not insert follow: %v", err)
+	}
+
+	query = `INSERT INTO user_stats (user_id, followees_count) VALUES ($1, 1)
+		ON CONFLICT (user_id) DO UPDATE SET followees_count = user_stats.followees_count + 1`
+	if _, err := db.Exec(query, followerID); err != nil {
+		t.Fatalf("could not update followees count: %v", err)
+	}
+
+	query = `INSERT INTO user_stats (user_id, followers_count) VALUES ($1, 1)
+		ON CONFLICT (user_id) DO UPDATE SET followers_count = user_stats.followers_count + 1`
+	if _, err := db.Exec(query, followeeID); err != nil {
+		t.Fatalf("could not update followers count: %v", err)
+	}
+}
+
+// Eventually retries fn until it succeeds or the timeout passes,
+// for asserting on side effects that happen in background goroutines like the post fanout.
+func Eventually(t testing.TB, timeout time.Duration, fn func() error) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := fn()
+		if err == nil {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met after %s: %v", timeout, err)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
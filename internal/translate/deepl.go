@@ -0,0 +1,68 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const deeplBaseURL = "https://api-free.deepl.com"
+
+// DeepL translator.
+type DeepL struct {
+	APIKey string
+	// BaseURL defaults to the free API.
+	BaseURL string
+}
+
+// Translate text using DeepL.
+func (t *DeepL) Translate(ctx context.Context, text, targetLang string) (Translation, error) {
+	var out Translation
+	baseURL := t.BaseURL
+	if baseURL == "" {
+		baseURL = deeplBaseURL
+	}
+
+	form := url.Values{}
+	form.Set("text", text)
+	form.Set("target_lang", strings.ToUpper(targetLang))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/v2/translate", strings.NewReader(form.Encode()))
+	if err != nil {
+		return out, fmt.Errorf("could not create deepl request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "DeepL-Auth-Key "+t.APIKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return out, fmt.Errorf("could not do deepl request: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	if err = checkResponse(res); err != nil {
+		return out, err
+	}
+
+	var body struct {
+		Translations []struct {
+			DetectedSourceLanguage string `json:"detected_source_language"`
+			Text                   string `json:"text"`
+		} `json:"translations"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return out, fmt.Errorf("could not decode deepl response: %v", err)
+	}
+
+	if len(body.Translations) == 0 {
+		return out, errors.New("deepl returned no translations")
+	}
+
+	out.Text = body.Translations[0].Text
+	out.SourceLang = strings.ToLower(body.Translations[0].DetectedSourceLanguage)
+	return out, nil
+}
@@ -0,0 +1,70 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const googleBaseURL = "https://translation.googleapis.com"
+
+// Google Cloud Translation (v2) translator.
+type Google struct {
+	APIKey  string
+	BaseURL string
+}
+
+// Translate text using Google Cloud Translation.
+func (t *Google) Translate(ctx context.Context, text, targetLang string) (Translation, error) {
+	var out Translation
+	baseURL := t.BaseURL
+	if baseURL == "" {
+		baseURL = googleBaseURL
+	}
+
+	form := url.Values{}
+	form.Set("q", text)
+	form.Set("target", targetLang)
+	form.Set("format", "text")
+	endpoint := baseURL + "/language/translate/v2?key=" + url.QueryEscape(t.APIKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return out, fmt.Errorf("could not create google translate request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return out, fmt.Errorf("could not do google translate request: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	if err = checkResponse(res); err != nil {
+		return out, err
+	}
+
+	var body struct {
+		Data struct {
+			Translations []struct {
+				TranslatedText         string `json:"translatedText"`
+				DetectedSourceLanguage string `json:"detectedSourceLanguage"`
+			} `json:"translations"`
+		} `json:"data"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return out, fmt.Errorf("could not decode google translate response: %v", err)
+	}
+
+	if len(body.Data.Translations) == 0 {
+		return out, errors.New("google translate returned no translations")
+	}
+
+	out.Text = body.Data.Translations[0].TranslatedText
+	out.SourceLang = strings.ToLower(body.Data.Translations[0].DetectedSourceLanguage)
+	return out, nil
+}
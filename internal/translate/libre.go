@@ -0,0 +1,70 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const libreBaseURL = "https://libretranslate.com"
+
+// Libre translator for LibreTranslate instances.
+type Libre struct {
+	// APIKey is optional on self hosted instances.
+	APIKey  string
+	BaseURL string
+}
+
+// Translate text using LibreTranslate.
+func (t *Libre) Translate(ctx context.Context, text, targetLang string) (Translation, error) {
+	var out Translation
+	baseURL := t.BaseURL
+	if baseURL == "" {
+		baseURL = libreBaseURL
+	}
+
+	b, err := json.Marshal(map[string]string{
+		"q":       text,
+		"source":  "auto",
+		"target":  targetLang,
+		"format":  "text",
+		"api_key": t.APIKey,
+	})
+	if err != nil {
+		return out, fmt.Errorf("could not marshal libretranslate request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/translate", bytes.NewReader(b))
+	if err != nil {
+		return out, fmt.Errorf("could not create libretranslate request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return out, fmt.Errorf("could not do libretranslate request: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	if err = checkResponse(res); err != nil {
+		return out, err
+	}
+
+	var body struct {
+		TranslatedText   string `json:"translatedText"`
+		DetectedLanguage struct {
+			Language string `json:"language"`
+		} `json:"detectedLanguage"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return out, fmt.Errorf("could not decode libretranslate response: %v", err)
+	}
+
+	out.Text = body.TranslatedText
+	out.SourceLang = strings.ToLower(body.DetectedLanguage.Language)
+	return out, nil
+}
@@ -0,0 +1,59 @@
+// Package translate translates post content through third party providers.
+package translate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Supported providers.
+const (
+	ProviderDeepL  = "deepl"
+	ProviderGoogle = "google"
+	ProviderLibre  = "libre"
+)
+
+// ErrUnknownProvider used when the configured provider is not supported.
+var ErrUnknownProvider = errors.New("unknown translation provider")
+
+// Translation of a text.
+type Translation struct {
+	Text string
+	// SourceLang is the language detected by the provider, lowercased.
+	SourceLang string
+}
+
+// Translator translates text into the target language, detecting the source one.
+type Translator interface {
+	Translate(ctx context.Context, text, targetLang string) (Translation, error)
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// New translator for the given provider.
+// An empty provider returns a nil Translator.
+func New(provider, apiKey, baseURL string) (Translator, error) {
+	switch provider {
+	case "":
+		return nil, nil
+	case ProviderDeepL:
+		return &DeepL{APIKey: apiKey, BaseURL: baseURL}, nil
+	case ProviderGoogle:
+		return &Google{APIKey: apiKey, BaseURL: baseURL}, nil
+	case ProviderLibre:
+		return &Libre{APIKey: apiKey, BaseURL: baseURL}, nil
+	}
+
+	return nil, ErrUnknownProvider
+}
+
+func checkResponse(res *http.Response) error {
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("translation provider responded with %s", res.Status)
+	}
+
+	return nil
+}
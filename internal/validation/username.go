@@ -0,0 +1,111 @@
+package validation
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// usernameScripts a username letter can be written in. A username must use a
+// single one, except for the mixes listed in usernameScriptMixes.
+var usernameScripts = map[string]*unicode.RangeTable{
+	"Latin":      unicode.Latin,
+	"Cyrillic":   unicode.Cyrillic,
+	"Greek":      unicode.Greek,
+	"Arabic":     unicode.Arabic,
+	"Hebrew":     unicode.Hebrew,
+	"Devanagari": unicode.Devanagari,
+	"Thai":       unicode.Thai,
+	"Hangul":     unicode.Hangul,
+	"Han":        unicode.Han,
+	"Hiragana":   unicode.Hiragana,
+	"Katakana":   unicode.Katakana,
+}
+
+// usernameScriptMixes are the scripts commonly written together.
+var usernameScriptMixes = []map[string]bool{
+	{"Han": true, "Hiragana": true, "Katakana": true},
+	{"Han": true, "Hangul": true},
+}
+
+// confusables maps lowercase letters to the Latin letter or digit they are
+// visually identical to, so lookalike handles share a skeleton.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'г': 'r', 'е': 'e', 'ё': 'e', 'з': '3', 'і': 'i', 'ј': 'j',
+	'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'п': 'n', 'р': 'p', 'с': 'c', 'т': 't',
+	'у': 'y', 'х': 'x', 'ѕ': 's', 'һ': 'h', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ү': 'y',
+	'ө': 'o', 'ӏ': 'l', 'ь': 'b',
+	// Greek
+	'α': 'a', 'β': 'b', 'γ': 'y', 'ε': 'e', 'ζ': 'z', 'η': 'n', 'ι': 'i', 'κ': 'k',
+	'μ': 'm', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+	'ϲ': 'c',
+	// Latin
+	'ı': 'i', 'ɡ': 'g', 'ɑ': 'a',
+	// Digits
+	'0': 'o', '1': 'l',
+}
+
+// NormalizeUsername trims the username and puts it in NFC form,
+// the form usernames are stored and looked up with.
+func NormalizeUsername(username string) string {
+	return norm.NFC.String(strings.TrimSpace(username))
+}
+
+// UsernameSkeleton of a username. Usernames that look the same share a skeleton,
+// regardless of case, compatibility forms or lookalike letters of other scripts.
+func UsernameSkeleton(username string) string {
+	s := norm.NFKC.String(strings.ToLower(username))
+	return strings.Map(func(r rune) rune {
+		if c, ok := confusables[r]; ok {
+			return c
+		}
+
+		return r
+	}, s)
+}
+
+// singleScript reports whether the letters of username are written in one of
+// usernameScripts, or in one of usernameScriptMixes.
+func singleScript(username string) bool {
+	used := map[string]bool{}
+	for _, r := range username {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+
+		var found bool
+		for name, table := range usernameScripts {
+			if unicode.Is(table, r) {
+				used[name] = true
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if len(used) <= 1 {
+		return true
+	}
+
+	for _, mix := range usernameScriptMixes {
+		inMix := true
+		for name := range used {
+			if !mix[name] {
+				inMix = false
+				break
+			}
+		}
+
+		if inMix {
+			return true
+		}
+	}
+
+	return false
+}
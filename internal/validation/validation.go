@@ -0,0 +1,161 @@
+// Package validation checks user input, collecting every invalid field
+// so clients get them all at once.
+package validation
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Length limits in runes.
+const (
+	MaxPostLength    = 480
+	MaxCommentLength = 480
+	MaxSpoilerLength = 64
+	MaxNameLength    = 64
+	MaxAltTextLength = 1500
+	MaxPlaceLength   = 100
+)
+
+// MaxAutoDeleteDays a user can keep posts for before they are auto deleted.
+const MaxAutoDeleteDays = 3650
+
+// MaxPostMedia is how many media items can be attached to a post.
+const MaxPostMedia = 4
+
+// MaxInterests a user can tag their profile with.
+const MaxInterests = 10
+
+// Page size limits.
+const (
+	MinPageSize     = 1
+	DefaultPageSize = 10
+	MaxPageSize     = 99
+)
+
+var (
+	reEmail     = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
+	reUsername  = regexp.MustCompile(`^\p{L}\p{M}*(?:[\p{L}0-9_-]\p{M}*){0,17}$`)
+	reSlug      = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,31}$`)
+	reShortcode = regexp.MustCompile(`^[a-zA-Z0-9_]{2,32}$`)
+	reKeyword   = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}_]{2,32}$`)
+	reLang      = regexp.MustCompile(`^[a-z]{2,3}(-[a-z]{2,4})?$`)
+)
+
+// FieldError tells why a field is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors of an input, one per invalid field.
+type Errors []FieldError
+
+func (ee Errors) Error() string {
+	ss := make([]string, len(ee))
+	for i, e := range ee {
+		ss[i] = e.Field + ": " + e.Message
+	}
+
+	return strings.Join(ss, ", ")
+}
+
+// Validator collects field errors. The zero value is ready to use.
+type Validator struct {
+	errs Errors
+}
+
+// Check records message for field when ok is false.
+// Only the first error of each field is kept.
+func (v *Validator) Check(ok bool, field, message string) {
+	if ok {
+		return
+	}
+
+	for _, e := range v.errs {
+		if e.Field == field {
+			return
+		}
+	}
+
+	v.errs = append(v.errs, FieldError{Field: field, Message: message})
+}
+
+// Email checks the email format.
+func (v *Validator) Email(field, email string) {
+	v.Check(reEmail.MatchString(email), field, "invalid email")
+}
+
+// Username checks the username format: up to 18 letters, digits, _ or -
+// starting with a letter, in NFC form and written in a single script.
+func (v *Validator) Username(field, username string) {
+	v.Check(reUsername.MatchString(username), field, "invalid username")
+	v.Check(norm.NFC.IsNormalString(username), field, "invalid username")
+	v.Check(singleScript(username), field, "cannot mix scripts")
+}
+
+// Slug checks a lowercase url friendly name.
+func (v *Validator) Slug(field, slug string) {
+	v.Check(reSlug.MatchString(slug), field, "must be 2 to 32 lowercase letters, digits, _ or -")
+}
+
+// Shortcode checks a custom emoji shortcode, without the surrounding colons.
+func (v *Validator) Shortcode(field, shortcode string) {
+	v.Check(reShortcode.MatchString(shortcode), field, "must be 2 to 32 letters, digits or _")
+}
+
+// Keyword checks a single lowercase word.
+func (v *Validator) Keyword(field, keyword string) {
+	v.Check(reKeyword.MatchString(keyword), field, "must be a single lowercase word of 2 to 32 characters")
+}
+
+// Lang checks a lowercase language code like "en" or "pt-br".
+func (v *Validator) Lang(field, lang string) {
+	v.Check(reLang.MatchString(lang), field, "invalid language code")
+}
+
+// Content checks s is not empty and at most max runes long.
+func (v *Validator) Content(field, s string, max int) {
+	v.Check(s != "", field, "cannot be empty")
+	v.Check(utf8.RuneCountInString(s) <= max, field, "too long")
+}
+
+// Cursor checks a pagination cursor is not negative.
+func (v *Validator) Cursor(field string, id int64) {
+	v.Check(id >= 0, field, "invalid cursor")
+}
+
+// Coordinates checks latitude and longitude are within the range of the globe.
+func (v *Validator) Coordinates(field string, latitude, longitude float64) {
+	v.Check(latitude >= -90 && latitude <= 90, field, "latitude out of range")
+	v.Check(longitude >= -180 && longitude <= 180, field, "longitude out of range")
+}
+
+// Err returns the collected errors, or nil when the input is valid.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+
+	return v.errs
+}
+
+// PageSize clamps a requested page size, using the default for zero.
+func PageSize(i int) int {
+	if i == 0 {
+		return DefaultPageSize
+	}
+
+	if i < MinPageSize {
+		return MinPageSize
+	}
+
+	if i > MaxPageSize {
+		return MaxPageSize
+	}
+
+	return i
+}
@@ -0,0 +1,317 @@
+// Package webauthn verifies the passkey ceremonies of the Web Authentication API:
+// registering a credential and asserting it to log in. Attestation is not asked
+// for, so attestation statements are not verified; the credential public key is
+// trusted on registration, as with the "none" attestation format.
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// COSE algorithms supported, in order of preference.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// Authenticator data flags.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// Algorithms supported, to list in the credential creation options.
+var Algorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+var (
+	// ErrInvalid used when a ceremony response is malformed or doesn't match what was asked.
+	ErrInvalid = errors.New("invalid webauthn response")
+	// ErrSignature used when an assertion signature doesn't verify.
+	ErrSignature = errors.New("invalid webauthn signature")
+	// ErrCloned used when the signature counter went backwards,
+	// which hints at a cloned authenticator.
+	ErrCloned = errors.New("webauthn signature counter went backwards")
+)
+
+// Base64URL is binary data encoded as unpadded base64url in JSON,
+// like WebAuthn clients encode it.
+type Base64URL []byte
+
+// MarshalJSON as unpadded base64url.
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON from base64url, padded or not.
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	d, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+
+	*b = d
+	return nil
+}
+
+// RelyingParty the credentials are scoped to.
+type RelyingParty struct {
+	// ID is the domain of the origin, or a registrable suffix of it.
+	ID string
+	// Origin the ceremonies must run on, like https://example.org.
+	Origin string
+}
+
+// Credential registered by an authenticator.
+type Credential struct {
+	ID []byte
+	// PublicKey is COSE encoded.
+	PublicKey []byte
+	SignCount uint32
+}
+
+// Registration is the response of navigator.credentials.create().
+type Registration struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AttestationObject Base64URL `json:"attestationObject"`
+}
+
+// Assertion is the response of navigator.credentials.get().
+type Assertion struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AuthenticatorData Base64URL `json:"authenticatorData"`
+	Signature         Base64URL `json:"signature"`
+	// UserHandle is the user id given on registration, for discoverable credentials.
+	UserHandle Base64URL `json:"userHandle"`
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// VerifyRegistration checks the response to the given challenge and returns the new credential.
+// The user must have been verified by the authenticator.
+func (rp RelyingParty) VerifyRegistration(challenge []byte, r Registration) (Credential, error) {
+	var c Credential
+	if err := rp.verifyClientData(r.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return c, err
+	}
+
+	v, _, err := decodeCBOR(r.AttestationObject)
+	if err != nil {
+		return c, ErrInvalid
+	}
+
+	obj, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return c, ErrInvalid
+	}
+
+	raw, ok := obj["authData"].([]byte)
+	if !ok {
+		return c, ErrInvalid
+	}
+
+	ad, err := rp.parseAuthenticatorData(raw)
+	if err != nil {
+		return c, err
+	}
+
+	if ad.flags&flagAttested == 0 {
+		return c, ErrInvalid
+	}
+
+	if _, err = parsePublicKey(ad.publicKey); err != nil {
+		return c, err
+	}
+
+	c.ID = ad.credentialID
+	c.PublicKey = ad.publicKey
+	c.SignCount = ad.signCount
+	return c, nil
+}
+
+// VerifyAssertion checks the response to the given challenge against the stored
+// credential and returns its new signature counter. The user must have been verified
+// by the authenticator.
+func (rp RelyingParty) VerifyAssertion(challenge []byte, c Credential, a Assertion) (uint32, error) {
+	if err := rp.verifyClientData(a.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	ad, err := rp.parseAuthenticatorData(a.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	pub, err := parsePublicKey(c.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	hash := sha256.Sum256(a.ClientDataJSON)
+	signed := append(append([]byte(nil), a.AuthenticatorData...), hash[:]...)
+	if !verifySignature(pub, signed, a.Signature) {
+		return 0, ErrSignature
+	}
+
+	// Authenticators without a counter always report zero.
+	if (ad.signCount != 0 || c.SignCount != 0) && ad.signCount <= c.SignCount {
+		return 0, ErrCloned
+	}
+
+	return ad.signCount, nil
+}
+
+func (rp RelyingParty) verifyClientData(b []byte, typ string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(b, &cd); err != nil {
+		return ErrInvalid
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cd.Challenge, "="))
+	if err != nil || cd.Type != typ || cd.Origin != rp.Origin || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return ErrInvalid
+	}
+
+	return nil
+}
+
+func (rp RelyingParty) parseAuthenticatorData(b []byte) (authenticatorData, error) {
+	var ad authenticatorData
+	if len(b) < 37 {
+		return ad, ErrInvalid
+	}
+
+	ad.rpIDHash, ad.flags, ad.signCount = b[:32], b[32], binary.BigEndian.Uint32(b[33:37])
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, rpIDHash[:]) {
+		return ad, ErrInvalid
+	}
+
+	if ad.flags&flagUserPresent == 0 || ad.flags&flagUserVerified == 0 {
+		return ad, ErrInvalid
+	}
+
+	if ad.flags&flagAttested == 0 {
+		return ad, nil
+	}
+
+	// AAGUID then the credential id length.
+	rest := b[37:]
+	if len(rest) < 18 {
+		return ad, ErrInvalid
+	}
+
+	n := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if n == 0 || len(rest) < n {
+		return ad, ErrInvalid
+	}
+
+	ad.credentialID, rest = rest[:n], rest[n:]
+	_, keyLen, err := decodeCBOR(rest)
+	if err != nil {
+		return ad, ErrInvalid
+	}
+
+	ad.publicKey = rest[:keyLen]
+	return ad, nil
+}
+
+// parsePublicKey from its COSE encoding.
+func parsePublicKey(b []byte) (crypto.PublicKey, error) {
+	v, _, err := decodeCBOR(b)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	key, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrInvalid
+	}
+
+	alg, _ := key[int64(3)].(int64)
+	switch alg {
+	case AlgES256:
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if crv, _ := key[int64(-1)].(int64); crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, ErrInvalid
+		}
+
+		// Rejects points off the curve.
+		point := append(append([]byte{4}, x...), y...)
+		if _, err = ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, ErrInvalid
+		}
+
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case AlgEdDSA:
+		x, _ := key[int64(-2)].([]byte)
+		if crv, _ := key[int64(-1)].(int64); crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalid
+		}
+
+		return ed25519.PublicKey(x), nil
+	case AlgRS256:
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrInvalid
+		}
+
+		exp := 0
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}, nil
+	}
+
+	return nil, ErrInvalid
+}
+
+func verifySignature(pub crypto.PublicKey, signed, sig []byte) bool {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		hash := sha256.Sum256(signed)
+		return ecdsa.VerifyASN1(pub, hash[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, signed, sig)
+	case *rsa.PublicKey:
+		hash := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], sig) == nil
+	}
+	return false
+}
@@ -0,0 +1,449 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+var testRP = RelyingParty{ID: "example.org", Origin: "https://example.org"}
+
+// cborMap keeps the key order of the encoded map.
+type cborMap [][2]interface{}
+
+// encodeCBOR is the encoding counterpart of decodeCBOR, to build fixtures.
+func encodeCBOR(v interface{}) []byte {
+	head := func(major byte, arg uint64) []byte {
+		switch {
+		case arg < 24:
+			return []byte{major<<5 | byte(arg)}
+		case arg <= math.MaxUint8:
+			return []byte{major<<5 | 24, byte(arg)}
+		case arg <= math.MaxUint16:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+		case arg <= math.MaxUint32:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(arg))
+		}
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, arg)
+	}
+
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []interface{}:
+		b := head(4, uint64(len(v)))
+		for _, item := range v {
+			b = append(b, encodeCBOR(item)...)
+		}
+		return b
+	case cborMap:
+		b := head(5, uint64(len(v)))
+		for _, kv := range v {
+			b = append(b, encodeCBOR(kv[0])...)
+			b = append(b, encodeCBOR(kv[1])...)
+		}
+		return b
+	}
+	panic("unsupported cbor value")
+}
+
+// authenticator holds a credential key pair, signing like a real authenticator would.
+type authenticator struct {
+	alg  int
+	priv crypto.Signer
+}
+
+func newAuthenticator(t *testing.T, alg int) authenticator {
+	t.Helper()
+
+	var (
+		priv crypto.Signer
+		err  error
+	)
+	switch alg {
+	case AlgES256:
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+
+	return authenticator{alg: alg, priv: priv}
+}
+
+func (a authenticator) coseKey() []byte {
+	switch pub := a.priv.Public().(type) {
+	case *ecdsa.PublicKey:
+		return encodeCBOR(cborMap{
+			{1, 2},
+			{3, AlgES256},
+			{-1, 1},
+			{-2, pub.X.FillBytes(make([]byte, 32))},
+			{-3, pub.Y.FillBytes(make([]byte, 32))},
+		})
+	case ed25519.PublicKey:
+		return encodeCBOR(cborMap{{1, 1}, {3, AlgEdDSA}, {-1, 6}, {-2, []byte(pub)}})
+	case *rsa.PublicKey:
+		return encodeCBOR(cborMap{{1, 3}, {3, AlgRS256}, {-1, pub.N.Bytes()}, {-2, big.NewInt(int64(pub.E)).Bytes()}})
+	}
+	panic("unsupported key")
+}
+
+func (a authenticator) sign(t *testing.T, authData, clientDataJSON []byte) []byte {
+	t.Helper()
+
+	hash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authData...), hash[:]...)
+
+	var (
+		sig []byte
+		err error
+	)
+	if a.alg == AlgEdDSA {
+		sig, err = a.priv.Sign(rand.Reader, signed, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(signed)
+		sig, err = a.priv.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatalf("could not sign: %v", err)
+	}
+
+	return sig
+}
+
+func makeAuthData(rpID string, flags byte, signCount uint32, credentialID, publicKey []byte) []byte {
+	hash := sha256.Sum256([]byte(rpID))
+	b := append(hash[:], flags)
+	b = binary.BigEndian.AppendUint32(b, signCount)
+	if flags&flagAttested == 0 {
+		return b
+	}
+
+	b = append(b, make([]byte, 16)...) // AAGUID
+	b = binary.BigEndian.AppendUint16(b, uint16(len(credentialID)))
+	b = append(b, credentialID...)
+	return append(b, publicKey...)
+}
+
+func makeClientData(typ, origin string, challenge []byte) []byte {
+	b, _ := json.Marshal(clientData{
+		Type:      typ,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    origin,
+	})
+	return b
+}
+
+func makeAttestation(authData []byte) []byte {
+	return encodeCBOR(cborMap{{"fmt", "none"}, {"attStmt", cborMap{}}, {"authData", authData}})
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want interface{}
+		n    int
+	}{
+		{name: "small uint", in: []byte{0x17}, want: int64(23), n: 1},
+		{name: "uint8", in: []byte{0x18, 0xff}, want: int64(255), n: 2},
+		{name: "uint16", in: []byte{0x19, 0x01, 0x00}, want: int64(256), n: 3},
+		{name: "uint32", in: []byte{0x1a, 0, 1, 0, 0}, want: int64(65536), n: 5},
+		{name: "uint64", in: []byte{0x1b, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, want: int64(math.MaxInt64), n: 9},
+		{name: "negative", in: []byte{0x26}, want: int64(-7), n: 1},
+		{name: "negative uint16", in: []byte{0x39, 0x01, 0x00}, want: int64(-257), n: 3},
+		{name: "bytes", in: []byte{0x43, 1, 2, 3}, want: []byte{1, 2, 3}, n: 4},
+		{name: "text", in: []byte{0x62, 'h', 'i'}, want: "hi", n: 3},
+		{name: "array", in: []byte{0x82, 0x01, 0x61, 'a'}, want: []interface{}{int64(1), "a"}, n: 4},
+		{name: "map", in: []byte{0xa2, 0x01, 0x02, 0x61, 'k', 0xf5}, want: map[interface{}]interface{}{int64(1): int64(2), "k": true}, n: 6},
+		{name: "tag", in: []byte{0xc2, 0x41, 0x01}, want: []byte{1}, n: 3},
+		{name: "false", in: []byte{0xf4}, want: false, n: 1},
+		{name: "null", in: []byte{0xf6}, want: nil, n: 1},
+		{name: "float32", in: []byte{0xfa, 0x3f, 0xc0, 0, 0}, want: 1.5, n: 5},
+		{name: "float64", in: []byte{0xfb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, want: 1.5, n: 9},
+		{name: "trailing bytes", in: []byte{0x01, 0x02, 0x03}, want: int64(1), n: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, n, err := decodeCBOR(tt.in)
+			if err != nil {
+				t.Fatalf("decodeCBOR(%x) error = %v", tt.in, err)
+			}
+
+			if n != tt.n {
+				t.Errorf("decodeCBOR(%x) length = %d, want %d", tt.in, n, tt.n)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeCBOR(%x) = %#v, want %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	nested := bytes.Repeat([]byte{0x81}, maxCBORDepth+2)
+	nested = append(nested, 0x01)
+
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{name: "empty", in: nil},
+		{name: "truncated uint8", in: []byte{0x18}},
+		{name: "truncated uint16", in: []byte{0x19, 0x01}},
+		{name: "truncated uint32", in: []byte{0x1a, 0, 0, 1}},
+		{name: "truncated uint64", in: []byte{0x1b, 0, 0, 0, 0, 0, 0, 1}},
+		{name: "truncated bytes", in: []byte{0x43, 1, 2}},
+		{name: "truncated text", in: []byte{0x63, 'h', 'i'}},
+		{name: "truncated array", in: []byte{0x82, 0x01}},
+		{name: "truncated map", in: []byte{0xa1, 0x01}},
+		{name: "truncated tag", in: []byte{0xc2}},
+		{name: "over-long bytes", in: []byte{0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}},
+		{name: "over-long text", in: []byte{0x7a, 0xff, 0xff, 0xff, 0xff, 'a'}},
+		{name: "over-long array", in: []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "over-long map", in: []byte{0xba, 0xff, 0xff, 0xff, 0xff}},
+		{name: "uint overflow", in: []byte{0x1b, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+		{name: "negative overflow", in: []byte{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "indefinite bytes", in: []byte{0x5f, 0x41, 0x01, 0xff}},
+		{name: "indefinite array", in: []byte{0x9f, 0x01, 0xff}},
+		{name: "reserved info", in: []byte{0x1c}},
+		{name: "array key", in: []byte{0xa1, 0x80, 0x01}},
+		{name: "float16", in: []byte{0xf9, 0x3c, 0x00}},
+		{name: "too deep", in: nested},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v, _, err := decodeCBOR(tt.in); err == nil {
+				t.Errorf("decodeCBOR(%x) = %#v, want error", tt.in, v)
+			}
+		})
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	ec := newAuthenticator(t, AlgES256).priv.Public().(*ecdsa.PublicKey)
+	x, y := ec.X.FillBytes(make([]byte, 32)), ec.Y.FillBytes(make([]byte, 32))
+	offCurve := append([]byte(nil), y...)
+	offCurve[31] ^= 1
+
+	rs := newAuthenticator(t, AlgRS256).priv.Public().(*rsa.PublicKey)
+
+	tests := []struct {
+		name string
+		key  []byte
+	}{
+		{name: "not a map", key: encodeCBOR([]interface{}{1})},
+		{name: "truncated", key: encodeCBOR(cborMap{{3, AlgES256}, {-2, x}})[:10]},
+		{name: "unknown alg", key: encodeCBOR(cborMap{{3, -35}, {-1, 2}, {-2, x}, {-3, y}})},
+		{name: "ES256 wrong curve", key: encodeCBOR(cborMap{{3, AlgES256}, {-1, 2}, {-2, x}, {-3, y}})},
+		{name: "ES256 short coordinate", key: encodeCBOR(cborMap{{3, AlgES256}, {-1, 1}, {-2, x[1:]}, {-3, y}})},
+		{name: "ES256 off curve", key: encodeCBOR(cborMap{{3, AlgES256}, {-1, 1}, {-2, x}, {-3, offCurve}})},
+		{name: "EdDSA wrong curve", key: encodeCBOR(cborMap{{3, AlgEdDSA}, {-1, 4}, {-2, make([]byte, 32)}})},
+		{name: "EdDSA short key", key: encodeCBOR(cborMap{{3, AlgEdDSA}, {-1, 6}, {-2, make([]byte, 31)}})},
+		{name: "RS256 short modulus", key: encodeCBOR(cborMap{{3, AlgRS256}, {-1, rs.N.Bytes()[:128]}, {-2, []byte{1, 0, 1}}})},
+		{name: "RS256 no exponent", key: encodeCBOR(cborMap{{3, AlgRS256}, {-1, rs.N.Bytes()}, {-2, []byte{}}})},
+		{name: "RS256 long exponent", key: encodeCBOR(cborMap{{3, AlgRS256}, {-1, rs.N.Bytes()}, {-2, []byte{1, 0, 0, 0, 1}}})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parsePublicKey(tt.key); !errors.Is(err, ErrInvalid) {
+				t.Errorf("parsePublicKey() error = %v, want %v", err, ErrInvalid)
+			}
+		})
+	}
+}
+
+func TestCeremonies(t *testing.T) {
+	const verified = flagUserPresent | flagUserVerified
+
+	for _, alg := range Algorithms {
+		a := newAuthenticator(t, alg)
+		t.Run(map[int]string{AlgES256: "ES256", AlgEdDSA: "EdDSA", AlgRS256: "RS256"}[alg], func(t *testing.T) {
+			challenge := []byte("registration challenge")
+			credentialID := []byte("credential id")
+			reg := Registration{
+				ClientDataJSON:    makeClientData("webauthn.create", testRP.Origin, challenge),
+				AttestationObject: makeAttestation(makeAuthData(testRP.ID, verified|flagAttested, 0, credentialID, a.coseKey())),
+			}
+
+			c, err := testRP.VerifyRegistration(challenge, reg)
+			if err != nil {
+				t.Fatalf("VerifyRegistration() error = %v", err)
+			}
+
+			if !bytes.Equal(c.ID, credentialID) || !bytes.Equal(c.PublicKey, a.coseKey()) || c.SignCount != 0 {
+				t.Fatalf("VerifyRegistration() = %+v, want id %q and the authenticator key", c, credentialID)
+			}
+
+			challenge = []byte("login challenge")
+			assert := func(signCount uint32) Assertion {
+				cd := makeClientData("webauthn.get", testRP.Origin, challenge)
+				ad := makeAuthData(testRP.ID, verified, signCount, nil, nil)
+				return Assertion{ClientDataJSON: cd, AuthenticatorData: ad, Signature: a.sign(t, ad, cd)}
+			}
+
+			got, err := testRP.VerifyAssertion(challenge, c, assert(1))
+			if err != nil {
+				t.Fatalf("VerifyAssertion() error = %v", err)
+			}
+
+			if got != 1 {
+				t.Errorf("VerifyAssertion() sign count = %d, want 1", got)
+			}
+
+			tampered := assert(1)
+			tampered.Signature[len(tampered.Signature)/2] ^= 1
+			if _, err = testRP.VerifyAssertion(challenge, c, tampered); !errors.Is(err, ErrSignature) {
+				t.Errorf("VerifyAssertion() with a tampered signature error = %v, want %v", err, ErrSignature)
+			}
+
+			// The signature covers the client data.
+			swapped := assert(1)
+			swapped.ClientDataJSON = append(makeClientData("webauthn.get", testRP.Origin, challenge), ' ')
+			if _, err = testRP.VerifyAssertion(challenge, c, swapped); !errors.Is(err, ErrSignature) {
+				t.Errorf("VerifyAssertion() with other client data error = %v, want %v", err, ErrSignature)
+			}
+
+			other := c
+			other.PublicKey = newAuthenticator(t, alg).coseKey()
+			if _, err = testRP.VerifyAssertion(challenge, other, assert(1)); !errors.Is(err, ErrSignature) {
+				t.Errorf("VerifyAssertion() with another key error = %v, want %v", err, ErrSignature)
+			}
+		})
+	}
+}
+
+func TestVerifyRegistrationInvalid(t *testing.T) {
+	const verified = flagUserPresent | flagUserVerified
+
+	a := newAuthenticator(t, AlgES256)
+	challenge := []byte("challenge")
+	clientDataJSON := makeClientData("webauthn.create", testRP.Origin, challenge)
+	authData := makeAuthData(testRP.ID, verified|flagAttested, 0, []byte("id"), a.coseKey())
+
+	// Credential id length past the end of the authenticator data.
+	overLong := append([]byte(nil), authData...)
+	binary.BigEndian.PutUint16(overLong[53:55], 0xffff)
+
+	tests := []struct {
+		name           string
+		clientDataJSON []byte
+		attestation    []byte
+	}{
+		{name: "wrong type", clientDataJSON: makeClientData("webauthn.get", testRP.Origin, challenge), attestation: makeAttestation(authData)},
+		{name: "wrong origin", clientDataJSON: makeClientData("webauthn.create", "https://evil.example", challenge), attestation: makeAttestation(authData)},
+		{name: "wrong challenge", clientDataJSON: makeClientData("webauthn.create", testRP.Origin, []byte("other")), attestation: makeAttestation(authData)},
+		{name: "malformed client data", clientDataJSON: clientDataJSON[:len(clientDataJSON)-1], attestation: makeAttestation(authData)},
+		{name: "wrong rp id", clientDataJSON: clientDataJSON, attestation: makeAttestation(makeAuthData("evil.example", verified|flagAttested, 0, []byte("id"), a.coseKey()))},
+		{name: "user not verified", clientDataJSON: clientDataJSON, attestation: makeAttestation(makeAuthData(testRP.ID, flagUserPresent|flagAttested, 0, []byte("id"), a.coseKey()))},
+		{name: "user not present", clientDataJSON: clientDataJSON, attestation: makeAttestation(makeAuthData(testRP.ID, flagUserVerified|flagAttested, 0, []byte("id"), a.coseKey()))},
+		{name: "no attested credential", clientDataJSON: clientDataJSON, attestation: makeAttestation(makeAuthData(testRP.ID, verified, 0, nil, nil))},
+		{name: "empty credential id", clientDataJSON: clientDataJSON, attestation: makeAttestation(makeAuthData(testRP.ID, verified|flagAttested, 0, nil, a.coseKey()))},
+		{name: "over-long credential id", clientDataJSON: clientDataJSON, attestation: makeAttestation(overLong)},
+		{name: "truncated authenticator data", clientDataJSON: clientDataJSON, attestation: makeAttestation(authData[:36])},
+		{name: "truncated public key", clientDataJSON: clientDataJSON, attestation: makeAttestation(authData[:len(authData)-1])},
+		{name: "truncated attestation", clientDataJSON: clientDataJSON, attestation: makeAttestation(authData)[:40]},
+		{name: "attestation not a map", clientDataJSON: clientDataJSON, attestation: encodeCBOR([]interface{}{authData})},
+		{name: "missing authData", clientDataJSON: clientDataJSON, attestation: encodeCBOR(cborMap{{"fmt", "none"}})},
+		{name: "invalid public key", clientDataJSON: clientDataJSON, attestation: makeAttestation(makeAuthData(testRP.ID, verified|flagAttested, 0, []byte("id"), encodeCBOR(cborMap{{3, -35}})))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := testRP.VerifyRegistration(challenge, Registration{ClientDataJSON: tt.clientDataJSON, AttestationObject: tt.attestation})
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("VerifyRegistration() error = %v, want %v", err, ErrInvalid)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionInvalid(t *testing.T) {
+	const verified = flagUserPresent | flagUserVerified
+
+	a := newAuthenticator(t, AlgEdDSA)
+	c := Credential{ID: []byte("id"), PublicKey: a.coseKey(), SignCount: 5}
+	challenge := []byte("challenge")
+
+	assertion := func(typ, origin string, challenge []byte, rpID string, flags byte, signCount uint32) Assertion {
+		cd := makeClientData(typ, origin, challenge)
+		ad := makeAuthData(rpID, flags, signCount, nil, nil)
+		return Assertion{ClientDataJSON: cd, AuthenticatorData: ad, Signature: a.sign(t, ad, cd)}
+	}
+
+	truncated := assertion("webauthn.get", testRP.Origin, challenge, testRP.ID, verified, 6)
+	truncated.AuthenticatorData = truncated.AuthenticatorData[:36]
+
+	tests := []struct {
+		name       string
+		credential Credential
+		assertion  Assertion
+		err        error
+	}{
+		{name: "wrong type", assertion: assertion("webauthn.create", testRP.Origin, challenge, testRP.ID, verified, 6), err: ErrInvalid},
+		{name: "wrong origin", assertion: assertion("webauthn.get", "https://evil.example", challenge, testRP.ID, verified, 6), err: ErrInvalid},
+		{name: "wrong challenge", assertion: assertion("webauthn.get", testRP.Origin, []byte("other"), testRP.ID, verified, 6), err: ErrInvalid},
+		{name: "wrong rp id", assertion: assertion("webauthn.get", testRP.Origin, challenge, "evil.example", verified, 6), err: ErrInvalid},
+		{name: "user not verified", assertion: assertion("webauthn.get", testRP.Origin, challenge, testRP.ID, flagUserPresent, 6), err: ErrInvalid},
+		{name: "truncated authenticator data", assertion: truncated, err: ErrInvalid},
+		{name: "counter rollback", assertion: assertion("webauthn.get", testRP.Origin, challenge, testRP.ID, verified, 4), err: ErrCloned},
+		{name: "counter replay", assertion: assertion("webauthn.get", testRP.Origin, challenge, testRP.ID, verified, 5), err: ErrCloned},
+		{name: "counter reset", assertion: assertion("webauthn.get", testRP.Origin, challenge, testRP.ID, verified, 0), err: ErrCloned},
+		{
+			name:       "invalid stored key",
+			credential: Credential{ID: c.ID, PublicKey: c.PublicKey[:len(c.PublicKey)-1]},
+			assertion:  assertion("webauthn.get", testRP.Origin, challenge, testRP.ID, verified, 6),
+			err:        ErrInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cred := c
+			if tt.credential.ID != nil {
+				cred = tt.credential
+			}
+
+			if _, err := testRP.VerifyAssertion(challenge, cred, tt.assertion); !errors.Is(err, tt.err) {
+				t.Errorf("VerifyAssertion() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	// Authenticators without a counter always report zero.
+	zero := c
+	zero.SignCount = 0
+	got, err := testRP.VerifyAssertion(challenge, zero, assertion("webauthn.get", testRP.Origin, challenge, testRP.ID, verified, 0))
+	if err != nil || got != 0 {
+		t.Errorf("VerifyAssertion() without a counter = %d, %v, want 0, nil", got, err)
+	}
+}
@@ -1,10 +1,10 @@
+CREATE SCHEMA IF NOT EXISTS socnet;
+
 CREATE TABLE IF NOT EXISTS socnet.users (
     id SERIAL NOT NULL PRIMARY KEY,
     email VARCHAR NOT NULL UNIQUE,
     username VARCHAR NOT NULL UNIQUE,
-    avatar VARCHAR,
-    followers_count INT NOT NULL DEFAULT 0 CHECK (followers_count >=0),
-    followees_count INT NOT NULL DEFAULT 0 CHECK (followees_count >=0)
+    avatar VARCHAR
 );
 
 CREATE TABLE IF NOT EXISTS socnet.follows (
@@ -18,9 +18,9 @@ CREATE TABLE IF NOT EXISTS socnet.posts (
     user_id INT NOT NULL  REFERENCES socnet.users(id),
     content VARCHAR NOT NULL,
     spoiler_of VARCHAR,
-    nsfw BOOLEAN NOT NULL,
-    likes_count INT NOT NULL DEFAULT 0 CHECK (likes_count >=0)
-    comments_count INT NOT NULL DEFAULT 0 CHECK (comments_count >=0)
+    nsfw BOOLEAN NOT NULL DEFAULT false,
+    likes_count INT NOT NULL DEFAULT 0 CHECK (likes_count >=0),
+    comments_count INT NOT NULL DEFAULT 0 CHECK (comments_count >=0),
     created_at TIMESTAMPTZ NOT NULL DEFAULT now()
 );
 
@@ -54,7 +54,7 @@ CREATE INDEX IF NOT EXISTS sorted_comments ON socnet.comments (created_at DESC);
 CREATE TABLE IF NOT EXISTS socnet.comment_likes (
     user_id INT NOT NULL REFERENCES socnet.users(id),
     comment_id INT NOT NULL REFERENCES socnet.comments(id),
-    PRIMARY KEY (user_id, comments_id)
+    PRIMARY KEY (user_id, comment_id)
 );
 
 CREATE TABLE IF NOT EXISTS socnet.notifications (
@@ -68,17 +68,714 @@ CREATE TABLE IF NOT EXISTS socnet.notifications (
 
 CREATE INDEX IF NOT EXISTS sorted_notifications ON socnet.notifications (issued_at DESC);
 
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS role VARCHAR NOT NULL DEFAULT 'user';
+
+-- Extensions are shared by every schema of the database, so they go in public,
+-- which is on the search_path of each tenant after its own schema.
+CREATE EXTENSION IF NOT EXISTS pg_trgm WITH SCHEMA public;
+CREATE INDEX IF NOT EXISTS users_username_trgm ON socnet.users USING GIN (username gin_trgm_ops);
+
+CREATE TABLE IF NOT EXISTS socnet.sessions (
+    id SERIAL NOT NULL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES socnet.users(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user ON socnet.sessions (user_id);
+
+
+CREATE TABLE IF NOT EXISTS socnet.follow_imports (
+    id SERIAL NOT NULL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES socnet.users(id),
+    status VARCHAR NOT NULL DEFAULT 'pending',
+    total INT NOT NULL,
+    processed INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS socnet.follow_import_rows (
+    import_id INT NOT NULL REFERENCES socnet.follow_imports(id) ON DELETE CASCADE,
+    row INT NOT NULL,
+    username VARCHAR NOT NULL,
+    status VARCHAR NOT NULL DEFAULT 'pending',
+    error VARCHAR,
+    PRIMARY KEY (import_id, row)
+);
+
+ALTER TABLE socnet.follow_imports ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+
+CREATE TABLE IF NOT EXISTS socnet.lists (
+    id SERIAL NOT NULL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES socnet.users(id),
+    name VARCHAR NOT NULL,
+    members_count INT NOT NULL DEFAULT 0 CHECK (members_count >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS lists_user ON socnet.lists (user_id);
+
+CREATE TABLE IF NOT EXISTS socnet.list_members (
+    list_id INT NOT NULL REFERENCES socnet.lists(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES socnet.users(id),
+    PRIMARY KEY (list_id, user_id)
+);
+
+
+CREATE TABLE IF NOT EXISTS socnet.communities (
+    id SERIAL NOT NULL PRIMARY KEY,
+    name VARCHAR NOT NULL UNIQUE,
+    description VARCHAR NOT NULL DEFAULT '',
+    members_count INT NOT NULL DEFAULT 0 CHECK (members_count >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS socnet.community_members (
+    community_id INT NOT NULL REFERENCES socnet.communities(id),
+    user_id INT NOT NULL REFERENCES socnet.users(id),
+    role VARCHAR NOT NULL DEFAULT 'member',
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (community_id, user_id)
+);
+
+ALTER TABLE socnet.posts ADD COLUMN IF NOT EXISTS community_id INT REFERENCES socnet.communities(id);
+CREATE INDEX IF NOT EXISTS community_posts ON socnet.posts (community_id, id DESC) WHERE community_id IS NOT NULL;
+
+
+CREATE TABLE IF NOT EXISTS socnet.user_interests (
+    user_id INT NOT NULL REFERENCES socnet.users(id),
+    interest VARCHAR NOT NULL,
+    PRIMARY KEY (user_id, interest)
+);
+
+CREATE INDEX IF NOT EXISTS interest_users ON socnet.user_interests (interest, user_id);
+
+
+ALTER TABLE socnet.posts ADD COLUMN IF NOT EXISTS lang VARCHAR;
+
+CREATE TABLE IF NOT EXISTS socnet.post_translations (
+    post_id INT NOT NULL REFERENCES socnet.posts(id) ON DELETE CASCADE,
+    lang VARCHAR NOT NULL,
+    content VARCHAR NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (post_id, lang)
+);
+
+
+CREATE TABLE IF NOT EXISTS socnet.media (
+    id SERIAL NOT NULL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES socnet.users(id),
+    post_id INT REFERENCES socnet.posts(id) ON DELETE CASCADE,
+    kind VARCHAR NOT NULL,
+    filename VARCHAR NOT NULL,
+    alt_text VARCHAR,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS post_media ON socnet.media (post_id, id) WHERE post_id IS NOT NULL;
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS require_alt_text BOOLEAN NOT NULL DEFAULT false;
+
+
+ALTER TABLE socnet.media ADD COLUMN IF NOT EXISTS sensitive BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE socnet.media ADD COLUMN IF NOT EXISTS spoiler_of VARCHAR;
+
+
+CREATE TABLE IF NOT EXISTS socnet.custom_emojis (
+    id SERIAL NOT NULL PRIMARY KEY,
+    shortcode VARCHAR NOT NULL UNIQUE,
+    filename VARCHAR NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+
+CREATE TABLE IF NOT EXISTS socnet.word_filters (
+    id SERIAL NOT NULL PRIMARY KEY,
+    word VARCHAR NOT NULL UNIQUE,
+    action VARCHAR NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS socnet.post_reviews (
+    post_id INT NOT NULL PRIMARY KEY REFERENCES socnet.posts(id) ON DELETE CASCADE,
+    reason VARCHAR NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    resolved_at TIMESTAMPTZ
+);
+
+
+ALTER TABLE socnet.notifications ADD COLUMN IF NOT EXISTS post_id INT REFERENCES socnet.posts(id) ON DELETE CASCADE;
+
+CREATE TABLE IF NOT EXISTS socnet.keyword_alerts (
+    id SERIAL NOT NULL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES socnet.users(id),
+    keyword VARCHAR NOT NULL,
+    scope VARCHAR NOT NULL DEFAULT 'followees',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, keyword)
+);
+
+CREATE INDEX IF NOT EXISTS keyword_alerts_keyword ON socnet.keyword_alerts (keyword);
+
+
+CREATE INDEX IF NOT EXISTS posts_content_trgm ON socnet.posts USING GIN (content gin_trgm_ops);
+
+CREATE TABLE IF NOT EXISTS socnet.saved_searches (
+    id SERIAL NOT NULL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES socnet.users(id),
+    name VARCHAR NOT NULL,
+    kind VARCHAR NOT NULL,
+    query VARCHAR NOT NULL,
+    last_seen_id INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, name)
+);
+
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS auto_delete_after_days INT CHECK (auto_delete_after_days > 0);
+ALTER TABLE socnet.posts ADD COLUMN IF NOT EXISTS pinned BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS socnet.post_bookmarks (
+    user_id INT NOT NULL REFERENCES socnet.users(id),
+    post_id INT NOT NULL REFERENCES socnet.posts(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, post_id)
+);
+
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS nsfw_preference VARCHAR NOT NULL DEFAULT 'blur';
+
+
+CREATE TABLE IF NOT EXISTS socnet.timeline_markers (
+    user_id INT NOT NULL PRIMARY KEY REFERENCES socnet.users(id),
+    timeline_item_id INT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+
+CREATE TABLE IF NOT EXISTS socnet.post_subscriptions (
+    subscriber_id INT NOT NULL REFERENCES socnet.users(id),
+    user_id INT NOT NULL REFERENCES socnet.users(id),
+    PRIMARY KEY (subscriber_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS post_subscriptions_user_id ON socnet.post_subscriptions (user_id);
+
+
+CREATE TABLE IF NOT EXISTS socnet.feature_flags (
+    name VARCHAR NOT NULL PRIMARY KEY,
+    description VARCHAR NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    rollout INT NOT NULL DEFAULT 0 CHECK (rollout BETWEEN 0 AND 100),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS socnet.feature_flag_users (
+    flag_name VARCHAR NOT NULL REFERENCES socnet.feature_flags(name) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES socnet.users(id),
+    PRIMARY KEY (flag_name, user_id)
+);
+
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS locale VARCHAR NOT NULL DEFAULT 'en';
+
+
+CREATE TABLE IF NOT EXISTS socnet.email_suppressions (
+    email VARCHAR NOT NULL PRIMARY KEY,
+    reason VARCHAR NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+
+CREATE TABLE IF NOT EXISTS socnet.push_devices (
+    id SERIAL NOT NULL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES socnet.users(id),
+    platform VARCHAR NOT NULL,
+    token VARCHAR NOT NULL UNIQUE,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    muted_types VARCHAR[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS push_devices_user_id ON socnet.push_devices (user_id);
+
+
+ALTER TABLE socnet.sessions ADD COLUMN IF NOT EXISTS user_agent VARCHAR;
+ALTER TABLE socnet.sessions ADD COLUMN IF NOT EXISTS ip VARCHAR;
+ALTER TABLE socnet.sessions ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ;
+
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS online_until TIMESTAMPTZ;
+
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS show_last_active BOOLEAN NOT NULL DEFAULT true;
+
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS verified BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS socnet.audit_log (
+    id SERIAL NOT NULL PRIMARY KEY,
+    actor_id INT REFERENCES socnet.users(id) ON DELETE SET NULL,
+    action VARCHAR NOT NULL,
+    target_user_id INT REFERENCES socnet.users(id) ON DELETE SET NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_lower ON socnet.users (lower(username));
+
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS username_skeleton VARCHAR;
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_skeleton ON socnet.users (username_skeleton);
+
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS follow_lists_visibility VARCHAR NOT NULL DEFAULT 'everyone';
+
+
+ALTER TABLE socnet.follows ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE socnet.post_likes ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS reputation INT NOT NULL DEFAULT 0;
+
+
+CREATE TABLE IF NOT EXISTS socnet.leaderboard_entries (
+    board VARCHAR NOT NULL,
+    rank INT NOT NULL,
+    user_id INT NOT NULL REFERENCES socnet.users(id) ON DELETE CASCADE,
+    score INT NOT NULL,
+    refreshed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (board, rank)
+);
+
+
+ALTER TABLE socnet.posts ADD COLUMN IF NOT EXISTS community_pinned_at TIMESTAMPTZ;
+
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS default_license VARCHAR NOT NULL DEFAULT 'all-rights-reserved';
+ALTER TABLE socnet.posts ADD COLUMN IF NOT EXISTS license VARCHAR NOT NULL DEFAULT 'all-rights-reserved';
+
+
+CREATE TABLE IF NOT EXISTS socnet.post_locations (
+    post_id INT NOT NULL PRIMARY KEY REFERENCES socnet.posts(id) ON DELETE CASCADE,
+    latitude DOUBLE PRECISION,
+    longitude DOUBLE PRECISION,
+    place VARCHAR,
+    CHECK ((latitude IS NULL) = (longitude IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS post_locations_coordinates ON socnet.post_locations (latitude, longitude);
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS strip_post_location BOOLEAN NOT NULL DEFAULT false;
+
+
+CREATE EXTENSION IF NOT EXISTS postgis WITH SCHEMA public;
+
+CREATE TABLE IF NOT EXISTS socnet.places (
+    id SERIAL NOT NULL PRIMARY KEY,
+    geonames_id INT UNIQUE,
+    name VARCHAR NOT NULL,
+    country VARCHAR,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    geog GEOGRAPHY(Point, 4326) GENERATED ALWAYS AS (ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)::geography) STORED
+);
+
+CREATE INDEX IF NOT EXISTS places_name_trgm ON socnet.places USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS places_geog ON socnet.places USING GIST (geog);
+
+ALTER TABLE socnet.post_locations ADD COLUMN IF NOT EXISTS place_id INT REFERENCES socnet.places(id) ON DELETE SET NULL;
+ALTER TABLE socnet.post_locations ADD COLUMN IF NOT EXISTS geog GEOGRAPHY(Point, 4326)
+    GENERATED ALWAYS AS (ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)::geography) STORED;
+DROP INDEX IF EXISTS socnet.post_locations_coordinates;
+CREATE INDEX IF NOT EXISTS post_locations_geog ON socnet.post_locations USING GIST (geog);
+
+
+CREATE TABLE IF NOT EXISTS socnet.uploads (
+    id VARCHAR NOT NULL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES socnet.users(id) ON DELETE CASCADE,
+    content_type VARCHAR NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS uploads_user_id ON socnet.uploads (user_id);
+
+
+ALTER TABLE socnet.uploads ADD COLUMN IF NOT EXISTS storage VARCHAR NOT NULL DEFAULT 's3';
+ALTER TABLE socnet.uploads ADD COLUMN IF NOT EXISTS upload_offset BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE socnet.uploads ALTER COLUMN content_type DROP NOT NULL;
+ALTER TABLE socnet.uploads ADD COLUMN IF NOT EXISTS writing_since TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS uploads_expires_at ON socnet.uploads (expires_at);
+
+
+ALTER TABLE socnet.media ADD COLUMN IF NOT EXISTS thumbnail VARCHAR;
+
+
+CREATE TABLE IF NOT EXISTS socnet.post_links (
+    id SERIAL NOT NULL PRIMARY KEY,
+    code VARCHAR NOT NULL UNIQUE,
+    post_id INT NOT NULL REFERENCES socnet.posts(id) ON DELETE CASCADE,
+    url VARCHAR NOT NULL,
+    clicks INT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS post_links_post_id ON socnet.post_links (post_id);
+
+
+CREATE TABLE IF NOT EXISTS socnet.link_previews (
+    url VARCHAR NOT NULL PRIMARY KEY,
+    title VARCHAR,
+    description VARCHAR,
+    image_url VARCHAR,
+    site_name VARCHAR,
+    fetched_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    refreshing_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS socnet.link_preview_aliases (
+    url VARCHAR NOT NULL PRIMARY KEY,
+    preview_url VARCHAR NOT NULL REFERENCES socnet.link_previews(url) ON DELETE CASCADE
+);
+
+ALTER TABLE socnet.post_links ADD COLUMN IF NOT EXISTS preview_url VARCHAR REFERENCES socnet.link_previews(url) ON DELETE SET NULL;
+
+
+ALTER TABLE socnet.posts ADD COLUMN IF NOT EXISTS thread_id INT REFERENCES socnet.posts(id) ON DELETE SET NULL;
+ALTER TABLE socnet.posts ADD COLUMN IF NOT EXISTS reply_to_post_id INT REFERENCES socnet.posts(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS posts_thread_id ON socnet.posts (thread_id);
+
+
+ALTER TABLE socnet.posts ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT false;
+
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS weekly_insights_email BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS weekly_insights_sent_at TIMESTAMPTZ;
+
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS likes_visibility VARCHAR NOT NULL DEFAULT 'everyone';
+
+
+CREATE INDEX IF NOT EXISTS post_likes_post_id_created_at ON socnet.post_likes (post_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS comments_post_id_created_at ON socnet.comments (post_id, created_at DESC);
+
+
+ALTER TABLE socnet.posts ADD COLUMN IF NOT EXISTS fanout_shed BOOLEAN NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS shed_posts ON socnet.posts (created_at DESC) WHERE fanout_shed;
+
+
+CREATE TABLE IF NOT EXISTS socnet.fanout_outbox (
+    post_id INT NOT NULL PRIMARY KEY REFERENCES socnet.posts(id) ON DELETE CASCADE,
+    attempts INT NOT NULL DEFAULT 0,
+    available_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+
+CREATE TABLE IF NOT EXISTS socnet.events (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    type VARCHAR NOT NULL,
+    actor_id INT NOT NULL,
+    target_id BIGINT NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp()
+);
+CREATE INDEX IF NOT EXISTS events_type ON socnet.events (type, id);
+CREATE OR REPLACE FUNCTION socnet.events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'events are append-only';
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS events_append_only ON socnet.events;
+CREATE TRIGGER events_append_only BEFORE UPDATE OR DELETE ON socnet.events
+    FOR EACH ROW EXECUTE FUNCTION socnet.events_append_only();
+
+
+-- Insert time rather than tx start, which eventSettleDelay is measured against.
+ALTER TABLE socnet.events ALTER COLUMN created_at SET DEFAULT clock_timestamp();
+
+CREATE TABLE IF NOT EXISTS socnet.user_stats (
+    user_id INT NOT NULL PRIMARY KEY REFERENCES socnet.users(id) ON DELETE CASCADE,
+    followers_count INT NOT NULL DEFAULT 0 CHECK (followers_count >= 0),
+    followees_count INT NOT NULL DEFAULT 0 CHECK (followees_count >= 0),
+    posts_count INT NOT NULL DEFAULT 0 CHECK (posts_count >= 0)
+);
+
+-- How far each read model has replayed the events journal.
+CREATE TABLE IF NOT EXISTS socnet.projections (
+    name VARCHAR NOT NULL PRIMARY KEY,
+    last_event_id BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+INSERT INTO socnet.projections (name, last_event_id)
+VALUES ('user_stats', (SELECT COALESCE(max(id), 0) FROM socnet.events))
+ON CONFLICT DO NOTHING;
+
+-- The counts used to live on users, updated in the tx of every follow.
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM pg_attribute
+        WHERE attrelid = 'socnet.users'::regclass AND attname = 'followers_count' AND NOT attisdropped
+    ) THEN
+        INSERT INTO socnet.user_stats (user_id, followers_count, followees_count, posts_count)
+        SELECT u.id, u.followers_count, u.followees_count, (SELECT count(*) FROM socnet.posts WHERE user_id = u.id)
+        FROM socnet.users u
+        ON CONFLICT DO NOTHING;
+        ALTER TABLE socnet.users DROP COLUMN followers_count, DROP COLUMN followees_count;
+    END IF;
+END
+$$;
+
+
+ALTER TABLE socnet.sessions ADD COLUMN IF NOT EXISTS impersonator_id INT REFERENCES socnet.users(id);
+ALTER TABLE socnet.sessions ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+
+CREATE TABLE IF NOT EXISTS socnet.consents (
+    user_id INT NOT NULL REFERENCES socnet.users(id),
+    version VARCHAR NOT NULL,
+    accepted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    user_agent VARCHAR,
+    ip VARCHAR,
+    PRIMARY KEY (user_id, version)
+);
+
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS birthdate DATE;
+
+
+CREATE INDEX IF NOT EXISTS events_actor ON socnet.events (actor_id, type, created_at);
+
+CREATE TABLE IF NOT EXISTS socnet.follow_throttles (
+    id SERIAL NOT NULL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES socnet.users(id) ON DELETE CASCADE,
+    reason VARCHAR NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS follow_throttles_user ON socnet.follow_throttles (user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS socnet.user_reviews (
+    user_id INT NOT NULL PRIMARY KEY REFERENCES socnet.users(id) ON DELETE CASCADE,
+    reason VARCHAR NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    resolved_at TIMESTAMPTZ
+);
+
+
+CREATE TABLE IF NOT EXISTS socnet.passkeys (
+    id BYTEA NOT NULL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES socnet.users(id) ON DELETE CASCADE,
+    public_key BYTEA NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    name VARCHAR NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS passkeys_user ON socnet.passkeys (user_id);
+
+CREATE TABLE IF NOT EXISTS socnet.passkey_challenges (
+    challenge BYTEA NOT NULL PRIMARY KEY,
+    user_id INT REFERENCES socnet.users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMPTZ;
+
+
+CREATE TABLE IF NOT EXISTS socnet.oidc_states (
+    state VARCHAR NOT NULL PRIMARY KEY,
+    nonce VARCHAR NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+
+CREATE TABLE IF NOT EXISTS socnet.user_activity (
+    user_id INT NOT NULL REFERENCES socnet.users(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    PRIMARY KEY (day, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS socnet.active_user_counts (
+    day DATE NOT NULL PRIMARY KEY,
+    dau INT NOT NULL,
+    wau INT NOT NULL,
+    mau INT NOT NULL
+);
+
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ;
+ALTER TABLE socnet.users ALTER COLUMN created_at SET DEFAULT now();
+
+CREATE TABLE IF NOT EXISTS socnet.cohort_retention (
+    cohort DATE NOT NULL,
+    week INT NOT NULL,
+    cohort_size INT NOT NULL,
+    active_users INT NOT NULL,
+    PRIMARY KEY (cohort, week)
+);
+
+
+CREATE TABLE IF NOT EXISTS socnet.experiments (
+    name VARCHAR NOT NULL PRIMARY KEY,
+    description VARCHAR NOT NULL DEFAULT '',
+    running BOOLEAN NOT NULL DEFAULT false,
+    variants JSONB NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE socnet.events ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '{}';
+
+
+CREATE TABLE IF NOT EXISTS socnet.announcements (
+    id SERIAL NOT NULL PRIMARY KEY,
+    text VARCHAR NOT NULL,
+    severity VARCHAR NOT NULL DEFAULT 'info',
+    starts_at TIMESTAMPTZ,
+    ends_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS socnet.announcement_dismissals (
+    announcement_id INT NOT NULL REFERENCES socnet.announcements(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES socnet.users(id) ON DELETE CASCADE,
+    PRIMARY KEY (announcement_id, user_id)
+);
+
+
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMPTZ;
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS suspended_until TIMESTAMPTZ;
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS suspension_reason VARCHAR;
+
+
+-- When a profile last changed, for conditional requests.
+ALTER TABLE socnet.users ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE socnet.user_stats ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+CREATE OR REPLACE FUNCTION socnet.touch_updated_at() RETURNS trigger AS $$
+BEGIN
+    NEW.updated_at = now();
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS users_updated_at ON socnet.users;
+CREATE TRIGGER users_updated_at BEFORE UPDATE ON socnet.users
+    FOR EACH ROW WHEN (OLD IS DISTINCT FROM NEW) EXECUTE FUNCTION socnet.touch_updated_at();
+DROP TRIGGER IF EXISTS user_stats_updated_at ON socnet.user_stats;
+CREATE TRIGGER user_stats_updated_at BEFORE UPDATE ON socnet.user_stats
+    FOR EACH ROW WHEN (OLD IS DISTINCT FROM NEW) EXECUTE FUNCTION socnet.touch_updated_at();
+
+
+-- Delta sync. Synced rows take a sync_id on every change, from one sequence
+-- along with the removals, so clients resume from the last one they saw.
+CREATE SEQUENCE IF NOT EXISTS socnet.sync_seq;
+CREATE TABLE IF NOT EXISTS socnet.sync_removals (
+    id BIGINT NOT NULL PRIMARY KEY DEFAULT nextval('socnet.sync_seq'),
+    user_id INT NOT NULL REFERENCES socnet.users(id) ON DELETE CASCADE,
+    resource VARCHAR NOT NULL,
+    item_id BIGINT NOT NULL,
+    removed_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp()
+);
+CREATE INDEX IF NOT EXISTS sync_removals_user_id ON socnet.sync_removals (user_id, resource, id);
+CREATE INDEX IF NOT EXISTS sync_removals_removed_at ON socnet.sync_removals (removed_at);
+
+ALTER TABLE socnet.timeline ADD COLUMN IF NOT EXISTS sync_id BIGINT NOT NULL DEFAULT nextval('socnet.sync_seq');
+ALTER TABLE socnet.timeline ADD COLUMN IF NOT EXISTS synced_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp();
+CREATE INDEX IF NOT EXISTS timeline_sync_id ON socnet.timeline (user_id, sync_id);
+ALTER TABLE socnet.notifications ADD COLUMN IF NOT EXISTS sync_id BIGINT NOT NULL DEFAULT nextval('socnet.sync_seq');
+ALTER TABLE socnet.notifications ADD COLUMN IF NOT EXISTS synced_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp();
+CREATE INDEX IF NOT EXISTS notifications_sync_id ON socnet.notifications (user_id, sync_id);
+ALTER TABLE socnet.post_bookmarks ADD COLUMN IF NOT EXISTS sync_id BIGINT NOT NULL DEFAULT nextval('socnet.sync_seq');
+ALTER TABLE socnet.post_bookmarks ADD COLUMN IF NOT EXISTS synced_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp();
+CREATE INDEX IF NOT EXISTS post_bookmarks_sync_id ON socnet.post_bookmarks (user_id, sync_id);
+
+CREATE OR REPLACE FUNCTION socnet.sync_changed() RETURNS trigger AS $$
+BEGIN
+    NEW.sync_id = nextval('socnet.sync_seq');
+    NEW.synced_at = clock_timestamp();
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS notifications_sync_changed ON socnet.notifications;
+CREATE TRIGGER notifications_sync_changed BEFORE UPDATE ON socnet.notifications
+    FOR EACH ROW WHEN (OLD IS DISTINCT FROM NEW) EXECUTE FUNCTION socnet.sync_changed();
+
+-- Takes the resource and the column of the item id. Timeline items are noted
+-- where posts are deleted instead, so pruning timelines isn't synced.
+CREATE OR REPLACE FUNCTION socnet.sync_removed() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO socnet.sync_removals (user_id, resource, item_id)
+    VALUES (OLD.user_id, TG_ARGV[0], (to_jsonb(OLD) ->> TG_ARGV[1])::BIGINT);
+    RETURN OLD;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS notifications_sync_removed ON socnet.notifications;
+CREATE TRIGGER notifications_sync_removed AFTER DELETE ON socnet.notifications
+    FOR EACH ROW EXECUTE FUNCTION socnet.sync_removed('notifications', 'id');
+DROP TRIGGER IF EXISTS post_bookmarks_sync_removed ON socnet.post_bookmarks;
+CREATE TRIGGER post_bookmarks_sync_removed AFTER DELETE ON socnet.post_bookmarks
+    FOR EACH ROW EXECUTE FUNCTION socnet.sync_removed('bookmarks', 'post_id');
+
+
+CREATE TABLE IF NOT EXISTS socnet.api_keys (
+    id SERIAL NOT NULL PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    key_hash BYTEA NOT NULL UNIQUE,
+    daily_quota INT NOT NULL,
+    rate_limit INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS socnet.api_key_usage (
+    api_key_id INT NOT NULL REFERENCES socnet.api_keys(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    requests INT NOT NULL DEFAULT 0,
+    refused INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (api_key_id, day)
+);
+
 
 INSERT INTO socnet.users (id, email, username) VALUES
 (1, 'mladen@example.org', 'mladen'),
 (2, 'milutin@example.org', 'milutin'),
-(3, 'momcilo@example.org', 'momcilo');
+(3, 'momcilo@example.org', 'momcilo')
+ON CONFLICT DO NOTHING;
 
 INSERT INTO socnet.posts (id, user_id, content, comments_count) VALUES
-(1, 1, 'sample post', 1);
+(1, 1, 'sample post', 1)
+ON CONFLICT DO NOTHING;
 
 INSERT INTO socnet.timeline (id, user_id, post_id) VALUES
-(1, 1, 1);
+(1, 1, 1)
+ON CONFLICT DO NOTHING;
 
 INSERT INTO socnet.comments (id, user_id, post_id, content) VALUES
-(1, 1, 1, 'sample post');
\ No newline at end of file
+(1, 1, 1, 'sample post')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO socnet.user_stats (user_id, posts_count) VALUES
+(1, 1)
+ON CONFLICT DO NOTHING;
+
+-- Usernames created before Unicode support are ASCII, whose skeleton
+-- only folds case and the 0 and 1 lookalikes.
+UPDATE socnet.users SET username_skeleton = translate(lower(username), '01', 'ol')
+WHERE username_skeleton IS NULL;
+
+SELECT setval('socnet.users_id_seq', (SELECT max(id) FROM socnet.users));
+SELECT setval('socnet.posts_id_seq', (SELECT max(id) FROM socnet.posts));
+SELECT setval('socnet.timeline_id_seq', (SELECT max(id) FROM socnet.timeline));
+SELECT setval('socnet.comments_id_seq', (SELECT max(id) FROM socnet.comments));
+
+-- The transaction of each event, so replays wait for it to finish instead of
+-- expecting it to commit within a delay. Events journaled before have none.
+ALTER TABLE socnet.events ADD COLUMN IF NOT EXISTS xact_id xid8;
+CREATE INDEX IF NOT EXISTS events_xact_id ON socnet.events (xact_id);
+ALTER TABLE socnet.projections ADD COLUMN IF NOT EXISTS last_snapshot pg_snapshot;
@@ -0,0 +1,28 @@
+// Package socnet holds the resources shared by the commands under cmd.
+package socnet
+
+import (
+	// embed the database schema.
+	_ "embed"
+	"strings"
+)
+
+// Schema of the database.
+// Every statement is idempotent so it can be applied on each migration.
+//
+//go:embed schema.sql
+var Schema string
+
+// DefaultSchemaName is the database schema Schema creates.
+const DefaultSchemaName = "socnet"
+
+// SchemaFor returns Schema creating the database schema with the given name
+// instead, so each tenant of a multi tenant instance gets its own.
+func SchemaFor(name string) string {
+	if name == "" || name == DefaultSchemaName {
+		return Schema
+	}
+
+	s := strings.Replace(Schema, "CREATE SCHEMA IF NOT EXISTS "+DefaultSchemaName+";", "CREATE SCHEMA IF NOT EXISTS "+name+";", 1)
+	return strings.ReplaceAll(s, DefaultSchemaName+".", name+".")
+}
@@ -0,0 +1,20 @@
+// Package web holds the frontend served next to the API.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed static
+var static embed.FS
+
+// Static returns the embedded frontend files rooted at web/static.
+func Static() fs.FS {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+
+	return sub
+}